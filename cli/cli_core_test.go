@@ -55,6 +55,8 @@ func resetFlagSet(fs *pflag.FlagSet) {
 		switch f.Value.Type() {
 		case "stringSlice":
 			_ = f.Value.Set("")
+		case "stringArray":
+			_ = f.Value.(pflag.SliceValue).Replace(nil)
 		default:
 			_ = f.Value.Set(f.DefValue)
 		}
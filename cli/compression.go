@@ -46,7 +46,7 @@ func init() {
 			if err != nil {
 				return err
 			}
-			ledger = l
+			bindLedger(l)
 			h, _ := ledger.Head()
 			compOut(map[string]uint64{"height": uint64(h)}, fmt.Sprintf("height: %d", h))
 			return nil
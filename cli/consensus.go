@@ -33,7 +33,89 @@ func ensureConsensusValidator() (string, error) {
 	return consensusMinerAddr, consensusMinerError
 }
 
+type consensusMineParams struct {
+	Difficulty uint8 `json:"difficulty"`
+}
+
+type consensusLoadParams struct {
+	Demand float64 `json:"demand"`
+	Threat float64 `json:"threat,omitempty"`
+	Stake  float64 `json:"stake"`
+}
+
+type consensusDifficultyParams struct {
+	Old      float64 `json:"old"`
+	Actual   float64 `json:"actual"`
+	Expected float64 `json:"expected"`
+}
+
+type consensusAvailabilityParams struct {
+	PoW bool `json:"pow"`
+	PoS bool `json:"pos"`
+	PoH bool `json:"poh"`
+}
+
+type consensusToggleParams struct {
+	Enabled bool `json:"enabled"`
+}
+
+func consensusWeights() map[string]float64 {
+	weights := consensus.WeightsSnapshot()
+	return map[string]float64{"pow": weights.PoW, "pos": weights.PoS, "poh": weights.PoH}
+}
+
 func init() {
+	registerMethod("consensus_mine", func(p consensusMineParams) (any, error) {
+		validator, err := ensureConsensusValidator()
+		if err != nil {
+			return nil, err
+		}
+		sb := core.NewSubBlock([]*core.Transaction{}, validator)
+		if err := core.SignSubBlock(sb); err != nil {
+			return nil, err
+		}
+		b := core.NewBlock([]*core.SubBlock{sb}, "")
+		consensus.MineBlock(b, p.Difficulty)
+		ilog.Info("cli_mine", "nonce", b.Nonce)
+		return map[string]any{"nonce": b.Nonce}, nil
+	})
+	registerMethod("consensus_weights", func(struct{}) (any, error) {
+		w := consensusWeights()
+		ilog.Info("cli_weights", "pow", w["pow"], "pos", w["pos"], "poh", w["poh"])
+		return w, nil
+	})
+	registerMethod("consensus_adjustWeights", func(p consensusLoadParams) (any, error) {
+		consensus.AdjustWeights(p.Demand, p.Stake)
+		w := consensusWeights()
+		ilog.Info("cli_adjust", "pow", w["pow"], "pos", w["pos"], "poh", w["poh"])
+		return w, nil
+	})
+	registerMethod("consensus_threshold", func(p consensusLoadParams) (any, error) {
+		th := consensus.Threshold(p.Demand, p.Stake)
+		ilog.Info("cli_threshold", "value", th)
+		return map[string]float64{"threshold": th}, nil
+	})
+	registerMethod("consensus_transitionThreshold", func(p consensusLoadParams) (any, error) {
+		thr := consensus.TransitionThreshold(p.Demand, p.Threat, p.Stake)
+		ilog.Info("cli_transition", "value", thr)
+		return map[string]float64{"threshold": thr}, nil
+	})
+	registerMethod("consensus_adjustDifficulty", func(p consensusDifficultyParams) (any, error) {
+		nd := consensus.DifficultyAdjust(p.Old, p.Actual, p.Expected)
+		ilog.Info("cli_difficulty", "value", nd)
+		return map[string]float64{"difficulty": nd}, nil
+	})
+	registerMethod("consensus_setAvailability", func(p consensusAvailabilityParams) (any, error) {
+		consensus.SetAvailability(p.PoW, p.PoS, p.PoH)
+		ilog.Info("cli_availability", "pow", p.PoW, "pos", p.PoS, "poh", p.PoH)
+		return map[string]bool{"pow": p.PoW, "pos": p.PoS, "poh": p.PoH}, nil
+	})
+	registerMethod("consensus_setPoWRewards", func(p consensusToggleParams) (any, error) {
+		consensus.SetPoWRewards(p.Enabled)
+		ilog.Info("cli_pow_rewards", "enabled", p.Enabled)
+		return map[string]bool{"enabled": p.Enabled}, nil
+	})
+
 	consensusCmd := &cobra.Command{
 		Use:   "consensus",
 		Short: "Consensus operations",
@@ -48,21 +130,13 @@ func init() {
 				printOutput(map[string]any{"error": "invalid difficulty"})
 				return
 			}
-			validator, err := ensureConsensusValidator()
+			res, err := invoke("consensus_mine", consensusMineParams{Difficulty: uint8(diff)})
 			if err != nil {
 				printOutput(map[string]any{"error": err.Error()})
 				return
 			}
-			sb := core.NewSubBlock([]*core.Transaction{}, validator)
-			if err := core.SignSubBlock(sb); err != nil {
-				printOutput(map[string]any{"error": err.Error()})
-				return
-			}
-			b := core.NewBlock([]*core.SubBlock{sb}, "")
-			consensus.MineBlock(b, uint8(diff))
-			ilog.Info("cli_mine", "nonce", b.Nonce)
 			gasPrint("MineBlock")
-			printOutput(map[string]any{"nonce": b.Nonce})
+			printOutput(res)
 		},
 	}
 
@@ -71,9 +145,7 @@ func init() {
 		Short: "Show current consensus weights",
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("Weights")
-			weights := consensus.WeightsSnapshot()
-			ilog.Info("cli_weights", "pow", weights.PoW, "pos", weights.PoS, "poh", weights.PoH)
-			printOutput(map[string]float64{"pow": weights.PoW, "pos": weights.PoS, "poh": weights.PoH})
+			printResult(invoke("consensus_weights", nil))
 		},
 	}
 
@@ -92,11 +164,8 @@ func init() {
 				printOutput(map[string]any{"error": "invalid stake"})
 				return
 			}
-			consensus.AdjustWeights(d, s)
-			weights := consensus.WeightsSnapshot()
-			ilog.Info("cli_adjust", "pow", weights.PoW, "pos", weights.PoS, "poh", weights.PoH)
 			gasPrint("AdjustWeights")
-			printOutput(map[string]float64{"pow": weights.PoW, "pos": weights.PoS, "poh": weights.PoH})
+			printResult(invoke("consensus_adjustWeights", consensusLoadParams{Demand: d, Stake: s}))
 		},
 	}
 
@@ -115,10 +184,8 @@ func init() {
 				printOutput(map[string]any{"error": "invalid stake"})
 				return
 			}
-			th := consensus.Threshold(d, s)
-			ilog.Info("cli_threshold", "value", th)
 			gasPrint("Threshold")
-			printOutput(map[string]float64{"threshold": th})
+			printResult(invoke("consensus_threshold", consensusLoadParams{Demand: d, Stake: s}))
 		},
 	}
 
@@ -142,10 +209,8 @@ func init() {
 				printOutput(map[string]any{"error": "invalid stake"})
 				return
 			}
-			thr := consensus.TransitionThreshold(d, t, s)
-			ilog.Info("cli_transition", "value", thr)
 			gasPrint("TransitionThreshold")
-			printOutput(map[string]float64{"threshold": thr})
+			printResult(invoke("consensus_transitionThreshold", consensusLoadParams{Demand: d, Threat: t, Stake: s}))
 		},
 	}
 
@@ -169,10 +234,8 @@ func init() {
 				printOutput(map[string]any{"error": "invalid expected"})
 				return
 			}
-			nd := consensus.DifficultyAdjust(old, actual, expected)
-			ilog.Info("cli_difficulty", "value", nd)
 			gasPrint("DifficultyAdjust")
-			printOutput(map[string]float64{"difficulty": nd})
+			printResult(invoke("consensus_adjustDifficulty", consensusDifficultyParams{Old: old, Actual: actual, Expected: expected}))
 		},
 	}
 
@@ -196,10 +259,8 @@ func init() {
 				printOutput(map[string]any{"error": "invalid poh"})
 				return
 			}
-			consensus.SetAvailability(pow, pos, poh)
-			ilog.Info("cli_availability", "pow", pow, "pos", pos, "poh", poh)
 			gasPrint("SetAvailability")
-			printOutput(map[string]bool{"pow": pow, "pos": pos, "poh": poh})
+			printResult(invoke("consensus_setAvailability", consensusAvailabilityParams{PoW: pow, PoS: pos, PoH: poh}))
 		},
 	}
 
@@ -213,10 +274,8 @@ func init() {
 				printOutput(map[string]any{"error": "invalid flag"})
 				return
 			}
-			consensus.SetPoWRewards(en)
-			ilog.Info("cli_pow_rewards", "enabled", en)
 			gasPrint("SetPoWRewards")
-			printOutput(map[string]bool{"enabled": en})
+			printResult(invoke("consensus_setPoWRewards", consensusToggleParams{Enabled: en}))
 		},
 	}
 
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"synnergy/pkg/abi"
+)
+
+func init() {
+	registerMethod("contracts_abi", func(p contractAddrParams) (any, error) {
+		c, ok := contractRegistry.Get(p.Address)
+		if !ok {
+			return nil, fmt.Errorf("contract not found")
+		}
+		return c.ABI()
+	})
+}
+
+// contractABI fetches the ABI of the contract at addr, or nil when its
+// manifest declares none.
+func contractABI(addr string) (*abi.ABI, error) {
+	return invokeAs[*abi.ABI]("contracts_abi", contractAddrParams{Address: addr})
+}
+
+// encodeCallArgs encodes name=value pairs as the inputs of m, parsing each
+// value according to its declared type.
+func encodeCallArgs(m *abi.Method, pairs []string) ([]byte, error) {
+	values := make(map[string]any, len(pairs))
+	for _, pair := range pairs {
+		name, text, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("argument %q must be name=value", pair)
+		}
+		var param *abi.Param
+		for i := range m.Inputs {
+			if m.Inputs[i].Name == name {
+				param = &m.Inputs[i]
+			}
+		}
+		if param == nil {
+			return nil, fmt.Errorf("%s has no argument %s", m.Signature(), name)
+		}
+		v, err := abi.ParseValue(param.Type, text)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %w", name, err)
+		}
+		values[name] = v
+	}
+	return m.EncodeNamedArgs(values)
+}
+
+// printDecodedOutput prints the outputs of m decoded from out, one
+// name: value line each in declaration order, followed by the gas used.
+// With --json the decoded outputs and gas are printed as an object.
+func printDecodedOutput(w io.Writer, m *abi.Method, out []byte, gas uint64) error {
+	values, err := m.DecodeOutputs(out)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printOutput(map[string]any{"outputs": values, "gas": gas})
+		return nil
+	}
+	for i, p := range m.Outputs {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		fmt.Fprintf(w, "%s: %s\n", name, abi.FormatValue(values[name]))
+	}
+	fmt.Fprintf(w, "gas: %d\n", gas)
+	return nil
+}
+
+func newContractsABICmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "abi <address>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Show the typed interface a contract declares",
+		Long: `List the methods and events declared under the "abi" key of a contract's
+manifest with their argument and return types and mutability.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := contractABI(args[0])
+			if err != nil {
+				return err
+			}
+			if a == nil {
+				return fmt.Errorf("contract %s declares no abi", args[0])
+			}
+			if jsonOutput {
+				printOutput(a)
+				return nil
+			}
+			w := cmd.OutOrStdout()
+			for _, m := range a.Methods {
+				mut := m.Mutability
+				if mut == "" {
+					mut = abi.Mutable
+				}
+				fmt.Fprintf(w, "method %s(%s)", m.Name, formatParams(m.Inputs))
+				if len(m.Outputs) > 0 {
+					fmt.Fprintf(w, " -> (%s)", formatParams(m.Outputs))
+				}
+				fmt.Fprintf(w, " %s\n", mut)
+			}
+			for _, e := range a.Events {
+				fmt.Fprintf(w, "event %s(%s) id=%s\n", e.Name, formatParams(e.Inputs), e.ID())
+			}
+			return nil
+		},
+	}
+}
+
+func formatParams(params []abi.Param) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = strings.TrimSpace(p.Name + " " + p.Type)
+		if p.Indexed {
+			parts[i] += " indexed"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"synnergy/core"
+)
+
+// addModule exports add(i64, i64) i64.
+const addModule = "0061736d01000000" +
+	"01070160027e7e017e" +
+	"03020100" +
+	"070701036164640000" +
+	"0a09010700200020017c0b"
+
+const addManifest = `{"name":"adder","abi":{"methods":[
+	{"name":"add","inputs":[{"name":"a","type":"uint64"},{"name":"b","type":"uint64"}],"outputs":[{"name":"sum","type":"uint64"}],"mutability":"view"}
+]}}`
+
+func TestContractsInvokeTypedArgs(t *testing.T) {
+	prev := ledger
+	l := core.NewLedger()
+	bindLedger(l)
+	t.Cleanup(func() { bindLedger(prev) })
+	l.Credit("owner", 100_000)
+	wasm, _ := hex.DecodeString(addModule)
+	addr, err := contractRegistry.Deploy(wasm, addManifest, 5_000, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+
+	out, err := execCommand("contracts", "abi", addr)
+	if err != nil || !strings.Contains(out, "method add(a uint64, b uint64) -> (sum uint64) view") {
+		t.Fatalf("abi: %q %v", out, err)
+	}
+	out, err = execCommand("contracts", "invoke", addr, "add", "--arg", "a=2", "--arg", "b=40")
+	if err != nil || !strings.Contains(out, "sum: 42") || !strings.Contains(out, "gas: ") {
+		t.Fatalf("invoke: %q %v", out, err)
+	}
+	if _, err := execCommand("contracts", "invoke", addr, "add", "--arg", "a=2", "--arg", "c=1"); err == nil || !strings.Contains(err.Error(), "no argument c") {
+		t.Fatalf("expected unknown argument error, got %v", err)
+	}
+	if _, err := execCommand("contracts", "invoke", addr, "add", "--arg", "a=-1", "--arg", "b=1"); err == nil {
+		t.Fatalf("expected a negative uint64 to be rejected")
+	}
+	if _, err := execCommand("contracts", "invoke", addr, "add", "--args", "short"); err == nil || !strings.Contains(err.Error(), core.ErrInvalidCallArgs.Error()) {
+		t.Fatalf("expected raw arguments to be checked against the abi, got %v", err)
+	}
+}
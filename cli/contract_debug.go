@@ -0,0 +1,316 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"synnergy/core"
+)
+
+func newContractsDebugCmd() *cobra.Command {
+	var caller, out string
+	var value, gas uint64
+	var interactive bool
+	var breaks []string
+	cmd := &cobra.Command{
+		Use:   "debug <address> <method> [argsHex]",
+		Args:  cobra.RangeArgs(2, 3),
+		Short: "Replay a contract call and trace its execution",
+		Long: `Replay a contract call against the current state without applying it and
+record every executed instruction with its stack and memory changes, host
+calls and storage accesses. The trace is printed as JSON with --json or
+written to --out, and --interactive steps through it with breakpoints.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := parseContractCall(args)
+			if err != nil {
+				return err
+			}
+			p.Caller, p.Value, p.Gas = caller, value, gas
+			trace, err := invokeAs[core.ContractTrace]("contracts_debug", p)
+			if err != nil {
+				return err
+			}
+			if out != "" {
+				raw, err := json.MarshalIndent(trace, "", "  ")
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(out, raw, 0o644); err != nil {
+					return err
+				}
+			}
+			w := cmd.OutOrStdout()
+			switch {
+			case interactive:
+				d := &traceDebugger{trace: &trace, out: w}
+				for _, spec := range breaks {
+					if err := d.addBreak(spec); err != nil {
+						return err
+					}
+				}
+				return d.run(cmd.InOrStdin())
+			case jsonOutput:
+				printOutput(trace)
+			case out == "":
+				for _, s := range trace.Steps {
+					fmt.Fprintln(w, formatTraceStep(s))
+				}
+				fmt.Fprintln(w, formatTraceSummary(&trace))
+			default:
+				fmt.Fprintln(w, formatTraceSummary(&trace))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&caller, "caller", "", "Account replaying the call (default the contract owner)")
+	cmd.Flags().Uint64Var(&value, "value", 0, "Coins sent with the call")
+	cmd.Flags().Uint64Var(&gas, "gas", 0, "Gas limit (0 for the contract's limit)")
+	cmd.Flags().StringVar(&out, "out", "", "Write the JSON trace to this file")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Step through the trace interactively")
+	cmd.Flags().StringArrayVar(&breaks, "break", nil, "Breakpoint for interactive mode (repeatable): step number, op=, host=, func=, contract= or error")
+	return cmd
+}
+
+func formatTraceStep(s core.TraceStep) string {
+	var b strings.Builder
+	fn := s.FuncName
+	if fn == "" {
+		fn = fmt.Sprintf("func%d", s.Func)
+	}
+	fmt.Fprintf(&b, "#%-6d %s%s+%d %s", s.Step, strings.Repeat("  ", s.Frame), fn, s.PC, s.Op)
+	if s.Immediate != nil {
+		fmt.Fprintf(&b, " %d", *s.Immediate)
+	}
+	fmt.Fprintf(&b, "  gas=%d left=%d", s.GasCost, s.GasLeft)
+	if len(s.Pop) > 0 {
+		fmt.Fprintf(&b, " pop=%v", s.Pop)
+	}
+	if len(s.Push) > 0 {
+		fmt.Fprintf(&b, " push=%v", s.Push)
+	}
+	for _, m := range s.Memory {
+		fmt.Fprintf(&b, " mem[%d]=%s->%s", m.Offset, m.Old, m.New)
+	}
+	if s.Host != nil {
+		fmt.Fprintf(&b, " host=%s%v->%d", s.Host.Name, s.Host.Args, s.Host.Result)
+	}
+	for _, a := range s.Storage {
+		fmt.Fprintf(&b, " %s[%s]=%s", a.Kind, a.Key, a.Value)
+	}
+	if s.Err != "" {
+		fmt.Fprintf(&b, " error=%q", s.Err)
+	}
+	return b.String()
+}
+
+func formatTraceSummary(t *core.ContractTrace) string {
+	status := "success"
+	if t.Error != "" {
+		status = "failed: " + t.Error
+	}
+	s := fmt.Sprintf("%s.%s %s: %d steps, gas %d/%d, return %s, %d logs",
+		t.Contract, t.Method, status, len(t.Steps), t.GasUsed, t.GasLimit, t.ReturnData, len(t.Logs))
+	if t.Truncated {
+		s += " (trace truncated)"
+	}
+	return s
+}
+
+// traceBreak stops interactive replay at a matching step.
+type traceBreak struct {
+	spec  string
+	match func(core.TraceStep) bool
+}
+
+func parseTraceBreak(spec string) (traceBreak, error) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		return traceBreak{spec, func(s core.TraceStep) bool { return s.Step == n }}, nil
+	}
+	if spec == "error" {
+		return traceBreak{spec, func(s core.TraceStep) bool { return s.Err != "" }}, nil
+	}
+	key, val, ok := strings.Cut(spec, "=")
+	if !ok || val == "" {
+		return traceBreak{}, fmt.Errorf("invalid breakpoint %q", spec)
+	}
+	var match func(core.TraceStep) bool
+	switch key {
+	case "op":
+		match = func(s core.TraceStep) bool { return s.Op == val }
+	case "host":
+		match = func(s core.TraceStep) bool { return s.Host != nil && s.Host.Name == val }
+	case "func":
+		match = func(s core.TraceStep) bool { return s.FuncName == val || fmt.Sprint(s.Func) == val }
+	case "contract":
+		match = func(s core.TraceStep) bool { return s.Contract == val }
+	default:
+		return traceBreak{}, fmt.Errorf("invalid breakpoint %q", spec)
+	}
+	return traceBreak{spec, match}, nil
+}
+
+// traceDebugger steps through a recorded trace. pos is the index of the next
+// step to show.
+type traceDebugger struct {
+	trace  *core.ContractTrace
+	out    io.Writer
+	pos    int
+	breaks []traceBreak
+}
+
+const traceDebuggerHelp = `commands:
+  s, step [n]       show the next n steps
+  n, next           step over calls into deeper frames
+  c, continue       run to the next breakpoint or the end
+  b, break <spec>   add a breakpoint: step number, op=, host=, func=, contract= or error
+  bl, breaks        list breakpoints
+  d, delete <i>     delete breakpoint i
+  p, print [step]   print a step as JSON, by default the last one shown
+  r, restart        go back to the first step
+  q, quit           leave the debugger`
+
+func (d *traceDebugger) addBreak(spec string) error {
+	b, err := parseTraceBreak(spec)
+	if err != nil {
+		return err
+	}
+	d.breaks = append(d.breaks, b)
+	return nil
+}
+
+func (d *traceDebugger) show() {
+	fmt.Fprintln(d.out, formatTraceStep(d.trace.Steps[d.pos]))
+	d.pos++
+	if d.pos == len(d.trace.Steps) {
+		fmt.Fprintln(d.out, formatTraceSummary(d.trace))
+	}
+}
+
+func (d *traceDebugger) done() bool {
+	if d.pos < len(d.trace.Steps) {
+		return false
+	}
+	fmt.Fprintln(d.out, "end of trace")
+	return true
+}
+
+func (d *traceDebugger) breakAt(s core.TraceStep) (int, bool) {
+	for i, b := range d.breaks {
+		if b.match(s) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// resume skips steps until one matches a breakpoint, which is shown, or stop
+// reports true for one, which is left as the next step.
+func (d *traceDebugger) resume(stop func(core.TraceStep) bool) {
+	for d.pos < len(d.trace.Steps) {
+		s := d.trace.Steps[d.pos]
+		if stop != nil && stop(s) {
+			return
+		}
+		if i, ok := d.breakAt(s); ok {
+			fmt.Fprintf(d.out, "breakpoint %d (%s)\n", i, d.breaks[i].spec)
+			d.show()
+			return
+		}
+		d.pos++
+	}
+	fmt.Fprintln(d.out, formatTraceSummary(d.trace))
+}
+
+func (d *traceDebugger) run(in io.Reader) error {
+	fmt.Fprintf(d.out, "%s; type help for commands\n", formatTraceSummary(d.trace))
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			fields = []string{"step"}
+		}
+		arg := ""
+		if len(fields) > 1 {
+			arg = fields[1]
+		}
+		switch fields[0] {
+		case "s", "step":
+			n := 1
+			if arg != "" {
+				v, err := strconv.Atoi(arg)
+				if err != nil || v < 1 {
+					fmt.Fprintf(d.out, "invalid count %q\n", arg)
+					continue
+				}
+				n = v
+			}
+			for ; n > 0 && !d.done(); n-- {
+				d.show()
+			}
+		case "n", "next":
+			if d.done() {
+				continue
+			}
+			frame := d.trace.Steps[d.pos].Frame
+			if d.show(); d.pos < len(d.trace.Steps) {
+				d.resume(func(s core.TraceStep) bool { return s.Frame <= frame })
+			}
+		case "c", "continue":
+			if !d.done() {
+				d.resume(nil)
+			}
+		case "b", "break":
+			if err := d.addBreak(arg); err != nil {
+				fmt.Fprintln(d.out, err)
+				continue
+			}
+			fmt.Fprintf(d.out, "breakpoint %d (%s)\n", len(d.breaks)-1, arg)
+		case "bl", "breaks":
+			for i, b := range d.breaks {
+				fmt.Fprintf(d.out, "%d: %s\n", i, b.spec)
+			}
+		case "d", "delete":
+			i, err := strconv.Atoi(arg)
+			if err != nil || i < 0 || i >= len(d.breaks) {
+				fmt.Fprintf(d.out, "no breakpoint %q\n", arg)
+				continue
+			}
+			d.breaks = append(d.breaks[:i], d.breaks[i+1:]...)
+		case "p", "print":
+			i := d.pos - 1
+			if arg != "" {
+				v, err := strconv.Atoi(arg)
+				if err != nil {
+					fmt.Fprintf(d.out, "invalid step %q\n", arg)
+					continue
+				}
+				i = v
+			}
+			if i < 0 || i >= len(d.trace.Steps) {
+				fmt.Fprintln(d.out, "no step to print")
+				continue
+			}
+			raw, _ := json.MarshalIndent(d.trace.Steps[i], "", "  ")
+			fmt.Fprintln(d.out, string(raw))
+		case "r", "restart":
+			d.pos = 0
+		case "q", "quit":
+			return nil
+		case "h", "help":
+			fmt.Fprintln(d.out, traceDebuggerHelp)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q; type help for commands\n", fields[0])
+		}
+	}
+}
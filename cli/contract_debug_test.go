@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"synnergy/core"
+)
+
+// storageSetModule exports set, which writes "v" under key "k".
+const storageSetModule = "0061736d01000000" +
+	"010b0260047f7f7f7f0060000002180108" + "73796e6e65726779" + "0b" + "73746f726167655f736574" + "0000" +
+	"030201010503010001070701037365740001" +
+	"0a0e010c00410041014101410110000b" +
+	"0b08010041000b026b76"
+
+func TestContractsDebug(t *testing.T) {
+	prev := ledger
+	l := core.NewLedger()
+	bindLedger(l)
+	t.Cleanup(func() { bindLedger(prev) })
+	l.Credit("owner", 10_000)
+	wasm, _ := hex.DecodeString(storageSetModule)
+	addr, err := contractRegistry.Deploy(wasm, "", 5_000, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+
+	out, err := execCommand("contracts", "debug", addr, "set")
+	if err != nil || !strings.Contains(out, "host=storage_set") || !strings.Contains(out, "write[6b]=76") || !strings.Contains(out, "success") {
+		t.Fatalf("debug: %q %v", out, err)
+	}
+	if _, ok := l.ContractStorage(addr, []byte("k")); ok {
+		t.Fatalf("debugging must not write storage")
+	}
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if _, err := execCommand("contracts", "debug", addr, "set", "--out", path); err != nil {
+		t.Fatalf("debug --out: %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	var trace core.ContractTrace
+	if err != nil || json.Unmarshal(raw, &trace) != nil || len(trace.Steps) != 6 || trace.Steps[4].Host == nil {
+		t.Fatalf("trace file: %s %v", raw, err)
+	}
+
+	rootCmd.SetIn(strings.NewReader("c\np\nbl\nd 0\nc\nq\n"))
+	t.Cleanup(func() { rootCmd.SetIn(nil) })
+	out, err = execCommand("contracts", "debug", addr, "set", "-i", "--break", "host=storage_set")
+	if err != nil {
+		t.Fatalf("interactive: %v", err)
+	}
+	for _, want := range []string{"breakpoint 0 (host=storage_set)", `"kind": "write"`, "0: host=storage_set", "6 steps"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("interactive output misses %q:\n%s", want, out)
+		}
+	}
+	if _, err := execCommand("contracts", "debug", addr, "set", "zz"); err == nil {
+		t.Fatalf("expected invalid args error")
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/hex"
 	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
+	"synnergy/core"
 	ierr "synnergy/internal/errors"
 )
 
@@ -94,11 +96,113 @@ func init() {
 				return
 			}
 			gasPrint("ContractInfo")
-			printOutput(map[string]any{"owner": c.Owner, "paused": c.Paused, "gas": c.GasLimit})
+			printOutput(map[string]any{"owner": c.Owner, "paused": c.Paused, "gas": c.GasLimit, "version": c.Version})
 		},
 	}
 
-	cmd.AddCommand(transferCmd, pauseCmd, resumeCmd, upgradeCmd, infoCmd)
+	proposeUpgradeCmd := &cobra.Command{
+		Use:   "propose-upgrade [addr] [wasmHex]",
+		Args:  cobra.ExactArgs(2),
+		Short: "Propose new contract code, activated after the upgrade timelock",
+		Run: func(cmd *cobra.Command, args []string) {
+			bytes, err := hex.DecodeString(args[1])
+			if err != nil {
+				printOutput(map[string]any{"error": "invalid wasm"})
+				return
+			}
+			caller, _ := cmd.Flags().GetString("caller")
+			gas, _ := cmd.Flags().GetUint64("gas")
+			manifest, _ := cmd.Flags().GetString("manifest")
+			proposal, _ := cmd.Flags().GetString("proposal")
+			up, err := contractMgr.ProposeUpgrade(context.Background(), args[0], core.UpgradeRequest{
+				Caller:     caller,
+				WASM:       bytes,
+				GasLimit:   gas,
+				Manifest:   manifest,
+				ProposalID: proposal,
+			})
+			if err != nil {
+				printErr(err)
+				return
+			}
+			gasPrint("ProposeContractUpgrade")
+			printOutput(up)
+		},
+	}
+	proposeUpgradeCmd.Flags().String("caller", "", "Account proposing the upgrade")
+	proposeUpgradeCmd.Flags().Uint64("gas", 0, "New gas limit, 0 keeps the current one")
+	proposeUpgradeCmd.Flags().String("manifest", "", "New manifest JSON, empty keeps the current one")
+	proposeUpgradeCmd.Flags().String("proposal", "", "Passed DAO proposal approving the code hash")
+
+	activateUpgradeCmd := &cobra.Command{
+		Use:   "activate-upgrade [addr]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Activate a pending upgrade whose timelock has elapsed",
+		Run: func(cmd *cobra.Command, args []string) {
+			up, err := contractMgr.ActivateUpgrade(context.Background(), args[0])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			gasPrint("ActivateContractUpgrade")
+			printOutput(up)
+		},
+	}
+
+	cancelUpgradeCmd := &cobra.Command{
+		Use:   "cancel-upgrade [addr]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Cancel a pending upgrade",
+		Run: func(cmd *cobra.Command, args []string) {
+			caller, _ := cmd.Flags().GetString("caller")
+			if err := contractMgr.CancelUpgrade(context.Background(), args[0], caller); err != nil {
+				printErr(err)
+				return
+			}
+			gasPrint("CancelContractUpgrade")
+			printOutput(map[string]any{"status": "cancelled", "address": args[0]})
+		},
+	}
+	cancelUpgradeCmd.Flags().String("caller", "", "Owner or proposer of the upgrade")
+
+	policyCmd := &cobra.Command{
+		Use:   "upgrade-policy [addr]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Require DAO approval or a timelock for contract upgrades",
+		Run: func(cmd *cobra.Command, args []string) {
+			caller, _ := cmd.Flags().GetString("caller")
+			dao, _ := cmd.Flags().GetString("dao")
+			timelock, _ := cmd.Flags().GetDuration("timelock")
+			policy := core.UpgradePolicy{DAOID: dao, Timelock: timelock}
+			if err := contractMgr.SetUpgradePolicy(context.Background(), args[0], caller, policy); err != nil {
+				printErr(err)
+				return
+			}
+			gasPrint("SetContractUpgradePolicy")
+			printOutput(map[string]any{"status": "updated", "address": args[0], "dao": dao, "timelock": timelock.String()})
+		},
+	}
+	policyCmd.Flags().String("caller", "", "Contract owner")
+	policyCmd.Flags().String("dao", "", "DAO whose passed proposals authorise upgrades")
+	policyCmd.Flags().Duration("timelock", time.Duration(0), "Delay between proposing and activating an upgrade")
+
+	historyCmd := &cobra.Command{
+		Use:   "history [addr]",
+		Args:  cobra.ExactArgs(1),
+		Short: "List the code versions of a contract",
+		Run: func(cmd *cobra.Command, args []string) {
+			history, err := contractMgr.UpgradeHistory(context.Background(), args[0])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			gasPrint("ContractUpgradeHistory")
+			printOutput(history)
+		},
+	}
+
+	cmd.AddCommand(transferCmd, pauseCmd, resumeCmd, upgradeCmd, infoCmd,
+		proposeUpgradeCmd, activateUpgradeCmd, cancelUpgradeCmd, policyCmd, historyCmd)
 	rootCmd.AddCommand(cmd)
 }
 
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"synnergy/core"
 )
 
 // TestContractManagerInfoError checks that querying a missing contract prints an error.
@@ -25,3 +27,45 @@ func TestContractManagerInfoError(t *testing.T) {
 		t.Fatalf("expected error field, got %v", res)
 	}
 }
+
+func TestContractManagerUpgradeCommands(t *testing.T) {
+	prev := ledger
+	l := core.NewLedger()
+	bindLedger(l)
+	t.Cleanup(func() { bindLedger(prev) })
+	l.Credit("owner", 1000)
+	addr, err := contractRegistry.Deploy([]byte("\x00asm\x01\x00\x00\x00"), "", 100, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	// an empty module carrying a custom section
+	v2 := "0061736d0100000000020178"
+
+	out, err := execCommand("--json", "contract-mgr", "propose-upgrade", addr, v2, "--caller", "owner")
+	var up core.ContractUpgrade
+	if err != nil || json.Unmarshal([]byte(jsonPayload(out)), &up) != nil || up.Version != 2 || up.Status != core.UpgradeActive {
+		t.Fatalf("propose-upgrade: %q %v", out, err)
+	}
+	if _, err := execCommand("contract-mgr", "upgrade-policy", addr, "--caller", "owner", "--timelock", "1h"); err != nil {
+		t.Fatalf("upgrade-policy: %v", err)
+	}
+	out, _ = execCommand("--json", "contract-mgr", "propose-upgrade", addr, "0061736d0100000000020179", "--caller", "owner")
+	if json.Unmarshal([]byte(jsonPayload(out)), &up) != nil || up.Status != core.UpgradePending {
+		t.Fatalf("timelocked proposal: %q", out)
+	}
+	if out, _ := execCommand("--json", "contract-mgr", "activate-upgrade", addr); !strings.Contains(out, "error") {
+		t.Fatalf("expected timelocked activation to fail: %q", out)
+	}
+	if _, err := execCommand("contract-mgr", "cancel-upgrade", addr, "--caller", "owner"); err != nil {
+		t.Fatalf("cancel-upgrade: %v", err)
+	}
+
+	out, err = execCommand("--json", "contract-mgr", "history", addr)
+	var history []core.ContractUpgrade
+	if err != nil || json.Unmarshal([]byte(jsonPayload(out)), &history) != nil || len(history) != 3 {
+		t.Fatalf("history: %q %v", out, err)
+	}
+	if history[0].Status != core.UpgradeSuperseded || history[1].Status != core.UpgradeActive || history[2].Status != core.UpgradeCancelled {
+		t.Fatalf("unexpected history %+v", history)
+	}
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"synnergy/core"
+)
+
+// parseContractCall reads the <address> <method> [argsHex] arguments shared
+// by the commands that replay or simulate a call.
+func parseContractCall(args []string) (contractCallParams, error) {
+	p := contractCallParams{Address: args[0], Method: args[1]}
+	if len(args) == 3 {
+		raw, err := hex.DecodeString(strings.TrimPrefix(args[2], "0x"))
+		if err != nil {
+			return p, fmt.Errorf("invalid args: %w", err)
+		}
+		p.Args = raw
+	}
+	return p, nil
+}
+
+func newContractsEstimateCmd() *cobra.Command {
+	var caller string
+	var value uint64
+	cmd := &cobra.Command{
+		Use:   "estimate <address> <method> [argsHex]",
+		Args:  cobra.RangeArgs(2, 3),
+		Short: "Estimate the gas limit a contract call needs",
+		Long: `Simulate a contract call against the current state without applying it and
+report the smallest gas limit it succeeds with plus a safety margin, together
+with the gas used, return data, logs and state changes of the call.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := parseContractCall(args)
+			if err != nil {
+				return err
+			}
+			p.Caller, p.Value = caller, value
+			sim, err := invokeAs[core.Simulation]("contracts_estimateGas", p)
+			if err != nil {
+				return err
+			}
+			printSimulation(cmd.OutOrStdout(), &sim)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&caller, "caller", "", "Account making the call (default the contract owner)")
+	cmd.Flags().Uint64Var(&value, "value", 0, "Coins sent with the call")
+	return cmd
+}
+
+func newContractsSimulateCmd() *cobra.Command {
+	var caller string
+	var value, gas uint64
+	cmd := &cobra.Command{
+		Use:   "simulate <address> <method> [argsHex]",
+		Args:  cobra.RangeArgs(2, 3),
+		Short: "Run a contract call without applying it",
+		Long: `Execute a contract call against a copy-on-write view of the current state and
+report its gas use, return data, logs and the balance and storage changes it
+would make. Nothing is committed and no gas is charged.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := parseContractCall(args)
+			if err != nil {
+				return err
+			}
+			p.Caller, p.Value, p.Gas = caller, value, gas
+			sim, err := invokeAs[core.Simulation]("contracts_simulate", p)
+			if err != nil {
+				return err
+			}
+			printSimulation(cmd.OutOrStdout(), &sim)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&caller, "caller", "", "Account making the call (default the contract owner)")
+	cmd.Flags().Uint64Var(&value, "value", 0, "Coins sent with the call")
+	cmd.Flags().Uint64Var(&gas, "gas", 0, "Gas limit (0 for the contract's limit)")
+	return cmd
+}
+
+// printSimulation prints a simulation as JSON with --json and as a summary
+// followed by its state changes otherwise.
+func printSimulation(w io.Writer, s *core.Simulation) {
+	if jsonOutput {
+		printOutput(s)
+		return
+	}
+	for _, line := range formatSimulation(s) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+func formatSimulation(s *core.Simulation) []string {
+	status := "success"
+	if s.Error != "" {
+		status = "failed: " + s.Error
+	}
+	var lines []string
+	if s.Contract != "" {
+		lines = append(lines, fmt.Sprintf("%s.%s by %s %s", s.Contract, s.Method, s.Caller, status))
+		gas := fmt.Sprintf("gas used %d of %d", s.GasUsed, s.GasLimit)
+		if s.GasEstimate > 0 {
+			gas += fmt.Sprintf(", estimate %d", s.GasEstimate)
+		}
+		lines = append(lines, gas, "return "+hex.EncodeToString(s.ReturnData))
+	} else {
+		lines = append(lines, fmt.Sprintf("transaction %s from %s %s", s.TxID, s.Caller, status), fmt.Sprintf("fee %d", s.Fee))
+	}
+	for _, l := range s.Logs {
+		lines = append(lines, fmt.Sprintf("log %s %v %s", l.Address, l.Topics, hex.EncodeToString(l.Data)))
+	}
+	for _, c := range s.Diff.Balances {
+		lines = append(lines, fmt.Sprintf("balance %s %d -> %d", c.Address, c.Before, c.After))
+	}
+	for _, c := range s.Diff.Nonces {
+		lines = append(lines, fmt.Sprintf("nonce %s %d -> %d", c.Address, c.Before, c.After))
+	}
+	for _, c := range s.Diff.Storage {
+		lines = append(lines, fmt.Sprintf("storage %s[%x] %x -> %x", c.Contract, c.Key, c.Before, c.After))
+	}
+	return lines
+}
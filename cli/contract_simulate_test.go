@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"synnergy/core"
+)
+
+func TestContractsSimulateAndEstimate(t *testing.T) {
+	prev := ledger
+	l := core.NewLedger()
+	bindLedger(l)
+	t.Cleanup(func() { bindLedger(prev) })
+	l.Credit("owner", 10_000)
+	wasm, _ := hex.DecodeString(storageSetModule)
+	addr, err := contractRegistry.Deploy(wasm, "", 5_000, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	balance := l.GetBalance("owner")
+
+	out, err := execCommand("contracts", "estimate", addr, "set")
+	if err != nil || !strings.Contains(out, "success") || !strings.Contains(out, ", estimate ") || !strings.Contains(out, "storage "+addr+"[6b]  -> 76") {
+		t.Fatalf("estimate: %q %v", out, err)
+	}
+	out, err = execCommand("contracts", "simulate", addr, "set", "--gas", "1")
+	if err != nil || !strings.Contains(out, "failed: ") || !strings.Contains(out, "gas used 1 of 1") {
+		t.Fatalf("simulate: %q %v", out, err)
+	}
+	if _, ok := l.ContractStorage(addr, []byte("k")); ok || l.GetBalance("owner") != balance {
+		t.Fatalf("simulation must not change the ledger")
+	}
+
+	nonce := l.Nonce("owner")
+	out, err = execCommand("tx", "simulate", "owner", "bob", "10", "1", fmt.Sprint(nonce))
+	if err != nil || !strings.Contains(out, "balance bob 0 -> 10") || !strings.Contains(out, fmt.Sprintf("nonce owner %d -> %d", nonce, nonce+1)) {
+		t.Fatalf("tx simulate: %q %v", out, err)
+	}
+	if l.GetBalance("bob") != 0 {
+		t.Fatalf("transaction simulation must not change the ledger")
+	}
+}
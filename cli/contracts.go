@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,10 +9,11 @@ import (
 
 	"github.com/spf13/cobra"
 	"synnergy/core"
+	"synnergy/pkg/abi"
 )
 
 var (
-	contractVM       = core.NewSimpleVM()
+	contractVM       = core.NewWASMVM()
 	contractRegistry *core.ContractRegistry
 	contractMgr      *core.ContractManager
 )
@@ -21,11 +23,125 @@ func ensureContractComponents() {
 		contractRegistry = core.NewContractRegistry(contractVM, ledger)
 	}
 	if contractMgr == nil {
-		contractMgr = core.NewContractManager(contractRegistry)
+		contractMgr = core.NewContractManager(contractRegistry, core.WithUpgradeProposals(proposalMgr))
 	}
 }
 
+type contractDeployParams struct {
+	WASM     []byte `json:"wasm"`
+	Manifest string `json:"manifest,omitempty"`
+	Gas      uint64 `json:"gas"`
+	Owner    string `json:"owner"`
+	Salt     []byte `json:"salt,omitempty"`
+}
+
+type contractAddressParams struct {
+	Owner string `json:"owner"`
+	Salt  []byte `json:"salt,omitempty"`
+	WASM  []byte `json:"wasm,omitempty"`
+}
+
+type contractInvokeParams struct {
+	Address string `json:"address"`
+	Method  string `json:"method"`
+	Args    []byte `json:"args,omitempty"`
+	Gas     uint64 `json:"gas,omitempty"`
+}
+
+// contractCallParams describes a call that is replayed or simulated rather
+// than executed.
+type contractCallParams struct {
+	Address string `json:"address"`
+	Caller  string `json:"caller,omitempty"`
+	Method  string `json:"method"`
+	Args    []byte `json:"args,omitempty"`
+	Value   uint64 `json:"value,omitempty"`
+	Gas     uint64 `json:"gas,omitempty"`
+}
+
+type contractInvokeResult struct {
+	Output []byte `json:"output"`
+	Gas    uint64 `json:"gas"`
+}
+
+type contractAddrParams struct {
+	Address string `json:"address"`
+}
+
+type contractStorageParams struct {
+	Address string `json:"address"`
+	Key     []byte `json:"key"`
+}
+
+// contractSummary describes a deployed contract without its bytecode.
+type contractSummary struct {
+	Address  string `json:"address"`
+	Owner    string `json:"owner"`
+	GasLimit uint64 `json:"gas_limit"`
+	Paused   bool   `json:"paused"`
+}
+
 func init() {
+	registerMethod("contracts_deploy", func(p contractDeployParams) (any, error) {
+		if len(p.Salt) > 0 {
+			return contractRegistry.DeployWithSalt(p.WASM, p.Manifest, p.Gas, p.Owner, p.Salt)
+		}
+		return contractRegistry.Deploy(p.WASM, p.Manifest, p.Gas, p.Owner)
+	})
+	registerMethod("contracts_address", func(p contractAddressParams) (any, error) {
+		if len(p.Salt) > 0 {
+			return core.ContractAddressWithSalt(p.Owner, p.Salt, p.WASM), nil
+		}
+		return contractRegistry.NextAddress(p.Owner), nil
+	})
+	registerMethod("contracts_invoke", func(p contractInvokeParams) (any, error) {
+		out, gas, err := contractRegistry.Invoke(p.Address, p.Method, p.Args, p.Gas)
+		if err != nil {
+			return nil, err
+		}
+		return contractInvokeResult{Output: out, Gas: gas}, nil
+	})
+	registerMethod("contracts_debug", func(p contractCallParams) (any, error) {
+		return contractRegistry.Debug(p.Address, p.Caller, p.Method, p.Args, p.Value, p.Gas)
+	})
+	registerMethod("contracts_simulate", func(p contractCallParams) (any, error) {
+		return contractRegistry.SimulateCall(p.Address, p.Caller, p.Method, p.Args, p.Value, p.Gas)
+	})
+	registerMethod("contracts_estimateGas", func(p contractCallParams) (any, error) {
+		return contractRegistry.EstimateGasWithValue(p.Caller, p.Address, p.Method, p.Args, p.Value)
+	})
+	registerMethod("contracts_list", func(struct{}) (any, error) {
+		list := []contractSummary{}
+		for _, c := range contractRegistry.List() {
+			list = append(list, contractSummary{Address: c.Address, Owner: c.Owner, GasLimit: c.GasLimit, Paused: c.Paused})
+		}
+		return list, nil
+	})
+	registerMethod("contracts_info", func(p contractAddrParams) (any, error) {
+		c, ok := contractRegistry.Get(p.Address)
+		if !ok {
+			return nil, fmt.Errorf("contract not found")
+		}
+		return c.Manifest, nil
+	})
+	registerMethod("contracts_storageGet", func(p contractStorageParams) (any, error) {
+		v, ok, err := contractRegistry.Storage(p.Address, p.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("storage slot %x not set", p.Key)
+		}
+		return v, nil
+	})
+	registerMethod("contracts_storageDump", func(p contractAddrParams) (any, error) {
+		entries, err := contractRegistry.StorageEntries(p.Address)
+		if entries == nil && err == nil {
+			entries = []core.ContractStorageEntry{}
+		}
+		return entries, err
+	})
+
 	ensureContractComponents()
 	// start VM to allow contract execution
 	_ = contractVM.Start()
@@ -36,9 +152,9 @@ func init() {
 	}
 
 	compileCmd := &cobra.Command{
-		Use:   "compile [src.wat|src.wasm]",
+		Use:   "compile [src.wasm]",
 		Args:  cobra.ExactArgs(1),
-		Short: "Compile WAT or WASM to deterministic bytecode",
+		Short: "Validate a WASM module and print its deterministic hash",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			src, err := os.ReadFile(args[0])
 			if err != nil {
@@ -55,6 +171,7 @@ func init() {
 
 	var wasmPath, manifestPath, owner string
 	var gasLimit uint64
+	var deploySalt string
 
 	deployCmd := &cobra.Command{
 		Use:   "deploy",
@@ -78,7 +195,11 @@ func init() {
 				}
 				manifest = string(m)
 			}
-			addr, err := contractRegistry.Deploy(wasm, manifest, gasLimit, owner)
+			salt, err := hex.DecodeString(deploySalt)
+			if err != nil {
+				return fmt.Errorf("invalid hex salt: %w", err)
+			}
+			addr, err := invokeAs[string]("contracts_deploy", contractDeployParams{WASM: wasm, Manifest: manifest, Gas: gasLimit, Owner: owner, Salt: salt})
 			if err != nil {
 				return err
 			}
@@ -90,32 +211,74 @@ func init() {
 	deployCmd.Flags().StringVar(&manifestPath, "ric", "", "Path to Ricardian manifest")
 	deployCmd.Flags().Uint64Var(&gasLimit, "gas", 100000, "Gas limit")
 	deployCmd.Flags().StringVar(&owner, "owner", "", "Owner address")
+	deployCmd.Flags().StringVar(&deploySalt, "salt", "", "Hex salt for a deterministic address independent of the owner's nonce")
 
 	var invokeMethod, invokeArgs string
+	var invokeTyped []string
 	var invokeGas uint64
 	invokeCmd := &cobra.Command{
-		Use:   "invoke <address>",
-		Args:  cobra.ExactArgs(1),
+		Use:   "invoke <address> [method]",
+		Args:  cobra.RangeArgs(1, 2),
 		Short: "Invoke a contract method",
+		Long: `Invoke a contract method. Arguments are passed as raw bytes with --args, or
+by name with repeated --arg name=value when the contract declares an ABI in its
+manifest; values are parsed by their declared types and encoded for the call.
+The output of a method declared in the ABI is decoded into its named return
+values.`,
+		Example: `  synnergy contracts invoke <address> transfer --arg to=<account> --arg amount=100`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			addr := args[0]
-			out, gas, err := contractRegistry.Invoke(addr, invokeMethod, []byte(invokeArgs), invokeGas)
+			method := invokeMethod
+			if len(args) == 2 {
+				if method != "" && method != args[1] {
+					return fmt.Errorf("method given both as %q and --method %q", args[1], method)
+				}
+				method = args[1]
+			}
+			if len(invokeTyped) > 0 && invokeArgs != "" {
+				return fmt.Errorf("--arg and --args cannot be combined")
+			}
+			iface, err := contractABI(args[0])
 			if err != nil {
 				return err
 			}
-			fmt.Fprintf(cmd.OutOrStdout(), "output: %s\ngas: %d\n", string(out), gas)
+			var m *abi.Method
+			if iface != nil {
+				m, _ = iface.Method(method)
+			}
+			callArgs := []byte(invokeArgs)
+			if len(invokeTyped) > 0 {
+				if m == nil {
+					return fmt.Errorf("contract %s declares no method %q in its abi", args[0], method)
+				}
+				if callArgs, err = encodeCallArgs(m, invokeTyped); err != nil {
+					return err
+				}
+			}
+			res, err := invokeAs[contractInvokeResult]("contracts_invoke", contractInvokeParams{Address: args[0], Method: method, Args: callArgs, Gas: invokeGas})
+			if err != nil {
+				return err
+			}
+			if m != nil {
+				return printDecodedOutput(cmd.OutOrStdout(), m, res.Output, res.Gas)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "output: %s\ngas: %d\n", string(res.Output), res.Gas)
 			return nil
 		},
 	}
 	invokeCmd.Flags().StringVar(&invokeMethod, "method", "", "Contract method to call")
 	invokeCmd.Flags().StringVar(&invokeArgs, "args", "", "Arguments as raw bytes")
+	invokeCmd.Flags().StringArrayVar(&invokeTyped, "arg", nil, "Named argument as name=value, encoded by the contract ABI (repeatable)")
 	invokeCmd.Flags().Uint64Var(&invokeGas, "gas", 0, "Gas limit (0 for default)")
 
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List deployed contracts",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			for _, c := range contractRegistry.List() {
+			list, err := invokeAs[[]contractSummary]("contracts_list", nil)
+			if err != nil {
+				return err
+			}
+			for _, c := range list {
 				fmt.Fprintf(cmd.OutOrStdout(), "%s owner=%s gas=%d paused=%v\n", c.Address, c.Owner, c.GasLimit, c.Paused)
 			}
 			return nil
@@ -127,16 +290,16 @@ func init() {
 		Args:  cobra.ExactArgs(1),
 		Short: "Show contract manifest",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c, ok := contractRegistry.Get(args[0])
-			if !ok {
-				return fmt.Errorf("contract not found")
+			manifest, err := invokeAs[string]("contracts_info", contractAddrParams{Address: args[0]})
+			if err != nil {
+				return err
 			}
-			fmt.Fprintln(cmd.OutOrStdout(), c.Manifest)
+			fmt.Fprintln(cmd.OutOrStdout(), manifest)
 			return nil
 		},
 	}
 
-	var templateName, templateOwner string
+	var templateName, templateOwner, templateSalt string
 	var templateGas uint64
 	deployTemplateCmd := &cobra.Command{
 		Use:   "deploy-template",
@@ -153,7 +316,11 @@ func init() {
 			if err != nil {
 				return err
 			}
-			addr, err := contractRegistry.Deploy(wasm, "", templateGas, templateOwner)
+			salt, err := hex.DecodeString(templateSalt)
+			if err != nil {
+				return fmt.Errorf("invalid hex salt: %w", err)
+			}
+			addr, err := invokeAs[string]("contracts_deploy", contractDeployParams{WASM: wasm, Gas: templateGas, Owner: templateOwner, Salt: salt})
 			if err != nil {
 				return err
 			}
@@ -164,6 +331,42 @@ func init() {
 	deployTemplateCmd.Flags().StringVar(&templateName, "name", "", "Template name (token_faucet, storage_market, dao_governance, nft_minting, ai_model_market)")
 	deployTemplateCmd.Flags().StringVar(&templateOwner, "owner", "", "Owner address")
 	deployTemplateCmd.Flags().Uint64Var(&templateGas, "gas", 100000, "Gas limit")
+	deployTemplateCmd.Flags().StringVar(&templateSalt, "salt", "", "Hex salt for a deterministic address independent of the owner's nonce")
+
+	var addressOwner, addressSalt, addressWASM string
+	addressCmd := &cobra.Command{
+		Use:   "address",
+		Short: "Compute the address of the next deployment by an owner",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if addressOwner == "" {
+				return fmt.Errorf("--owner required")
+			}
+			p := contractAddressParams{Owner: addressOwner}
+			if addressSalt != "" {
+				salt, err := hex.DecodeString(addressSalt)
+				if err != nil {
+					return fmt.Errorf("invalid hex salt: %w", err)
+				}
+				if addressWASM == "" {
+					return fmt.Errorf("--wasm required with --salt")
+				}
+				wasm, err := os.ReadFile(addressWASM)
+				if err != nil {
+					return err
+				}
+				p.Salt, p.WASM = salt, wasm
+			}
+			addr, err := invokeAs[string]("contracts_address", p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), addr)
+			return nil
+		},
+	}
+	addressCmd.Flags().StringVar(&addressOwner, "owner", "", "Deployer address")
+	addressCmd.Flags().StringVar(&addressSalt, "salt", "", "Hex salt of a salted deployment")
+	addressCmd.Flags().StringVar(&addressWASM, "wasm", "", "Path to the WASM of a salted deployment")
 
 	listTemplatesCmd := &cobra.Command{
 		Use:   "list-templates",
@@ -182,6 +385,49 @@ func init() {
 		},
 	}
 
-	contractsCmd.AddCommand(compileCmd, deployCmd, invokeCmd, listCmd, infoCmd, deployTemplateCmd, listTemplatesCmd)
+	storageCmd := &cobra.Command{
+		Use:   "storage",
+		Short: "Inspect contract storage",
+	}
+	var storageHexKey bool
+	storageGetCmd := &cobra.Command{
+		Use:   "get <address> <key>",
+		Args:  cobra.ExactArgs(2),
+		Short: "Print the hex value of a storage slot",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := []byte(args[1])
+			if storageHexKey {
+				var err error
+				if key, err = hex.DecodeString(args[1]); err != nil {
+					return fmt.Errorf("invalid hex key: %w", err)
+				}
+			}
+			v, err := invokeAs[[]byte]("contracts_storageGet", contractStorageParams{Address: args[0], Key: key})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), hex.EncodeToString(v))
+			return nil
+		},
+	}
+	storageGetCmd.Flags().BoolVar(&storageHexKey, "hex", false, "Key is hex encoded")
+	storageDumpCmd := &cobra.Command{
+		Use:   "dump <address>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Print every storage slot as hex key=value",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := invokeAs[[]core.ContractStorageEntry]("contracts_storageDump", contractAddrParams{Address: args[0]})
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%x=%x\n", e.Key, e.Value)
+			}
+			return nil
+		},
+	}
+	storageCmd.AddCommand(storageGetCmd, storageDumpCmd)
+
+	contractsCmd.AddCommand(compileCmd, deployCmd, addressCmd, invokeCmd, listCmd, infoCmd, deployTemplateCmd, listTemplatesCmd, storageCmd, newContractsABICmd(), newContractsDebugCmd(), newContractsEstimateCmd(), newContractsSimulateCmd())
 	rootCmd.AddCommand(contractsCmd)
 }
@@ -1,6 +1,12 @@
 package cli
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synnergy/core"
+)
 
 func TestContractsList(t *testing.T) {
 	out, err := execCommand("contracts", "list")
@@ -11,3 +17,78 @@ func TestContractsList(t *testing.T) {
 		t.Fatalf("expected empty list, got %s", out)
 	}
 }
+
+func TestContractsStorageCommands(t *testing.T) {
+	prev := ledger
+	l := core.NewLedger()
+	bindLedger(l)
+	t.Cleanup(func() { bindLedger(prev) })
+	l.Credit("owner", 1000)
+	addr, err := contractRegistry.Deploy([]byte("\x00asm\x01\x00\x00\x00"), "", 100, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	err = l.ApplyContractChanges(&core.ContractStateChanges{Storage: []core.ContractStorageWrite{
+		{Contract: addr, Key: []byte("b"), Value: []byte{0x02}},
+		{Contract: addr, Key: []byte("a"), Value: []byte{0x01}},
+	}})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	out, err := execCommand("contracts", "storage", "get", addr, "a")
+	if err != nil || out != "01" {
+		t.Fatalf("get: %q %v", out, err)
+	}
+	out, err = execCommand("contracts", "storage", "get", "--hex", addr, "62")
+	if err != nil || out != "02" {
+		t.Fatalf("get hex: %q %v", out, err)
+	}
+	if _, err := execCommand("contracts", "storage", "get", addr, "c"); err == nil {
+		t.Fatalf("expected error for unset slot")
+	}
+	out, err = execCommand("contracts", "storage", "dump", addr)
+	if err != nil || out != "61=01\n62=02" {
+		t.Fatalf("dump: %q %v", out, err)
+	}
+	if _, err := execCommand("contracts", "storage", "dump", "missing"); err == nil {
+		t.Fatalf("expected error for unknown contract")
+	}
+}
+
+func TestContractsDeterministicAddresses(t *testing.T) {
+	prev := ledger
+	l := core.NewLedger()
+	bindLedger(l)
+	t.Cleanup(func() { bindLedger(prev) })
+	l.Credit("owner", 1000)
+	wasm := filepath.Join(t.TempDir(), "empty.wasm")
+	if err := os.WriteFile(wasm, []byte("\x00asm\x01\x00\x00\x00"), 0o644); err != nil {
+		t.Fatalf("write wasm: %v", err)
+	}
+
+	next, err := execCommand("contracts", "address", "--owner", "owner")
+	if err != nil || next != core.ContractAddress("owner", 0) {
+		t.Fatalf("address: %q %v", next, err)
+	}
+	first, err := execCommand("contracts", "deploy", "--wasm", wasm, "--owner", "owner", "--gas", "10")
+	if err != nil || first != next {
+		t.Fatalf("deploy: %q %v", first, err)
+	}
+	second, err := execCommand("contracts", "deploy", "--wasm", wasm, "--owner", "owner", "--gas", "10")
+	if err != nil || second == first {
+		t.Fatalf("redeploy: %q %v", second, err)
+	}
+
+	salted, err := execCommand("contracts", "address", "--owner", "owner", "--salt", "01", "--wasm", wasm)
+	if err != nil || salted == next {
+		t.Fatalf("salted address: %q %v", salted, err)
+	}
+	out, err := execCommand("contracts", "deploy", "--wasm", wasm, "--owner", "owner", "--gas", "10", "--salt", "01")
+	if err != nil || out != salted {
+		t.Fatalf("salted deploy: %q %v", out, err)
+	}
+	if _, err := execCommand("contracts", "deploy", "--wasm", wasm, "--owner", "owner", "--gas", "10", "--salt", "01"); err == nil {
+		t.Fatalf("expected duplicate salted deploy to fail")
+	}
+}
@@ -180,6 +180,8 @@ func newEnterpriseBroadcastCmd() *cobra.Command {
 		amount uint64
 		fee    uint64
 		nonce  uint64
+		wallet string
+		pass   string
 	)
 	cmd := &cobra.Command{
 		Use:   "broadcast",
@@ -189,6 +191,18 @@ func newEnterpriseBroadcastCmd() *cobra.Command {
 				return fmt.Errorf("from and to addresses are required")
 			}
 			tx := core.NewTransaction(from, to, amount, fee, nonce)
+			if wallet != "" {
+				w, err := loadWallet(wallet, pass)
+				if err != nil {
+					return err
+				}
+				if w.Address != from {
+					return fmt.Errorf("wallet address mismatch")
+				}
+				if _, err := w.Sign(tx); err != nil {
+					return err
+				}
+			}
 			results, err := enterpriseSpecialNode.BroadcastTransaction(tx)
 			if err != nil {
 				return err
@@ -211,7 +225,9 @@ func newEnterpriseBroadcastCmd() *cobra.Command {
 	cmd.Flags().StringVar(&to, "to", "", "Recipient address")
 	cmd.Flags().Uint64Var(&amount, "amount", 0, "Transaction amount")
 	cmd.Flags().Uint64Var(&fee, "fee", 0, "Transaction fee")
-	cmd.Flags().Uint64Var(&nonce, "nonce", uint64(time.Now().UnixNano()), "Transaction nonce")
+	cmd.Flags().Uint64Var(&nonce, "nonce", 0, "Sender account nonce")
+	cmd.Flags().StringVar(&wallet, "wallet", "", "Wallet file used to sign the transaction")
+	cmd.Flags().StringVar(&pass, "password", "", "Wallet password")
 	_ = cmd.MarkFlagRequired("from")
 	_ = cmd.MarkFlagRequired("to")
 	return cmd
@@ -38,8 +38,10 @@ func TestEnterpriseSpecialAttachCommand(t *testing.T) {
 }
 
 func TestEnterpriseSpecialBroadcastCommand(t *testing.T) {
+	useMemoryWalletLoader(t)
+	w, walletPath := newMemoryWallet(t, "pw")
 	attach := newEnterpriseAttachCmd()
-	if err := attach.Flags().Set("id", "cli-broadcast"); err != nil {
+	if err := attach.Flags().Set("id", w.Address); err != nil {
 		t.Fatalf("set id: %v", err)
 	}
 	if err := attach.Flags().Set("seed-balance", "250"); err != nil {
@@ -50,7 +52,7 @@ func TestEnterpriseSpecialBroadcastCommand(t *testing.T) {
 	}
 
 	broadcast := newEnterpriseBroadcastCmd()
-	if err := broadcast.Flags().Set("from", "cli-broadcast"); err != nil {
+	if err := broadcast.Flags().Set("from", w.Address); err != nil {
 		t.Fatalf("from: %v", err)
 	}
 	if err := broadcast.Flags().Set("to", "cli-dest"); err != nil {
@@ -62,8 +64,11 @@ func TestEnterpriseSpecialBroadcastCommand(t *testing.T) {
 	if err := broadcast.Flags().Set("fee", "1"); err != nil {
 		t.Fatalf("fee: %v", err)
 	}
-	if err := broadcast.Flags().Set("nonce", "1"); err != nil {
-		t.Fatalf("nonce: %v", err)
+	if err := broadcast.Flags().Set("wallet", walletPath); err != nil {
+		t.Fatalf("wallet: %v", err)
+	}
+	if err := broadcast.Flags().Set("password", "pw"); err != nil {
+		t.Fatalf("password: %v", err)
 	}
 	if err := broadcast.RunE(broadcast, nil); err != nil {
 		t.Fatalf("broadcast: %v", err)
@@ -73,7 +78,7 @@ func TestEnterpriseSpecialBroadcastCommand(t *testing.T) {
 	snap := enterpriseSpecialNode.Snapshot()
 	queued := false
 	for _, plugin := range snap.Plugins {
-		if plugin.ID == "cli-broadcast" && plugin.Metrics.MempoolSize > 0 {
+		if plugin.ID == w.Address && plugin.Metrics.MempoolSize > 0 {
 			queued = true
 			break
 		}
@@ -82,5 +87,5 @@ func TestEnterpriseSpecialBroadcastCommand(t *testing.T) {
 		t.Fatalf("expected broadcast to queue transaction")
 	}
 
-	enterpriseSpecialNode.DetachPlugin("cli-broadcast")
+	enterpriseSpecialNode.DetachPlugin(w.Address)
 }
@@ -18,6 +18,12 @@ func init() {
 		Short: "Initialise enforcer with ledger genesis",
 		Run: func(cmd *cobra.Command, args []string) {
 			gen := core.NewBlock(nil, "")
+			root, err := ledger.ComputeStateRoot(gen)
+			if err != nil {
+				printOutput(map[string]any{"error": err.Error()})
+				return
+			}
+			gen.StateRoot = root
 			gen.Hash = gen.HeaderHash(0)
 			if err := ledger.AddBlock(gen); err != nil {
 				printOutput(map[string]any{"error": err.Error()})
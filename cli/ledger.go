@@ -1,15 +1,107 @@
 package cli
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"synnergy/core"
+	"synnergy/internal/config"
 )
 
 var ledger = core.NewLedger()
 
+// ledgerOptions translates the ledger section of the configuration into
+// ledger options.
+func ledgerOptions(cfg config.LedgerConfig) ([]core.LedgerOption, error) {
+	mode, err := core.ParseHistoryMode(cfg.History)
+	if err != nil {
+		return nil, err
+	}
+	opts := []core.LedgerOption{core.WithMaxReorgDepth(cfg.MaxReorgDepth), core.WithHistory(mode, cfg.RetainBlocks)}
+	if fm := cfg.FeeMarket; fm.Enabled {
+		market := core.FeeMarket{InitialBaseFee: fm.InitialBaseFee, MinBaseFee: fm.MinBaseFee, TargetGas: fm.TargetGas}
+		if fm.BaseFee == "split" {
+			policy := core.DefaultFeeSplitPolicy
+			market.Split = &policy
+		}
+		opts = append(opts, core.WithFeeMarket(market))
+	}
+	return opts, nil
+}
+
+type ledgerBlockParams struct {
+	Height int `json:"height"`
+}
+
+type ledgerAddrParams struct {
+	Address string `json:"address"`
+	// Height selects a past block for balance queries; nil means the head.
+	Height *int `json:"height,omitempty"`
+}
+
+type ledgerMintParams struct {
+	Address string `json:"address"`
+	Amount  uint64 `json:"amount"`
+}
+
+type ledgerReceiptParams struct {
+	TxID string `json:"tx_id"`
+}
+
+type ledgerTransferParams struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount uint64 `json:"amount"`
+	Fee    uint64 `json:"fee"`
+}
+
 func init() {
+	registerMethod("ledger_head", func(struct{}) (any, error) {
+		h, hash := ledger.Head()
+		res := map[string]any{"height": h, "hash": hash}
+		if _, ok := ledger.FeeMarket(); ok {
+			res["next_base_fee"] = ledger.NextBaseFee()
+		}
+		return res, nil
+	})
+	registerMethod("ledger_getBlock", func(p ledgerBlockParams) (any, error) {
+		b, ok := ledger.GetBlock(p.Height)
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return b, nil
+	})
+	registerMethod("ledger_getBalance", func(p ledgerAddrParams) (any, error) {
+		if p.Height == nil {
+			return ledger.GetBalance(p.Address), nil
+		}
+		return ledger.GetBalanceAt(p.Address, *p.Height)
+	})
+	registerMethod("ledger_getUTXOs", func(p ledgerAddrParams) (any, error) {
+		return ledger.GetUTXOs(p.Address), nil
+	})
+	registerMethod("ledger_pool", func(struct{}) (any, error) {
+		return ledger.Pool(), nil
+	})
+	registerMethod("ledger_getReceipt", func(p ledgerReceiptParams) (any, error) {
+		return ledger.GetReceipt(p.TxID)
+	})
+	registerMethod("ledger_getLogs", func(p core.LogFilter) (any, error) {
+		return ledger.GetLogs(p)
+	})
+	registerMethod("ledger_mint", func(p ledgerMintParams) (any, error) {
+		ledger.Mint(p.Address, p.Amount)
+		return map[string]any{"status": "minted", "address": p.Address, "amount": p.Amount}, nil
+	})
+	registerMethod("ledger_transfer", func(p ledgerTransferParams) (any, error) {
+		if err := ledger.Transfer(p.From, p.To, p.Amount, p.Fee); err != nil {
+			return nil, err
+		}
+		return map[string]any{"status": "transferred", "from": p.From, "to": p.To, "amount": p.Amount, "fee": p.Fee}, nil
+	})
+
 	cmd := &cobra.Command{
 		Use:   "ledger",
 		Short: "Interact with the ledger",
@@ -18,10 +110,12 @@ func init() {
 	cmd.AddCommand(&cobra.Command{
 		Use:   "head",
 		Short: "Show chain height and latest block hash",
+		Long: `Show the chain height and the hash of the latest block. When the ledger runs
+a fee market the base fee per unit of gas the next block must declare is
+shown as well.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("LedgerHead")
-			h, hash := ledger.Head()
-			printOutput(map[string]any{"height": h, "hash": hash})
+			printResult(invoke("ledger_head", nil))
 		},
 	})
 
@@ -36,23 +130,61 @@ func init() {
 				printOutput(map[string]any{"error": "invalid height"})
 				return
 			}
-			if b, ok := ledger.GetBlock(ht); ok {
-				printOutput(b)
-			} else {
-				printOutput(map[string]any{"error": "not found"})
-			}
+			printResult(invoke("ledger_getBlock", ledgerBlockParams{Height: ht}))
 		},
 	})
 
-	cmd.AddCommand(&cobra.Command{
+	openCmd := &cobra.Command{
+		Use:   "open [wal]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Open a ledger from its write-ahead log using the configured history mode",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				printOutput(map[string]any{"error": err.Error()})
+				return
+			}
+			if h, _ := cmd.Flags().GetString("history"); h != "" {
+				cfg.Ledger.History = h
+			}
+			if n, _ := cmd.Flags().GetInt("retain-blocks"); n > 0 {
+				cfg.Ledger.RetainBlocks = n
+			}
+			opts, err := ledgerOptions(cfg.Ledger)
+			if err != nil {
+				printOutput(map[string]any{"error": err.Error()})
+				return
+			}
+			l, err := core.OpenLedger(args[0], opts...)
+			if err != nil {
+				printOutput(map[string]any{"error": err.Error()})
+				return
+			}
+			bindLedger(l)
+			h, hash := ledger.Head()
+			mode, keep := ledger.History()
+			printOutput(map[string]any{"height": h, "hash": hash, "history": mode.String(), "retain_blocks": keep})
+		},
+	}
+	openCmd.Flags().String("history", "", "override ledger.history: full, pruned or archive")
+	openCmd.Flags().Int("retain-blocks", 0, "override ledger.retain_blocks for pruned history")
+	cmd.AddCommand(openCmd)
+
+	balanceCmd := &cobra.Command{
 		Use:   "balance [addr]",
 		Args:  cobra.ExactArgs(1),
 		Short: "Display token balance of an address",
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("LedgerBalance")
-			printOutput(ledger.GetBalance(args[0]))
+			p := ledgerAddrParams{Address: args[0]}
+			if height, _ := cmd.Flags().GetInt("at-height"); height >= 0 {
+				p.Height = &height
+			}
+			printResult(invoke("ledger_getBalance", p))
 		},
-	})
+	}
+	balanceCmd.Flags().Int("at-height", -1, "report the balance at a past block height")
+	cmd.AddCommand(balanceCmd)
 
 	cmd.AddCommand(&cobra.Command{
 		Use:   "utxo [addr]",
@@ -60,8 +192,7 @@ func init() {
 		Short: "List UTXOs for an address",
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("LedgerUTXO")
-			outs := ledger.GetUTXOs(args[0])
-			printOutput(outs)
+			printResult(invoke("ledger_getUTXOs", ledgerAddrParams{Address: args[0]}))
 		},
 	})
 
@@ -70,10 +201,48 @@ func init() {
 		Short: "List mem-pool transactions",
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("LedgerPool")
-			printOutput(ledger.Pool())
+			printResult(invoke("ledger_pool", nil))
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "receipt [txid]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Show the receipt of a transaction or contract invocation",
+		Run: func(cmd *cobra.Command, args []string) {
+			gasPrint("LedgerReceipt")
+			printResult(invoke("ledger_getReceipt", ledgerReceiptParams{TxID: args[0]}))
 		},
 	})
 
+	logsCmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Query contract event logs by height range, address and topics",
+		Long: "Query contract event logs. Each --topic flag matches one topic position in order;\n" +
+			"separate alternatives with commas and pass an empty value or * to match any topic.",
+		Run: func(cmd *cobra.Command, args []string) {
+			gasPrint("LedgerLogs")
+			f := core.LogFilter{}
+			f.FromHeight, _ = cmd.Flags().GetInt("from")
+			f.ToHeight, _ = cmd.Flags().GetInt("to")
+			f.Address, _ = cmd.Flags().GetString("address")
+			topics, _ := cmd.Flags().GetStringArray("topic")
+			for _, t := range topics {
+				var alts []string
+				if t != "" && t != "*" {
+					alts = strings.Split(t, ",")
+				}
+				f.Topics = append(f.Topics, alts)
+			}
+			printResult(invoke("ledger_getLogs", f))
+		},
+	}
+	logsCmd.Flags().Int("from", 0, "first height to search (default first block)")
+	logsCmd.Flags().Int("to", 0, "last height to search (default pending height)")
+	logsCmd.Flags().String("address", "", "only logs emitted by this contract")
+	logsCmd.Flags().StringArray("topic", nil, "topic alternatives for the next position")
+	cmd.AddCommand(logsCmd)
+
 	cmd.AddCommand(&cobra.Command{
 		Use:   "mint [addr] [amount]",
 		Args:  cobra.ExactArgs(2),
@@ -85,8 +254,7 @@ func init() {
 				printOutput(map[string]any{"error": "invalid amount"})
 				return
 			}
-			ledger.Mint(args[0], amt)
-			printOutput(map[string]any{"status": "minted", "address": args[0], "amount": amt})
+			printResult(invoke("ledger_mint", ledgerMintParams{Address: args[0], Amount: amt}))
 		},
 	})
 
@@ -109,11 +277,7 @@ func init() {
 					return
 				}
 			}
-			if err := ledger.Transfer(args[0], args[1], amt, fee); err != nil {
-				printOutput(map[string]any{"error": err.Error()})
-				return
-			}
-			printOutput(map[string]any{"status": "transferred", "from": args[0], "to": args[1], "amount": amt, "fee": fee})
+			printResult(invoke("ledger_transfer", ledgerTransferParams{From: args[0], To: args[1], Amount: amt, Fee: fee}))
 		},
 	})
 
@@ -2,8 +2,12 @@ package cli
 
 import (
 	"encoding/json"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+
+	"synnergy/core"
 )
 
 // TestLedgerMintBalance ensures minting and balance queries emit JSON with gas info.
@@ -32,3 +36,91 @@ func TestLedgerMintBalance(t *testing.T) {
 		t.Fatalf("expected balance 50, got %v", bal)
 	}
 }
+
+// emptyBlock returns a block without transactions declaring the state root
+// it leaves l with.
+func emptyBlock(t *testing.T, l *core.Ledger, hash string) *core.Block {
+	t.Helper()
+	b := &core.Block{Hash: hash}
+	root, err := l.ComputeStateRoot(b)
+	if err != nil {
+		t.Fatalf("state root: %v", err)
+	}
+	b.StateRoot = root
+	return b
+}
+
+// TestLedgerBalanceAtHeight opens an archive ledger and queries past balances.
+func TestLedgerBalanceAtHeight(t *testing.T) {
+	prev := ledger
+	t.Cleanup(func() { bindLedger(prev) })
+	wal := filepath.Join(t.TempDir(), "ledger.wal")
+	out, err := execCommand("ledger", "open", wal, "--history", "archive")
+	if err != nil || !strings.Contains(out, "archive") {
+		t.Fatalf("open: %q %v", out, err)
+	}
+	ledger.Mint("alice", 10)
+	if err := ledger.AddBlock(emptyBlock(t, ledger, "b1")); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	ledger.Mint("alice", 5)
+
+	for height, want := range []string{"10", "15"} {
+		out, err := execCommand("ledger", "balance", "alice", "--at-height", strconv.Itoa(height))
+		if err != nil || !strings.HasSuffix(out, want) {
+			t.Fatalf("balance at %d: %q %v", height, out, err)
+		}
+	}
+	out, _ = execCommand("ledger", "balance", "alice", "--at-height", "2")
+	if !strings.Contains(out, "historical state unavailable") {
+		t.Fatalf("expected an error above the head, got %q", out)
+	}
+}
+
+// TestLedgerReceiptAndLogs queries recorded receipts and filters their logs.
+func TestLedgerReceiptAndLogs(t *testing.T) {
+	prev := ledger
+	l := core.NewLedger()
+	bindLedger(l)
+	t.Cleanup(func() { bindLedger(prev) })
+	topic := strings.Repeat("ab", 32)
+	rcpt := &core.Receipt{Status: core.ReceiptSuccess, ContractAddress: "c1", Logs: []core.ContractLog{
+		{Address: "c1", Topics: []string{topic}, Data: []byte("x")},
+		{Address: "c2", Topics: []string{strings.Repeat("cd", 32)}},
+	}}
+	if err := l.ApplyContractChanges(&core.ContractStateChanges{Receipt: rcpt}); err != nil {
+		t.Fatalf("record receipt: %v", err)
+	}
+	jsonOut := func(args ...string) string {
+		t.Helper()
+		out, err := execCommand(append(args, "--json")...)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if err := rootCmd.PersistentFlags().Set("json", "false"); err != nil {
+			t.Fatalf("reset json: %v", err)
+		}
+		return out[strings.Index(out, "\n")+1:]
+	}
+
+	var got core.Receipt
+	if err := json.Unmarshal([]byte(jsonOut("ledger", "receipt", rcpt.TxID)), &got); err != nil {
+		t.Fatalf("unmarshal receipt: %v", err)
+	}
+	if got.TxID != rcpt.TxID || got.BlockHeight != 1 || len(got.Logs) != 2 {
+		t.Fatalf("unexpected receipt %+v", got)
+	}
+	var logs []core.ContractLog
+	if err := json.Unmarshal([]byte(jsonOut("ledger", "logs", "--topic", "00,"+topic)), &logs); err != nil {
+		t.Fatalf("unmarshal logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Address != "c1" || logs[0].TxID != rcpt.TxID {
+		t.Fatalf("unexpected logs %+v", logs)
+	}
+	if out := jsonOut("ledger", "logs", "--address", "c2", "--topic", "*", "--to", "1"); !strings.Contains(out, `"log_index": 1`) {
+		t.Fatalf("unexpected logs for c2: %s", out)
+	}
+	if out, _ := execCommand("ledger", "receipt", "missing"); !strings.Contains(out, "receipt not found") {
+		t.Fatalf("expected missing receipt error, got %q", out)
+	}
+}
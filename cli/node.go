@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/spf13/cobra"
@@ -10,7 +13,59 @@ import (
 
 var currentNode = core.NewNode("node1", "localhost", ledger)
 
+type nodeStakeParams struct {
+	Address string `json:"address"`
+	Amount  uint64 `json:"amount"`
+}
+
+type nodeAddrParams struct {
+	Address string `json:"address"`
+}
+
 func init() {
+	registerMethod("node_info", func(struct{}) (any, error) {
+		return map[string]any{
+			"id":     currentNode.ID,
+			"addr":   currentNode.Addr,
+			"height": len(currentNode.Blockchain),
+		}, nil
+	})
+	registerMethod("node_setStake", func(p nodeStakeParams) (any, error) {
+		if err := currentNode.SetStake(p.Address, p.Amount); err != nil {
+			return nil, err
+		}
+		return map[string]any{"address": p.Address, "stake": p.Amount}, nil
+	})
+	registerMethod("node_slash", func(ev core.Evidence) (any, error) {
+		if err := currentNode.SubmitEvidence(&ev); err != nil {
+			return nil, err
+		}
+		return map[string]any{"id": ev.ID(), "kind": ev.Kind, "validator": ev.Validator, "status": "pending"}, nil
+	})
+	registerMethod("node_evidence", func(struct{}) (any, error) {
+		return currentNode.PendingEvidence(), nil
+	})
+	registerMethod("node_rehabilitate", func(p nodeAddrParams) (any, error) {
+		currentNode.Rehabilitate(p.Address)
+		return "rehabilitated", nil
+	})
+	registerMethod("node_addTransaction", func(tx core.Transaction) (any, error) {
+		if err := currentNode.AddTransaction(&tx); err != nil {
+			return nil, err
+		}
+		return "transaction added", nil
+	})
+	registerMethod("node_mempool", func(struct{}) (any, error) {
+		return map[string]int{"size": currentNode.Mempool.Len()}, nil
+	})
+	registerMethod("node_mine", func(struct{}) (any, error) {
+		block := currentNode.MineBlock()
+		if block == nil {
+			return "no transactions to mine", nil
+		}
+		return map[string]any{"hash": block.Hash, "nonce": block.Nonce}, nil
+	})
+
 	nodeCmd := &cobra.Command{
 		Use:   "node",
 		Short: "Node operations",
@@ -20,12 +75,7 @@ func init() {
 		Short: "Show node information",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			gasPrint("NodeInfo")
-			printOutput(map[string]any{
-				"id":     currentNode.ID,
-				"addr":   currentNode.Addr,
-				"height": len(currentNode.Blockchain),
-			})
-			return nil
+			return printInvoke("node_info", nil)
 		},
 	}
 	stakeCmd := &cobra.Command{
@@ -38,29 +88,37 @@ func init() {
 			if err != nil {
 				return fmt.Errorf("invalid amount")
 			}
-			if err := currentNode.SetStake(args[0], amt); err != nil {
-				return err
-			}
-			printOutput(map[string]any{"address": args[0], "stake": amt})
-			return nil
+			return printInvoke("node_setStake", nodeStakeParams{Address: args[0], Amount: amt})
 		},
 	}
 	slashCmd := &cobra.Command{
-		Use:   "slash [address] [reason]",
-		Args:  cobra.ExactArgs(2),
-		Short: "Slash a validator (reason: double|downtime)",
+		Use:   "slash [evidence-file]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Submit misbehaviour evidence against a validator",
+		Long: `Submit a JSON evidence file proving that a validator double-signed or was
+offline. Double-sign evidence holds two conflicting votes or sub-blocks the
+validator signed for one height; downtime evidence names the last block of
+a window the chain's liveness records show the validator failed to sign. The
+node verifies the evidence and the validator is slashed once a block carrying
+it is mined.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			gasPrint("NodeSlash")
-			switch args[1] {
-			case "double":
-				currentNode.ReportDoubleSign(args[0])
-			case "downtime":
-				currentNode.ReportDowntime(args[0])
-			default:
-				return fmt.Errorf("invalid reason")
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
 			}
-			printOutput("slashed")
-			return nil
+			var ev core.Evidence
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return fmt.Errorf("invalid evidence file: %w", err)
+			}
+			return printInvoke("node_slash", ev)
+		},
+	}
+	evidenceCmd := &cobra.Command{
+		Use:   "evidence",
+		Short: "List evidence awaiting inclusion in a block",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printInvoke("node_evidence", nil)
 		},
 	}
 	rehabCmd := &cobra.Command{
@@ -69,15 +127,13 @@ func init() {
 		Short: "Rehabilitate a slashed validator",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			gasPrint("NodeRehab")
-			currentNode.Rehabilitate(args[0])
-			printOutput("rehabilitated")
-			return nil
+			return printInvoke("node_rehabilitate", nodeAddrParams{Address: args[0]})
 		},
 	}
 	addTxCmd := &cobra.Command{
 		Use:   "addtx [from] [to] [amount] [fee] [nonce]",
 		Args:  cobra.ExactArgs(5),
-		Short: "Add a transaction to the mempool",
+		Short: "Sign and add a transaction to the mempool",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			gasPrint("NodeAddTx")
 			amt, err := strconv.ParseUint(args[2], 10, 64)
@@ -93,11 +149,21 @@ func init() {
 				return fmt.Errorf("invalid nonce")
 			}
 			tx := core.NewTransaction(args[0], args[1], amt, fee, nonce)
-			if err := currentNode.AddTransaction(tx); err != nil {
-				return err
+			walletPath, _ := cmd.Flags().GetString("wallet")
+			password, _ := cmd.Flags().GetString("password")
+			if walletPath != "" {
+				w, err := loadWallet(walletPath, password)
+				if err != nil {
+					return err
+				}
+				if w.Address != args[0] {
+					return errors.New("wallet address mismatch")
+				}
+				if _, err := w.Sign(tx); err != nil {
+					return err
+				}
 			}
-			printOutput("transaction added")
-			return nil
+			return printInvoke("node_addTransaction", tx)
 		},
 	}
 	mempoolCmd := &cobra.Command{
@@ -105,8 +171,7 @@ func init() {
 		Short: "Show mempool size",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			gasPrint("NodeMempool")
-			printOutput(map[string]int{"size": len(currentNode.Mempool)})
-			return nil
+			return printInvoke("node_mempool", nil)
 		},
 	}
 	mineCmd := &cobra.Command{
@@ -114,15 +179,11 @@ func init() {
 		Short: "Mine a block from the current mempool",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			gasPrint("NodeMine")
-			block := currentNode.MineBlock()
-			if block == nil {
-				printOutput("no transactions to mine")
-				return nil
-			}
-			printOutput(map[string]any{"hash": block.Hash, "nonce": block.Nonce})
-			return nil
+			return printInvoke("node_mine", nil)
 		},
 	}
-	nodeCmd.AddCommand(infoCmd, stakeCmd, slashCmd, rehabCmd, addTxCmd, mempoolCmd, mineCmd)
+	addTxCmd.Flags().String("wallet", "", "wallet file used to sign the transaction")
+	addTxCmd.Flags().String("password", "", "wallet password")
+	nodeCmd.AddCommand(nodeRunCmd(), infoCmd, stakeCmd, slashCmd, evidenceCmd, rehabCmd, addTxCmd, mempoolCmd, mineCmd)
 	rootCmd.AddCommand(nodeCmd)
 }
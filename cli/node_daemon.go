@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"synnergy/core"
+	"synnergy/internal/config"
+	ilog "synnergy/internal/log"
+	"synnergy/internal/rpc"
+)
+
+// daemonConfig selects where `node run` serves the API and which ledger it
+// operates on.
+type daemonConfig struct {
+	HTTP   string // TCP listen address, empty to disable
+	Socket string // Unix socket path, empty to disable
+	WAL    string // ledger write-ahead log, empty for an in-memory ledger
+	Token  string // API token for state-changing methods over HTTP
+}
+
+// runDaemon serves the node API until ctx is cancelled. When ready is not nil
+// it receives the listeners once they are accepting connections.
+func runDaemon(ctx context.Context, cfg daemonConfig, ready chan<- []net.Listener) error {
+	if cfg.HTTP == "" && cfg.Socket == "" {
+		return errors.New("no listen address: set --http or --socket")
+	}
+	if cfg.WAL != "" {
+		c, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		opts, err := ledgerOptions(c.Ledger)
+		if err != nil {
+			return err
+		}
+		l, err := core.OpenLedger(cfg.WAL, opts...)
+		if err != nil {
+			return err
+		}
+		stateMu.Lock()
+		bindLedger(l)
+		stateMu.Unlock()
+	}
+
+	rpcMethods.SetToken(cfg.Token)
+
+	var listeners []net.Listener
+	for _, endpoint := range []string{cfg.HTTP, cfg.Socket} {
+		if endpoint == "" {
+			continue
+		}
+		if endpoint == cfg.Socket {
+			endpoint = "unix://" + endpoint
+		}
+		ln, err := rpc.Listen(endpoint)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+	if cfg.Socket != "" {
+		defer os.Remove(cfg.Socket)
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		ilog.Info("rpc_listen", "network", ln.Addr().Network(), "addr", ln.Addr().String(), "version", rpc.Version)
+		go func(ln net.Listener) { errs <- rpcMethods.Serve(ctx, ln) }(ln)
+	}
+	if ready != nil {
+		ready <- listeners
+	}
+	var err error
+	for range listeners {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func nodeRunCmd() *cobra.Command {
+	var cfg daemonConfig
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run the node daemon serving the JSON-RPC API",
+		Long: "Run the node daemon. The JSON-RPC 2.0 API is served at " + rpc.Path +
+			" over HTTP and a Unix socket; other commands reach it with --rpc. Requests must be" +
+			" sent as application/json, and over HTTP only to a loopback host and without an Origin" +
+			" header. Methods that change node state without a signed transaction, such as" +
+			" ledger mint and node slash, are served over HTTP only to callers whose --rpc-token" +
+			" matches --token; without a token they are served on the Unix socket only.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			return runDaemon(ctx, cfg, nil)
+		},
+	}
+	cmd.Flags().StringVar(&cfg.HTTP, "http", "127.0.0.1:8545", "HTTP listen address (empty to disable)")
+	cmd.Flags().StringVar(&cfg.Socket, "socket", filepath.Join(os.TempDir(), "synnergy.sock"), "Unix socket path (empty to disable)")
+	cmd.Flags().StringVar(&cfg.WAL, "wal", "", "ledger write-ahead log to open")
+	cmd.Flags().StringVar(&cfg.Token, "token", "", "API token for state-changing methods over HTTP (empty to serve them on the Unix socket only)")
+	return cmd
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"synnergy/internal/rpc"
+)
+
+// TestNodeDaemonServesCommands runs the daemon and drives it with --rpc over
+// both transports, checking state persists between invocations.
+func TestNodeDaemonServesCommands(t *testing.T) {
+	prev := ledger
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "node.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan []net.Listener, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(ctx, daemonConfig{HTTP: "127.0.0.1:0", Socket: sock, WAL: filepath.Join(dir, "ledger.wal"), Token: "secret"}, ready)
+	}()
+	var listeners []net.Listener
+	select {
+	case listeners = <-ready:
+	case err := <-done:
+		t.Fatalf("daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("daemon: %v", err)
+		}
+		bindLedger(prev)
+	})
+	httpAddr := "http://" + listeners[0].Addr().String()
+
+	if out, err := execCommand("ledger", "mint", "alice", "25", "--rpc", sock); err != nil || !strings.Contains(out, "minted") {
+		t.Fatalf("mint: %q %v", out, err)
+	}
+	out, err := execCommand("ledger", "balance", "alice", "--rpc", httpAddr)
+	if err != nil || !strings.HasSuffix(out, "25") {
+		t.Fatalf("balance: %q %v", out, err)
+	}
+	// minting over HTTP needs the daemon's token
+	if out, _ := execCommand("ledger", "mint", "alice", "5", "--rpc", httpAddr); !strings.Contains(out, "API token") {
+		t.Fatalf("expected an untokened mint to be refused, got %q", out)
+	}
+	if out, err := execCommand("ledger", "mint", "alice", "5", "--rpc", httpAddr, "--rpc-token", "secret"); err != nil || !strings.Contains(out, "minted") {
+		t.Fatalf("tokened mint: %q %v", out, err)
+	}
+	if _, err := execCommand("contracts", "info", "missing", "--rpc", httpAddr); err == nil || !strings.Contains(err.Error(), "contract not found") {
+		t.Fatalf("expected remote error, got %v", err)
+	}
+
+	c, err := rpc.Dial(sock)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	var methods struct {
+		Version string   `json:"version"`
+		Methods []string `json:"methods"`
+	}
+	if err := c.Call(context.Background(), "rpc_methods", nil, &methods); err != nil {
+		t.Fatalf("methods: %v", err)
+	}
+	joined := strings.Join(methods.Methods, " ")
+	for _, m := range []string{"ledger_getBalance", "node_info", "consensus_weights", "contracts_deploy", "tokens_list"} {
+		if !strings.Contains(joined, m) {
+			t.Fatalf("method %s not served: %v", m, methods.Methods)
+		}
+	}
+}
@@ -44,8 +44,10 @@ func TestNodeCLICommands(t *testing.T) {
 
 	}
 
-	ledger.Mint("alice", 100)
-	if _, err := execNodeCLI("node", "addtx", "alice", "bob", "10", "1", "1"); err != nil {
+	useMemoryWalletLoader(t)
+	alice, walletPath := newMemoryWallet(t, "pw")
+	ledger.Mint(alice.Address, 100)
+	if _, err := execNodeCLI("node", "addtx", alice.Address, "bob", "10", "1", "0", "--wallet", walletPath, "--password", "pw"); err != nil {
 		t.Fatalf("addtx failed: %v", err)
 	}
 	out, _ = execNodeCLI("--json", "node", "mempool")
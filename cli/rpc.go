@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"synnergy/core"
+	"synnergy/internal/rpc"
+)
+
+var (
+	// rpcEndpoint is the JSON-RPC endpoint of a running node set with --rpc.
+	rpcEndpoint string
+
+	// rpcToken is the API token sent to the daemon, set with --rpc-token.
+	rpcToken string
+
+	// rpcMethods is the API served by `synnergy node run`. Commands dispatch
+	// through it, in-process by default or to the daemon named by --rpc, so a
+	// command behaves the same whichever state it operates on.
+	rpcMethods = rpc.NewServer()
+
+	// stateMu serialises method calls against the package-level state.
+	stateMu sync.Mutex
+)
+
+// adminMethods change node state on the caller's say-so rather than on a
+// signed transaction. The daemon serves them over HTTP only to callers
+// presenting its token.
+var adminMethods = []string{
+	"ledger_mint", "ledger_transfer",
+	"node_setStake", "node_slash", "node_rehabilitate", "node_mine",
+	"contracts_deploy", "contracts_invoke",
+	"consensus_mine", "consensus_adjustWeights", "consensus_setAvailability", "consensus_setPoWRewards",
+	"tokens_registerBase",
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&rpcEndpoint, "rpc", "", "JSON-RPC endpoint of a running node (host:port, http://host:port or a unix socket path)")
+	rootCmd.PersistentFlags().StringVar(&rpcToken, "rpc-token", "", "API token for state-changing methods when --rpc names an HTTP endpoint")
+	rpcMethods.Protect(adminMethods...)
+}
+
+// registerMethod adds a method to the node API. Calls are serialised, so fn
+// may use the package-level state without further locking.
+func registerMethod[P any](name string, fn func(P) (any, error)) {
+	rpcMethods.Register(name, rpc.Method(func(_ context.Context, p P) (any, error) {
+		stateMu.Lock()
+		defer stateMu.Unlock()
+		return fn(p)
+	}))
+}
+
+// invoke calls method against the local state or, when --rpc is set, against
+// the daemon.
+func invoke(method string, params any) (any, error) {
+	ctx := context.Background()
+	if rpcEndpoint == "" {
+		return rpcMethods.Invoke(ctx, method, params)
+	}
+	c, err := rpc.Dial(rpcEndpoint, rpc.WithToken(rpcToken))
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := c.Call(ctx, method, params, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// invokeAs calls method like invoke and converts the result to T.
+func invokeAs[T any](method string, params any) (T, error) {
+	var out T
+	res, err := invoke(method, params)
+	if err != nil {
+		return out, err
+	}
+	if v, ok := res.(T); ok {
+		return v, nil
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return out, err
+	}
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+// bindLedger makes l the ledger behind the CLI and rebuilds the components
+// served over RPC that hold a reference to it.
+func bindLedger(l *core.Ledger) {
+	ledger = l
+	currentNode = core.NewNode(currentNode.ID, currentNode.Addr, l)
+	contractRegistry = core.NewContractRegistry(contractVM, l)
+	contractMgr = core.NewContractManager(contractRegistry, core.WithUpgradeProposals(proposalMgr))
+	syncMgr = core.NewSyncManager(l)
+}
+
+// printResult prints the outcome of invoke in the style used by the ledger
+// commands, reporting failures as an error object.
+func printResult(v any, err error) {
+	if err != nil {
+		printOutput(map[string]any{"error": err.Error()})
+		return
+	}
+	printOutput(v)
+}
+
+// printInvoke calls method and prints its result, for commands that report
+// failures through their returned error.
+func printInvoke(method string, params any) error {
+	res, err := invoke(method, params)
+	if err != nil {
+		return err
+	}
+	printOutput(res)
+	return nil
+}
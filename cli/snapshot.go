@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"synnergy/core"
+)
+
+// snapshotSummary is printed by the snapshot commands.
+type snapshotSummary struct {
+	Height    int    `json:"height"`
+	BlockHash string `json:"block_hash"`
+	StateRoot string `json:"state_root"`
+	Chunks    int    `json:"chunks"`
+	Producer  string `json:"producer"`
+}
+
+func summariseSnapshot(m *core.SnapshotManifest) snapshotSummary {
+	return snapshotSummary{Height: m.Height, BlockHash: m.BlockHash, StateRoot: m.StateRoot, Chunks: len(m.Chunks), Producer: m.Producer}
+}
+
+func init() {
+	snapCmd := &cobra.Command{Use: "snapshot", Short: "Chunked state snapshots for fast sync"}
+
+	createCmd := &cobra.Command{
+		Use:   "create [dir]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Write a signed state snapshot of the ledger to a directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			height, _ := cmd.Flags().GetInt("height")
+			chunkSize, _ := cmd.Flags().GetInt("chunk-size")
+			walletPath, _ := cmd.Flags().GetString("wallet")
+			password, _ := cmd.Flags().GetString("password")
+			w, err := loadWallet(walletPath, password)
+			if err != nil {
+				return err
+			}
+			snap, err := core.CreateSnapshot(ledger, height, w, core.WithSnapshotChunkSize(chunkSize), core.WithSnapshotTokens(tokenRegistry))
+			if err != nil {
+				return err
+			}
+			if err := snap.WriteDir(args[0]); err != nil {
+				return err
+			}
+			m, _ := snap.Manifest()
+			s := summariseSnapshot(m)
+			if jsonOutput {
+				printOutput(s)
+			} else {
+				printOutput(fmt.Sprintf("snapshot at height %d with %d chunks, state root %s", s.Height, s.Chunks, s.StateRoot))
+			}
+			return nil
+		},
+	}
+	createCmd.Flags().Int("height", 0, "block height to snapshot (default head)")
+	createCmd.Flags().Int("chunk-size", core.DefaultSnapshotChunkSize, "target chunk size in bytes")
+	createCmd.Flags().String("wallet", "", "wallet file of the producing node")
+	createCmd.Flags().String("password", "", "wallet password")
+	_ = createCmd.MarkFlagRequired("wallet")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify [dir]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Check a snapshot's signature, chunks and state root against a trusted producer, block or root",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := core.VerifySnapshot(core.SnapshotDir(args[0]), snapshotTrust(cmd)...)
+			if err != nil {
+				return err
+			}
+			s := summariseSnapshot(m)
+			if jsonOutput {
+				printOutput(s)
+			} else {
+				printOutput(fmt.Sprintf("valid snapshot at height %d signed by %s, state root %s", s.Height, s.Producer, s.StateRoot))
+			}
+			return nil
+		},
+	}
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore [dir]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Verify a snapshot and load it into a fresh ledger",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			wal, _ := cmd.Flags().GetString("wal")
+			l, err := core.OpenLedger(wal)
+			if err != nil {
+				return err
+			}
+			opts := append(snapshotTrust(cmd), core.WithSnapshotTokens(tokenRegistry))
+			m, err := l.RestoreSnapshot(core.SnapshotDir(args[0]), opts...)
+			if err != nil {
+				l.Close()
+				return err
+			}
+			bindLedger(l)
+			s := summariseSnapshot(m)
+			if jsonOutput {
+				printOutput(s)
+			} else {
+				printOutput(fmt.Sprintf("restored height %d, state root %s", s.Height, s.StateRoot))
+			}
+			return nil
+		},
+	}
+	restoreCmd.Flags().String("wal", "", "write-ahead log of the restored ledger")
+	for _, c := range []*cobra.Command{verifyCmd, restoreCmd} {
+		c.Flags().StringSlice("producer", nil, "address of a trusted snapshot producer")
+		c.Flags().String("block", "", "trusted hash of the snapshot's block")
+		c.Flags().String("state-root", "", "trusted state root of the snapshot")
+	}
+
+	snapCmd.AddCommand(createCmd, verifyCmd, restoreCmd)
+	rootCmd.AddCommand(snapCmd)
+}
+
+// snapshotTrust turns the --producer, --block and --state-root flags into
+// the trust anchors a snapshot must satisfy. Without any of them the
+// snapshot is rejected.
+func snapshotTrust(cmd *cobra.Command) []core.SnapshotOption {
+	var opts []core.SnapshotOption
+	if producers, _ := cmd.Flags().GetStringSlice("producer"); len(producers) > 0 {
+		opts = append(opts, core.WithTrustedSnapshotProducers(producers...))
+	}
+	if hash, _ := cmd.Flags().GetString("block"); hash != "" {
+		opts = append(opts, core.WithTrustedSnapshotBlock(hash))
+	}
+	if root, _ := cmd.Flags().GetString("state-root"); root != "" {
+		opts = append(opts, core.WithTrustedSnapshotRoot(root))
+	}
+	return opts
+}
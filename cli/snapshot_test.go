@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"synnergy/core"
+)
+
+func TestSnapshotCommands(t *testing.T) {
+	prev := ledger
+	t.Cleanup(func() {
+		ledger = prev
+		jsonOutput = false
+	})
+	ledger = core.NewLedger()
+	ledger.Mint("alice", 50)
+	if err := ledger.AddBlock(emptyBlock(t, ledger, "b1")); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	useMemoryWalletLoader(t)
+	w, walletPath := newMemoryWallet(t, "pw")
+	dir := filepath.Join(t.TempDir(), "snap")
+
+	out, err := executeCLICommand(t, "--json", "snapshot", "create", dir, "--wallet", walletPath, "--password", "pw")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var created snapshotSummary
+	if err := json.Unmarshal([]byte(out), &created); err != nil || created.Height != 1 || created.StateRoot != ledger.StateRoot() {
+		t.Fatalf("unexpected create output %q: %v", out, err)
+	}
+
+	if _, err := executeCLICommand(t, "snapshot", "verify", dir); !errors.Is(err, core.ErrSnapshotUntrusted) {
+		t.Fatalf("expected a snapshot without a trust anchor to be rejected, got %v", err)
+	}
+	out, err = executeCLICommand(t, "--json", "snapshot", "verify", dir, "--producer", w.Address)
+	if err != nil || !strings.Contains(out, created.StateRoot) {
+		t.Fatalf("verify: %q %v", out, err)
+	}
+
+	source := ledger
+	if _, err := executeCLICommand(t, "--json", "snapshot", "restore", dir, "--state-root", created.StateRoot); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if ledger == source || ledger.GetBalance("alice") != 50 || ledger.StateRoot() != source.StateRoot() {
+		t.Fatalf("snapshot not restored into a new ledger")
+	}
+
+	manifest := filepath.Join(dir, "manifest.json")
+	raw, _ := os.ReadFile(manifest)
+	os.WriteFile(manifest, []byte(strings.Replace(string(raw), `"height": 1`, `"height": 2`, 1)), 0o600)
+	if _, err := executeCLICommand(t, "snapshot", "verify", dir, "--producer", w.Address); err == nil {
+		t.Fatalf("expected a tampered manifest to fail verification")
+	}
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"synnergy/core"
+)
+
+type stakingRewardsParams struct {
+	Delegator string `json:"delegator"`
+	Validator string `json:"validator,omitempty"`
+}
+
+func init() {
+	registerMethod("staking_submit", func(tx core.Transaction) (any, error) {
+		if err := currentNode.AddTransaction(&tx); err != nil {
+			return nil, err
+		}
+		return map[string]any{"id": tx.ID, "from": tx.From, "validator": tx.To, "amount": tx.Amount, "status": "pending"}, nil
+	})
+	registerMethod("staking_nonce", func(p nodeAddrParams) (any, error) {
+		return nextNonce(p.Address), nil
+	})
+	registerMethod("staking_rewards", func(p stakingRewardsParams) (any, error) {
+		l := currentNode.Ledger
+		if p.Validator != "" {
+			return core.Delegation{
+				Delegator: p.Delegator,
+				Validator: p.Validator,
+				Amount:    l.Bonded(p.Delegator, p.Validator),
+				Rewards:   l.Rewards(p.Delegator, p.Validator),
+			}, nil
+		}
+		return map[string]any{
+			"delegations":   l.Delegations(p.Delegator),
+			"unbonding":     l.Unbonding(p.Delegator),
+			"redelegations": l.Redelegations(p.Delegator),
+		}, nil
+	})
+
+	cmd := &cobra.Command{
+		Use:   "staking",
+		Short: "Delegate stake to validators and collect rewards",
+		Long: `Bond stake to validators on the ledger. Anyone can delegate to a validator;
+the validator keeps its commission from the rewards it is paid and the rest is
+shared among its delegators in proportion to their stake. Transactions are
+signed with --wallet and added to the node's mempool.`,
+	}
+
+	delegateCmd := &cobra.Command{
+		Use:   "delegate <validator> <amount>",
+		Args:  cobra.ExactArgs(2),
+		Short: "Delegate stake to a validator",
+		Long: `Delegate amount of the wallet's balance to validator. With --from the stake
+is redelegated from another validator instead; it stays slashable for that
+validator's offences for the unbonding period.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gasPrint("StakingDelegate")
+			amt, err := strconv.ParseUint(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid amount")
+			}
+			src, _ := cmd.Flags().GetString("from")
+			return submitStaking(cmd, func(from string, fee, nonce uint64) *core.Transaction {
+				if src != "" {
+					return core.NewRedelegateTransaction(from, src, args[0], amt, fee, nonce)
+				}
+				return core.NewBondTransaction(from, args[0], amt, fee, nonce)
+			})
+		},
+	}
+	delegateCmd.Flags().String("from", "", "validator to redelegate the stake from")
+
+	undelegateCmd := &cobra.Command{
+		Use:   "undelegate <validator> <amount>",
+		Args:  cobra.ExactArgs(2),
+		Short: "Start unbonding stake delegated to a validator",
+		Long: `Start unbonding amount of the stake delegated to validator. It stops earning
+rewards at once and returns to the wallet's balance after the unbonding
+period, during which it can still be slashed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gasPrint("StakingUndelegate")
+			amt, err := strconv.ParseUint(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid amount")
+			}
+			return submitStaking(cmd, func(from string, fee, nonce uint64) *core.Transaction {
+				return core.NewUnbondTransaction(from, args[0], amt, fee, nonce)
+			})
+		},
+	}
+
+	rewardsCmd := &cobra.Command{
+		Use:   "rewards <delegator> [validator]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "Show or withdraw delegation rewards",
+		Long: `Show the stake and unwithdrawn rewards of delegator, with every validator or
+only validator. With --withdraw the rewards earned with validator are paid to
+the delegator's balance.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gasPrint("StakingRewards")
+			params := stakingRewardsParams{Delegator: args[0]}
+			if len(args) == 2 {
+				params.Validator = args[1]
+			}
+			if withdraw, _ := cmd.Flags().GetBool("withdraw"); !withdraw {
+				return printInvoke("staking_rewards", params)
+			}
+			if params.Validator == "" {
+				return errors.New("validator required to withdraw")
+			}
+			return submitStaking(cmd, func(from string, fee, nonce uint64) *core.Transaction {
+				return core.NewWithdrawRewardsTransaction(from, params.Validator, fee, nonce)
+			}, params.Delegator)
+		},
+	}
+	rewardsCmd.Flags().Bool("withdraw", false, "withdraw the rewards instead of showing them")
+
+	commissionCmd := &cobra.Command{
+		Use:   "commission <rate>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Set the wallet validator's commission in basis points",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gasPrint("StakingCommission")
+			rate, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil || rate > core.MaxCommission {
+				return fmt.Errorf("invalid rate: must be 0-%d basis points", core.MaxCommission)
+			}
+			return submitStaking(cmd, func(from string, fee, nonce uint64) *core.Transaction {
+				return core.NewCommissionTransaction(from, rate, fee, nonce)
+			})
+		},
+	}
+
+	for _, c := range []*cobra.Command{delegateCmd, undelegateCmd, rewardsCmd, commissionCmd} {
+		c.Flags().String("wallet", "", "wallet file used to sign the transaction")
+		c.Flags().String("password", "", "wallet password")
+		c.Flags().Uint64("fee", 0, "transaction fee")
+		c.Flags().Int64("nonce", -1, "transaction nonce, -1 for the wallet's next nonce")
+	}
+	cmd.AddCommand(delegateCmd, undelegateCmd, rewardsCmd, commissionCmd)
+	rootCmd.AddCommand(cmd)
+}
+
+// submitStaking signs the transaction build returns with the --wallet of cmd
+// and submits it. If sender is given the wallet must belong to it.
+func submitStaking(cmd *cobra.Command, build func(from string, fee, nonce uint64) *core.Transaction, sender ...string) error {
+	walletPath, _ := cmd.Flags().GetString("wallet")
+	password, _ := cmd.Flags().GetString("password")
+	if walletPath == "" {
+		return errors.New("--wallet required to sign the transaction")
+	}
+	w, err := loadWallet(walletPath, password)
+	if err != nil {
+		return err
+	}
+	if len(sender) > 0 && w.Address != sender[0] {
+		return errors.New("wallet address mismatch")
+	}
+	fee, _ := cmd.Flags().GetUint64("fee")
+	n, _ := cmd.Flags().GetInt64("nonce")
+	nonce := uint64(n)
+	if n < 0 {
+		if nonce, err = invokeAs[uint64]("staking_nonce", nodeAddrParams{Address: w.Address}); err != nil {
+			return err
+		}
+	}
+	tx := build(w.Address, fee, nonce)
+	if _, err := w.Sign(tx); err != nil {
+		return err
+	}
+	return printInvoke("staking_submit", tx)
+}
+
+// nextNonce returns the nonce of addr's next transaction, counting those
+// waiting in the mempool.
+func nextNonce(addr string) uint64 {
+	pending := make(map[uint64]bool)
+	for _, tx := range currentNode.Mempool.Transactions() {
+		if tx.From == addr {
+			pending[tx.Nonce] = true
+		}
+	}
+	nonce := currentNode.Ledger.Nonce(addr)
+	for pending[nonce] {
+		nonce++
+	}
+	return nonce
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 	"synnergy/core"
@@ -34,14 +35,28 @@ func init() {
 	unstakeCmd := &cobra.Command{
 		Use:   "unstake <addr> <amount>",
 		Args:  cobra.ExactArgs(2),
-		Short: "Unstake tokens",
+		Short: "Start unbonding staked tokens",
+		Long: `Start unbonding staked tokens. They stop counting as stake at once but stay
+locked, and can still be slashed, until the unbonding period has passed.
+Withdraw them afterwards with "staking_node withdraw".`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			amt, err := strconv.ParseUint(args[1], 10, 64)
 			if err != nil {
 				return fmt.Errorf("invalid amount")
 			}
-			stakingNode.Unstake(args[0], amt)
-			printOutput(map[string]any{"status": "unstaked", "address": args[0], "amount": amt})
+			release := stakingNode.Unstake(args[0], amt)
+			printOutput(map[string]any{"status": "unbonding", "address": args[0], "amount": amt, "release": release.UTC().Format(time.RFC3339)})
+			return nil
+		},
+	}
+
+	withdrawCmd := &cobra.Command{
+		Use:   "withdraw <addr>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Withdraw tokens whose unbonding period has passed",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			amt := stakingNode.Withdraw(args[0])
+			printOutput(map[string]any{"status": "withdrawn", "address": args[0], "amount": amt, "unbonding": stakingNode.Unbonding(args[0])})
 			return nil
 		},
 	}
@@ -65,6 +80,6 @@ func init() {
 		},
 	}
 
-	cmd.AddCommand(stakeCmd, unstakeCmd, balanceCmd, totalCmd)
+	cmd.AddCommand(stakeCmd, unstakeCmd, withdrawCmd, balanceCmd, totalCmd)
 	rootCmd.AddCommand(cmd)
 }
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"synnergy/core"
+)
+
+func TestStakingDelegateAndRewards(t *testing.T) {
+	prev := ledger
+	bindLedger(core.NewLedger())
+	t.Cleanup(func() { bindLedger(prev) })
+	useMemoryWalletLoader(t)
+	val, valPath := newMemoryWallet(t, "pw")
+	alice, alicePath := newMemoryWallet(t, "pw")
+	if err := core.RegisterValidatorWallet(val); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	t.Cleanup(func() { core.UnregisterValidator(val.Address) })
+	if err := currentNode.RegisterValidatorWallet(val); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := currentNode.SetStake(val.Address, 1); err != nil {
+		t.Fatalf("stake: %v", err)
+	}
+	ledger.Mint(val.Address, 1_000)
+	ledger.Mint(alice.Address, 1_000)
+
+	if _, err := execCommand("staking", "delegate", val.Address, "100", "--wallet", valPath, "--password", "pw"); err != nil {
+		t.Fatalf("self bond: %v", err)
+	}
+	if _, err := execCommand("staking", "commission", "2000", "--wallet", valPath, "--password", "pw"); err != nil {
+		t.Fatalf("commission: %v", err)
+	}
+	if _, err := execCommand("staking", "delegate", val.Address, "100", "--wallet", alicePath, "--password", "pw"); err != nil {
+		t.Fatalf("delegate: %v", err)
+	}
+	if currentNode.MineBlock() == nil {
+		t.Fatalf("block not mined")
+	}
+	if ledger.Bonded(alice.Address, val.Address) != 100 || ledger.ValidatorPower(val.Address) != 200 {
+		t.Fatalf("delegation not applied: %d", ledger.Bonded(alice.Address, val.Address))
+	}
+
+	if err := ledger.DistributeReward(val.Address, 1_000); err != nil {
+		t.Fatalf("reward: %v", err)
+	}
+	out, err := execCommand("--json", "staking", "rewards", alice.Address, val.Address)
+	jsonOutput = false
+	if err != nil || !strings.Contains(out, `"rewards": 400`) {
+		t.Fatalf("rewards: %q %v", out, err)
+	}
+	if _, err := execCommand("staking", "rewards", val.Address, val.Address, "--withdraw", "--wallet", alicePath, "--password", "pw"); err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Fatalf("expected withdrawing another delegator's rewards to fail, got %v", err)
+	}
+	if _, err := execCommand("staking", "rewards", alice.Address, val.Address, "--withdraw", "--wallet", alicePath, "--password", "pw"); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if _, err := execCommand("staking", "undelegate", val.Address, "40", "--wallet", alicePath, "--password", "pw"); err != nil {
+		t.Fatalf("undelegate: %v", err)
+	}
+	currentNode.MineBlock()
+	if ledger.GetBalance(alice.Address) != 900+400 || ledger.Bonded(alice.Address, val.Address) != 60 {
+		t.Fatalf("withdraw and undelegate not applied: balance %d, bonded %d", ledger.GetBalance(alice.Address), ledger.Bonded(alice.Address, val.Address))
+	}
+	if unbonding := ledger.Unbonding(alice.Address); len(unbonding) != 1 || unbonding[0].Amount != 40 {
+		t.Fatalf("unbonding: %+v", unbonding)
+	}
+}
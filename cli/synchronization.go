@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"synnergy/core"
@@ -21,11 +22,11 @@ func init() {
 	stopCmd := &cobra.Command{Use: "stop", Short: "Stop the sync manager", Run: func(cmd *cobra.Command, args []string) { syncMgr.Stop() }}
 
 	statusCmd := &cobra.Command{Use: "status", Short: "Show sync status", Run: func(cmd *cobra.Command, args []string) {
-		running, h := syncMgr.Status()
+		st := syncMgr.Status()
 		if syncJSON {
-			_ = json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"running": running, "height": h})
+			_ = json.NewEncoder(os.Stdout).Encode(st)
 		} else {
-			fmt.Printf("running: %v height: %d\n", running, h)
+			fmt.Printf("running: %v height: %d target: %d rate: %.1f blocks/s eta: %s\n", st.Running, st.Height, st.TargetHeight, st.BlocksPerSec, st.ETA.Round(time.Second))
 		}
 	}}
 
@@ -9,7 +9,32 @@ import (
 
 var tokenRegistry = tokens.NewRegistry()
 
+type tokenIDParams struct {
+	ID tokens.TokenID `json:"id"`
+}
+
 func init() {
+	registerMethod("tokens_nextID", func(struct{}) (any, error) {
+		return tokenRegistry.NextID(), nil
+	})
+	registerMethod("tokens_registerBase", func(struct{}) (any, error) {
+		if baseToken == nil {
+			return nil, fmt.Errorf("base token not initialised")
+		}
+		tokenRegistry.Register(baseToken)
+		return "base token registered", nil
+	})
+	registerMethod("tokens_info", func(p tokenIDParams) (any, error) {
+		info, ok := tokenRegistry.Info(p.ID)
+		if !ok {
+			return nil, fmt.Errorf("token not found")
+		}
+		return info, nil
+	})
+	registerMethod("tokens_list", func(struct{}) (any, error) {
+		return tokenRegistry.List(), nil
+	})
+
 	cmd := &cobra.Command{
 		Use:   "registry",
 		Short: "Token registry utilities",
@@ -19,7 +44,10 @@ func init() {
 		Use:   "nextid",
 		Short: "Generate next token ID",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			id := tokenRegistry.NextID()
+			id, err := invokeAs[tokens.TokenID]("tokens_nextID", nil)
+			if err != nil {
+				return err
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), id)
 			return nil
 		},
@@ -30,11 +58,11 @@ func init() {
 		Use:   "register-base",
 		Short: "Register the base token",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if baseToken == nil {
-				return fmt.Errorf("base token not initialised")
+			msg, err := invokeAs[string]("tokens_registerBase", nil)
+			if err != nil {
+				return err
 			}
-			tokenRegistry.Register(baseToken)
-			fmt.Fprintln(cmd.OutOrStdout(), "base token registered")
+			fmt.Fprintln(cmd.OutOrStdout(), msg)
 			return nil
 		},
 	}
@@ -47,9 +75,9 @@ func init() {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var id uint64
 			fmt.Sscanf(args[0], "%d", &id)
-			info, ok := tokenRegistry.Info(tokens.TokenID(id))
-			if !ok {
-				return fmt.Errorf("token not found")
+			info, err := invokeAs[tokens.TokenInfo]("tokens_info", tokenIDParams{ID: tokens.TokenID(id)})
+			if err != nil {
+				return err
 			}
 			fmt.Fprintf(cmd.OutOrStdout(), "ID:%d Name:%s Symbol:%s Decimals:%d Supply:%d\n", info.ID, info.Name, info.Symbol, info.Decimals, info.TotalSupply)
 			return nil
@@ -61,7 +89,10 @@ func init() {
 		Use:   "list",
 		Short: "List all registered tokens",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			infos := tokenRegistry.List()
+			infos, err := invokeAs[[]tokens.TokenInfo]("tokens_list", nil)
+			if err != nil {
+				return err
+			}
 			for _, i := range infos {
 				fmt.Fprintf(cmd.OutOrStdout(), "ID:%d Name:%s Symbol:%s Supply:%d\n", i.ID, i.Name, i.Symbol, i.TotalSupply)
 			}
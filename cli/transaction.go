@@ -19,7 +19,25 @@ var (
 	feeFloor uint64
 )
 
+// txFromArgs builds the transaction given by the [from] [to] [amount] [fee]
+// [nonce] arguments. With --max-fee it is priced per unit of gas instead of
+// paying the flat fee.
+func txFromArgs(cmd *cobra.Command, args []string) *core.Transaction {
+	amt, _ := strconv.ParseUint(args[2], 10, 64)
+	fee, _ := strconv.ParseUint(args[3], 10, 64)
+	nonce, _ := strconv.ParseUint(args[4], 10, 64)
+	maxFee, _ := cmd.Flags().GetUint64("max-fee")
+	if maxFee == 0 {
+		return core.NewTransaction(args[0], args[1], amt, fee, nonce)
+	}
+	tip, _ := cmd.Flags().GetUint64("tip")
+	return core.NewDynamicFeeTransaction(args[0], args[1], amt, maxFee, tip, nonce)
+}
+
 func init() {
+	registerMethod("tx_simulate", func(tx core.Transaction) (any, error) {
+		return ledger.Simulate(&tx)
+	})
 
 	createCmd := &cobra.Command{
 		Use:   "create [from] [to] [amount] [fee] [nonce]",
@@ -27,10 +45,7 @@ func init() {
 		Short: "Create a transaction",
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("TxCreate")
-			amt, _ := strconv.ParseUint(args[2], 10, 64)
-			fee, _ := strconv.ParseUint(args[3], 10, 64)
-			nonce, _ := strconv.ParseUint(args[4], 10, 64)
-			tx := core.NewTransaction(args[0], args[1], amt, fee, nonce)
+			tx := txFromArgs(cmd, args)
 			printOutput(tx)
 		},
 	}
@@ -41,10 +56,7 @@ func init() {
 		Short: "Create and sign a transaction with a new wallet",
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("TxSign")
-			amt, _ := strconv.ParseUint(args[2], 10, 64)
-			fee, _ := strconv.ParseUint(args[3], 10, 64)
-			nonce, _ := strconv.ParseUint(args[4], 10, 64)
-			tx := core.NewTransaction(args[0], args[1], amt, fee, nonce)
+			tx := txFromArgs(cmd, args)
 			w, err := core.NewWallet()
 			if err != nil {
 				printOutput(map[string]any{"error": err.Error()})
@@ -60,16 +72,29 @@ func init() {
 		},
 	}
 
+	simulateCmd := &cobra.Command{
+		Use:   "simulate [from] [to] [amount] [fee] [nonce]",
+		Args:  cobra.ExactArgs(5),
+		Short: "Simulate a transaction against the ledger without applying it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gasPrint("TxSimulate")
+			tx := txFromArgs(cmd, args)
+			sim, err := invokeAs[core.Simulation]("tx_simulate", tx)
+			if err != nil {
+				return err
+			}
+			printSimulation(cmd.OutOrStdout(), &sim)
+			return nil
+		},
+	}
+
 	verifyCmd := &cobra.Command{
 		Use:   "verify [from] [to] [amount] [fee] [nonce] [pubhex] [sighex]",
 		Args:  cobra.ExactArgs(7),
 		Short: "Verify a transaction signature",
 		Run: func(cmd *cobra.Command, args []string) {
 			gasPrint("TxVerify")
-			amt, _ := strconv.ParseUint(args[2], 10, 64)
-			fee, _ := strconv.ParseUint(args[3], 10, 64)
-			nonce, _ := strconv.ParseUint(args[4], 10, 64)
-			tx := core.NewTransaction(args[0], args[1], amt, fee, nonce)
+			tx := txFromArgs(cmd, args)
 			pubBytes, _ := hex.DecodeString(args[5])
 			sig, _ := hex.DecodeString(args[6])
 			x, y := elliptic.Unmarshal(elliptic.P256(), pubBytes)
@@ -147,6 +172,10 @@ func init() {
 		},
 	}
 
-	txCmd.AddCommand(createCmd, signCmd, verifyCmd, feeCmd, baseFeeCmd, variableFeeCmd)
+	for _, c := range []*cobra.Command{createCmd, signCmd, simulateCmd, verifyCmd} {
+		c.Flags().Uint64("max-fee", 0, "Most the transaction pays per unit of gas under a fee market (replaces the flat fee)")
+		c.Flags().Uint64("tip", 0, "Priority tip per unit of gas for the block's validator")
+	}
+	txCmd.AddCommand(createCmd, signCmd, simulateCmd, verifyCmd, feeCmd, baseFeeCmd, variableFeeCmd)
 	rootCmd.AddCommand(txCmd)
 }
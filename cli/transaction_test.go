@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"fmt"
 	"strings"
 	"testing"
+
+	"synnergy/core"
 )
 
 // TestTransactionVariableFee ensures the variable fee command emits gas and result output.
@@ -18,3 +21,33 @@ func TestTransactionVariableFee(t *testing.T) {
 		t.Fatalf("unexpected output: %s", out)
 	}
 }
+
+// TestTransactionFeeMarket prices a simulated transaction at the ledger's base fee.
+func TestTransactionFeeMarket(t *testing.T) {
+	prev := ledger
+	l, err := core.OpenLedger("", core.WithFeeMarket(core.FeeMarket{InitialBaseFee: 3}))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	bindLedger(l)
+	simulate, _, _ := rootCmd.Find([]string{"tx", "simulate"})
+	t.Cleanup(func() {
+		bindLedger(prev)
+		_ = simulate.Flags().Set("max-fee", "0")
+		_ = simulate.Flags().Set("tip", "0")
+	})
+	l.Credit("alice", 1_000_000)
+
+	out, err := execCommand("ledger", "head")
+	if err != nil || !strings.Contains(out, "next_base_fee:3") {
+		t.Fatalf("head: %q %v", out, err)
+	}
+	out, err = execCommand("tx", "simulate", "alice", "bob", "10", "0", "0", "--max-fee", "5", "--tip", "1")
+	if err != nil || !strings.Contains(out, fmt.Sprintf("fee %d", 4*core.TxBaseGas)) || !strings.Contains(out, "balance bob 0 -> 10") {
+		t.Fatalf("simulate: %q %v", out, err)
+	}
+	out, err = execCommand("tx", "simulate", "alice", "bob", "10", "0", "0", "--max-fee", "2")
+	if err != nil || !strings.Contains(out, core.ErrFeeCapTooLow.Error()) {
+		t.Fatalf("expected the fee cap to be rejected: %q %v", out, err)
+	}
+}
@@ -60,7 +60,7 @@ func init() {
 			l := core.NewLedger()
 			l.Credit(args[0], amt+fee)
 			tx := core.NewTransaction(args[0], args[1], amt, fee, nonce)
-			if err := l.ApplyTransaction(tx); err != nil {
+			if err := l.Transfer(args[0], args[1], amt, fee); err != nil {
 				printOutput(map[string]any{"error": err.Error()})
 				return
 			}
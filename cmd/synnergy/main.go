@@ -198,43 +198,11 @@ func registerEnterpriseGasMetadata() error {
 		"EnterpriseSpecialLedger":    30,
 	}
 	if inserted, err := synn.EnsureGasSchedule(enterpriseSpecialGas); err != nil {
-
-		return fmt.Errorf("stage 79 gas sync failed: %w", err)
-=======
 		return fmt.Errorf("enterprise special gas sync failed: %w", err)
 	} else if len(inserted) > 0 {
 		logrus.Infof("registered %d enterprise special opcodes", len(inserted))
 	}
 
-
-	categories := []struct {
-		category    string
-		description string
-		names       []string
-	}{
-		{"consensus", "Core consensus lifecycle operations", []string{"MineBlock"}},
-		{"dao", "DAO creation and authority renewal", []string{"CreateDAO", "UpdateMemberRole", "RenewAuthorityTerm"}},
-		{"cross-chain", "Stage 24 cross-chain operations", []string{"RegisterBridge", "BridgeDeposit", "BridgeClaim", "OpenConnection", "CloseConnection", "LockMint", "BurnRelease"}},
-		{"node", "Stage 25 node and infrastructure operations", []string{"SetMode", "Stake", "Unstake", "Optimize", "SecureCommand", "TrackLogistics", "ShareTactical", "ReportFork", "Metrics"}},
-		{"templates", "Stage 29 contract templates", []string{"DeployTokenFaucetTemplate", "DeployStorageMarketTemplate", "DeployDAOGovernanceTemplate", "DeployNFTMintingTemplate", "DeployAIModelMarketTemplate"}},
-		{"marketplace", "Stage 34 marketplace settlement", []string{"DeploySmartContract", "TradeContract"}},
-		{"storage", "Stage 35 storage marketplace operations", []string{"CreateListing", "ListListings", "GetListing", "OpenDeal", "CloseDeal", "ListDeals", "GetDeal", "Storage_Pin", "Storage_Retrieve", "IPFS_Add", "IPFS_Get", "IPFS_Unpin"}},
-		{"nft", "Stage 36 NFT marketplace operations", []string{"MintNFT", "ListNFT", "BuyNFT"}},
-		{"dex", "Stage 39 liquidity view operations", []string{"Liquidity_Pool", "Liquidity_Pools"}},
-		{"wallet", "Wallet lifecycle operations", []string{"NewWallet", "Sign", "VerifySignature"}},
-		{"content", "Stage 59 content registry operations", []string{"RegisterContentNode", "UploadContent", "RetrieveContent", "ListContentNodes"}},
-		{"monetary", "Stage 40 monetary policy queries", []string{"BlockReward", "CirculatingSupply", "RemainingSupply", "InitialPrice", "AlphaFactor", "MinimumStake"}},
-		{"p2p", "Stage 67 Kademlia routing operations", []string{"KademliaStore", "KademliaGet", "KademliaClosest", "KademliaDistance"}},
-		{"orchestrator", "Stage 78 enterprise orchestrator operations", []string{"EnterpriseBootstrap", "EnterpriseConsensusSync", "EnterpriseWalletSeal", "EnterpriseNodeAudit", "EnterpriseAuthorityElect"}},
-		{"enterprise", "Stage 79 enterprise combined node operations", []string{"EnterpriseSpecialAttach", "EnterpriseSpecialDetach", "EnterpriseSpecialBroadcast", "EnterpriseSpecialSnapshot", "EnterpriseSpecialLedger"}},
-	}
-
-	register := func(category, description string, names ...string) error {
-		for _, name := range names {
-			cost := synn.GasCost(name)
-			if err := synn.RegisterGasMetadata(name, cost, category, description); err != nil {
-				return fmt.Errorf("register gas metadata %s: %w", name, err)
-=======
 	type category struct {
 		name        string
 		description string
@@ -276,18 +244,8 @@ func registerEnterpriseGasMetadata() error {
 				return fmt.Errorf("register gas metadata %s: %w", op, err)
 			}
 		}
-		return nil
 	}
 
-
-	for _, entry := range categories {
-		if err := register(entry.category, entry.description, entry.names...); err != nil {
-			return err
-		}
-	}
-
-=======
-
 	logrus.Debug("gas table loaded")
 	return nil
 }
@@ -8,8 +8,9 @@ import (
 )
 
 func TestBiometricSecurityNode(t *testing.T) {
+	from := testWallet(t, "from")
 	ledger := NewLedger()
-	ledger.Credit("from", 100)
+	ledger.Credit(from.Address, 100)
 	base := NewNode("node1", "addr1", ledger)
 	bsn := NewBiometricSecurityNode(base, nil)
 
@@ -25,21 +26,21 @@ func TestBiometricSecurityNode(t *testing.T) {
 	hash := sha256.Sum256(bio)
 	sig := ed25519.Sign(priv, hash[:])
 
-	tx := NewTransaction("from", "to", 1, 0, 0)
+	tx := signedTestTx(t, from, "to", 1, 0, 0)
 	if err := bsn.SecureAddTransaction(admin, bio, sig, tx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(base.Mempool) != 1 {
+	if base.Mempool.Len() != 1 {
 		t.Fatal("transaction not added to mempool")
 	}
 
-	tx2 := NewTransaction("from", "to", 1, 0, 1)
+	tx2 := signedTestTx(t, from, "to", 1, 0, 1)
 	wrongHash := sha256.Sum256([]byte("wrong"))
 	wrongSig := ed25519.Sign(priv, wrongHash[:])
 	if err := bsn.SecureAddTransaction(admin, []byte("wrong"), wrongSig, tx2); err == nil {
 		t.Fatal("expected authentication failure")
 	}
-	if len(base.Mempool) != 1 {
+	if base.Mempool.Len() != 1 {
 		t.Fatal("unexpected transaction added")
 	}
 
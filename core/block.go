@@ -11,22 +11,41 @@ import (
 	"time"
 )
 
-// SubBlock contains transactions ordered by PoH and validated by PoS.
+// SubBlock contains transactions ordered by PoH and validated by PoS. Height,
+// when set, is the chain height the sub-block was produced for; the PoH hash
+// and therefore the validator's signature commit to it, so two signed
+// sub-blocks for one height prove the validator double-signed.
 type SubBlock struct {
 	Transactions []*Transaction
+	TxRoot       string
 	Validator    string
 	PohHash      string
 	Timestamp    int64
 	Signature    []byte
 	ValidatorKey []byte
 	System       bool
+	Height       uint64 `json:",omitempty"`
+	// VRFProof proves the validator's VRF output for the slot, see
+	// SlotInput.
+	VRFProof []byte `json:",omitempty"`
 }
 
 const maxTimeDriftSeconds = 300 // five minutes
 
 // NewSubBlock constructs a sub-block from the given transactions and validator.
 func NewSubBlock(txs []*Transaction, validator string) *SubBlock {
-	sb := &SubBlock{Transactions: txs, Validator: validator, Timestamp: time.Now().Unix()}
+	return NewSubBlockAt(txs, validator, 0)
+}
+
+// NewSubBlockAt constructs a sub-block for the block at height.
+func NewSubBlockAt(txs []*Transaction, validator string, height uint64) *SubBlock {
+	return NewSlotSubBlock(txs, validator, height, nil)
+}
+
+// NewSlotSubBlock constructs a sub-block for the block at height carrying the
+// validator's VRF proof for the slot.
+func NewSlotSubBlock(txs []*Transaction, validator string, height uint64, proof []byte) *SubBlock {
+	sb := &SubBlock{Transactions: txs, TxRoot: TxMerkleRoot(txs), Validator: validator, Timestamp: time.Now().Unix(), Height: height, VRFProof: proof}
 	sb.PohHash = sb.Hash()
 	if err := SignSubBlock(sb); err != nil {
 		sb.Signature = nil
@@ -38,20 +57,25 @@ func NewSubBlock(txs []*Transaction, validator string) *SubBlock {
 // the genesis block. The sub-block contains no transactions and is marked so
 // that validation bypasses signature checks while still providing a PoH link.
 func NewGenesisSubBlock(validator string) *SubBlock {
-	sb := &SubBlock{Validator: validator, Timestamp: time.Now().Unix(), System: true}
+	sb := &SubBlock{TxRoot: TxMerkleRoot(nil), Validator: validator, Timestamp: time.Now().Unix(), System: true}
 	sb.PohHash = sb.Hash()
 	return sb
 }
 
 // Hash generates a deterministic hash of the sub-block's contents to provide the
-// PoH link.  For now a simple concatenation of transaction IDs is used.
+// PoH link. Transactions are committed to through their Merkle root.
 func (sb *SubBlock) Hash() string {
 	h := sha256.New()
-	for _, tx := range sb.Transactions {
-		h.Write([]byte(tx.ID))
-	}
+	h.Write([]byte(TxMerkleRoot(sb.Transactions)))
 	h.Write([]byte(sb.Validator))
 	h.Write([]byte(fmt.Sprintf("%d", sb.Timestamp)))
+	// sub-blocks without a height hash as they did before it existed
+	if sb.Height != 0 {
+		h.Write([]byte(fmt.Sprintf("height:%d;", sb.Height)))
+	}
+	if len(sb.VRFProof) != 0 {
+		h.Write([]byte(fmt.Sprintf("vrf:%x;", sb.VRFProof)))
+	}
 	return hex.EncodeToString(h.Sum(nil))
 }
 
@@ -112,6 +136,9 @@ func (sb *SubBlock) Validate() error {
 	if sb.Timestamp > now+maxTimeDriftSeconds {
 		return fmt.Errorf("timestamp in future")
 	}
+	if sb.TxRoot != TxMerkleRoot(sb.Transactions) {
+		return fmt.Errorf("tx root mismatch")
+	}
 	if sb.PohHash != sb.Hash() {
 		return fmt.Errorf("poh hash mismatch")
 	}
@@ -129,14 +156,57 @@ func (sb *SubBlock) Validate() error {
 	return nil
 }
 
-// Block aggregates validated sub-blocks and is finalized via PoW.
+// TxMerkleRoot returns the hex encoded Merkle root over the transactions. Leaves
+// commit to each transaction's ID and content hash; an odd node at any level is
+// promoted unchanged rather than paired with itself, so no two distinct
+// transaction lists share a root. An empty list yields EmptyStateRoot.
+func TxMerkleRoot(txs []*Transaction) string {
+	if len(txs) == 0 {
+		return EmptyStateRoot
+	}
+	level := make([][]byte, len(txs))
+	for i, tx := range txs {
+		var leaf [32]byte
+		if tx != nil {
+			leaf = sha256.Sum256([]byte("\x00" + tx.ID + ":" + tx.Hash()))
+		}
+		level[i] = leaf[:]
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{0x01})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// Block aggregates validated sub-blocks and is finalized via PoW. StateRoot
+// commits to the ledger state after the block's transactions are executed.
+// Under a fee market BaseFee is the price per unit of gas the block's
+// transactions pay, derived from the parent block, and GasUsed is the gas
+// they use; both are zero otherwise.
 type Block struct {
 	SubBlocks []*SubBlock
 	PrevHash  string
+	StateRoot string
+	BaseFee   uint64 `json:",omitempty"`
+	GasUsed   uint64 `json:",omitempty"`
 	Nonce     uint64
 	Timestamp int64
 	Hash      string
 	Finalized bool
+	Evidence  []Evidence `json:",omitempty"`
+	Liveness  []Vote     `json:",omitempty"`
 }
 
 // NewBlock creates a block from sub-blocks and the hash of the previous block.
@@ -147,13 +217,83 @@ func NewBlock(subBlocks []*SubBlock, prevHash string) *Block {
 // HeaderHash returns the hash of the block header for a given nonce.  This is
 // used as the proof-of-work target.
 func (b *Block) HeaderHash(nonce uint64) string {
-	h := sha256.New()
-	h.Write([]byte(b.PrevHash))
-	for _, sb := range b.SubBlocks {
-		h.Write([]byte(sb.PohHash))
+	return b.Header(0).hash(nonce)
+}
+
+// BlockHeader carries the fields of a block that its hash commits to, so a
+// chain of headers can be checked before any block bodies are downloaded.
+type BlockHeader struct {
+	Height    int      `json:"height"`
+	Hash      string   `json:"hash"`
+	PrevHash  string   `json:"prev_hash"`
+	StateRoot string   `json:"state_root,omitempty"`
+	BaseFee   uint64   `json:"base_fee,omitempty"`
+	GasUsed   uint64   `json:"gas_used,omitempty"`
+	PohHashes []string `json:"poh_hashes"`
+	Nonce     uint64   `json:"nonce"`
+	Timestamp int64    `json:"timestamp"`
+	// EvidenceRoot commits to the misbehaviour evidence the block carries.
+	EvidenceRoot string `json:"evidence_root,omitempty"`
+	// LivenessRoot commits to the finality votes the block records.
+	LivenessRoot string `json:"liveness_root,omitempty"`
+}
+
+// Header returns the header of the block at the given height.
+func (b *Block) Header(height int) BlockHeader {
+	pohs := make([]string, len(b.SubBlocks))
+	for i, sb := range b.SubBlocks {
+		pohs[i] = sb.PohHash
 	}
-	h.Write([]byte(fmt.Sprintf("%d%d", b.Timestamp, nonce)))
-	return hex.EncodeToString(h.Sum(nil))
+	return BlockHeader{
+		Height:    height,
+		Hash:      b.Hash,
+		PrevHash:  b.PrevHash,
+		StateRoot: b.StateRoot,
+		BaseFee:   b.BaseFee,
+		GasUsed:   b.GasUsed,
+		PohHashes: pohs,
+		Nonce:     b.Nonce,
+		Timestamp: b.Timestamp,
+
+		EvidenceRoot: EvidenceRoot(b.Evidence),
+		LivenessRoot: LivenessRoot(b.Liveness),
+	}
+}
+
+func (h BlockHeader) hash(nonce uint64) string {
+	d := sha256.New()
+	d.Write([]byte(h.PrevHash))
+	for _, poh := range h.PohHashes {
+		d.Write([]byte(poh))
+	}
+	d.Write([]byte(h.StateRoot))
+	// blocks without a fee market hash as they did before it existed
+	if h.BaseFee != 0 || h.GasUsed != 0 {
+		d.Write([]byte(fmt.Sprintf("fee:%d:%d;", h.BaseFee, h.GasUsed)))
+	}
+	if h.EvidenceRoot != "" {
+		d.Write([]byte("evidence:" + h.EvidenceRoot + ";"))
+	}
+	if h.LivenessRoot != "" {
+		d.Write([]byte("liveness:" + h.LivenessRoot + ";"))
+	}
+	d.Write([]byte(fmt.Sprintf("%d%d", h.Timestamp, nonce)))
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// Verify checks that the header hash matches its contents. As with
+// Block.Validate, genesis headers without a parent are not checked.
+func (h BlockHeader) Verify() error {
+	if h.PrevHash == "" {
+		return nil
+	}
+	if h.Hash == "" {
+		return fmt.Errorf("hash required")
+	}
+	if h.Hash != h.hash(h.Nonce) {
+		return fmt.Errorf("hash mismatch")
+	}
+	return nil
 }
 
 // SignSubBlock looks up the validator's wallet from the global registry and
@@ -201,13 +341,21 @@ func signSubBlock(priv *ecdsa.PrivateKey, msg string) ([]byte, []byte, error) {
 	return sig, pub, nil
 }
 
-// Validate checks that the block and its sub-blocks are internally consistent.
-// For non-genesis blocks it also verifies the stored header hash matches the
-// computed hash for the provided nonce.
+// Validate checks that the block and its sub-blocks are internally consistent,
+// including each sub-block's transaction root and the form of the state root.
+// For non-genesis blocks it also verifies the stored header hash, which covers
+// the state root, matches the computed hash for the provided nonce. Whether the
+// state root matches execution is checked by the ledger when the block is
+// applied.
 func (b *Block) Validate() error {
 	if len(b.SubBlocks) == 0 {
 		return fmt.Errorf("no sub-blocks")
 	}
+	if b.StateRoot != "" || b.PrevHash != "" {
+		if raw, err := hex.DecodeString(b.StateRoot); err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("malformed state root")
+		}
+	}
 	now := time.Now().Unix()
 	if b.Timestamp == 0 {
 		return fmt.Errorf("timestamp required")
@@ -49,9 +49,18 @@ func TestBlockHeaderHash(t *testing.T) {
 	}
 	b.Nonce = nonce
 	b.Hash = got
+	if err := b.Validate(); err == nil || !strings.Contains(err.Error(), "malformed state root") {
+		t.Fatalf("expected a block without a state root to fail, got %v", err)
+	}
+	b.StateRoot = EmptyStateRoot
+	b.Hash = b.HeaderHash(nonce)
 	if err := b.Validate(); err != nil {
 		t.Fatalf("validate: %v", err)
 	}
+	genesis := NewBlock([]*SubBlock{sb}, "")
+	if err := genesis.Validate(); err != nil {
+		t.Fatalf("a genesis block may leave its state root out: %v", err)
+	}
 }
 
 func TestSubBlockValidateRejectsDuplicateTransactions(t *testing.T) {
@@ -70,6 +79,23 @@ func TestSubBlockValidateRejectsDuplicateTransactions(t *testing.T) {
 	}
 }
 
+func TestSubBlockValidateRejectsTamperedTransactions(t *testing.T) {
+	tx := NewTransaction("a", "b", 1, 0, 0)
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatalf("wallet: %v", err)
+	}
+	if err := RegisterValidatorWallet(w); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer UnregisterValidator(w.Address)
+	sb := NewSubBlock([]*Transaction{tx}, w.Address)
+	tx.Amount = 1000
+	if err := sb.Validate(); err == nil || !strings.Contains(err.Error(), "tx root mismatch") {
+		t.Fatalf("expected tx root mismatch, got %v", err)
+	}
+}
+
 func TestBlockValidateRejectsFutureTimestamp(t *testing.T) {
 	tx := NewTransaction("a", "b", 1, 0, 0)
 	w, err := NewWallet()
@@ -82,6 +108,7 @@ func TestBlockValidateRejectsFutureTimestamp(t *testing.T) {
 	defer UnregisterValidator(w.Address)
 	sb := NewSubBlock([]*Transaction{tx}, w.Address)
 	b := NewBlock([]*SubBlock{sb}, "prevhash")
+	b.StateRoot = EmptyStateRoot
 	b.Timestamp = time.Now().Add(6 * time.Minute).Unix()
 	b.Nonce = 1
 	b.Hash = b.HeaderHash(b.Nonce)
@@ -102,6 +129,7 @@ func TestBlockValidateRejectsSubBlockAfterBlockTimestamp(t *testing.T) {
 	defer UnregisterValidator(w.Address)
 	sb := NewSubBlock([]*Transaction{tx}, w.Address)
 	b := NewBlock([]*SubBlock{sb}, "prevhash")
+	b.StateRoot = EmptyStateRoot
 	b.Timestamp = sb.Timestamp - 10
 	b.Nonce = 1
 	b.Hash = b.HeaderHash(b.Nonce)
@@ -122,6 +150,7 @@ func TestBlockValidateRequiresHash(t *testing.T) {
 	defer UnregisterValidator(w.Address)
 	sb := NewSubBlock([]*Transaction{tx}, w.Address)
 	b := NewBlock([]*SubBlock{sb}, "prevhash")
+	b.StateRoot = EmptyStateRoot
 	b.Nonce = 1
 	if err := b.Validate(); err == nil || !strings.Contains(err.Error(), "hash required") {
 		t.Fatalf("expected hash required error, got %v", err)
@@ -140,6 +169,7 @@ func TestBlockValidateDetectsHashMismatch(t *testing.T) {
 	defer UnregisterValidator(w.Address)
 	sb := NewSubBlock([]*Transaction{tx}, w.Address)
 	b := NewBlock([]*SubBlock{sb}, "prevhash")
+	b.StateRoot = EmptyStateRoot
 	b.Nonce = 1
 	b.Hash = "bad"
 	if err := b.Validate(); err == nil || !strings.Contains(err.Error(), "hash mismatch") {
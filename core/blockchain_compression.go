@@ -4,24 +4,44 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // ledgerSnapshot is a helper type used for serializing the ledger. It exposes
 // only the fields that need to be persisted.
 type ledgerSnapshot struct {
-	Balances map[string]uint64  `json:"balances"`
-	Blocks   []*Block           `json:"blocks"`
-	UTXOs    map[string][]*UTXO `json:"utxos,omitempty"`
-	Mempool  []*Transaction     `json:"mempool,omitempty"`
+	Balances map[string]uint64 `json:"balances"`
+	Blocks   []*Block          `json:"blocks"`
+	UTXOs    map[string][]UTXO `json:"utxos,omitempty"`
+	Mempool  []*Transaction    `json:"mempool,omitempty"`
 }
 
 // CompressLedger returns the gzip-compressed JSON encoding of the provided ledger.
 func CompressLedger(l *Ledger) ([]byte, error) {
 	l.mu.RLock()
-	defer l.mu.RUnlock()
-	snap := ledgerSnapshot{Balances: l.balances, Blocks: l.blocks, UTXOs: l.utxos, Mempool: l.mempool}
+	snap := ledgerSnapshot{Balances: make(map[string]uint64), UTXOs: make(map[string][]UTXO)}
+	it := l.store.Iterate([]byte(keyBalancePrefix))
+	for it.Next() {
+		snap.Balances[strings.TrimPrefix(string(it.Key()), keyBalancePrefix)] = decodeUint(it.Value())
+	}
+	it = l.store.Iterate([]byte(keyUTXOPrefix))
+	for it.Next() {
+		addr := strings.TrimPrefix(string(it.Key()), keyUTXOPrefix)
+		snap.UTXOs[addr] = l.utxosLocked(addr)
+	}
+	for h := 1; h <= l.heightLocked(); h++ {
+		b, ok := l.blockLocked(h)
+		if !ok {
+			l.mu.RUnlock()
+			return nil, fmt.Errorf("block %d missing from state store", h)
+		}
+		snap.Blocks = append(snap.Blocks, b)
+	}
+	l.mu.RUnlock()
+	snap.Mempool = l.mempool.Transactions()
 	var buf bytes.Buffer
 	gz := gzip.NewWriter(&buf)
 	if err := json.NewEncoder(gz).Encode(&snap); err != nil {
@@ -45,20 +65,34 @@ func DecompressLedger(data []byte) (*Ledger, error) {
 	if err := json.NewDecoder(gz).Decode(&snap); err != nil {
 		return nil, err
 	}
-	l := &Ledger{
-		balances: snap.Balances,
-		blocks:   snap.Blocks,
-		utxos:    snap.UTXOs,
-		mempool:  snap.Mempool,
+	l := newLedger()
+	for addr, bal := range snap.Balances {
+		l.setUintLocked(keyBalancePrefix+addr, bal)
+	}
+	for addr, outs := range snap.UTXOs {
+		if err := l.putJSONLocked(keyUTXOPrefix+addr, outs); err != nil {
+			return nil, err
+		}
 	}
-	if l.balances == nil {
-		l.balances = make(map[string]uint64)
+	for i, b := range snap.Blocks {
+		if b == nil {
+			return nil, fmt.Errorf("snapshot block %d is nil", i+1)
+		}
+		if err := l.putBlockLocked(i+1, b); err != nil {
+			return nil, err
+		}
 	}
-	if l.utxos == nil {
-		l.utxos = make(map[string][]*UTXO)
+	if _, err := l.updateStateRootLocked(); err != nil {
+		return nil, err
+	}
+	if err := l.store.Write(l.batch); err != nil {
+		return nil, err
 	}
-	if l.mempool == nil {
-		l.mempool = []*Transaction{}
+	l.discardLocked()
+	// pooled transactions are re-admitted against the restored state; forged
+	// ones and any the pool no longer accepts are dropped
+	for _, tx := range snap.Mempool {
+		_ = l.AddToPool(tx)
 	}
 	return l, nil
 }
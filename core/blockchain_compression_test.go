@@ -7,6 +7,7 @@ func TestLedgerCompressionRoundTrip(t *testing.T) {
 	l.Credit("alice", 50)
 	b := NewBlock(nil, "")
 	b.Hash = "gen" // ensure deterministic
+	sealTestBlock(t, l, b)
 	if err := l.AddBlock(b); err != nil {
 		t.Fatalf("add block: %v", err)
 	}
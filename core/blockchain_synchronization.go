@@ -1,23 +1,187 @@
 package core
 
 import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"sync"
+	"time"
+
+	"synnergy/internal/p2p"
+)
+
+const (
+	// DefaultSyncBatchSize is the number of block bodies requested at once.
+	DefaultSyncBatchSize = 64
+	// DefaultSyncWorkers is the number of body requests issued in parallel.
+	DefaultSyncWorkers = 4
+
+	maxSyncHeaders    = 512
+	maxSyncBodies     = 256
+	maxSyncFrameSize  = 32 << 20
+	syncWriteChunk    = 16 << 10
+	syncReadBuffer    = 128 << 10
+	syncProtocol      = 1
+	syncRequestHeader = "headers"
+	syncRequestBodies = "bodies"
+	syncRequestSnap   = "snapshot"
+	syncRequestChunk  = "chunk"
+)
+
+// SyncMode selects how a node with an empty ledger catches up.
+type SyncMode int
+
+const (
+	// SyncModeFull downloads and executes every block.
+	SyncModeFull SyncMode = iota
+	// SyncModeSnapshot restores the state snapshot offered by the peer,
+	// verified against the state root of the snapshot block's header, and
+	// then downloads only the blocks after it. Peers without a snapshot are
+	// synced in full.
+	SyncModeSnapshot
 )
 
+var (
+	// ErrSyncNotRunning is returned when a sync round is requested while the
+	// manager is stopped.
+	ErrSyncNotRunning = errors.New("synchronization not running")
+	// ErrSyncNoPeers is returned when no peer can serve blocks.
+	ErrSyncNoPeers = errors.New("no peers available for synchronization")
+	// ErrSyncBadHeader is returned when a peer serves headers that do not form
+	// a valid chain.
+	ErrSyncBadHeader = errors.New("invalid header chain")
+	// ErrSyncBadBlock is returned when a downloaded block does not match its
+	// header or fails validation.
+	ErrSyncBadBlock = errors.New("invalid block")
+	// ErrSyncNoCommonAncestor is returned when a peer's chain forks from the
+	// local chain deeper than the ledger can reorganise.
+	ErrSyncNoCommonAncestor = errors.New("no common ancestor with peer")
+)
+
+// SyncStatus reports the progress of block synchronization.
+type SyncStatus struct {
+	Running bool `json:"running"`
+	// Syncing is true while blocks are being downloaded.
+	Syncing      bool          `json:"syncing"`
+	Height       int           `json:"height"`
+	TargetHeight int           `json:"target_height"`
+	Peer         string        `json:"peer,omitempty"`
+	BlocksPerSec float64       `json:"blocks_per_sec"`
+	ETA          time.Duration `json:"eta"`
+	LastError    string        `json:"last_error,omitempty"`
+}
+
+// SyncOption configures a SyncManager.
+type SyncOption func(*SyncManager)
+
+// WithSyncTransport sets the transport used to reach peers.
+func WithSyncTransport(t p2p.Transport) SyncOption {
+	return func(s *SyncManager) { s.transport = t }
+}
+
+// WithSyncPeers sets the peer registry blocks are downloaded from. Peers that
+// serve invalid data or fail to respond are marked as failed.
+func WithSyncPeers(m *p2p.Manager) SyncOption {
+	return func(s *SyncManager) { s.peers = m }
+}
+
+// WithSyncConsensus validates downloaded blocks with sc and uses it as the
+// fork choice when a peer's chain diverges from the local one.
+func WithSyncConsensus(sc *SynnergyConsensus) SyncOption {
+	return func(s *SyncManager) { s.consensus = sc }
+}
+
+// WithSyncBatchSize sets how many block bodies are requested at once.
+func WithSyncBatchSize(n int) SyncOption {
+	return func(s *SyncManager) {
+		if n > 0 {
+			s.batchSize = min(n, maxSyncBodies)
+		}
+	}
+}
+
+// WithSyncWorkers sets how many body requests are issued in parallel.
+func WithSyncWorkers(n int) SyncOption {
+	return func(s *SyncManager) {
+		if n > 0 {
+			s.workers = n
+		}
+	}
+}
+
+// WithSyncTimeout bounds each request to a peer.
+func WithSyncTimeout(d time.Duration) SyncOption {
+	return func(s *SyncManager) {
+		if d > 0 {
+			s.timeout = d
+		}
+	}
+}
+
+// WithSyncMode selects full or snapshot based synchronization.
+func WithSyncMode(m SyncMode) SyncOption {
+	return func(s *SyncManager) { s.mode = m }
+}
+
+// WithSyncSnapshot offers src to peers syncing in snapshot mode.
+func WithSyncSnapshot(src SnapshotSource) SyncOption {
+	return func(s *SyncManager) { s.snapshot = src }
+}
+
+// WithSyncProgress registers a callback invoked after each batch of blocks
+// has been applied.
+func WithSyncProgress(fn func(SyncStatus)) SyncOption {
+	return func(s *SyncManager) { s.progress = fn }
+}
+
 // SyncManager coordinates block download and verification to keep a node's
-// ledger in sync with the network. The implementation here tracks state in
-// memory and exposes helpers for the CLI to control the process.
+// ledger in sync with the network. Headers are downloaded first from the peer
+// with the highest chain and checked to form a chain extending the local one;
+// block bodies are then fetched in parallel by height range, validated
+// against their headers and consensus rules, and applied through the ledger.
+// Verified headers are kept between rounds, and blocks already applied are
+// recorded by the ledger, so an interrupted sync resumes where it stopped.
+// The manager also serves its own ledger to peers through Serve.
 type SyncManager struct {
 	mu         sync.RWMutex
 	ledger     *Ledger
 	running    bool
 	lastHeight int
+	status     SyncStatus
+
+	transport p2p.Transport
+	peers     *p2p.Manager
+	consensus *SynnergyConsensus
+	batchSize int
+	workers   int
+	timeout   time.Duration
+	progress  func(SyncStatus)
+	mode      SyncMode
+	snapshot  SnapshotSource
+
+	// syncMu serialises sync rounds. headers holds verified headers that
+	// have not been applied yet.
+	syncMu  sync.Mutex
+	headers []BlockHeader
 }
 
 // NewSyncManager returns a new SyncManager bound to a ledger.
-func NewSyncManager(l *Ledger) *SyncManager {
-	return &SyncManager{ledger: l}
+func NewSyncManager(l *Ledger, opts ...SyncOption) *SyncManager {
+	s := &SyncManager{
+		ledger:    l,
+		batchSize: DefaultSyncBatchSize,
+		workers:   DefaultSyncWorkers,
+		timeout:   10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Start marks the manager as running.
@@ -27,28 +191,636 @@ func (s *SyncManager) Start() {
 	s.running = true
 }
 
-// Stop halts synchronization.
+// Stop halts synchronization. A sync round in progress stops after the
+// current batch.
 func (s *SyncManager) Stop() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.running = false
 }
 
-// Status reports whether synchronization is active and the last synced height.
-func (s *SyncManager) Status() (bool, int) {
+// Status reports whether synchronization is active together with the local
+// and target heights, the download rate and the estimated time remaining.
+func (s *SyncManager) Status() SyncStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.status
+	st.Running = s.running
+	st.Height = s.lastHeight
+	if st.TargetHeight < st.Height {
+		st.TargetHeight = st.Height
+	}
+	return st
+}
+
+func (s *SyncManager) isRunning() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.running, s.lastHeight
+	return s.running
 }
 
-// Once performs a single synchronization round by checking the ledger head.
+// Once performs a single synchronization round. Without a transport and peer
+// registry it only records the ledger head.
 func (s *SyncManager) Once() error {
+	return s.Sync(context.Background())
+}
+
+// Sync downloads and applies blocks from the best peer until the ledger
+// reaches the peer's height, the context is cancelled or the manager is
+// stopped.
+func (s *SyncManager) Sync(ctx context.Context) error {
+	if !s.isRunning() {
+		return ErrSyncNotRunning
+	}
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	s.recordHeight()
+	if s.transport == nil || s.peers == nil {
+		return nil
+	}
+	err := s.sync(ctx)
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if !s.running {
-		return fmt.Errorf("synchronization not running")
+	s.status.Syncing = false
+	s.status.BlocksPerSec = 0
+	s.status.ETA = 0
+	s.status.LastError = ""
+	if err != nil {
+		s.status.LastError = err.Error()
 	}
+	s.mu.Unlock()
+	return err
+}
+
+func (s *SyncManager) recordHeight() int {
 	h, _ := s.ledger.Head()
+	s.mu.Lock()
 	s.lastHeight = h
+	s.mu.Unlock()
+	return h
+}
+
+// syncPeer is a peer together with the head it reported.
+type syncPeer struct {
+	p2p.Peer
+	height int
+}
+
+func (s *SyncManager) sync(ctx context.Context) error {
+	best, err := s.bestPeer(ctx)
+	if err != nil {
+		return err
+	}
+	local, headHash := s.ledger.Head()
+	if best.height <= local {
+		return nil
+	}
+	s.mu.Lock()
+	s.status.Syncing = true
+	s.status.TargetHeight = best.height
+	s.status.Peer = best.ID
+	s.mu.Unlock()
+
+	conn, err := s.dial(ctx, best.Address)
+	if err != nil {
+		s.peers.MarkFailure(best.ID, err.Error())
+		return err
+	}
+	defer conn.Close()
+
+	if s.mode == SyncModeSnapshot && local == 0 && s.ledger.StateRoot() == EmptyStateRoot {
+		if err := s.restoreSnapshot(ctx, conn, best); err != nil {
+			s.peers.MarkFailure(best.ID, err.Error())
+			return err
+		}
+		local, headHash = s.ledger.Head()
+		s.recordHeight()
+	}
+	start := s.resumeHeaders(local, headHash)
+	if start == 0 {
+		start, err = s.commonAncestor(ctx, conn, local, headHash)
+		if err != nil {
+			s.peers.MarkFailure(best.ID, err.Error())
+			return err
+		}
+	}
+	if err := s.downloadHeaders(ctx, conn, start, best.height); err != nil {
+		s.peers.MarkFailure(best.ID, err.Error())
+		return err
+	}
+	return s.downloadBodies(ctx, best)
+}
+
+// restoreSnapshot downloads the peer's snapshot and restores it into the
+// empty ledger. The header chain up to the snapshot height is downloaded and
+// verified first, and the snapshot must name the block at that height and
+// reproduce the state root its header commits to.
+func (s *SyncManager) restoreSnapshot(ctx context.Context, conn *syncConn, best syncPeer) error {
+	resp, err := conn.call(ctx, syncRequest{Type: syncRequestSnap})
+	if err != nil {
+		return err
+	}
+	m := resp.Manifest
+	if m == nil || m.Height <= 0 || m.Height > best.height {
+		return nil
+	}
+	s.headers = nil
+	if err := s.downloadHeaders(ctx, conn, 1, m.Height); err != nil {
+		return err
+	}
+	h := s.headers[len(s.headers)-1]
+	s.headers = nil
+	if h.Hash != m.BlockHash {
+		return fmt.Errorf("%w: snapshot block is not on the peer's chain", ErrSnapshotInvalid)
+	}
+	if h.StateRoot == "" || h.StateRoot != m.StateRoot {
+		return fmt.Errorf("%w: snapshot state root does not match block %d", ErrSnapshotInvalid, m.Height)
+	}
+	snap, err := s.fetchSnapshot(ctx, best, m)
+	if err != nil {
+		return err
+	}
+	_, err = s.ledger.RestoreSnapshot(snap, WithTrustedSnapshotBlock(h.Hash))
+	return err
+}
+
+// fetchSnapshot downloads the chunks listed in m in parallel. Chunks are
+// verified against their hashes when the snapshot is restored.
+func (s *SyncManager) fetchSnapshot(ctx context.Context, best syncPeer, m *SnapshotManifest) (*Snapshot, error) {
+	snap := &Snapshot{manifest: *m, chunks: make(map[string][]byte)}
+	refs := make(chan SnapshotChunk)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+	for i := 0; i < min(s.workers, len(m.Chunks)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := s.dial(ctx, best.Address)
+			if err != nil {
+				fail(err)
+				for range refs {
+				}
+				return
+			}
+			defer conn.Close()
+			for ref := range refs {
+				resp, err := conn.call(ctx, syncRequest{Type: syncRequestChunk, Hash: ref.Hash})
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				snap.chunks[ref.Hash] = resp.Chunk
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, ref := range m.Chunks {
+		select {
+		case refs <- ref:
+		case <-ctx.Done():
+		}
+	}
+	close(refs)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return snap, nil
+}
+
+// bestPeer connects to every connected peer and returns the one announcing
+// the highest chain.
+func (s *SyncManager) bestPeer(ctx context.Context) (syncPeer, error) {
+	var best syncPeer
+	found := false
+	for _, p := range s.peers.ListPeers() {
+		if p.State != p2p.PeerStateConnected || p.Address == "" {
+			continue
+		}
+		conn, err := s.dial(ctx, p.Address)
+		if err != nil {
+			s.peers.MarkFailure(p.ID, err.Error())
+			continue
+		}
+		conn.Close()
+		if !found || conn.hello.Height > best.height {
+			best = syncPeer{Peer: p, height: conn.hello.Height}
+			found = true
+		}
+	}
+	if !found {
+		return syncPeer{}, ErrSyncNoPeers
+	}
+	return best, nil
+}
+
+// resumeHeaders keeps headers verified in an earlier round when they still
+// extend the local head, and returns the height after the last of them, or 0
+// when they must be downloaded again.
+func (s *SyncManager) resumeHeaders(local int, headHash string) int {
+	for len(s.headers) > 0 && s.headers[0].Height <= local {
+		s.headers = s.headers[1:]
+	}
+	if len(s.headers) == 0 || s.headers[0].Height != local+1 || s.headers[0].PrevHash != headHash {
+		s.headers = nil
+		return 0
+	}
+	return s.headers[len(s.headers)-1].Height + 1
+}
+
+// commonAncestor returns the first height to download. When the peer's chain
+// extends the local head this is the next height; otherwise the most recent
+// block both chains share is located so the ledger can reorganise onto the
+// peer's branch.
+func (s *SyncManager) commonAncestor(ctx context.Context, conn *syncConn, local int, headHash string) (int, error) {
+	if local == 0 {
+		return 1, nil
+	}
+	from := max(1, local-s.ledger.maxReorgDepth+1)
+	resp, err := conn.call(ctx, syncRequest{Type: syncRequestHeader, From: from, Count: local - from + 1})
+	if err != nil {
+		return 0, err
+	}
+	for i := len(resp.Headers) - 1; i >= 0; i-- {
+		h := resp.Headers[i]
+		if h.Height == local && h.Hash == headHash {
+			return local + 1, nil
+		}
+		if local, ok := s.ledger.GetHeader(h.Height); ok && local.Hash == h.Hash {
+			return h.Height + 1, nil
+		}
+	}
+	if from == 1 {
+		return 1, nil
+	}
+	return 0, ErrSyncNoCommonAncestor
+}
+
+// downloadHeaders fetches headers from start up to target and checks that
+// each links to its predecessor.
+func (s *SyncManager) downloadHeaders(ctx context.Context, conn *syncConn, start, target int) error {
+	prev := ""
+	if len(s.headers) > 0 {
+		prev = s.headers[len(s.headers)-1].Hash
+	} else if h, ok := s.ledger.GetHeader(start - 1); ok {
+		prev = h.Hash
+	}
+	for from := start; from <= target; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		count := min(maxSyncHeaders, target-from+1)
+		resp, err := conn.call(ctx, syncRequest{Type: syncRequestHeader, From: from, Count: count})
+		if err != nil {
+			return err
+		}
+		if len(resp.Headers) == 0 {
+			return fmt.Errorf("%w: no headers from height %d", ErrSyncBadHeader, from)
+		}
+		for _, h := range resp.Headers {
+			if h.Height != from {
+				return fmt.Errorf("%w: expected height %d got %d", ErrSyncBadHeader, from, h.Height)
+			}
+			if from > 1 && h.PrevHash != prev {
+				return fmt.Errorf("%w: block %d does not link to its parent", ErrSyncBadHeader, from)
+			}
+			if err := h.Verify(); err != nil {
+				return fmt.Errorf("%w: block %d: %v", ErrSyncBadHeader, from, err)
+			}
+			s.headers = append(s.headers, h)
+			prev = h.Hash
+			from++
+		}
+	}
+	return nil
+}
+
+// downloadBodies fetches the bodies for the verified headers in windows of
+// parallel range requests and applies each window in order.
+func (s *SyncManager) downloadBodies(ctx context.Context, best syncPeer) error {
+	started := time.Now()
+	applied := 0
+	window := s.batchSize * s.workers
+	for len(s.headers) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !s.isRunning() {
+			return ErrSyncNotRunning
+		}
+		n := min(window, len(s.headers))
+		blocks, err := s.fetchWindow(ctx, best, s.headers[:n])
+		if err != nil {
+			return err
+		}
+		var fc ForkChoice
+		if s.consensus != nil {
+			fc = s.consensus
+		}
+		for i, b := range blocks {
+			if _, err := s.ledger.ImportBlock(b, fc); err != nil {
+				s.headers = s.headers[i:]
+				return fmt.Errorf("apply block %d: %w", s.headers[0].Height, err)
+			}
+		}
+		s.headers = s.headers[n:]
+		applied += n
+		height := s.recordHeight()
+
+		rate := float64(applied) / max(time.Since(started).Seconds(), 1e-9)
+		s.mu.Lock()
+		s.status.BlocksPerSec = rate
+		s.status.ETA = time.Duration(float64(max(0, s.status.TargetHeight-height)) / rate * float64(time.Second))
+		s.mu.Unlock()
+		if s.progress != nil {
+			s.progress(s.Status())
+		}
+	}
+	return nil
+}
+
+// fetchWindow downloads the bodies for headers using up to s.workers
+// connections and validates each block.
+func (s *SyncManager) fetchWindow(ctx context.Context, best syncPeer, headers []BlockHeader) ([]*Block, error) {
+	blocks := make([]*Block, len(headers))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	for off := 0; off < len(headers); off += s.batchSize {
+		end := min(off+s.batchSize, len(headers))
+		wg.Add(1)
+		go func(off, end int) {
+			defer wg.Done()
+			conn, err := s.dial(ctx, best.Address)
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer conn.Close()
+			resp, err := conn.call(ctx, syncRequest{Type: syncRequestBodies, From: headers[off].Height, Count: end - off})
+			if err != nil {
+				fail(err)
+				return
+			}
+			if len(resp.Blocks) != end-off {
+				fail(fmt.Errorf("%w: expected %d blocks from height %d got %d", ErrSyncBadBlock, end-off, headers[off].Height, len(resp.Blocks)))
+				return
+			}
+			for i, b := range resp.Blocks {
+				if err := s.checkBlock(b, headers[off+i]); err != nil {
+					fail(err)
+					return
+				}
+				blocks[off+i] = b
+			}
+		}(off, end)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		if !errors.Is(firstErr, context.Canceled) {
+			s.peers.MarkFailure(best.ID, firstErr.Error())
+		}
+		return nil, firstErr
+	}
+	return blocks, nil
+}
+
+// checkBlock verifies a downloaded block against its header, Block.Validate
+// and, when configured, the consensus rules.
+func (s *SyncManager) checkBlock(b *Block, h BlockHeader) error {
+	if b == nil || b.Hash != h.Hash || b.PrevHash != h.PrevHash {
+		return fmt.Errorf("%w: block %d does not match its header", ErrSyncBadBlock, h.Height)
+	}
+	if err := b.Validate(); err != nil {
+		return fmt.Errorf("%w: block %d: %v", ErrSyncBadBlock, h.Height, err)
+	}
+	if b.HeaderHash(b.Nonce) != h.hash(h.Nonce) {
+		return fmt.Errorf("%w: block %d does not match its header", ErrSyncBadBlock, h.Height)
+	}
+	if s.consensus == nil {
+		return nil
+	}
+	if !s.consensus.ValidateBlock(b) {
+		return fmt.Errorf("%w: block %d rejected by consensus", ErrSyncBadBlock, h.Height)
+	}
+	for _, sb := range b.SubBlocks {
+		if !s.consensus.ValidateSubBlock(sb, uint64(h.Height)) {
+			return fmt.Errorf("%w: block %d has an invalid sub-block", ErrSyncBadBlock, h.Height)
+		}
+	}
 	return nil
 }
+
+// Serve answers sync requests from peers on ln until ctx is cancelled. Use a
+// listener from a p2p.Transport so peers are authenticated.
+func (s *SyncManager) Serve(ctx context.Context, ln net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// accept deadlines and failed handshakes only affect one peer
+			continue
+		}
+		go s.serveConn(ctx, c)
+	}
+}
+
+func (s *SyncManager) serveConn(ctx context.Context, c net.Conn) {
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+	// The server speaks first. Besides announcing the head, this keeps the
+	// first request from racing the end of the transport handshake.
+	height, hash := s.ledger.Head()
+	if err := writeSyncFrame(c, syncResponse{Protocol: syncProtocol, Height: height, Hash: hash}); err != nil {
+		return
+	}
+	br := bufio.NewReaderSize(c, syncReadBuffer)
+	for {
+		var req syncRequest
+		if err := readSyncFrame(br, &req); err != nil {
+			return
+		}
+		if err := writeSyncFrame(c, s.handle(req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *SyncManager) handle(req syncRequest) syncResponse {
+	height, hash := s.ledger.Head()
+	resp := syncResponse{Height: height, Hash: hash}
+	from := max(1, req.From)
+	switch req.Type {
+	case syncRequestHeader:
+		for h := from; h <= height && h < from+min(req.Count, maxSyncHeaders); h++ {
+			header, ok := s.ledger.GetHeader(h)
+			if !ok {
+				break
+			}
+			resp.Headers = append(resp.Headers, header)
+		}
+	case syncRequestSnap:
+		if s.snapshot != nil {
+			m, err := s.snapshot.Manifest()
+			if err != nil {
+				resp.Error = err.Error()
+				break
+			}
+			resp.Manifest = m
+		}
+	case syncRequestChunk:
+		if s.snapshot == nil {
+			resp.Error = "no snapshot available"
+			break
+		}
+		c, err := s.snapshot.Chunk(req.Hash)
+		if err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		resp.Chunk = c
+	case syncRequestBodies:
+		for h := from; h <= height && h < from+min(req.Count, maxSyncBodies); h++ {
+			b, ok := s.ledger.GetBlock(h)
+			if !ok {
+				break
+			}
+			resp.Blocks = append(resp.Blocks, b)
+		}
+	default:
+		resp.Error = fmt.Sprintf("unknown request %q", req.Type)
+	}
+	return resp
+}
+
+type syncRequest struct {
+	Type  string `json:"type"`
+	From  int    `json:"from,omitempty"`
+	Count int    `json:"count,omitempty"`
+	Hash  string `json:"hash,omitempty"`
+}
+
+type syncResponse struct {
+	Protocol int               `json:"protocol,omitempty"`
+	Height   int               `json:"height"`
+	Hash     string            `json:"hash"`
+	Headers  []BlockHeader     `json:"headers,omitempty"`
+	Blocks   []*Block          `json:"blocks,omitempty"`
+	Manifest *SnapshotManifest `json:"manifest,omitempty"`
+	Chunk    []byte            `json:"chunk,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// syncConn is a client connection to a peer serving sync requests.
+type syncConn struct {
+	net.Conn
+	br      *bufio.Reader
+	timeout time.Duration
+	hello   syncResponse
+}
+
+func (s *SyncManager) dial(ctx context.Context, addr string) (*syncConn, error) {
+	dctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	c, err := s.transport.Dial(dctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &syncConn{Conn: c, br: bufio.NewReaderSize(c, syncReadBuffer), timeout: s.timeout}
+	c.SetDeadline(time.Now().Add(s.timeout))
+	if err := readSyncFrame(conn.br, &conn.hello); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if conn.hello.Protocol != syncProtocol {
+		c.Close()
+		return nil, fmt.Errorf("unsupported sync protocol %d", conn.hello.Protocol)
+	}
+	return conn, nil
+}
+
+func (c *syncConn) call(ctx context.Context, req syncRequest) (syncResponse, error) {
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+	c.SetDeadline(time.Now().Add(c.timeout))
+	var resp syncResponse
+	if err := writeSyncFrame(c.Conn, req); err != nil {
+		return resp, errors.Join(ctx.Err(), err)
+	}
+	if err := readSyncFrame(c.br, &resp); err != nil {
+		return resp, errors.Join(ctx.Err(), err)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// writeSyncFrame writes v as a length prefixed JSON frame. The payload is
+// written in small chunks because encrypted transports frame each write.
+func writeSyncFrame(w io.Writer, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	for len(payload) > 0 {
+		n := min(len(payload), syncWriteChunk)
+		if _, err := w.Write(payload[:n]); err != nil {
+			return err
+		}
+		payload = payload[n:]
+	}
+	return nil
+}
+
+func readSyncFrame(r io.Reader, v interface{}) error {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n > maxSyncFrameSize {
+		return fmt.Errorf("sync frame of %d bytes exceeds limit", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
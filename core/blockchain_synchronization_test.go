@@ -1,6 +1,14 @@
 package core
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"synnergy/internal/p2p"
+)
 
 func TestSyncManagerLifecycle(t *testing.T) {
 	l := NewLedger()
@@ -12,28 +20,241 @@ func TestSyncManagerLifecycle(t *testing.T) {
 	}
 
 	sm.Start()
-	running, _ := sm.Status()
-	if !running {
+	if !sm.Status().Running {
 		t.Fatalf("expected running")
 	}
 
-	if err := l.AddBlock(&Block{Hash: "b1"}); err != nil {
+	if err := l.AddBlock(sealTestBlock(t, l, &Block{Hash: "b1"})); err != nil {
 		t.Fatalf("add block: %v", err)
 	}
 	if err := sm.Once(); err != nil {
 		t.Fatalf("once: %v", err)
 	}
-	_, h := sm.Status()
-	if h != 1 {
+	if h := sm.Status().Height; h != 1 {
 		t.Fatalf("expected height 1 got %d", h)
 	}
 
 	sm.Stop()
-	running, _ = sm.Status()
-	if running {
+	if sm.Status().Running {
 		t.Fatalf("expected stopped")
 	}
 	if err := sm.Once(); err == nil {
 		t.Fatalf("expected error when stopped")
 	}
 }
+
+// syncTestChain is a chain of n blocks, each moving funds from alice.
+type syncTestChain struct {
+	validator *Wallet
+	alice     *Wallet
+	blocks    []*Block
+}
+
+func newSyncTestChain(t *testing.T, n int) *syncTestChain {
+	c := &syncTestChain{validator: registerTestValidator(t), alice: testWallet(t, "alice")}
+	l := NewLedger()
+	c.fund(l)
+	c.blocks = addSealedTestBlocks(t, l, c.validator, c.alice, n)
+	return c
+}
+
+func (c *syncTestChain) ledger(t *testing.T, blocks []*Block) *Ledger {
+	t.Helper()
+	l := NewLedger()
+	c.fund(l)
+	for _, b := range blocks {
+		if err := l.AddBlock(b); err != nil {
+			t.Fatalf("add block: %v", err)
+		}
+	}
+	return l
+}
+
+func (c *syncTestChain) fund(l *Ledger) { l.Credit(c.alice.Address, 1000) }
+
+// serveSync serves l over a Noise transport on the loopback interface and
+// returns a peer registry pointing at it.
+func serveSync(t *testing.T, l *Ledger) *p2p.Manager {
+	t.Helper()
+	tr, err := p2p.NewNoiseTransport()
+	if err != nil {
+		t.Fatalf("transport: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ln, err := tr.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewSyncManager(l).Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	peers := p2p.NewManager(nil)
+	peers.AddPeer(p2p.Peer{ID: "source", Address: ln.Addr().String()})
+	return peers
+}
+
+func newSyncClient(t *testing.T, l *Ledger, peers *p2p.Manager, opts ...SyncOption) *SyncManager {
+	t.Helper()
+	tr, err := p2p.NewNoiseTransport()
+	if err != nil {
+		t.Fatalf("transport: %v", err)
+	}
+	sm := NewSyncManager(l, append([]SyncOption{WithSyncTransport(tr), WithSyncPeers(peers), WithSyncTimeout(5 * time.Second)}, opts...)...)
+	sm.Start()
+	return sm
+}
+
+func TestSyncManagerLoopback(t *testing.T) {
+	c := newSyncTestChain(t, 20)
+	source := c.ledger(t, c.blocks)
+	peers := serveSync(t, source)
+
+	sc := NewSynnergyConsensus()
+	sc.RegisterValidatorPublicKey(c.validator.Address, &c.validator.PublicKey)
+	dest := c.ledger(t, nil)
+	sm := newSyncClient(t, dest, peers, WithSyncConsensus(sc), WithSyncBatchSize(3), WithSyncWorkers(2))
+	if err := sm.Once(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if h, head := dest.Head(); h != 20 || head != c.blocks[19].Hash {
+		t.Fatalf("unexpected head %d %s", h, head)
+	}
+	if dest.StateRoot() != source.StateRoot() {
+		t.Fatalf("synced state differs from the source")
+	}
+	st := sm.Status()
+	if !st.Running || st.Syncing || st.Height != 20 || st.TargetHeight != 20 || st.Peer != "source" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	// nothing left to do
+	if err := sm.Once(); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+}
+
+func TestSyncManagerRejectsInvalidBlocks(t *testing.T) {
+	c := newSyncTestChain(t, 4)
+	peers := serveSync(t, c.ledger(t, c.blocks))
+	// the consensus engine does not know the block producer
+	dest := c.ledger(t, nil)
+	sm := newSyncClient(t, dest, peers, WithSyncConsensus(NewSynnergyConsensus()))
+	if err := sm.Once(); !errors.Is(err, ErrSyncBadBlock) {
+		t.Fatalf("expected ErrSyncBadBlock got %v", err)
+	}
+	if h, _ := dest.Head(); h != 0 {
+		t.Fatalf("invalid blocks must not be applied, height %d", h)
+	}
+	if p, _ := peers.GetPeer("source"); p.FailureCount == 0 {
+		t.Fatalf("expected the peer to be marked as failed")
+	}
+	if st := sm.Status(); st.LastError == "" {
+		t.Fatalf("expected the error in the status")
+	}
+}
+
+func TestSyncManagerResumesAfterInterruption(t *testing.T) {
+	c := newSyncTestChain(t, 20)
+	source := c.ledger(t, c.blocks)
+	peers := serveSync(t, source)
+
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	dest, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	c.fund(dest)
+	ctx, cancel := context.WithCancel(context.Background())
+	var seen SyncStatus
+	sm := newSyncClient(t, dest, peers, WithSyncBatchSize(2), WithSyncWorkers(2), WithSyncProgress(func(st SyncStatus) {
+		if st.Height >= 6 && seen.Height == 0 {
+			seen = st
+			cancel()
+		}
+	}))
+	if err := sm.Sync(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation got %v", err)
+	}
+	if seen.Height != 8 || seen.TargetHeight != 20 || !seen.Syncing || seen.BlocksPerSec <= 0 || seen.ETA <= 0 {
+		t.Fatalf("unexpected progress %+v", seen)
+	}
+	dest.Close()
+
+	// a restarted node picks up from the blocks it already applied
+	dest, err = OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if h, _ := dest.Head(); h != 8 {
+		t.Fatalf("expected 8 blocks after restart got %d", h)
+	}
+	sm = newSyncClient(t, dest, peers)
+	if err := sm.Once(); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if dest.StateRoot() != source.StateRoot() {
+		t.Fatalf("resumed state differs from the source")
+	}
+}
+
+func TestSyncManagerFollowsLongerFork(t *testing.T) {
+	c := newSyncTestChain(t, 6)
+	peers := serveSync(t, c.ledger(t, c.blocks))
+	// the local chain shares the first two blocks and then diverges
+	fork := sealTestBlock(t, c.ledger(t, c.blocks[:2]), reorgTestBlock(t, c.blocks[1], c.validator, signedTestTx(t, c.alice, "fork", 5, 0, 2)))
+	dest := c.ledger(t, append(c.blocks[:2:2], fork))
+	sm := newSyncClient(t, dest, peers)
+	if err := sm.Once(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if h, head := dest.Head(); h != 6 || head != c.blocks[5].Hash {
+		t.Fatalf("expected to follow the peer's chain, got %d %s", h, head)
+	}
+	if dest.GetBalance("fork") != 0 {
+		t.Fatalf("forked block still applied")
+	}
+}
+
+func TestSyncManagerSnapshotMode(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	source := NewLedger()
+	source.Credit(alice.Address, 1000)
+	addSealedTestBlocks(t, source, validator, alice, 6)
+	snap, err := CreateSnapshot(source, 0, testWallet(t, "producer"), WithSnapshotChunkSize(64))
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	addSealedTestBlocks(t, source, validator, alice, 3)
+
+	tr, err := p2p.NewNoiseTransport()
+	if err != nil {
+		t.Fatalf("transport: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, err := tr.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go NewSyncManager(source, WithSyncSnapshot(snap)).Serve(ctx, ln)
+	peers := p2p.NewManager(nil)
+	peers.AddPeer(p2p.Peer{ID: "source", Address: ln.Addr().String()})
+
+	// a fresh node holds nothing, not even the funding of the first block
+	dest := NewLedger()
+	sm := newSyncClient(t, dest, peers, WithSyncMode(SyncModeSnapshot))
+	if err := sm.Once(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if h, _ := dest.Head(); h != 9 || dest.StateRoot() != source.StateRoot() {
+		t.Fatalf("snapshot sync did not reach the source state, height %d", h)
+	}
+	if _, ok := dest.GetBlock(3); ok {
+		t.Fatalf("blocks below the snapshot must not be downloaded")
+	}
+}
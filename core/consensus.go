@@ -56,11 +56,24 @@ type SynnergyConsensus struct {
 	PoHAvailable bool
 	PoWRewards   bool
 
+	// SlotLeaders is the expected number of validators allowed to propose
+	// in each slot. A validator may propose when its VRF priority is below
+	// SlotLeaders over the total stake, which happens with a probability
+	// that grows with its share of the stake. No validator may propose in a
+	// slot with probability e^-SlotLeaders.
+	SlotLeaders float64
+
 	// RegNode performs regulatory checks on transactions during
 	// consensus validation. When nil, regulatory checks are bypassed.
 	RegNode *RegulatoryNode
 
 	validatorPubKeys map[string][]byte
+	// randomness returns the epoch randomness seed of a height. When set,
+	// sub-blocks must carry their validator's VRF proof for the slot.
+	randomness func(height uint64) ([]byte, bool)
+	// stakes returns the validator set of a height. When set along with
+	// randomness, only validators below the slot threshold may propose.
+	stakes func(height uint64) ValidatorSet
 }
 
 var defaultConsensusWeights = ConsensusWeights{PoW: 0.40, PoS: 0.30, PoH: 0.30}
@@ -79,6 +92,7 @@ func NewSynnergyConsensus() *SynnergyConsensus {
 		PoSAvailable:     true,
 		PoHAvailable:     true,
 		PoWRewards:       true,
+		SlotLeaders:      20,
 		validatorPubKeys: make(map[string][]byte),
 	}
 }
@@ -113,6 +127,37 @@ func (sc *SynnergyConsensus) RegisterValidatorPublicKey(addr string, pub *ecdsa.
 	sc.mu.Unlock()
 }
 
+// SetRandomness sets the source of the epoch randomness seed of each height,
+// usually Ledger.RandomnessAt. Once set, ValidateSubBlock requires the
+// validator's VRF proof for the sub-block's slot and rejects sub-blocks whose
+// seed the source cannot tell yet.
+func (sc *SynnergyConsensus) SetRandomness(seed func(height uint64) ([]byte, bool)) {
+	sc.mu.Lock()
+	sc.randomness = seed
+	sc.mu.Unlock()
+}
+
+// SetValidatorSets sets the source of the validator set of each height,
+// usually the node's validator manager. Together with SetRandomness it makes
+// ValidateSubBlock enforce the stake-weighted slot threshold.
+func (sc *SynnergyConsensus) SetValidatorSets(stakes func(height uint64) ValidatorSet) {
+	sc.mu.Lock()
+	sc.stakes = stakes
+	sc.mu.Unlock()
+}
+
+// SlotThreshold returns the VRF priority below which a validator may propose
+// in a slot of a validator set holding total stake.
+func (sc *SynnergyConsensus) SlotThreshold(total uint64) float64 {
+	sc.mu.RLock()
+	leaders := sc.SlotLeaders
+	sc.mu.RUnlock()
+	if total == 0 || leaders <= 0 {
+		return 0
+	}
+	return leaders / float64(total)
+}
+
 // Threshold computes the switching threshold based on network demand (D) and
 // stake concentration (S).
 func (sc *SynnergyConsensus) Threshold(D, S float64) float64 {
@@ -230,10 +275,9 @@ func (sc *SynnergyConsensus) SetPoWRewards(enabled bool) {
 	ilog.Info("set_pow_rewards", "requested", enabled, "effective", effective)
 }
 
-// SelectValidator deterministically selects a validator using a VRF-style
-// hash of the provided seed and validator address. The validator with the
-// smallest weighted hash value wins, ensuring all nodes arrive at the same
-// result.
+// SelectValidator deterministically selects a validator weighted by stake
+// from a SHA-256 hash of the provided seed. Anyone knowing the seed can
+// predict the result; leader election uses SelectValidatorVRF.
 func (sc *SynnergyConsensus) SelectValidator(seed string, stakes map[string]uint64) string {
 	if len(stakes) == 0 {
 		ilog.Info("select_validator", "result", "")
@@ -275,19 +319,65 @@ func (sc *SynnergyConsensus) SelectValidator(seed string, stakes map[string]uint
 	return chosen
 }
 
-// ValidateSubBlock performs simple PoS and PoH validation on a sub-block.
-// It verifies that the sub-block is non-nil, contains transactions and has a
-// valid signature from its declared validator.
-func (sc *SynnergyConsensus) ValidateSubBlock(sb *SubBlock) bool {
+// SelectValidatorVRF elects the slot leader from the VRF outputs validators
+// proved for the slot: the validator with the lowest VRFPriority for its
+// stake wins, which picks each validator with probability proportional to its
+// stake. Validators without an output or stake are not candidates. Nobody can
+// tell the leader before the outputs are revealed.
+func (sc *SynnergyConsensus) SelectValidatorVRF(outputs map[string][]byte, stakes map[string]uint64) string {
+	var (
+		leader string
+		best   = math.Inf(1)
+	)
+	for addr, out := range outputs {
+		p := VRFPriority(out, stakes[addr])
+		if math.IsInf(p, 1) {
+			continue
+		}
+		if p < best || (p == best && addr < leader) {
+			leader, best = addr, p
+		}
+	}
+	ilog.Info("select_validator_vrf", "result", leader, "candidates", len(outputs))
+	return leader
+}
+
+// verifySlotProof checks the VRF proof of sb against its validator's key and
+// the randomness of its height and returns the VRF output.
+func verifySlotProof(sb *SubBlock, seed func(uint64) ([]byte, bool)) ([]byte, error) {
+	r, ok := seed(sb.Height)
+	if !ok {
+		return nil, fmt.Errorf("no randomness for height %d", sb.Height)
+	}
+	pub, err := decodePublicKey(sb.ValidatorKey)
+	if err != nil {
+		return nil, err
+	}
+	return VRFVerify(pub, SlotInput(r, sb.Height), sb.VRFProof)
+}
+
+// ValidateSubBlock performs simple PoS and PoH validation on a sub-block
+// proposed for the block at height. It verifies that the sub-block is
+// non-nil, contains transactions, has a valid signature from its declared
+// validator and, if it declares a height, was produced for this one. Once
+// randomness is set it also verifies the validator's VRF proof for the slot,
+// and once validator sets are set that the proof's priority is below the slot
+// threshold for the validator's stake.
+func (sc *SynnergyConsensus) ValidateSubBlock(sb *SubBlock, height uint64) bool {
 	if sb == nil {
 		return false
 	}
 	if err := sb.Validate(); err != nil {
 		return false
 	}
+	if sb.Height != 0 && sb.Height != height {
+		ilog.Info("subblock_reject", "validator", sb.Validator, "height", sb.Height, "block", height)
+		return false
+	}
 	if !sb.System {
 		sc.mu.RLock()
 		expected := sc.validatorPubKeys[sb.Validator]
+		seed, stakes := sc.randomness, sc.stakes
 		sc.mu.RUnlock()
 		if len(expected) == 0 {
 			return false
@@ -295,6 +385,21 @@ func (sc *SynnergyConsensus) ValidateSubBlock(sb *SubBlock) bool {
 		if !bytes.Equal(expected, sb.ValidatorKey) {
 			return false
 		}
+		if seed != nil {
+			out, err := verifySlotProof(sb, seed)
+			if err != nil {
+				ilog.Info("vrf_reject", "validator", sb.Validator, "height", sb.Height, "err", err)
+				return false
+			}
+			if stakes != nil {
+				set := stakes(sb.Height)
+				priority, threshold := VRFPriority(out, set[sb.Validator]), sc.SlotThreshold(set.TotalStake())
+				if priority >= threshold {
+					ilog.Info("vrf_reject", "validator", sb.Validator, "height", sb.Height, "priority", priority, "threshold", threshold)
+					return false
+				}
+			}
+		}
 	}
 	regNode := sc.getRegNode()
 	if regNode == nil {
@@ -348,6 +453,9 @@ func (sc *SynnergyConsensus) MineBlock(b *Block, difficulty uint8) {
 // FinalizeBlock applies a simple BFT-style vote on the block. If at least two
 // thirds of votes are affirmative the block is marked finalized and validators
 // contributing sub-blocks receive a stake reward via the provided manager.
+//
+// Deprecated: votes are unsigned, so any caller can finalize a block. Use
+// FinalizeBlockWithCertificate.
 func (sc *SynnergyConsensus) FinalizeBlock(b *Block, votes map[string]bool, vm *ValidatorManager, reward uint64) bool {
 	if b == nil || vm == nil {
 		return false
@@ -396,6 +504,37 @@ func (sc *SynnergyConsensus) FinalizeBlock(b *Block, votes map[string]bool, vm *
 	return true
 }
 
+// FinalizeBlockWithCertificate marks b finalized once cert proves that
+// validators holding two thirds of the stake eligible at its height signed
+// it, and rewards
+// the validators contributing its sub-blocks via the provided manager.
+func (sc *SynnergyConsensus) FinalizeBlockWithCertificate(b *Block, cert *FinalityCertificate, vm *ValidatorManager, reward uint64) error {
+	if b == nil {
+		return ErrNilBlock
+	}
+	if vm == nil {
+		return fmt.Errorf("validator manager required")
+	}
+	if cert == nil || cert.BlockHash != b.Hash {
+		return fmt.Errorf("%w: certificate does not finalize block %s", ErrInvalidCertificate, b.Hash)
+	}
+	if err := cert.Verify(vm.SetAt(cert.Height)); err != nil {
+		ilog.Info("finalize_block", "hash", b.Hash, "result", "invalid_certificate", "error", err)
+		return err
+	}
+	b.Finalized = true
+	if reward > 0 {
+		for _, sb := range b.SubBlocks {
+			if sb == nil {
+				continue
+			}
+			vm.Reward(context.Background(), sb.Validator, reward)
+		}
+	}
+	ilog.Info("finalize_block", "hash", b.Hash, "height", cert.Height, "round", cert.Round, "votes", len(cert.Votes))
+	return nil
+}
+
 // ChooseChain selects the longest chain from the candidates. This placeholder
 // fork-choice rule enables nodes to converge on a canonical history.
 func (sc *SynnergyConsensus) ChooseChain(chains [][]*Block) []*Block {
@@ -776,8 +915,7 @@ func (sc *SynnergyConsensus) applyAvailabilityLocked(weights ConsensusWeights) C
 }
 
 func (sc *SynnergyConsensus) resilientWeightsLocked(weights ConsensusWeights) ConsensusWeights {
-	weights = normalizeWeights(weights)
-	weights = sc.applyAvailabilityLocked(weights)
+	weights = normalizeWeights(sc.applyAvailabilityLocked(weights))
 
 	total := weights.PoW + weights.PoS + weights.PoH
 	if total > 0 {
@@ -8,13 +8,18 @@ import (
 
 // TestConsensusServiceStartStop verifies the start-stop lifecycle of the consensus service.
 func TestConsensusServiceStartStop(t *testing.T) {
+	alice := testWallet(t, "alice")
 	ledger := NewLedger()
 	node := NewNode("n1", "addr", ledger)
-	if err := node.SetStake("n1", 1); err != nil {
+	w := registerTestValidator(t)
+	if err := node.RegisterValidatorWallet(w); err != nil {
+		t.Fatalf("register wallet: %v", err)
+	}
+	if err := node.SetStake(w.Address, 1); err != nil {
 		t.Fatalf("set stake: %v", err)
 	}
-	ledger.Mint("alice", 100)
-	tx := NewTransaction("alice", "bob", 10, 1, 0)
+	ledger.Mint(alice.Address, 100)
+	tx := signedTestTx(t, alice, "bob", 10, 1, 0)
 	if err := node.AddTransaction(tx); err != nil {
 		t.Fatalf("add tx: %v", err)
 	}
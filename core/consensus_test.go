@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sync"
 	"testing"
 	"time"
 )
@@ -219,7 +220,32 @@ func TestSetPoWRewardsFallback(t *testing.T) {
 	}
 }
 
-func testConsensusBlock(prev *Block, timestamp int64, finalized bool, validator string, txCount int) *Block {
+var (
+	consensusTestWalletsMu sync.Mutex
+	consensusTestWallets   = make(map[string]*Wallet)
+)
+
+// consensusTestValidator maps a readable label to a registered signing wallet
+// so test chains carry valid sub-block signatures.
+func consensusTestValidator(label string) string {
+	consensusTestWalletsMu.Lock()
+	defer consensusTestWalletsMu.Unlock()
+	w := consensusTestWallets[label]
+	if w == nil {
+		var err error
+		if w, err = NewWallet(); err != nil {
+			panic(err)
+		}
+		if err := RegisterValidatorWallet(w); err != nil {
+			panic(err)
+		}
+		consensusTestWallets[label] = w
+	}
+	return w.Address
+}
+
+func testConsensusBlock(prev *Block, timestamp int64, finalized bool, label string, txCount int) *Block {
+	validator := consensusTestValidator(label)
 	txs := make([]*Transaction, txCount)
 	for i := range txs {
 		txs[i] = &Transaction{
@@ -233,9 +259,10 @@ func testConsensusBlock(prev *Block, timestamp int64, finalized bool, validator
 	if timestamp > 0 {
 		sb.Timestamp = timestamp - 1
 		sb.PohHash = sb.Hash()
-		sb.Signature = signSubBlock(sb.Validator, sb.PohHash)
+		_ = SignSubBlock(sb)
 	}
 	blk := NewBlock([]*SubBlock{sb}, "")
+	blk.StateRoot = EmptyStateRoot
 	if prev != nil {
 		blk.PrevHash = prev.Hash
 	}
@@ -254,11 +281,11 @@ func TestValidateSubBlock(t *testing.T) {
 	w := registerTestValidator(t)
 	sb := NewSubBlock([]*Transaction{tx}, w.Address)
 	sc.RegisterValidatorPublicKey(w.Address, &w.PublicKey)
-	if !sc.ValidateSubBlock(sb) {
+	if !sc.ValidateSubBlock(sb, 1) {
 		t.Fatalf("expected valid sub-block")
 	}
 	sb.Signature = []byte("bad")
-	if sc.ValidateSubBlock(sb) {
+	if sc.ValidateSubBlock(sb, 1) {
 		t.Fatalf("expected invalid sub-block")
 	}
 }
@@ -299,7 +326,7 @@ func TestValidateSubBlockRegulatory(t *testing.T) {
 		t.Fatalf("sign: %v", err)
 	}
 	sb := NewSubBlock([]*Transaction{tx}, validator.Address)
-	if !sc.ValidateSubBlock(sb) {
+	if !sc.ValidateSubBlock(sb, 1) {
 		t.Fatalf("expected valid sub-block")
 	}
 
@@ -308,7 +335,7 @@ func TestValidateSubBlockRegulatory(t *testing.T) {
 		t.Fatalf("sign2: %v", err)
 	}
 	sb2 := NewSubBlock([]*Transaction{tx2}, validator.Address)
-	if sc.ValidateSubBlock(sb2) {
+	if sc.ValidateSubBlock(sb2, 1) {
 		t.Fatalf("expected regulatory rejection")
 	}
 }
@@ -324,11 +351,11 @@ func TestValidateSubBlockWithoutRegNode(t *testing.T) {
 
 	tx := NewTransaction("alice", "bob", 20, 0, 0)
 	sb := NewSubBlock([]*Transaction{tx}, validator.Address)
-	if sc.ValidateSubBlock(sb) {
+	if sc.ValidateSubBlock(sb, 1) {
 		t.Fatalf("expected rejection with regulatory node")
 	}
 	sc.SetRegulatoryNode(nil)
-	if !sc.ValidateSubBlock(sb) {
+	if !sc.ValidateSubBlock(sb, 1) {
 		t.Fatalf("expected approval without regulatory node")
 	}
 }
@@ -2,29 +2,73 @@ package core
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
 
 	ierr "synnergy/internal/errors"
 	"synnergy/internal/telemetry"
 )
 
-// ValidatorManager tracks validator stakes and slashing state.
+// ValidatorManager tracks validator stakes and slashing state. With an epoch
+// length, stake changes take effect only at epoch boundaries, and the set
+// eligible at every height is kept so votes and evidence for past heights can
+// be checked against it.
 type ValidatorManager struct {
 	mu       sync.RWMutex
 	stakes   map[string]uint64
 	slashed  map[string]bool
 	evidence map[string]string
+	applied  map[string]bool
+	bonded   map[string]bool
 	minStake uint64
+	epoch    uint64
+	height   uint64
+	pending  []validatorChange
+	history  []heightSet
+}
+
+type changeKind int
+
+const (
+	changeStake changeKind = iota
+	changeRemove
+	changeBond
+	changeReward
+)
+
+// validatorChange is a stake change queued until the next epoch boundary.
+type validatorChange struct {
+	kind  changeKind
+	addr  string
+	stake uint64
+}
+
+// ValidatorManagerOption configures optional behaviour of a ValidatorManager.
+type ValidatorManagerOption func(*ValidatorManager)
+
+// WithEpochLength makes stake changes take effect at epoch boundaries. Once
+// the chain has started, Add, Remove, Reward and SyncBonded queue their
+// changes until AdvanceTo reaches the last block of an epoch. Slashing and
+// rehabilitation still apply at once.
+func WithEpochLength(blocks uint64) ValidatorManagerOption {
+	return func(vm *ValidatorManager) { vm.epoch = blocks }
 }
 
 // NewValidatorManager creates a manager requiring the provided minimum stake.
-func NewValidatorManager(minStake uint64) *ValidatorManager {
-	return &ValidatorManager{
+func NewValidatorManager(minStake uint64, opts ...ValidatorManagerOption) *ValidatorManager {
+	vm := &ValidatorManager{
 		stakes:   make(map[string]uint64),
 		slashed:  make(map[string]bool),
 		evidence: make(map[string]string),
+		applied:  make(map[string]bool),
+		bonded:   make(map[string]bool),
 		minStake: minStake,
 	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	return vm
 }
 
 // Add registers a validator with a given stake.
@@ -37,8 +81,7 @@ func (vm *ValidatorManager) Add(ctx context.Context, addr string, stake uint64)
 	if stake < vm.minStake {
 		return ierr.New(ierr.Invalid, "stake below minimum")
 	}
-	vm.stakes[addr] = stake
-	delete(vm.slashed, addr)
+	vm.changeLocked(validatorChange{kind: changeStake, addr: addr, stake: stake})
 	return nil
 }
 
@@ -49,8 +92,122 @@ func (vm *ValidatorManager) Remove(ctx context.Context, addr string) {
 
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
-	delete(vm.stakes, addr)
-	delete(vm.slashed, addr)
+	vm.changeLocked(validatorChange{kind: changeRemove, addr: addr})
+}
+
+// SyncBonded makes the stake of validators backed by stake bonded on the
+// ledger follow set: validators in set take its stake and bonded validators
+// missing from it are removed. Slashed validators stay slashed. Changes are
+// queued like those of Add and replace any queued by an earlier call.
+func (vm *ValidatorManager) SyncBonded(ctx context.Context, set ValidatorSet) {
+	ctx, span := telemetry.Tracer("core.consensus").Start(ctx, "ValidatorManager.SyncBonded")
+	defer span.End()
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	kept := vm.pending[:0]
+	for _, c := range vm.pending {
+		if c.kind != changeBond {
+			kept = append(kept, c)
+		}
+	}
+	vm.pending = kept
+	addrs := make([]string, 0, len(set)+len(vm.bonded))
+	for addr := range set {
+		addrs = append(addrs, addr)
+	}
+	for addr := range vm.bonded {
+		if _, ok := set[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		if stake := set[addr]; !vm.bonded[addr] || vm.stakes[addr] != stake {
+			vm.changeLocked(validatorChange{kind: changeBond, addr: addr, stake: stake})
+		}
+	}
+}
+
+// AdvanceTo records that the chain has reached height. When height ends an
+// epoch the queued changes are applied and the resulting set takes effect
+// from the next block.
+func (vm *ValidatorManager) AdvanceTo(ctx context.Context, height uint64) {
+	ctx, span := telemetry.Tracer("core.consensus").Start(ctx, "ValidatorManager.AdvanceTo")
+	defer span.End()
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if height <= vm.height {
+		return
+	}
+	prev := vm.height
+	vm.height = height
+	if vm.epoch == 0 || height/vm.epoch == prev/vm.epoch || len(vm.pending) == 0 {
+		return
+	}
+	for _, c := range vm.pending {
+		vm.applyLocked(c)
+	}
+	vm.pending = nil
+	vm.recordLocked(height/vm.epoch*vm.epoch + 1)
+}
+
+// changeLocked applies c, or queues it when stake changes wait for the next
+// epoch boundary.
+func (vm *ValidatorManager) changeLocked(c validatorChange) {
+	if vm.epoch > 0 && (vm.height > 0 || c.kind == changeBond) {
+		vm.pending = append(vm.pending, c)
+		return
+	}
+	vm.applyLocked(c)
+	vm.recordLocked(vm.height + 1)
+}
+
+func (vm *ValidatorManager) applyLocked(c validatorChange) {
+	switch c.kind {
+	case changeStake:
+		vm.stakes[c.addr] = c.stake
+		delete(vm.slashed, c.addr)
+	case changeRemove:
+		delete(vm.stakes, c.addr)
+		delete(vm.slashed, c.addr)
+		delete(vm.bonded, c.addr)
+	case changeBond:
+		if c.stake == 0 {
+			delete(vm.stakes, c.addr)
+			delete(vm.bonded, c.addr)
+			return
+		}
+		vm.stakes[c.addr] = c.stake
+		vm.bonded[c.addr] = true
+	case changeReward:
+		vm.stakes[c.addr] += c.stake
+	}
+}
+
+// recordLocked records the eligible set as the one in effect from height on.
+func (vm *ValidatorManager) recordLocked(from uint64) {
+	set := heightSet{from: from, set: ValidatorSet(vm.eligibleLocked())}
+	if n := len(vm.history); n > 0 && vm.history[n-1].from >= from {
+		vm.history[n-1] = set
+		return
+	}
+	vm.history = append(vm.history, set)
+}
+
+// SetAt returns the validators eligible at height with their stake.
+func (vm *ValidatorManager) SetAt(height uint64) ValidatorSet {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	i := sort.Search(len(vm.history), func(i int) bool { return vm.history[i].from > height })
+	set := make(ValidatorSet)
+	if i > 0 {
+		for addr, stake := range vm.history[i-1].set {
+			set[addr] = stake
+		}
+	}
+	return set
 }
 
 // Slash halves the stake of the validator and marks it as slashed.
@@ -65,28 +222,76 @@ func (vm *ValidatorManager) Reward(ctx context.Context, addr string, amount uint
 
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
-	vm.stakes[addr] += amount
+	vm.changeLocked(validatorChange{kind: changeReward, addr: addr, stake: amount})
 }
 
 // SlashWithEvidence halves the stake of the validator, marks it as slashed and
 // records the provided evidence string for later auditing.
 func (vm *ValidatorManager) SlashWithEvidence(ctx context.Context, addr, evidence string) {
+	vm.slash(ctx, addr, evidence, DoubleSignSlash)
+}
+
+// slash burns bps basis points of the validator's stake, marks it as slashed
+// and records evidence. The stake of bonded validators is left alone: the
+// ledger burns it and SyncBonded carries the result over.
+func (vm *ValidatorManager) slash(ctx context.Context, addr, evidence string, bps uint64) {
 	ctx, span := telemetry.Tracer("core.consensus").Start(ctx, "ValidatorManager.Slash")
 	defer span.End()
 
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 	if stake, ok := vm.stakes[addr]; ok {
-		vm.stakes[addr] = stake / 2
+		if !vm.bonded[addr] {
+			vm.stakes[addr] = slashKept(stake, bps)
+		}
 		vm.slashed[addr] = true
 		vm.evidence[addr] = evidence
+		vm.recordLocked(vm.height + 1)
+	}
+}
+
+// Rehabilitate lifts the slashed status of a validator, making it eligible
+// again with the stake slashing left it.
+func (vm *ValidatorManager) Rehabilitate(ctx context.Context, addr string) {
+	ctx, span := telemetry.Tracer("core.consensus").Start(ctx, "ValidatorManager.Rehabilitate")
+	defer span.End()
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if vm.slashed[addr] && vm.stakes[addr] > 0 {
+		delete(vm.slashed, addr)
+		vm.recordLocked(vm.height + 1)
+	}
+}
+
+// ApplyEvidence slashes the validator ev proves misbehaved by the fraction of
+// its stake the offence burns. Evidence of an offence that was already
+// punished is ignored, so the same offence never slashes twice. It reports
+// whether a slash was applied.
+func (vm *ValidatorManager) ApplyEvidence(ctx context.Context, ev *Evidence) bool {
+	if ev == nil {
+		return false
 	}
+	id := ev.ID()
+	vm.mu.Lock()
+	if vm.applied[id] {
+		vm.mu.Unlock()
+		return false
+	}
+	vm.applied[id] = true
+	vm.mu.Unlock()
+	vm.slash(ctx, ev.Validator, fmt.Sprintf("%s at height %d (%s)", ev.Kind, ev.Height, id), ev.SlashFraction())
+	return true
 }
 
 // Eligible returns a copy of the current validators eligible for selection.
 func (vm *ValidatorManager) Eligible() map[string]uint64 {
 	vm.mu.RLock()
 	defer vm.mu.RUnlock()
+	return vm.eligibleLocked()
+}
+
+func (vm *ValidatorManager) eligibleLocked() map[string]uint64 {
 	eligible := make(map[string]uint64)
 	for addr, stake := range vm.stakes {
 		if stake >= vm.minStake && !vm.slashed[addr] {
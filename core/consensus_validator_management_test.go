@@ -43,3 +43,34 @@ func TestValidatorManagerLifecycle(t *testing.T) {
 		t.Fatalf("validator not removed")
 	}
 }
+
+func TestValidatorManagerEpochs(t *testing.T) {
+	ctx := context.Background()
+	vm := NewValidatorManager(1, WithEpochLength(2))
+	_ = vm.Add(ctx, "v1", 10)
+	vm.AdvanceTo(ctx, 1)
+	_ = vm.Add(ctx, "v2", 5)
+	vm.Remove(ctx, "v1")
+	if elig := vm.Eligible(); elig["v1"] != 10 || elig["v2"] != 0 {
+		t.Fatalf("changes applied before the epoch ended: %v", elig)
+	}
+	vm.AdvanceTo(ctx, 2)
+	if elig := vm.Eligible(); elig["v1"] != 0 || elig["v2"] != 5 {
+		t.Fatalf("changes not applied at the epoch boundary: %v", elig)
+	}
+	vm.AdvanceTo(ctx, 3)
+	vm.Slash(ctx, "v2")
+	if set := vm.SetAt(2); set["v1"] != 10 || len(set) != 1 {
+		t.Fatalf("set at 2: %v", set)
+	}
+	if set := vm.SetAt(3); set["v2"] != 5 {
+		t.Fatalf("set at 3: %v", set)
+	}
+	if set := vm.SetAt(4); len(set) != 0 {
+		t.Fatalf("slashed validator in set at 4: %v", set)
+	}
+	vm.Rehabilitate(ctx, "v2")
+	if set := vm.SetAt(4); set["v2"] != 2 {
+		t.Fatalf("rehabilitated validator missing: %v", set)
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"synnergy/pkg/abi"
+)
+
+var (
+	// ErrUnknownMethod is returned when a contract with an ABI is called with
+	// a method the ABI does not declare.
+	ErrUnknownMethod = errors.New("method not in contract abi")
+	// ErrInvalidCallArgs is returned when call arguments do not decode as the
+	// inputs the ABI declares for the method.
+	ErrInvalidCallArgs = errors.New("call arguments do not match abi")
+	// ErrViewStateChange is returned when a view method receives coins or
+	// changes state.
+	ErrViewStateChange = errors.New("view method cannot change state")
+)
+
+// ABI returns the typed interface declared in the contract's manifest, or nil
+// when it declares none.
+func (c *Contract) ABI() (*abi.ABI, error) {
+	a, err := abi.FromManifest(c.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	return a, nil
+}
+
+// checkCall validates a call of c against its ABI before execution. Calls of
+// contracts without an ABI pass unchecked. Otherwise the method must be
+// declared, the arguments must decode exactly as its inputs and view
+// methods cannot receive value.
+func checkCall(c *Contract, method string, args []byte, value uint64) error {
+	a, err := c.ABI()
+	if err != nil || a == nil {
+		return err
+	}
+	m, ok := a.Method(method)
+	if !ok {
+		return fmt.Errorf("%w: %s on %s", ErrUnknownMethod, method, c.Address)
+	}
+	if _, err := m.DecodeArgs(args); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidCallArgs, m.Signature(), err)
+	}
+	if m.IsView() && value > 0 {
+		return fmt.Errorf("%w: %s cannot receive value", ErrViewStateChange, method)
+	}
+	return nil
+}
+
+// isView reports whether c's ABI declares method view.
+func isView(c *Contract, method string) bool {
+	a, err := c.ABI()
+	if err != nil || a == nil {
+		return false
+	}
+	m, ok := a.Method(method)
+	return ok && m.IsView()
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+const vaultABIManifest = `{"name":"vault","abi":{"methods":[
+	{"name":"deposit","outputs":[{"name":"amount","type":"uint64"}]},
+	{"name":"get","outputs":[{"name":"balance","type":"uint64"}],"mutability":"view"},
+	{"name":"pay","inputs":[{"name":"amount","type":"uint64"}],"outputs":[{"name":"status","type":"uint32"}]}
+]}}`
+
+func TestContractABIValidation(t *testing.T) {
+	vm := runningWASMVM(t)
+	ledger := NewLedger()
+	ledger.Credit("alice", 1_000_000)
+	reg := NewContractRegistry(vm, ledger)
+	if _, err := reg.Deploy(vaultModule(""), `{"abi":{"methods":[{"name":"get","inputs":[{"name":"x","type":"uint7"}]}]}}`, 200_000, "alice"); !errors.Is(err, ErrInvalidManifest) {
+		t.Fatalf("expected ErrInvalidManifest, got %v", err)
+	}
+	vault, err := reg.Deploy(vaultModule(""), vaultABIManifest, 200_000, "alice")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	c, _ := reg.Get(vault)
+	a, err := c.ABI()
+	if err != nil || a == nil {
+		t.Fatalf("abi: %v", err)
+	}
+
+	balance := ledger.GetBalance("alice")
+	if _, err := reg.Call(vault, "alice", "fail", nil, 0, 0); !errors.Is(err, ErrUnknownMethod) {
+		t.Fatalf("expected ErrUnknownMethod, got %v", err)
+	}
+	if _, err := reg.Call(vault, "alice", "pay", le32(1), 0, 0); !errors.Is(err, ErrInvalidCallArgs) {
+		t.Fatalf("expected ErrInvalidCallArgs, got %v", err)
+	}
+	if _, err := reg.Call(vault, "alice", "get", nil, 5, 0); !errors.Is(err, ErrViewStateChange) {
+		t.Fatalf("view methods must not receive value, got %v", err)
+	}
+	if ledger.GetBalance("alice") != balance {
+		t.Fatalf("rejected calls must not be charged")
+	}
+
+	if _, err := reg.Call(vault, "alice", "deposit", nil, 40, 0); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	m, _ := a.Method("get")
+	rcpt, err := reg.Call(vault, "alice", "get", nil, 0, 0)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if out, err := m.DecodeOutputs(rcpt.ReturnData); err != nil || out["balance"] != uint64(40) {
+		t.Fatalf("decoded output %v %v", out, err)
+	}
+
+	// a method declared view fails once it writes storage
+	lying, err := reg.Deploy(vaultModule(""), `{"abi":{"methods":[{"name":"deposit","mutability":"view"}]}}`, 200_000, "alice")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if _, err := reg.Call(lying, "alice", "deposit", nil, 0, 0); !errors.Is(err, ErrViewStateChange) {
+		t.Fatalf("expected ErrViewStateChange, got %v", err)
+	}
+	if v, ok, _ := reg.Storage(lying, []byte("alice")); ok {
+		t.Fatalf("view call must not write storage, got %x", v)
+	}
+	if sim, err := reg.SimulateCall(lying, "alice", "deposit", nil, 0, 0); err != nil || sim.Error == "" {
+		t.Fatalf("simulated view call must fail: %+v %v", sim, err)
+	}
+	if out, _, err := reg.InvokeFrom(vault, "alice", "pay", le64(1), 0); err != nil || !bytes.Equal(out, le32(wasmCallOK)) {
+		t.Fatalf("pay: %x %v", out, err)
+	}
+}
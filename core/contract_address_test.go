@@ -0,0 +1,86 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestContractAddressDerivation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Credit("alice", 1_000)
+	l.Credit("bob", 1_000)
+	reg := NewContractRegistry(runningWASMVM(t), l)
+	wasm := []byte("\x00asm\x01\x00\x00\x00")
+
+	predicted := reg.NextAddress("alice")
+	first, err := reg.Deploy(wasm, "", 10, "alice")
+	if err != nil || first != predicted || first != ContractAddress("alice", 0) {
+		t.Fatalf("deploy: %s %v, predicted %s", first, err, predicted)
+	}
+	second, err := reg.Deploy(wasm, "", 10, "alice")
+	if err != nil || second != ContractAddress("alice", 1) {
+		t.Fatalf("redeploy: %s %v", second, err)
+	}
+	if l.Nonce("alice") != 2 {
+		t.Fatalf("deployments must consume the nonce, got %d", l.Nonce("alice"))
+	}
+	if bobs, err := reg.Deploy(wasm, "", 10, "bob"); err != nil || bobs == first {
+		t.Fatalf("deployers must not collide: %s %v", bobs, err)
+	}
+
+	salt := []byte("mirror-v1")
+	want := ContractAddressWithSalt("alice", salt, wasm)
+	salted, err := reg.DeployWithSalt(wasm, "", 10, "alice", salt)
+	if err != nil || salted != want {
+		t.Fatalf("salted deploy: %s %v, want %s", salted, err, want)
+	}
+	if l.Nonce("alice") != 2 {
+		t.Fatalf("salted deployments must not consume the nonce")
+	}
+	balance := l.GetBalance("alice")
+	if _, err := reg.DeployWithSalt(wasm, "", 10, "alice", salt); !errors.Is(err, ErrContractAlreadyExists) {
+		t.Fatalf("expected duplicate salted deploy to fail, got %v", err)
+	}
+	if l.GetBalance("alice") != balance {
+		t.Fatalf("failed deploy charged gas")
+	}
+	if other := ContractAddressWithSalt("alice", salt, append(wasm, 0)); other == want {
+		t.Fatalf("salted address must depend on the code")
+	}
+	if _, err := reg.DeployWithSalt(wasm, "", 10, "alice", nil); !errors.Is(err, ErrSaltRequired) {
+		t.Fatalf("expected salt required, got %v", err)
+	}
+
+	l.Close()
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reopened.Nonce("alice") != 2 {
+		t.Fatalf("nonce not replayed: %d", reopened.Nonce("alice"))
+	}
+	c, ok := NewContractRegistry(runningWASMVM(t), reopened).Get(salted)
+	if !ok || !bytes.Equal(c.Salt, salt) {
+		t.Fatalf("salted contract not replayed: %+v", c)
+	}
+}
+
+func TestContractAddressWithoutLedger(t *testing.T) {
+	reg := NewContractRegistry(runningWASMVM(t), nil)
+	wasm := []byte("\x00asm\x01\x00\x00\x00")
+	for i := uint64(0); i < 2; i++ {
+		addr, err := reg.Deploy(wasm, "", 10, "owner")
+		if err != nil || addr != ContractAddress("owner", i) {
+			t.Fatalf("deploy %d: %s %v", i, addr, err)
+		}
+	}
+	if reg.NextAddress("owner") != ContractAddress("owner", 2) {
+		t.Fatalf("unexpected next address")
+	}
+}
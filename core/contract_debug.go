@@ -0,0 +1,388 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Debugging replays a contract call against a journal over the current state
+// that is never committed, so nothing is charged or persisted. While it runs
+// the WebAssembly interpreter records every executed instruction together
+// with the operand stack and linear memory it changed, the host functions it
+// called and the storage they accessed. Nested calls into other contracts are
+// recorded in the same trace.
+
+// MaxContractTraceSteps bounds the number of instructions recorded by a
+// single trace. Execution continues past the limit but is no longer recorded.
+const MaxContractTraceSteps = 1_000_000
+
+// ErrTraceUnsupported is returned when the registry's virtual machine cannot
+// record execution traces.
+var ErrTraceUnsupported = errors.New("virtual machine does not support tracing")
+
+// ContractTrace is the record of a replayed contract call. Byte strings are
+// hex encoded.
+type ContractTrace struct {
+	Contract   string        `json:"contract"`
+	Caller     string        `json:"caller"`
+	Method     string        `json:"method"`
+	Args       string        `json:"args,omitempty"`
+	Value      uint64        `json:"value,omitempty"`
+	Height     uint64        `json:"height"`
+	GasLimit   uint64        `json:"gas_limit"`
+	GasUsed    uint64        `json:"gas_used"`
+	ReturnData string        `json:"return_data,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Logs       []ContractLog `json:"logs,omitempty"`
+	Steps      []TraceStep   `json:"steps"`
+	Truncated  bool          `json:"truncated,omitempty"`
+}
+
+// TraceStep is one executed instruction. Pop and Push describe the change to
+// the operand stack of the executing function: the values removed from its
+// top and the values left in their place. GasLeft is the gas remaining before
+// the instruction ran. PC indexes the function's compiled instructions, which
+// omit structural instructions such as block and end.
+type TraceStep struct {
+	Step      int                  `json:"step"`
+	Contract  string               `json:"contract"`
+	Depth     int                  `json:"depth"`
+	Frame     int                  `json:"frame"`
+	Func      uint32               `json:"func"`
+	FuncName  string               `json:"func_name,omitempty"`
+	PC        int                  `json:"pc"`
+	Op        string               `json:"op"`
+	Immediate *uint64              `json:"immediate,omitempty"`
+	GasCost   uint64               `json:"gas_cost"`
+	GasLeft   uint64               `json:"gas_left"`
+	Pop       []uint64             `json:"pop,omitempty"`
+	Push      []uint64             `json:"push,omitempty"`
+	Memory    []TraceMemoryWrite   `json:"memory,omitempty"`
+	Host      *TraceHostCall       `json:"host,omitempty"`
+	Storage   []TraceStorageAccess `json:"storage,omitempty"`
+	Err       string               `json:"error,omitempty"`
+}
+
+// TraceMemoryWrite is a change to linear memory.
+type TraceMemoryWrite struct {
+	Offset uint64 `json:"offset"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// TraceHostCall is a call to a function of the synnergy host ABI.
+type TraceHostCall struct {
+	Name   string   `json:"name"`
+	Args   []uint64 `json:"args,omitempty"`
+	Result uint64   `json:"result"`
+	Err    string   `json:"error,omitempty"`
+}
+
+// Storage access kinds.
+const (
+	TraceStorageRead  = "read"
+	TraceStorageWrite = "write"
+)
+
+// TraceStorageAccess is a read or write of contract storage.
+type TraceStorageAccess struct {
+	Kind     string `json:"kind"`
+	Contract string `json:"contract"`
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Found    bool   `json:"found"`
+}
+
+// Debug replays a call of method on addr by caller like Call and returns its
+// trace. The call runs against the current state but none of its effects are
+// applied: no gas is charged and no receipt is recorded. Execution failures
+// are reported in the trace rather than as an error.
+func (r *ContractRegistry) Debug(addr, caller, method string, args []byte, value, gasLimit uint64) (*ContractTrace, error) {
+	if _, ok := r.vm.(*WASMVM); !ok {
+		return nil, ErrTraceUnsupported
+	}
+	c, ok := r.Get(addr)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, addr)
+	}
+	if err := checkCall(c, method, args, value); err != nil {
+		return nil, err
+	}
+	limit := gasLimit
+	if limit == 0 || limit > c.GasLimit {
+		limit = c.GasLimit
+	}
+	payer := caller
+	if payer == "" {
+		payer = c.Owner
+	}
+	host := registryHost{r: r, j: newContractJournal(r.state)}
+	if err := host.Transfer(payer, addr, value); err != nil {
+		return nil, err
+	}
+	call := r.newCall(addr, payer, value, host)
+	trace := &ContractTrace{
+		Contract: addr,
+		Caller:   payer,
+		Method:   method,
+		Args:     hex.EncodeToString(args),
+		Value:    value,
+		Height:   call.Height,
+		GasLimit: limit,
+		Steps:    []TraceStep{},
+	}
+	(&contractTracer{trace: trace}).attach(call)
+	out, used, err := r.execute(context.Background(), call, c, method, args, limit)
+	trace.GasUsed = used
+	trace.ReturnData = hex.EncodeToString(out)
+	trace.Logs = call.Logs
+	if err != nil {
+		trace.Error = err.Error()
+		var revert *RevertError
+		if errors.As(err, &revert) {
+			trace.ReturnData = hex.EncodeToString(revert.Data)
+		}
+	}
+	return trace, nil
+}
+
+// contractTracer records a ContractTrace as the interpreter executes. It
+// keeps the step in progress of every active function so that the stack
+// change of a call instruction is recorded once the callee returns.
+type contractTracer struct {
+	trace  *ContractTrace
+	frames []*traceFrame
+}
+
+type traceFrame struct {
+	in      *wasmInstance
+	fn      uint32
+	base    int
+	pending int
+	before  []uint64
+}
+
+// attach makes call record into t and wraps its host so that storage accesses
+// are recorded.
+func (t *contractTracer) attach(call *CallContext) {
+	call.trace = t
+	if call.Host != nil {
+		call.Host = tracingHost{ContractHost: call.Host, t: t}
+	}
+}
+
+func (t *contractTracer) top() *traceFrame {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	return t.frames[len(t.frames)-1]
+}
+
+func (t *contractTracer) current() *TraceStep {
+	f := t.top()
+	if f == nil || f.pending < 0 {
+		return nil
+	}
+	return &t.trace.Steps[f.pending]
+}
+
+func (t *contractTracer) enter(in *wasmInstance, fn uint32, base int) {
+	t.frames = append(t.frames, &traceFrame{in: in, fn: fn, base: base, pending: -1})
+}
+
+func (t *contractTracer) leave(err error) {
+	f := t.top()
+	if f == nil {
+		return
+	}
+	if err != nil {
+		t.finish(f, nil, err)
+	} else {
+		t.finish(f, f.in.stack[f.base:f.in.sp], nil)
+	}
+	t.frames = t.frames[:len(t.frames)-1]
+}
+
+// begin completes the previous step of the executing function, whose stack is
+// now stack, and opens a step for ins.
+func (t *contractTracer) begin(pc int, ins *wasmInstr, stack []uint64) {
+	f := t.top()
+	t.finish(f, stack, nil)
+	if len(t.trace.Steps) >= MaxContractTraceSteps {
+		t.trace.Truncated = true
+		return
+	}
+	in := f.in
+	step := TraceStep{
+		Step:     len(t.trace.Steps),
+		Contract: in.env.Contract,
+		Depth:    in.env.Depth,
+		Frame:    len(t.frames) - 1,
+		Func:     f.fn,
+		FuncName: in.mod.funcName(f.fn),
+		PC:       pc,
+		Op:       wasmOpName(ins.op),
+		GasCost:  in.costs[ins.class],
+		GasLeft:  in.gasLeft,
+	}
+	if wasmHasImmediate(ins.op) {
+		imm := ins.a
+		step.Immediate = &imm
+	}
+	t.trace.Steps = append(t.trace.Steps, step)
+	f.pending = step.Step
+	f.before = append(f.before[:0], stack...)
+}
+
+func (t *contractTracer) finish(f *traceFrame, after []uint64, err error) {
+	if f.pending < 0 {
+		return
+	}
+	step := &t.trace.Steps[f.pending]
+	f.pending = -1
+	if err != nil {
+		step.Err = err.Error()
+		return
+	}
+	keep := 0
+	for keep < len(f.before) && keep < len(after) && f.before[keep] == after[keep] {
+		keep++
+	}
+	if keep < len(f.before) {
+		step.Pop = append([]uint64(nil), f.before[keep:]...)
+	}
+	if keep < len(after) {
+		step.Push = append([]uint64(nil), after[keep:]...)
+	}
+}
+
+func (t *contractTracer) memory(offset uint64, old, new []byte) {
+	if step := t.current(); step != nil {
+		step.Memory = append(step.Memory, TraceMemoryWrite{
+			Offset: offset,
+			Old:    hex.EncodeToString(old),
+			New:    hex.EncodeToString(new),
+		})
+	}
+}
+
+func (t *contractTracer) host(name string, args []uint64, result uint64, err error) {
+	if step := t.current(); step != nil {
+		step.Host = &TraceHostCall{Name: name, Args: args, Result: result}
+		if err != nil {
+			step.Host.Err = err.Error()
+		}
+	}
+}
+
+func (t *contractTracer) storage(access TraceStorageAccess) {
+	if step := t.current(); step != nil {
+		step.Storage = append(step.Storage, access)
+	}
+}
+
+// tracingHost records the storage accesses of a traced call. Nested calls
+// are traced through their own call context.
+type tracingHost struct {
+	ContractHost
+	t *contractTracer
+}
+
+func (h tracingHost) StorageGet(contract string, key []byte) ([]byte, bool) {
+	v, ok := h.ContractHost.StorageGet(contract, key)
+	h.t.storage(TraceStorageAccess{
+		Kind:     TraceStorageRead,
+		Contract: contract,
+		Key:      hex.EncodeToString(key),
+		Value:    hex.EncodeToString(v),
+		Found:    ok,
+	})
+	return v, ok
+}
+
+func (h tracingHost) StorageSet(contract string, key, value []byte) {
+	h.ContractHost.StorageSet(contract, key, value)
+	h.t.storage(TraceStorageAccess{
+		Kind:     TraceStorageWrite,
+		Contract: contract,
+		Key:      hex.EncodeToString(key),
+		Value:    hex.EncodeToString(value),
+		Found:    true,
+	})
+}
+
+// funcName returns the export name of function idx, or the import name for
+// host functions.
+func (m *wasmModule) funcName(idx uint32) string {
+	if int(idx) < len(m.imports) {
+		return m.imports[idx].module + "." + m.imports[idx].name
+	}
+	for name, exp := range m.exports {
+		if exp.kind == wasmExternFunc && exp.index == idx {
+			return name
+		}
+	}
+	return ""
+}
+
+var wasmOpNames [256]string
+
+func init() {
+	names := func(first byte, list string) {
+		for i, name := range strings.Fields(list) {
+			wasmOpNames[int(first)+i] = name
+		}
+	}
+	names(0x00, "unreachable nop block loop if else")
+	names(0x0b, "end br br_if br_table return call call_indirect")
+	names(0x1a, "drop select")
+	names(0x20, "local.get local.set local.tee global.get global.set")
+	names(0x28, `i32.load i64.load f32.load f64.load i32.load8_s i32.load8_u
+		i32.load16_s i32.load16_u i64.load8_s i64.load8_u i64.load16_s i64.load16_u
+		i64.load32_s i64.load32_u i32.store i64.store f32.store f64.store i32.store8
+		i32.store16 i64.store8 i64.store16 i64.store32 memory.size memory.grow
+		i32.const i64.const f32.const f64.const`)
+	names(0x45, `i32.eqz i32.eq i32.ne i32.lt_s i32.lt_u i32.gt_s i32.gt_u i32.le_s
+		i32.le_u i32.ge_s i32.ge_u i64.eqz i64.eq i64.ne i64.lt_s i64.lt_u i64.gt_s
+		i64.gt_u i64.le_s i64.le_u i64.ge_s i64.ge_u f32.eq f32.ne f32.lt f32.gt
+		f32.le f32.ge f64.eq f64.ne f64.lt f64.gt f64.le f64.ge i32.clz i32.ctz
+		i32.popcnt i32.add i32.sub i32.mul i32.div_s i32.div_u i32.rem_s i32.rem_u
+		i32.and i32.or i32.xor i32.shl i32.shr_s i32.shr_u i32.rotl i32.rotr i64.clz
+		i64.ctz i64.popcnt i64.add i64.sub i64.mul i64.div_s i64.div_u i64.rem_s
+		i64.rem_u i64.and i64.or i64.xor i64.shl i64.shr_s i64.shr_u i64.rotl
+		i64.rotr f32.abs f32.neg f32.ceil f32.floor f32.trunc f32.nearest f32.sqrt
+		f32.add f32.sub f32.mul f32.div f32.min f32.max f32.copysign f64.abs f64.neg
+		f64.ceil f64.floor f64.trunc f64.nearest f64.sqrt f64.add f64.sub f64.mul
+		f64.div f64.min f64.max f64.copysign i32.wrap_i64 i32.trunc_f32_s
+		i32.trunc_f32_u i32.trunc_f64_s i32.trunc_f64_u i64.extend_i32_s
+		i64.extend_i32_u i64.trunc_f32_s i64.trunc_f32_u i64.trunc_f64_s
+		i64.trunc_f64_u f32.convert_i32_s f32.convert_i32_u f32.convert_i64_s
+		f32.convert_i64_u f32.demote_f64 f64.convert_i32_s f64.convert_i32_u
+		f64.convert_i64_s f64.convert_i64_u f64.promote_f32 i32.reinterpret_f32
+		i64.reinterpret_f64 f32.reinterpret_i32 f64.reinterpret_i64 i32.extend8_s
+		i32.extend16_s i64.extend8_s i64.extend16_s i64.extend32_s`)
+}
+
+// wasmOpName returns the text format mnemonic of op.
+func wasmOpName(op byte) string {
+	if name := wasmOpNames[op]; name != "" {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", op)
+}
+
+// wasmHasImmediate reports whether the compiled operand of op is meaningful
+// to a reader: a constant, an index or a memory offset. Branch operands are
+// compiled into instruction positions and are left out.
+func wasmHasImmediate(op byte) bool {
+	switch {
+	case op == wasmOpCall, op >= wasmOpLocalGet && op <= wasmOpGlobalSet:
+		return true
+	case op >= 0x28 && op <= 0x3e, op >= wasmOpI32Const && op <= wasmOpF64Const:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestContractDebugTrace(t *testing.T) {
+	l := NewLedger()
+	reg, vault, proxy := deployVaults(t, l)
+	if _, err := reg.Call(vault, "alice", "deposit", nil, 50, 0); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	balance, receipts := l.GetBalance("alice"), len(l.Receipts(1))
+
+	trace, err := reg.Debug(vault, "alice", "get", nil, 0, 0)
+	if err != nil || trace.Error != "" || trace.ReturnData != hex.EncodeToString(le64(50)) {
+		t.Fatalf("debug get: %+v %v", trace, err)
+	}
+	first := trace.Steps[0]
+	if first.Op != "i32.const" || first.FuncName != "get" || first.Immediate == nil || *first.Immediate != 0 ||
+		len(first.Push) != 1 || first.Push[0] != 0 || first.GasLeft != trace.GasLimit {
+		t.Fatalf("unexpected first step %+v", first)
+	}
+	var read *TraceStep
+	for i := range trace.Steps {
+		if h := trace.Steps[i].Host; h != nil && h.Name == "storage_get" {
+			read = &trace.Steps[i]
+		}
+	}
+	if read == nil || len(read.Storage) != 1 || read.Storage[0].Kind != TraceStorageRead || !read.Storage[0].Found ||
+		read.Storage[0].Key != hex.EncodeToString([]byte("alice")) || read.Storage[0].Value != hex.EncodeToString(le64(50)) {
+		t.Fatalf("storage read not traced: %+v", read)
+	}
+	if len(read.Memory) != 1 || read.Memory[0].Offset != 256 || read.Memory[0].New != hex.EncodeToString(le64(50)) {
+		t.Fatalf("host memory write not traced: %+v", read.Memory)
+	}
+	if len(read.Pop) != 4 || len(read.Push) != 1 || read.Push[0] != 8 {
+		t.Fatalf("host call stack diff: pop %v push %v", read.Pop, read.Push)
+	}
+
+	trace, err = reg.Debug(proxy, "alice", "relay", append(le32(0), le64(7)...), 7, 0)
+	if err != nil || trace.Error != "" || len(trace.Logs) != 1 {
+		t.Fatalf("debug relay: %+v %v", trace, err)
+	}
+	var nested, store int
+	for _, s := range trace.Steps {
+		if s.Contract == vault {
+			nested++
+			if s.Depth != 1 || s.Frame != 1 {
+				t.Fatalf("nested step %+v", s)
+			}
+		}
+		if s.Op == "i64.store" && s.Contract == vault {
+			store++
+			if len(s.Memory) != 1 || s.Memory[0].New != hex.EncodeToString(le64(7)) {
+				t.Fatalf("store not traced: %+v", s)
+			}
+		}
+	}
+	if nested == 0 || store != 1 {
+		t.Fatalf("nested call not traced: %d steps, %d stores", nested, store)
+	}
+
+	trace, err = reg.Debug(vault, "alice", "spill", nil, 0, 0)
+	if err != nil || !strings.Contains(trace.Error, ErrContractReverted.Error()) || trace.ReturnData != hex.EncodeToString([]byte("nope")) {
+		t.Fatalf("debug spill: %+v %v", trace, err)
+	}
+	last := trace.Steps[len(trace.Steps)-1]
+	if last.Host == nil || last.Host.Name != "revert" || last.Err == "" {
+		t.Fatalf("failing step %+v", last)
+	}
+
+	if l.GetBalance("alice") != balance || len(l.Receipts(1)) != receipts {
+		t.Fatalf("debugging must not change the ledger")
+	}
+	if v, _, _ := reg.Storage(vault, []byte("alice")); hex.EncodeToString(v) != hex.EncodeToString(le64(50)) {
+		t.Fatalf("debugging must not write storage, got %x", v)
+	}
+	if _, err := reg.Debug("missing", "alice", "get", nil, 0, 0); !errors.Is(err, ErrContractNotFound) {
+		t.Fatalf("expected missing contract, got %v", err)
+	}
+	vm := NewSimpleVM()
+	_ = vm.Start()
+	if _, err := NewContractRegistry(vm, nil).Debug(vault, "", "get", nil, 0, 0); !errors.Is(err, ErrTraceUnsupported) {
+		t.Fatalf("expected unsupported vm, got %v", err)
+	}
+}
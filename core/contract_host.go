@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MaxContractCallDepth bounds the nesting of cross-contract calls.
+const MaxContractCallDepth = 64
+
+// MaxLogTopics bounds the number of topics attached to a contract log.
+const MaxLogTopics = 4
+
+var (
+	ErrContractReverted  = errors.New("contract reverted")
+	ErrCallDepthExceeded = errors.New("contract call depth exceeded")
+	ErrHostUnavailable   = errors.New("contract host unavailable")
+)
+
+// RevertError is returned when a contract aborts through the revert host
+// function. Data carries the reason supplied by the contract.
+type RevertError struct {
+	Data []byte
+}
+
+func (e *RevertError) Error() string {
+	if len(e.Data) == 0 {
+		return ErrContractReverted.Error()
+	}
+	return fmt.Sprintf("%s: %q", ErrContractReverted, e.Data)
+}
+
+func (e *RevertError) Unwrap() error { return ErrContractReverted }
+
+// ContractLog is an event emitted by a contract. Topics are hex encoded
+// 32-byte values used for indexing; Data is opaque to the chain. Once the
+// ledger records the log in a receipt it also carries the receipt's
+// transaction, its height and its index among the logs of that height.
+type ContractLog struct {
+	Address     string   `json:"address"`
+	Topics      []string `json:"topics"`
+	Data        []byte   `json:"data"`
+	TxID        string   `json:"tx_id,omitempty"`
+	BlockHeight int      `json:"block_height,omitempty"`
+	Index       int      `json:"log_index"`
+}
+
+// CallContext describes the environment of a contract invocation. Contracts
+// read it through the synnergy host ABI.
+type CallContext struct {
+	Contract string       // address of the executing contract
+	Caller   string       // immediate caller, a contract for nested calls
+	Origin   string       // account that started the call chain
+	Value    uint64       // coins transferred to the contract with the call
+	Height   uint64       // height of the latest block
+	Time     int64        // timestamp of the latest block
+	Depth    int          // nesting depth, zero for top-level calls
+	Host     ContractHost // chain state; nil disables state access
+	Logs     []ContractLog
+
+	trace *contractTracer // records execution when the call is debugged
+}
+
+// ContractHost provides the chain state behind the synnergy host ABI.
+type ContractHost interface {
+	Balance(addr string) uint64
+	Transfer(from, to string, amount uint64) error
+	StorageGet(contract string, key []byte) ([]byte, bool)
+	StorageSet(contract string, key, value []byte)
+	// Call invokes another contract on behalf of parent and returns its
+	// output and the gas it consumed.
+	Call(ctx context.Context, parent *CallContext, to, method string, args []byte, value, gasLimit uint64) ([]byte, uint64, error)
+}
+
+// HostVM is implemented by virtual machines that expose the synnergy host ABI
+// to contracts.
+type HostVM interface {
+	ExecuteCall(ctx context.Context, call *CallContext, wasm []byte, method string, args []byte, gasLimit uint64) ([]byte, uint64, error)
+}
+
+// registryHost implements ContractHost for one call frame on top of a
+// registry. State access goes through the frame's journal.
+type registryHost struct {
+	r *ContractRegistry
+	j *contractJournal
+}
+
+func (h registryHost) Balance(addr string) uint64 { return h.j.balance(addr) }
+
+func (h registryHost) Transfer(from, to string, amount uint64) error {
+	if h.r.ledger == nil && amount > 0 {
+		return ErrHostUnavailable
+	}
+	return h.j.transfer(from, to, amount)
+}
+
+func (h registryHost) StorageGet(contract string, key []byte) ([]byte, bool) {
+	return h.j.get(contract, key)
+}
+
+func (h registryHost) StorageSet(contract string, key, value []byte) {
+	h.j.set(contract, key, value)
+}
+
+// Call runs a nested call in a child journal, which is merged into the
+// caller's journal only if the call succeeds.
+func (h registryHost) Call(ctx context.Context, parent *CallContext, to, method string, args []byte, value, gasLimit uint64) ([]byte, uint64, error) {
+	if parent.Depth+1 > MaxContractCallDepth {
+		return nil, 0, ErrCallDepthExceeded
+	}
+	c, ok := h.r.Get(to)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrContractNotFound, to)
+	}
+	if c.Paused {
+		return nil, 0, fmt.Errorf("%w: %s", ErrContractPaused, to)
+	}
+	if err := checkCall(c, method, args, value); err != nil {
+		return nil, 0, err
+	}
+	child := registryHost{r: h.r, j: h.j.child()}
+	if err := child.Transfer(parent.Contract, to, value); err != nil {
+		return nil, 0, err
+	}
+	call := &CallContext{
+		Contract: to,
+		Caller:   parent.Contract,
+		Origin:   parent.Origin,
+		Value:    value,
+		Height:   parent.Height,
+		Time:     parent.Time,
+		Depth:    parent.Depth + 1,
+		Host:     child,
+	}
+	if parent.trace != nil {
+		parent.trace.attach(call)
+	}
+	out, used, err := h.r.execute(ctx, call, c, method, args, gasLimit)
+	if err != nil {
+		return out, used, err
+	}
+	child.j.merge()
+	parent.Logs = append(parent.Logs, call.Logs...)
+	return out, used, nil
+}
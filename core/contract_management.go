@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	ierr "synnergy/internal/errors"
 	"synnergy/internal/telemetry"
@@ -11,12 +12,40 @@ import (
 
 // ContractManager provides administrative operations over deployed contracts.
 type ContractManager struct {
-	registry *ContractRegistry
+	registry  *ContractRegistry
+	proposals *ProposalManager
+	now       func() time.Time
+}
+
+// ContractManagerOption configures a ContractManager.
+type ContractManagerOption func(*ContractManager)
+
+// WithUpgradeProposals sets the proposals consulted when authorising upgrades
+// of contracts governed by a DAO.
+func WithUpgradeProposals(pm *ProposalManager) ContractManagerOption {
+	return func(m *ContractManager) {
+		m.proposals = pm
+	}
+}
+
+// WithContractManagerClock overrides the clock used for upgrade timelocks.
+func WithContractManagerClock(now func() time.Time) ContractManagerOption {
+	return func(m *ContractManager) {
+		if now != nil {
+			m.now = now
+		}
+	}
 }
 
 // NewContractManager wires a manager to an existing registry.
-func NewContractManager(reg *ContractRegistry) *ContractManager {
-	return &ContractManager{registry: reg}
+func NewContractManager(reg *ContractRegistry, opts ...ContractManagerOption) *ContractManager {
+	m := &ContractManager{registry: reg, now: time.Now}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
 }
 
 // Transfer changes the owner of a contract.
@@ -87,7 +116,9 @@ func (m *ContractManager) Resume(ctx context.Context, addr string) error {
 	return nil
 }
 
-// Upgrade replaces contract bytecode and optional gas limit.
+// Upgrade replaces contract bytecode and optional gas limit on behalf of the
+// owner. It applies to contracts whose policy has neither a DAO nor a
+// timelock; others go through ProposeUpgrade and ActivateUpgrade.
 func (m *ContractManager) Upgrade(ctx context.Context, addr string, wasm []byte, gasLimit uint64) error {
 	ctx, span := telemetry.Tracer("core.contracts").Start(ctx, "ContractManager.Upgrade")
 	defer span.End()
@@ -99,23 +130,17 @@ func (m *ContractManager) Upgrade(ctx context.Context, addr string, wasm []byte,
 	if !ok {
 		return ierr.New(ierr.NotFound, fmt.Sprintf("contract not found: %s", addr))
 	}
-	m.registry.mu.Lock()
-	wasmCopy := make([]byte, len(wasm))
-	copy(wasmCopy, wasm)
-	c.WASM = wasmCopy
-	if gasLimit > 0 {
-		c.GasLimit = gasLimit
+	m.registry.mu.RLock()
+	owner, policy := c.Owner, c.Policy
+	m.registry.mu.RUnlock()
+	if policy.DAOID != "" {
+		return ierr.Wrap(ierr.Unauthorized, fmt.Sprintf("contract %s is upgraded through DAO %s", addr, policy.DAOID), ErrUpgradeUnauthorized)
 	}
-	snapshot := cloneContract(c)
-	m.registry.mu.Unlock()
-	m.registry.persistContract(snapshot)
-	m.registry.emit(ContractRegistryEvent{
-		Type:     ContractRegistryEventUpgrade,
-		Contract: snapshot,
-		Caller:   snapshot.Owner,
-		GasLimit: snapshot.GasLimit,
-	})
-	return nil
+	if policy.Timelock > 0 {
+		return ierr.Wrap(ierr.Conflict, fmt.Sprintf("contract %s upgrades are timelocked for %s", addr, policy.Timelock), ErrUpgradeTimelocked)
+	}
+	_, err := m.ProposeUpgrade(ctx, addr, UpgradeRequest{Caller: owner, WASM: wasm, GasLimit: gasLimit})
+	return err
 }
 
 // Info returns contract metadata including owner and paused status.
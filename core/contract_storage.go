@@ -0,0 +1,310 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// keyContractStoragePrefix holds contract storage as
+// "cstore/<contract>/<hex key>". Each slot is a leaf of the state trie.
+const keyContractStoragePrefix = "cstore/"
+
+func contractStorageKey(contract string, key []byte) string {
+	return keyContractStoragePrefix + contract + "/" + hex.EncodeToString(key)
+}
+
+// ContractTransfer moves coins on behalf of a contract invocation.
+type ContractTransfer struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount uint64 `json:"amount"`
+}
+
+// ContractStorageWrite sets a storage slot of a contract. An empty Value
+// deletes the slot.
+type ContractStorageWrite struct {
+	Contract string `json:"contract"`
+	Key      []byte `json:"key"`
+	Value    []byte `json:"value,omitempty"`
+}
+
+// ContractStorageEntry is a single slot of contract storage.
+type ContractStorageEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// ContractStateChanges is the net effect of a contract invocation. Transfers
+// are applied in order before the storage writes, and the invocation's receipt
+// is recorded with them.
+type ContractStateChanges struct {
+	Transfers []ContractTransfer     `json:"transfers,omitempty"`
+	Storage   []ContractStorageWrite `json:"storage,omitempty"`
+	Receipt   *Receipt               `json:"receipt,omitempty"`
+}
+
+func (c *ContractStateChanges) empty() bool {
+	return c == nil || (len(c.Transfers) == 0 && len(c.Storage) == 0 && c.Receipt == nil)
+}
+
+// ContractStorage returns the value of a contract storage slot.
+func (l *Ledger) ContractStorage(contract string, key []byte) ([]byte, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.getLocked(contractStorageKey(contract, key))
+}
+
+// ContractStorageEntries returns every storage slot of a contract ordered by
+// key.
+func (l *Ledger) ContractStorageEntries(contract string) []ContractStorageEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	prefix := keyContractStoragePrefix + contract + "/"
+	var out []ContractStorageEntry
+	it := l.store.Iterate([]byte(prefix))
+	for it.Next() {
+		key, err := hex.DecodeString(strings.TrimPrefix(string(it.Key()), prefix))
+		if err != nil {
+			continue
+		}
+		out = append(out, ContractStorageEntry{Key: key, Value: append([]byte(nil), it.Value()...)})
+	}
+	return out
+}
+
+// ApplyContractChanges commits the state changes of a contract invocation
+// atomically. If any transfer lacks funds nothing is applied.
+func (l *Ledger) ApplyContractChanges(c *ContractStateChanges) error {
+	if c.empty() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.applyContractChangesLocked(c); err != nil {
+		l.discardLocked()
+		return err
+	}
+	return l.commitLocked(walRecord{Kind: walKindContractState, Changes: c})
+}
+
+func (l *Ledger) applyContractChangesLocked(c *ContractStateChanges) error {
+	for _, t := range c.Transfers {
+		if err := l.transferLocked(t.From, t.To, t.Amount, 0); err != nil {
+			return fmt.Errorf("transfer %s -> %s: %w", t.From, t.To, err)
+		}
+	}
+	for _, w := range c.Storage {
+		key := contractStorageKey(w.Contract, w.Key)
+		if len(w.Value) == 0 {
+			l.deleteLocked(key)
+		} else {
+			l.setLocked(key, w.Value)
+		}
+	}
+	if c.Receipt != nil {
+		return l.recordReceiptLocked(c.Receipt)
+	}
+	return nil
+}
+
+// contractState is the committed state contract journals read through to and
+// commit into. The ledger implements it; registries without a ledger keep
+// storage in memory.
+type contractState interface {
+	GetBalance(addr string) uint64
+	ContractStorage(contract string, key []byte) ([]byte, bool)
+	ContractStorageEntries(contract string) []ContractStorageEntry
+	ApplyContractChanges(c *ContractStateChanges) error
+}
+
+// memContractState keeps contract storage in memory. It holds no balances, so
+// transfers fail.
+type memContractState struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func (s *memContractState) GetBalance(string) uint64 { return 0 }
+
+func (s *memContractState) ContractStorage(contract string, key []byte) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.data[contractStorageKey(contract, key)]
+	return bytes.Clone(v), ok
+}
+
+func (s *memContractState) ContractStorageEntries(contract string) []ContractStorageEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	prefix := keyContractStoragePrefix + contract + "/"
+	var out []ContractStorageEntry
+	for k, v := range s.data {
+		if key, err := hex.DecodeString(strings.TrimPrefix(k, prefix)); err == nil && strings.HasPrefix(k, prefix) {
+			out = append(out, ContractStorageEntry{Key: key, Value: bytes.Clone(v)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i].Key, out[j].Key) < 0 })
+	return out
+}
+
+func (s *memContractState) ApplyContractChanges(c *ContractStateChanges) error {
+	if c.empty() {
+		return nil
+	}
+	if len(c.Transfers) > 0 {
+		return ErrHostUnavailable
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string][]byte)
+	}
+	for _, w := range c.Storage {
+		key := contractStorageKey(w.Contract, w.Key)
+		if len(w.Value) == 0 {
+			delete(s.data, key)
+		} else {
+			s.data[key] = bytes.Clone(w.Value)
+		}
+	}
+	return nil
+}
+
+// contractJournal buffers the state changes of an invocation on top of the
+// committed state. Nested calls open a child journal that is merged into its
+// parent when the call succeeds and dropped when it fails, so reverts and
+// out-of-gas errors leave no trace and only the outermost successful call
+// reaches the ledger.
+type contractJournal struct {
+	parent    *contractJournal
+	state     contractState
+	transfers []ContractTransfer
+	storage   map[string]ContractStorageWrite
+	gas       bool // transfers[0] holds the gas reserved for the call
+}
+
+func newContractJournal(state contractState) *contractJournal {
+	return &contractJournal{state: state, storage: make(map[string]ContractStorageWrite)}
+}
+
+func (j *contractJournal) child() *contractJournal {
+	return &contractJournal{parent: j, state: j.state, storage: make(map[string]ContractStorageWrite)}
+}
+
+func (j *contractJournal) balance(addr string) uint64 {
+	var bal uint64
+	if j.parent != nil {
+		bal = j.parent.balance(addr)
+	} else {
+		bal = j.state.GetBalance(addr)
+	}
+	for _, t := range j.transfers {
+		if t.From == addr {
+			bal -= min(bal, t.Amount)
+		}
+		if t.To == addr {
+			bal += t.Amount
+		}
+	}
+	return bal
+}
+
+func (j *contractJournal) transfer(from, to string, amount uint64) error {
+	if amount == 0 {
+		return nil
+	}
+	if from == "" || to == "" {
+		return ErrEmptyAddress
+	}
+	if j.balance(from) < amount {
+		return errors.New("insufficient funds")
+	}
+	j.transfers = append(j.transfers, ContractTransfer{From: from, To: to, Amount: amount})
+	return nil
+}
+
+// reserveGas sets aside limit of payer's balance for the call's gas, so the
+// call cannot spend it. It must be the journal's first write.
+func (j *contractJournal) reserveGas(payer, collector string, limit uint64) error {
+	if err := j.transfer(payer, collector, limit); err != nil {
+		return err
+	}
+	j.gas = limit > 0
+	return nil
+}
+
+// settleGas reduces the gas reservation to the gas used, which is then
+// charged when the journal commits.
+func (j *contractJournal) settleGas(used uint64) {
+	if !j.gas {
+		return
+	}
+	if used == 0 {
+		j.transfers, j.gas = j.transfers[1:], false
+		return
+	}
+	j.transfers[0].Amount = min(used, j.transfers[0].Amount)
+}
+
+func (j *contractJournal) get(contract string, key []byte) ([]byte, bool) {
+	for cur := j; cur != nil; cur = cur.parent {
+		if w, ok := cur.storage[contractStorageKey(contract, key)]; ok {
+			return bytes.Clone(w.Value), len(w.Value) > 0
+		}
+	}
+	return j.state.ContractStorage(contract, key)
+}
+
+func (j *contractJournal) set(contract string, key, value []byte) {
+	j.storage[contractStorageKey(contract, key)] = ContractStorageWrite{
+		Contract: contract,
+		Key:      bytes.Clone(key),
+		Value:    bytes.Clone(value),
+	}
+}
+
+// writes returns the number of transfers and storage slots the journal has
+// written, excluding its gas reservation.
+func (j *contractJournal) writes() int {
+	n := len(j.transfers) + len(j.storage)
+	if j.gas {
+		n--
+	}
+	return n
+}
+
+// merge folds a successful child journal into its parent.
+func (j *contractJournal) merge() {
+	p := j.parent
+	p.transfers = append(p.transfers, j.transfers...)
+	for k, w := range j.storage {
+		p.storage[k] = w
+	}
+}
+
+// changes returns the journal's writes with storage ordered by slot.
+func (j *contractJournal) changes() *ContractStateChanges {
+	c := &ContractStateChanges{Transfers: j.transfers}
+	keys := make([]string, 0, len(j.storage))
+	for k := range j.storage {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		c.Storage = append(c.Storage, j.storage[k])
+	}
+	return c
+}
+
+// commit writes a top-level journal to the committed state together with the
+// invocation's receipt.
+func (j *contractJournal) commit(r *Receipt) error {
+	c := j.changes()
+	c.Receipt = r
+	return j.state.ApplyContractChanges(c)
+}
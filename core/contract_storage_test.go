@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func deployVaults(t *testing.T, l *Ledger) (*ContractRegistry, string, string) {
+	t.Helper()
+	l.Credit("alice", 1_000_000)
+	reg := NewContractRegistry(runningWASMVM(t), l)
+	vault, err := reg.Deploy(vaultModule(""), "", 200_000, "alice")
+	if err != nil {
+		t.Fatalf("deploy vault: %v", err)
+	}
+	proxy, err := reg.Deploy(vaultModule(vault), "", 200_000, "alice")
+	if err != nil {
+		t.Fatalf("deploy proxy: %v", err)
+	}
+	return reg, vault, proxy
+}
+
+func TestContractStorageCommitsToLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	reg, vault, proxy := deployVaults(t, l)
+	root := l.StateRoot()
+	if _, _, err := reg.InvokeWithValue(vault, "alice", "deposit", nil, 50, 0); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if _, _, err := reg.InvokeWithValue(proxy, "alice", "relay", append(le32(0), le64(7)...), 7, 0); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if l.StateRoot() == root {
+		t.Fatalf("storage writes must change the state root")
+	}
+	want := []ContractStorageEntry{{Key: []byte("alice"), Value: le64(50)}, {Key: []byte(proxy), Value: le64(7)}}
+	if proxy < "alice" {
+		want[0], want[1] = want[1], want[0]
+	}
+	got, err := reg.StorageEntries(vault)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("entries: %+v %v", got, err)
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].Key, want[i].Key) || !bytes.Equal(got[i].Value, want[i].Value) {
+			t.Fatalf("entry %d: got %q=%x want %q=%x", i, got[i].Key, got[i].Value, want[i].Key, want[i].Value)
+		}
+	}
+	if _, err := reg.StorageEntries("missing"); !errors.Is(err, ErrContractNotFound) {
+		t.Fatalf("expected unknown contract error, got %v", err)
+	}
+
+	l.Close()
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if v, ok := reopened.ContractStorage(vault, []byte("alice")); !ok || !bytes.Equal(v, le64(50)) {
+		t.Fatalf("storage not replayed: %x", v)
+	}
+	if reopened.GetBalance(vault) != 57 {
+		t.Fatalf("vault balance %d after replay", reopened.GetBalance(vault))
+	}
+	reg = NewContractRegistry(runningWASMVM(t), reopened)
+	if out, _, err := reg.InvokeFrom(vault, "alice", "get", nil, 0); err != nil || !bytes.Equal(out, le64(50)) {
+		t.Fatalf("get after restart: %x %v", out, err)
+	}
+}
+
+func TestContractStorageRollsBackFailedCalls(t *testing.T) {
+	l := NewLedger()
+	reg, vault, proxy := deployVaults(t, l)
+	root := l.StateRoot()
+	alice := l.GetBalance("alice")
+
+	if _, _, err := reg.InvokeWithValue(vault, "alice", "spill", nil, 10, 0); !errors.Is(err, ErrContractReverted) {
+		t.Fatalf("spill: %v", err)
+	}
+	if _, _, err := reg.InvokeWithValue(vault, "alice", "burn", nil, 10, 5_000); !errors.Is(err, ErrGasLimit) {
+		t.Fatalf("burn: %v", err)
+	}
+	// the relayed deposit succeeds but the proxy reverts afterwards
+	if _, _, err := reg.InvokeWithValue(proxy, "alice", "relay_fail", append(le32(0), le64(5)...), 5, 0); !errors.Is(err, ErrContractReverted) {
+		t.Fatalf("relay_fail: %v", err)
+	}
+	for _, c := range []string{vault, proxy} {
+		if entries, _ := reg.StorageEntries(c); len(entries) != 0 || l.GetBalance(c) != 0 {
+			t.Fatalf("failed calls left state in %s: %+v balance %d", c, entries, l.GetBalance(c))
+		}
+	}
+	if l.StateRoot() != root || l.GetBalance("alice") != alice {
+		t.Fatalf("failed calls must not change state")
+	}
+
+	// a reverted nested call is discarded while its caller commits
+	if out, _, err := reg.InvokeFrom(proxy, "alice", "relay", append(le32(1), le64(0)...), 0); err != nil || !bytes.Equal(out, le32(104)) {
+		t.Fatalf("relay revert: %x %v", out, err)
+	}
+}
+
+func TestContractStorageInSnapshot(t *testing.T) {
+	validator, sender := registerTestValidator(t), testWallet(t, "alice")
+	source := NewLedger()
+	source.Credit(sender.Address, 1000)
+	reg, vault, _ := deployVaults(t, source)
+	if _, _, err := reg.InvokeWithValue(vault, "alice", "deposit", nil, 50, 0); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	addSealedTestBlocks(t, source, validator, sender, 1)
+
+	snap, err := CreateSnapshot(source, 0, testWallet(t, "producer"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	dir := t.TempDir()
+	if err := snap.WriteDir(dir); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	dest := NewLedger()
+	if _, err := dest.RestoreSnapshot(SnapshotDir(dir), WithTrustedSnapshotRoot(source.StateRoot())); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if dest.StateRoot() != source.StateRoot() {
+		t.Fatalf("state root differs after restore")
+	}
+	if v, ok := dest.ContractStorage(vault, []byte("alice")); !ok || !bytes.Equal(v, le64(50)) {
+		t.Fatalf("storage not restored: %x", v)
+	}
+}
@@ -0,0 +1,408 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ierr "synnergy/internal/errors"
+	"synnergy/internal/telemetry"
+)
+
+// A contract's address is a stable proxy for a sequence of code versions.
+// Upgrades replace the code, gas limit and manifest behind the address while
+// its storage and balance stay in place. Each contract carries an
+// UpgradePolicy: by default its owner proposes upgrades, and a policy naming
+// a DAO instead requires a passed proposal of that DAO whose description
+// contains the new code hash. A proposed upgrade becomes pending and can be
+// activated once the policy's timelock has elapsed. Every version is kept in
+// the contract's upgrade history.
+
+var (
+	ErrUpgradeUnauthorized       = errors.New("upgrade not authorized")
+	ErrUpgradeTimelocked         = errors.New("upgrade timelock has not elapsed")
+	ErrUpgradePending            = errors.New("an upgrade is already pending")
+	ErrNoPendingUpgrade          = errors.New("no pending upgrade")
+	ErrStorageLayoutIncompatible = errors.New("incompatible storage layout")
+)
+
+// UpgradePolicy governs how a contract's code may be replaced.
+type UpgradePolicy struct {
+	// DAOID names the DAO whose passed proposals authorise upgrades. When
+	// empty the contract owner authorises them.
+	DAOID string `json:"dao_id,omitempty"`
+	// Timelock is the delay between proposing and activating an upgrade.
+	Timelock time.Duration `json:"timelock,omitempty"`
+}
+
+// UpgradeStatus is the state of a contract code version.
+type UpgradeStatus string
+
+const (
+	UpgradePending    UpgradeStatus = "pending"
+	UpgradeActive     UpgradeStatus = "active"
+	UpgradeSuperseded UpgradeStatus = "superseded"
+	UpgradeCancelled  UpgradeStatus = "cancelled"
+)
+
+// ContractUpgrade is one version of a contract's code. Times are Unix
+// seconds; the first version records no times as it predates the history.
+type ContractUpgrade struct {
+	Version     int           `json:"version"`
+	CodeHash    string        `json:"code_hash"`
+	GasLimit    uint64        `json:"gas_limit"`
+	Manifest    string        `json:"manifest,omitempty"`
+	ProposedBy  string        `json:"proposed_by,omitempty"`
+	ProposalID  string        `json:"proposal_id,omitempty"`
+	ProposedAt  int64         `json:"proposed_at,omitempty"`
+	ActivateAt  int64         `json:"activate_at,omitempty"`
+	ActivatedAt int64         `json:"activated_at,omitempty"`
+	Status      UpgradeStatus `json:"status"`
+	// WASM holds the code of a pending upgrade until it is activated.
+	WASM []byte `json:"wasm,omitempty"`
+}
+
+// UpgradeRequest describes new code for a contract. Zero GasLimit and empty
+// Manifest keep the current values. ProposalID is required for contracts
+// governed by a DAO.
+type UpgradeRequest struct {
+	Caller     string
+	WASM       []byte
+	GasLimit   uint64
+	Manifest   string
+	ProposalID string
+}
+
+// StorageSlot declares a region of contract storage in the "storage_layout"
+// list of a manifest. Keys of the slot start with Prefix and hold values of
+// Type.
+type StorageSlot struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Type   string `json:"type"`
+}
+
+func storageLayout(manifest string) ([]StorageSlot, error) {
+	if strings.TrimSpace(manifest) == "" {
+		return nil, nil
+	}
+	var m struct {
+		Layout []StorageSlot `json:"storage_layout"`
+	}
+	if err := json.Unmarshal([]byte(manifest), &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	return m.Layout, nil
+}
+
+// CheckStorageLayout reports whether code declaring newManifest can take over
+// the storage of code declaring oldManifest. Every declared slot must be kept
+// with the same prefix and type, and added slots must not overlap existing
+// ones. Manifests without a layout place no constraints on their successor.
+func CheckStorageLayout(oldManifest, newManifest string) error {
+	oldLayout, err := storageLayout(oldManifest)
+	if err != nil {
+		return err
+	}
+	newLayout, err := storageLayout(newManifest)
+	if err != nil {
+		return err
+	}
+	if len(oldLayout) == 0 {
+		return nil
+	}
+	byName := make(map[string]StorageSlot, len(newLayout))
+	for _, s := range newLayout {
+		byName[s.Name] = s
+	}
+	for _, old := range oldLayout {
+		s, ok := byName[old.Name]
+		switch {
+		case !ok:
+			return fmt.Errorf("%w: slot %q removed", ErrStorageLayoutIncompatible, old.Name)
+		case s.Prefix != old.Prefix:
+			return fmt.Errorf("%w: slot %q moved from prefix %q to %q", ErrStorageLayoutIncompatible, old.Name, old.Prefix, s.Prefix)
+		case s.Type != old.Type:
+			return fmt.Errorf("%w: slot %q changed type from %s to %s", ErrStorageLayoutIncompatible, old.Name, old.Type, s.Type)
+		}
+	}
+	for i, a := range newLayout {
+		for _, b := range newLayout[i+1:] {
+			if strings.HasPrefix(a.Prefix, b.Prefix) || strings.HasPrefix(b.Prefix, a.Prefix) {
+				return fmt.Errorf("%w: slots %q and %q overlap", ErrStorageLayoutIncompatible, a.Name, b.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func codeHash(wasm []byte) string {
+	sum := sha256.Sum256(wasm)
+	return hex.EncodeToString(sum[:])
+}
+
+func cloneUpgrades(in []ContractUpgrade) []ContractUpgrade {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]ContractUpgrade, len(in))
+	for i, u := range in {
+		u.WASM = bytes.Clone(u.WASM)
+		out[i] = u
+	}
+	return out
+}
+
+// pendingUpgrade returns the pending version of c, if any. Callers must hold
+// the registry lock.
+func pendingUpgrade(c *Contract) *ContractUpgrade {
+	if n := len(c.Upgrades); n > 0 && c.Upgrades[n-1].Status == UpgradePending {
+		return &c.Upgrades[n-1]
+	}
+	return nil
+}
+
+// SetUpgradePolicy changes how a contract may be upgraded. Only the owner may
+// change the policy of a contract that is not governed by a DAO, the timelock
+// can only be extended, and the policy is fixed while an upgrade is pending.
+func (m *ContractManager) SetUpgradePolicy(ctx context.Context, addr, caller string, p UpgradePolicy) error {
+	ctx, span := telemetry.Tracer("core.contracts").Start(ctx, "ContractManager.SetUpgradePolicy")
+	defer span.End()
+
+	c, ok := m.registry.Get(addr)
+	if !ok {
+		return ierr.New(ierr.NotFound, fmt.Sprintf("contract not found: %s", addr))
+	}
+	m.registry.mu.Lock()
+	switch {
+	case c.Policy.DAOID != "" || caller != c.Owner:
+		m.registry.mu.Unlock()
+		return ierr.Wrap(ierr.Unauthorized, "only the owner may change the upgrade policy of a contract not governed by a DAO", ErrUpgradeUnauthorized)
+	case p.Timelock < c.Policy.Timelock:
+		m.registry.mu.Unlock()
+		return ierr.New(ierr.Invalid, fmt.Sprintf("timelock cannot be shortened below %s", c.Policy.Timelock))
+	case pendingUpgrade(c) != nil:
+		m.registry.mu.Unlock()
+		return ierr.Wrap(ierr.Conflict, "upgrade policy is fixed while an upgrade is pending", ErrUpgradePending)
+	}
+	c.Policy = p
+	snapshot := cloneContract(c)
+	m.registry.mu.Unlock()
+	m.registry.persistContract(snapshot)
+	return nil
+}
+
+// ProposeUpgrade validates new code for a contract and records it as a
+// pending version that activates once the policy's timelock has elapsed. An
+// upgrade without a timelock is activated immediately.
+func (m *ContractManager) ProposeUpgrade(ctx context.Context, addr string, req UpgradeRequest) (*ContractUpgrade, error) {
+	ctx, span := telemetry.Tracer("core.contracts").Start(ctx, "ContractManager.ProposeUpgrade")
+	defer span.End()
+
+	if len(req.WASM) == 0 {
+		return nil, ierr.New(ierr.Invalid, ErrWASMRequired.Error())
+	}
+	c, ok := m.registry.Get(addr)
+	if !ok {
+		return nil, ierr.New(ierr.NotFound, fmt.Sprintf("contract not found: %s", addr))
+	}
+	if err := validateManifest(req.Manifest); err != nil {
+		return nil, ierr.Wrap(ierr.Invalid, "invalid upgrade manifest", err)
+	}
+	if v, ok := m.registry.vm.(ModuleValidator); ok {
+		if err := v.Validate(req.WASM); err != nil {
+			return nil, ierr.Wrap(ierr.Invalid, "invalid upgrade code", err)
+		}
+	}
+	hash := codeHash(req.WASM)
+	now := m.now()
+
+	m.registry.mu.Lock()
+	if pendingUpgrade(c) != nil {
+		m.registry.mu.Unlock()
+		return nil, ierr.Wrap(ierr.Conflict, fmt.Sprintf("contract %s already has a pending upgrade", addr), ErrUpgradePending)
+	}
+	if err := m.authorizeUpgradeLocked(c, req, hash); err != nil {
+		m.registry.mu.Unlock()
+		return nil, err
+	}
+	manifest := req.Manifest
+	if strings.TrimSpace(manifest) == "" {
+		manifest = c.Manifest
+	}
+	if err := CheckStorageLayout(c.Manifest, manifest); err != nil {
+		m.registry.mu.Unlock()
+		return nil, ierr.Wrap(ierr.Invalid, "upgrade breaks the declared storage layout", err)
+	}
+	gasLimit := req.GasLimit
+	if gasLimit == 0 {
+		gasLimit = c.GasLimit
+	}
+	if len(c.Upgrades) == 0 {
+		c.Upgrades = []ContractUpgrade{{
+			Version:  1,
+			CodeHash: codeHash(c.WASM),
+			GasLimit: c.GasLimit,
+			Manifest: c.Manifest,
+			Status:   UpgradeActive,
+		}}
+	}
+	c.Upgrades = append(c.Upgrades, ContractUpgrade{
+		Version:    c.Upgrades[len(c.Upgrades)-1].Version + 1,
+		CodeHash:   hash,
+		GasLimit:   gasLimit,
+		Manifest:   manifest,
+		ProposedBy: req.Caller,
+		ProposalID: req.ProposalID,
+		ProposedAt: now.Unix(),
+		ActivateAt: now.Add(c.Policy.Timelock).Unix(),
+		Status:     UpgradePending,
+		WASM:       append([]byte(nil), req.WASM...),
+	})
+	timelocked := c.Policy.Timelock > 0
+	snapshot := cloneContract(c)
+	m.registry.mu.Unlock()
+	m.registry.persistContract(snapshot)
+	if !timelocked {
+		return m.ActivateUpgrade(ctx, addr)
+	}
+	up := snapshot.Upgrades[len(snapshot.Upgrades)-1]
+	return &up, nil
+}
+
+// authorizeUpgradeLocked checks that req may upgrade c to code with the given
+// hash under the contract's policy.
+func (m *ContractManager) authorizeUpgradeLocked(c *Contract, req UpgradeRequest, hash string) error {
+	if c.Policy.DAOID == "" {
+		if req.Caller != c.Owner {
+			return ierr.Wrap(ierr.Unauthorized, fmt.Sprintf("only the owner may upgrade contract %s", c.Address), ErrUpgradeUnauthorized)
+		}
+		return nil
+	}
+	if m.proposals == nil || req.ProposalID == "" {
+		return ierr.Wrap(ierr.Unauthorized, fmt.Sprintf("upgrading contract %s requires a proposal of DAO %s", c.Address, c.Policy.DAOID), ErrUpgradeUnauthorized)
+	}
+	p, err := m.proposals.Get(req.ProposalID)
+	if err != nil {
+		return ierr.Wrap(ierr.NotFound, fmt.Sprintf("proposal %s", req.ProposalID), err)
+	}
+	if p.DAOID != c.Policy.DAOID || !strings.Contains(p.Desc, hash) {
+		return ierr.Wrap(ierr.Unauthorized, fmt.Sprintf("proposal %s of DAO %s does not approve code %s", p.ID, p.DAOID, hash), ErrUpgradeUnauthorized)
+	}
+	for _, u := range c.Upgrades {
+		if u.ProposalID == req.ProposalID {
+			return ierr.Wrap(ierr.Conflict, fmt.Sprintf("proposal %s was already used", p.ID), ErrUpgradeUnauthorized)
+		}
+	}
+	yes, no, err := m.proposals.Results(p.ID)
+	if err != nil {
+		return ierr.Wrap(ierr.NotFound, fmt.Sprintf("proposal %s", p.ID), err)
+	}
+	if yes == 0 || yes <= no {
+		return ierr.Wrap(ierr.Unauthorized, fmt.Sprintf("proposal %s has not passed", p.ID), ErrUpgradeUnauthorized)
+	}
+	return nil
+}
+
+// ActivateUpgrade switches a contract to its pending version once the
+// timelock has elapsed. Anyone may activate an upgrade.
+func (m *ContractManager) ActivateUpgrade(ctx context.Context, addr string) (*ContractUpgrade, error) {
+	ctx, span := telemetry.Tracer("core.contracts").Start(ctx, "ContractManager.ActivateUpgrade")
+	defer span.End()
+
+	c, ok := m.registry.Get(addr)
+	if !ok {
+		return nil, ierr.New(ierr.NotFound, fmt.Sprintf("contract not found: %s", addr))
+	}
+	now := m.now().Unix()
+	m.registry.mu.Lock()
+	up := pendingUpgrade(c)
+	if up == nil {
+		m.registry.mu.Unlock()
+		return nil, ierr.Wrap(ierr.Conflict, fmt.Sprintf("contract %s has no pending upgrade", addr), ErrNoPendingUpgrade)
+	}
+	if now < up.ActivateAt {
+		m.registry.mu.Unlock()
+		return nil, ierr.Wrap(ierr.Conflict, fmt.Sprintf("upgrade of %s activates at %s", addr, time.Unix(up.ActivateAt, 0).UTC().Format(time.RFC3339)), ErrUpgradeTimelocked)
+	}
+	for i := range c.Upgrades {
+		if c.Upgrades[i].Status == UpgradeActive {
+			c.Upgrades[i].Status = UpgradeSuperseded
+		}
+	}
+	c.WASM = up.WASM
+	c.GasLimit = up.GasLimit
+	c.Manifest = up.Manifest
+	c.Version = up.Version
+	up.WASM = nil
+	up.Status = UpgradeActive
+	up.ActivatedAt = now
+	activated := *up
+	snapshot := cloneContract(c)
+	m.registry.mu.Unlock()
+	m.registry.persistContract(snapshot)
+	m.registry.emit(ContractRegistryEvent{
+		Type:     ContractRegistryEventUpgrade,
+		Contract: snapshot,
+		Caller:   activated.ProposedBy,
+		GasLimit: snapshot.GasLimit,
+	})
+	return &activated, nil
+}
+
+// CancelUpgrade drops a contract's pending upgrade. The owner or the account
+// that proposed the upgrade may cancel it.
+func (m *ContractManager) CancelUpgrade(ctx context.Context, addr, caller string) error {
+	ctx, span := telemetry.Tracer("core.contracts").Start(ctx, "ContractManager.CancelUpgrade")
+	defer span.End()
+
+	c, ok := m.registry.Get(addr)
+	if !ok {
+		return ierr.New(ierr.NotFound, fmt.Sprintf("contract not found: %s", addr))
+	}
+	m.registry.mu.Lock()
+	up := pendingUpgrade(c)
+	switch {
+	case up == nil:
+		m.registry.mu.Unlock()
+		return ierr.Wrap(ierr.Conflict, fmt.Sprintf("contract %s has no pending upgrade", addr), ErrNoPendingUpgrade)
+	case caller != c.Owner && caller != up.ProposedBy:
+		m.registry.mu.Unlock()
+		return ierr.Wrap(ierr.Unauthorized, "only the owner or the proposer may cancel an upgrade", ErrUpgradeUnauthorized)
+	}
+	up.WASM = nil
+	up.Status = UpgradeCancelled
+	snapshot := cloneContract(c)
+	m.registry.mu.Unlock()
+	m.registry.persistContract(snapshot)
+	return nil
+}
+
+// UpgradeHistory returns every version of a contract's code, oldest first.
+// Contracts that were never upgraded report their deployed code as version 1.
+func (m *ContractManager) UpgradeHistory(ctx context.Context, addr string) ([]ContractUpgrade, error) {
+	ctx, span := telemetry.Tracer("core.contracts").Start(ctx, "ContractManager.UpgradeHistory")
+	defer span.End()
+
+	c, ok := m.registry.Get(addr)
+	if !ok {
+		return nil, ierr.New(ierr.NotFound, fmt.Sprintf("contract not found: %s", addr))
+	}
+	m.registry.mu.RLock()
+	defer m.registry.mu.RUnlock()
+	if len(c.Upgrades) == 0 {
+		return []ContractUpgrade{{Version: 1, CodeHash: codeHash(c.WASM), GasLimit: c.GasLimit, Manifest: c.Manifest, Status: UpgradeActive}}, nil
+	}
+	out := make([]ContractUpgrade, len(c.Upgrades))
+	for i, u := range c.Upgrades {
+		u.WASM = nil
+		out[i] = u
+	}
+	return out, nil
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContractUpgradeTimelock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Credit("owner", 1_000)
+	vm := NewSimpleVM()
+	_ = vm.Start()
+	obs := &recordingObserver{}
+	reg := NewContractRegistry(vm, l, WithContractRegistryObserver(obs))
+	addr, err := reg.Deploy([]byte{0x01}, "", 5, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	mgr := NewContractManager(reg, WithContractManagerClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	if err := mgr.SetUpgradePolicy(ctx, addr, "mallory", UpgradePolicy{Timelock: time.Hour}); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("expected unauthorized policy change, got %v", err)
+	}
+	if err := mgr.SetUpgradePolicy(ctx, addr, "owner", UpgradePolicy{Timelock: time.Hour}); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	if err := mgr.SetUpgradePolicy(ctx, addr, "owner", UpgradePolicy{Timelock: time.Minute}); err == nil {
+		t.Fatalf("timelock must not be shortened")
+	}
+	if err := mgr.Upgrade(ctx, addr, []byte{0x02}, 0); !errors.Is(err, ErrUpgradeTimelocked) {
+		t.Fatalf("direct upgrade must respect the timelock, got %v", err)
+	}
+	if _, err := mgr.ProposeUpgrade(ctx, addr, UpgradeRequest{Caller: "mallory", WASM: []byte{0x02}}); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("expected unauthorized proposal, got %v", err)
+	}
+	up, err := mgr.ProposeUpgrade(ctx, addr, UpgradeRequest{Caller: "owner", WASM: []byte{0x02}, GasLimit: 7})
+	if err != nil || up.Version != 2 || up.Status != UpgradePending || up.ActivateAt != now.Add(time.Hour).Unix() {
+		t.Fatalf("propose: %+v %v", up, err)
+	}
+	if _, err := mgr.ProposeUpgrade(ctx, addr, UpgradeRequest{Caller: "owner", WASM: []byte{0x03}}); !errors.Is(err, ErrUpgradePending) {
+		t.Fatalf("expected pending upgrade, got %v", err)
+	}
+	if _, err := mgr.ActivateUpgrade(ctx, addr); !errors.Is(err, ErrUpgradeTimelocked) {
+		t.Fatalf("expected timelocked activation, got %v", err)
+	}
+	if c, _ := mgr.Info(ctx, addr); !bytes.Equal(c.WASM, []byte{0x01}) || c.Version != 1 {
+		t.Fatalf("pending upgrade must not change the code: %+v", c)
+	}
+
+	now = now.Add(time.Hour)
+	active, err := mgr.ActivateUpgrade(ctx, addr)
+	if err != nil || active.Status != UpgradeActive || active.ActivatedAt != now.Unix() {
+		t.Fatalf("activate: %+v %v", active, err)
+	}
+	if c, _ := mgr.Info(ctx, addr); !bytes.Equal(c.WASM, []byte{0x02}) || c.Version != 2 || c.GasLimit != 7 {
+		t.Fatalf("upgrade not applied: %+v", c)
+	}
+	if _, err := mgr.ActivateUpgrade(ctx, addr); !errors.Is(err, ErrNoPendingUpgrade) {
+		t.Fatalf("expected no pending upgrade, got %v", err)
+	}
+
+	if _, err := mgr.ProposeUpgrade(ctx, addr, UpgradeRequest{Caller: "owner", WASM: []byte{0x03}}); err != nil {
+		t.Fatalf("second proposal: %v", err)
+	}
+	if err := mgr.CancelUpgrade(ctx, addr, "mallory"); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("expected unauthorized cancel, got %v", err)
+	}
+	if err := mgr.CancelUpgrade(ctx, addr, "owner"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if got := obs.Types(); len(got) != 2 || got[1] != ContractRegistryEventUpgrade {
+		t.Fatalf("unexpected events %v", got)
+	}
+
+	l.Close()
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	mgr = NewContractManager(NewContractRegistry(vm, reopened))
+	history, err := mgr.UpgradeHistory(ctx, addr)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("history: %+v %v", history, err)
+	}
+	want := []UpgradeStatus{UpgradeSuperseded, UpgradeActive, UpgradeCancelled}
+	for i, u := range history {
+		if u.Version != i+1 || u.Status != want[i] || u.WASM != nil {
+			t.Fatalf("history[%d] = %+v", i, u)
+		}
+	}
+	if history[1].CodeHash != codeHash([]byte{0x02}) {
+		t.Fatalf("unexpected code hash %s", history[1].CodeHash)
+	}
+	if c, _ := mgr.Info(ctx, addr); c.Version != 2 || c.Policy.Timelock != time.Hour {
+		t.Fatalf("version or policy not replayed: %+v", c)
+	}
+}
+
+func TestContractUpgradeDAOGovernance(t *testing.T) {
+	vm := NewSimpleVM()
+	_ = vm.Start()
+	l := NewLedger()
+	l.Credit("owner", 1_000)
+	reg := NewContractRegistry(vm, l)
+	addr, err := reg.Deploy([]byte{0x01}, "", 5, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	daos := NewDAOManager()
+	daos.AuthorizeRelayer("alice")
+	dao, err := daos.Create("upgraders", "alice")
+	if err != nil {
+		t.Fatalf("create dao: %v", err)
+	}
+	proposals := NewProposalManager()
+	mgr := NewContractManager(reg, WithUpgradeProposals(proposals))
+	ctx := context.Background()
+	if err := mgr.SetUpgradePolicy(ctx, addr, "owner", UpgradePolicy{DAOID: dao.ID}); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	if err := mgr.SetUpgradePolicy(ctx, addr, "owner", UpgradePolicy{}); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("owner must not revoke dao governance, got %v", err)
+	}
+	if err := mgr.Upgrade(ctx, addr, []byte{0x02}, 0); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("owner must not upgrade a dao governed contract, got %v", err)
+	}
+
+	wasm := []byte{0x02}
+	p, err := proposals.CreateProposal(dao, "alice", "upgrade to "+codeHash(wasm))
+	if err != nil {
+		t.Fatalf("proposal: %v", err)
+	}
+	req := UpgradeRequest{Caller: "alice", WASM: wasm, ProposalID: p.ID}
+	if _, err := mgr.ProposeUpgrade(ctx, addr, req); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("unvoted proposal must not authorise, got %v", err)
+	}
+	if err := proposals.Vote(dao, p.ID, "alice", 1, true); err != nil {
+		t.Fatalf("vote: %v", err)
+	}
+	other, _ := proposals.CreateProposal(dao, "alice", "unrelated")
+	_ = proposals.Vote(dao, other.ID, "alice", 1, true)
+	if _, err := mgr.ProposeUpgrade(ctx, addr, UpgradeRequest{Caller: "alice", WASM: wasm, ProposalID: other.ID}); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("proposal without the code hash must not authorise, got %v", err)
+	}
+	up, err := mgr.ProposeUpgrade(ctx, addr, req)
+	if err != nil || up.Status != UpgradeActive || up.ProposalID != p.ID {
+		t.Fatalf("dao upgrade: %+v %v", up, err)
+	}
+	if _, err := mgr.ProposeUpgrade(ctx, addr, req); !errors.Is(err, ErrUpgradeUnauthorized) {
+		t.Fatalf("proposal must not be reused, got %v", err)
+	}
+}
+
+func TestCheckStorageLayout(t *testing.T) {
+	v1 := `{"storage_layout":[{"name":"balances","prefix":"b/","type":"u64"}]}`
+	cases := []struct {
+		name     string
+		next     string
+		wantFail bool
+	}{
+		{"unchanged", v1, false},
+		{"appended", `{"storage_layout":[{"name":"balances","prefix":"b/","type":"u64"},{"name":"owner","prefix":"o","type":"address"}]}`, false},
+		{"removed", `{"storage_layout":[]}`, true},
+		{"moved", `{"storage_layout":[{"name":"balances","prefix":"bal/","type":"u64"}]}`, true},
+		{"retyped", `{"storage_layout":[{"name":"balances","prefix":"b/","type":"u128"}]}`, true},
+		{"overlapping", `{"storage_layout":[{"name":"balances","prefix":"b/","type":"u64"},{"name":"bonus","prefix":"b/x","type":"u64"}]}`, true},
+	}
+	for _, tc := range cases {
+		err := CheckStorageLayout(v1, tc.next)
+		if tc.wantFail != errors.Is(err, ErrStorageLayoutIncompatible) {
+			t.Fatalf("%s: unexpected result %v", tc.name, err)
+		}
+	}
+	if err := CheckStorageLayout("", v1); err != nil {
+		t.Fatalf("contracts without a layout may adopt one: %v", err)
+	}
+
+	vm := NewSimpleVM()
+	_ = vm.Start()
+	reg := NewContractRegistry(vm, nil)
+	addr, err := reg.Deploy([]byte{0x01}, v1, 5, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	mgr := NewContractManager(reg)
+	req := UpgradeRequest{Caller: "owner", WASM: []byte{0x02}, Manifest: cases[3].next}
+	if _, err := mgr.ProposeUpgrade(context.Background(), addr, req); !errors.Is(err, ErrStorageLayoutIncompatible) {
+		t.Fatalf("expected incompatible layout, got %v", err)
+	}
+	req.Manifest = ""
+	if _, err := mgr.ProposeUpgrade(context.Background(), addr, req); err != nil {
+		t.Fatalf("upgrade keeping the manifest: %v", err)
+	}
+	if c, _ := reg.Get(addr); c.Manifest != v1 {
+		t.Fatalf("manifest not kept: %s", c.Manifest)
+	}
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -8,17 +10,25 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
+
+	"synnergy/pkg/abi"
 )
 
 // Contract represents a deployed smart contract. It keeps minimal metadata
 // required by the CLI and other modules to manage and invoke contracts.
 type Contract struct {
-	Address  string // deterministic hash of the WASM bytecode
+	Address  string // derived from the deployer and its nonce or salt
 	Owner    string // creator/owner address
 	WASM     []byte // raw WASM bytecode
 	Manifest string // optional Ricardian manifest JSON
 	GasLimit uint64 // max gas allowed per invocation
 	Paused   bool   // whether execution is paused
+	Salt     []byte // deployment salt, empty for nonce-derived addresses
+	Version  int    // current code version, starting at 1
+
+	Policy   UpgradePolicy     // who may upgrade the code and with what delay
+	Upgrades []ContractUpgrade // code versions, empty until the first upgrade
 }
 
 // ContractRegistryEventType enumerates observable registry actions.
@@ -43,6 +53,7 @@ type ContractRegistryEvent struct {
 	GasLimit uint64
 	GasUsed  uint64
 	Err      error
+	Logs     []ContractLog
 }
 
 // ContractRegistryObserver consumes registry events for telemetry or auditing.
@@ -62,6 +73,12 @@ type VirtualMachine interface {
 	Status() bool
 }
 
+// ModuleValidator is implemented by virtual machines that can check bytecode
+// before it is deployed.
+type ModuleValidator interface {
+	Validate(wasm []byte) error
+}
+
 // ContractRegistry stores deployed contracts and offers helper methods for
 // deployment and invocation. It is safe for concurrent use.
 type ContractRegistry struct {
@@ -71,6 +88,9 @@ type ContractRegistry struct {
 	ledger       *Ledger
 	feeCollector string
 	observer     ContractRegistryObserver
+	state        contractState
+	nonces       map[string]uint64 // deployment nonces without a ledger
+	gasMargin    uint64            // percentage added to gas estimates
 }
 
 // WithContractRegistryObserver configures the registry to emit events.
@@ -103,8 +123,12 @@ func NewContractRegistry(vm VirtualMachine, ledger *Ledger, opts ...ContractRegi
 		vm:           vm,
 		ledger:       ledger,
 		feeCollector: contractFeeCollectorAddress(),
+		state:        &memContractState{},
+		nonces:       make(map[string]uint64),
+		gasMargin:    DefaultGasEstimateMargin,
 	}
 	if ledger != nil {
+		reg.state = ledger
 		for _, rec := range ledger.Contracts() {
 			wasm := make([]byte, len(rec.WASM))
 			copy(wasm, rec.WASM)
@@ -114,6 +138,12 @@ func NewContractRegistry(vm VirtualMachine, ledger *Ledger, opts ...ContractRegi
 				WASM:     wasm,
 				Manifest: rec.Manifest,
 				GasLimit: rec.GasLimit,
+				Salt:     rec.Salt,
+				Version:  max(rec.Version, 1),
+				Upgrades: cloneUpgrades(rec.Upgrades),
+			}
+			if rec.Policy != nil {
+				reg.contracts[rec.Address].Policy = *rec.Policy
 			}
 		}
 	}
@@ -125,21 +155,47 @@ func NewContractRegistry(vm VirtualMachine, ledger *Ledger, opts ...ContractRegi
 	return reg
 }
 
-// CompileWASM returns the input bytecode and its sha256 hash. In the full
-// implementation this would also convert WAT to WASM, but here we simply return
-// the bytes unmodified for deterministic builds.
+// CompileWASM validates a binary WebAssembly module and returns it with its
+// sha256 hash. Text-format sources must be assembled beforehand.
 func CompileWASM(src []byte) ([]byte, string, error) {
 	if len(src) == 0 {
 		return nil, "", errors.New("source bytecode is empty")
 	}
+	if _, err := decodeWASMModule(src); err != nil {
+		return nil, "", err
+	}
 	h := sha256.Sum256(src)
 	return src, hex.EncodeToString(h[:]), nil
 }
 
-// Deploy registers a new contract. The address is derived from the bytecode
-// hash. If a contract with the same address already exists an error is
-// returned.
+// Deploy registers a new contract owned by owner at the address derived from
+// owner and its account nonce, which the deployment consumes.
 func (r *ContractRegistry) Deploy(wasm []byte, manifest string, gasLimit uint64, owner string) (string, error) {
+	return r.deploy(wasm, manifest, gasLimit, owner, nil)
+}
+
+// DeployWithSalt registers a new contract at the address
+// ContractAddressWithSalt derives from owner, salt and the bytecode. Deploying
+// the same code with the same salt twice fails with ErrContractAlreadyExists.
+func (r *ContractRegistry) DeployWithSalt(wasm []byte, manifest string, gasLimit uint64, owner string, salt []byte) (string, error) {
+	if len(salt) == 0 {
+		return "", ErrSaltRequired
+	}
+	return r.deploy(wasm, manifest, gasLimit, owner, salt)
+}
+
+// NextAddress returns the address the next plain deployment by owner will
+// receive.
+func (r *ContractRegistry) NextAddress(owner string) string {
+	if r.ledger != nil {
+		return r.ledger.NextContractAddress(owner)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return ContractAddress(owner, r.nonces[owner])
+}
+
+func (r *ContractRegistry) deploy(wasm []byte, manifest string, gasLimit uint64, owner string, salt []byte) (string, error) {
 	if len(wasm) == 0 {
 		return "", ErrWASMRequired
 	}
@@ -149,14 +205,19 @@ func (r *ContractRegistry) Deploy(wasm []byte, manifest string, gasLimit uint64,
 	if err := validateManifest(manifest); err != nil {
 		return "", err
 	}
-	hash := sha256.Sum256(wasm)
-	addr := hex.EncodeToString(hash[:])
-
-	r.mu.RLock()
-	_, exists := r.contracts[addr]
-	r.mu.RUnlock()
-	if exists {
-		return "", fmt.Errorf("%w: %s", ErrContractAlreadyExists, addr)
+	if v, ok := r.vm.(ModuleValidator); ok {
+		if err := v.Validate(wasm); err != nil {
+			return "", err
+		}
+	}
+	if len(salt) > 0 {
+		addr := ContractAddressWithSalt(owner, salt, wasm)
+		r.mu.RLock()
+		_, exists := r.contracts[addr]
+		r.mu.RUnlock()
+		if exists {
+			return "", fmt.Errorf("%w: %s", ErrContractAlreadyExists, addr)
+		}
 	}
 	if r.ledger != nil && gasLimit > 0 {
 		if err := r.ledger.Transfer(owner, r.feeCollector, gasLimit, 0); err != nil {
@@ -166,29 +227,42 @@ func (r *ContractRegistry) Deploy(wasm []byte, manifest string, gasLimit uint64,
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, exists := r.contracts[addr]; exists {
-		if r.ledger != nil && gasLimit > 0 {
-			_ = r.ledger.Transfer(r.feeCollector, owner, gasLimit, 0)
+	rec := LedgerContract{
+		Owner:    owner,
+		Manifest: manifest,
+		GasLimit: gasLimit,
+		WASM:     bytes.Clone(wasm),
+		Salt:     bytes.Clone(salt),
+	}
+	if r.ledger != nil {
+		if err := r.ledger.CreateContract(&rec); err != nil {
+			if gasLimit > 0 {
+				_ = r.ledger.Transfer(r.feeCollector, owner, gasLimit, 0)
+			}
+			return "", err
+		}
+	} else {
+		if len(salt) > 0 {
+			rec.Address = ContractAddressWithSalt(owner, salt, wasm)
+		} else {
+			rec.Address = ContractAddress(owner, r.nonces[owner])
+		}
+		if _, exists := r.contracts[rec.Address]; exists {
+			return "", fmt.Errorf("%w: %s", ErrContractAlreadyExists, rec.Address)
+		}
+		if len(salt) == 0 {
+			r.nonces[owner]++
 		}
-		return "", fmt.Errorf("%w: %s", ErrContractAlreadyExists, addr)
 	}
-	wasmCopy := make([]byte, len(wasm))
-	copy(wasmCopy, wasm)
+	addr := rec.Address
 	r.contracts[addr] = &Contract{
 		Address:  addr,
 		Owner:    owner,
-		WASM:     wasmCopy,
+		WASM:     rec.WASM,
 		Manifest: manifest,
 		GasLimit: gasLimit,
-	}
-	if r.ledger != nil {
-		r.ledger.RegisterContract(LedgerContract{
-			Address:  addr,
-			Owner:    owner,
-			Manifest: manifest,
-			GasLimit: gasLimit,
-			WASM:     wasmCopy,
-		})
+		Salt:     rec.Salt,
+		Version:  1,
 	}
 	r.emit(ContractRegistryEvent{
 		Type:     ContractRegistryEventDeploy,
@@ -206,14 +280,107 @@ func (r *ContractRegistry) Invoke(addr, method string, args []byte, gasLimit uin
 // InvokeFrom executes a method on the specified contract, charging gas to the
 // supplied caller. When caller is empty the contract owner is billed.
 func (r *ContractRegistry) InvokeFrom(addr, caller, method string, args []byte, gasLimit uint64) ([]byte, uint64, error) {
+	return r.InvokeWithValue(addr, caller, method, args, 0, gasLimit)
+}
+
+// InvokeWithValue executes a method like InvokeFrom and transfers value from
+// the caller to the contract. The transfer, storage writes and nested calls
+// are journaled and committed together only if execution succeeds.
+func (r *ContractRegistry) InvokeWithValue(addr, caller, method string, args []byte, value, gasLimit uint64) ([]byte, uint64, error) {
+	rcpt, err := r.Call(addr, caller, method, args, value, gasLimit)
+	if rcpt == nil {
+		return nil, 0, err
+	}
+	return rcpt.ReturnData, rcpt.GasUsed, err
+}
+
+// Call executes a method like InvokeWithValue and returns the receipt of the
+// invocation. Every call that reaches execution has its receipt recorded on
+// the ledger; failed executions return a receipt with status ReceiptFailed
+// alongside the error, carrying the revert data as return data. The gas limit
+// is reserved from the payer's balance in the call's journal and only the gas
+// used is charged, together with the call's state changes; failed calls are
+// not charged.
+func (r *ContractRegistry) Call(addr, caller, method string, args []byte, value, gasLimit uint64) (*Receipt, error) {
+	c, payer, limit, err := r.callTarget(addr, caller, method, args, value, gasLimit)
+	if err != nil {
+		return nil, err
+	}
+	host := registryHost{r: r, j: newContractJournal(r.state)}
+	if r.ledger != nil {
+		if err := host.j.reserveGas(payer, r.feeCollector, limit); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrGasChargeFailed, err)
+		}
+	}
+	if err := host.Transfer(payer, addr, value); err != nil {
+		return nil, err
+	}
+	call := r.newCall(addr, payer, value, host)
+	out, used, err := r.execute(context.Background(), call, c, method, args, limit)
+	now := time.Now().Unix()
+	if err == nil {
+		rcpt := &Receipt{
+			Status:          ReceiptSuccess,
+			Timestamp:       now,
+			GasUsed:         used,
+			ContractAddress: addr,
+			ReturnData:      out,
+			Logs:            call.Logs,
+		}
+		host.j.settleGas(used)
+		if err = host.j.commit(rcpt); err == nil {
+			r.emit(ContractRegistryEvent{
+				Type:     ContractRegistryEventInvoke,
+				Contract: cloneContract(c),
+				Method:   method,
+				Caller:   payer,
+				GasLimit: limit,
+				GasUsed:  used,
+				Logs:     rcpt.Logs,
+			})
+			return rcpt, nil
+		}
+	}
+	rcpt := &Receipt{
+		Status:          ReceiptFailed,
+		Timestamp:       now,
+		Details:         err.Error(),
+		GasUsed:         used,
+		ContractAddress: addr,
+		ReturnData:      out,
+	}
+	var revert *RevertError
+	if errors.As(err, &revert) {
+		rcpt.ReturnData = revert.Data
+	}
+	_ = r.state.ApplyContractChanges(&ContractStateChanges{Receipt: rcpt})
+	r.emit(ContractRegistryEvent{
+		Type:     ContractRegistryEventInvokeFailed,
+		Contract: cloneContract(c),
+		Method:   method,
+		Caller:   payer,
+		GasLimit: limit,
+		GasUsed:  used,
+		Err:      err,
+	})
+	return rcpt, err
+}
+
+// callTarget resolves the contract a call of addr runs, the account paying
+// for it and the gas limit it runs with, and checks the call against the
+// contract's ABI.
+func (r *ContractRegistry) callTarget(addr, caller, method string, args []byte, value, gasLimit uint64) (*Contract, string, uint64, error) {
 	r.mu.RLock()
 	c, ok := r.contracts[addr]
 	r.mu.RUnlock()
 	if !ok {
-		return nil, 0, fmt.Errorf("%w: %s", ErrContractNotFound, addr)
+		return nil, "", 0, fmt.Errorf("%w: %s", ErrContractNotFound, addr)
 	}
 	if c.Paused {
-		return nil, 0, fmt.Errorf("%w: %s", ErrContractPaused, addr)
+		return nil, "", 0, fmt.Errorf("%w: %s", ErrContractPaused, addr)
+	}
+	if err := checkCall(c, method, args, value); err != nil {
+		return nil, "", 0, err
 	}
 	limit := gasLimit
 	if limit == 0 || limit > c.GasLimit {
@@ -223,42 +390,47 @@ func (r *ContractRegistry) InvokeFrom(addr, caller, method string, args []byte,
 	if payer == "" {
 		payer = c.Owner
 	}
-	if r.ledger != nil && limit > 0 {
-		if err := r.ledger.Transfer(payer, r.feeCollector, limit, 0); err != nil {
-			return nil, 0, fmt.Errorf("%w: %v", ErrGasChargeFailed, err)
+	return c, payer, limit, nil
+}
+
+// newCall returns the context of a top-level call of addr by payer at the
+// latest block.
+func (r *ContractRegistry) newCall(addr, payer string, value uint64, host ContractHost) *CallContext {
+	call := &CallContext{Contract: addr, Caller: payer, Origin: payer, Value: value, Host: host}
+	if r.ledger != nil {
+		height, _ := r.ledger.Head()
+		call.Height = uint64(height)
+		if b, ok := r.ledger.GetBlock(height); ok {
+			call.Time = b.Timestamp
 		}
 	}
-	out, used, err := r.vm.Execute(c.WASM, method, args, limit)
-	if err != nil {
-		if r.ledger != nil && limit > 0 {
-			_ = r.ledger.Transfer(r.feeCollector, payer, limit, 0)
-		}
-		r.emit(ContractRegistryEvent{
-			Type:     ContractRegistryEventInvokeFailed,
-			Contract: cloneContract(c),
-			Method:   method,
-			Caller:   payer,
-			GasLimit: limit,
-			GasUsed:  used,
-			Err:      err,
-		})
-		return out, used, err
-	}
-	if r.ledger != nil && used < limit {
-		refund := limit - used
-		if refund > 0 {
-			_ = r.ledger.Transfer(r.feeCollector, payer, refund, 0)
-		}
+	return call
+}
+
+// execute runs a contract method, exposing the host ABI when the VM
+// supports it. A method the contract's ABI declares view fails if it
+// changes state, including through nested calls.
+func (r *ContractRegistry) execute(ctx context.Context, call *CallContext, c *Contract, method string, args []byte, gasLimit uint64) ([]byte, uint64, error) {
+	h, journaled := call.Host.(registryHost)
+	view := journaled && isView(c, method)
+	var writes int
+	if view {
+		writes = h.j.writes()
 	}
-	r.emit(ContractRegistryEvent{
-		Type:     ContractRegistryEventInvoke,
-		Contract: cloneContract(c),
-		Method:   method,
-		Caller:   payer,
-		GasLimit: limit,
-		GasUsed:  used,
-	})
-	return out, used, nil
+	var (
+		out  []byte
+		used uint64
+		err  error
+	)
+	if vm, ok := r.vm.(HostVM); ok {
+		out, used, err = vm.ExecuteCall(ctx, call, c.WASM, method, args, gasLimit)
+	} else {
+		out, used, err = r.vm.Execute(c.WASM, method, args, gasLimit)
+	}
+	if err == nil && view && h.j.writes() != writes {
+		err = fmt.Errorf("%w: %s", ErrViewStateChange, method)
+	}
+	return out, used, err
 }
 
 // List returns all deployed contracts.
@@ -280,6 +452,23 @@ func (r *ContractRegistry) Get(addr string) (*Contract, bool) {
 	return c, ok
 }
 
+// Storage returns the committed value of a contract storage slot.
+func (r *ContractRegistry) Storage(addr string, key []byte) ([]byte, bool, error) {
+	if _, ok := r.Get(addr); !ok {
+		return nil, false, fmt.Errorf("%w: %s", ErrContractNotFound, addr)
+	}
+	v, ok := r.state.ContractStorage(addr, key)
+	return v, ok, nil
+}
+
+// StorageEntries returns the committed storage of a contract ordered by key.
+func (r *ContractRegistry) StorageEntries(addr string) ([]ContractStorageEntry, error) {
+	if _, ok := r.Get(addr); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, addr)
+	}
+	return r.state.ContractStorageEntries(addr), nil
+}
+
 func (r *ContractRegistry) emit(event ContractRegistryEvent) {
 	if r.observer == nil {
 		return
@@ -293,13 +482,21 @@ func (r *ContractRegistry) persistContract(c *Contract) {
 	}
 	wasmCopy := make([]byte, len(c.WASM))
 	copy(wasmCopy, c.WASM)
-	r.ledger.RegisterContract(LedgerContract{
+	rec := LedgerContract{
 		Address:  c.Address,
 		Owner:    c.Owner,
 		Manifest: c.Manifest,
 		GasLimit: c.GasLimit,
 		WASM:     wasmCopy,
-	})
+		Salt:     c.Salt,
+		Version:  c.Version,
+		Upgrades: cloneUpgrades(c.Upgrades),
+	}
+	if c.Policy != (UpgradePolicy{}) {
+		policy := c.Policy
+		rec.Policy = &policy
+	}
+	r.ledger.RegisterContract(rec)
 }
 
 func cloneContract(c *Contract) *Contract {
@@ -315,6 +512,10 @@ func cloneContract(c *Contract) *Contract {
 		Manifest: c.Manifest,
 		GasLimit: c.GasLimit,
 		Paused:   c.Paused,
+		Salt:     bytes.Clone(c.Salt),
+		Version:  c.Version,
+		Policy:   c.Policy,
+		Upgrades: cloneUpgrades(c.Upgrades),
 	}
 }
 
@@ -329,5 +530,8 @@ func validateManifest(manifest string) error {
 	if payload == nil {
 		return fmt.Errorf("%w: manifest cannot be null", ErrInvalidManifest)
 	}
+	if _, err := abi.FromManifest(manifest); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
 	return nil
 }
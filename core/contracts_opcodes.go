@@ -17,6 +17,12 @@ var (
 	OpContractInfo     = opcodeByName("ContractInfo")
 	OpDeployAIContract = opcodeByName("DeployAIContract")
 	OpInvokeAIContract = opcodeByName("InvokeAIContract")
+
+	OpProposeContractUpgrade   = opcodeByName("ProposeContractUpgrade")
+	OpActivateContractUpgrade  = opcodeByName("ActivateContractUpgrade")
+	OpCancelContractUpgrade    = opcodeByName("CancelContractUpgrade")
+	OpSetContractUpgradePolicy = opcodeByName("SetContractUpgradePolicy")
+	OpContractUpgradeHistory   = opcodeByName("ContractUpgradeHistory")
 )
 
 func opcodeByName(name string) Opcode {
@@ -25,8 +25,9 @@ func TestContractRegistry(t *testing.T) {
 	if string(out) != "hi" {
 		t.Fatalf("unexpected output: %q", out)
 	}
-	if _, err := reg.Deploy(wasm, "", 10, "owner"); err == nil {
-		t.Fatalf("expected duplicate deploy error")
+	again, err := reg.Deploy(wasm, "", 10, "owner")
+	if err != nil || again == addr {
+		t.Fatalf("redeploying the same code must yield a new address: %s %v", again, err)
 	}
 	if _, ok := reg.Get("missing"); ok {
 		t.Fatalf("expected missing contract")
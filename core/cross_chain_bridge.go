@@ -182,8 +182,7 @@ func (m *BridgeManager) Deposit(bridgeID int, from, to string, amount uint64, to
 	if m.ledger == nil {
 		return 0, errors.New("ledger not configured")
 	}
-	tx := &Transaction{From: from, To: "bridge_escrow", Amount: amount}
-	if err := m.ledger.ApplyTransaction(tx); err != nil {
+	if err := m.ledger.Transfer(from, "bridge_escrow", amount, 0); err != nil {
 		return 0, err
 	}
 	m.nextTransferID++
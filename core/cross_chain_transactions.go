@@ -72,8 +72,7 @@ func (m *CrossChainTxManager) LockMint(bridgeID int, from, to, assetID string, a
 	if !m.relayers[from] {
 		return 0, errors.New("unauthorized relayer")
 	}
-	tx := &Transaction{From: from, To: "lockmint_escrow", Amount: amount}
-	if err := m.ledger.ApplyTransaction(tx); err != nil {
+	if err := m.ledger.Transfer(from, "lockmint_escrow", amount, 0); err != nil {
 		return 0, err
 	}
 	m.ledger.Credit(to, amount)
@@ -93,8 +92,7 @@ func (m *CrossChainTxManager) BurnRelease(bridgeID int, from, to, assetID string
 	if !m.relayers[from] {
 		return 0, errors.New("unauthorized relayer")
 	}
-	tx := &Transaction{From: from, To: "burn_vault", Amount: amount}
-	if err := m.ledger.ApplyTransaction(tx); err != nil {
+	if err := m.ledger.Transfer(from, "burn_vault", amount, 0); err != nil {
 		return 0, err
 	}
 	m.ledger.Credit(to, amount)
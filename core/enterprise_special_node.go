@@ -406,7 +406,7 @@ func EnterpriseNodePluginFromNode(id string, role CombinedNodeRole, node *Node,
 	if node != nil {
 		plugin.Metrics = func() CombinedNodeMetrics {
 			node.mu.Lock()
-			mempool := len(node.Mempool)
+			mempool := node.Mempool.Len()
 			height := len(node.Blockchain)
 			node.mu.Unlock()
 			validators := 0
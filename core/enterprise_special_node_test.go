@@ -38,6 +38,7 @@ func TestEnterpriseSpecialNodeAttachSnapshot(t *testing.T) {
 }
 
 func TestEnterpriseSpecialNodeBroadcastAndLedger(t *testing.T) {
+	alice := testWallet(t, "alice")
 	agg := NewEnterpriseSpecialNode(nodes.Address("agg-broadcast"))
 	if err := agg.Start(); err != nil {
 		t.Fatalf("start: %v", err)
@@ -45,8 +46,8 @@ func TestEnterpriseSpecialNodeBroadcastAndLedger(t *testing.T) {
 
 	ledgerA := NewLedger()
 	ledgerB := NewLedger()
-	ledgerA.Mint("alice", 150)
-	ledgerB.Mint("alice", 90)
+	ledgerA.Mint(alice.Address, 150)
+	ledgerB.Mint(alice.Address, 90)
 
 	nodeA := NewNode("node-a", "addr-a", ledgerA)
 	nodeB := NewNode("node-b", "addr-b", ledgerB)
@@ -58,7 +59,7 @@ func TestEnterpriseSpecialNodeBroadcastAndLedger(t *testing.T) {
 		t.Fatalf("attach node-b: %v", err)
 	}
 
-	tx := NewTransaction("alice", "bob", 10, 1, 0)
+	tx := signedTestTx(t, alice, "bob", 10, 1, 0)
 	results, err := agg.BroadcastTransaction(tx)
 	if err != nil {
 		t.Fatalf("broadcast: %v", err)
@@ -72,14 +73,14 @@ func TestEnterpriseSpecialNodeBroadcastAndLedger(t *testing.T) {
 		}
 	}
 
-	if len(nodeA.Mempool) != 1 {
-		t.Fatalf("expected nodeA mempool 1, got %d", len(nodeA.Mempool))
+	if nodeA.Mempool.Len() != 1 {
+		t.Fatalf("expected nodeA mempool 1, got %d", nodeA.Mempool.Len())
 	}
-	if len(nodeB.Mempool) != 1 {
-		t.Fatalf("expected nodeB mempool 1, got %d", len(nodeB.Mempool))
+	if nodeB.Mempool.Len() != 1 {
+		t.Fatalf("expected nodeB mempool 1, got %d", nodeB.Mempool.Len())
 	}
 
-	if bal := agg.LedgerBalance("alice"); bal != 240 {
+	if bal := agg.LedgerBalance(alice.Address); bal != 240 {
 		t.Fatalf("expected aggregated balance 240, got %d", bal)
 	}
 }
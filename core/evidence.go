@@ -0,0 +1,252 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Validators are slashed on evidence rather than on accusation. Double-sign
+// evidence carries two conflicting votes or sub-blocks the validator signed
+// for one height. Downtime evidence names a window of consecutive blocks, and
+// is proven by the liveness records of the chain itself: blocks carry the
+// finality votes their proposer received for recent blocks, late votes
+// included, and the ledger records which validators signed each block. Once
+// no more votes for the window can be recorded, a validator with too few
+// records in it was offline. Every node checks evidence before it enters a
+// block, and the ledger checks it again when the block is applied: evidence
+// older than EvidenceParams.MaxAge is rejected, and the same offence is never
+// committed twice. Validators are slashed in block order once a block carrying
+// evidence is added, downtime less severely than double-signing.
+
+// Evidence kinds.
+const (
+	EvidenceDoubleSign = "double-sign"
+	EvidenceDowntime   = "downtime"
+)
+
+var (
+	// ErrInvalidEvidence is returned for evidence that does not prove the
+	// offence it claims.
+	ErrInvalidEvidence = errors.New("invalid evidence")
+	// ErrDuplicateEvidence is returned for evidence of an offence that was
+	// already punished.
+	ErrDuplicateEvidence = errors.New("duplicate evidence")
+	// ErrEvidenceExpired is returned for evidence older than the maximum
+	// evidence age.
+	ErrEvidenceExpired = errors.New("evidence expired")
+)
+
+// Fractions of an offender's stake slashing burns, in basis points.
+const (
+	DoubleSignSlash = 5_000
+	DowntimeSlash   = 100
+)
+
+// EvidenceParams bound the evidence a chain accepts.
+type EvidenceParams struct {
+	// MaxAge is the number of blocks after an offence during which evidence
+	// of it can be included.
+	MaxAge int `json:"max_age"`
+	// DowntimeWindow is the number of consecutive blocks downtime evidence
+	// covers.
+	DowntimeWindow int `json:"downtime_window"`
+	// DowntimeMinSigned is the number of blocks in the window a validator must
+	// sign to be considered live.
+	DowntimeMinSigned int `json:"downtime_min_signed"`
+	// LivenessGrace is the number of blocks after the one following a block
+	// during which votes for it can still be recorded. Downtime evidence is
+	// accepted only once the grace of the last block of its window is over.
+	LivenessGrace int `json:"liveness_grace"`
+}
+
+// DefaultEvidenceParams returns the evidence parameters ledgers use unless
+// configured otherwise.
+func DefaultEvidenceParams() EvidenceParams {
+	return EvidenceParams{MaxAge: 1000, DowntimeWindow: 100, DowntimeMinSigned: 50, LivenessGrace: 10}
+}
+
+// Evidence proves that a validator misbehaved. Height is the height of the
+// offence: that of the conflicting votes or sub-blocks, or the last block of
+// a downtime window.
+type Evidence struct {
+	Kind      string      `json:"kind"`
+	Validator string      `json:"validator"`
+	Height    uint64      `json:"height"`
+	Votes     []Vote      `json:"votes,omitempty"`
+	SubBlocks []*SubBlock `json:"sub_blocks,omitempty"`
+}
+
+// NewVoteEvidence returns double-sign evidence from an equivocation.
+func NewVoteEvidence(eq Equivocation) *Evidence {
+	return &Evidence{
+		Kind:      EvidenceDoubleSign,
+		Validator: eq.Validator(),
+		Height:    eq.First.Height,
+		Votes:     []Vote{eq.First, eq.Second},
+	}
+}
+
+// NewSubBlockEvidence returns double-sign evidence from two different
+// sub-blocks a validator signed for the same height.
+func NewSubBlockEvidence(a, b *SubBlock) (*Evidence, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("%w: two sub-blocks required", ErrInvalidEvidence)
+	}
+	ev := &Evidence{
+		Kind:      EvidenceDoubleSign,
+		Validator: a.Validator,
+		Height:    a.Height,
+		SubBlocks: []*SubBlock{a, b},
+	}
+	if err := ev.Validate(EvidenceParams{}); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// NewDowntimeEvidence returns evidence that validator was offline during the
+// downtime window ending with the block at height. The ledger's liveness
+// records prove or refute it.
+func NewDowntimeEvidence(validator string, height uint64) *Evidence {
+	return &Evidence{Kind: EvidenceDowntime, Validator: validator, Height: height}
+}
+
+// ID identifies the offence the evidence proves. Evidence of the same
+// offence shares an ID however it was assembled.
+func (e *Evidence) ID() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", e.Kind, e.Validator, e.Height)))
+	return hex.EncodeToString(sum[:])
+}
+
+// WindowStart returns the first height downtime evidence covers under p, or
+// the offence height for double-sign evidence.
+func (e *Evidence) WindowStart(p EvidenceParams) uint64 {
+	if e.Kind == EvidenceDowntime && p.DowntimeWindow > 0 && e.Height >= uint64(p.DowntimeWindow) {
+		return e.Height - uint64(p.DowntimeWindow) + 1
+	}
+	return e.Height
+}
+
+// SlashFraction returns the basis points of the offender's stake the
+// evidence burns.
+func (e *Evidence) SlashFraction() uint64 {
+	if e.Kind == EvidenceDowntime {
+		return DowntimeSlash
+	}
+	return DoubleSignSlash
+}
+
+// Validate checks the evidence on its own: signatures, the conflict between
+// double-signed messages and the shape of a downtime window under p. It does
+// not check the validator sets involved, see Verify, nor whether a downtime
+// window was missed, which only the ledger's liveness records tell.
+func (e *Evidence) Validate(p EvidenceParams) error {
+	if e == nil {
+		return fmt.Errorf("%w: evidence required", ErrInvalidEvidence)
+	}
+	if e.Validator == "" {
+		return fmt.Errorf("%w: validator required", ErrInvalidEvidence)
+	}
+	switch e.Kind {
+	case EvidenceDoubleSign:
+		return e.validateDoubleSign()
+	case EvidenceDowntime:
+		return e.validateDowntime(p)
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidEvidence, e.Kind)
+	}
+}
+
+func (e *Evidence) validateDoubleSign() error {
+	switch {
+	case len(e.Votes) == 2 && len(e.SubBlocks) == 0:
+		eq := Equivocation{First: e.Votes[0], Second: e.Votes[1]}
+		if eq.Validator() != e.Validator || eq.First.Height != e.Height {
+			return fmt.Errorf("%w: votes are not from %s at height %d", ErrInvalidEvidence, e.Validator, e.Height)
+		}
+		if err := eq.Verify(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+		}
+		return nil
+	case len(e.SubBlocks) == 2 && len(e.Votes) == 0:
+		a, b := e.SubBlocks[0], e.SubBlocks[1]
+		if a == nil || b == nil {
+			return fmt.Errorf("%w: two sub-blocks required", ErrInvalidEvidence)
+		}
+		if e.Height == 0 || a.Height != e.Height || b.Height != e.Height {
+			return fmt.Errorf("%w: sub-blocks are not both for height %d", ErrInvalidEvidence, e.Height)
+		}
+		if a.Validator != e.Validator || b.Validator != e.Validator {
+			return fmt.Errorf("%w: sub-blocks are not both from %s", ErrInvalidEvidence, e.Validator)
+		}
+		if a.PohHash == b.PohHash {
+			return fmt.Errorf("%w: sub-blocks are identical", ErrInvalidEvidence)
+		}
+		for _, sb := range e.SubBlocks {
+			if sb.System || sb.PohHash != sb.Hash() || !sb.VerifySignature() {
+				return fmt.Errorf("%w: sub-block %s is not signed by %s", ErrInvalidEvidence, sb.PohHash, e.Validator)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: double-sign evidence needs two votes or two sub-blocks", ErrInvalidEvidence)
+	}
+}
+
+func (e *Evidence) validateDowntime(p EvidenceParams) error {
+	if len(e.Votes) != 0 || len(e.SubBlocks) != 0 {
+		return fmt.Errorf("%w: downtime evidence carries no votes or sub-blocks", ErrInvalidEvidence)
+	}
+	if p.DowntimeWindow <= 0 || e.Height < uint64(p.DowntimeWindow) {
+		return fmt.Errorf("%w: no %d block window ends at height %d", ErrInvalidEvidence, p.DowntimeWindow, e.Height)
+	}
+	return nil
+}
+
+// Verify validates the evidence and checks it against the validator sets
+// validators returns: the offender must have been a validator at every height
+// involved.
+func (e *Evidence) Verify(p EvidenceParams, validators func(height uint64) ValidatorSet) error {
+	if err := e.Validate(p); err != nil {
+		return err
+	}
+	if e.Kind == EvidenceDoubleSign {
+		if validators(e.Height)[e.Validator] == 0 {
+			return fmt.Errorf("%w: %s is not a validator at height %d", ErrInvalidEvidence, e.Validator, e.Height)
+		}
+		return nil
+	}
+	for h := e.WindowStart(p); h <= e.Height; h++ {
+		if validators(h)[e.Validator] == 0 {
+			return fmt.Errorf("%w: %s is not a validator at height %d", ErrInvalidEvidence, e.Validator, h)
+		}
+	}
+	return nil
+}
+
+// slashKept returns what is left of stake after burning bps basis points.
+func slashKept(stake, bps uint64) uint64 {
+	keep := 10_000 - min(bps, 10_000)
+	return stake/10_000*keep + stake%10_000*keep/10_000
+}
+
+// EvidenceRoot returns the digest a block header commits to for its
+// evidence, or "" when there is none.
+func EvidenceRoot(evidence []Evidence) string {
+	if len(evidence) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for i := range evidence {
+		data, err := json.Marshal(&evidence[i])
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// evidenceChain is a node whose proposer signs every block it mines.
+type evidenceChain struct {
+	node     *Node
+	alice    *Wallet
+	proposer *Wallet
+	nonce    uint64
+}
+
+func newEvidenceChain(t *testing.T, opts ...LedgerOption) *evidenceChain {
+	t.Helper()
+	l, err := OpenLedger("", opts...)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	c := &evidenceChain{node: NewNode("n1", "addr", l), alice: testWallet(t, "alice")}
+	l.Credit(c.alice.Address, 1_000)
+	c.proposer = registerTestValidator(t)
+	if err := c.node.RegisterValidatorWallet(c.proposer); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := c.node.SetStake(c.proposer.Address, 1_000_000); err != nil {
+		t.Fatalf("stake: %v", err)
+	}
+	return c
+}
+
+// oneBlockEpochs makes the stake bonded in a block count towards the
+// validator set from the next block on.
+var oneBlockEpochs = WithStakingParams(StakingParams{EpochLength: 1, UnbondingPeriod: 10})
+
+// bond credits each wallet with its stake and mines a block bonding it, so
+// that the ledger records the wallets as validators from the next block on
+// when epochs are one block long.
+func (c *evidenceChain) bond(t *testing.T, stakes map[*Wallet]uint64) *Block {
+	t.Helper()
+	for w, amount := range stakes {
+		c.node.Ledger.Credit(w.Address, amount)
+		if err := c.node.AddTransaction(signedStakeTx(t, w, TxTypeBond, amount, 0)); err != nil {
+			t.Fatalf("bond: %v", err)
+		}
+	}
+	return c.mine(t)
+}
+
+// mine mines a block carrying one transfer and the pending evidence.
+func (c *evidenceChain) mine(t *testing.T) *Block {
+	t.Helper()
+	if err := c.node.AddTransaction(signedTestTx(t, c.alice, "bob", 1, 0, c.nonce)); err != nil {
+		t.Fatalf("add tx: %v", err)
+	}
+	c.nonce++
+	b := c.node.MineBlock()
+	if b == nil {
+		t.Fatalf("block not mined")
+	}
+	return b
+}
+
+// equivocate returns double-sign evidence of w voting for two blocks.
+func equivocate(t *testing.T, w *Wallet, height uint64) *Evidence {
+	t.Helper()
+	a, err := SignVote(w, height, "blockA", 0)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	b, _ := SignVote(w, height, "blockB", 0)
+	return NewVoteEvidence(Equivocation{First: *a, Second: *b})
+}
+
+func TestDoubleSignEvidenceSlashesOnce(t *testing.T) {
+	c := newEvidenceChain(t, oneBlockEpochs)
+	offender, _ := NewWallet()
+	c.bond(t, map[*Wallet]uint64{c.proposer: 1_000_000, offender: 1_000})
+	c.mine(t)
+
+	forged := equivocate(t, offender, 2)
+	forged.Votes[1].BlockHash = "blockC"
+	if err := c.node.ReportDoubleSign(forged); !errors.Is(err, ErrInvalidVote) && !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected forged evidence to fail, got %v", err)
+	}
+	if err := c.node.ReportDoubleSign(&Evidence{Kind: EvidenceDoubleSign, Validator: offender.Address}); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("bare accusations must fail, got %v", err)
+	}
+	ev := equivocate(t, offender, 2)
+	if err := c.node.ReportDowntime(ev); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected a kind mismatch, got %v", err)
+	}
+	if err := c.node.ReportDoubleSign(ev); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if err := c.node.ReportDoubleSign(equivocate(t, offender, 2)); !errors.Is(err, ErrDuplicateEvidence) {
+		t.Fatalf("expected pending duplicate, got %v", err)
+	}
+	if _, ok := c.node.Validators.Eligible()[offender.Address]; !ok {
+		t.Fatalf("validator slashed before the evidence was included")
+	}
+
+	b := c.mine(t)
+	if len(b.Evidence) != 1 || b.Header(0).EvidenceRoot == "" {
+		t.Fatalf("evidence not included: %+v", b.Evidence)
+	}
+	if _, ok := c.node.Validators.Eligible()[offender.Address]; ok {
+		t.Fatalf("offender still eligible")
+	}
+	if !c.node.Ledger.HasEvidence(ev) || len(c.node.PendingEvidence()) != 0 {
+		t.Fatalf("evidence not committed")
+	}
+
+	// a block repeating committed evidence is rejected by every ledger
+	c.node.Rehabilitate(offender.Address)
+	again := reorgTestBlock(t, b, c.proposer)
+	again.Evidence = []Evidence{*equivocate(t, offender, 2)}
+	again.Hash = again.HeaderHash(again.Nonce)
+	if err := c.node.Ledger.AddBlock(again); !errors.Is(err, ErrDuplicateEvidence) {
+		t.Fatalf("expected ErrDuplicateEvidence, got %v", err)
+	}
+	stake := c.node.Validators.Stake(offender.Address)
+	if c.node.Validators.ApplyEvidence(context.Background(), ev) || c.node.Validators.Stake(offender.Address) != stake {
+		t.Fatalf("the same offence slashed twice")
+	}
+}
+
+func TestSubBlockDoubleSignEvidence(t *testing.T) {
+	w := registerTestValidator(t)
+	tx := NewTransaction("a", "b", 1, 0, 0)
+	a := NewSubBlockAt([]*Transaction{tx}, w.Address, 4)
+	b := NewSubBlockAt([]*Transaction{tx, NewTransaction("a", "c", 1, 0, 1)}, w.Address, 4)
+	ev, err := NewSubBlockEvidence(a, b)
+	if err != nil || ev.Height != 4 {
+		t.Fatalf("evidence: %+v %v", ev, err)
+	}
+	if err := ev.Verify(EvidenceParams{}, func(uint64) ValidatorSet { return ValidatorSet{w.Address: 1} }); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := ev.Verify(EvidenceParams{}, func(uint64) ValidatorSet { return nil }); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected an offender outside the set to fail, got %v", err)
+	}
+	// the signature commits to the height
+	other := NewSubBlockAt([]*Transaction{tx}, w.Address, 5)
+	other.Height = 4
+	if _, err := NewSubBlockEvidence(a, other); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected a relabelled sub-block to fail, got %v", err)
+	}
+	if _, err := NewSubBlockEvidence(a, a); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected identical sub-blocks to fail, got %v", err)
+	}
+}
+
+func TestDowntimeEvidence(t *testing.T) {
+	params := EvidenceParams{MaxAge: 5, DowntimeWindow: 2, DowntimeMinSigned: 1, LivenessGrace: 1}
+	c := newEvidenceChain(t, WithEvidenceParams(params), oneBlockEpochs)
+	// offline has stake but never votes; late votes only after each block
+	// has been finalized without it
+	offline, late := testWallet(t, "offline"), testWallet(t, "late")
+	c.bond(t, map[*Wallet]uint64{c.proposer: 1_000_000, offline: 1_000, late: 1_000})
+	for h := 2; h <= 4; h++ {
+		b := c.mine(t)
+		if !b.Finalized {
+			t.Fatalf("block %d not finalized", h)
+		}
+		v, _ := SignVote(late, uint64(h), b.Hash, 0)
+		if _, err := c.node.Finality.Add(v); err != nil {
+			t.Fatalf("late vote: %v", err)
+		}
+	}
+	for h := uint64(2); h <= 3; h++ {
+		if !c.node.Ledger.HasLiveness(late.Address, h) || c.node.Ledger.HasLiveness(offline.Address, h) {
+			t.Fatalf("liveness of block %d not recorded", h)
+		}
+	}
+
+	// a vote can only be recorded once, and only for a canonical block
+	head, _ := c.node.Ledger.GetBlock(4)
+	dup := reorgTestBlock(t, head, c.proposer)
+	v, _ := SignVote(late, 3, "elsewhere", 0)
+	dup.Liveness = c.node.Finality.Votes(3)
+	dup.Hash = dup.HeaderHash(dup.Nonce)
+	if err := c.node.Ledger.AddBlock(dup); !errors.Is(err, ErrInvalidVote) {
+		t.Fatalf("expected a recorded vote to be rejected, got %v", err)
+	}
+	dup.Liveness = []Vote{*v}
+	dup.Hash = dup.HeaderHash(dup.Nonce)
+	if err := c.node.Ledger.AddBlock(dup); !errors.Is(err, ErrInvalidVote) {
+		t.Fatalf("expected a vote for another block to be rejected, got %v", err)
+	}
+
+	ev := NewDowntimeEvidence(offline.Address, 3)
+	if err := c.node.ReportDowntime(ev); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected evidence within the liveness grace to fail, got %v", err)
+	}
+	c.mine(t)
+	if err := c.node.ReportDowntime(NewDowntimeEvidence(late.Address, 3)); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("a validator whose votes arrived late is live, got %v", err)
+	}
+	if err := c.node.ReportDowntime(NewDowntimeEvidence(c.proposer.Address, 3)); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("a validator that signed every block is live, got %v", err)
+	}
+	stranger, _ := NewWallet()
+	if err := c.node.Ledger.CheckEvidence(NewDowntimeEvidence(stranger.Address, 3)); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected evidence against a non-validator to fail, got %v", err)
+	}
+	if err := c.node.Ledger.CheckEvidence(equivocate(t, stranger, 2)); !errors.Is(err, ErrInvalidEvidence) {
+		t.Fatalf("expected evidence against a non-validator to fail, got %v", err)
+	}
+	if err := c.node.ReportDowntime(ev); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	c.mine(t)
+	if _, ok := c.node.Validators.Eligible()[offline.Address]; ok {
+		t.Fatalf("offline validator still eligible")
+	}
+	if stake := c.node.Validators.Stake(offline.Address); stake != 990 {
+		t.Fatalf("downtime should burn %d basis points, stake left %d", DowntimeSlash, stake)
+	}
+
+	// the missed blocks cannot be punished again through another window
+	c.node.Rehabilitate(offline.Address)
+	if err := c.node.ReportDowntime(NewDowntimeEvidence(offline.Address, 4)); !errors.Is(err, ErrDuplicateEvidence) {
+		t.Fatalf("expected ErrDuplicateEvidence, got %v", err)
+	}
+
+	// evidence older than MaxAge expires
+	old := equivocate(t, offline, 2)
+	for i := 0; i < 2; i++ {
+		c.mine(t)
+	}
+	if err := c.node.ReportDoubleSign(old); !errors.Is(err, ErrEvidenceExpired) {
+		t.Fatalf("expected ErrEvidenceExpired, got %v", err)
+	}
+}
+
+func TestEvidenceAndLivenessSurviveSnapshots(t *testing.T) {
+	c := newEvidenceChain(t, oneBlockEpochs)
+	offender := testWallet(t, "offender")
+	c.bond(t, map[*Wallet]uint64{c.proposer: 1_000_000, offender: 1_000})
+	c.mine(t)
+	ev := equivocate(t, offender, 2)
+	if err := c.node.ReportDoubleSign(ev); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	c.mine(t)
+	c.mine(t)
+	if !c.node.Ledger.HasEvidence(ev) || !c.node.Ledger.HasLiveness(c.proposer.Address, 3) {
+		t.Fatalf("evidence or liveness not recorded")
+	}
+
+	snap, err := CreateSnapshot(c.node.Ledger, 0, testWallet(t, "producer"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	restored, _ := OpenLedger("", oneBlockEpochs)
+	if _, err := restored.RestoreSnapshot(snap, WithTrustedSnapshotRoot(c.node.Ledger.StateRoot())); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if !restored.HasEvidence(ev) || !restored.HasLiveness(c.proposer.Address, 3) {
+		t.Fatalf("evidence or liveness lost in the snapshot")
+	}
+	if err := restored.CheckEvidence(equivocate(t, offender, 2)); !errors.Is(err, ErrDuplicateEvidence) {
+		t.Fatalf("restored ledger accepts punished evidence again: %v", err)
+	}
+}
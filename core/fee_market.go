@@ -0,0 +1,282 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Fee market parameters. Blocks may use up to BlockGasElasticity times the
+// target gas, and the base fee moves by at most 1/BaseFeeChangeDenominator
+// from one block to the next.
+const (
+	BlockGasElasticity       = 2
+	BaseFeeChangeDenominator = 8
+	DefaultTargetBlockGas    = 12_500_000
+	DefaultInitialBaseFee    = 1
+
+	// TxBaseGas is the gas of a plain transfer and TxInstructionGas is added
+	// for every instruction of a transaction's program.
+	TxBaseGas        = 21_000
+	TxInstructionGas = 100
+)
+
+var (
+	// ErrFeeCapTooLow is returned when a transaction cannot pay the base fee
+	// of the block it is executed in.
+	ErrFeeCapTooLow = errors.New("fee cap below base fee")
+	// ErrBaseFeeMismatch is returned when a block declares a base fee other
+	// than the one derived from its parent.
+	ErrBaseFeeMismatch = errors.New("base fee mismatch")
+	// ErrBlockGas is returned when a block misreports its gas use or uses
+	// more than the fee market allows.
+	ErrBlockGas = errors.New("invalid block gas")
+)
+
+// FeeMarket configures EIP-1559 style transaction pricing. Every block
+// carries a base fee per unit of gas derived from the gas its parent used
+// against TargetGas: it rises while blocks are fuller than the target and
+// falls while they are emptier. Transactions pay the base fee plus a
+// priority tip, which goes to the validator of the sub-block including them.
+// The base fee portion is burned, or split among the fee pools of Split when
+// one is set.
+type FeeMarket struct {
+	InitialBaseFee uint64
+	MinBaseFee     uint64
+	TargetGas      uint64
+	Split          *FeeSplitPolicy
+}
+
+// DefaultFeeMarket burns the base fee and targets DefaultTargetBlockGas.
+var DefaultFeeMarket = FeeMarket{InitialBaseFee: DefaultInitialBaseFee, TargetGas: DefaultTargetBlockGas}
+
+// WithFeeMarket enables the fee market on a ledger. Without it blocks carry
+// no base fee and transactions pay their flat fee, which is burned. Every
+// node of a network must use the same parameters.
+func WithFeeMarket(m FeeMarket) LedgerOption {
+	return func(l *Ledger) {
+		if m.TargetGas == 0 {
+			m.TargetGas = DefaultTargetBlockGas
+		}
+		l.feeMarket = &m
+	}
+}
+
+// MaxGas returns the most gas a block may use.
+func (m FeeMarket) MaxGas() uint64 { return m.TargetGas * BlockGasElasticity }
+
+// NextBaseFee returns the base fee of a block whose parent had the given
+// base fee and gas use. A parent without a base fee, such as a genesis block,
+// is followed by InitialBaseFee.
+func (m FeeMarket) NextBaseFee(parentBaseFee, parentGasUsed uint64) uint64 {
+	if parentBaseFee == 0 {
+		return max(m.InitialBaseFee, m.MinBaseFee)
+	}
+	next := parentBaseFee
+	switch {
+	case parentGasUsed > m.TargetGas:
+		delta := min(parentGasUsed-m.TargetGas, m.TargetGas)
+		next += max(scaleFee(parentBaseFee, delta, m.TargetGas), 1)
+		if next < parentBaseFee {
+			next = ^uint64(0)
+		}
+	case parentGasUsed < m.TargetGas:
+		next -= scaleFee(parentBaseFee, m.TargetGas-parentGasUsed, m.TargetGas)
+	}
+	return max(next, m.MinBaseFee)
+}
+
+// scaleFee returns fee*delta/target/BaseFeeChangeDenominator for delta no
+// larger than target without overflowing.
+func scaleFee(fee, delta, target uint64) uint64 {
+	hi, lo := bits.Mul64(fee, delta)
+	q, _ := bits.Div64(hi, lo, target)
+	return q / BaseFeeChangeDenominator
+}
+
+// Gas returns the gas a transaction uses.
+func (t *Transaction) Gas() uint64 {
+	return TxBaseGas + uint64(len(t.Program))*TxInstructionGas
+}
+
+// FeeCap returns the most a transaction can pay in fees: its MaxFee for all
+// of its gas, or its flat Fee when it sets no MaxFee.
+func (t *Transaction) FeeCap() uint64 {
+	if t.MaxFee == 0 {
+		return t.Fee
+	}
+	hi, lo := bits.Mul64(t.MaxFee, t.Gas())
+	if hi != 0 {
+		return ^uint64(0)
+	}
+	return lo
+}
+
+// FeeAt splits what a transaction pays when executed at baseFee into the
+// base fee portion and the priority tip. A transaction with a MaxFee pays
+// baseFee plus up to Tip per unit of gas without exceeding MaxFee, while one
+// with only a flat Fee pays all of it and tips whatever exceeds the base fee
+// portion. ErrFeeCapTooLow is returned when the transaction cannot cover the
+// base fee.
+func (t *Transaction) FeeAt(baseFee uint64) (base, tip uint64, err error) {
+	gas := t.Gas()
+	hi, base := bits.Mul64(baseFee, gas)
+	if t.MaxFee == 0 {
+		if hi != 0 || t.Fee < base {
+			return 0, 0, fmt.Errorf("%w: fee %d does not cover %d gas at base fee %d", ErrFeeCapTooLow, t.Fee, gas, baseFee)
+		}
+		return base, t.Fee - base, nil
+	}
+	if t.MaxFee < baseFee || hi != 0 {
+		return 0, 0, fmt.Errorf("%w: max fee %d, base fee %d", ErrFeeCapTooLow, t.MaxFee, baseFee)
+	}
+	hi, tip = bits.Mul64(min(t.Tip, t.MaxFee-baseFee), gas)
+	if hi != 0 || base+tip < base {
+		return 0, 0, fmt.Errorf("%w: fee overflows", ErrFeeCapTooLow)
+	}
+	return base, tip, nil
+}
+
+// BlockGas returns the gas used by the transactions of b.
+func BlockGas(b *Block) uint64 {
+	var gas uint64
+	for _, sb := range b.SubBlocks {
+		if sb == nil {
+			continue
+		}
+		for _, tx := range sb.Transactions {
+			if tx != nil {
+				gas += tx.Gas()
+			}
+		}
+	}
+	return gas
+}
+
+// FeePoolAddress returns the account collecting the base fee share of a fee
+// split category, such as "loan_pool" or "validators_miners".
+func FeePoolAddress(category string) string {
+	h := sha256.Sum256([]byte("fee_pool/" + category))
+	return hex.EncodeToString(h[:20])
+}
+
+// poolShares lists the fee pools of a distribution in policy order.
+func (d FeeDistribution) poolShares() []struct {
+	pool   string
+	amount uint64
+} {
+	return []struct {
+		pool   string
+		amount uint64
+	}{
+		{"internal_development", d.InternalDevelopment},
+		{"internal_charity", d.InternalCharity},
+		{"external_charity", d.ExternalCharity},
+		{"loan_pool", d.LoanPool},
+		{"passive_income", d.PassiveIncome},
+		{"validators_miners", d.ValidatorsMiners},
+		{"authority_nodes", d.AuthorityNodes},
+		{"node_hosts", d.NodeHosts},
+		{"creator_wallet", d.CreatorWallet},
+	}
+}
+
+// FeeMarket returns the ledger's fee market and whether one is enabled.
+func (l *Ledger) FeeMarket() (FeeMarket, bool) {
+	if l.feeMarket == nil {
+		return FeeMarket{}, false
+	}
+	return *l.feeMarket, true
+}
+
+// NextBaseFee returns the base fee the next block must declare, or zero when
+// the ledger has no fee market.
+func (l *Ledger) NextBaseFee() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.nextBaseFeeLocked()
+}
+
+func (l *Ledger) nextBaseFeeLocked() uint64 {
+	if l.feeMarket == nil {
+		return 0
+	}
+	var parent BlockHeader
+	if height := l.heightLocked(); height > 0 {
+		parent, _ = l.headerLocked(height)
+	}
+	return l.feeMarket.NextBaseFee(parent.BaseFee, parent.GasUsed)
+}
+
+// checkBlockFeesLocked checks the base fee and gas use b declares. Without a
+// fee market blocks must not declare a base fee, and the first block of a
+// chain may leave it zero.
+func (l *Ledger) checkBlockFeesLocked(b *Block) error {
+	if l.feeMarket == nil {
+		if b.BaseFee != 0 {
+			return fmt.Errorf("%w: ledger has no fee market, block declares %d", ErrBaseFeeMismatch, b.BaseFee)
+		}
+		return nil
+	}
+	if gas := BlockGas(b); b.GasUsed != gas {
+		return fmt.Errorf("%w: block declares %d, transactions use %d", ErrBlockGas, b.GasUsed, gas)
+	}
+	if b.GasUsed > l.feeMarket.MaxGas() {
+		return fmt.Errorf("%w: %d exceeds the limit of %d", ErrBlockGas, b.GasUsed, l.feeMarket.MaxGas())
+	}
+	if l.heightLocked() == 0 && b.BaseFee == 0 {
+		return nil
+	}
+	if want := l.nextBaseFeeLocked(); b.BaseFee != want {
+		return fmt.Errorf("%w: block declares %d, expected %d", ErrBaseFeeMismatch, b.BaseFee, want)
+	}
+	return nil
+}
+
+// txBaseFeeLocked returns the base fee transactions pay: that of the block
+// being executed, or the next block's for transactions applied on their own.
+func (l *Ledger) txBaseFeeLocked() uint64 {
+	if l.exec != nil {
+		return l.exec.baseFee
+	}
+	return l.nextBaseFeeLocked()
+}
+
+// payFeesLocked pays the tip to the validator of the sub-block being executed,
+// to be shared with its delegators, and burns the base fee portion or splits
+// it among the fee pools when the market has a split policy. Without a fee
+// market the validator is paid the validators' and miners' share of the fee
+// under DefaultFeeSplitPolicy and the rest is burned. Outside a block fees are
+// burned.
+func (l *Ledger) payFeesLocked(base, tip uint64) {
+	paid := l.exec != nil && l.exec.validator != ""
+	if l.feeMarket == nil {
+		if share := (base + tip) * DefaultFeeSplitPolicy.ValidatorsMiners / 100; paid && share > 0 {
+			l.rewardLocked(l.exec.validator, share)
+		}
+		return
+	}
+	if paid && tip > 0 {
+		l.rewardLocked(l.exec.validator, tip)
+	}
+	if l.feeMarket.Split == nil || base == 0 {
+		return
+	}
+	dist, err := DistributeFeesWithPolicy(base, *l.feeMarket.Split)
+	if err != nil {
+		return
+	}
+	for _, s := range dist.poolShares() {
+		if s.amount > 0 {
+			l.creditLocked(FeePoolAddress(s.pool), s.amount)
+		}
+	}
+}
+
+// blockExec is the context of the block whose transactions are executed.
+type blockExec struct {
+	baseFee   uint64
+	validator string
+}
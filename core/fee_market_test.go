@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFeeMarketNextBaseFee(t *testing.T) {
+	m := FeeMarket{InitialBaseFee: 100, MinBaseFee: 10, TargetGas: 1000}
+	cases := []struct{ base, used, want uint64 }{
+		{0, 5000, 100},
+		{800, 1000, 800},
+		{800, 2000, 900},
+		{800, 1500, 850},
+		{800, 9000, 900},
+		{800, 0, 700},
+		{10, 0, 10},
+		{1, 1001, 10},
+	}
+	for _, c := range cases {
+		if got := m.NextBaseFee(c.base, c.used); got != c.want {
+			t.Errorf("NextBaseFee(%d, %d) = %d, want %d", c.base, c.used, got, c.want)
+		}
+	}
+	m.MinBaseFee = 0
+	if got := m.NextBaseFee(1, 1001); got != 2 {
+		t.Fatalf("a full block must raise the base fee, got %d", got)
+	}
+}
+
+func TestTransactionFeeAt(t *testing.T) {
+	tx := NewDynamicFeeTransaction("a", "b", 1, 12, 3, 0)
+	if tx.FeeCap() != 12*TxBaseGas || tx.ID == NewTransaction("a", "b", 1, 0, 0).ID {
+		t.Fatalf("unexpected fee cap %d or id", tx.FeeCap())
+	}
+	if base, tip, err := tx.FeeAt(5); err != nil || base != 5*TxBaseGas || tip != 3*TxBaseGas {
+		t.Fatalf("FeeAt(5) = %d %d %v", base, tip, err)
+	}
+	if base, tip, err := tx.FeeAt(10); err != nil || base != 10*TxBaseGas || tip != 2*TxBaseGas {
+		t.Fatalf("tip must be capped by the max fee: %d %d %v", base, tip, err)
+	}
+	if _, _, err := tx.FeeAt(13); !errors.Is(err, ErrFeeCapTooLow) {
+		t.Fatalf("expected ErrFeeCapTooLow, got %v", err)
+	}
+	flat := NewTransaction("a", "b", 1, 2*TxBaseGas+5, 0)
+	if base, tip, err := flat.FeeAt(2); err != nil || base != 2*TxBaseGas || tip != 5 {
+		t.Fatalf("flat FeeAt(2) = %d %d %v", base, tip, err)
+	}
+	if _, _, err := flat.FeeAt(3); !errors.Is(err, ErrFeeCapTooLow) {
+		t.Fatalf("expected ErrFeeCapTooLow, got %v", err)
+	}
+}
+
+func TestMineBlockFeeMarket(t *testing.T) {
+	alice := testWallet(t, "alice")
+	ledger := newLedger(WithFeeMarket(FeeMarket{InitialBaseFee: 10, TargetGas: TxBaseGas}))
+	ledger.Credit(alice.Address, 10_000_000)
+	node := NewNode("miner", "addr", ledger)
+	validator := testWallet(t, "validator")
+	if err := node.RegisterValidatorWallet(validator); err != nil {
+		t.Fatalf("register validator: %v", err)
+	}
+	node.SetStake(validator.Address, 2)
+	// the last transaction cannot pay the base fee once it rises
+	for nonce, maxFee := range []uint64{20, 20, 10} {
+		tx := NewDynamicFeeTransaction(alice.Address, "bob", 5, maxFee, 2, uint64(nonce))
+		if _, err := alice.Sign(tx); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		if err := node.AddTransaction(tx); err != nil {
+			t.Fatalf("add tx: %v", err)
+		}
+	}
+
+	block := node.MineBlock()
+	if block == nil {
+		t.Fatalf("block not mined")
+	}
+	if block.BaseFee != 10 || block.GasUsed != 2*TxBaseGas || len(block.SubBlocks[0].Transactions) != 2 {
+		t.Fatalf("block must declare the base fee and fit its gas limit: %d %d %d", block.BaseFee, block.GasUsed, len(block.SubBlocks[0].Transactions))
+	}
+	if got := ledger.GetBalance(alice.Address); got != 10_000_000-2*(5+12*TxBaseGas) {
+		t.Fatalf("unexpected sender balance %d", got)
+	}
+	if got := ledger.GetBalance(validator.Address); got != 2*2*TxBaseGas {
+		t.Fatalf("validator must receive the tips, got %d", got)
+	}
+	if got := ledger.GetBalance("miner"); got != 0 {
+		t.Fatalf("base fee must be burned, miner got %d", got)
+	}
+	h, _ := ledger.GetHeader(1)
+	if h.BaseFee != 10 || h.hash(h.Nonce) != block.Hash {
+		t.Fatalf("header must carry the base fee: %+v", h)
+	}
+	if h.BaseFee++; h.hash(h.Nonce) == block.Hash {
+		t.Fatalf("header hash must commit to the base fee")
+	}
+
+	// the full block raised the base fee by an eighth
+	if got := ledger.NextBaseFee(); got != 11 {
+		t.Fatalf("next base fee %d, want 11", got)
+	}
+	if node.Mempool.Len() != 1 || node.MineBlock() != nil {
+		t.Fatalf("a transaction below the base fee must stay queued")
+	}
+
+	tx := signedTestTx(t, alice, "bob", 1, 11*TxBaseGas, 2)
+	bad := NewBlock([]*SubBlock{NewSubBlock([]*Transaction{tx}, validator.Address)}, block.Hash)
+	bad.BaseFee, bad.GasUsed = 12, TxBaseGas
+	if err := ledger.AddBlock(bad); !errors.Is(err, ErrBaseFeeMismatch) {
+		t.Fatalf("expected ErrBaseFeeMismatch, got %v", err)
+	}
+	bad.BaseFee, bad.GasUsed = 11, 1
+	if err := ledger.AddBlock(bad); !errors.Is(err, ErrBlockGas) {
+		t.Fatalf("expected ErrBlockGas, got %v", err)
+	}
+	bad.GasUsed = TxBaseGas
+	if err := ledger.AddBlock(bad); !errors.Is(err, ErrStateRootMismatch) {
+		t.Fatalf("expected a block without a state root to fail, got %v", err)
+	}
+	if err := ledger.AddBlock(sealTestBlock(t, ledger, bad)); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	if got := ledger.NextBaseFee(); got != 11 {
+		t.Fatalf("a block at target must keep the base fee, got %d", got)
+	}
+}
+
+func TestFeeMarketSplitsBaseFee(t *testing.T) {
+	alice := testWallet(t, "alice")
+	l := newLedger(WithFeeMarket(FeeMarket{InitialBaseFee: 10, Split: &DefaultFeeSplitPolicy}))
+	l.Credit(alice.Address, 1_000_000)
+	sim, err := l.Simulate(NewDynamicFeeTransaction(alice.Address, "bob", 1, 15, 1, 0))
+	if err != nil || sim.Error != "" || sim.Fee != 11*TxBaseGas {
+		t.Fatalf("simulate: %+v %v", sim, err)
+	}
+	if err := l.ApplyTransaction(signedTestTx(t, alice, "bob", 1, 10*TxBaseGas+7, 0)); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	base := uint64(10 * TxBaseGas)
+	if got := l.GetBalance(FeePoolAddress("validators_miners")); got != base*DefaultFeeSplitPolicy.ValidatorsMiners/100 {
+		t.Fatalf("unexpected validator pool balance %d", got)
+	}
+	if got := l.GetBalance(FeePoolAddress("loan_pool")); got != base*DefaultFeeSplitPolicy.LoanPool/100 {
+		t.Fatalf("unexpected loan pool balance %d", got)
+	}
+	if err := l.ApplyTransaction(signedTestTx(t, alice, "bob", 1, 10*TxBaseGas-1, 1)); !errors.Is(err, ErrFeeCapTooLow) {
+		t.Fatalf("expected ErrFeeCapTooLow, got %v", err)
+	}
+}
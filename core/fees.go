@@ -37,6 +37,21 @@ const (
 	TxTypeTokenInteraction
 	TxTypeContract
 	TxTypeWalletVerification
+	// TxTypeBond bonds Amount of the sender's balance as stake of the
+	// validator To.
+	TxTypeBond
+	// TxTypeUnbond starts unbonding Amount of the stake the sender bonded
+	// to the validator To.
+	TxTypeUnbond
+	// TxTypeRedelegate moves Amount of the stake the sender bonded to the
+	// validator Source over to the validator To.
+	TxTypeRedelegate
+	// TxTypeWithdrawRewards pays out the rewards the sender's stake with the
+	// validator To has earned.
+	TxTypeWithdrawRewards
+	// TxTypeCommission sets the commission of the sending validator to Amount
+	// basis points.
+	TxTypeCommission
 )
 
 // FeeBreakdown captures the components of a transaction fee.
@@ -239,7 +254,7 @@ func AdjustFeeRates(baseFee, variableRate uint64, load float64) (uint64, uint64)
 // purchases.
 func EstimateFee(txType TransactionType, units, baseFee, variableRate, tip uint64) FeeBreakdown {
 	switch txType {
-	case TxTypeTransfer:
+	case TxTypeTransfer, TxTypeBond, TxTypeUnbond, TxTypeRedelegate, TxTypeWithdrawRewards, TxTypeCommission:
 		return FeeForTransfer(units, baseFee, variableRate, tip)
 	case TxTypePurchase:
 		return FeeForPurchase(units, baseFee, variableRate, tip)
@@ -294,10 +309,12 @@ func NewFeeDistributionContract(l *Ledger) *FeeDistributionContract {
 	return &FeeDistributionContract{Ledger: l}
 }
 
-// Distribute credits each participant with its fee share.
+// Distribute credits each participant with its fee share. The shares of
+// validators with bonded stake are split with their delegators, see
+// Ledger.DistributeReward.
 func (f *FeeDistributionContract) Distribute(shares map[string]uint64) {
 	for addr, amt := range shares {
-		f.Ledger.Credit(addr, amt)
+		_ = f.Ledger.DistributeReward(addr, amt)
 	}
 }
 
@@ -0,0 +1,383 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Blocks become final through signed votes. Validators sign a Vote for the
+// height, hash and round of a block and gossip it on VoteTopic. A
+// VoteCollector gathers the votes of every round, and once validators holding
+// at least two thirds of the stake have voted for the same block their votes
+// form a FinalityCertificate. The ledger stores certificates alongside their
+// blocks and never reorganises below the last finalized height. Anyone
+// holding the validator set of a height, including a LightNode, can verify
+// its certificate. A validator signing votes for two blocks in the same round
+// equivocates, and the collector keeps both votes as evidence.
+
+// VoteTopic is the network topic finality votes are gossiped on.
+const VoteTopic = "consensus/votes"
+
+var (
+	// ErrInvalidVote is returned for votes that are malformed, badly signed or
+	// cast by an address outside the validator set.
+	ErrInvalidVote = errors.New("invalid finality vote")
+	// ErrEquivocation is returned when a validator votes for two different
+	// blocks at the same height and round.
+	ErrEquivocation = errors.New("validator equivocated")
+	// ErrInvalidCertificate is returned when a finality certificate does not
+	// carry a quorum of valid votes for its block.
+	ErrInvalidCertificate = errors.New("invalid finality certificate")
+	// ErrFinalizedReorg is returned when a branch would replace a finalized
+	// block.
+	ErrFinalizedReorg = errors.New("reorg below finalized height")
+)
+
+// Vote is a validator's signature over a block's height, hash and round.
+type Vote struct {
+	Height    uint64 `json:"height"`
+	BlockHash string `json:"block_hash"`
+	Round     uint32 `json:"round"`
+	Validator string `json:"validator"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+func voteDigest(height uint64, blockHash string, round uint32) []byte {
+	var buf [12]byte
+	binary.BigEndian.PutUint64(buf[:8], height)
+	binary.BigEndian.PutUint32(buf[8:], round)
+	h := sha256.New()
+	h.Write([]byte("synnergy/vote\x00"))
+	h.Write(buf[:])
+	h.Write([]byte(blockHash))
+	return h.Sum(nil)
+}
+
+// SignVote returns w's vote for the block with the given hash at height in
+// round.
+func SignVote(w *Wallet, height uint64, blockHash string, round uint32) (*Vote, error) {
+	if w == nil || w.PrivateKey == nil {
+		return nil, errors.New("wallet private key not initialised")
+	}
+	if blockHash == "" {
+		return nil, fmt.Errorf("%w: block hash required", ErrInvalidVote)
+	}
+	sig, key, err := signSubBlock(w.PrivateKey, hex.EncodeToString(voteDigest(height, blockHash, round)))
+	if err != nil {
+		return nil, err
+	}
+	return &Vote{
+		Height:    height,
+		BlockHash: blockHash,
+		Round:     round,
+		Validator: deriveAddress(&w.PrivateKey.PublicKey),
+		PublicKey: key,
+		Signature: sig,
+	}, nil
+}
+
+// Verify checks that the vote is signed by the key of its validator.
+func (v *Vote) Verify() error {
+	if v.BlockHash == "" {
+		return fmt.Errorf("%w: block hash required", ErrInvalidVote)
+	}
+	pub, err := decodePublicKey(v.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVote, err)
+	}
+	if deriveAddress(pub) != v.Validator {
+		return fmt.Errorf("%w: key does not belong to %s", ErrInvalidVote, v.Validator)
+	}
+	if !verifyDigest(voteDigest(v.Height, v.BlockHash, v.Round), v.Signature, pub) {
+		return fmt.Errorf("%w: bad signature from %s", ErrInvalidVote, v.Validator)
+	}
+	return nil
+}
+
+// Equivocation is evidence that a validator signed votes for two different
+// blocks at the same height and round.
+type Equivocation struct {
+	First  Vote `json:"first"`
+	Second Vote `json:"second"`
+}
+
+// Validator returns the address of the equivocating validator.
+func (e *Equivocation) Validator() string { return e.First.Validator }
+
+// Verify checks that both votes are validly signed by the same validator for
+// different blocks at the same height and round.
+func (e *Equivocation) Verify() error {
+	a, b := &e.First, &e.Second
+	if a.Validator != b.Validator || a.Height != b.Height || a.Round != b.Round {
+		return fmt.Errorf("%w: votes are not from the same validator and round", ErrInvalidVote)
+	}
+	if a.BlockHash == b.BlockHash {
+		return fmt.Errorf("%w: votes are for the same block", ErrInvalidVote)
+	}
+	if err := a.Verify(); err != nil {
+		return err
+	}
+	return b.Verify()
+}
+
+// ValidatorSet maps the validators of a height to their voting stake.
+type ValidatorSet map[string]uint64
+
+// TotalStake returns the stake of all validators in the set.
+func (s ValidatorSet) TotalStake() uint64 {
+	var total uint64
+	for _, stake := range s {
+		total += stake
+	}
+	return total
+}
+
+// HasQuorum reports whether stake is at least two thirds of the set's total.
+func (s ValidatorSet) HasQuorum(stake uint64) bool {
+	total := s.TotalStake()
+	if total == 0 {
+		return false
+	}
+	// ceil(2*total/3) without overflowing
+	need := total/3*2 + (total%3*2+2)/3
+	return stake >= need
+}
+
+// FinalityCertificate carries the votes finalizing a block.
+type FinalityCertificate struct {
+	Height    uint64 `json:"height"`
+	BlockHash string `json:"block_hash"`
+	Round     uint32 `json:"round"`
+	Votes     []Vote `json:"votes"`
+}
+
+// Verify checks that the certificate holds validly signed votes for its block
+// from distinct members of set holding at least two thirds of its stake.
+func (c *FinalityCertificate) Verify(set ValidatorSet) error {
+	if c == nil {
+		return fmt.Errorf("%w: certificate required", ErrInvalidCertificate)
+	}
+	seen := make(map[string]bool, len(c.Votes))
+	var stake uint64
+	for i := range c.Votes {
+		v := &c.Votes[i]
+		if v.Height != c.Height || v.BlockHash != c.BlockHash || v.Round != c.Round {
+			return fmt.Errorf("%w: vote by %s is for another block", ErrInvalidCertificate, v.Validator)
+		}
+		if seen[v.Validator] {
+			return fmt.Errorf("%w: duplicate vote by %s", ErrInvalidCertificate, v.Validator)
+		}
+		seen[v.Validator] = true
+		power, ok := set[v.Validator]
+		if !ok || power == 0 {
+			return fmt.Errorf("%w: %s is not a validator at height %d", ErrInvalidCertificate, v.Validator, c.Height)
+		}
+		if err := v.Verify(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+		}
+		stake += power
+	}
+	if !set.HasQuorum(stake) {
+		return fmt.Errorf("%w: votes carry %d of %d stake", ErrInvalidCertificate, stake, set.TotalStake())
+	}
+	return nil
+}
+
+type voteRound struct {
+	height uint64
+	round  uint32
+}
+
+// VoteCollector gathers finality votes per height and round and assembles a
+// certificate once a block has a quorum. It is safe for concurrent use.
+type VoteCollector struct {
+	mu         sync.Mutex
+	validators func(height uint64) ValidatorSet
+	rounds     map[voteRound]map[string]Vote
+	certs      map[uint64]*FinalityCertificate
+	evidence   []Equivocation
+	handlers   []func(*FinalityCertificate)
+}
+
+// NewVoteCollector returns a collector checking votes against the validator
+// set validators returns for their height.
+func NewVoteCollector(validators func(height uint64) ValidatorSet) *VoteCollector {
+	return &VoteCollector{
+		validators: validators,
+		rounds:     make(map[voteRound]map[string]Vote),
+		certs:      make(map[uint64]*FinalityCertificate),
+	}
+}
+
+// OnCertificate registers fn to be called with every certificate the
+// collector assembles.
+func (c *VoteCollector) OnCertificate(fn func(*FinalityCertificate)) {
+	c.mu.Lock()
+	c.handlers = append(c.handlers, fn)
+	c.mu.Unlock()
+}
+
+// Add verifies and records v. It returns the certificate of v's height once
+// one has been assembled, and nil until then. A vote conflicting with one the
+// validator already cast in the same round is recorded as evidence and
+// rejected with ErrEquivocation.
+func (c *VoteCollector) Add(v *Vote) (*FinalityCertificate, error) {
+	if v == nil {
+		return nil, fmt.Errorf("%w: vote required", ErrInvalidVote)
+	}
+	if err := v.Verify(); err != nil {
+		return nil, err
+	}
+	set := c.validators(v.Height)
+	if set[v.Validator] == 0 {
+		return nil, fmt.Errorf("%w: %s is not a validator at height %d", ErrInvalidVote, v.Validator, v.Height)
+	}
+	c.mu.Lock()
+	key := voteRound{v.Height, v.Round}
+	votes := c.rounds[key]
+	if votes == nil {
+		votes = make(map[string]Vote)
+		c.rounds[key] = votes
+	}
+	if prev, ok := votes[v.Validator]; ok {
+		cert := c.certs[v.Height]
+		c.mu.Unlock()
+		if prev.BlockHash == v.BlockHash {
+			return cert, nil
+		}
+		c.mu.Lock()
+		c.evidence = append(c.evidence, Equivocation{First: prev, Second: *v})
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s voted for %s and %s at height %d round %d", ErrEquivocation, v.Validator, prev.BlockHash, v.BlockHash, v.Height, v.Round)
+	}
+	votes[v.Validator] = *v
+	if cert := c.certs[v.Height]; cert != nil {
+		c.mu.Unlock()
+		return cert, nil
+	}
+	var (
+		stake  uint64
+		signed []Vote
+	)
+	for _, vote := range votes {
+		if vote.BlockHash == v.BlockHash {
+			stake += set[vote.Validator]
+			signed = append(signed, vote)
+		}
+	}
+	if !set.HasQuorum(stake) {
+		c.mu.Unlock()
+		return nil, nil
+	}
+	sort.Slice(signed, func(i, j int) bool { return signed[i].Validator < signed[j].Validator })
+	cert := &FinalityCertificate{Height: v.Height, BlockHash: v.BlockHash, Round: v.Round, Votes: signed}
+	c.certs[v.Height] = cert
+	handlers := append([]func(*FinalityCertificate){}, c.handlers...)
+	c.mu.Unlock()
+	for _, fn := range handlers {
+		fn(cert)
+	}
+	return cert, nil
+}
+
+// Certificate returns the certificate assembled for height.
+func (c *VoteCollector) Certificate(height uint64) (*FinalityCertificate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cert, ok := c.certs[height]
+	return cert, ok
+}
+
+// Votes returns every vote received for height, in any round and including
+// those that arrived after its certificate was assembled, ordered by round
+// and validator.
+func (c *VoteCollector) Votes(height uint64) []Vote {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []Vote
+	for key, votes := range c.rounds {
+		if key.height != height {
+			continue
+		}
+		for _, v := range votes {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Round != out[j].Round {
+			return out[i].Round < out[j].Round
+		}
+		return out[i].Validator < out[j].Validator
+	})
+	return out
+}
+
+// Evidence returns the equivocations observed so far.
+func (c *VoteCollector) Evidence() []Equivocation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Equivocation(nil), c.evidence...)
+}
+
+// Prune forgets the votes, certificates and equivocations of heights below
+// height.
+func (c *VoteCollector) Prune(height uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.evidence[:0]
+	for _, eq := range c.evidence {
+		if eq.First.Height >= height {
+			kept = append(kept, eq)
+		}
+	}
+	c.evidence = kept
+	for key := range c.rounds {
+		if key.height < height {
+			delete(c.rounds, key)
+		}
+	}
+	for h := range c.certs {
+		if h < height {
+			delete(c.certs, h)
+		}
+	}
+}
+
+// PublishVote gossips v to the subscribers of VoteTopic on n.
+func PublishVote(n *Network, v *Vote) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	n.Publish(VoteTopic, data)
+	return nil
+}
+
+// Listen subscribes to VoteTopic on n and adds the votes gossiped there until
+// ctx is done. Malformed, invalid and equivocating votes are dropped, the
+// latter after being recorded as evidence.
+func (c *VoteCollector) Listen(ctx context.Context, n *Network) {
+	ch := n.Subscribe(VoteTopic)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case data := <-ch:
+				var v Vote
+				if err := json.Unmarshal(data, &v); err != nil {
+					continue
+				}
+				_, _ = c.Add(&v)
+			}
+		}
+	}()
+}
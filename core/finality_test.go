@@ -0,0 +1,354 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"synnergy/internal/nodes"
+)
+
+func finalityValidators(t *testing.T, n int) ([]*Wallet, ValidatorSet) {
+	t.Helper()
+	wallets := make([]*Wallet, n)
+	set := make(ValidatorSet, n)
+	for i := range wallets {
+		w, err := NewWallet()
+		if err != nil {
+			t.Fatalf("wallet: %v", err)
+		}
+		wallets[i] = w
+		set[w.Address] = 10
+	}
+	return wallets, set
+}
+
+func signVotes(t *testing.T, wallets []*Wallet, height uint64, hash string) []*Vote {
+	t.Helper()
+	votes := make([]*Vote, len(wallets))
+	for i, w := range wallets {
+		v, err := SignVote(w, height, hash, 0)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		votes[i] = v
+	}
+	return votes
+}
+
+func TestVoteCollectorCertifiesQuorum(t *testing.T) {
+	wallets, set := finalityValidators(t, 4)
+	c := NewVoteCollector(func(uint64) ValidatorSet { return set })
+	var notified []*FinalityCertificate
+	c.OnCertificate(func(cert *FinalityCertificate) { notified = append(notified, cert) })
+
+	votes := signVotes(t, wallets, 7, "blockA")
+	forged := *votes[3]
+	forged.BlockHash = "blockB"
+	if _, err := c.Add(&forged); !errors.Is(err, ErrInvalidVote) {
+		t.Fatalf("expected ErrInvalidVote for a forged vote, got %v", err)
+	}
+	outsider, _ := NewWallet()
+	ov, _ := SignVote(outsider, 7, "blockA", 0)
+	if _, err := c.Add(ov); !errors.Is(err, ErrInvalidVote) {
+		t.Fatalf("expected ErrInvalidVote from a non validator, got %v", err)
+	}
+	for _, v := range votes[:2] {
+		if cert, err := c.Add(v); err != nil || cert != nil {
+			t.Fatalf("certificate before quorum: %v %v", cert, err)
+		}
+	}
+	// a vote for another block in the same round is an equivocation
+	double, _ := SignVote(wallets[0], 7, "blockB", 0)
+	if _, err := c.Add(double); !errors.Is(err, ErrEquivocation) {
+		t.Fatalf("expected ErrEquivocation, got %v", err)
+	}
+	ev := c.Evidence()
+	if len(ev) != 1 || ev[0].Validator() != wallets[0].Address || ev[0].Verify() != nil {
+		t.Fatalf("unexpected evidence %+v", ev)
+	}
+	// voting again in the next round is allowed
+	next, _ := SignVote(wallets[0], 7, "blockB", 1)
+	if _, err := c.Add(next); err != nil {
+		t.Fatalf("next round: %v", err)
+	}
+
+	cert, err := c.Add(votes[2])
+	if err != nil || cert == nil {
+		t.Fatalf("expected certificate at quorum: %v", err)
+	}
+	if len(cert.Votes) != 3 || len(notified) != 1 || notified[0] != cert {
+		t.Fatalf("unexpected certificate %+v, notified %d", cert, len(notified))
+	}
+	if err := cert.Verify(set); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if got, ok := c.Certificate(7); !ok || got != cert {
+		t.Fatalf("certificate not retained")
+	}
+	if _, err := c.Add(votes[3]); err != nil || len(notified) != 1 {
+		t.Fatalf("late votes must not issue another certificate: %v", err)
+	}
+
+	short := *cert
+	short.Votes = cert.Votes[:2]
+	if err := short.Verify(set); !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("expected ErrInvalidCertificate without quorum, got %v", err)
+	}
+	dup := *cert
+	dup.Votes = append([]Vote{cert.Votes[0]}, cert.Votes...)
+	if err := dup.Verify(set); !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("expected ErrInvalidCertificate for duplicate votes, got %v", err)
+	}
+	if all := c.Votes(7); len(all) != 5 || all[4].Round != 1 {
+		t.Fatalf("unexpected votes %+v", all)
+	}
+	c.Prune(7)
+	if _, ok := c.Certificate(7); !ok || len(c.Evidence()) != 1 {
+		t.Fatalf("prune dropped the height it was told to keep")
+	}
+	c.Prune(8)
+	if _, ok := c.Certificate(7); ok || len(c.Evidence()) != 0 || len(c.Votes(7)) != 0 {
+		t.Fatalf("prune must drop the votes, certificates and evidence below its height")
+	}
+}
+
+func TestVoteGossip(t *testing.T) {
+	wallets, set := finalityValidators(t, 3)
+	net := NewNetwork(nil)
+	c := NewVoteCollector(func(uint64) ValidatorSet { return set })
+	certs := make(chan *FinalityCertificate, 1)
+	c.OnCertificate(func(cert *FinalityCertificate) { certs <- cert })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Listen(ctx, net)
+
+	// gossip is best effort, so keep republishing until the votes arrive
+	votes := signVotes(t, wallets, 1, "gossiped")
+	deadline := time.After(5 * time.Second)
+	for {
+		for _, v := range votes {
+			if err := PublishVote(net, v); err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		select {
+		case cert := <-certs:
+			if cert.BlockHash != "gossiped" || cert.Verify(set) != nil {
+				t.Fatalf("unexpected certificate %+v", cert)
+			}
+			return
+		case <-deadline:
+			t.Fatalf("no certificate from gossiped votes")
+		default:
+		}
+	}
+}
+
+func certify(t *testing.T, wallets []*Wallet, height int, hash string) *FinalityCertificate {
+	t.Helper()
+	cert := &FinalityCertificate{Height: uint64(height), BlockHash: hash}
+	for _, v := range signVotes(t, wallets, uint64(height), hash) {
+		cert.Votes = append(cert.Votes, *v)
+	}
+	return cert
+}
+
+func TestLedgerFinalityBlocksReorg(t *testing.T) {
+	wallets, _ := finalityValidators(t, 3)
+	f := newStakedReorgFixture(t, wallets...)
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path, f.opts...)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.fund(l)
+	for _, b := range []*Block{f.g, f.a1} {
+		if _, err := l.ImportBlock(b, nil); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	}
+	if err := l.AddFinalityCertificate(certify(t, wallets, 2, f.b1.Hash)); !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("certificate for a side block must fail, got %v", err)
+	}
+	if err := l.AddFinalityCertificate(certify(t, wallets[:1], 2, f.a1.Hash)); !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("certificate without quorum must fail, got %v", err)
+	}
+	if err := l.AddFinalityCertificate(certify(t, wallets, 2, f.a1.Hash)); err != nil {
+		t.Fatalf("add certificate: %v", err)
+	}
+	if cert, ok := l.FinalityCertificate(2); !ok || cert.BlockHash != f.a1.Hash || l.FinalizedHeight() != 2 {
+		t.Fatalf("certificate not stored: %+v", cert)
+	}
+	if _, err := l.ImportBlock(f.b1, nil); err != nil {
+		t.Fatalf("import side block: %v", err)
+	}
+	if _, err := l.ImportBlock(f.b2, nil); !errors.Is(err, ErrFinalizedReorg) {
+		t.Fatalf("expected ErrFinalizedReorg, got %v", err)
+	}
+	if _, head := l.Head(); head != f.a1.Hash {
+		t.Fatalf("finalized head replaced by %s", head)
+	}
+
+	reopened, err := OpenLedger(path, f.opts...)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if _, ok := reopened.FinalityCertificate(2); !ok || reopened.FinalizedHeight() != 2 {
+		t.Fatalf("certificate lost on replay")
+	}
+}
+
+// mineBonds mines a block on node in which each wallet bonds stake, which the
+// ledger must have credited it. Under one block epochs the ledger records the
+// wallets as validators from the next block on.
+func mineBonds(t *testing.T, node *Node, stake uint64, wallets ...*Wallet) *Block {
+	t.Helper()
+	for _, w := range wallets {
+		if err := node.AddTransaction(signedStakeTx(t, w, TxTypeBond, stake, 0)); err != nil {
+			t.Fatalf("bond: %v", err)
+		}
+	}
+	b := node.MineBlock()
+	if b == nil {
+		t.Fatalf("bonds not mined")
+	}
+	return b
+}
+
+func TestMineBlockFinalizesWithCertificate(t *testing.T) {
+	alice := testWallet(t, "alice")
+	ledger, err := OpenLedger("", oneBlockEpochs)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	ledger.Credit(alice.Address, 200)
+	node := NewNode("miner", "addr", ledger)
+	validator, err := NewWallet()
+	if err != nil {
+		t.Fatalf("wallet: %v", err)
+	}
+	if err := node.RegisterValidatorWallet(validator); err != nil {
+		t.Fatalf("register validator: %v", err)
+	}
+	node.SetStake(validator.Address, 2)
+	ledger.Credit(validator.Address, 2)
+	mineBonds(t, node, 2, validator)
+	net := NewNetwork(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node.JoinNetwork(ctx, net)
+	gossip := net.Subscribe(VoteTopic)
+
+	if err := node.AddTransaction(signedTestTx(t, alice, "bob", 10, 1, 0)); err != nil {
+		t.Fatalf("add tx: %v", err)
+	}
+	block := node.MineBlock()
+	if block == nil || !block.Finalized {
+		t.Fatalf("block not finalized: %+v", block)
+	}
+	cert, ok := ledger.FinalityCertificate(2)
+	if !ok || cert.BlockHash != block.Hash || ledger.FinalizedHeight() != 2 {
+		t.Fatalf("certificate not stored with the block")
+	}
+	select {
+	case <-gossip:
+	case <-time.After(time.Second):
+		t.Fatalf("vote not gossiped")
+	}
+
+	// a light node holding the header and validator set verifies it
+	light := NewLightNode(nodes.Address("light"))
+	if err := light.AddHeader(nodes.BlockHeader{Hash: block.Hash, Height: 2}); err != nil {
+		t.Fatalf("add header: %v", err)
+	}
+	if err := light.VerifyFinality(cert); !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("expected ErrInvalidCertificate without a validator set, got %v", err)
+	}
+	light.SetValidatorSet(2, ValidatorSet{"someone-else": 5})
+	if err := light.VerifyFinality(cert); !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("expected ErrInvalidCertificate against another set, got %v", err)
+	}
+	light.SetValidatorSet(0, ValidatorSet{validator.Address: 2})
+	light.SetValidatorSet(2, ValidatorSet{validator.Address: 2})
+	if set, ok := light.ValidatorSet(5); !ok || set[validator.Address] != 2 {
+		t.Fatalf("unexpected validator set %v", set)
+	}
+	if err := light.VerifyFinality(cert); err != nil || light.FinalizedHeight() != 2 {
+		t.Fatalf("light verify: %v", err)
+	}
+}
+
+func TestImportedBlocksReachFinalityAcrossNodes(t *testing.T) {
+	alice := testWallet(t, "alice")
+	net := NewNetwork(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// each node holds one of two equally staked validators, so neither can
+	// finalize a block alone
+	var nodes [2]*Node
+	var validators [2]*Wallet
+	for i := range nodes {
+		validators[i] = registerTestValidator(t)
+	}
+	for i := range nodes {
+		l, err := OpenLedger("", oneBlockEpochs)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		l.Credit(alice.Address, 200)
+		for _, v := range validators {
+			l.Credit(v.Address, 1)
+		}
+		nodes[i] = NewNode("n", "addr", l)
+		if err := nodes[i].RegisterValidatorWallet(validators[i]); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+		for _, v := range validators {
+			_ = nodes[i].SetStake(v.Address, 1)
+		}
+		nodes[i].JoinNetwork(ctx, net)
+	}
+	bonds := mineBonds(t, nodes[0], 1, validators[:]...)
+	if _, err := nodes[1].ImportBlock(bonds); err != nil {
+		t.Fatalf("import bonds: %v", err)
+	}
+
+	if err := nodes[0].AddTransaction(signedTestTx(t, alice, "bob", 10, 1, 0)); err != nil {
+		t.Fatalf("add tx: %v", err)
+	}
+	block := nodes[0].MineBlock()
+	if block == nil || block.Finalized {
+		t.Fatalf("one validator finalized a block alone: %+v", block)
+	}
+	if _, err := nodes[1].ImportBlock(block); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if votes := nodes[1].Finality.Votes(2); len(votes) == 0 {
+		t.Fatalf("importing node did not vote")
+	}
+
+	// gossip is best effort, so keep republishing each node's own vote until
+	// both have a quorum
+	deadline := time.After(5 * time.Second)
+	for nodes[0].Ledger.FinalizedHeight() != 2 || nodes[1].Ledger.FinalizedHeight() != 2 {
+		for i, n := range nodes {
+			for _, v := range n.Finality.Votes(2) {
+				if v.Validator == validators[i].Address {
+					_ = PublishVote(net, &v)
+				}
+			}
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("block not finalized on both nodes")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if cert, _ := nodes[0].Ledger.FinalityCertificate(2); cert == nil || len(cert.Votes) != 2 {
+		t.Fatalf("unexpected certificate %+v", cert)
+	}
+}
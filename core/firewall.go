@@ -78,8 +78,9 @@ func (f *Firewall) BlockWithOptions(ip string, opts RuleOptions) {
 }
 
 // IsAllowed returns true if the given IP address is permitted by the firewall.
-// If no allow rules are defined, the firewall defaults to allowing all addresses
-// not explicitly blocked.
+// Addresses without an explicit rule fall back to the default policy, which
+// allows everything not explicitly blocked unless SetDefaultAllow(false) is
+// used.
 func (f *Firewall) IsAllowed(ip string) bool {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -89,15 +90,12 @@ func (f *Firewall) IsAllowed(ip string) bool {
 		f.blocked[ip] = rec
 		return false
 	}
-	if len(f.allowed) == 0 {
-		return f.defaultAllow
-	}
-	rec, ok := f.allowed[ip]
-	if ok {
+	if rec, ok := f.allowed[ip]; ok {
 		rec.hits++
 		f.allowed[ip] = rec
+		return true
 	}
-	return ok
+	return f.defaultAllow
 }
 
 // Rules returns the current allow and block lists for inspection.
@@ -46,3 +46,13 @@ func (f *FullNode) CurrentMode() FullNodeMode {
 func (f *FullNode) IsArchive() bool {
 	return f.CurrentMode() == FullNodeModeArchive
 }
+
+// LedgerOption returns the ledger history option matching the node's mode.
+// Pruned nodes keep the bodies and state diffs of the most recent keep blocks,
+// while archive nodes keep everything and ignore keep.
+func (f *FullNode) LedgerOption(keep int) LedgerOption {
+	if f.IsArchive() {
+		return WithHistory(HistoryArchive, 0)
+	}
+	return WithHistory(HistoryPruned, keep)
+}
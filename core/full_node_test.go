@@ -45,3 +45,16 @@ func TestFullNode_ModeConcurrency(t *testing.T) {
 		t.Fatalf("unexpected mode after concurrent updates: %v", m)
 	}
 }
+
+func TestFullNodeLedgerOption(t *testing.T) {
+	fn := NewFullNode(nodes.Address("f1"), FullNodeModePruned)
+	l, _ := OpenLedger("", fn.LedgerOption(32))
+	if mode, keep := l.History(); mode != HistoryPruned || keep != 32 {
+		t.Fatalf("unexpected pruned history %v %d", mode, keep)
+	}
+	fn.SetMode(FullNodeModeArchive)
+	l, _ = OpenLedger("", fn.LedgerOption(32))
+	if mode, _ := l.History(); mode != HistoryArchive {
+		t.Fatalf("unexpected archive history %v", mode)
+	}
+}
@@ -29,6 +29,11 @@ func (n *Node) InitGenesis(wallets GenesisWallets) (GenesisStats, *Block, error)
 	n.Ledger.Credit(wallets.CreatorWallet, GenesisAllocation)
 	sb := NewGenesisSubBlock(wallets.Genesis)
 	block := NewBlock([]*SubBlock{sb}, "")
+	root, err := n.Ledger.ComputeStateRoot(block)
+	if err != nil {
+		return GenesisStats{}, nil, err
+	}
+	block.StateRoot = root
 	n.Consensus.MineBlock(block, 1)
 	n.Blockchain = append(n.Blockchain, block)
 	if err := n.Ledger.AddBlock(block); err != nil {
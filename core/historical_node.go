@@ -2,7 +2,10 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"sync"
+	"time"
+
 	nodes "synnergy/internal/nodes"
 )
 
@@ -75,3 +78,27 @@ func (h *HistoricalNode) PruneBelow(height uint64) {
 		}
 	}
 }
+
+// ArchiveLedger archives the headers of the ledger's blocks from height from up
+// to the head, skipping heights that are already archived, and returns how many
+// were added. Headers outlive block bodies on pruned ledgers, so a historical
+// node can keep indexing a chain its full nodes prune.
+func (h *HistoricalNode) ArchiveLedger(l *Ledger, from uint64) (int, error) {
+	height, _ := l.Head()
+	added := 0
+	for hgt := max(from, 1); hgt <= uint64(height); hgt++ {
+		if _, ok := h.GetBlockByHeight(hgt); ok {
+			continue
+		}
+		header, ok := l.GetHeader(int(hgt))
+		if !ok {
+			return added, fmt.Errorf("header %d missing from ledger", hgt)
+		}
+		summary := nodes.BlockSummary{Height: hgt, Hash: header.Hash, Timestamp: time.Unix(header.Timestamp, 0)}
+		if err := h.ArchiveBlock(summary); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, nil
+}
@@ -48,3 +48,20 @@ func TestHistoricalNode_PruneBelow(t *testing.T) {
 		t.Fatalf("pruned block should be removed")
 	}
 }
+
+func TestHistoricalNode_ArchiveLedger(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	l, _ := OpenLedger("", WithHistory(HistoryPruned, 1))
+	l.Credit(alice.Address, 10)
+	blocks := addSealedTestBlocks(t, l, validator, alice, 3)
+	hn := NewHistoricalNode()
+	if n, err := hn.ArchiveLedger(l, 0); err != nil || n != 3 {
+		t.Fatalf("archive ledger: %d %v", n, err)
+	}
+	if s, ok := hn.GetBlockByHeight(1); !ok || s.Hash != blocks[0].Hash {
+		t.Fatalf("pruned block header not archived")
+	}
+	if n, _ := hn.ArchiveLedger(l, 0); n != 0 {
+		t.Fatalf("expected archived heights to be skipped, added %d", n)
+	}
+}
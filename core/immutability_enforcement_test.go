@@ -3,8 +3,8 @@ package core
 import "testing"
 
 func TestImmutabilityEnforcer(t *testing.T) {
-	genesis := &Block{Hash: "gen"}
 	l := NewLedger()
+	genesis := sealTestBlock(t, l, &Block{Hash: "gen"})
 	if err := l.AddBlock(genesis); err != nil {
 		t.Fatalf("add block: %v", err)
 	}
@@ -20,8 +20,16 @@ func TestImmutabilityEnforcer(t *testing.T) {
 	if err := enforcer.CheckLedger(empty); err != ErrGenesisMissing {
 		t.Fatalf("expected ErrGenesisMissing, got %v", err)
 	}
-	// modify genesis hash to trigger failure
-	l.blocks[0].Hash = "other"
+	// modify the stored genesis hash to trigger failure
+	l.mu.Lock()
+	if err := l.putBlockLocked(1, &Block{Hash: "other"}); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	if err := l.store.Write(l.batch); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	l.discardLocked()
+	l.mu.Unlock()
 	if err := enforcer.CheckLedger(l); err != ErrGenesisChanged {
 		t.Fatalf("expected mismatch error")
 	}
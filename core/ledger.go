@@ -1,10 +1,12 @@
 package core
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"sync"
 )
 
@@ -13,70 +15,135 @@ var (
 	ErrNilBlock = errors.New("nil block")
 	// ErrNilTransaction is returned when a nil transaction is supplied.
 	ErrNilTransaction = errors.New("nil transaction")
+	// ErrNonceTooLow is returned when a transaction reuses a nonce the sender
+	// has already consumed, for example when a signed transaction is replayed.
+	ErrNonceTooLow = errors.New("nonce too low")
+	// ErrNonceGap is returned when a transaction skips ahead of the sender's
+	// next expected nonce.
+	ErrNonceGap = errors.New("nonce gap")
+	// ErrBadSignature is returned when a transaction is unsigned, its signer's
+	// public key is unknown, or the signature does not verify.
+	ErrBadSignature = errors.New("bad signature")
 )
 
-// Ledger maintains account balances and block history. It persists blocks to a
-// simple write-ahead log so that a node can recover on restart. The WAL path is
-// optional; if empty the ledger operates purely in memory.
 // UTXO represents an unspent transaction output owned by an address.
 type UTXO struct {
 	ID     string `json:"id"`
 	Amount uint64 `json:"amount"`
 }
 
-// Ledger maintains account balances, a simple UTXO view and block history. It
-// persists blocks to a simple write-ahead log so that a node can recover on
-// restart. The WAL path is optional; if empty the ledger operates purely in
-// memory.
+// Ledger maintains account balances, a simple UTXO view and block history.
+// State lives in a StateStore; by default a volatile in-memory store is used,
+// while WithStateStore plugs in a persistent backend such as FileStateStore so
+// that large account sets and block history stay on disk. Every mutation is
+// first appended to the optional write-ahead log and then committed to the
+// store as one atomic batch, which also records how many WAL entries the store
+// reflects so recovery only replays what the store is missing.
 type Ledger struct {
-	mu        sync.RWMutex
-	balances  map[string]uint64
-	blocks    []*Block
-	walPath   string
-	utxos     map[string][]*UTXO
-	mempool   []*Transaction
-	nextUTXO  uint64
-	frozen    map[string]uint64
-	contracts map[string]LedgerContract
-}
-
-// NewLedger creates a new ledger. If a path is supplied it will replay any
-// existing WAL file to restore previous blocks.
+	mu      sync.RWMutex
+	store   StateStore
+	batch   *StateBatch
+	walPath string
+	walSeq  uint64
+	dirty   map[string]struct{}
+	mempool *Mempool
+
+	checkpointEvery int
+	sinceCheckpoint int
+
+	undo          *blockUndo
+	maxReorgDepth int
+	history       HistoryMode
+	retainBlocks  int
+
+	feeMarket *FeeMarket
+	exec      *blockExec
+	evidence  EvidenceParams
+	staking   StakingParams
+
+	subMu      sync.Mutex
+	reorgSubs  map[uint64]chan ReorgEvent
+	reorgSubID uint64
+}
+
+// LedgerOption configures optional behaviour of a Ledger.
+type LedgerOption func(*Ledger)
+
+// WithStateStore backs the ledger with the provided store. The ledger takes
+// ownership of the store and closes it in Close.
+func WithStateStore(s StateStore) LedgerOption {
+	return func(l *Ledger) {
+		if s != nil {
+			l.store = s
+		}
+	}
+}
+
+// NewLedger creates a new ledger. If a path is supplied the write-ahead log is
+// replayed to rebuild state. Because a node must not start on top of state it
+// cannot reproduce, NewLedger panics when recovery fails; callers that want to
+// handle recovery errors should use OpenLedger instead.
 func NewLedger(path ...string) *Ledger {
-	l := &Ledger{
-		balances:  make(map[string]uint64),
-		blocks:    []*Block{},
-		utxos:     make(map[string][]*UTXO),
-		mempool:   []*Transaction{},
-		frozen:    make(map[string]uint64),
-		contracts: make(map[string]LedgerContract),
+	if len(path) > 0 && path[0] != "" {
+		l, err := OpenLedger(path[0])
+		if err != nil {
+			panic(err)
+		}
+		return l
 	}
-	if len(path) > 0 {
-		l.walPath = path[0]
-		l.replayWAL()
+	return newLedger()
+}
+
+// OpenLedger creates a ledger backed by the write-ahead log at path. Records
+// not yet reflected in the state store are re-executed and the result is
+// compared with the checkpoints stored in the log. A corrupt or truncated log
+// yields a *WALError and a divergent replay, or a store that is ahead of the
+// log, yields ErrStateMismatch.
+func OpenLedger(path string, opts ...LedgerOption) (*Ledger, error) {
+	l := newLedger(opts...)
+	seq, err := l.loadUintLocked(keyMetaWALSeq)
+	if err != nil {
+		return nil, err
 	}
-	return l
+	l.walSeq = seq
+	if path == "" {
+		return l, nil
+	}
+	if err := l.replayWAL(path); err != nil {
+		return nil, err
+	}
+	l.walPath = path
+	return l, nil
 }
 
-// replayWAL loads blocks from the write-ahead log if configured. Errors are
-// ignored which keeps recovery best-effort.
-func (l *Ledger) replayWAL() {
-	if l.walPath == "" {
-		return
+func newLedger(opts ...LedgerOption) *Ledger {
+	l := &Ledger{
+		batch:           NewStateBatch(),
+		checkpointEvery: DefaultCheckpointInterval,
+		maxReorgDepth:   DefaultMaxReorgDepth,
+		retainBlocks:    DefaultRetainBlocks,
+		evidence:        DefaultEvidenceParams(),
+		staking:         DefaultStakingParams(),
 	}
-	f, err := os.Open(l.walPath)
-	if err != nil {
-		return
+	for _, opt := range opts {
+		opt(l)
 	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	for {
-		var b Block
-		if err := dec.Decode(&b); err != nil {
-			break
-		}
-		l.blocks = append(l.blocks, &b)
+	if l.history == HistoryPruned {
+		// a reorg needs the bodies and diffs of every block it rolls back
+		l.maxReorgDepth = min(l.maxReorgDepth, l.retainBlocks)
 	}
+	if l.store == nil {
+		l.store = NewMemoryStateStore()
+	}
+	l.mempool = NewMempool(l)
+	return l
+}
+
+// Close releases the underlying state store.
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.store.Close()
 }
 
 // LedgerContract stores metadata about deployed smart contracts.
@@ -86,6 +153,11 @@ type LedgerContract struct {
 	Manifest string `json:"manifest"`
 	GasLimit uint64 `json:"gas_limit"`
 	WASM     []byte `json:"wasm"`
+	Salt     []byte `json:"salt,omitempty"`
+
+	Version  int               `json:"version,omitempty"`
+	Policy   *UpgradePolicy    `json:"upgrade_policy,omitempty"`
+	Upgrades []ContractUpgrade `json:"upgrades,omitempty"`
 }
 
 // RegisterContract persists contract metadata on the ledger. The WASM bytecode
@@ -100,75 +172,153 @@ func (l *Ledger) RegisterContract(rec LedgerContract) {
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.contracts[rec.Address] = rec
+	l.putJSONLocked(keyContractPrefix+rec.Address, rec)
+	_ = l.commitLocked(walRecord{Kind: walKindContract, Contract: &rec})
 }
 
 // Contracts returns a copy of the registered contracts.
 func (l *Ledger) Contracts() []LedgerContract {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	out := make([]LedgerContract, 0, len(l.contracts))
-	for _, rec := range l.contracts {
-		wasm := make([]byte, len(rec.WASM))
-		copy(wasm, rec.WASM)
-		out = append(out, LedgerContract{
-			Address:  rec.Address,
-			Owner:    rec.Owner,
-			Manifest: rec.Manifest,
-			GasLimit: rec.GasLimit,
-			WASM:     wasm,
-		})
+	out := make([]LedgerContract, 0)
+	it := l.store.Iterate([]byte(keyContractPrefix))
+	for it.Next() {
+		var rec LedgerContract
+		if err := json.Unmarshal(it.Value(), &rec); err != nil {
+			continue
+		}
+		out = append(out, rec)
 	}
 	return out
 }
 
-// appendWAL writes a block to the WAL if a path is configured.
-func (l *Ledger) appendWAL(b *Block) {
-	if l.walPath == "" {
-		return
-	}
-	f, err := os.OpenFile(l.walPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(b)
-}
-
 // Head returns the current height and hash of the latest block.
 func (l *Ledger) Head() (int, string) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	height := len(l.blocks)
+	height := l.heightLocked()
 	if height == 0 {
 		return 0, ""
 	}
-	return height, l.blocks[height-1].Hash
+	b, ok := l.blockLocked(height)
+	if !ok {
+		return height, ""
+	}
+	return height, b.Hash
 }
 
 // GetBlock returns the block at the provided 1-indexed height.
 func (l *Ledger) GetBlock(height int) (*Block, bool) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	if height <= 0 || height > len(l.blocks) {
+	if height <= 0 || height > l.heightLocked() {
 		return nil, false
 	}
-	return l.blocks[height-1], true
+	return l.blockLocked(height)
 }
 
-// AddBlock appends a block to the chain and persists it to the WAL.
-// A nil block returns an error and is ignored.
+// AddBlock executes the transactions of every sub-block, appends the block to
+// the chain and persists it to the WAL. Transactions that fail (for example
+// because the sender is short of funds) are skipped so that replaying the same
+// block always produces the same state. A nil block returns an error and is
+// ignored.
 func (l *Ledger) AddBlock(b *Block) error {
 	if b == nil {
 		return ErrNilBlock
 	}
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.blocks = append(l.blocks, b)
-	l.appendWAL(b)
+	err := l.addBlockLocked(b)
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// transactions included in the block are now stale in the pool
+	l.mempool.Prune()
 	return nil
 }
 
+func (l *Ledger) addBlockLocked(b *Block) error {
+	if err := l.applyBlockLocked(b); err != nil {
+		l.discardLocked()
+		return err
+	}
+	if err := l.commitLocked(walRecord{Kind: walKindBlock, Block: b}); err != nil {
+		return err
+	}
+	l.sinceCheckpoint++
+	if l.checkpointEvery > 0 && l.sinceCheckpoint >= l.checkpointEvery {
+		if _, err := l.checkpointLocked(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyBlockLocked checks the block's base fee and gas use, executes its
+// transactions, checks the resulting state root against the one declared by
+// the block and appends it to the chain together with the undo record needed
+// to roll it back. Callers must hold l.mu.
+func (l *Ledger) applyBlockLocked(b *Block) error {
+	if err := l.checkBlockFeesLocked(b); err != nil {
+		return err
+	}
+	height := l.heightLocked() + 1
+	if err := l.checkEvidenceLocked(b, height); err != nil {
+		return err
+	}
+	if err := l.checkLivenessLocked(b, height); err != nil {
+		return err
+	}
+	l.undo = &blockUndo{seen: make(map[string]struct{})}
+	defer func() { l.undo = nil }()
+	l.executeBlockLocked(b)
+	root, err := l.updateStateRootLocked()
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(root[:]); b.StateRoot != got {
+		return fmt.Errorf("%w: block declares %s, execution produced %s", ErrStateRootMismatch, b.StateRoot, got)
+	}
+	if err := l.putBlockLocked(height, b); err != nil {
+		return err
+	}
+	entries := l.undo.entries
+	l.undo = nil
+	if err := l.putJSONLocked(undoKey(height), entries); err != nil {
+		return err
+	}
+	return l.pruneLocked(height)
+}
+
+// executeBlockLocked updates staking for the block and records the evidence
+// and liveness votes it carries, then applies its transactions in order at
+// the block's base fee, skipping any that fail, and records a receipt for
+// each of them at the block's height.
+func (l *Ledger) executeBlockLocked(b *Block) {
+	height := l.heightLocked() + 1
+	defer func() { l.exec = nil }()
+	l.beginBlockStakingLocked(b, height)
+	l.recordEvidenceLocked(b)
+	l.recordLivenessLocked(b, height)
+	l.beaconBlockLocked(b, height)
+	for _, sb := range b.SubBlocks {
+		if sb == nil {
+			continue
+		}
+		l.exec = &blockExec{baseFee: b.BaseFee, validator: sb.Validator}
+		for _, tx := range sb.Transactions {
+			r := &Receipt{Status: ReceiptSuccess, Timestamp: b.Timestamp, BlockHeight: height}
+			if tx != nil {
+				r.TxID = tx.ID
+			}
+			if err := l.applyTransactionLocked(tx); err != nil {
+				r.Status, r.Details = ReceiptFailed, err.Error()
+			}
+			_ = l.recordReceiptLocked(r)
+		}
+	}
+}
+
 // HasBlock reports whether a block with the given hash exists on the ledger.
 func (l *Ledger) HasBlock(hash string) bool {
 	if hash == "" {
@@ -176,30 +326,24 @@ func (l *Ledger) HasBlock(hash string) bool {
 	}
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	for _, b := range l.blocks {
-		if b != nil && b.Hash == hash {
-			return true
-		}
-	}
-	return false
+	_, ok := l.getLocked(keyBlockHashPrefix + hash)
+	return ok
 }
 
 // GetBalance returns the balance for a given address.
 func (l *Ledger) GetBalance(addr string) uint64 {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	return l.balances[addr]
+	return l.balanceLocked(addr)
 }
 
 // GetUTXOs returns a copy of the unspent outputs for an address.
 func (l *Ledger) GetUTXOs(addr string) []UTXO {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	outs := l.utxos[addr]
+	outs := l.utxosLocked(addr)
 	res := make([]UTXO, len(outs))
-	for i, u := range outs {
-		res[i] = *u
-	}
+	copy(res, outs)
 	return res
 }
 
@@ -211,8 +355,12 @@ func (l *Ledger) Credit(addr string, amount uint64) {
 	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.balances[addr] += amount
-	l.updateUTXO(addr)
+	l.creditLocked(addr, amount)
+	_ = l.commitLocked(walRecord{Kind: walKindCredit, Addr: addr, Amount: amount})
+}
+
+func (l *Ledger) creditLocked(addr string, amount uint64) {
+	l.setBalanceLocked(addr, l.balanceLocked(addr)+amount)
 }
 
 // Mint is an exported helper that credits funds to an address. It mirrors the
@@ -221,9 +369,10 @@ func (l *Ledger) Mint(addr string, amount uint64) {
 	l.Credit(addr, amount)
 }
 
-// Transfer moves funds from one address to another. A fee is deducted from the
-// sender. It validates the addresses and amount before applying the
-// transaction.
+// Transfer moves funds from one address to another on behalf of trusted
+// in-process callers such as bridges, reversals and operator tooling. A fee is
+// deducted from the sender. Unlike ApplyTransaction it neither requires a
+// signature nor consumes the sender's nonce.
 func (l *Ledger) Transfer(from, to string, amount, fee uint64) error {
 	if from == "" || to == "" {
 		return ErrEmptyAddress
@@ -231,14 +380,73 @@ func (l *Ledger) Transfer(from, to string, amount, fee uint64) error {
 	if amount == 0 {
 		return errors.New("amount must be > 0")
 	}
-	tx := NewTransaction(from, to, amount, fee, 0)
-	return l.ApplyTransaction(tx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.transferLocked(from, to, amount, fee); err != nil {
+		return err
+	}
+	return l.commitLocked(walRecord{Kind: walKindTransfer, Addr: from, To: to, Amount: amount, Fee: fee})
 }
 
-// ApplyTransaction applies a transaction to the ledger, deducting both amount
-// and fee from the sender. It returns an error if the sender lacks sufficient
-// funds.
-func (l *Ledger) ApplyTransaction(tx *Transaction) error {
+// Nonce returns the nonce the next transaction from addr must carry.
+func (l *Ledger) Nonce(addr string) uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.nonceLocked(addr)
+}
+
+// PublicKey returns the public key registered for addr, if any.
+func (l *Ledger) PublicKey(addr string) (*ecdsa.PublicKey, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	raw, ok := l.getLocked(keyPubKeyPrefix + addr)
+	if !ok {
+		return nil, false
+	}
+	pub, err := decodePublicKey(raw)
+	if err != nil {
+		return nil, false
+	}
+	return pub, true
+}
+
+// RegisterPublicKey records pub as the signing key of the address derived
+// from it. Registering the same key again is a no-op; a different key for an
+// address that already has one is rejected.
+func (l *Ledger) RegisterPublicKey(pub *ecdsa.PublicKey) error {
+	raw := encodePublicKey(pub)
+	if raw == nil {
+		return errors.New("public key required")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	addr := deriveAddress(pub)
+	if cur, ok := l.getLocked(keyPubKeyPrefix + addr); ok {
+		if !bytes.Equal(cur, raw) {
+			return fmt.Errorf("public key already registered for %s", addr)
+		}
+		return nil
+	}
+	l.setLocked(keyPubKeyPrefix+addr, raw)
+	return l.commitLocked(walRecord{Kind: walKindPubKey, Addr: addr, Key: raw})
+}
+
+// CheckSignature verifies tx against its sender's registered public key, or
+// against tx.PublicKey for a sender that has not registered one yet.
+func (l *Ledger) CheckSignature(tx *Transaction) error {
+	if tx == nil {
+		return ErrNilTransaction
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.discardLocked()
+	return l.verifySignatureLocked(tx)
+}
+
+// ValidateTransaction reports whether tx could be applied to the current
+// state: its signature must verify, its nonce must be the sender's next nonce
+// and the sender must hold amount plus fee. Nothing is modified.
+func (l *Ledger) ValidateTransaction(tx *Transaction) error {
 	if tx == nil {
 		return ErrNilTransaction
 	}
@@ -247,47 +455,141 @@ func (l *Ledger) ApplyTransaction(tx *Transaction) error {
 	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	total := uint64(tx.Amount + tx.Fee)
-	if l.balances[tx.From] < total {
-		return errors.New("insufficient funds")
-	}
-	l.balances[tx.From] -= total
-	l.balances[tx.To] += uint64(tx.Amount)
-	l.updateUTXO(tx.From)
-	l.updateUTXO(tx.To)
-	return nil
+	defer l.discardLocked()
+	return l.applyTransactionLocked(tx)
 }
 
-// AddToPool appends a transaction to the mem-pool. Nil transactions are
-// ignored.
-func (l *Ledger) AddToPool(tx *Transaction) {
+// ApplyTransaction applies a signed transaction to the ledger, deducting both
+// amount and fee from the sender and advancing the sender's nonce. The
+// signature is checked against the sender's registered public key and the
+// nonce must equal Nonce(tx.From); failures are reported as ErrBadSignature,
+// ErrNonceTooLow or ErrNonceGap before any balance is moved. It also returns
+// an error if the sender lacks sufficient funds.
+func (l *Ledger) ApplyTransaction(tx *Transaction) error {
 	if tx == nil {
-		return
+		return ErrNilTransaction
+	}
+	if tx.From == "" || tx.To == "" {
+		return ErrEmptyAddress
 	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.mempool = append(l.mempool, tx)
+	if err := l.applyTransactionLocked(tx); err != nil {
+		l.discardLocked()
+		return err
+	}
+	return l.commitLocked(walRecord{Kind: walKindTx, Tx: tx})
 }
 
-// Pool returns a snapshot of the current mem-pool transactions.
-func (l *Ledger) Pool() []*Transaction {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	out := make([]*Transaction, len(l.mempool))
-	copy(out, l.mempool)
-	return out
+func (l *Ledger) applyTransactionLocked(tx *Transaction) error {
+	if tx == nil {
+		return ErrNilTransaction
+	}
+	if tx.From == "" || tx.To == "" {
+		return ErrEmptyAddress
+	}
+	if err := l.verifySignatureLocked(tx); err != nil {
+		return err
+	}
+	switch tx.Type {
+	case TxTypeBond:
+		return l.applyBondLocked(tx)
+	case TxTypeUnbond:
+		return l.applyUnbondLocked(tx)
+	case TxTypeRedelegate:
+		return l.applyRedelegateLocked(tx)
+	case TxTypeWithdrawRewards:
+		return l.applyWithdrawRewardsLocked(tx)
+	case TxTypeCommission:
+		return l.applyCommissionLocked(tx)
+	default:
+		return l.applyTransferLocked(tx)
+	}
 }
 
-func (l *Ledger) newUTXO(amount uint64) *UTXO {
-	u := &UTXO{ID: fmt.Sprintf("u%d", l.nextUTXO), Amount: amount}
-	l.nextUTXO++
-	return u
+// applyTransferLocked applies the nonce, amount and fee of a transaction whose
+// signature has been checked.
+func (l *Ledger) applyTransferLocked(tx *Transaction) error {
+	if err := l.chargeLocked(tx, tx.Amount); err != nil {
+		return err
+	}
+	l.setBalanceLocked(tx.To, l.balanceLocked(tx.To)+tx.Amount)
+	return nil
 }
 
-func (l *Ledger) updateUTXO(addr string) {
-	if l.balances[addr] == 0 {
-		delete(l.utxos, addr)
-		return
+// chargeLocked checks the nonce of a transaction whose signature has been
+// checked, debits amount and its fees from the sender, advances the sender's
+// nonce and pays the fees. The fee is priced at the current base fee, see
+// Transaction.FeeAt.
+func (l *Ledger) chargeLocked(tx *Transaction, amount uint64) error {
+	next := l.nonceLocked(tx.From)
+	switch {
+	case tx.Nonce < next:
+		return fmt.Errorf("%w: account %s expects %d, got %d", ErrNonceTooLow, tx.From, next, tx.Nonce)
+	case tx.Nonce > next:
+		return fmt.Errorf("%w: account %s expects %d, got %d", ErrNonceGap, tx.From, next, tx.Nonce)
 	}
-	l.utxos[addr] = []*UTXO{l.newUTXO(l.balances[addr])}
+	base, tip, err := tx.FeeAt(l.txBaseFeeLocked())
+	if err != nil {
+		return err
+	}
+	total := amount + base + tip
+	fromBal := l.balanceLocked(tx.From)
+	if fromBal < total || total < amount {
+		return errors.New("insufficient funds")
+	}
+	l.setBalanceLocked(tx.From, fromBal-total)
+	l.setUintLocked(keyNoncePrefix+tx.From, next+1)
+	l.payFeesLocked(base, tip)
+	return nil
 }
+
+// verifySignatureLocked checks tx against the sender's registered key. A
+// sender without a key may supply one in tx.PublicKey; it is registered as part
+// of the transaction when it hashes to the sender's address.
+func (l *Ledger) verifySignatureLocked(tx *Transaction) error {
+	if len(tx.Signature) == 0 {
+		return fmt.Errorf("%w: transaction is unsigned", ErrBadSignature)
+	}
+	raw, registered := l.getLocked(keyPubKeyPrefix + tx.From)
+	if !registered {
+		if len(tx.PublicKey) == 0 {
+			return fmt.Errorf("%w: no public key registered for %s", ErrBadSignature, tx.From)
+		}
+		raw = tx.PublicKey
+	}
+	pub, err := decodePublicKey(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if !registered && deriveAddress(pub) != tx.From {
+		return fmt.Errorf("%w: public key does not match %s", ErrBadSignature, tx.From)
+	}
+	if !VerifySignature(tx, tx.Signature, pub) {
+		return fmt.Errorf("%w: signature does not verify for %s", ErrBadSignature, tx.From)
+	}
+	if !registered {
+		l.setLocked(keyPubKeyPrefix+tx.From, raw)
+	}
+	return nil
+}
+
+// AddToPool checks the signature of a transaction and queues it in the
+// ledger's mem-pool, which orders it against the ledger's nonces and balances.
+// The check keeps a forged transaction from replacing a queued one with the
+// same sender and nonce. See Mempool.Add.
+func (l *Ledger) AddToPool(tx *Transaction) error {
+	if err := l.CheckSignature(tx); err != nil {
+		return err
+	}
+	return l.mempool.Add(tx)
+}
+
+// Pool returns a snapshot of the current mem-pool transactions ordered by
+// sender and nonce.
+func (l *Ledger) Pool() []*Transaction {
+	return l.mempool.Transactions()
+}
+
+// Mempool returns the ledger's transaction pool.
+func (l *Ledger) Mempool() *Mempool { return l.mempool }
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// The randomness beacon gives every epoch a seed that slot leaders prove
+// their VRF outputs against. The verified VRF outputs of an epoch's blocks
+// are folded into an accumulator in block order, and when the next epoch
+// starts its seed is the hash of the previous seed and that accumulator. A
+// seed is therefore fixed before any of its slots and unknown until the epoch
+// before it has ended, and no single validator controls more than its own
+// VRF outputs. Chains whose blocks never carried a VRF proof keep the genesis
+// seed. Seeds and accumulators live in the state trie.
+
+const (
+	keyBeaconPrefix     = "beacon/"
+	keyBeaconSeedPrefix = keyBeaconPrefix + "seed/"
+	keyBeaconAccPrefix  = keyBeaconPrefix + "acc/"
+)
+
+var genesisBeaconSeed = sha256.Sum256([]byte("synnergy/beacon/genesis"))
+
+func beaconSeedKey(epoch int) string { return fmt.Sprintf("%s%016x", keyBeaconSeedPrefix, epoch) }
+
+func beaconAccKey(epoch int) string { return fmt.Sprintf("%s%016x", keyBeaconAccPrefix, epoch) }
+
+// RandomnessAt returns the randomness seed of the epoch containing height.
+// The seed of the epoch starting with the next block is already known. It
+// reports false for heights in later epochs.
+func (l *Ledger) RandomnessAt(height int) ([]byte, bool) {
+	if height <= 0 {
+		return nil, false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	epoch := (height - 1) / l.staking.EpochLength
+	if epoch > l.heightLocked()/l.staking.EpochLength {
+		return nil, false
+	}
+	return l.beaconSeedLocked(epoch), true
+}
+
+// beaconSeedLocked returns the seed of epoch, deriving it from the previous
+// epoch when it has not been stored yet.
+func (l *Ledger) beaconSeedLocked(epoch int) []byte {
+	if seed, ok := l.getLocked(beaconSeedKey(epoch)); ok {
+		return seed
+	}
+	if epoch > 0 {
+		_, seeded := l.getLocked(beaconSeedKey(epoch - 1))
+		acc, ok := l.getLocked(beaconAccKey(epoch - 1))
+		if seeded || ok {
+			h := sha256.New()
+			h.Write([]byte("synnergy/beacon\x00"))
+			h.Write(l.beaconSeedLocked(epoch - 1))
+			h.Write(acc)
+			return h.Sum(nil)
+		}
+	}
+	return genesisBeaconSeed[:]
+}
+
+// beaconBlockLocked runs before the transactions of the block at height: at
+// the first block of an epoch it stores the epoch's seed, then it folds the
+// VRF outputs of b's sub-blocks that verify against the seed into the
+// epoch's accumulator. Invalid proofs are left out.
+func (l *Ledger) beaconBlockLocked(b *Block, height int) {
+	epoch := (height - 1) / l.staking.EpochLength
+	if epoch > 0 && (height-1)%l.staking.EpochLength == 0 {
+		_, seeded := l.getLocked(beaconSeedKey(epoch - 1))
+		if _, ok := l.getLocked(beaconAccKey(epoch - 1)); seeded || ok {
+			l.setLocked(beaconSeedKey(epoch), l.beaconSeedLocked(epoch))
+			l.deleteLocked(beaconAccKey(epoch - 1))
+		}
+	}
+	seed := l.beaconSeedLocked(epoch)
+	for _, sb := range b.SubBlocks {
+		if sb == nil || sb.System || len(sb.VRFProof) == 0 {
+			continue
+		}
+		pub, err := decodePublicKey(sb.ValidatorKey)
+		if err != nil || deriveAddress(pub) != sb.Validator {
+			continue
+		}
+		out, err := VRFVerify(pub, SlotInput(seed, uint64(height)), sb.VRFProof)
+		if err != nil {
+			continue
+		}
+		acc, _ := l.getLocked(beaconAccKey(epoch))
+		sum := sha256.Sum256(append(append([]byte(nil), acc...), out...))
+		l.setLocked(beaconAccKey(epoch), sum[:])
+	}
+}
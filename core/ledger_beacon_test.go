@@ -0,0 +1,70 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRandomnessBeaconAndSlotProofs(t *testing.T) {
+	c := newEvidenceChain(t, WithStakingParams(StakingParams{EpochLength: 2, UnbondingPeriod: 4}))
+	l := c.node.Ledger
+	genesis, ok := l.RandomnessAt(1)
+	if !ok || !bytes.Equal(genesis, genesisBeaconSeed[:]) {
+		t.Fatalf("genesis seed: %x %v", genesis, ok)
+	}
+	if _, ok := l.RandomnessAt(3); ok {
+		t.Fatalf("the seed of epoch 1 is not known before epoch 0 ends")
+	}
+
+	b := c.mine(t)
+	sb := b.SubBlocks[0]
+	if len(sb.VRFProof) != VRFProofSize || sb.Validator != c.proposer.Address {
+		t.Fatalf("sub-block carries no slot proof: %+v", sb)
+	}
+	if _, err := VRFVerify(&c.proposer.PublicKey, SlotInput(genesis, 1), sb.VRFProof); err != nil {
+		t.Fatalf("slot proof: %v", err)
+	}
+	c.mine(t)
+	seed, ok := l.RandomnessAt(3)
+	if !ok || bytes.Equal(seed, genesis) {
+		t.Fatalf("epoch 1 seed not derived from the vrf outputs: %x %v", seed, ok)
+	}
+	b = c.mine(t)
+	if stored, _ := l.RandomnessAt(4); !bytes.Equal(stored, seed) {
+		t.Fatalf("epoch seed changed within the epoch")
+	}
+	if _, err := VRFVerify(&c.proposer.PublicKey, SlotInput(seed, 3), b.SubBlocks[0].VRFProof); err != nil {
+		t.Fatalf("slot proof under the epoch seed: %v", err)
+	}
+
+	// every node checks the slot proof
+	forged := NewSlotSubBlock(b.SubBlocks[0].Transactions, c.proposer.Address, 3, sb.VRFProof)
+	if c.node.Consensus.ValidateSubBlock(forged, 3) {
+		t.Fatalf("sub-block with another slot's proof accepted")
+	}
+	if c.node.Consensus.ValidateSubBlock(NewSubBlockAt(b.SubBlocks[0].Transactions, c.proposer.Address, 3), 3) {
+		t.Fatalf("sub-block without a slot proof accepted")
+	}
+	if !c.node.Consensus.ValidateSubBlock(b.SubBlocks[0], 3) {
+		t.Fatalf("mined sub-block rejected")
+	}
+	if c.node.Consensus.ValidateSubBlock(b.SubBlocks[0], 4) {
+		t.Fatalf("sub-block accepted in a block of another height")
+	}
+
+	// a validator with a valid proof but a tiny share of the stake is almost
+	// never below the slot threshold
+	minnow := registerTestValidator(t)
+	if err := c.node.RegisterValidatorWallet(minnow); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	_ = c.node.SetStake(minnow.Address, 1)
+	c.mine(t)
+	c.mine(t)
+	seed, _ = l.RandomnessAt(6)
+	_, proof, _ := VRFProve(minnow.PrivateKey, SlotInput(seed, 6))
+	small := NewSlotSubBlock(b.SubBlocks[0].Transactions, minnow.Address, 6, proof)
+	if c.node.Validators.Stake(minnow.Address) != 1 || c.node.Consensus.ValidateSubBlock(small, 6) {
+		t.Fatalf("sub-block above the slot threshold accepted")
+	}
+}
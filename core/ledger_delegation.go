@@ -0,0 +1,397 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Anyone can delegate stake to a validator by bonding to it. Validators take
+// a commission, set with TxTypeCommission, from the rewards paid to them and
+// the rest is shared among everyone bonded to them in proportion to their
+// stake, the validator's own bond included.
+//
+// Rewards are accounted lazily, F1 style, so that paying a reward costs the
+// same however many delegators a validator has. A validator's history is cut
+// into periods that end whenever the stake bonded to it changes. Ending a
+// period adds the rewards it collected per unit of stake to a cumulative
+// ratio stored for it. A delegator records the period its stake last changed
+// in, and is owed its stake times the growth of the ratio since then. Rewards
+// are settled into the delegation whenever its stake changes and paid out by
+// TxTypeWithdrawRewards.
+//
+// Redelegation moves stake between validators at once, but the stake stays
+// slashable for offences of the source validator for the unbonding period.
+// Stake redelegated into a validator cannot be redelegated again until then.
+
+const (
+	keyValidatorPrefix  = keyStakePrefix + "validator/"
+	keyRatioPrefix      = keyStakePrefix + "ratio/"
+	keyStartPrefix      = keyStakePrefix + "start/"
+	keyRedelegatePrefix = keyStakePrefix + "redelegate/"
+)
+
+// MaxCommission is the commission rate, in basis points, that keeps every
+// reward for the validator.
+const MaxCommission = 10_000
+
+// rewardScale is the fixed point scale of the cumulative reward ratios.
+var rewardScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+func ratioKey(validator string, period uint64) string {
+	return fmt.Sprintf("%s%s/%016x", keyRatioPrefix, validator, period)
+}
+
+func startKey(validator, delegator string) string {
+	return keyStartPrefix + validator + "/" + delegator
+}
+
+func redelegateKey(complete uint64, src, delegator, dst string) string {
+	return fmt.Sprintf("%s%016x/%s/%s/%s", keyRedelegatePrefix, complete, src, delegator, dst)
+}
+
+// validatorRecord is the reward state of a validator. Period is the current,
+// not yet ended, period and Rewards what it has collected so far.
+type validatorRecord struct {
+	Commission uint64 `json:"commission"`
+	Period     uint64 `json:"period"`
+	Rewards    uint64 `json:"rewards"`
+}
+
+// delegationStart is the reward state of a delegation: the last period whose
+// rewards are settled into Accrued.
+type delegationStart struct {
+	Period  uint64 `json:"period"`
+	Accrued uint64 `json:"accrued"`
+}
+
+// ValidatorInfo describes a validator accepting delegations.
+type ValidatorInfo struct {
+	Address    string `json:"address"`
+	Commission uint64 `json:"commission"`
+	Power      uint64 `json:"power"`
+}
+
+// Delegation is stake a delegator has bonded to a validator and the rewards
+// it has earned but not withdrawn.
+type Delegation struct {
+	Delegator string `json:"delegator"`
+	Validator string `json:"validator"`
+	Amount    uint64 `json:"amount"`
+	Rewards   uint64 `json:"rewards"`
+}
+
+// Redelegation is stake moved from Source to Destination at Height that
+// stays slashable for offences of Source until Complete.
+type Redelegation struct {
+	Delegator   string `json:"delegator"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Amount      uint64 `json:"amount"`
+	Height      uint64 `json:"height"`
+	Complete    uint64 `json:"complete"`
+}
+
+// Validator returns the commission and power of validator, and false if it
+// never bonded stake to itself.
+func (l *Ledger) Validator(addr string) (ValidatorInfo, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	rec, ok := l.validatorLocked(addr)
+	if !ok {
+		return ValidatorInfo{}, false
+	}
+	return ValidatorInfo{Address: addr, Commission: rec.Commission, Power: l.uintLocked(keyPowerPrefix + addr)}, true
+}
+
+// Delegations returns the stake delegator has bonded to each validator and
+// the rewards it has earned there, ordered by validator. Delegations fully
+// unbonded whose rewards were not withdrawn are included.
+func (l *Ledger) Delegations(delegator string) []Delegation {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []Delegation
+	for _, e := range l.scanLocked(keyStartPrefix) {
+		validator, d, ok := strings.Cut(strings.TrimPrefix(e.Key, keyStartPrefix), "/")
+		if !ok || d != delegator {
+			continue
+		}
+		out = append(out, Delegation{
+			Delegator: delegator,
+			Validator: validator,
+			Amount:    l.uintLocked(bondKey(validator, delegator)),
+			Rewards:   l.rewardsLocked(validator, delegator),
+		})
+	}
+	return out
+}
+
+// Rewards returns the rewards the stake delegator bonded to validator has
+// earned and not withdrawn, including those of the current period.
+func (l *Ledger) Rewards(delegator, validator string) uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.rewardsLocked(validator, delegator)
+}
+
+// Redelegations returns the redelegations of delegator that are still
+// slashable, ordered by completion height.
+func (l *Ledger) Redelegations(delegator string) []Redelegation {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []Redelegation
+	for _, r := range l.redelegationsLocked() {
+		if r.Delegator == delegator {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// DistributeReward pays amount to validator. The validator's commission is
+// credited to it and the rest shared among the stake bonded to it. Addresses
+// without bonded stake are credited the whole amount.
+func (l *Ledger) DistributeReward(validator string, amount uint64) error {
+	if validator == "" || amount == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rewardLocked(validator, amount)
+	return l.commitLocked(walRecord{Kind: walKindReward, Addr: validator, Amount: amount})
+}
+
+func (l *Ledger) rewardLocked(validator string, amount uint64) {
+	rec, ok := l.validatorLocked(validator)
+	if !ok || l.uintLocked(keyPowerPrefix+validator) == 0 {
+		l.creditLocked(validator, amount)
+		return
+	}
+	// amount*rate/MaxCommission without overflowing
+	commission := amount/MaxCommission*rec.Commission + amount%MaxCommission*rec.Commission/MaxCommission
+	l.creditLocked(validator, commission)
+	rec.Rewards += amount - commission
+	_ = l.putJSONLocked(keyValidatorPrefix+validator, rec)
+}
+
+// validatorLocked returns the reward state of validator, and false if it has
+// none yet.
+func (l *Ledger) validatorLocked(validator string) (validatorRecord, bool) {
+	rec := validatorRecord{Period: 1}
+	raw, ok := l.getLocked(keyValidatorPrefix + validator)
+	if !ok {
+		return rec, false
+	}
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return validatorRecord{Period: 1}, false
+	}
+	return rec, true
+}
+
+func (l *Ledger) startLocked(validator, delegator string) (delegationStart, bool) {
+	var st delegationStart
+	raw, ok := l.getLocked(startKey(validator, delegator))
+	if !ok {
+		return st, false
+	}
+	return st, json.Unmarshal(raw, &st) == nil
+}
+
+// ratioLocked returns the cumulative reward per unit of stake of validator at
+// the end of period. Period 0 precedes every reward.
+func (l *Ledger) ratioLocked(validator string, period uint64) *big.Int {
+	r := new(big.Int)
+	if period == 0 {
+		return r
+	}
+	if raw, ok := l.getLocked(ratioKey(validator, period)); ok {
+		r.SetString(string(raw), 16)
+	}
+	return r
+}
+
+// accrued returns what stake earned while the cumulative ratio grew from
+// from to to.
+func accrued(stake uint64, from, to *big.Int) uint64 {
+	r := new(big.Int).Sub(to, from)
+	r.Mul(r, new(big.Int).SetUint64(stake))
+	r.Quo(r, rewardScale)
+	if r.Sign() <= 0 {
+		return 0
+	}
+	if !r.IsUint64() {
+		return ^uint64(0)
+	}
+	return r.Uint64()
+}
+
+// endPeriodLocked ends the current period of validator, storing its
+// cumulative ratio, and returns the last ended period. A period without
+// rewards does not change the ratio, so it is left open.
+func (l *Ledger) endPeriodLocked(validator string, rec *validatorRecord) uint64 {
+	if rec.Rewards == 0 {
+		return rec.Period - 1
+	}
+	ended := rec.Period
+	ratio := l.ratioLocked(validator, ended-1)
+	if power := l.uintLocked(keyPowerPrefix + validator); power == 0 {
+		l.creditLocked(validator, rec.Rewards)
+	} else {
+		r := new(big.Int).SetUint64(rec.Rewards)
+		r.Mul(r, rewardScale)
+		ratio.Add(ratio, r.Quo(r, new(big.Int).SetUint64(power)))
+	}
+	l.setLocked(ratioKey(validator, ended), []byte(ratio.Text(16)))
+	rec.Period++
+	rec.Rewards = 0
+	return ended
+}
+
+// settleLocked adds the rewards the delegation earned up to the ended period
+// to its accrued rewards.
+func (l *Ledger) settleLocked(validator, delegator string, ended uint64) delegationStart {
+	st, _ := l.startLocked(validator, delegator)
+	if st.Period != ended {
+		bonded := l.uintLocked(bondKey(validator, delegator))
+		st.Accrued += accrued(bonded, l.ratioLocked(validator, st.Period), l.ratioLocked(validator, ended))
+		st.Period = ended
+	}
+	return st
+}
+
+func (l *Ledger) putStartLocked(validator, delegator string, st delegationStart) {
+	if st.Accrued == 0 && l.uintLocked(bondKey(validator, delegator)) == 0 {
+		l.deleteLocked(startKey(validator, delegator))
+		return
+	}
+	_ = l.putJSONLocked(startKey(validator, delegator), st)
+}
+
+// rewardsLocked computes the unwithdrawn rewards of a delegation without
+// changing state.
+func (l *Ledger) rewardsLocked(validator, delegator string) uint64 {
+	rec, _ := l.validatorLocked(validator)
+	st, _ := l.startLocked(validator, delegator)
+	current := l.ratioLocked(validator, rec.Period-1)
+	if power := l.uintLocked(keyPowerPrefix + validator); power > 0 && rec.Rewards > 0 {
+		r := new(big.Int).SetUint64(rec.Rewards)
+		r.Mul(r, rewardScale)
+		current.Add(current, r.Quo(r, new(big.Int).SetUint64(power)))
+	}
+	bonded := l.uintLocked(bondKey(validator, delegator))
+	return st.Accrued + accrued(bonded, l.ratioLocked(validator, st.Period), current)
+}
+
+// changeBondLocked adds add to and removes sub from the stake delegator
+// bonded to validator, settling the delegation's rewards first.
+func (l *Ledger) changeBondLocked(validator, delegator string, add, sub uint64) {
+	rec, _ := l.validatorLocked(validator)
+	st := l.settleLocked(validator, delegator, l.endPeriodLocked(validator, &rec))
+	bond := bondKey(validator, delegator)
+	l.setUintLocked(bond, l.uintLocked(bond)+add-sub)
+	l.setUintLocked(keyPowerPrefix+validator, l.uintLocked(keyPowerPrefix+validator)+add-sub)
+	l.putStartLocked(validator, delegator, st)
+	_ = l.putJSONLocked(keyValidatorPrefix+validator, rec)
+}
+
+// applyRedelegateLocked moves tx.Amount of the stake the sender bonded to
+// tx.Source over to tx.To.
+func (l *Ledger) applyRedelegateLocked(tx *Transaction) error {
+	src, dst := tx.Source, tx.To
+	if src == "" || src == dst {
+		return fmt.Errorf("%w: redelegation needs distinct source and destination", ErrInvalidStake)
+	}
+	bonded := l.uintLocked(bondKey(src, tx.From))
+	if tx.Amount == 0 || tx.Amount > bonded {
+		return fmt.Errorf("%w: %s has %d bonded to %s, cannot redelegate %d", ErrInvalidStake, tx.From, bonded, src, tx.Amount)
+	}
+	if _, ok := l.validatorLocked(dst); !ok {
+		return fmt.Errorf("%w: %s is not a validator", ErrInvalidStake, dst)
+	}
+	for _, r := range l.redelegationsLocked() {
+		if r.Delegator == tx.From && r.Destination == src {
+			return fmt.Errorf("%w: stake redelegated to %s is slashable for %s until height %d", ErrInvalidStake, src, r.Source, r.Complete)
+		}
+	}
+	if err := l.chargeLocked(tx, 0); err != nil {
+		return err
+	}
+	l.changeBondLocked(src, tx.From, 0, tx.Amount)
+	l.changeBondLocked(dst, tx.From, tx.Amount, 0)
+	height := uint64(l.heightLocked() + 1)
+	r := Redelegation{Delegator: tx.From, Source: src, Destination: dst, Height: height, Complete: height + uint64(l.staking.UnbondingPeriod)}
+	key := redelegateKey(r.Complete, src, tx.From, dst)
+	if raw, ok := l.getLocked(key); ok {
+		_ = json.Unmarshal(raw, &r)
+	}
+	r.Amount += tx.Amount
+	return l.putJSONLocked(key, r)
+}
+
+// applyWithdrawRewardsLocked pays the sender the rewards its stake with
+// tx.To has earned.
+func (l *Ledger) applyWithdrawRewardsLocked(tx *Transaction) error {
+	if _, ok := l.startLocked(tx.To, tx.From); !ok {
+		return fmt.Errorf("%w: %s has no delegation with %s", ErrInvalidStake, tx.From, tx.To)
+	}
+	if err := l.chargeLocked(tx, 0); err != nil {
+		return err
+	}
+	rec, _ := l.validatorLocked(tx.To)
+	st := l.settleLocked(tx.To, tx.From, l.endPeriodLocked(tx.To, &rec))
+	l.creditLocked(tx.From, st.Accrued)
+	st.Accrued = 0
+	l.putStartLocked(tx.To, tx.From, st)
+	return l.putJSONLocked(keyValidatorPrefix+tx.To, rec)
+}
+
+// applyCommissionLocked sets the commission of the sending validator.
+func (l *Ledger) applyCommissionLocked(tx *Transaction) error {
+	if tx.To != tx.From {
+		return fmt.Errorf("%w: %s can only set its own commission", ErrInvalidStake, tx.From)
+	}
+	rec, ok := l.validatorLocked(tx.From)
+	if !ok {
+		return fmt.Errorf("%w: %s is not a validator", ErrInvalidStake, tx.From)
+	}
+	if tx.Amount > MaxCommission {
+		return fmt.Errorf("%w: commission %d exceeds %d", ErrInvalidStake, tx.Amount, MaxCommission)
+	}
+	if err := l.chargeLocked(tx, 0); err != nil {
+		return err
+	}
+	rec.Commission = tx.Amount
+	return l.putJSONLocked(keyValidatorPrefix+tx.From, rec)
+}
+
+func (l *Ledger) redelegationsLocked() []Redelegation {
+	var out []Redelegation
+	for _, e := range l.scanLocked(keyRedelegatePrefix) {
+		var r Redelegation
+		if err := json.Unmarshal(e.Value, &r); err == nil {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// slashRedelegationsLocked burns bps basis points of the stake redelegated
+// away from validator at or after the offence height from its destination.
+// Stake the delegator already unbonded from the destination is out of reach.
+func (l *Ledger) slashRedelegationsLocked(validator string, offence, bps uint64) {
+	for _, e := range l.scanLocked(keyRedelegatePrefix) {
+		var r Redelegation
+		if err := json.Unmarshal(e.Value, &r); err != nil || r.Source != validator || r.Height < offence {
+			continue
+		}
+		kept := slashKept(r.Amount, bps)
+		burn := min(r.Amount-kept, l.uintLocked(bondKey(r.Destination, r.Delegator)))
+		l.changeBondLocked(r.Destination, r.Delegator, 0, burn)
+		if r.Amount = kept; r.Amount == 0 {
+			l.deleteLocked(e.Key)
+			continue
+		}
+		_ = l.putJSONLocked(e.Key, r)
+	}
+}
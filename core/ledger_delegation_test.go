@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// applySigned signs tx with w and applies it to l.
+func applySigned(t *testing.T, l *Ledger, w *Wallet, tx *Transaction) error {
+	t.Helper()
+	if _, err := w.Sign(tx); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return l.ApplyTransaction(tx)
+}
+
+func TestDelegationRewardsFollowStakeAndCommission(t *testing.T) {
+	val, other, alice := testWallet(t, "validator"), testWallet(t, "other"), testWallet(t, "alice")
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, w := range []*Wallet{val, other, alice} {
+		l.Credit(w.Address, 1_000)
+	}
+
+	if err := applySigned(t, l, alice, NewBondTransaction(alice.Address, val.Address, 300, 0, 0)); !errors.Is(err, ErrInvalidStake) {
+		t.Fatalf("expected delegating to a non-validator to fail, got %v", err)
+	}
+	if err := applySigned(t, l, val, NewBondTransaction(val.Address, val.Address, 100, 0, 0)); err != nil {
+		t.Fatalf("self bond: %v", err)
+	}
+	if err := applySigned(t, l, val, NewCommissionTransaction(val.Address, MaxCommission+1, 0, 1)); !errors.Is(err, ErrInvalidStake) {
+		t.Fatalf("expected an excessive commission to fail, got %v", err)
+	}
+	if err := applySigned(t, l, val, NewCommissionTransaction(val.Address, 1_000, 0, 1)); err != nil {
+		t.Fatalf("commission: %v", err)
+	}
+	if err := applySigned(t, l, alice, NewBondTransaction(alice.Address, val.Address, 300, 0, 0)); err != nil {
+		t.Fatalf("delegate: %v", err)
+	}
+	if info, ok := l.Validator(val.Address); !ok || info.Commission != 1_000 || info.Power != 400 {
+		t.Fatalf("validator: %+v %v", info, ok)
+	}
+
+	// 10% commission, the rest split 1:3 by stake
+	if err := l.DistributeReward(val.Address, 1_000); err != nil {
+		t.Fatalf("reward: %v", err)
+	}
+	if l.GetBalance(val.Address) != 1_000 || l.Rewards(val.Address, val.Address) != 225 || l.Rewards(alice.Address, val.Address) != 675 {
+		t.Fatalf("first reward: balance %d, rewards %d/%d", l.GetBalance(val.Address), l.Rewards(val.Address, val.Address), l.Rewards(alice.Address, val.Address))
+	}
+	// rewards earned before a stake change are kept, later ones follow the new stake
+	if err := applySigned(t, l, alice, NewBondTransaction(alice.Address, val.Address, 100, 0, 1)); err != nil {
+		t.Fatalf("delegate more: %v", err)
+	}
+	_ = l.DistributeReward(val.Address, 1_000)
+	if l.Rewards(val.Address, val.Address) != 405 || l.Rewards(alice.Address, val.Address) != 1_395 {
+		t.Fatalf("second reward: %d/%d", l.Rewards(val.Address, val.Address), l.Rewards(alice.Address, val.Address))
+	}
+	if err := applySigned(t, l, alice, NewWithdrawRewardsTransaction(alice.Address, val.Address, 0, 2)); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if l.GetBalance(alice.Address) != 600+1_395 || l.Rewards(alice.Address, val.Address) != 0 {
+		t.Fatalf("withdraw not paid: balance %d, rewards %d", l.GetBalance(alice.Address), l.Rewards(alice.Address, val.Address))
+	}
+
+	// redelegated stake cannot hop on while it is slashable for its source
+	if err := applySigned(t, l, other, NewBondTransaction(other.Address, other.Address, 100, 0, 0)); err != nil {
+		t.Fatalf("other self bond: %v", err)
+	}
+	if err := applySigned(t, l, alice, NewRedelegateTransaction(alice.Address, val.Address, other.Address, 200, 0, 3)); err != nil {
+		t.Fatalf("redelegate: %v", err)
+	}
+	if l.Bonded(alice.Address, val.Address) != 200 || l.Bonded(alice.Address, other.Address) != 200 || l.ValidatorPower(other.Address) != 300 {
+		t.Fatalf("redelegation not applied: %d/%d", l.Bonded(alice.Address, val.Address), l.Bonded(alice.Address, other.Address))
+	}
+	if reds := l.Redelegations(alice.Address); len(reds) != 1 || reds[0].Amount != 200 || reds[0].Source != val.Address {
+		t.Fatalf("redelegations: %+v", reds)
+	}
+	if err := applySigned(t, l, alice, NewRedelegateTransaction(alice.Address, other.Address, val.Address, 100, 0, 4)); !errors.Is(err, ErrInvalidStake) {
+		t.Fatalf("expected a transitive redelegation to fail, got %v", err)
+	}
+	if got := l.Delegations(alice.Address); len(got) != 2 {
+		t.Fatalf("delegations: %+v", got)
+	}
+
+	restored, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if restored.Rewards(val.Address, val.Address) != 405 || restored.StateRoot() != l.StateRoot() {
+		t.Fatalf("replay diverged: rewards %d", restored.Rewards(val.Address, val.Address))
+	}
+}
+
+func TestSlashingPropagatesToDelegators(t *testing.T) {
+	c := newEvidenceChain(t, WithStakingParams(StakingParams{EpochLength: 2, UnbondingPeriod: 10}))
+	l := c.node.Ledger
+	val := registerTestValidator(t)
+	if err := c.node.RegisterValidatorWallet(val); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	carol := testWallet(t, "carol")
+	l.Credit(val.Address, 1_000)
+	l.Credit(carol.Address, 1_000)
+	if err := c.node.AddTransaction(signedStakeTx(t, val, TxTypeBond, 200, 0)); err != nil {
+		t.Fatalf("bond: %v", err)
+	}
+	c.mine(t)
+	delegate := NewBondTransaction(carol.Address, val.Address, 400, 0, 0)
+	_, _ = carol.Sign(delegate)
+	if err := c.node.AddTransaction(delegate); err != nil {
+		t.Fatalf("delegate: %v", err)
+	}
+	self := NewBondTransaction(c.alice.Address, c.alice.Address, 100, 0, c.nonce)
+	_, _ = c.alice.Sign(self)
+	if err := c.node.AddTransaction(self); err != nil {
+		t.Fatalf("destination bond: %v", err)
+	}
+	c.nonce++
+	c.mine(t)
+	c.mine(t)
+	if c.node.Validators.SetAt(3)[val.Address] != 600 {
+		t.Fatalf("delegated stake not in the validator set: %v", c.node.Validators.SetAt(3))
+	}
+
+	// after the offence carol moves half her stake away, which stays slashable
+	redelegate := NewRedelegateTransaction(carol.Address, val.Address, c.alice.Address, 200, 0, 1)
+	_, _ = carol.Sign(redelegate)
+	if err := c.node.AddTransaction(redelegate); err != nil {
+		t.Fatalf("redelegate: %v", err)
+	}
+	c.mine(t)
+	if err := c.node.ReportDoubleSign(equivocate(t, val, 3)); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	c.mine(t)
+	if l.Bonded(val.Address, val.Address) != 100 || l.Bonded(carol.Address, val.Address) != 100 || l.ValidatorPower(val.Address) != 200 {
+		t.Fatalf("bonds not slashed: %d/%d", l.Bonded(val.Address, val.Address), l.Bonded(carol.Address, val.Address))
+	}
+	if l.Bonded(carol.Address, c.alice.Address) != 100 || l.ValidatorPower(c.alice.Address) != 200 {
+		t.Fatalf("redelegated stake not slashed: %d", l.Bonded(carol.Address, c.alice.Address))
+	}
+	if reds := l.Redelegations(carol.Address); len(reds) != 1 || reds[0].Amount != 100 {
+		t.Fatalf("redelegation entry: %+v", reds)
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+)
+
+// Committed evidence is recorded in the state trie, so that every node, and
+// every node restored from a snapshot, agrees on which offences were already
+// punished. Double-sign offences are keyed by validator and height; downtime
+// keeps the last height a validator was punished for, so overlapping windows
+// cannot punish the same missed blocks twice.
+
+const (
+	keyEvidencePrefix   = "evidence/"
+	keyDoubleSignPrefix = keyEvidencePrefix + "double/"
+	keyDowntimePrefix   = keyEvidencePrefix + "downtime/"
+)
+
+func doubleSignKey(validator string, height uint64) string {
+	return fmt.Sprintf("%s%s/%016x", keyDoubleSignPrefix, validator, height)
+}
+
+// WithEvidenceParams sets the limits on the evidence blocks may carry.
+func WithEvidenceParams(p EvidenceParams) LedgerOption {
+	return func(l *Ledger) {
+		if p.MaxAge > 0 && p.DowntimeWindow > 0 && p.DowntimeMinSigned <= p.DowntimeWindow &&
+			p.LivenessGrace >= 0 && p.LivenessGrace+1 < p.MaxAge {
+			l.evidence = p
+		}
+	}
+}
+
+// EvidenceParams returns the limits on the evidence blocks may carry.
+func (l *Ledger) EvidenceParams() EvidenceParams { return l.evidence }
+
+// CheckEvidence reports whether ev could be included in the next block: it
+// must be verified against the validator sets of the heights involved, be
+// younger than the maximum evidence age and not yet committed.
+func (l *Ledger) CheckEvidence(ev *Evidence) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.checkOneEvidenceLocked(ev, l.heightLocked()+1)
+}
+
+// HasEvidence reports whether the offence ev proves was already punished.
+func (l *Ledger) HasEvidence(ev *Evidence) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.committedEvidenceLocked(ev)
+}
+
+func (l *Ledger) committedEvidenceLocked(ev *Evidence) bool {
+	if ev.Kind == EvidenceDowntime {
+		last := l.uintLocked(keyDowntimePrefix + ev.Validator)
+		return last != 0 && ev.WindowStart(l.evidence) <= last
+	}
+	_, ok := l.getLocked(doubleSignKey(ev.Validator, ev.Height))
+	return ok
+}
+
+// checkEvidenceLocked checks the evidence b carries before it is applied at
+// height. It also checks that sub-blocks declaring a height were produced for
+// this one, which is what makes two of them for a height conflicting.
+func (l *Ledger) checkEvidenceLocked(b *Block, height int) error {
+	for _, sb := range b.SubBlocks {
+		if sb != nil && sb.Height != 0 && sb.Height != uint64(height) {
+			return fmt.Errorf("sub-block for height %d in block %d", sb.Height, height)
+		}
+	}
+	seen := make(map[string]bool, len(b.Evidence))
+	for i := range b.Evidence {
+		ev := &b.Evidence[i]
+		if err := l.checkOneEvidenceLocked(ev, height); err != nil {
+			return err
+		}
+		key := ev.Kind + "/" + ev.Validator
+		if ev.Kind == EvidenceDoubleSign {
+			key = ev.ID()
+		}
+		if seen[key] {
+			return fmt.Errorf("%w: %s evidence against %s repeated in block", ErrDuplicateEvidence, ev.Kind, ev.Validator)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func (l *Ledger) checkOneEvidenceLocked(ev *Evidence, height int) error {
+	if err := ev.Verify(l.evidence, l.validatorSetLocked); err != nil {
+		return err
+	}
+	if ev.Height >= uint64(height) {
+		return fmt.Errorf("%w: offence at height %d is not before block %d", ErrInvalidEvidence, ev.Height, height)
+	}
+	if age := uint64(height) - ev.Height; age > uint64(l.evidence.MaxAge) {
+		return fmt.Errorf("%w: offence at height %d is %d blocks old", ErrEvidenceExpired, ev.Height, age)
+	}
+	if l.committedEvidenceLocked(ev) {
+		return fmt.Errorf("%w: %s by %s at height %d", ErrDuplicateEvidence, ev.Kind, ev.Validator, ev.Height)
+	}
+	if ev.Kind != EvidenceDowntime {
+		return nil
+	}
+	// late votes for the window may still be recorded until its grace is over
+	if open := ev.Height + 1 + uint64(l.evidence.LivenessGrace); uint64(height) <= open {
+		return fmt.Errorf("%w: votes for block %d can be recorded until block %d", ErrInvalidEvidence, ev.Height, open)
+	}
+	if signed := l.signedLocked(ev); signed >= l.evidence.DowntimeMinSigned {
+		return fmt.Errorf("%w: %s signed %d of %d blocks", ErrInvalidEvidence, ev.Validator, signed, l.evidence.DowntimeWindow)
+	}
+	return nil
+}
+
+// validatorSetLocked returns the validator set at height that evidence,
+// liveness votes and finality certificates are checked against, or nil when
+// it is not known. It is the set recorded on chain, so that replaying the
+// log and syncing from peers check blocks exactly as they were checked live.
+func (l *Ledger) validatorSetLocked(height uint64) ValidatorSet {
+	set, _ := l.validatorSetAtLocked(int(height))
+	return set
+}
+
+func (l *Ledger) recordEvidenceLocked(b *Block) {
+	for i := range b.Evidence {
+		ev := &b.Evidence[i]
+		if ev.Kind == EvidenceDowntime {
+			l.setUintLocked(keyDowntimePrefix+ev.Validator, ev.Height)
+			continue
+		}
+		_ = l.putJSONLocked(doubleSignKey(ev.Validator, ev.Height), ev)
+	}
+}
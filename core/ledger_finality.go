@@ -0,0 +1,79 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Finality certificates are stored next to the canonical blocks they finalize,
+// outside of the state trie. The height of the highest finalized block bounds
+// reorgs: ImportBlock refuses any branch that forks below it.
+
+const (
+	keyFinalityPrefix = "final/"
+	keyMetaFinalized  = "meta/finalized"
+)
+
+func finalityKey(height int) string { return fmt.Sprintf("%s%016x", keyFinalityPrefix, height) }
+
+// AddFinalityCertificate verifies cert against the validator set the chain
+// records for its height and stores it with the canonical block it finalizes.
+func (l *Ledger) AddFinalityCertificate(cert *FinalityCertificate) error {
+	if cert == nil {
+		return cert.Verify(nil)
+	}
+	height := int(cert.Height)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := cert.Verify(l.validatorSetLocked(cert.Height)); err != nil {
+		return err
+	}
+	b, ok := l.blockLocked(height)
+	if !ok || height > l.heightLocked() {
+		return fmt.Errorf("%w: no block at height %d", ErrInvalidCertificate, cert.Height)
+	}
+	if b.Hash != cert.BlockHash {
+		return fmt.Errorf("%w: block %d is %s, certificate finalizes %s", ErrInvalidCertificate, height, b.Hash, cert.BlockHash)
+	}
+	if _, ok := l.getLocked(finalityKey(height)); ok {
+		return nil
+	}
+	if err := l.putFinalityLocked(cert); err != nil {
+		l.discardLocked()
+		return err
+	}
+	return l.commitLocked(walRecord{Kind: walKindFinality, Certificate: cert})
+}
+
+func (l *Ledger) putFinalityLocked(cert *FinalityCertificate) error {
+	if err := l.putJSONLocked(finalityKey(int(cert.Height)), cert); err != nil {
+		return err
+	}
+	if cert.Height > l.uintLocked(keyMetaFinalized) {
+		l.setUintLocked(keyMetaFinalized, cert.Height)
+	}
+	return nil
+}
+
+// FinalityCertificate returns the certificate stored for the block at height.
+func (l *Ledger) FinalityCertificate(height int) (*FinalityCertificate, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	v, ok := l.getLocked(finalityKey(height))
+	if !ok {
+		return nil, false
+	}
+	var cert FinalityCertificate
+	if err := json.Unmarshal(v, &cert); err != nil {
+		return nil, false
+	}
+	return &cert, true
+}
+
+// FinalizedHeight returns the height of the highest finalized block, or 0
+// when no block is final yet.
+func (l *Ledger) FinalizedHeight() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return int(l.uintLocked(keyMetaFinalized))
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Historical state is reconstructed from state diffs. Every block stores an
+// undo record with the value each key had before the block, and state changed
+// between blocks, such as mints, is recorded under keyHistoryPrefix for the
+// height of the block that follows it. Walking both kinds of record from the
+// head down recovers the state at any height whose diffs are still retained.
+//
+// How long diffs and block bodies are retained depends on the ledger's
+// HistoryMode. Full history keeps every block body but only the diffs needed
+// for reorgs, pruned history also drops block bodies older than the retention
+// window and keeps just their headers, and archive history keeps everything so
+// that any height can be queried.
+
+const (
+	keyHeaderPrefix  = "header/"
+	keyHistoryPrefix = "hist/"
+
+	// DefaultRetainBlocks is the number of recent blocks a pruned ledger
+	// keeps by default.
+	DefaultRetainBlocks = 1024
+)
+
+// ErrHistoryUnavailable is returned when the state at a height cannot be
+// reconstructed because its diffs were pruned or the height is not on the
+// chain.
+var ErrHistoryUnavailable = errors.New("historical state unavailable")
+
+func headerKey(height int) string { return fmt.Sprintf("%s%016x", keyHeaderPrefix, height) }
+
+func historyKey(height int) string { return fmt.Sprintf("%s%016x", keyHistoryPrefix, height) }
+
+// HistoryMode selects how much chain history a ledger retains.
+type HistoryMode int
+
+const (
+	// HistoryFull keeps every block body and the state diffs of the blocks a
+	// reorg may roll back.
+	HistoryFull HistoryMode = iota
+	// HistoryPruned keeps block bodies and state diffs for a fixed number of
+	// recent blocks. Older blocks are reduced to their headers.
+	HistoryPruned
+	// HistoryArchive keeps every block body and every state diff.
+	HistoryArchive
+)
+
+// String returns the configuration name of the mode.
+func (m HistoryMode) String() string {
+	switch m {
+	case HistoryPruned:
+		return "pruned"
+	case HistoryArchive:
+		return "archive"
+	default:
+		return "full"
+	}
+}
+
+// ParseHistoryMode converts a configuration name into a HistoryMode.
+func ParseHistoryMode(s string) (HistoryMode, error) {
+	switch strings.ToLower(s) {
+	case "", "full":
+		return HistoryFull, nil
+	case "pruned":
+		return HistoryPruned, nil
+	case "archive":
+		return HistoryArchive, nil
+	default:
+		return 0, fmt.Errorf("unknown history mode %q", s)
+	}
+}
+
+// WithHistory sets the ledger's history mode. In pruned mode keep is the number
+// of recent blocks whose bodies and state diffs are retained, and reorgs are
+// limited to that depth; it is ignored otherwise.
+func WithHistory(mode HistoryMode, keep int) LedgerOption {
+	return func(l *Ledger) {
+		l.history = mode
+		if mode == HistoryPruned && keep > 0 {
+			l.retainBlocks = keep
+		}
+	}
+}
+
+// History returns the ledger's history mode and, for pruned ledgers, the
+// number of blocks retained.
+func (l *Ledger) History() (HistoryMode, int) {
+	if l.history != HistoryPruned {
+		return l.history, 0
+	}
+	return l.history, l.retainBlocks
+}
+
+// pruneLocked drops the history that falls out of the retention window once
+// the block at height has been applied.
+func (l *Ledger) pruneLocked(height int) error {
+	switch l.history {
+	case HistoryArchive:
+		return nil
+	case HistoryPruned:
+		old := height - l.retainBlocks
+		if old <= 0 {
+			return nil
+		}
+		l.dropDiffsLocked(old)
+		l.dropReceiptsLocked(old)
+		b, ok := l.blockLocked(old)
+		if !ok {
+			return nil
+		}
+		if err := l.putJSONLocked(headerKey(old), b.Header(old)); err != nil {
+			return err
+		}
+		l.deleteLocked(blockKey(old))
+	default:
+		if old := height - l.maxReorgDepth; old > 0 {
+			l.dropDiffsLocked(old)
+		}
+	}
+	return nil
+}
+
+func (l *Ledger) dropDiffsLocked(height int) {
+	l.deleteLocked(undoKey(height))
+	l.deleteLocked(historyKey(height))
+}
+
+// recordHistoryLocked adds the keys staged in the pending batch to the diff of
+// the next block, keeping the first recorded value of each key. It is used for
+// state changed outside of blocks and must run before the batch is written.
+func (l *Ledger) recordHistoryLocked() error {
+	key := historyKey(l.heightLocked() + 1)
+	var entries []undoEntry
+	if raw, ok := l.getLocked(key); ok {
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return fmt.Errorf("history record: %w", err)
+		}
+	}
+	seen := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		seen[e.Key] = struct{}{}
+	}
+	n := len(entries)
+	for _, op := range l.batch.ops {
+		if !isSnapshotKey(op.key) {
+			continue
+		}
+		if _, ok := seen[op.key]; ok {
+			continue
+		}
+		seen[op.key] = struct{}{}
+		v, err := l.store.Get([]byte(op.key))
+		if err != nil {
+			entries = append(entries, undoEntry{Key: op.key, Absent: true})
+			continue
+		}
+		entries = append(entries, undoEntry{Key: op.key, Value: append([]byte(nil), v...)})
+	}
+	if len(entries) == n {
+		return nil
+	}
+	return l.putJSONLocked(key, entries)
+}
+
+// walkHistoryLocked visits the diffs that separate the current state from the
+// state at height, newest first. The state at a height is the one the next
+// block was applied on top of, so changes made between blocks belong to the
+// height before them.
+func (l *Ledger) walkHistoryLocked(height int, fn func(undoEntry)) error {
+	head := l.heightLocked()
+	if height < 0 || height > head {
+		return fmt.Errorf("%w: height %d, head %d", ErrHistoryUnavailable, height, head)
+	}
+	for h := head; h > height; h-- {
+		if raw, ok := l.getLocked(historyKey(h + 1)); ok {
+			if err := visitUndo(raw, fn); err != nil {
+				return fmt.Errorf("history record for block %d: %w", h+1, err)
+			}
+		}
+		raw, ok := l.getLocked(undoKey(h))
+		if !ok {
+			return fmt.Errorf("%w: no state diff for block %d", ErrHistoryUnavailable, h)
+		}
+		if err := visitUndo(raw, fn); err != nil {
+			return fmt.Errorf("undo record for block %d: %w", h, err)
+		}
+	}
+	return nil
+}
+
+func visitUndo(raw []byte, fn func(undoEntry)) error {
+	var entries []undoEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fn(e)
+	}
+	return nil
+}
+
+// stateAtLocked returns the value key had at height.
+func (l *Ledger) stateAtLocked(key string, height int) ([]byte, bool, error) {
+	v, ok := l.getLocked(key)
+	err := l.walkHistoryLocked(height, func(e undoEntry) {
+		if e.Key == key {
+			v, ok = e.Value, !e.Absent
+		}
+	})
+	return v, ok, err
+}
+
+// GetBalanceAt returns the balance addr held at height, after the block at
+// that height and any changes made before the next block. Heights whose state
+// diffs were pruned return ErrHistoryUnavailable; archive ledgers can answer
+// for every height they applied.
+func (l *Ledger) GetBalanceAt(addr string, height int) (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	v, _, err := l.stateAtLocked(keyBalancePrefix+addr, height)
+	if err != nil {
+		return 0, err
+	}
+	return decodeUint(v), nil
+}
+
+// GetHeader returns the header of the block at height. Headers remain
+// available after a pruned ledger has dropped the block body.
+func (l *Ledger) GetHeader(height int) (BlockHeader, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if height <= 0 || height > l.heightLocked() {
+		return BlockHeader{}, false
+	}
+	return l.headerLocked(height)
+}
+
+func (l *Ledger) headerLocked(height int) (BlockHeader, bool) {
+	if b, ok := l.blockLocked(height); ok {
+		return b.Header(height), true
+	}
+	v, ok := l.getLocked(headerKey(height))
+	if !ok {
+		return BlockHeader{}, false
+	}
+	var h BlockHeader
+	if err := json.Unmarshal(v, &h); err != nil {
+		return BlockHeader{}, false
+	}
+	return h, true
+}
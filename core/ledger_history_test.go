@@ -0,0 +1,106 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLedgerGetBalanceAtArchive(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path, WithHistory(HistoryArchive, 0), WithMaxReorgDepth(1))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Credit(alice.Address, 1000)
+	addSealedTestBlocks(t, l, validator, alice, 2)
+	l.Credit(alice.Address, 100)
+	addSealedTestBlocks(t, l, validator, alice, 1)
+	l.Credit(alice.Address, 5)
+
+	want := []uint64{1000, 999, 1098, 1102}
+	check := func(l *Ledger) {
+		t.Helper()
+		for h, bal := range want {
+			got, err := l.GetBalanceAt(alice.Address, h)
+			if err != nil || got != bal {
+				t.Fatalf("balance at %d: got %d err %v, want %d", h, got, err, bal)
+			}
+		}
+		if _, err := l.GetBalanceAt(alice.Address, 4); !errors.Is(err, ErrHistoryUnavailable) {
+			t.Fatalf("expected ErrHistoryUnavailable above the head, got %v", err)
+		}
+	}
+	check(l)
+	l.Close()
+	reopened, err := OpenLedger(path, WithHistory(HistoryArchive, 0))
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	check(reopened)
+}
+
+func TestLedgerFullHistoryKeepsReorgWindow(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	l, _ := OpenLedger("", WithMaxReorgDepth(2))
+	l.Credit(alice.Address, 1000)
+	addSealedTestBlocks(t, l, validator, alice, 4)
+	if bal, err := l.GetBalanceAt(alice.Address, 2); err != nil || bal != 998 {
+		t.Fatalf("balance at 2: %d %v", bal, err)
+	}
+	if _, err := l.GetBalanceAt(alice.Address, 1); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("expected ErrHistoryUnavailable below the reorg window, got %v", err)
+	}
+	if _, ok := l.GetBlock(1); !ok {
+		t.Fatalf("full history should keep every block body")
+	}
+}
+
+func TestLedgerPrunedHistory(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	l, _ := OpenLedger("", WithHistory(HistoryPruned, 2))
+	if mode, keep := l.History(); mode != HistoryPruned || keep != 2 {
+		t.Fatalf("unexpected history %v %d", mode, keep)
+	}
+	l.Credit(alice.Address, 1000)
+	blocks := addSealedTestBlocks(t, l, validator, alice, 4)
+
+	for h := 1; h <= 2; h++ {
+		if _, ok := l.GetBlock(h); ok {
+			t.Fatalf("block %d should have been pruned", h)
+		}
+		header, ok := l.GetHeader(h)
+		if !ok || header.Hash != blocks[h-1].Hash || header.StateRoot != blocks[h-1].StateRoot {
+			t.Fatalf("header %d not retained: %+v", h, header)
+		}
+	}
+	if _, ok := l.GetBlock(3); !ok {
+		t.Fatalf("recent block pruned")
+	}
+	if !l.HasBlock(blocks[0].Hash) {
+		t.Fatalf("pruned block should still be known by hash")
+	}
+	if bal, err := l.GetBalanceAt(alice.Address, 2); err != nil || bal != 998 {
+		t.Fatalf("balance at 2: %d %v", bal, err)
+	}
+	if _, err := l.GetBalanceAt(alice.Address, 1); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("expected ErrHistoryUnavailable for pruned height, got %v", err)
+	}
+
+	fork := sealTestBlock(t, l, reorgTestBlock(t, blocks[0], validator))
+	if _, err := l.ImportBlock(fork, nil); !errors.Is(err, ErrReorgTooDeep) {
+		t.Fatalf("expected a fork below the retention window to be too deep, got %v", err)
+	}
+}
+
+func TestParseHistoryMode(t *testing.T) {
+	for _, m := range []HistoryMode{HistoryFull, HistoryPruned, HistoryArchive} {
+		if got, err := ParseHistoryMode(m.String()); err != nil || got != m {
+			t.Fatalf("round trip of %v: %v %v", m, got, err)
+		}
+	}
+	if _, err := ParseHistoryMode("light"); err == nil {
+		t.Fatalf("expected unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Liveness records note which validators signed each block. Blocks carry the
+// finality votes their proposer received for the blocks before them, and
+// when a block is applied every vote in it is recorded against the height it
+// is for. A vote can be recorded by the block after the one it is for or by
+// any of the EvidenceParams.LivenessGrace blocks after that, so validators
+// whose votes arrive after a quorum has been reached are still counted.
+// Records live in the state trie, like evidence, so downtime is judged the
+// same way on every node, and are dropped once no downtime window that
+// includes them can be punished any more.
+
+const keyLivenessPrefix = "liveness/"
+
+func livenessKey(height uint64, validator string) string {
+	return fmt.Sprintf("%s%016x/%s", keyLivenessPrefix, height, validator)
+}
+
+// HasLiveness reports whether the chain records validator signing the block
+// at height.
+func (l *Ledger) HasLiveness(validator string, height uint64) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.getLocked(livenessKey(height, validator))
+	return ok
+}
+
+// checkLivenessLocked checks the votes b carries before it is applied at
+// height: each must be a valid vote by a validator of its height for a
+// canonical block whose grace is not over, and not recorded before.
+func (l *Ledger) checkLivenessLocked(b *Block, height int) error {
+	seen := make(map[string]bool, len(b.Liveness))
+	for i := range b.Liveness {
+		v := &b.Liveness[i]
+		if v.Height == 0 || v.Height >= uint64(height) {
+			return fmt.Errorf("%w: vote for height %d in block %d", ErrInvalidVote, v.Height, height)
+		}
+		if uint64(height)-v.Height > uint64(l.evidence.LivenessGrace)+1 {
+			return fmt.Errorf("%w: votes for block %d can no longer be recorded", ErrInvalidVote, v.Height)
+		}
+		blk, ok := l.blockLocked(int(v.Height))
+		if !ok || blk.Hash != v.BlockHash {
+			return fmt.Errorf("%w: vote for %s is not for canonical block %d", ErrInvalidVote, v.BlockHash, v.Height)
+		}
+		if l.validatorSetLocked(v.Height)[v.Validator] == 0 {
+			return fmt.Errorf("%w: %s is not a validator at height %d", ErrInvalidVote, v.Validator, v.Height)
+		}
+		if err := v.Verify(); err != nil {
+			return err
+		}
+		key := livenessKey(v.Height, v.Validator)
+		if _, ok := l.getLocked(key); ok || seen[key] {
+			return fmt.Errorf("%w: vote by %s for block %d already recorded", ErrInvalidVote, v.Validator, v.Height)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// recordLivenessLocked records the votes b carries and drops the records no
+// downtime evidence included from the block at height on can cover.
+func (l *Ledger) recordLivenessLocked(b *Block, height int) {
+	for i := range b.Liveness {
+		l.setLocked(livenessKey(b.Liveness[i].Height, b.Liveness[i].Validator), []byte{1})
+	}
+	expired := height - l.evidence.MaxAge - l.evidence.DowntimeWindow
+	if expired <= 0 {
+		return
+	}
+	prefix := fmt.Sprintf("%s%016x/", keyLivenessPrefix, expired)
+	for _, e := range l.scanLocked(prefix) {
+		l.deleteLocked(e.Key)
+	}
+}
+
+// signedLocked returns the number of blocks of the downtime window ev names
+// that the offender signed.
+func (l *Ledger) signedLocked(ev *Evidence) int {
+	signed := 0
+	for h := ev.WindowStart(l.evidence); h <= ev.Height; h++ {
+		if _, ok := l.getLocked(livenessKey(h, ev.Validator)); ok {
+			signed++
+		}
+	}
+	return signed
+}
+
+// LivenessRoot returns the digest a block header commits to for the votes it
+// records, or "" when there are none.
+func LivenessRoot(votes []Vote) string {
+	if len(votes) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for i := range votes {
+		data, err := json.Marshal(&votes[i])
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Receipts are indexed by block height. Transactions in a block receive their
+// receipts when the block executes, so they are rolled back together with the
+// block. Contract invocations run between blocks and are recorded at the height
+// of the block that follows them. Every height also keeps a bloom filter over
+// the addresses and topics of its logs, letting log queries skip heights
+// without loading their receipts.
+
+const (
+	keyReceiptPrefix   = "receipts/"
+	keyReceiptIDPrefix = "receiptid/"
+	keyBloomPrefix     = "bloom/"
+
+	// MaxLogQueryRange bounds the number of heights a single GetLogs call
+	// may scan.
+	MaxLogQueryRange = 10000
+)
+
+// Receipt statuses.
+const (
+	ReceiptSuccess = "success"
+	ReceiptFailed  = "failed"
+)
+
+var (
+	ErrReceiptNotFound  = errors.New("receipt not found")
+	ErrInvalidLogFilter = errors.New("invalid log filter")
+)
+
+func receiptsKey(height int) string { return fmt.Sprintf("%s%016x", keyReceiptPrefix, height) }
+
+func bloomKey(height int) string { return fmt.Sprintf("%s%016x", keyBloomPrefix, height) }
+
+// BloomBytes is the size of a log bloom filter.
+const BloomBytes = 256
+
+// Bloom is a 2048-bit bloom filter over log addresses and topics. Each item
+// sets three bits taken from its SHA-256 digest.
+type Bloom [BloomBytes]byte
+
+func bloomBits(item string) [3]uint {
+	sum := sha256.Sum256([]byte(item))
+	var bits [3]uint
+	for i := range bits {
+		bits[i] = (uint(sum[2*i])<<8 | uint(sum[2*i+1])) % (BloomBytes * 8)
+	}
+	return bits
+}
+
+// Add inserts item into the filter.
+func (b *Bloom) Add(item string) {
+	for _, bit := range bloomBits(item) {
+		b[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test reports whether item may have been added to the filter. False
+// positives are possible, false negatives are not.
+func (b *Bloom) Test(item string) bool {
+	for _, bit := range bloomBits(item) {
+		if b[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// AddLog inserts the address and topics of log into the filter.
+func (b *Bloom) AddLog(log ContractLog) {
+	b.Add(log.Address)
+	for _, t := range log.Topics {
+		b.Add(strings.ToLower(t))
+	}
+}
+
+// MarshalText encodes the filter as hex.
+func (b Bloom) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b[:])), nil
+}
+
+// UnmarshalText decodes a hex encoded filter.
+func (b *Bloom) UnmarshalText(text []byte) error {
+	raw, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	if len(raw) != BloomBytes {
+		return fmt.Errorf("bloom must be %d bytes, got %d", BloomBytes, len(raw))
+	}
+	copy(b[:], raw)
+	return nil
+}
+
+// LogFilter selects contract logs. Heights are inclusive; a zero FromHeight
+// starts at the first block and a zero ToHeight ends at the pending height,
+// which holds invocations not yet followed by a block. Topics match by
+// position: each position lists alternatives and an empty position matches
+// any topic.
+type LogFilter struct {
+	FromHeight int        `json:"from_height,omitempty"`
+	ToHeight   int        `json:"to_height,omitempty"`
+	Address    string     `json:"address,omitempty"`
+	Topics     [][]string `json:"topics,omitempty"`
+}
+
+// Matches reports whether log satisfies the address and topic criteria of f.
+func (f LogFilter) Matches(log ContractLog) bool {
+	if f.Address != "" && log.Address != f.Address {
+		return false
+	}
+	if len(f.Topics) > len(log.Topics) {
+		for _, alts := range f.Topics[len(log.Topics):] {
+			if len(alts) > 0 {
+				return false
+			}
+		}
+	}
+	for i, alts := range f.Topics {
+		if len(alts) == 0 || i >= len(log.Topics) {
+			continue
+		}
+		found := false
+		for _, t := range alts {
+			if strings.EqualFold(t, log.Topics[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// mayMatch reports whether a height with the given bloom can hold logs
+// matching f.
+func (f LogFilter) mayMatch(b *Bloom) bool {
+	if f.Address != "" && !b.Test(f.Address) {
+		return false
+	}
+	for _, alts := range f.Topics {
+		if len(alts) == 0 {
+			continue
+		}
+		found := false
+		for _, t := range alts {
+			if b.Test(strings.ToLower(t)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// recordReceiptLocked appends r to the receipts of its height, assigning the
+// pending height when r has none. Its position, the block-wide index of its
+// logs and, for invocations without a transaction, its ID are filled in.
+func (l *Ledger) recordReceiptLocked(r *Receipt) error {
+	if r.BlockHeight == 0 {
+		r.BlockHeight = l.heightLocked() + 1
+	}
+	receipts := l.receiptsLocked(r.BlockHeight)
+	r.Index = len(receipts)
+	logIndex := 0
+	for _, prev := range receipts {
+		logIndex += len(prev.Logs)
+	}
+	if r.TxID == "" {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(raw)
+		r.TxID = hex.EncodeToString(sum[:])
+	}
+	bloom := l.bloomLocked(r.BlockHeight)
+	for i := range r.Logs {
+		r.Logs[i].TxID = r.TxID
+		r.Logs[i].BlockHeight = r.BlockHeight
+		r.Logs[i].Index = logIndex + i
+		bloom.AddLog(r.Logs[i])
+	}
+	if err := l.putJSONLocked(receiptsKey(r.BlockHeight), append(receipts, *r)); err != nil {
+		return err
+	}
+	if len(r.Logs) > 0 {
+		l.setLocked(bloomKey(r.BlockHeight), bloom[:])
+	}
+	// A transaction ID keeps pointing at its first receipt, so a replayed
+	// transaction that fails does not hide the one that was applied.
+	if _, ok := l.getLocked(keyReceiptIDPrefix + r.TxID); !ok {
+		l.setLocked(keyReceiptIDPrefix+r.TxID, encodeUint(uint64(r.BlockHeight)))
+	}
+	return nil
+}
+
+func (l *Ledger) receiptsLocked(height int) []Receipt {
+	raw, ok := l.getLocked(receiptsKey(height))
+	if !ok {
+		return nil
+	}
+	var receipts []Receipt
+	if err := json.Unmarshal(raw, &receipts); err != nil {
+		return nil
+	}
+	return receipts
+}
+
+func (l *Ledger) bloomLocked(height int) *Bloom {
+	var b Bloom
+	if raw, ok := l.getLocked(bloomKey(height)); ok {
+		copy(b[:], raw)
+	}
+	return &b
+}
+
+// dropReceiptsLocked removes the receipts and bloom of a pruned height.
+func (l *Ledger) dropReceiptsLocked(height int) {
+	for _, r := range l.receiptsLocked(height) {
+		l.deleteLocked(keyReceiptIDPrefix + r.TxID)
+	}
+	l.deleteLocked(receiptsKey(height))
+	l.deleteLocked(bloomKey(height))
+}
+
+// GetReceipt returns the receipt of a transaction or contract invocation.
+func (l *Ledger) GetReceipt(txID string) (*Receipt, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	raw, ok := l.getLocked(keyReceiptIDPrefix + txID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrReceiptNotFound, txID)
+	}
+	for _, r := range l.receiptsLocked(int(decodeUint(raw))) {
+		if r.TxID == txID {
+			return &r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrReceiptNotFound, txID)
+}
+
+// Receipts returns the receipts recorded at a height in execution order.
+func (l *Ledger) Receipts(height int) []Receipt {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.receiptsLocked(height)
+}
+
+// LogsBloom returns the bloom filter over the logs recorded at a height.
+func (l *Ledger) LogsBloom(height int) Bloom {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return *l.bloomLocked(height)
+}
+
+// GetLogs returns the logs matching f in chain order. Heights whose bloom
+// rules out a match are skipped without loading their receipts.
+func (l *Ledger) GetLogs(f LogFilter) ([]ContractLog, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	head := l.heightLocked()
+	from, to := max(f.FromHeight, 1), f.ToHeight
+	if to <= 0 || to > head+1 {
+		to = head + 1
+	}
+	if from > to {
+		return nil, fmt.Errorf("%w: from height %d is after to height %d", ErrInvalidLogFilter, from, to)
+	}
+	if to-from+1 > MaxLogQueryRange {
+		return nil, fmt.Errorf("%w: %d heights requested, limit is %d", ErrInvalidLogFilter, to-from+1, MaxLogQueryRange)
+	}
+	if l.history == HistoryPruned && from <= head-l.retainBlocks {
+		return nil, fmt.Errorf("%w: logs up to height %d were pruned", ErrHistoryUnavailable, head-l.retainBlocks)
+	}
+	if len(f.Topics) > MaxLogTopics {
+		return nil, fmt.Errorf("%w: %d topic positions, limit is %d", ErrInvalidLogFilter, len(f.Topics), MaxLogTopics)
+	}
+	var out []ContractLog
+	for h := from; h <= to; h++ {
+		if !f.mayMatch(l.bloomLocked(h)) {
+			continue
+		}
+		for _, r := range l.receiptsLocked(h) {
+			for _, log := range r.Logs {
+				if f.Matches(log) {
+					out = append(out, log)
+				}
+			}
+		}
+	}
+	return out, nil
+}
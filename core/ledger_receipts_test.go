@@ -0,0 +1,139 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestContractReceiptsAndLogs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	reg, vault, proxy := deployVaults(t, l)
+	topic := hex.EncodeToString(append([]byte("deposit"), make([]byte, 25)...))
+
+	deposit, err := reg.Call(vault, "alice", "deposit", nil, 50, 0)
+	if err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if deposit.Status != ReceiptSuccess || deposit.BlockHeight != 1 || deposit.Index != 0 || deposit.TxID == "" ||
+		deposit.ContractAddress != vault || deposit.GasUsed == 0 || len(deposit.Logs) != 1 {
+		t.Fatalf("unexpected receipt %+v", deposit)
+	}
+	if log := deposit.Logs[0]; log.TxID != deposit.TxID || log.BlockHeight != 1 || log.Index != 0 || log.Topics[0] != topic {
+		t.Fatalf("unexpected log %+v", log)
+	}
+	relay, err := reg.Call(proxy, "alice", "relay", append(le32(0), le64(7)...), 7, 0)
+	if err != nil || len(relay.Logs) != 1 || relay.Logs[0].Address != vault || relay.Logs[0].Index != 1 {
+		t.Fatalf("relay: %+v %v", relay, err)
+	}
+	failed, err := reg.Call(vault, "alice", "fail", nil, 0, 0)
+	if !errors.Is(err, ErrContractReverted) || failed == nil || failed.Status != ReceiptFailed ||
+		string(failed.ReturnData) != "nope" || len(failed.Logs) != 0 {
+		t.Fatalf("failed call: %+v %v", failed, err)
+	}
+	if got, err := l.GetReceipt(failed.TxID); err != nil || got.Status != ReceiptFailed || got.Index != 2 {
+		t.Fatalf("stored failed receipt: %+v %v", got, err)
+	}
+	if _, err := l.GetReceipt("missing"); !errors.Is(err, ErrReceiptNotFound) {
+		t.Fatalf("expected missing receipt, got %v", err)
+	}
+
+	if err := l.AddBlock(sealTestBlock(t, l, &Block{Hash: "b1"})); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	later, err := reg.Call(vault, "alice", "get", nil, 0, 0)
+	if err != nil || later.BlockHeight != 2 {
+		t.Fatalf("call after block: %+v %v", later, err)
+	}
+	if _, err := reg.Call(vault, "alice", "deposit", nil, 1, 0); err != nil {
+		t.Fatalf("second deposit: %v", err)
+	}
+
+	bloom := l.LogsBloom(1)
+	if !bloom.Test(vault) || !bloom.Test(topic) {
+		t.Fatalf("bloom misses the logged address and topic")
+	}
+	logs, err := l.GetLogs(LogFilter{Address: vault})
+	if err != nil || len(logs) != 3 {
+		t.Fatalf("logs by address: %+v %v", logs, err)
+	}
+	if logs[0].TxID != deposit.TxID || logs[1].TxID != relay.TxID || logs[2].BlockHeight != 2 || logs[2].Index != 0 {
+		t.Fatalf("logs out of order: %+v", logs)
+	}
+	if logs, err := l.GetLogs(LogFilter{FromHeight: 2, Topics: [][]string{{"00", topic}}}); err != nil || len(logs) != 1 {
+		t.Fatalf("logs by topic: %+v %v", logs, err)
+	}
+	if logs, err := l.GetLogs(LogFilter{Address: proxy}); err != nil || len(logs) != 0 {
+		t.Fatalf("proxy emitted no logs: %+v %v", logs, err)
+	}
+	if logs, err := l.GetLogs(LogFilter{Topics: [][]string{nil, {topic}}}); err != nil || len(logs) != 0 {
+		t.Fatalf("second topic position must not match: %+v %v", logs, err)
+	}
+	if _, err := l.GetLogs(LogFilter{FromHeight: 3, ToHeight: 2}); !errors.Is(err, ErrInvalidLogFilter) {
+		t.Fatalf("expected invalid range, got %v", err)
+	}
+
+	l.Close()
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got, err := reopened.GetReceipt(relay.TxID); err != nil || got.Index != relay.Index || len(got.Logs) != 1 {
+		t.Fatalf("receipt not replayed: %+v %v", got, err)
+	}
+	if logs, err := reopened.GetLogs(LogFilter{Address: vault}); err != nil || len(logs) != 3 {
+		t.Fatalf("logs after replay: %+v %v", logs, err)
+	}
+}
+
+func TestBlockTransactionReceipts(t *testing.T) {
+	f := newReorgFixture(t)
+	l := NewLedger()
+	f.fund(l)
+	for _, b := range []*Block{f.g, f.a1} {
+		if err := l.AddBlock(b); err != nil {
+			t.Fatalf("add %s: %v", b.Hash, err)
+		}
+	}
+	receipts := l.Receipts(2)
+	if len(receipts) != 2 || receipts[0].Status != ReceiptSuccess || receipts[1].Index != 1 || receipts[1].BlockHeight != 2 {
+		t.Fatalf("unexpected receipts %+v", receipts)
+	}
+	orphan := f.a1.SubBlocks[0].Transactions[1].ID
+	if r, err := l.GetReceipt(orphan); err != nil || r.BlockHeight != 2 {
+		t.Fatalf("receipt of %s: %+v %v", orphan, r, err)
+	}
+
+	// replaying alice's second transaction fails on its nonce
+	validator := registerTestValidator(t)
+	bad := sealTestBlock(t, l, reorgTestBlock(t, f.a1, validator, f.a1.SubBlocks[0].Transactions[0]))
+	if err := l.AddBlock(bad); err != nil {
+		t.Fatalf("add replay block: %v", err)
+	}
+	if r := l.Receipts(3); len(r) != 1 || r[0].Status != ReceiptFailed || r[0].Details == "" {
+		t.Fatalf("replayed transaction receipt %+v", r)
+	}
+	if r, err := l.GetReceipt(bad.SubBlocks[0].Transactions[0].ID); err != nil || r.Status != ReceiptSuccess {
+		t.Fatalf("failed replay must not hide the applied receipt: %+v %v", r, err)
+	}
+
+	// receipts of orphaned blocks are rolled back by a reorg
+	reorged := NewLedger()
+	f.fund(reorged)
+	for _, b := range []*Block{f.g, f.a1, f.b1, f.b2} {
+		if _, err := reorged.ImportBlock(b, nil); err != nil {
+			t.Fatalf("import %s: %v", b.Hash, err)
+		}
+	}
+	if _, err := reorged.GetReceipt(orphan); !errors.Is(err, ErrReceiptNotFound) {
+		t.Fatalf("orphaned receipt still indexed: %v", err)
+	}
+	if r := reorged.Receipts(2); len(r) != 1 || r[0].TxID != f.b1.SubBlocks[0].Transactions[0].ID {
+		t.Fatalf("receipts at height 2 after reorg: %+v", r)
+	}
+}
@@ -0,0 +1,411 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The ledger keeps every block it has seen in a tree keyed by hash. Blocks on
+// the canonical chain are stored by height; blocks on side branches are kept
+// under keySideBlockPrefix so the ledger can switch to them later. To switch
+// branches the ledger rolls state back to the common ancestor using per-block
+// undo records, which hold the value every key had before the block was
+// applied, and then applies the new branch. Undo records are retained for the
+// most recent blocks (see WithMaxReorgDepth), which bounds how deep a reorg
+// can go. State changed outside of blocks, such as mints, is recorded in the
+// state history for the block that follows it (see recordHistoryLocked), and
+// a rollback undoes those changes together with the blocks they were made
+// on top of, since the blocks of the new branch were not built on them.
+
+const (
+	keySideBlockPrefix = "tree/"
+	keyUndoPrefix      = "undo/"
+
+	// DefaultMaxReorgDepth is the number of recent blocks whose undo records
+	// are retained by default.
+	DefaultMaxReorgDepth = 64
+)
+
+var (
+	// ErrUnknownParent is returned when a block's parent is not known to the
+	// ledger.
+	ErrUnknownParent = errors.New("unknown parent block")
+	// ErrReorgTooDeep is returned when switching to a branch would roll back
+	// more blocks than the ledger keeps undo records for.
+	ErrReorgTooDeep = errors.New("reorg too deep")
+	// ErrInvalidBlock is returned when an imported block fails Block.Validate.
+	ErrInvalidBlock = errors.New("invalid block")
+)
+
+func undoKey(height int) string { return fmt.Sprintf("%s%016x", keyUndoPrefix, height) }
+
+// WithMaxReorgDepth sets how many recent blocks can be rolled back during a
+// reorg. Older undo records are discarded.
+func WithMaxReorgDepth(n int) LedgerOption {
+	return func(l *Ledger) {
+		if n > 0 {
+			l.maxReorgDepth = n
+		}
+	}
+}
+
+// ForkChoice selects the preferred chain among competing candidates.
+// SynnergyConsensus implements it through ChooseChain.
+type ForkChoice interface {
+	ChooseChain(chains [][]*Block) []*Block
+}
+
+var _ ForkChoice = (*SynnergyConsensus)(nil)
+
+// ReorgEvent describes a switch of the canonical chain to another branch.
+// Depth is the number of blocks rolled back from the old head to the common
+// ancestor at AncestorHeight.
+type ReorgEvent struct {
+	Depth          int    `json:"depth"`
+	AncestorHeight int    `json:"ancestor_height"`
+	OldHead        string `json:"old_head"`
+	NewHead        string `json:"new_head"`
+	Height         int    `json:"height"`
+	// Orphaned counts the transactions from rolled back blocks that were not
+	// included in the new branch and were returned to the mempool.
+	Orphaned int `json:"orphaned"`
+}
+
+// undoEntry restores a single key to the value it held before a block.
+type undoEntry struct {
+	Key    string `json:"key"`
+	Value  []byte `json:"value,omitempty"`
+	Absent bool   `json:"absent,omitempty"`
+}
+
+// blockUndo collects undo entries while a block is applied.
+type blockUndo struct {
+	seen    map[string]struct{}
+	entries []undoEntry
+}
+
+// recordUndoLocked remembers the current value of key the first time the block
+// being applied writes it. Trie nodes are content addressed and never need
+// restoring, and the WAL sequence only moves forward.
+func (l *Ledger) recordUndoLocked(key string) {
+	u := l.undo
+	if u == nil {
+		return
+	}
+	if strings.HasPrefix(key, keyTrieNodePrefix) || strings.HasPrefix(key, keyUndoPrefix) ||
+		strings.HasPrefix(key, keySideBlockPrefix) || key == keyMetaWALSeq {
+		return
+	}
+	if _, ok := u.seen[key]; ok {
+		return
+	}
+	u.seen[key] = struct{}{}
+	v, ok := l.getLocked(key)
+	if !ok {
+		u.entries = append(u.entries, undoEntry{Key: key, Absent: true})
+		return
+	}
+	u.entries = append(u.entries, undoEntry{Key: key, Value: append([]byte(nil), v...)})
+}
+
+// rollbackLocked undoes canonical blocks from the head down to height,
+// keeping the removed blocks as side blocks. Changes made outside of blocks
+// after each removed block are undone first.
+func (l *Ledger) rollbackLocked(height int) error {
+	for h := l.heightLocked(); h > height; h-- {
+		b, ok := l.blockLocked(h)
+		if !ok {
+			return fmt.Errorf("block %d missing from state store", h)
+		}
+		if raw, ok := l.getLocked(historyKey(h + 1)); ok {
+			if err := l.undoLocked(raw); err != nil {
+				return fmt.Errorf("history record for block %d: %w", h+1, err)
+			}
+			l.deleteLocked(historyKey(h + 1))
+		}
+		raw, ok := l.getLocked(undoKey(h))
+		if !ok {
+			return fmt.Errorf("%w: no undo record for block %d", ErrReorgTooDeep, h)
+		}
+		if err := l.undoLocked(raw); err != nil {
+			return fmt.Errorf("undo record for block %d: %w", h, err)
+		}
+		l.deleteLocked(undoKey(h))
+		if b.Hash != "" {
+			if err := l.putJSONLocked(keySideBlockPrefix+b.Hash, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// undoLocked restores the values held in an encoded undo record.
+func (l *Ledger) undoLocked(raw []byte) error {
+	var entries []undoEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Absent {
+			l.deleteLocked(e.Key)
+		} else {
+			l.setLocked(e.Key, e.Value)
+		}
+	}
+	return nil
+}
+
+// blockByHashLocked finds a canonical or side block by hash. The height
+// returned is only meaningful for canonical blocks.
+func (l *Ledger) blockByHashLocked(hash string) (b *Block, height int, canonical bool) {
+	if v, ok := l.getLocked(keyBlockHashPrefix + hash); ok {
+		height = int(decodeUint(v))
+		if b, ok := l.blockLocked(height); ok && b.Hash == hash {
+			return b, height, true
+		}
+		// pruned blocks are known by their header only
+		if h, ok := l.headerLocked(height); ok && h.Hash == hash {
+			return &Block{PrevHash: h.PrevHash, StateRoot: h.StateRoot, BaseFee: h.BaseFee, GasUsed: h.GasUsed, Nonce: h.Nonce, Timestamp: h.Timestamp, Hash: h.Hash}, height, true
+		}
+	}
+	v, ok := l.getLocked(keySideBlockPrefix + hash)
+	if !ok {
+		return nil, 0, false
+	}
+	var side Block
+	if err := json.Unmarshal(v, &side); err != nil {
+		return nil, 0, false
+	}
+	return &side, 0, false
+}
+
+// branchLocked walks back from b through known blocks until it reaches the
+// canonical chain. It returns the height of the common ancestor and the
+// branch after it, oldest first. A block whose parent hash is empty descends
+// from the empty chain at height zero.
+func (l *Ledger) branchLocked(b *Block) (int, []*Block, error) {
+	branch := []*Block{b}
+	for cur := b; ; {
+		if cur.PrevHash == "" {
+			break
+		}
+		parent, height, canonical := l.blockByHashLocked(cur.PrevHash)
+		if parent == nil {
+			return 0, nil, fmt.Errorf("%w: %s", ErrUnknownParent, cur.PrevHash)
+		}
+		if canonical {
+			reverseBlocks(branch)
+			return height, branch, nil
+		}
+		branch = append(branch, parent)
+		cur = parent
+	}
+	reverseBlocks(branch)
+	return 0, branch, nil
+}
+
+func reverseBlocks(bs []*Block) {
+	for i, j := 0, len(bs)-1; i < j; i, j = i+1, j-1 {
+		bs[i], bs[j] = bs[j], bs[i]
+	}
+}
+
+// ImportBlock adds a block received from the network. A block that extends
+// the canonical head is applied as with AddBlock. Any other block with a known
+// parent is kept in the block tree and the branch it completes is offered to
+// fc together with the canonical blocks after the common ancestor; when fc
+// prefers the branch, the ledger rolls back to the ancestor, applies the
+// branch and returns the resulting ReorgEvent. Transactions from rolled back
+// blocks that the branch does not include are returned to the mempool, and
+// the event is delivered to reorg subscribers. Blocks the ledger already
+// holds are ignored, and blocks failing Block.Validate are rejected before
+// they are stored.
+func (l *Ledger) ImportBlock(b *Block, fc ForkChoice) (*ReorgEvent, error) {
+	if b == nil {
+		return nil, ErrNilBlock
+	}
+	if b.Hash == "" {
+		return nil, errors.New("block hash required")
+	}
+	if err := b.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBlock, err)
+	}
+	l.mu.Lock()
+	if blk, _, _ := l.blockByHashLocked(b.Hash); blk != nil {
+		l.mu.Unlock()
+		return nil, nil
+	}
+	height := l.heightLocked()
+	var headHash string
+	if head, ok := l.blockLocked(height); ok {
+		headHash = head.Hash
+	}
+	if b.PrevHash == headHash {
+		err := l.addBlockLocked(b)
+		l.mu.Unlock()
+		if err == nil {
+			l.mempool.Prune()
+		}
+		return nil, err
+	}
+	ancestor, branch, err := l.branchLocked(b)
+	if err != nil {
+		l.mu.Unlock()
+		return nil, err
+	}
+	if err := l.putJSONLocked(keySideBlockPrefix+b.Hash, b); err != nil {
+		l.discardLocked()
+		l.mu.Unlock()
+		return nil, err
+	}
+	if err := l.commitLocked(walRecord{Kind: walKindSideBlock, Block: b}); err != nil {
+		l.mu.Unlock()
+		return nil, err
+	}
+	depth := height - ancestor
+	if depth > l.maxReorgDepth {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("%w: branch forks %d blocks below the head", ErrReorgTooDeep, depth)
+	}
+	current := make([]*Block, 0, depth)
+	for h := ancestor + 1; h <= height; h++ {
+		blk, ok := l.blockLocked(h)
+		if !ok {
+			l.mu.Unlock()
+			return nil, fmt.Errorf("block %d missing from state store", h)
+		}
+		current = append(current, blk)
+	}
+	if !prefersBranch(fc, current, branch) {
+		l.mu.Unlock()
+		return nil, nil
+	}
+	if finalized := int(l.uintLocked(keyMetaFinalized)); ancestor < finalized {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("%w: branch forks at %d, block %d is final", ErrFinalizedReorg, ancestor, finalized)
+	}
+	if err := l.reorgLocked(ancestor, branch); err != nil {
+		l.discardLocked()
+		l.mu.Unlock()
+		return nil, err
+	}
+	if err := l.commitLocked(walRecord{Kind: walKindReorg, Height: ancestor, Blocks: branch}); err != nil {
+		l.mu.Unlock()
+		return nil, err
+	}
+	l.mu.Unlock()
+
+	included := make(map[string]struct{})
+	for _, blk := range branch {
+		for _, tx := range blockTransactions(blk) {
+			included[tx.ID] = struct{}{}
+		}
+	}
+	ev := &ReorgEvent{
+		Depth:          depth,
+		AncestorHeight: ancestor,
+		OldHead:        headHash,
+		NewHead:        b.Hash,
+		Height:         ancestor + len(branch),
+	}
+	for _, blk := range current {
+		for _, tx := range blockTransactions(blk) {
+			if _, ok := included[tx.ID]; ok {
+				continue
+			}
+			if l.mempool.Add(tx) == nil {
+				ev.Orphaned++
+			}
+		}
+	}
+	l.mempool.Prune()
+	l.publishReorg(*ev)
+	return ev, nil
+}
+
+// prefersBranch asks fc whether branch should replace the canonical blocks
+// current. Without a fork choice the longer branch wins.
+func prefersBranch(fc ForkChoice, current, branch []*Block) bool {
+	if len(current) == 0 {
+		return true
+	}
+	if fc == nil {
+		return len(branch) > len(current)
+	}
+	chosen := fc.ChooseChain([][]*Block{current, branch})
+	return len(chosen) > 0 && chosen[len(chosen)-1].Hash == branch[len(branch)-1].Hash
+}
+
+// reorgLocked replaces the canonical blocks above ancestor with branch.
+func (l *Ledger) reorgLocked(ancestor int, branch []*Block) error {
+	if err := l.rollbackLocked(ancestor); err != nil {
+		return err
+	}
+	for _, blk := range branch {
+		if err := l.applyBlockLocked(blk); err != nil {
+			return fmt.Errorf("block %s: %w", blk.Hash, err)
+		}
+		if blk.Hash != "" {
+			l.deleteLocked(keySideBlockPrefix + blk.Hash)
+		}
+	}
+	return nil
+}
+
+func blockTransactions(b *Block) []*Transaction {
+	var txs []*Transaction
+	for _, sb := range b.SubBlocks {
+		if sb == nil {
+			continue
+		}
+		for _, tx := range sb.Transactions {
+			if tx != nil {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	return txs
+}
+
+// SubscribeReorgs registers a channel that receives future reorg events. Slow
+// subscribers miss events rather than block the ledger. The returned cancel
+// function must be invoked to release the subscription.
+func (l *Ledger) SubscribeReorgs(buffer int) (<-chan ReorgEvent, func()) {
+	if buffer <= 0 {
+		buffer = 16
+	}
+	ch := make(chan ReorgEvent, buffer)
+	l.subMu.Lock()
+	if l.reorgSubs == nil {
+		l.reorgSubs = make(map[uint64]chan ReorgEvent)
+	}
+	l.reorgSubID++
+	id := l.reorgSubID
+	l.reorgSubs[id] = ch
+	l.subMu.Unlock()
+
+	cancel := func() {
+		l.subMu.Lock()
+		if ch, ok := l.reorgSubs[id]; ok {
+			delete(l.reorgSubs, id)
+			close(ch)
+		}
+		l.subMu.Unlock()
+	}
+	return ch, cancel
+}
+
+func (l *Ledger) publishReorg(ev ReorgEvent) {
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+	for _, ch := range l.reorgSubs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reorgTestBlock builds a valid block on top of prev signed by validator.
+func reorgTestBlock(t *testing.T, prev *Block, validator *Wallet, txs ...*Transaction) *Block {
+	t.Helper()
+	var sb *SubBlock
+	if len(txs) == 0 {
+		sb = NewGenesisSubBlock(validator.Address)
+	} else {
+		sb = NewSubBlock(txs, validator.Address)
+	}
+	prevHash := ""
+	if prev != nil {
+		prevHash = prev.Hash
+	}
+	blk := NewBlock([]*SubBlock{sb}, prevHash)
+	blk.Timestamp = sb.Timestamp + 1
+	if prev != nil && blk.Timestamp <= prev.Timestamp {
+		blk.Timestamp = prev.Timestamp + 1
+	}
+	blk.Hash = blk.HeaderHash(blk.Nonce)
+	return blk
+}
+
+// recordingForkChoice prefers the candidate ending in the given hash.
+type recordingForkChoice struct {
+	prefer string
+	seen   [][]*Block
+}
+
+func (f *recordingForkChoice) ChooseChain(chains [][]*Block) []*Block {
+	f.seen = chains
+	for _, c := range chains {
+		if c[len(c)-1].Hash == f.prefer {
+			return c
+		}
+	}
+	return nil
+}
+
+type reorgFixture struct {
+	alice, frank  *Wallet
+	g, a1, b1, b2 *Block
+	// stakers bond stake in g and opts make them validators from a1 and b1
+	// on.
+	stakers []*Wallet
+	opts    []LedgerOption
+}
+
+func newReorgFixture(t *testing.T) reorgFixture {
+	return newStakedReorgFixture(t)
+}
+
+// newStakedReorgFixture returns the reorg fixture with stakers bonding stake
+// in its genesis block under one block epochs.
+func newStakedReorgFixture(t *testing.T, stakers ...*Wallet) reorgFixture {
+	validator := registerTestValidator(t)
+	f := reorgFixture{alice: testWallet(t, "alice"), frank: testWallet(t, "frank"), stakers: stakers}
+	genesis := []*Transaction{signedTestTx(t, f.alice, "dave", 1, 0, 0)}
+	for _, w := range stakers {
+		genesis = append(genesis, signedStakeTx(t, w, TxTypeBond, 10, 0))
+	}
+	if len(stakers) > 0 {
+		f.opts = []LedgerOption{oneBlockEpochs}
+	}
+	f.g = f.seal(t, reorgTestBlock(t, nil, validator, genesis...))
+	f.a1 = f.seal(t, reorgTestBlock(t, f.g, validator,
+		signedTestTx(t, f.alice, "bob", 10, 0, 1),
+		signedTestTx(t, f.frank, "bob", 4, 0, 0)), f.g)
+	f.b1 = f.seal(t, reorgTestBlock(t, f.g, validator, signedTestTx(t, f.alice, "carol", 3, 0, 1)), f.g)
+	f.b2 = f.seal(t, reorgTestBlock(t, f.b1, validator, signedTestTx(t, f.alice, "erin", 2, 0, 2)), f.g, f.b1)
+	return f
+}
+
+func (f reorgFixture) fund(l *Ledger) {
+	l.Credit(f.alice.Address, 100)
+	l.Credit(f.frank.Address, 100)
+	for _, w := range f.stakers {
+		l.Credit(w.Address, 10)
+	}
+}
+
+// seal sets the state root b produces on top of chain, applied to a funded
+// ledger.
+func (f reorgFixture) seal(t *testing.T, b *Block, chain ...*Block) *Block {
+	t.Helper()
+	l, err := OpenLedger("", f.opts...)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	f.fund(l)
+	for _, blk := range chain {
+		if err := l.AddBlock(blk); err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+	}
+	return sealTestBlock(t, l, b)
+}
+
+func TestLedgerReorgToLongerBranch(t *testing.T) {
+	f := newReorgFixture(t)
+	l := NewLedger()
+	f.fund(l)
+	reorgs, cancel := l.SubscribeReorgs(1)
+	defer cancel()
+	for _, b := range []*Block{f.g, f.a1} {
+		if ev, err := l.ImportBlock(b, nil); err != nil || ev != nil {
+			t.Fatalf("import %s: %v %v", b.Hash, ev, err)
+		}
+	}
+	if ev, err := l.ImportBlock(f.b1, nil); err != nil || ev != nil {
+		t.Fatalf("equal length branch must not reorg: %v %v", ev, err)
+	}
+	if h, head := l.Head(); h != 2 || head != f.a1.Hash || l.GetBalance("bob") != 14 {
+		t.Fatalf("unexpected head %d %s", h, head)
+	}
+
+	ev, err := l.ImportBlock(f.b2, nil)
+	if err != nil || ev == nil {
+		t.Fatalf("expected reorg: %v %v", ev, err)
+	}
+	want := ReorgEvent{Depth: 1, AncestorHeight: 1, OldHead: f.a1.Hash, NewHead: f.b2.Hash, Height: 3, Orphaned: 1}
+	if *ev != want {
+		t.Fatalf("event %+v want %+v", *ev, want)
+	}
+	select {
+	case got := <-reorgs:
+		if got != want {
+			t.Fatalf("published %+v want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("reorg event not published")
+	}
+
+	// the ledger must match one that only ever saw the winning branch
+	ref := NewLedger()
+	f.fund(ref)
+	for _, b := range []*Block{f.g, f.b1, f.b2} {
+		if err := ref.AddBlock(b); err != nil {
+			t.Fatalf("reference: %v", err)
+		}
+	}
+	if l.StateRoot() != ref.StateRoot() {
+		t.Fatalf("state after reorg differs from the winning branch")
+	}
+	if l.GetBalance("bob") != 0 || l.GetBalance("erin") != 2 || l.Nonce(f.alice.Address) != 3 || l.Nonce(f.frank.Address) != 0 {
+		t.Fatalf("unexpected balances after reorg")
+	}
+	// frank's transaction was only in the orphaned block
+	if pool := l.Pool(); len(pool) != 1 || pool[0].From != f.frank.Address {
+		t.Fatalf("orphaned transaction not returned to the mempool: %v", pool)
+	}
+	if b, ok := l.GetBlock(2); !ok || b.Hash != f.b1.Hash {
+		t.Fatalf("canonical block 2 not replaced")
+	}
+}
+
+func TestLedgerReorgUsesForkChoice(t *testing.T) {
+	f := newReorgFixture(t)
+	l := NewLedger()
+	f.fund(l)
+	l.ImportBlock(f.g, nil)
+	l.ImportBlock(f.a1, nil)
+	fc := &recordingForkChoice{prefer: f.a1.Hash}
+	if ev, err := l.ImportBlock(f.b1, fc); err != nil || ev != nil {
+		t.Fatalf("fork choice kept the current chain: %v %v", ev, err)
+	}
+	if len(fc.seen) != 2 || fc.seen[0][0].Hash != f.a1.Hash || fc.seen[1][0].Hash != f.b1.Hash {
+		t.Fatalf("fork choice must compare the branches after the common ancestor")
+	}
+	fc.prefer = f.b2.Hash
+	if ev, err := l.ImportBlock(f.b2, fc); err != nil || ev == nil {
+		t.Fatalf("expected reorg: %v %v", ev, err)
+	}
+	// switching back needs the old branch to win again
+	fc.prefer = f.a1.Hash
+	validator := registerTestValidator(t)
+	a2 := f.seal(t, reorgTestBlock(t, f.a1, validator, signedTestTx(t, f.frank, "gina", 1, 0, 1)), f.g, f.a1)
+	ev, err := l.ImportBlock(a2, fc)
+	if err != nil || ev != nil {
+		t.Fatalf("fork choice must see the full branch: %v %v", ev, err)
+	}
+	fc.prefer = a2.Hash
+	l2 := NewLedger()
+	f.fund(l2)
+	for _, b := range []*Block{f.g, f.b1, f.b2, f.a1} {
+		l2.ImportBlock(b, nil)
+	}
+	if ev, err := l2.ImportBlock(a2, fc); err != nil || ev == nil || ev.Depth != 2 || ev.Height != 3 {
+		t.Fatalf("expected switch back to the first branch: %+v %v", ev, err)
+	}
+	if l2.GetBalance("bob") != 14 || l2.GetBalance("gina") != 1 || l2.GetBalance("carol") != 0 {
+		t.Fatalf("unexpected balances after switching back")
+	}
+}
+
+func TestLedgerReorgLimits(t *testing.T) {
+	f := newReorgFixture(t)
+	l := NewLedger()
+	f.fund(l)
+	validator := registerTestValidator(t)
+	orphan := f.seal(t, reorgTestBlock(t, &Block{Hash: "missing"}, validator, signedTestTx(t, f.alice, "x", 1, 0, 5)))
+	if _, err := l.ImportBlock(orphan, nil); !errors.Is(err, ErrUnknownParent) {
+		t.Fatalf("expected ErrUnknownParent got %v", err)
+	}
+
+	// side-branch blocks are validated before they are stored
+	l.ImportBlock(f.g, nil)
+	l.ImportBlock(f.a1, nil)
+	forged := f.seal(t, reorgTestBlock(t, f.g, validator, signedTestTx(t, f.alice, "mallory", 1, 0, 1)), f.g)
+	forged.SubBlocks[0].Transactions[0].Amount = 50
+	forged.Hash = forged.HeaderHash(forged.Nonce)
+	if _, err := l.ImportBlock(forged, nil); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("expected ErrInvalidBlock got %v", err)
+	}
+	if _, err := l.ImportBlock(f.seal(t, reorgTestBlock(t, forged, validator, signedTestTx(t, f.alice, "x", 1, 0, 2))), nil); !errors.Is(err, ErrUnknownParent) {
+		t.Fatalf("an invalid block must not be stored, got %v", err)
+	}
+
+	shallow, err := OpenLedger("", WithMaxReorgDepth(1))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.fund(shallow)
+	a2 := f.seal(t, reorgTestBlock(t, f.a1, validator, signedTestTx(t, f.frank, "gina", 1, 0, 1)), f.g, f.a1)
+	for _, b := range []*Block{f.g, f.a1, a2, f.b1} {
+		if _, err := shallow.ImportBlock(b, nil); err != nil && b != f.b1 {
+			t.Fatalf("import: %v", err)
+		}
+	}
+	if _, err := shallow.ImportBlock(f.b2, nil); !errors.Is(err, ErrReorgTooDeep) {
+		t.Fatalf("expected ErrReorgTooDeep got %v", err)
+	}
+}
+
+func TestLedgerReorgReplay(t *testing.T) {
+	f := newReorgFixture(t)
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.fund(l)
+	for _, b := range []*Block{f.g, f.a1, f.b1, f.b2} {
+		if _, err := l.ImportBlock(b, nil); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	}
+	root := l.StateRoot()
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if reopened.StateRoot() != root {
+		t.Fatalf("replayed state differs")
+	}
+	if h, head := reopened.Head(); h != 3 || head != f.b2.Hash {
+		t.Fatalf("unexpected head after replay %d %s", h, head)
+	}
+}
+
+func TestLedgerReorgUndoesChangesOutsideBlocks(t *testing.T) {
+	f := newReorgFixture(t)
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.fund(l)
+	for _, b := range []*Block{f.g, f.a1} {
+		if _, err := l.ImportBlock(b, nil); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	}
+	// mints on top of the orphaned block, to a key it wrote and to one it
+	// did not
+	l.Mint(f.alice.Address, 40)
+	l.Mint("zoe", 25)
+	for _, b := range []*Block{f.b1, f.b2} {
+		if _, err := l.ImportBlock(b, nil); err != nil {
+			t.Fatalf("import %s: %v", b.Hash, err)
+		}
+	}
+	if h, head := l.Head(); h != 3 || head != f.b2.Hash {
+		t.Fatalf("expected reorg onto the longer branch, head %d %s", h, head)
+	}
+	ref := NewLedger()
+	f.fund(ref)
+	for _, b := range []*Block{f.g, f.b1, f.b2} {
+		if err := ref.AddBlock(b); err != nil {
+			t.Fatalf("reference: %v", err)
+		}
+	}
+	if l.StateRoot() != ref.StateRoot() || l.GetBalance("zoe") != 0 || l.GetBalance(f.alice.Address) != ref.GetBalance(f.alice.Address) {
+		t.Fatalf("changes made on top of the orphaned block survived the reorg")
+	}
+	if bal, err := l.GetBalanceAt("zoe", 2); err != nil || bal != 0 {
+		t.Fatalf("history of the orphaned branch kept: %d %v", bal, err)
+	}
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if reopened.StateRoot() != ref.StateRoot() {
+		t.Fatalf("replayed state differs")
+	}
+}
+
+func TestNodeImportBlockFollowsReorg(t *testing.T) {
+	f := newReorgFixture(t)
+	l := NewLedger()
+	f.fund(l)
+	n := NewNode("n1", "addr", l)
+	// fall back to the longest chain rule
+	n.Consensus = nil
+	for _, b := range []*Block{f.g, f.a1, f.b1} {
+		if _, err := n.ImportBlock(b); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	}
+	if len(n.Blockchain) != 2 || n.Blockchain[1].Hash != f.a1.Hash {
+		t.Fatalf("expected the first branch, got %d blocks", len(n.Blockchain))
+	}
+	ev, err := n.ImportBlock(f.b2)
+	if err != nil || ev == nil {
+		t.Fatalf("expected reorg: %v %v", ev, err)
+	}
+	if len(n.Blockchain) != 3 || n.Blockchain[0].Hash != f.g.Hash || n.Blockchain[1].Hash != f.b1.Hash || n.Blockchain[2].Hash != f.b2.Hash {
+		t.Fatalf("node chain does not follow the reorg")
+	}
+	// the orphaned transaction is queued where the node mines from
+	if pending := n.Mempool.Pending(0); len(pending) != 1 || pending[0].From != f.frank.Address {
+		t.Fatalf("orphaned transaction not returned to the node's mempool: %v", pending)
+	}
+}
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Stake is bonded from account balances by TxTypeBond transactions and
+// released by TxTypeUnbond transactions. Delegation and rewards are described
+// in ledger_delegation.go. Released stake is not returned at once: it stays
+// locked for StakingParams.UnbondingPeriod blocks, and evidence of an offence
+// committed while it was still bonded slashes it like bonded stake. Bonds,
+// validator power and unbonding entries live in the state trie.
+//
+// The validator set changes only at epoch boundaries. When the first block of
+// an epoch is applied the bonded power of every validator is recorded as the
+// set of that epoch, so the set of any past height can be looked up to verify
+// its finality certificates and evidence. The recorded sets live in the state
+// trie as well, so a ledger restored from a snapshot taken mid-epoch still
+// knows the set of the current epoch.
+
+const (
+	keyStakePrefix  = "stake/"
+	keyBondPrefix   = keyStakePrefix + "bond/"
+	keyPowerPrefix  = keyStakePrefix + "power/"
+	keyUnbondPrefix = keyStakePrefix + "unbond/"
+	keyValSetPrefix = "valset/"
+)
+
+// ErrInvalidStake is returned for bond and unbond transactions the ledger
+// cannot apply.
+var ErrInvalidStake = errors.New("invalid staking transaction")
+
+func bondKey(validator, delegator string) string {
+	return keyBondPrefix + validator + "/" + delegator
+}
+
+func unbondKey(complete uint64, validator, delegator string) string {
+	return fmt.Sprintf("%s%016x/%s/%s", keyUnbondPrefix, complete, validator, delegator)
+}
+
+func valSetKey(epoch int) string { return fmt.Sprintf("%s%016x", keyValSetPrefix, epoch) }
+
+// StakingParams configure bonding and validator set epochs.
+type StakingParams struct {
+	// EpochLength is the number of blocks in an epoch. The validator set
+	// changes only at the first block of an epoch.
+	EpochLength int `json:"epoch_length"`
+	// UnbondingPeriod is the number of blocks unbonded stake stays locked,
+	// and slashable, before it returns to the delegator's balance. It should
+	// be at least EvidenceParams.MaxAge so that evidence of any offence can
+	// be included before the stake leaves.
+	UnbondingPeriod int `json:"unbonding_period"`
+}
+
+// DefaultStakingParams returns the staking parameters ledgers use unless
+// configured otherwise.
+func DefaultStakingParams() StakingParams {
+	return StakingParams{EpochLength: 100, UnbondingPeriod: 1000}
+}
+
+// WithStakingParams sets the epoch length and unbonding period.
+func WithStakingParams(p StakingParams) LedgerOption {
+	return func(l *Ledger) {
+		if p.EpochLength > 0 && p.UnbondingPeriod > 0 {
+			l.staking = p
+		}
+	}
+}
+
+// StakingParams returns the epoch length and unbonding period.
+func (l *Ledger) StakingParams() StakingParams { return l.staking }
+
+// Unbonding is stake on its way back to a delegator's balance. Height is the
+// height of the block that unbonded it and Complete the height of the block
+// that returns it.
+type Unbonding struct {
+	Delegator string `json:"delegator"`
+	Validator string `json:"validator"`
+	Amount    uint64 `json:"amount"`
+	Height    uint64 `json:"height"`
+	Complete  uint64 `json:"complete"`
+}
+
+// Bonded returns the stake delegator has bonded to validator.
+func (l *Ledger) Bonded(delegator, validator string) uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.uintLocked(bondKey(validator, delegator))
+}
+
+// ValidatorPower returns the stake bonded to validator.
+func (l *Ledger) ValidatorPower(validator string) uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.uintLocked(keyPowerPrefix + validator)
+}
+
+// ValidatorPowers returns the stake currently bonded to every validator. It
+// becomes the validator set at the start of the next epoch.
+func (l *Ledger) ValidatorPowers() ValidatorSet {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.powersLocked()
+}
+
+// Unbonding returns the stake delegator is unbonding, ordered by completion
+// height.
+func (l *Ledger) Unbonding(delegator string) []Unbonding {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []Unbonding
+	for _, u := range l.unbondingsLocked() {
+		if u.Delegator == delegator {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// ValidatorSetAt returns the validator set of the epoch containing height,
+// with each validator's bonded power. The set of the epoch starting with the
+// next block is the current bonded power. It reports false for heights in
+// later epochs and for epochs whose set was not recorded.
+func (l *Ledger) ValidatorSetAt(height int) (ValidatorSet, bool) {
+	if height <= 0 {
+		return nil, false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.validatorSetAtLocked(height)
+}
+
+func (l *Ledger) validatorSetAtLocked(height int) (ValidatorSet, bool) {
+	if height <= 0 {
+		return nil, false
+	}
+	epoch := (height - 1) / l.staking.EpochLength
+	if raw, ok := l.getLocked(valSetKey(epoch)); ok {
+		var set ValidatorSet
+		if err := json.Unmarshal(raw, &set); err != nil {
+			return nil, false
+		}
+		return set, true
+	}
+	if epoch*l.staking.EpochLength == l.heightLocked() {
+		return l.powersLocked(), true
+	}
+	return nil, false
+}
+
+func (l *Ledger) powersLocked() ValidatorSet {
+	set := make(ValidatorSet)
+	for _, e := range l.scanLocked(keyPowerPrefix) {
+		set[strings.TrimPrefix(e.Key, keyPowerPrefix)] = decodeUint(e.Value)
+	}
+	return set
+}
+
+func (l *Ledger) unbondingsLocked() []Unbonding {
+	var out []Unbonding
+	for _, e := range l.scanLocked(keyUnbondPrefix) {
+		var u Unbonding
+		if err := json.Unmarshal(e.Value, &u); err == nil {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// scanLocked returns the entries stored under prefix in key order, including
+// writes staged in the pending batch.
+func (l *Ledger) scanLocked(prefix string) []StateEntry {
+	state := make(map[string][]byte)
+	it := l.store.Iterate([]byte(prefix))
+	for it.Next() {
+		state[string(it.Key())] = append([]byte(nil), it.Value()...)
+	}
+	for _, op := range l.batch.ops {
+		if !strings.HasPrefix(op.key, prefix) {
+			continue
+		}
+		if op.delete {
+			delete(state, op.key)
+		} else {
+			state[op.key] = op.value
+		}
+	}
+	entries := make([]StateEntry, 0, len(state))
+	for k, v := range state {
+		entries = append(entries, StateEntry{Key: k, Value: v})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// applyBondLocked moves the amount of a bond transaction from the sender's
+// balance into stake bonded to tx.To. Bonding to itself makes the sender a
+// validator; bonding to another address delegates to it and requires it to
+// be a validator already.
+func (l *Ledger) applyBondLocked(tx *Transaction) error {
+	if _, ok := l.validatorLocked(tx.To); !ok && tx.To != tx.From {
+		return fmt.Errorf("%w: %s is not a validator", ErrInvalidStake, tx.To)
+	}
+	if tx.Amount == 0 {
+		return fmt.Errorf("%w: bond amount must be > 0", ErrInvalidStake)
+	}
+	if err := l.chargeLocked(tx, tx.Amount); err != nil {
+		return err
+	}
+	l.changeBondLocked(tx.To, tx.From, tx.Amount, 0)
+	return nil
+}
+
+// applyUnbondLocked starts unbonding tx.Amount of the stake the sender bonded
+// to tx.To. The stake stops counting towards the validator's power at once
+// and returns to the sender's balance after the unbonding period.
+func (l *Ledger) applyUnbondLocked(tx *Transaction) error {
+	bonded := l.uintLocked(bondKey(tx.To, tx.From))
+	if tx.Amount == 0 || tx.Amount > bonded {
+		return fmt.Errorf("%w: %s has %d bonded to %s, cannot unbond %d", ErrInvalidStake, tx.From, bonded, tx.To, tx.Amount)
+	}
+	if err := l.chargeLocked(tx, 0); err != nil {
+		return err
+	}
+	l.changeBondLocked(tx.To, tx.From, 0, tx.Amount)
+	height := uint64(l.heightLocked() + 1)
+	u := Unbonding{Delegator: tx.From, Validator: tx.To, Height: height, Complete: height + uint64(l.staking.UnbondingPeriod)}
+	key := unbondKey(u.Complete, u.Validator, u.Delegator)
+	if raw, ok := l.getLocked(key); ok {
+		_ = json.Unmarshal(raw, &u)
+	}
+	u.Amount += tx.Amount
+	return l.putJSONLocked(key, u)
+}
+
+// beginBlockStakingLocked runs before the transactions of the block at
+// height: it returns matured unbondings, forgets matured redelegations,
+// slashes the validators b carries evidence against and, at the first block
+// of an epoch, records the epoch's validator set.
+func (l *Ledger) beginBlockStakingLocked(b *Block, height int) {
+	for _, e := range l.scanLocked(keyUnbondPrefix) {
+		var u Unbonding
+		if err := json.Unmarshal(e.Value, &u); err != nil {
+			continue
+		}
+		if u.Complete > uint64(height) {
+			// entries are keyed by completion height
+			break
+		}
+		l.creditLocked(u.Delegator, u.Amount)
+		l.deleteLocked(e.Key)
+	}
+	for _, e := range l.scanLocked(keyRedelegatePrefix) {
+		var r Redelegation
+		if err := json.Unmarshal(e.Value, &r); err == nil && r.Complete > uint64(height) {
+			break
+		}
+		l.deleteLocked(e.Key)
+	}
+	for i := range b.Evidence {
+		ev := &b.Evidence[i]
+		l.slashStakeLocked(ev.Validator, ev.Height, ev.SlashFraction())
+	}
+	if (height-1)%l.staking.EpochLength == 0 {
+		_ = l.putJSONLocked(valSetKey((height-1)/l.staking.EpochLength), l.powersLocked())
+	}
+}
+
+// slashStakeLocked burns bps basis points of the stake bonded to validator,
+// its delegators' included, and of the stake that started unbonding or was
+// redelegated away from it at or after the offence height, while the offence
+// could still have been punished. Rewards earned before the offence are kept.
+func (l *Ledger) slashStakeLocked(validator string, offence, bps uint64) {
+	rec, ok := l.validatorLocked(validator)
+	if !ok {
+		// nothing was ever bonded to it
+		return
+	}
+	ended := l.endPeriodLocked(validator, &rec)
+	var power uint64
+	for _, e := range l.scanLocked(keyBondPrefix + validator + "/") {
+		delegator := strings.TrimPrefix(e.Key, keyBondPrefix+validator+"/")
+		st := l.settleLocked(validator, delegator, ended)
+		kept := slashKept(decodeUint(e.Value), bps)
+		l.setUintLocked(e.Key, kept)
+		l.putStartLocked(validator, delegator, st)
+		power += kept
+	}
+	l.setUintLocked(keyPowerPrefix+validator, power)
+	_ = l.putJSONLocked(keyValidatorPrefix+validator, rec)
+	for _, e := range l.scanLocked(keyUnbondPrefix) {
+		var u Unbonding
+		if err := json.Unmarshal(e.Value, &u); err != nil || u.Validator != validator || u.Height < offence {
+			continue
+		}
+		if u.Amount = slashKept(u.Amount, bps); u.Amount == 0 {
+			l.deleteLocked(e.Key)
+			continue
+		}
+		_ = l.putJSONLocked(e.Key, u)
+	}
+	l.slashRedelegationsLocked(validator, offence, bps)
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// signedStakeTx signs a bond or unbond transaction from w to itself.
+func signedStakeTx(t *testing.T, w *Wallet, typ TransactionType, amount, nonce uint64) *Transaction {
+	t.Helper()
+	tx := NewBondTransaction(w.Address, w.Address, amount, 0, nonce)
+	if typ == TxTypeUnbond {
+		tx = NewUnbondTransaction(w.Address, w.Address, amount, 0, nonce)
+	}
+	if _, err := w.Sign(tx); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return tx
+}
+
+func TestBondingFollowsEpochsAndUnbondingStaysSlashable(t *testing.T) {
+	c := newEvidenceChain(t, WithStakingParams(StakingParams{EpochLength: 2, UnbondingPeriod: 4}))
+	l := c.node.Ledger
+	val := registerTestValidator(t)
+	if err := c.node.RegisterValidatorWallet(val); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	l.Credit(val.Address, 500)
+
+	if err := l.ValidateTransaction(NewBondTransaction(val.Address, "other", 1, 0, 0)); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected unsigned bond to fail, got %v", err)
+	}
+	other := NewBondTransaction(val.Address, c.alice.Address, 1, 0, 0)
+	_, _ = val.Sign(other)
+	if err := l.ValidateTransaction(other); !errors.Is(err, ErrInvalidStake) {
+		t.Fatalf("expected a bond to another validator to fail, got %v", err)
+	}
+	if err := c.node.AddTransaction(signedStakeTx(t, val, TxTypeBond, 300, 0)); err != nil {
+		t.Fatalf("bond: %v", err)
+	}
+	c.mine(t)
+	if l.Bonded(val.Address, val.Address) != 300 || l.GetBalance(val.Address) != 200 {
+		t.Fatalf("bond not applied: %d bonded, balance %d", l.Bonded(val.Address, val.Address), l.GetBalance(val.Address))
+	}
+	if _, ok := c.node.Validators.Eligible()[val.Address]; ok {
+		t.Fatalf("bonded stake active before the epoch ended")
+	}
+	if set, ok := l.ValidatorSetAt(1); !ok || len(set) != 0 {
+		t.Fatalf("epoch 0 set: %v %v", set, ok)
+	}
+	if _, ok := l.ValidatorSetAt(3); ok {
+		t.Fatalf("the set of epoch 1 is not settled until its last block")
+	}
+
+	c.mine(t)
+	if set, ok := l.ValidatorSetAt(3); !ok || set[val.Address] != 300 {
+		t.Fatalf("epoch 1 set: %v %v", set, ok)
+	}
+	if c.node.Validators.SetAt(2)[val.Address] != 0 || c.node.Validators.SetAt(3)[val.Address] != 300 {
+		t.Fatalf("node validator set did not change at the epoch boundary")
+	}
+
+	// unbonded stake leaves the validator's power but not yet its account
+	if err := l.ValidateTransaction(signedStakeTx(t, val, TxTypeUnbond, 301, 1)); !errors.Is(err, ErrInvalidStake) {
+		t.Fatalf("expected unbonding more than bonded to fail, got %v", err)
+	}
+	if err := c.node.AddTransaction(signedStakeTx(t, val, TxTypeUnbond, 100, 1)); err != nil {
+		t.Fatalf("unbond: %v", err)
+	}
+	c.mine(t)
+	unbonding := l.Unbonding(val.Address)
+	if l.ValidatorPower(val.Address) != 200 || len(unbonding) != 1 || unbonding[0].Amount != 100 || unbonding[0].Complete != 7 {
+		t.Fatalf("unbond not applied: power %d, unbonding %+v", l.ValidatorPower(val.Address), unbonding)
+	}
+	if l.GetBalance(val.Address) != 200 {
+		t.Fatalf("unbonded stake returned early: %d", l.GetBalance(val.Address))
+	}
+	c.mine(t)
+
+	// an offence committed before unbonding slashes the unbonding stake too
+	if err := c.node.ReportDoubleSign(equivocate(t, val, 3)); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	c.mine(t)
+	unbonding = l.Unbonding(val.Address)
+	if l.ValidatorPower(val.Address) != 100 || len(unbonding) != 1 || unbonding[0].Amount != 50 {
+		t.Fatalf("stake not slashed: power %d, unbonding %+v", l.ValidatorPower(val.Address), unbonding)
+	}
+	if _, ok := c.node.Validators.Eligible()[val.Address]; ok {
+		t.Fatalf("slashed validator still eligible")
+	}
+	if c.node.Validators.SetAt(5)[val.Address] == 0 {
+		t.Fatalf("slashing rewrote the set of a past height")
+	}
+
+	c.mine(t)
+	c.mine(t)
+	if l.GetBalance(val.Address) != 250 || len(l.Unbonding(val.Address)) != 0 {
+		t.Fatalf("unbonding not released: balance %d, %+v", l.GetBalance(val.Address), l.Unbonding(val.Address))
+	}
+}
+
+func TestSlashingANonValidatorLeavesNoRecord(t *testing.T) {
+	l := NewLedger()
+	l.mu.Lock()
+	l.slashStakeLocked("nobody", 1, 5_000)
+	_, ok := l.validatorLocked("nobody")
+	l.mu.Unlock()
+	if ok {
+		t.Fatalf("slashing a non-validator created a validator record")
+	}
+}
+
+func TestSnapshotRestoredMidEpochKnowsTheValidatorSet(t *testing.T) {
+	params := WithStakingParams(StakingParams{EpochLength: 3, UnbondingPeriod: 10})
+	c := newEvidenceChain(t, params)
+	c.bond(t, map[*Wallet]uint64{c.proposer: 1_000_000})
+	for i := 0; i < 4; i++ {
+		c.mine(t)
+	}
+	// height 5 is in the middle of the epoch running from block 4 to 6
+	snap, err := CreateSnapshot(c.node.Ledger, 0, testWallet(t, "producer"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	restored, _ := OpenLedger("", params)
+	if _, err := restored.RestoreSnapshot(snap, WithTrustedSnapshotRoot(c.node.Ledger.StateRoot())); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	for h := 5; h <= 6; h++ {
+		if set, ok := restored.ValidatorSetAt(h); !ok || set[c.proposer.Address] != 1_000_000 {
+			t.Fatalf("set at height %d not restored: %v %v", h, set, ok)
+		}
+	}
+	// the next block records the proposer's vote for block 5
+	next := c.mine(t)
+	if len(next.Liveness) == 0 {
+		t.Fatalf("block carries no liveness votes")
+	}
+	if err := restored.AddBlock(next); err != nil {
+		t.Fatalf("block after a mid-epoch snapshot: %v", err)
+	}
+	if restored.StateRoot() != c.node.Ledger.StateRoot() {
+		t.Fatalf("restored ledger diverged")
+	}
+}
@@ -0,0 +1,298 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Key layout of ledger state inside a StateStore. Block keys use a fixed-width
+// hex height so that iteration visits them in chain order.
+const (
+	keyBalancePrefix   = "acct/bal/"
+	keyFrozenPrefix    = "acct/frz/"
+	keyUTXOPrefix      = "acct/utxo/"
+	keyNoncePrefix     = "acct/nonce/"
+	keyPubKeyPrefix    = "acct/key/"
+	keyContractPrefix  = "contract/"
+	keyBlockPrefix     = "block/"
+	keyBlockHashPrefix = "blockhash/"
+	keyKVPrefix        = "kv/"
+	keyMetaHeight      = "meta/height"
+	keyMetaUTXOSeq     = "meta/utxo-seq"
+	keyMetaWALSeq      = "meta/wal-seq"
+)
+
+func blockKey(height int) string { return fmt.Sprintf("%s%016x", keyBlockPrefix, height) }
+
+func encodeUint(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+func decodeUint(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// getLocked reads key, preferring writes staged in the pending batch. Store
+// read failures are treated as a missing key; the store is expected to surface
+// persistent faults on Write, which aborts the mutation.
+func (l *Ledger) getLocked(key string) ([]byte, bool) {
+	if v, deleted, ok := l.batch.lookup(key); ok {
+		return v, !deleted
+	}
+	v, err := l.store.Get([]byte(key))
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+func (l *Ledger) setLocked(key string, value []byte) {
+	l.recordUndoLocked(key)
+	l.batch.Set([]byte(key), value)
+	l.markDirtyLocked(key)
+}
+
+func (l *Ledger) deleteLocked(key string) {
+	l.recordUndoLocked(key)
+	l.batch.Delete([]byte(key))
+	l.markDirtyLocked(key)
+}
+
+// discardLocked drops every staged write.
+func (l *Ledger) discardLocked() {
+	l.batch.Reset()
+	clear(l.dirty)
+}
+
+func (l *Ledger) putJSONLocked(key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.setLocked(key, b)
+	return nil
+}
+
+func (l *Ledger) uintLocked(key string) uint64 {
+	v, _ := l.getLocked(key)
+	return decodeUint(v)
+}
+
+// setUintLocked stores v under key, removing the key when v is zero so empty
+// accounts do not occupy space in the store.
+func (l *Ledger) setUintLocked(key string, v uint64) {
+	if v == 0 {
+		l.deleteLocked(key)
+		return
+	}
+	l.setLocked(key, encodeUint(v))
+}
+
+// loadUintLocked reads a counter directly from the store, distinguishing a
+// missing key from a read failure.
+func (l *Ledger) loadUintLocked(key string) (uint64, error) {
+	v, err := l.store.Get([]byte(key))
+	if errors.Is(err, ErrStateNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeUint(v), nil
+}
+
+func (l *Ledger) balanceLocked(addr string) uint64 { return l.uintLocked(keyBalancePrefix + addr) }
+
+// setBalanceLocked updates an account balance together with its UTXO view.
+func (l *Ledger) setBalanceLocked(addr string, v uint64) {
+	l.setUintLocked(keyBalancePrefix+addr, v)
+	l.updateUTXOLocked(addr, v)
+}
+
+func (l *Ledger) nonceLocked(addr string) uint64 { return l.uintLocked(keyNoncePrefix + addr) }
+
+func (l *Ledger) frozenLocked(addr string) uint64 { return l.uintLocked(keyFrozenPrefix + addr) }
+
+func (l *Ledger) setFrozenLocked(addr string, v uint64) { l.setUintLocked(keyFrozenPrefix+addr, v) }
+
+func (l *Ledger) utxosLocked(addr string) []UTXO {
+	v, ok := l.getLocked(keyUTXOPrefix + addr)
+	if !ok {
+		return nil
+	}
+	var outs []UTXO
+	if err := json.Unmarshal(v, &outs); err != nil {
+		return nil
+	}
+	return outs
+}
+
+// updateUTXOLocked replaces the address's outputs with a single output holding
+// its full balance.
+func (l *Ledger) updateUTXOLocked(addr string, balance uint64) {
+	if balance == 0 {
+		l.deleteLocked(keyUTXOPrefix + addr)
+		return
+	}
+	seq := l.uintLocked(keyMetaUTXOSeq)
+	_ = l.putJSONLocked(keyUTXOPrefix+addr, []UTXO{{ID: fmt.Sprintf("u%d", seq), Amount: balance}})
+	l.setLocked(keyMetaUTXOSeq, encodeUint(seq+1))
+}
+
+func (l *Ledger) heightLocked() int { return int(l.uintLocked(keyMetaHeight)) }
+
+func (l *Ledger) blockLocked(height int) (*Block, bool) {
+	v, ok := l.getLocked(blockKey(height))
+	if !ok {
+		return nil, false
+	}
+	var b Block
+	if err := json.Unmarshal(v, &b); err != nil {
+		return nil, false
+	}
+	return &b, true
+}
+
+// putBlockLocked stores b at height, indexes its hash and advances the head
+// when height extends the chain.
+func (l *Ledger) putBlockLocked(height int, b *Block) error {
+	if err := l.putJSONLocked(blockKey(height), b); err != nil {
+		return err
+	}
+	if b.Hash != "" {
+		l.setLocked(keyBlockHashPrefix+b.Hash, encodeUint(uint64(height)))
+	}
+	if height > l.heightLocked() {
+		l.setLocked(keyMetaHeight, encodeUint(uint64(height)))
+	}
+	return nil
+}
+
+// commitLocked appends rec to the WAL, if one is configured, and then writes
+// the pending batch to the store together with the new WAL sequence number.
+// Changes made outside of blocks are first added to the state history. On
+// failure the pending writes are discarded.
+func (l *Ledger) commitLocked(rec walRecord) error {
+	if err := l.recordChangeLocked(rec); err != nil {
+		l.discardLocked()
+		return err
+	}
+	if err := l.appendWAL(rec); err != nil {
+		l.discardLocked()
+		return err
+	}
+	return l.flushLocked()
+}
+
+// recordChangeLocked records the state diff of rec when it changes state
+// outside of a block.
+func (l *Ledger) recordChangeLocked(rec walRecord) error {
+	switch rec.Kind {
+	case walKindBlock, walKindSideBlock, walKindReorg, walKindSnapshot, walKindCheckpoint, walKindFinality:
+		return nil
+	}
+	return l.recordHistoryLocked()
+}
+
+// flushLocked updates the state root, records one more applied WAL entry and
+// writes the pending batch to the store.
+func (l *Ledger) flushLocked() error {
+	defer l.discardLocked()
+	if _, err := l.updateStateRootLocked(); err != nil {
+		return err
+	}
+	l.setLocked(keyMetaWALSeq, encodeUint(l.walSeq+1))
+	if err := l.store.Write(l.batch); err != nil {
+		return err
+	}
+	l.walSeq++
+	return nil
+}
+
+// StateRW returns a view of the ledger implementing StateRW. Arbitrary state
+// written through it is kept in its own namespace of the ledger's store and is
+// persisted and replayed like every other ledger mutation.
+func (l *Ledger) StateRW() StateRW { return ledgerStateRW{l: l} }
+
+type ledgerStateRW struct{ l *Ledger }
+
+// Transfer moves amount between two accounts without charging a fee.
+func (s ledgerStateRW) Transfer(from, to Address, amount uint64) error {
+	if from == "" || to == "" {
+		return ErrEmptyAddress
+	}
+	l := s.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.transferLocked(string(from), string(to), amount, 0); err != nil {
+		return err
+	}
+	return l.commitLocked(walRecord{Kind: walKindTransfer, Addr: string(from), To: string(to), Amount: amount})
+}
+
+// transferLocked debits amount plus fee from one account and credits amount
+// to another without any authorisation checks.
+func (l *Ledger) transferLocked(from, to string, amount, fee uint64) error {
+	bal := l.balanceLocked(from)
+	if bal < amount+fee {
+		return errors.New("insufficient funds")
+	}
+	l.setBalanceLocked(from, bal-amount-fee)
+	l.setBalanceLocked(to, l.balanceLocked(to)+amount)
+	return nil
+}
+
+// SetState stores value under key.
+func (s ledgerStateRW) SetState(key, value []byte) {
+	l := s.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setLocked(keyKVPrefix+string(key), value)
+	_ = l.commitLocked(walRecord{Kind: walKindState, Key: key, Value: value})
+}
+
+// GetState returns the value stored under key or ErrStateNotFound.
+func (s ledgerStateRW) GetState(key []byte) ([]byte, error) {
+	s.l.mu.RLock()
+	defer s.l.mu.RUnlock()
+	v, err := s.l.store.Get([]byte(keyKVPrefix + string(key)))
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// HasState reports whether key is set.
+func (s ledgerStateRW) HasState(key []byte) (bool, error) {
+	s.l.mu.RLock()
+	defer s.l.mu.RUnlock()
+	return s.l.store.Has([]byte(keyKVPrefix + string(key)))
+}
+
+// PrefixIterator iterates the entries whose keys start with prefix in key
+// order. The returned iterator also implements StateKeyIterator.
+func (s ledgerStateRW) PrefixIterator(prefix []byte) StateIterator {
+	s.l.mu.RLock()
+	defer s.l.mu.RUnlock()
+	return kvIterator{StateKeyIterator: s.l.store.Iterate([]byte(keyKVPrefix + string(prefix)))}
+}
+
+// BalanceOf returns the spendable balance of addr.
+func (s ledgerStateRW) BalanceOf(addr Address) uint64 {
+	s.l.mu.RLock()
+	defer s.l.mu.RUnlock()
+	return s.l.balanceLocked(string(addr))
+}
+
+// kvIterator strips the ledger namespace from keys returned by the store.
+type kvIterator struct{ StateKeyIterator }
+
+func (it kvIterator) Key() []byte {
+	return []byte(strings.TrimPrefix(string(it.StateKeyIterator.Key()), keyKVPrefix))
+}
@@ -1,33 +1,79 @@
 package core
 
-import "testing"
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testWallet returns a wallet derived deterministically from label.
+func testWallet(t testing.TB, label string) *Wallet {
+	t.Helper()
+	seed := sha256.Sum256([]byte(label))
+	w, err := NewWalletFromSeed(seed[:])
+	if err != nil {
+		t.Fatalf("wallet: %v", err)
+	}
+	return w
+}
+
+// signedTestTx builds a transaction from w and signs it.
+func signedTestTx(t testing.TB, w *Wallet, to string, amount, fee, nonce uint64) *Transaction {
+	t.Helper()
+	tx := NewTransaction(w.Address, to, amount, fee, nonce)
+	if _, err := w.Sign(tx); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return tx
+}
+
+// sealTestBlock sets b's state root to the one applying it on top of l
+// produces. A hash derived from b's header is recomputed to match.
+func sealTestBlock(t testing.TB, l *Ledger, b *Block) *Block {
+	t.Helper()
+	rehash := b.Hash != "" && b.Hash == b.HeaderHash(b.Nonce)
+	root, err := l.ComputeStateRoot(b)
+	if err != nil {
+		t.Fatalf("state root: %v", err)
+	}
+	b.StateRoot = root
+	if rehash {
+		b.Hash = b.HeaderHash(b.Nonce)
+	}
+	return b
+}
 
 func TestLedgerApplyTransaction(t *testing.T) {
+	alice := testWallet(t, "alice")
 	l := NewLedger()
-	l.Credit("alice", 100)
-	tx := NewTransaction("alice", "bob", 40, 2, 0)
+	l.Credit(alice.Address, 100)
+	tx := signedTestTx(t, alice, "bob", 40, 2, 0)
 	if err := l.ApplyTransaction(tx); err != nil {
 		t.Fatalf("apply failed: %v", err)
 	}
-	if bal := l.GetBalance("alice"); bal != 58 {
+	if bal := l.GetBalance(alice.Address); bal != 58 {
 		t.Fatalf("unexpected balance: %d", bal)
 	}
 	if bal := l.GetBalance("bob"); bal != 40 {
 		t.Fatalf("unexpected recipient balance: %d", bal)
 	}
-	tx2 := NewTransaction("alice", "bob", 100, 1, 1)
+	tx2 := signedTestTx(t, alice, "bob", 100, 1, 1)
 	if err := l.ApplyTransaction(tx2); err == nil {
 		t.Fatalf("expected insufficient funds error")
 	}
 }
 
 func TestLedgerUTXOAndPool(t *testing.T) {
+	alice := testWallet(t, "alice")
 	l := NewLedger()
-	l.Mint("alice", 50)
-	if utxos := l.GetUTXOs("alice"); len(utxos) != 1 || utxos[0].Amount != 50 {
+	l.Mint(alice.Address, 50)
+	if utxos := l.GetUTXOs(alice.Address); len(utxos) != 1 || utxos[0].Amount != 50 {
 		t.Fatalf("unexpected utxo state: %+v", utxos)
 	}
-	tx := NewTransaction("alice", "bob", 20, 0, 0)
+	tx := signedTestTx(t, alice, "bob", 20, 0, 0)
 	l.AddToPool(tx)
 	if pool := l.Pool(); len(pool) != 1 {
 		t.Fatalf("expected pool size 1 got %d", len(pool))
@@ -35,7 +81,7 @@ func TestLedgerUTXOAndPool(t *testing.T) {
 	if err := l.ApplyTransaction(tx); err != nil {
 		t.Fatalf("apply failed: %v", err)
 	}
-	if utxos := l.GetUTXOs("alice"); len(utxos) != 1 || utxos[0].Amount != 30 {
+	if utxos := l.GetUTXOs(alice.Address); len(utxos) != 1 || utxos[0].Amount != 30 {
 		t.Fatalf("unexpected alice utxo: %+v", utxos)
 	}
 	if utxos := l.GetUTXOs("bob"); len(utxos) != 1 || utxos[0].Amount != 20 {
@@ -43,6 +89,27 @@ func TestLedgerUTXOAndPool(t *testing.T) {
 	}
 }
 
+func TestLedgerAddToPoolRejectsForgedReplacements(t *testing.T) {
+	alice, mallory := testWallet(t, "alice"), testWallet(t, "mallory")
+	l := NewLedger()
+	l.Mint(alice.Address, 500)
+	tx := signedTestTx(t, alice, "bob", 20, 10, 0)
+	if err := l.AddToPool(tx); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	// a higher paying transaction at the same nonce signed with another key
+	forged := NewTransaction(alice.Address, "mallory", 20, 100, 0)
+	if _, err := mallory.Sign(forged); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := l.AddToPool(forged); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature got %v", err)
+	}
+	if pool := l.Pool(); len(pool) != 1 || pool[0].ID != tx.ID {
+		t.Fatalf("forged transaction replaced the queued one: %v", pool)
+	}
+}
+
 func TestLedgerValidation(t *testing.T) {
 	l := NewLedger()
 	if err := l.AddBlock(nil); err != ErrNilBlock {
@@ -55,3 +122,267 @@ func TestLedgerValidation(t *testing.T) {
 		t.Fatalf("expected ErrNilTransaction got %v", err)
 	}
 }
+
+func TestLedgerWALReplayRestoresState(t *testing.T) {
+	alice := testWallet(t, "alice")
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Mint(alice.Address, 100)
+	tx := signedTestTx(t, alice, "bob", 30, 1, 0)
+	blk := sealTestBlock(t, l, NewBlock([]*SubBlock{{Transactions: []*Transaction{tx}}}, ""))
+	if err := l.AddBlock(blk); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	if err := l.Transfer("bob", "carol", 10, 0); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	want, err := l.Checkpoint()
+	if err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+
+	restored, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if h, _ := restored.Head(); h != 1 {
+		t.Fatalf("expected height 1 got %d", h)
+	}
+	if got := restored.GetBalance(alice.Address); got != 69 {
+		t.Fatalf("alice balance %d", got)
+	}
+	if got := restored.GetBalance("bob"); got != 20 {
+		t.Fatalf("bob balance %d", got)
+	}
+	if got := restored.GetBalance("carol"); got != 10 {
+		t.Fatalf("carol balance %d", got)
+	}
+	if restored.StateDigest() != want.Digest {
+		t.Fatalf("digest mismatch after replay")
+	}
+}
+
+func TestLedgerWALTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Mint("alice", 5)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	if _, err := f.WriteString(`0badc0de {"kind":"cre`); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	f.Close()
+
+	_, err = OpenLedger(path)
+	if !errors.Is(err, ErrWALTruncated) {
+		t.Fatalf("expected ErrWALTruncated got %v", err)
+	}
+	var walErr *WALError
+	if !errors.As(err, &walErr) || walErr.Record != 1 || walErr.Offset == 0 {
+		t.Fatalf("unexpected wal error %#v", err)
+	}
+}
+
+func TestLedgerWALCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Mint("alice", 5)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	corrupted := strings.Replace(string(data), `"amount":5`, `"amount":9`, 1)
+	if err := os.WriteFile(path, []byte(corrupted), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := OpenLedger(path); !errors.Is(err, ErrWALCorrupt) {
+		t.Fatalf("expected ErrWALCorrupt got %v", err)
+	}
+}
+
+func TestLedgerWALCheckpointMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	rec, err := encodeWALRecord(walRecord{Kind: walKindCredit, Addr: "alice", Amount: 5})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	cp, err := encodeWALRecord(walRecord{Kind: walKindCheckpoint, Checkpoint: &StateCheckpoint{Height: 0, Digest: "bogus"}})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := os.WriteFile(path, append(rec, cp...), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := OpenLedger(path); !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("expected ErrStateMismatch got %v", err)
+	}
+}
+
+func openFileLedger(t *testing.T, dir string) *Ledger {
+	t.Helper()
+	store, err := OpenFileStateStore(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	l, err := OpenLedger(filepath.Join(dir, "ledger.wal"), WithStateStore(store))
+	if err != nil {
+		store.Close()
+		t.Fatalf("open ledger: %v", err)
+	}
+	return l
+}
+
+func TestLedgerFileStateStoreRestart(t *testing.T) {
+	alice := testWallet(t, "alice")
+	dir := t.TempDir()
+	l := openFileLedger(t, dir)
+	l.Credit(alice.Address, 100)
+	tx := signedTestTx(t, alice, "bob", 30, 1, 0)
+	if err := l.AddBlock(sealTestBlock(t, l, &Block{Hash: "h1", SubBlocks: []*SubBlock{{Transactions: []*Transaction{tx}}}})); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	l.StateRW().SetState([]byte("charity:1"), []byte("x"))
+	digest := l.StateDigest()
+	l.Close()
+
+	l = openFileLedger(t, dir)
+	defer l.Close()
+	if l.GetBalance(alice.Address) != 69 || l.GetBalance("bob") != 30 {
+		t.Fatalf("records re-applied on restart: alice=%d bob=%d", l.GetBalance(alice.Address), l.GetBalance("bob"))
+	}
+	if h, hash := l.Head(); h != 1 || hash != "h1" || !l.HasBlock("h1") {
+		t.Fatalf("unexpected head %d %q", h, hash)
+	}
+	if v, err := l.StateRW().GetState([]byte("charity:1")); err != nil || string(v) != "x" {
+		t.Fatalf("state lost: %q %v", v, err)
+	}
+	if l.StateDigest() != digest {
+		t.Fatalf("digest changed across restart")
+	}
+
+	// a fresh store rebuilt from the WAL alone reaches the same state
+	rebuilt, err := OpenLedger(filepath.Join(dir, "ledger.wal"))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if rebuilt.StateDigest() != digest {
+		t.Fatalf("replayed digest differs")
+	}
+}
+
+func TestLedgerStoreAheadOfWAL(t *testing.T) {
+	dir := t.TempDir()
+	l := openFileLedger(t, dir)
+	l.Credit("alice", 10)
+	l.Close()
+	if err := os.Remove(filepath.Join(dir, "ledger.wal")); err != nil {
+		t.Fatalf("remove wal: %v", err)
+	}
+	store, _ := OpenFileStateStore(filepath.Join(dir, "state.db"))
+	defer store.Close()
+	if _, err := OpenLedger(filepath.Join(dir, "ledger.wal"), WithStateStore(store)); !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("expected ErrStateMismatch got %v", err)
+	}
+}
+
+func TestLedgerStateRW(t *testing.T) {
+	l := NewLedger()
+	s := l.StateRW()
+	l.Credit("alice", 20)
+	if err := s.Transfer("alice", "bob", 5); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if s.BalanceOf("alice") != 15 || s.BalanceOf("bob") != 5 {
+		t.Fatalf("unexpected balances")
+	}
+	if err := s.Transfer("bob", "alice", 6); err == nil {
+		t.Fatalf("expected insufficient funds")
+	}
+	s.SetState([]byte("p:b"), []byte("2"))
+	s.SetState([]byte("p:a"), []byte("1"))
+	s.SetState([]byte("q:a"), []byte("3"))
+	if ok, _ := s.HasState([]byte("p:a")); !ok {
+		t.Fatalf("expected key present")
+	}
+	if _, err := s.GetState([]byte("missing")); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("expected ErrStateNotFound got %v", err)
+	}
+	it := s.PrefixIterator([]byte("p:"))
+	var got []string
+	for it.Next() {
+		got = append(got, string(it.(StateKeyIterator).Key())+"="+string(it.Value()))
+	}
+	if strings.Join(got, ",") != "p:a=1,p:b=2" {
+		t.Fatalf("unexpected iteration: %v", got)
+	}
+}
+
+func TestLedgerNonceAndSignature(t *testing.T) {
+	l := NewLedger()
+	alice := testWallet(t, "alice")
+	mallory := testWallet(t, "mallory")
+	l.Credit(alice.Address, 100)
+
+	unsigned := NewTransaction(alice.Address, "bob", 1, 0, 0)
+	if err := l.ApplyTransaction(unsigned); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for unsigned tx got %v", err)
+	}
+	forged := NewTransaction(alice.Address, "bob", 1, 0, 0)
+	mallory.Sign(forged)
+	if err := l.ApplyTransaction(forged); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for foreign key got %v", err)
+	}
+	if err := l.ApplyTransaction(signedTestTx(t, alice, "bob", 1, 0, 1)); !errors.Is(err, ErrNonceGap) {
+		t.Fatalf("expected ErrNonceGap got %v", err)
+	}
+	if l.GetBalance(alice.Address) != 100 || l.Nonce(alice.Address) != 0 {
+		t.Fatalf("rejected transactions changed state")
+	}
+
+	tx := signedTestTx(t, alice, "bob", 10, 0, 0)
+	if err := l.ApplyTransaction(tx); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, ok := l.PublicKey(alice.Address); !ok {
+		t.Fatalf("public key not registered on first use")
+	}
+	if err := l.ApplyTransaction(tx); !errors.Is(err, ErrNonceTooLow) {
+		t.Fatalf("expected replay to fail with ErrNonceTooLow got %v", err)
+	}
+	tampered := signedTestTx(t, alice, "bob", 10, 0, 1)
+	tampered.Amount = 90
+	if err := l.ApplyTransaction(tampered); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for tampered tx got %v", err)
+	}
+	if l.GetBalance("bob") != 10 || l.Nonce(alice.Address) != 1 {
+		t.Fatalf("unexpected state: bob=%d nonce=%d", l.GetBalance("bob"), l.Nonce(alice.Address))
+	}
+}
+
+func TestLedgerRegisterPublicKey(t *testing.T) {
+	l := NewLedger()
+	alice := testWallet(t, "alice")
+	if err := l.RegisterPublicKey(&alice.PublicKey); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := l.RegisterPublicKey(&alice.PublicKey); err != nil {
+		t.Fatalf("re-register same key: %v", err)
+	}
+	l.Credit(alice.Address, 5)
+	tx := signedTestTx(t, alice, "bob", 5, 0, 0)
+	tx.PublicKey = nil
+	if err := l.ApplyTransaction(tx); err != nil {
+		t.Fatalf("apply with registered key: %v", err)
+	}
+}
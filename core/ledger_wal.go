@@ -0,0 +1,389 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+)
+
+// DefaultCheckpointInterval is the number of blocks between automatic state
+// checkpoints written to the ledger WAL.
+const DefaultCheckpointInterval = 100
+
+var (
+	// ErrWALCorrupt indicates a WAL record failed its checksum or could not be
+	// decoded.
+	ErrWALCorrupt = errors.New("wal corrupt")
+	// ErrWALTruncated indicates the WAL ends with a partially written record.
+	ErrWALTruncated = errors.New("wal truncated")
+	// ErrStateMismatch is returned when replaying the WAL produces a state that
+	// disagrees with a recorded checkpoint.
+	ErrStateMismatch = errors.New("replayed state does not match checkpoint")
+)
+
+// WALError describes where recovery of a ledger WAL failed. Offset is the byte
+// position of the offending record, which is also the length of the valid
+// prefix an operator can keep when repairing the log.
+type WALError struct {
+	Path   string
+	Offset int64
+	Record int
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *WALError) Error() string {
+	return fmt.Sprintf("wal %s: record %d at offset %d: %v", e.Path, e.Record, e.Offset, e.Err)
+}
+
+// Unwrap exposes the underlying cause so callers can use errors.Is.
+func (e *WALError) Unwrap() error { return e.Err }
+
+// StateCheckpoint records the ledger height and the digest of the account state
+// at that height.
+type StateCheckpoint struct {
+	Height int    `json:"height"`
+	Digest string `json:"digest"`
+}
+
+const (
+	walKindBlock      = "block"
+	walKindCredit     = "credit"
+	walKindTx         = "tx"
+	walKindReverse    = "reverse"
+	walKindFreeze     = "freeze"
+	walKindRelease    = "release"
+	walKindContract   = "contract"
+	walKindCheckpoint = "checkpoint"
+	walKindTransfer   = "transfer"
+	walKindState      = "state"
+	walKindPubKey     = "pubkey"
+	walKindSideBlock  = "sideblock"
+	walKindReorg      = "reorg"
+	walKindSnapshot   = "snapshot"
+	walKindFinality   = "finality"
+
+	walKindContractState = "contractstate"
+	walKindDeploy        = "deploy"
+	walKindReward        = "reward"
+)
+
+// walRecord is a single state transition persisted to the WAL. Blocks are
+// stored whole and re-executed on replay; the remaining kinds capture state
+// changes made outside of blocks such as mints and reversals.
+type walRecord struct {
+	Kind       string           `json:"kind"`
+	Block      *Block           `json:"block,omitempty"`
+	Blocks     []*Block         `json:"blocks,omitempty"`
+	Height     int              `json:"height,omitempty"`
+	Tx         *Transaction     `json:"tx,omitempty"`
+	Addr       string           `json:"addr,omitempty"`
+	To         string           `json:"to,omitempty"`
+	Amount     uint64           `json:"amount,omitempty"`
+	Fee        uint64           `json:"fee,omitempty"`
+	Key        []byte           `json:"key,omitempty"`
+	Value      []byte           `json:"value,omitempty"`
+	Contract   *LedgerContract  `json:"contract,omitempty"`
+	Checkpoint *StateCheckpoint `json:"checkpoint,omitempty"`
+	Entries    []StateEntry     `json:"entries,omitempty"`
+
+	Changes     *ContractStateChanges `json:"changes,omitempty"`
+	Certificate *FinalityCertificate  `json:"certificate,omitempty"`
+}
+
+// encodeWALRecord frames a record as "<crc32 hex> <json>\n".
+func encodeWALRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, 0, len(payload)+10)
+	line = append(line, fmt.Sprintf("%08x ", crc32.ChecksumIEEE(payload))...)
+	line = append(line, payload...)
+	return append(line, '\n'), nil
+}
+
+// decodeWALRecord parses a framed record. Lines beginning with '{' are treated
+// as legacy unframed block entries written by earlier versions.
+func decodeWALRecord(line []byte) (walRecord, error) {
+	var rec walRecord
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) > 0 && line[0] == '{' {
+		var b Block
+		if err := json.Unmarshal(line, &b); err != nil {
+			return rec, err
+		}
+		return walRecord{Kind: walKindBlock, Block: &b}, nil
+	}
+	sep := bytes.IndexByte(line, ' ')
+	if sep != 8 {
+		return rec, errors.New("missing checksum")
+	}
+	sum, err := strconv.ParseUint(string(line[:sep]), 16, 32)
+	if err != nil {
+		return rec, fmt.Errorf("bad checksum: %w", err)
+	}
+	payload := line[sep+1:]
+	if crc32.ChecksumIEEE(payload) != uint32(sum) {
+		return rec, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// appendWAL writes a record to the WAL if a path is configured. Callers must
+// hold l.mu so records are written in the order they were applied.
+func (l *Ledger) appendWAL(rec walRecord) error {
+	if l.walPath == "" {
+		return nil
+	}
+	line, err := encodeWALRecord(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.walPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replayWAL brings the state store up to date with the log at path. Records
+// the store already reflects are skipped; the remaining ones are re-applied
+// and committed one by one. A missing file is treated as an empty log.
+func (l *Ledger) replayWAL(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	applied := l.walSeq
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l.checkWALCoverage(path, 0, applied)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	var n, seq int
+	for ; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) == 0 {
+				return l.checkWALCoverage(path, seq, applied)
+			}
+			return &WALError{Path: path, Offset: offset, Record: n, Err: ErrWALTruncated}
+		}
+		if err != nil {
+			return &WALError{Path: path, Offset: offset, Record: n, Err: err}
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			offset += int64(len(line))
+			continue
+		}
+		rec, err := decodeWALRecord(line)
+		if err != nil {
+			return &WALError{Path: path, Offset: offset, Record: n, Err: fmt.Errorf("%w: %v", ErrWALCorrupt, err)}
+		}
+		if uint64(seq) < applied {
+			l.skipRecordLocked(rec)
+		} else {
+			err := l.replayRecordLocked(rec)
+			if err == nil {
+				err = l.recordChangeLocked(rec)
+			}
+			if err != nil {
+				l.discardLocked()
+				return &WALError{Path: path, Offset: offset, Record: n, Err: err}
+			}
+			if err := l.flushLocked(); err != nil {
+				return &WALError{Path: path, Offset: offset, Record: n, Err: err}
+			}
+		}
+		seq++
+		offset += int64(len(line))
+	}
+}
+
+// checkWALCoverage rejects a state store that reflects more records than the
+// log holds, which means the log was truncated or belongs to another store.
+func (l *Ledger) checkWALCoverage(path string, records int, applied uint64) error {
+	if uint64(records) < applied {
+		return fmt.Errorf("%w: state store reflects %d wal records but %s holds %d",
+			ErrStateMismatch, applied, path, records)
+	}
+	return nil
+}
+
+// skipRecordLocked keeps checkpoint bookkeeping in step for records already
+// reflected in the state store.
+func (l *Ledger) skipRecordLocked(rec walRecord) {
+	switch rec.Kind {
+	case walKindBlock:
+		l.sinceCheckpoint++
+	case walKindCheckpoint:
+		l.sinceCheckpoint = 0
+	}
+}
+
+// replayRecordLocked re-executes a single WAL record. Any record that applied
+// cleanly when it was written must apply cleanly again, so failures are
+// reported as state mismatches.
+func (l *Ledger) replayRecordLocked(rec walRecord) error {
+	switch rec.Kind {
+	case walKindBlock:
+		if rec.Block == nil {
+			return fmt.Errorf("%w: empty block record", ErrWALCorrupt)
+		}
+		if err := l.applyBlockLocked(rec.Block); err != nil {
+			return fmt.Errorf("%w: block %v", ErrStateMismatch, err)
+		}
+		l.sinceCheckpoint++
+	case walKindSideBlock:
+		if rec.Block == nil {
+			return fmt.Errorf("%w: empty side block record", ErrWALCorrupt)
+		}
+		if err := l.putJSONLocked(keySideBlockPrefix+rec.Block.Hash, rec.Block); err != nil {
+			return err
+		}
+	case walKindReorg:
+		if err := l.reorgLocked(rec.Height, rec.Blocks); err != nil {
+			return fmt.Errorf("%w: reorg %v", ErrStateMismatch, err)
+		}
+	case walKindSnapshot:
+		if rec.Block == nil {
+			return fmt.Errorf("%w: empty snapshot record", ErrWALCorrupt)
+		}
+		if err := l.restoreStateLocked(rec.Height, rec.Block, rec.Entries); err != nil {
+			return err
+		}
+	case walKindFinality:
+		if rec.Certificate == nil {
+			return fmt.Errorf("%w: empty finality record", ErrWALCorrupt)
+		}
+		if err := l.putFinalityLocked(rec.Certificate); err != nil {
+			return err
+		}
+	case walKindCredit:
+		l.creditLocked(rec.Addr, rec.Amount)
+	case walKindReward:
+		l.rewardLocked(rec.Addr, rec.Amount)
+	case walKindTx:
+		if err := l.applyTransactionLocked(rec.Tx); err != nil {
+			return fmt.Errorf("%w: transaction %v", ErrStateMismatch, err)
+		}
+	case walKindTransfer:
+		if err := l.transferLocked(rec.Addr, rec.To, rec.Amount, rec.Fee); err != nil {
+			return fmt.Errorf("%w: transfer %v", ErrStateMismatch, err)
+		}
+	case walKindReverse:
+		if err := l.reverseTransactionLocked(rec.Tx); err != nil {
+			return fmt.Errorf("%w: reversal %v", ErrStateMismatch, err)
+		}
+	case walKindFreeze:
+		if err := l.freezeLocked(rec.Addr, rec.Amount); err != nil {
+			return fmt.Errorf("%w: freeze %v", ErrStateMismatch, err)
+		}
+	case walKindRelease:
+		l.releaseLocked(rec.Addr, rec.Amount)
+	case walKindContract:
+		if rec.Contract == nil {
+			return fmt.Errorf("%w: empty contract record", ErrWALCorrupt)
+		}
+		if err := l.putJSONLocked(keyContractPrefix+rec.Contract.Address, rec.Contract); err != nil {
+			return err
+		}
+	case walKindDeploy:
+		if rec.Contract == nil {
+			return fmt.Errorf("%w: empty deploy record", ErrWALCorrupt)
+		}
+		if err := l.createContractLocked(rec.Contract); err != nil {
+			return fmt.Errorf("%w: deploy %v", ErrStateMismatch, err)
+		}
+	case walKindState:
+		l.setLocked(keyKVPrefix+string(rec.Key), rec.Value)
+	case walKindContractState:
+		if rec.Changes == nil {
+			return fmt.Errorf("%w: empty contract state record", ErrWALCorrupt)
+		}
+		if err := l.applyContractChangesLocked(rec.Changes); err != nil {
+			return fmt.Errorf("%w: contract state %v", ErrStateMismatch, err)
+		}
+	case walKindPubKey:
+		l.setLocked(keyPubKeyPrefix+rec.Addr, rec.Key)
+	case walKindCheckpoint:
+		if rec.Checkpoint == nil {
+			return fmt.Errorf("%w: empty checkpoint record", ErrWALCorrupt)
+		}
+		got := StateCheckpoint{Height: l.heightLocked(), Digest: l.stateDigestLocked()}
+		if got != *rec.Checkpoint {
+			return fmt.Errorf("%w: height %d digest %s, checkpoint height %d digest %s",
+				ErrStateMismatch, got.Height, got.Digest, rec.Checkpoint.Height, rec.Checkpoint.Digest)
+		}
+		l.sinceCheckpoint = 0
+	default:
+		return fmt.Errorf("%w: unknown record kind %q", ErrWALCorrupt, rec.Kind)
+	}
+	return nil
+}
+
+// SetCheckpointInterval configures how many blocks are added between automatic
+// checkpoints. A value of zero disables automatic checkpoints.
+func (l *Ledger) SetCheckpointInterval(blocks int) {
+	if blocks < 0 {
+		blocks = 0
+	}
+	l.mu.Lock()
+	l.checkpointEvery = blocks
+	l.mu.Unlock()
+}
+
+// Checkpoint records the current state digest in the WAL so that a later
+// replay can prove it reproduced the same state.
+func (l *Ledger) Checkpoint() (StateCheckpoint, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.checkpointLocked()
+}
+
+func (l *Ledger) checkpointLocked() (StateCheckpoint, error) {
+	cp := StateCheckpoint{Height: l.heightLocked(), Digest: l.stateDigestLocked()}
+	if err := l.commitLocked(walRecord{Kind: walKindCheckpoint, Checkpoint: &cp}); err != nil {
+		return StateCheckpoint{}, err
+	}
+	l.sinceCheckpoint = 0
+	return cp, nil
+}
+
+// StateDigest returns the hex encoded state root, a single hash committing to
+// balances, frozen funds, registered contracts and arbitrary state written
+// through StateRW. It is recorded in checkpoints so replay can prove it
+// reproduced the same state.
+func (l *Ledger) StateDigest() string {
+	return l.StateRoot()
+}
+
+// stateDigestLocked reads committed state only, so callers must not have
+// writes pending in the batch.
+func (l *Ledger) stateDigestLocked() string {
+	root := l.stateRootHashLocked()
+	return hex.EncodeToString(root[:])
+}
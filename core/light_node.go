@@ -2,16 +2,27 @@ package core
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 
 	"synnergy/internal/nodes"
 )
 
 // LightNode maintains a minimal view of the chain using block headers only.
+// Given the validator sets of the chain it verifies finality certificates
+// without executing blocks.
 type LightNode struct {
 	*BaseNode
-	mu      sync.RWMutex
-	headers []nodes.BlockHeader
+	mu         sync.RWMutex
+	headers    []nodes.BlockHeader
+	validators []heightSet
+	finalized  uint64
+}
+
+type heightSet struct {
+	from uint64
+	set  ValidatorSet
 }
 
 // NewLightNode constructs a light node with no headers.
@@ -48,3 +59,78 @@ func (n *LightNode) Headers() []nodes.BlockHeader {
 	copy(out, n.headers)
 	return out
 }
+
+// SetValidatorSet records set as the validator set from height onwards, until
+// a later set takes over.
+func (n *LightNode) SetValidatorSet(height uint64, set ValidatorSet) {
+	cp := make(ValidatorSet, len(set))
+	for addr, stake := range set {
+		cp[addr] = stake
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	i := sort.Search(len(n.validators), func(i int) bool { return n.validators[i].from >= height })
+	if i < len(n.validators) && n.validators[i].from == height {
+		n.validators[i].set = cp
+		return
+	}
+	n.validators = append(n.validators, heightSet{})
+	copy(n.validators[i+1:], n.validators[i:])
+	n.validators[i] = heightSet{from: height, set: cp}
+}
+
+// ValidatorSet returns the validator set in effect at height.
+func (n *LightNode) ValidatorSet(height uint64) (ValidatorSet, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.validatorSetLocked(height)
+}
+
+func (n *LightNode) validatorSetLocked(height uint64) (ValidatorSet, bool) {
+	i := sort.Search(len(n.validators), func(i int) bool { return n.validators[i].from > height })
+	if i == 0 {
+		return nil, false
+	}
+	return n.validators[i-1].set, true
+}
+
+// VerifyFinality checks cert against the header it finalizes and the
+// validator set at its height. Verified certificates advance the finalized
+// height.
+func (n *LightNode) VerifyFinality(cert *FinalityCertificate) error {
+	if cert == nil {
+		return fmt.Errorf("%w: certificate required", ErrInvalidCertificate)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var header *nodes.BlockHeader
+	for i := range n.headers {
+		if n.headers[i].Height == cert.Height {
+			header = &n.headers[i]
+		}
+	}
+	if header == nil {
+		return fmt.Errorf("%w: no header at height %d", ErrInvalidCertificate, cert.Height)
+	}
+	if header.Hash != cert.BlockHash {
+		return fmt.Errorf("%w: header %d is %s, certificate finalizes %s", ErrInvalidCertificate, cert.Height, header.Hash, cert.BlockHash)
+	}
+	set, ok := n.validatorSetLocked(cert.Height)
+	if !ok {
+		return fmt.Errorf("%w: no validator set for height %d", ErrInvalidCertificate, cert.Height)
+	}
+	if err := cert.Verify(set); err != nil {
+		return err
+	}
+	if cert.Height > n.finalized {
+		n.finalized = cert.Height
+	}
+	return nil
+}
+
+// FinalizedHeight returns the height of the highest header proven final.
+func (n *LightNode) FinalizedHeight() uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.finalized
+}
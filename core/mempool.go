@@ -0,0 +1,437 @@
+package core
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mempool defaults used by NewMempool.
+const (
+	DefaultMempoolMaxTxs         = 10000
+	DefaultMempoolMaxPerSender   = 64
+	DefaultMempoolTTL            = 3 * time.Hour
+	DefaultMempoolMinBumpPercent = 10
+)
+
+var (
+	// ErrMempoolFull is returned when the pool is at capacity and the
+	// transaction does not pay more per byte than the cheapest evictable one.
+	ErrMempoolFull = errors.New("mempool full")
+	// ErrMempoolSenderLimit is returned when a transaction's nonce lies beyond
+	// the window of nonces a single sender may queue.
+	ErrMempoolSenderLimit = errors.New("mempool sender limit reached")
+	// ErrReplacementUnderpriced is returned when a transaction replaces a queued
+	// one with the same sender and nonce without the required fee bump.
+	ErrReplacementUnderpriced = errors.New("replacement transaction underpriced")
+	// ErrFeeTooLow is returned when a transaction pays less than the pool's
+	// minimum fee for its size.
+	ErrFeeTooLow = errors.New("fee too low")
+	// ErrTxAlreadyKnown is returned when the exact transaction is already queued.
+	ErrTxAlreadyKnown = errors.New("transaction already in mempool")
+)
+
+// MempoolState supplies the account state the mempool orders transactions
+// against. Ledger satisfies it.
+type MempoolState interface {
+	Nonce(addr string) uint64
+	GetBalance(addr string) uint64
+}
+
+// Mempool holds transactions waiting for inclusion in a block. Each sender
+// has a queue keyed by nonce; transactions may arrive out of order and wait
+// until the gap before them is filled. Block producers take transactions with
+// Pending, which orders executable transactions by fee per byte while keeping
+// every sender's nonces in sequence. Fees are compared by Transaction.FeeCap,
+// so a transaction priced under a fee market counts with the most it may pay.
+// A queued transaction can be replaced by one with the same sender and nonce
+// that raises the fee by at least the configured bump, entries expire after a
+// TTL, and once the pool reaches its size cap the transaction paying the
+// least per byte is evicted.
+type Mempool struct {
+	mu    sync.Mutex
+	state MempoolState
+	now   func() time.Time
+
+	maxTxs       int
+	maxPerSender int
+	ttl          time.Duration
+	minBump      uint64
+	baseFee      uint64
+	feePerByte   uint64
+
+	senders map[string]map[uint64]*mempoolEntry
+	count   int
+	seq     uint64
+}
+
+type mempoolEntry struct {
+	tx    *Transaction
+	size  uint64
+	added time.Time
+	seq   uint64
+}
+
+// MempoolOption configures optional behaviour of a Mempool.
+type MempoolOption func(*Mempool)
+
+// WithMempoolMaxTxs caps the number of transactions held by the pool.
+func WithMempoolMaxTxs(n int) MempoolOption {
+	return func(m *Mempool) {
+		if n > 0 {
+			m.maxTxs = n
+		}
+	}
+}
+
+// WithMempoolMaxPerSender limits how far ahead of its account nonce a sender
+// may queue transactions.
+func WithMempoolMaxPerSender(n int) MempoolOption {
+	return func(m *Mempool) {
+		if n > 0 {
+			m.maxPerSender = n
+		}
+	}
+}
+
+// WithMempoolTTL sets how long a transaction may wait before it is dropped.
+// A zero TTL keeps transactions until they are mined or evicted.
+func WithMempoolTTL(ttl time.Duration) MempoolOption {
+	return func(m *Mempool) { m.ttl = ttl }
+}
+
+// WithMempoolMinBump sets the percentage by which a replacement must raise
+// the fee of the transaction it replaces.
+func WithMempoolMinBump(percent uint64) MempoolOption {
+	return func(m *Mempool) { m.minBump = percent }
+}
+
+// WithMempoolFeeFloor sets the minimum fee the pool accepts, priced with
+// FeeForTransfer as a base fee plus a per-byte rate.
+func WithMempoolFeeFloor(baseFee, perByte uint64) MempoolOption {
+	return func(m *Mempool) {
+		m.baseFee = baseFee
+		m.feePerByte = perByte
+	}
+}
+
+// WithMempoolClock overrides the time source used for TTL expiry.
+func WithMempoolClock(now func() time.Time) MempoolOption {
+	return func(m *Mempool) {
+		if now != nil {
+			m.now = now
+		}
+	}
+}
+
+// NewMempool creates an empty pool whose nonce and balance checks are made
+// against state.
+func NewMempool(state MempoolState, opts ...MempoolOption) *Mempool {
+	m := &Mempool{
+		state:        state,
+		now:          time.Now,
+		maxTxs:       DefaultMempoolMaxTxs,
+		maxPerSender: DefaultMempoolMaxPerSender,
+		ttl:          DefaultMempoolTTL,
+		minBump:      DefaultMempoolMinBumpPercent,
+		senders:      make(map[string]map[uint64]*mempoolEntry),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// FeeBreakdown splits the fee paid by tx into the pool's base and per-byte
+// components, with anything above them counted as priority tip.
+func (m *Mempool) FeeBreakdown(tx *Transaction) FeeBreakdown {
+	size := tx.Size()
+	fee := tx.FeeCap()
+	floor := FeeForTransfer(size, m.baseFee, m.feePerByte, 0)
+	if fee <= floor.Total {
+		return FeeBreakdown{Base: floor.Base, Variable: floor.Variable, Total: fee}
+	}
+	return FeeForTransfer(size, m.baseFee, m.feePerByte, fee-floor.Total)
+}
+
+// Add queues tx, replacing a queued transaction with the same sender and
+// nonce or evicting the cheapest transaction when the pool is full. It does
+// not check signatures; callers such as Node and Ledger.AddToPool verify
+// those first.
+func (m *Mempool) Add(tx *Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, replaced, victim, err := m.admitLocked(tx)
+	if err != nil {
+		return err
+	}
+	if victim != nil {
+		m.removeLocked(victim.tx.From, victim.tx.Nonce)
+	}
+	queue := m.senders[tx.From]
+	if queue == nil {
+		queue = make(map[uint64]*mempoolEntry)
+		m.senders[tx.From] = queue
+	}
+	queue[tx.Nonce] = entry
+	if replaced == nil {
+		m.count++
+	}
+	return nil
+}
+
+// Check reports whether Add would accept tx without modifying the pool.
+func (m *Mempool) Check(tx *Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, _, _, err := m.admitLocked(tx)
+	return err
+}
+
+// admitLocked validates tx against the pool and returns the entry to insert,
+// the entry it replaces and the entry to evict to make room, if any.
+func (m *Mempool) admitLocked(tx *Transaction) (entry, replaced, victim *mempoolEntry, err error) {
+	if tx == nil {
+		return nil, nil, nil, ErrNilTransaction
+	}
+	now := m.now()
+	m.expireLocked(now)
+	next := m.state.Nonce(tx.From)
+	if tx.Nonce < next {
+		return nil, nil, nil, fmt.Errorf("%w: account %s expects %d, got %d", ErrNonceTooLow, tx.From, next, tx.Nonce)
+	}
+	if tx.Nonce-next >= uint64(m.maxPerSender) {
+		return nil, nil, nil, fmt.Errorf("%w: account %s may queue nonces %d to %d", ErrMempoolSenderLimit, tx.From, next, next+uint64(m.maxPerSender)-1)
+	}
+	size := tx.Size()
+	fee := tx.FeeCap()
+	if floor := FeeForTransfer(size, m.baseFee, m.feePerByte, 0); fee < floor.Total {
+		return nil, nil, nil, fmt.Errorf("%w: %d bytes require %d, got %d", ErrFeeTooLow, size, floor.Total, fee)
+	}
+	entry = &mempoolEntry{tx: tx, size: size, added: now, seq: m.seq}
+	m.seq++
+
+	if old := m.senders[tx.From][tx.Nonce]; old != nil {
+		if old.tx.ID == tx.ID {
+			return nil, nil, nil, ErrTxAlreadyKnown
+		}
+		oldFee := old.tx.FeeCap()
+		bump := oldFee / 100 * m.minBump
+		bump += oldFee % 100 * m.minBump / 100
+		if fee <= oldFee || fee < oldFee+bump {
+			return nil, nil, nil, fmt.Errorf("%w: fee %d must be at least %d", ErrReplacementUnderpriced, fee, max(oldFee+bump, oldFee+1))
+		}
+		return entry, old, nil, nil
+	}
+	if m.count < m.maxTxs {
+		return entry, nil, nil, nil
+	}
+	victim = m.cheapestTailLocked()
+	if victim == nil || !feeRateLess(victim, entry) {
+		return nil, nil, nil, ErrMempoolFull
+	}
+	return entry, nil, victim, nil
+}
+
+// cheapestTailLocked returns the lowest paying transaction among the last
+// queued transaction of every sender. Evicting only queue tails never opens a
+// nonce gap in front of transactions that remain.
+func (m *Mempool) cheapestTailLocked() *mempoolEntry {
+	var cheapest *mempoolEntry
+	for _, queue := range m.senders {
+		var tail *mempoolEntry
+		for _, e := range queue {
+			if tail == nil || e.tx.Nonce > tail.tx.Nonce {
+				tail = e
+			}
+		}
+		if cheapest == nil || feeRateLess(tail, cheapest) || (!feeRateLess(cheapest, tail) && tail.seq > cheapest.seq) {
+			cheapest = tail
+		}
+	}
+	return cheapest
+}
+
+// feeRateLess reports whether a pays a lower fee per byte than b. The rates
+// are compared by cross multiplication in 128 bits so no precision is lost.
+func feeRateLess(a, b *mempoolEntry) bool {
+	ah, al := bits.Mul64(a.tx.FeeCap(), max(b.size, 1))
+	bh, bl := bits.Mul64(b.tx.FeeCap(), max(a.size, 1))
+	return ah < bh || (ah == bh && al < bl)
+}
+
+func (m *Mempool) removeLocked(from string, nonce uint64) {
+	queue := m.senders[from]
+	if _, ok := queue[nonce]; !ok {
+		return
+	}
+	delete(queue, nonce)
+	m.count--
+	if len(queue) == 0 {
+		delete(m.senders, from)
+	}
+}
+
+func (m *Mempool) expireLocked(now time.Time) int {
+	if m.ttl <= 0 {
+		return 0
+	}
+	removed := 0
+	for from, queue := range m.senders {
+		for nonce, e := range queue {
+			if now.Sub(e.added) >= m.ttl {
+				m.removeLocked(from, nonce)
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// Pending returns up to maxTxs transactions ready for inclusion in a block,
+// highest fee per byte first. A sender's transactions are returned in nonce
+// order starting at its account nonce, and only while its balance covers
+// them. When the pool's state tracks a base fee, as a Ledger with a fee
+// market does, a sender's transactions also wait while the next one cannot
+// pay it. A non-positive maxTxs returns every ready transaction. The returned
+// transactions stay queued until they are removed or pruned.
+func (m *Mempool) Pending(maxTxs int) []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(m.now())
+	var baseFee uint64
+	if s, ok := m.state.(interface{ NextBaseFee() uint64 }); ok {
+		baseFee = s.NextBaseFee()
+	}
+	var h pendingHeap
+	for from, queue := range m.senders {
+		c := &pendingCursor{from: from, queue: queue, nonce: m.state.Nonce(from), budget: m.state.GetBalance(from), baseFee: baseFee}
+		if c.ready() {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	var out []*Transaction
+	for h.Len() > 0 && (maxTxs <= 0 || len(out) < maxTxs) {
+		c := h[0]
+		e := c.queue[c.nonce]
+		out = append(out, e.tx)
+		c.budget -= e.tx.Debit() + e.tx.FeeCap()
+		c.nonce++
+		if c.ready() {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return out
+}
+
+// pendingCursor walks one sender's queue during Pending.
+type pendingCursor struct {
+	from    string
+	queue   map[uint64]*mempoolEntry
+	nonce   uint64
+	budget  uint64
+	baseFee uint64
+}
+
+func (c *pendingCursor) ready() bool {
+	e := c.queue[c.nonce]
+	if e == nil || e.tx.Debit() > c.budget || e.tx.FeeCap() > c.budget-e.tx.Debit() {
+		return false
+	}
+	_, _, err := e.tx.FeeAt(c.baseFee)
+	return err == nil
+}
+
+// pendingHeap orders sender cursors by the fee rate of their next
+// transaction, breaking ties by arrival order.
+type pendingHeap []*pendingCursor
+
+func (h pendingHeap) Len() int { return len(h) }
+func (h pendingHeap) Less(i, j int) bool {
+	a, b := h[i].queue[h[i].nonce], h[j].queue[h[j].nonce]
+	if feeRateLess(b, a) {
+		return true
+	}
+	if feeRateLess(a, b) {
+		return false
+	}
+	return a.seq < b.seq
+}
+func (h pendingHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pendingHeap) Push(x any)   { *h = append(*h, x.(*pendingCursor)) }
+func (h *pendingHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// Remove drops the given transactions from the pool, for example after they
+// were included in a block.
+func (m *Mempool) Remove(txs ...*Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tx := range txs {
+		if tx == nil {
+			continue
+		}
+		if e := m.senders[tx.From][tx.Nonce]; e != nil && e.tx.ID == tx.ID {
+			m.removeLocked(tx.From, tx.Nonce)
+		}
+	}
+}
+
+// Prune drops expired transactions and those whose nonce has already been
+// used on chain. It returns the number of transactions removed.
+func (m *Mempool) Prune() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := m.expireLocked(m.now())
+	for from, queue := range m.senders {
+		next := m.state.Nonce(from)
+		for nonce := range queue {
+			if nonce < next {
+				m.removeLocked(from, nonce)
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// Len returns the number of queued transactions, including those waiting on
+// a nonce gap.
+func (m *Mempool) Len() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.count
+}
+
+// Transactions returns every queued transaction ordered by sender and nonce.
+func (m *Mempool) Transactions() []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*Transaction, 0, m.count)
+	for _, queue := range m.senders {
+		for _, e := range queue {
+			out = append(out, e.tx)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].From != out[j].From {
+			return out[i].From < out[j].From
+		}
+		return out[i].Nonce < out[j].Nonce
+	})
+	return out
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func poolIDs(txs []*Transaction) []string {
+	ids := make([]string, len(txs))
+	for i, tx := range txs {
+		ids[i] = tx.From + ":" + string(rune('0'+tx.Nonce))
+	}
+	return ids
+}
+
+func TestMempoolPendingOrder(t *testing.T) {
+	l := NewLedger()
+	for _, a := range []string{"alice", "carol", "dave"} {
+		l.Credit(a, 10000)
+	}
+	m := NewMempool(l)
+	for _, tx := range []*Transaction{
+		NewTransaction("alice", "x", 1, 100, 0),
+		// carol's second transaction pays most but must follow her first
+		NewTransaction("carol", "x", 1, 5000, 1),
+		NewTransaction("carol", "x", 1, 10, 0),
+		NewTransaction("dave", "x", 1, 1000, 0),
+		// waits for nonce 1
+		NewTransaction("dave", "x", 1, 900, 2),
+	} {
+		if err := m.Add(tx); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	got := poolIDs(m.Pending(0))
+	want := []string{"dave:0", "alice:0", "carol:0", "carol:1"}
+	if len(got) != len(want) {
+		t.Fatalf("pending %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("pending %v want %v", got, want)
+		}
+	}
+	if got := m.Pending(2); len(got) != 2 {
+		t.Fatalf("expected Pending to honour maxTxs, got %d", len(got))
+	}
+	if err := m.Add(NewTransaction("dave", "x", 1, 900, 1)); err != nil {
+		t.Fatalf("fill gap: %v", err)
+	}
+	if got := m.Pending(0); len(got) != 6 || m.Len() != 6 {
+		t.Fatalf("expected gap to be filled, got %v", poolIDs(got))
+	}
+}
+
+func TestMempoolSenderChecks(t *testing.T) {
+	l := NewLedger()
+	l.Credit("alice", 5)
+	m := NewMempool(l, WithMempoolMaxPerSender(2))
+	if err := m.Add(NewTransaction("alice", "x", 1, 1, 2)); !errors.Is(err, ErrMempoolSenderLimit) {
+		t.Fatalf("expected ErrMempoolSenderLimit got %v", err)
+	}
+	tx := NewTransaction("alice", "x", 2, 1, 0)
+	if err := m.Add(tx); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := m.Add(tx); !errors.Is(err, ErrTxAlreadyKnown) {
+		t.Fatalf("expected ErrTxAlreadyKnown got %v", err)
+	}
+	// the second transaction exceeds what remains of alice's balance
+	if err := m.Add(NewTransaction("alice", "x", 2, 1, 1)); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if got := m.Pending(0); len(got) != 1 {
+		t.Fatalf("expected unfunded transaction to be held back, got %v", poolIDs(got))
+	}
+
+	bob := testWallet(t, "bob")
+	l.Credit(bob.Address, 10)
+	m.Add(NewTransaction(bob.Address, "x", 1, 0, 0))
+	if err := l.ApplyTransaction(signedTestTx(t, bob, "x", 1, 0, 0)); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if err := m.Add(NewTransaction(bob.Address, "x", 1, 0, 0)); !errors.Is(err, ErrNonceTooLow) {
+		t.Fatalf("expected ErrNonceTooLow got %v", err)
+	}
+	if n := m.Prune(); n != 1 || m.Len() != 2 {
+		t.Fatalf("expected stale transaction to be pruned, removed %d left %d", n, m.Len())
+	}
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	l := NewLedger()
+	l.Credit("alice", 1000)
+	m := NewMempool(l, WithMempoolMinBump(10))
+	if err := m.Add(NewTransaction("alice", "x", 1, 100, 0)); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := m.Add(NewTransaction("alice", "y", 1, 109, 0)); !errors.Is(err, ErrReplacementUnderpriced) {
+		t.Fatalf("expected ErrReplacementUnderpriced got %v", err)
+	}
+	replacement := NewTransaction("alice", "y", 1, 110, 0)
+	if err := m.Add(replacement); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if got := m.Pending(0); m.Len() != 1 || len(got) != 1 || got[0] != replacement {
+		t.Fatalf("expected replacement to be queued")
+	}
+	// a zero bump still requires a strictly higher fee
+	m = NewMempool(l, WithMempoolMinBump(0))
+	m.Add(NewTransaction("alice", "x", 1, 0, 0))
+	if err := m.Add(NewTransaction("alice", "y", 1, 0, 0)); !errors.Is(err, ErrReplacementUnderpriced) {
+		t.Fatalf("expected ErrReplacementUnderpriced got %v", err)
+	}
+}
+
+func TestMempoolTTL(t *testing.T) {
+	l := NewLedger()
+	l.Credit("alice", 1000)
+	now := time.Unix(1000, 0)
+	m := NewMempool(l, WithMempoolTTL(time.Minute), WithMempoolClock(func() time.Time { return now }))
+	m.Add(NewTransaction("alice", "x", 1, 1, 0))
+	now = now.Add(30 * time.Second)
+	m.Add(NewTransaction("alice", "x", 1, 1, 1))
+	now = now.Add(31 * time.Second)
+	if n := m.Prune(); n != 1 || m.Len() != 1 {
+		t.Fatalf("expected oldest transaction to expire, removed %d", n)
+	}
+	if got := m.Pending(0); len(got) != 0 {
+		t.Fatalf("transaction behind an expired nonce must wait, got %v", poolIDs(got))
+	}
+}
+
+func TestMempoolEviction(t *testing.T) {
+	l := NewLedger()
+	for _, a := range []string{"alice", "carol", "dave"} {
+		l.Credit(a, 10000)
+	}
+	m := NewMempool(l, WithMempoolMaxTxs(3))
+	m.Add(NewTransaction("alice", "x", 1, 500, 0))
+	m.Add(NewTransaction("alice", "x", 1, 10, 1))
+	m.Add(NewTransaction("carol", "x", 1, 50, 0))
+	if err := m.Add(NewTransaction("dave", "x", 1, 5, 0)); !errors.Is(err, ErrMempoolFull) {
+		t.Fatalf("expected ErrMempoolFull got %v", err)
+	}
+	if err := m.Add(NewTransaction("dave", "x", 1, 100, 0)); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	got := poolIDs(m.Transactions())
+	if m.Len() != 3 || got[0] != "alice:0" || got[1] != "carol:0" || got[2] != "dave:0" {
+		t.Fatalf("expected alice's cheap tail to be evicted, got %v", got)
+	}
+}
+
+func TestMempoolFeeFloor(t *testing.T) {
+	l := NewLedger()
+	l.Credit("alice", 100000)
+	m := NewMempool(l, WithMempoolFeeFloor(10, 2))
+	tx := NewTransaction("alice", "x", 1, 10, 0)
+	if err := m.Add(tx); !errors.Is(err, ErrFeeTooLow) {
+		t.Fatalf("expected ErrFeeTooLow got %v", err)
+	}
+	tx = NewTransaction("alice", "x", 1, 10000, 0)
+	fb := m.FeeBreakdown(tx)
+	if fb.Base != 10 || fb.Variable != 2*tx.Size() || fb.Total != 10000 || fb.Priority != 10000-10-2*tx.Size() {
+		t.Fatalf("unexpected breakdown %+v", fb)
+	}
+	if err := m.Add(tx); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+}
@@ -94,7 +94,7 @@ func (n *Network) Start() {
 	n.quit = make(chan struct{})
 	n.running = true
 	n.wg.Add(1)
-	go n.processQueue()
+	go n.processQueue(n.queue, n.quit)
 }
 
 // Stop halts background processing and waits for completion.
@@ -225,19 +225,19 @@ func (n *Network) Publish(topic string, data []byte) {
 // processQueue processes queued transactions and broadcasts them to all peers
 // and relay nodes. Transactions are propagated in a simple fan-out manner to all
 // known nodes.
-func (n *Network) processQueue() {
+func (n *Network) processQueue(queue <-chan queueItem, quit <-chan struct{}) {
 	defer n.wg.Done()
 	for {
 		select {
-		case item := <-n.queue:
+		case item := <-queue:
 			if item.tx != nil {
 				if n.broadcast(item.tx) {
 					n.metrics.delivered.Add(1)
 				} else {
-					n.handleBroadcastFailure(item)
+					n.handleBroadcastFailure(item, quit)
 				}
 			}
-		case <-n.quit:
+		case <-quit:
 			return
 		}
 	}
@@ -282,7 +282,7 @@ func (n *Network) tryEnqueue(item queueItem) error {
 }
 
 // broadcast sends a transaction to all nodes and relay nodes.
-func (n *Network) broadcast(tx *Transaction) {
+func (n *Network) broadcast(tx *Transaction) bool {
 	nodes, relays := n.snapshotTargets()
 	success := true
 	for _, node := range nodes {
@@ -298,9 +298,10 @@ func (n *Network) broadcast(tx *Transaction) {
 	if !success {
 		n.metrics.failed.Add(1)
 	}
+	return success
 }
 
-func (n *Network) handleBroadcastFailure(item queueItem) {
+func (n *Network) handleBroadcastFailure(item queueItem, quit <-chan struct{}) {
 	if item.attempts >= n.retryLimit {
 		return
 	}
@@ -321,7 +322,7 @@ func (n *Network) handleBroadcastFailure(item queueItem) {
 			if err := n.tryEnqueue(retry); err != nil {
 				n.metrics.failed.Add(1)
 			}
-		case <-n.quit:
+		case <-quit:
 			return
 		}
 	}()
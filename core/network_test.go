@@ -23,9 +23,10 @@ func TestNetworkBroadcast(t *testing.T) {
 	relay := NewNode("r1", "addrR", NewLedger())
 
 	// credit balances so validation passes
-	n1.Ledger.Credit("alice", 100)
-	n2.Ledger.Credit("alice", 100)
-	relay.Ledger.Credit("alice", 100)
+	alice := testWallet(t, "alice")
+	n1.Ledger.Credit(alice.Address, 100)
+	n2.Ledger.Credit(alice.Address, 100)
+	relay.Ledger.Credit(alice.Address, 100)
 
 	network.AddNode(n1)
 	network.AddNode(n2)
@@ -41,7 +42,14 @@ func TestNetworkBroadcast(t *testing.T) {
 	}
 	h := sha256.Sum256(bio)
 	sig := ed25519.Sign(priv, h[:])
-	tx := NewTransaction("alice", "bob", 1, 1, 1)
+	// the biometric is attached before signing so the signature covers it
+	tx := NewTransaction(alice.Address, "bob", 1, 1, 0)
+	if err := tx.AttachBiometric("alice", bio, sig, svc); err != nil {
+		t.Fatalf("attach biometric: %v", err)
+	}
+	if _, err := alice.Sign(tx); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
 	if err := network.Broadcast(tx, "alice", bio, sig); err != nil {
 		t.Fatalf("broadcast failed: %v", err)
 	}
@@ -49,7 +57,7 @@ func TestNetworkBroadcast(t *testing.T) {
 	// allow goroutine to process queue
 	time.Sleep(50 * time.Millisecond)
 
-	if len(n1.Mempool) != 1 || len(n2.Mempool) != 1 || len(relay.Mempool) != 1 {
+	if n1.Mempool.Len() != 1 || n2.Mempool.Len() != 1 || relay.Mempool.Len() != 1 {
 		t.Fatalf("expected transaction to be broadcast to all nodes and relay")
 	}
 }
@@ -14,107 +14,300 @@ type Node struct {
 	Ledger         *Ledger
 	Consensus      *SynnergyConsensus
 	VM             *SNVM
-	Mempool        []*Transaction
+	Mempool        *Mempool
 	Blockchain     []*Block
 	Validators     *ValidatorManager
 	MaxTxPerBlock  int
 	mu             sync.Mutex
 	wallets        map[string]*Wallet
 	LiquidityPools *LiquidityPoolRegistry
+	// Finality collects the signed votes finalizing blocks. Votes are
+	// checked against the validator set the ledger records for their
+	// height, so the certificates it forms are ones every ledger accepts.
+	Finality *VoteCollector
+	// Network, when set, receives the finality votes of the node's
+	// validators. See JoinNetwork.
+	Network *Network
+	// evidence holds verified misbehaviour evidence awaiting inclusion in a
+	// block.
+	evidence []Evidence
+	// voted is the highest height the node's validators voted at. They never
+	// vote at a height twice, so a reorg cannot make them equivocate.
+	voted uint64
 }
 
 // NewNode creates a new node instance.
 func NewNode(id, addr string, ledger *Ledger) *Node {
-	return &Node{
+	n := &Node{
 		ID:             id,
 		Addr:           addr,
 		Ledger:         ledger,
 		Consensus:      NewSynnergyConsensus(),
 		VM:             NewSNVM(),
-		Mempool:        []*Transaction{},
+		Mempool:        ledger.Mempool(),
 		Blockchain:     []*Block{},
-		Validators:     NewValidatorManager(MinStake),
+		Validators:     NewValidatorManager(MinStake, WithEpochLength(uint64(ledger.StakingParams().EpochLength))),
 		MaxTxPerBlock:  100,
 		wallets:        make(map[string]*Wallet),
 		LiquidityPools: NewLiquidityPoolRegistry(),
 	}
+	n.Finality = NewVoteCollector(func(height uint64) ValidatorSet {
+		set, _ := ledger.ValidatorSetAt(int(height))
+		return set
+	})
+	n.Consensus.SetValidatorSets(n.validatorSet)
+	n.Consensus.SetRandomness(func(height uint64) ([]byte, bool) { return ledger.RandomnessAt(int(height)) })
+	return n
 }
 
-// AddTransaction validates and adds a transaction to the mempool.
+// AddTransaction validates a transaction and queues it in the mempool.
 func (n *Node) AddTransaction(tx *Transaction) error {
-	if err := n.ValidateTransaction(tx); err != nil {
+	if err := n.checkTransaction(tx); err != nil {
 		return err
 	}
-	n.mu.Lock()
-	n.Mempool = append(n.Mempool, tx)
-	n.mu.Unlock()
-	return nil
+	return n.Mempool.Add(tx)
 }
 
-// ValidateTransaction checks if a transaction is well-formed and the sender has
-// sufficient balance.
+// ValidateTransaction checks that a transaction is signed by its sender, that
+// the sender can afford it and that the mempool would accept it.
 func (n *Node) ValidateTransaction(tx *Transaction) error {
+	if err := n.checkTransaction(tx); err != nil {
+		return err
+	}
+	return n.Mempool.Check(tx)
+}
+
+func (n *Node) checkTransaction(tx *Transaction) error {
+	if tx == nil {
+		return ErrNilTransaction
+	}
+	if err := n.Ledger.CheckSignature(tx); err != nil {
+		return err
+	}
 	// Ensure the fee is considered with the amount using explicit uint64
 	// arithmetic. This guards against future changes to transaction field
 	// types that might otherwise introduce float arithmetic.
-	if n.Ledger.GetBalance(tx.From) < uint64(tx.Amount+tx.Fee) {
+	if n.Ledger.GetBalance(tx.From) < uint64(tx.Debit()+tx.FeeCap()) {
 		return errors.New("insufficient funds")
 	}
 	return nil
 }
 
-// MineBlock packages the current mempool into a sub-block and mines a block.
+// MineBlock packages up to MaxTxPerBlock of the highest paying ready
+// transactions from the mempool into a sub-block and mines a block. The
+// sub-block is proposed by the slot leader elected from the VRF outputs of
+// the eligible validators whose wallets the node holds. Included transactions
+// leave the mempool once the block is added to the ledger.
+//
+// The validator is paid by the ledger while it executes the block, so every
+// node that applies the block credits the same reward and the state root
+// covers it. There is no block reward. Without a fee market the validator
+// receives the validators' and miners' share of each fee and the rest is
+// burned. Under a fee market the block declares the ledger's next base fee
+// and takes only as many transactions as its gas limit allows; the validator
+// receives the tips, and the base fee is burned or split among the fee pools.
 func (n *Node) MineBlock() *Block {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	if len(n.Mempool) == 0 {
+	txs := n.Mempool.Pending(n.MaxTxPerBlock)
+	market, feeMarket := n.Ledger.FeeMarket()
+	if feeMarket {
+		txs = fitBlockGas(txs, market.MaxGas())
+	}
+	if len(txs) == 0 {
 		return nil
 	}
 	prevHash := ""
 	if len(n.Blockchain) > 0 {
 		prevHash = n.Blockchain[len(n.Blockchain)-1].Hash
 	}
-	eligible := n.eligibleStakes()
-	validator := n.Consensus.SelectValidator(prevHash, eligible)
+	head, _ := n.Ledger.Head()
+	height := uint64(head + 1)
+	eligible := map[string]uint64(n.validatorSet(height))
+	validator, proof := n.electLocked(height, eligible)
 	if validator == "" {
 		return nil
 	}
-	wallet := n.wallets[validator]
-	if wallet == nil {
+	sb := NewSlotSubBlock(txs, validator, height, proof)
+	if !n.Consensus.ValidateSubBlock(sb, height) {
 		return nil
 	}
-	sb := NewSubBlock(n.Mempool, validator)
-	if !n.Consensus.ValidateSubBlock(sb) {
+	block := NewBlock([]*SubBlock{sb}, prevHash)
+	block.Evidence = n.blockEvidenceLocked()
+	block.Liveness = n.livenessLocked(height)
+	if feeMarket {
+		block.BaseFee, block.GasUsed = n.Ledger.NextBaseFee(), BlockGas(block)
+	}
+	root, err := n.Ledger.ComputeStateRoot(block)
+	if err != nil {
 		return nil
 	}
-	n.Mempool = nil
-	block := NewBlock([]*SubBlock{sb}, prevHash)
+	block.StateRoot = root
 	n.Consensus.MineBlock(block, 3)
-	votes := make(map[string]bool, len(eligible))
-	for addr := range eligible {
-		votes[addr] = true
+	cert := n.voteLocked(height, block.Hash, eligible)
+	if cert != nil {
+		_ = n.Consensus.FinalizeBlockWithCertificate(block, cert, n.Validators, 1)
 	}
-	if len(votes) == 0 {
-		votes[validator] = true
+	if err := n.Ledger.AddBlock(block); err != nil {
+		return nil
 	}
-	n.Consensus.FinalizeBlock(block, votes, n.Validators, 1)
-	var totalFees uint64
-	for _, tx := range sb.Transactions {
-		totalFees += tx.Fee
-		_ = n.Ledger.ApplyTransaction(tx)
+	if cert != nil {
+		_ = n.Ledger.AddFinalityCertificate(cert)
 	}
+	n.Mempool.Prune()
 	n.Blockchain = append(n.Blockchain, block)
-
-	dist := DistributeFees(totalFees)
-	pool := AdjustForBlockUtilization(dist.ValidatorsMiners, len(sb.Transactions), n.MaxTxPerBlock)
-	weights := map[string]uint64{validator: n.Validators.Stake(validator)}
-	weights[n.ID] = 1
-	shares := ShareProportional(pool, weights)
-	contract := NewFeeDistributionContract(n.Ledger)
-	contract.Distribute(shares)
+	n.advanceLocked(block, height)
+	n.pruneFinalityLocked()
 	return block
 }
 
+// electLocked proves the VRF output for the slot at height with every
+// eligible validator whose wallet the node holds and returns the leader
+// among them with its proof. Validators whose wallets other nodes hold prove
+// their own outputs there; the slot threshold ValidateSubBlock enforces on
+// every node keeps the proposers of each slot to those the stake-weighted
+// draw allows.
+func (n *Node) electLocked(height uint64, eligible map[string]uint64) (string, []byte) {
+	seed, ok := n.Ledger.RandomnessAt(int(height))
+	if !ok {
+		return "", nil
+	}
+	outputs := make(map[string][]byte)
+	proofs := make(map[string][]byte)
+	for addr := range eligible {
+		w := n.wallets[addr]
+		if w == nil {
+			continue
+		}
+		out, proof, err := VRFProve(w.PrivateKey, SlotInput(seed, height))
+		if err != nil {
+			continue
+		}
+		outputs[addr], proofs[addr] = out, proof
+	}
+	leader := n.Consensus.SelectValidatorVRF(outputs, eligible)
+	return leader, proofs[leader]
+}
+
+// livenessLocked returns the votes the finality collector received for the
+// recent canonical blocks whose signers the chain has not recorded yet, for
+// the block at height to record. Votes by validators the chain does not
+// record for their height are left out, as the ledger would reject them.
+func (n *Node) livenessLocked(height uint64) []Vote {
+	grace := uint64(n.Ledger.EvidenceParams().LivenessGrace)
+	var out []Vote
+	for h := max(height, grace+2) - grace - 1; h < height; h++ {
+		blk, ok := n.Ledger.GetBlock(int(h))
+		if !ok {
+			continue
+		}
+		set, _ := n.Ledger.ValidatorSetAt(int(h))
+		recorded := make(map[string]bool)
+		for _, v := range n.Finality.Votes(h) {
+			if v.BlockHash != blk.Hash || set[v.Validator] == 0 || recorded[v.Validator] || n.Ledger.HasLiveness(v.Validator, h) {
+				continue
+			}
+			recorded[v.Validator] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// voteLocked signs a round zero vote for the block at height with every
+// eligible validator whose wallet the node holds, gossips the votes when the
+// node has joined a network and returns the certificate once they reach a
+// quorum. Heights the node already voted at are skipped.
+func (n *Node) voteLocked(height uint64, hash string, eligible map[string]uint64) *FinalityCertificate {
+	if height <= n.voted {
+		return nil
+	}
+	n.voted = height
+	var cert *FinalityCertificate
+	for addr := range eligible {
+		w := n.wallets[addr]
+		if w == nil {
+			continue
+		}
+		v, err := SignVote(w, height, hash, 0)
+		if err != nil {
+			continue
+		}
+		if n.Network != nil {
+			_ = PublishVote(n.Network, v)
+		}
+		if c, err := n.Finality.Add(v); err == nil && c != nil && c.BlockHash == hash {
+			cert = c
+		}
+	}
+	return cert
+}
+
+// JoinNetwork gossips the node's finality votes on net and collects the votes
+// of other validators published there until ctx is done. Certificates for
+// blocks the ledger already holds are stored with them.
+func (n *Node) JoinNetwork(ctx context.Context, net *Network) {
+	n.mu.Lock()
+	n.Network = net
+	n.mu.Unlock()
+	n.Finality.OnCertificate(func(cert *FinalityCertificate) {
+		_ = n.Ledger.AddFinalityCertificate(cert)
+	})
+	n.Finality.Listen(ctx, net)
+}
+
+// fitBlockGas returns the longest prefix of txs whose gas fits in a block.
+// Keeping a prefix preserves the nonce order of every sender.
+func fitBlockGas(txs []*Transaction, maxGas uint64) []*Transaction {
+	var gas uint64
+	for i, tx := range txs {
+		if gas += tx.Gas(); gas > maxGas {
+			return txs[:i]
+		}
+	}
+	return txs
+}
+
+// ImportBlock hands a block received from a peer to the ledger, which uses
+// the node's consensus fork choice to decide whether a competing branch
+// should replace the canonical chain. The node's copy of the chain is updated
+// to match the ledger, and the node's validators vote for the blocks that
+// became canonical. A non-nil event reports a reorg.
+func (n *Node) ImportBlock(b *Block) (*ReorgEvent, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	before, _ := n.Ledger.Head()
+	// Blockchain mirrors the ledger's most recent blocks
+	offset := before - len(n.Blockchain)
+	var fc ForkChoice
+	if n.Consensus != nil {
+		fc = n.Consensus
+	}
+	ev, err := n.Ledger.ImportBlock(b, fc)
+	if err != nil {
+		return nil, err
+	}
+	after, _ := n.Ledger.Head()
+	keep := before
+	if ev != nil {
+		keep = ev.AncestorHeight
+	} else if after == before {
+		return nil, nil
+	}
+	n.Blockchain = n.Blockchain[:max(0, min(len(n.Blockchain), keep-offset))]
+	for h := keep + 1; h <= after; h++ {
+		if blk, ok := n.Ledger.GetBlock(h); ok {
+			n.Blockchain = append(n.Blockchain, blk)
+			n.advanceLocked(blk, uint64(h))
+			if cert := n.voteLocked(uint64(h), blk.Hash, n.validatorSet(uint64(h))); cert != nil {
+				_ = n.Ledger.AddFinalityCertificate(cert)
+			}
+		}
+	}
+	n.pruneFinalityLocked()
+	return ev, nil
+}
+
 const MinStake uint64 = 1
 
 // SetStake assigns stake to an address for validator selection while enforcing a minimum.
@@ -145,31 +338,127 @@ func (n *Node) eligibleStakes() map[string]uint64 {
 	return n.Validators.Eligible()
 }
 
-// ReportDoubleSign slashes a validator for double signing.
-func (n *Node) ReportDoubleSign(addr string) {
-	n.Validators.SlashWithEvidence(context.Background(), addr, "double-sign")
+func (n *Node) validatorSet(height uint64) ValidatorSet {
+	return n.Validators.SetAt(height)
 }
 
-// ReportDowntime slashes a validator for downtime.
-func (n *Node) ReportDowntime(addr string) {
-	n.Validators.SlashWithEvidence(context.Background(), addr, "downtime")
+// advanceLocked moves the validator set past b, the block at height: stake
+// bonded on the ledger is queued for the next epoch, an epoch ending with b
+// activates the queued changes, and the validators b carries evidence against
+// are slashed from the next block on.
+func (n *Node) advanceLocked(b *Block, height uint64) {
+	ctx := context.Background()
+	n.Validators.SyncBonded(ctx, n.Ledger.ValidatorPowers())
+	n.Validators.AdvanceTo(ctx, height)
+	n.applyEvidenceLocked(b)
 }
 
-// Rehabilitate removes slashed status from a validator by re-adding the existing stake.
-func (n *Node) Rehabilitate(addr string) {
-	stake := n.Validators.Stake(addr)
-	if stake > 0 {
-		_ = n.Validators.Add(context.Background(), addr, stake)
+// pruneFinalityLocked queues the equivocations the finality collector caught
+// and makes it forget the votes for finalized blocks that no later block can
+// record any more.
+func (n *Node) pruneFinalityLocked() {
+	below := n.Ledger.FinalizedHeight() - n.Ledger.EvidenceParams().LivenessGrace
+	if below <= 1 {
+		return
+	}
+	for _, eq := range n.Finality.Evidence() {
+		_ = n.submitEvidenceLocked(NewVoteEvidence(eq))
+	}
+	n.Finality.Prune(uint64(below))
+}
+
+// SubmitEvidence verifies misbehaviour evidence against the validator set the
+// chain records and queues it for inclusion in the next mined block. The offender is slashed
+// once a block carrying the evidence is added.
+func (n *Node) SubmitEvidence(ev *Evidence) error {
+	if ev == nil {
+		return fmt.Errorf("%w: evidence required", ErrInvalidEvidence)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.submitEvidenceLocked(ev)
+}
+
+func (n *Node) submitEvidenceLocked(ev *Evidence) error {
+	if err := n.Ledger.CheckEvidence(ev); err != nil {
+		return err
+	}
+	for _, pending := range n.evidence {
+		if pending.Kind == ev.Kind && pending.Validator == ev.Validator && (ev.Kind == EvidenceDowntime || pending.Height == ev.Height) {
+			return fmt.Errorf("%w: %s by %s already pending", ErrDuplicateEvidence, ev.Kind, ev.Validator)
+		}
+	}
+	n.evidence = append(n.evidence, *ev)
+	return nil
+}
+
+// ReportDoubleSign queues evidence that a validator double-signed.
+func (n *Node) ReportDoubleSign(ev *Evidence) error {
+	if ev == nil || ev.Kind != EvidenceDoubleSign {
+		return fmt.Errorf("%w: double-sign evidence required", ErrInvalidEvidence)
+	}
+	return n.SubmitEvidence(ev)
+}
+
+// ReportDowntime queues evidence that a validator missed too many blocks.
+func (n *Node) ReportDowntime(ev *Evidence) error {
+	if ev == nil || ev.Kind != EvidenceDowntime {
+		return fmt.Errorf("%w: downtime evidence required", ErrInvalidEvidence)
+	}
+	return n.SubmitEvidence(ev)
+}
+
+// PendingEvidence returns the evidence awaiting inclusion in a block.
+func (n *Node) PendingEvidence() []Evidence {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Evidence(nil), n.evidence...)
+}
+
+// blockEvidenceLocked queues the equivocations the finality collector caught
+// and returns the pending evidence that is still includable, dropping the
+// rest.
+func (n *Node) blockEvidenceLocked() []Evidence {
+	for _, eq := range n.Finality.Evidence() {
+		_ = n.submitEvidenceLocked(NewVoteEvidence(eq))
+	}
+	kept := n.evidence[:0]
+	for i := range n.evidence {
+		if n.Ledger.CheckEvidence(&n.evidence[i]) == nil {
+			kept = append(kept, n.evidence[i])
+		}
+	}
+	n.evidence = kept
+	return append([]Evidence(nil), kept...)
+}
+
+// applyEvidenceLocked slashes the validators b carries evidence against and
+// drops that evidence from the pending queue.
+func (n *Node) applyEvidenceLocked(b *Block) {
+	for i := range b.Evidence {
+		ev := &b.Evidence[i]
+		n.Validators.ApplyEvidence(context.Background(), ev)
+		kept := n.evidence[:0]
+		for _, pending := range n.evidence {
+			if pending.ID() != ev.ID() {
+				kept = append(kept, pending)
+			}
+		}
+		n.evidence = kept
 	}
 }
 
+// Rehabilitate removes slashed status from a validator, keeping the stake
+// slashing left it.
+func (n *Node) Rehabilitate(addr string) {
+	n.Validators.Rehabilitate(context.Background(), addr)
+}
+
 // PendingTransactionCount returns the number of queued transactions awaiting
 // inclusion in a block. It is safe for concurrent use by background services.
 func (n *Node) PendingTransactionCount() int {
 	if n == nil {
 		return 0
 	}
-	n.mu.Lock()
-	defer n.mu.Unlock()
-	return len(n.Mempool)
+	return n.Mempool.Len()
 }
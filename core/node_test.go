@@ -1,13 +1,16 @@
 package core
 
 import (
+	"fmt"
+	"path/filepath"
 	"sync"
 	"testing"
 )
 
 func TestMineBlockFeeDistribution(t *testing.T) {
+	alice := testWallet(t, "alice")
 	ledger := NewLedger()
-	ledger.Credit("alice", 200)
+	ledger.Credit(alice.Address, 200)
 	node := NewNode("miner", "addr", ledger)
 	validatorWallet, err := NewWallet()
 	if err != nil {
@@ -18,7 +21,7 @@ func TestMineBlockFeeDistribution(t *testing.T) {
 	}
 	validator := validatorWallet.Address
 	node.SetStake(validator, 2)
-	tx := NewTransaction("alice", "bob", 10, 100, 0)
+	tx := signedTestTx(t, alice, "bob", 10, 100, 0)
 	if err := node.AddTransaction(tx); err != nil {
 		t.Fatalf("add tx: %v", err)
 	}
@@ -29,30 +32,128 @@ func TestMineBlockFeeDistribution(t *testing.T) {
 	if bal := ledger.GetBalance("bob"); bal != 10 {
 		t.Fatalf("recipient balance %d", bal)
 	}
-	dist := DistributeFees(100)
-	expected := ShareProportional(AdjustForBlockUtilization(dist.ValidatorsMiners, 1, node.MaxTxPerBlock), map[string]uint64{validator: 3, "miner": 1})
-	if ledger.GetBalance(validator) != expected[validator] || ledger.GetBalance("miner") != expected["miner"] {
+	// the ledger pays the validator its share while executing the block, so
+	// a peer applying the block credits it too
+	share := DistributeFees(100).ValidatorsMiners
+	if ledger.GetBalance(validator) != share || ledger.GetBalance("miner") != 0 {
 		t.Fatalf("unexpected shares: got validator %d miner %d", ledger.GetBalance(validator), ledger.GetBalance("miner"))
 	}
+	peer := NewLedger()
+	peer.Credit(alice.Address, 200)
+	if err := peer.AddBlock(block); err != nil {
+		t.Fatalf("peer: %v", err)
+	}
+	if peer.GetBalance(validator) != share || peer.StateRoot() != ledger.StateRoot() {
+		t.Fatalf("peer did not credit the fee reward")
+	}
+}
+
+func TestStakedNodeReplaysItsLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	ledger, err := OpenLedger(path, oneBlockEpochs)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	alice := testWallet(t, "alice")
+	ledger.Credit(alice.Address, 200)
+	node := NewNode("miner", "addr", ledger)
+	// bonded holds stake on chain; local only has the stake SetStake gives
+	// it on this node, which the chain does not know about
+	bonded, local := registerTestValidator(t), registerTestValidator(t)
+	for _, w := range []*Wallet{bonded, local} {
+		if err := node.RegisterValidatorWallet(w); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+		if err := node.SetStake(w.Address, 10); err != nil {
+			t.Fatalf("stake: %v", err)
+		}
+	}
+	ledger.Credit(bonded.Address, 10)
+	mineBonds(t, node, 10, bonded)
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		if err := node.AddTransaction(signedTestTx(t, alice, "bob", 1, 0, nonce)); err != nil {
+			t.Fatalf("add tx: %v", err)
+		}
+		if node.MineBlock() == nil {
+			t.Fatalf("block not mined")
+		}
+	}
+	if ledger.FinalizedHeight() != 4 || !ledger.HasLiveness(bonded.Address, 3) || ledger.HasLiveness(local.Address, 3) {
+		t.Fatalf("finality and liveness not recorded for the bonded validator alone")
+	}
+
+	reopened, err := OpenLedger(path, oneBlockEpochs)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	height, head := ledger.Head()
+	if h, hash := reopened.Head(); h != height || hash != head || reopened.StateRoot() != ledger.StateRoot() {
+		t.Fatalf("replayed ledger at %d %s root %s, want %d %s root %s", h, hash, reopened.StateRoot(), height, head, ledger.StateRoot())
+	}
 }
 
 // TestNodeConcurrentAddTransaction ensures AddTransaction is safe for concurrent
 // use and properly records all transactions.
 func TestNodeConcurrentAddTransaction(t *testing.T) {
 	ledger := NewLedger()
-	ledger.Credit("alice", 1000)
 	node := NewNode("n1", "addr", ledger)
+	txs := make([]*Transaction, 10)
+	for i := range txs {
+		w := testWallet(t, fmt.Sprintf("sender-%d", i))
+		ledger.Credit(w.Address, 1000)
+		txs[i] = signedTestTx(t, w, "b", 1, 1, 0)
+	}
 
 	var wg sync.WaitGroup
-	for i := 0; i < 10; i++ {
+	for _, tx := range txs {
 		wg.Add(1)
-		go func() {
+		go func(tx *Transaction) {
 			defer wg.Done()
-			_ = node.AddTransaction(NewTransaction("alice", "b", 1, 1, 0))
-		}()
+			_ = node.AddTransaction(tx)
+		}(tx)
 	}
 	wg.Wait()
-	if len(node.Mempool) != 10 {
-		t.Fatalf("expected 10 transactions, got %d", len(node.Mempool))
+	if node.Mempool.Len() != 10 {
+		t.Fatalf("expected 10 transactions, got %d", node.Mempool.Len())
+	}
+}
+
+func TestMineBlockTakesPendingTransactions(t *testing.T) {
+	ledger := NewLedger()
+	node := NewNode("miner", "addr", ledger)
+	node.MaxTxPerBlock = 2
+	validatorWallet, err := NewWallet()
+	if err != nil {
+		t.Fatalf("wallet: %v", err)
+	}
+	if err := node.RegisterValidatorWallet(validatorWallet); err != nil {
+		t.Fatalf("register validator: %v", err)
+	}
+	node.SetStake(validatorWallet.Address, 2)
+	var cheapest *Transaction
+	for i, fee := range []uint64{30, 10, 20} {
+		w := testWallet(t, fmt.Sprintf("sender-%d", i))
+		ledger.Credit(w.Address, 100)
+		tx := signedTestTx(t, w, "bob", 1, fee, 0)
+		if err := node.AddTransaction(tx); err != nil {
+			t.Fatalf("add tx: %v", err)
+		}
+		if fee == 10 {
+			cheapest = tx
+		}
+	}
+	block := node.MineBlock()
+	if block == nil {
+		t.Fatalf("block not mined")
+	}
+	if n := len(block.SubBlocks[0].Transactions); n != 2 {
+		t.Fatalf("expected 2 transactions in block, got %d", n)
+	}
+	left := node.Mempool.Transactions()
+	if len(left) != 1 || left[0] != cheapest {
+		t.Fatalf("expected only the cheapest transaction to remain queued")
+	}
+	if pool := ledger.Pool(); len(pool) != 1 || pool[0] != cheapest {
+		t.Fatalf("the node must mine from the ledger's pool")
 	}
 }
@@ -394,6 +394,11 @@ var catalogue = []struct {
 	{"DeployDAOGovernanceTemplate", 0x08000C},
 	{"DeployNFTMintingTemplate", 0x08000D},
 	{"DeployAIModelMarketTemplate", 0x08000E},
+	{"ProposeContractUpgrade", 0x08000F},
+	{"ActivateContractUpgrade", 0x080010},
+	{"CancelContractUpgrade", 0x080011},
+	{"SetContractUpgradePolicy", 0x080012},
+	{"ContractUpgradeHistory", 0x080013},
 	{"RegisterBridge", 0x090001},
 	{"AssertRelayer", 0x090002},
 	{"Iterator", 0x090003},
@@ -1636,6 +1641,39 @@ var catalogue = []struct {
         {"EnterpriseSpecialBroadcast", 0x210003},
         {"EnterpriseSpecialSnapshot", 0x210004},
         {"EnterpriseSpecialLedger", 0x210005},
+	// WebAssembly instruction classes (0x22)
+	{"WasmControl", 0x220001},
+	{"WasmCall", 0x220002},
+	{"WasmCallIndirect", 0x220003},
+	{"WasmVariable", 0x220004},
+	{"WasmConst", 0x220005},
+	{"WasmLoad", 0x220006},
+	{"WasmStore", 0x220007},
+	{"WasmMemorySize", 0x220008},
+	{"WasmMemoryGrow", 0x220009},
+	{"WasmMemoryPage", 0x22000A},
+	{"WasmIntArith", 0x22000B},
+	{"WasmIntMul", 0x22000C},
+	{"WasmIntDiv", 0x22000D},
+	{"WasmFloatArith", 0x22000E},
+	{"WasmFloatDiv", 0x22000F},
+	{"WasmConvert", 0x220010},
+	// Synnergy host ABI (0x23)
+	{"HostCaller", 0x230001},
+	{"HostOrigin", 0x230002},
+	{"HostAddress", 0x230003},
+	{"HostValue", 0x230004},
+	{"HostBlockHeight", 0x230005},
+	{"HostBlockTime", 0x230006},
+	{"HostBalance", 0x230007},
+	{"HostTransfer", 0x230008},
+	{"HostStorageGet", 0x230009},
+	{"HostStorageSet", 0x23000A},
+	{"HostEmitLog", 0x23000B},
+	{"HostCall", 0x23000C},
+	{"HostReturnData", 0x23000D},
+	{"HostRevert", 0x23000E},
+	{"HostDataWord", 0x23000F},
 }
 
 // init normalises the opcode catalogue, assigning sequential identifiers per
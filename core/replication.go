@@ -82,7 +82,7 @@ func (r *Replicator) Start() {
 	r.quit = make(chan struct{})
 	r.running = true
 	r.wg.Add(1)
-	go r.run()
+	go r.run(r.queue, r.quit)
 	r.mu.Unlock()
 }
 
@@ -200,19 +200,19 @@ func (r *Replicator) tryEnqueue(req replicationRequest) error {
 	}
 }
 
-func (r *Replicator) run() {
+func (r *Replicator) run(queue <-chan replicationRequest, quit <-chan struct{}) {
 	defer r.wg.Done()
 	for {
 		select {
-		case req := <-r.queue:
-			r.handleRequest(req)
-		case <-r.quit:
+		case req := <-queue:
+			r.handleRequest(req, quit)
+		case <-quit:
 			return
 		}
 	}
 }
 
-func (r *Replicator) handleRequest(req replicationRequest) {
+func (r *Replicator) handleRequest(req replicationRequest, quit <-chan struct{}) {
 	now := time.Now()
 	r.mu.Lock()
 	rec := r.ensureRecordLocked(req.hash)
@@ -226,7 +226,7 @@ func (r *Replicator) handleRequest(req replicationRequest) {
 	if req.attempt >= r.retryLimit {
 		return
 	}
-	r.scheduleRetry(replicationRequest{hash: req.hash, attempt: req.attempt + 1})
+	r.scheduleRetry(replicationRequest{hash: req.hash, attempt: req.attempt + 1}, quit)
 }
 
 func (r *Replicator) ensureRecordLocked(hash string) *ReplicationRecord {
@@ -267,7 +267,7 @@ func (r *Replicator) pendingPeersLocked(rec *ReplicationRecord) []nodes.Address
 	return pending
 }
 
-func (r *Replicator) scheduleRetry(req replicationRequest) {
+func (r *Replicator) scheduleRetry(req replicationRequest, quit <-chan struct{}) {
 	r.metrics.retries.Add(1)
 	delay := r.retryDelay
 	if delay <= 0 {
@@ -284,7 +284,7 @@ func (r *Replicator) scheduleRetry(req replicationRequest) {
 			if err := r.tryEnqueue(req); err != nil {
 				r.metrics.dropped.Add(1)
 			}
-		case <-r.quit:
+		case <-quit:
 			return
 		}
 	}()
@@ -9,7 +9,7 @@ import (
 
 func TestReplicator(t *testing.T) {
 	l := NewLedger()
-	b := &Block{Hash: "b1"}
+	b := sealTestBlock(t, l, &Block{Hash: "b1"})
 	if err := l.AddBlock(b); err != nil {
 		t.Fatalf("add block: %v", err)
 	}
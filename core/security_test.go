@@ -14,39 +14,53 @@ func TestSetStakeEnforcesMinimum(t *testing.T) {
 }
 
 func TestSlashingAndRehabilitation(t *testing.T) {
-	ledger := NewLedger()
-	node := NewNode("n1", "addr", ledger)
-	_ = node.SetStake("v1", MinStake*2)
-	node.ReportDoubleSign("v1")
-	if _, ok := node.Validators.Eligible()["v1"]; ok {
+	c := newEvidenceChain(t, oneBlockEpochs)
+	node := c.node
+	v1, _ := NewWallet()
+	c.bond(t, map[*Wallet]uint64{c.proposer: 1_000_000, v1: MinStake * 2})
+	c.mine(t)
+	if err := node.ReportDoubleSign(equivocate(t, v1, 2)); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	c.mine(t)
+	if _, ok := node.Validators.Eligible()[v1.Address]; ok {
 		t.Fatalf("validator should be slashed")
 	}
-	if node.Validators.Stake("v1") >= MinStake*2 {
+	if node.Validators.Stake(v1.Address) >= MinStake*2 {
 		t.Fatalf("stake not reduced")
 	}
-	node.Rehabilitate("v1")
-	if _, ok := node.Validators.Eligible()["v1"]; !ok {
+	node.Rehabilitate(v1.Address)
+	if _, ok := node.Validators.Eligible()[v1.Address]; !ok {
 		t.Fatalf("validator should be rehabilitated")
 	}
 }
 
 func TestEligibleStakesExcludesSlashed(t *testing.T) {
-	ledger := NewLedger()
-	node := NewNode("n1", "addr", ledger)
-	_ = node.SetStake("v1", MinStake)
+	c := newEvidenceChain(t, oneBlockEpochs)
+	node := c.node
+	v1, _ := NewWallet()
+	c.bond(t, map[*Wallet]uint64{c.proposer: 1_000_000, v1: MinStake})
 	_ = node.SetStake("v2", MinStake)
-	node.ReportDowntime("v1")
+	c.mine(t)
+	if err := node.ReportDoubleSign(equivocate(t, v1, 2)); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	c.mine(t)
 	elig := node.eligibleStakes()
-	if _, ok := elig["v1"]; ok {
+	if _, ok := elig[v1.Address]; ok {
 		t.Fatalf("slashed validator should not be eligible")
 	}
 	if _, ok := elig["v2"]; !ok {
 		t.Fatalf("validator v2 should be eligible")
 	}
-	node.Rehabilitate("v1")
-	_ = node.SetStake("v1", MinStake)
+	node.Rehabilitate(v1.Address)
+	_ = node.SetStake(v1.Address, MinStake)
+	if _, ok := node.eligibleStakes()[v1.Address]; ok {
+		t.Fatalf("restaked validator eligible before the epoch ends")
+	}
+	c.mine(t)
 	elig = node.eligibleStakes()
-	if _, ok := elig["v1"]; !ok {
+	if _, ok := elig[v1.Address]; !ok {
 		t.Fatalf("validator v1 should be eligible after rehab")
 	}
 }
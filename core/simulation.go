@@ -0,0 +1,253 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultGasEstimateMargin is the percentage EstimateGas adds to the gas a
+// call needs, so that state changing between estimation and execution does
+// not leave it short.
+const DefaultGasEstimateMargin = 10
+
+// Simulation is the outcome of executing a transaction or contract call
+// against a copy-on-write view of the current state. Nothing it reports has
+// been committed. Error is set when execution failed.
+type Simulation struct {
+	TxID        string        `json:"tx_id,omitempty"`
+	Contract    string        `json:"contract,omitempty"`
+	Method      string        `json:"method,omitempty"`
+	Caller      string        `json:"caller,omitempty"`
+	GasLimit    uint64        `json:"gas_limit,omitempty"`
+	GasUsed     uint64        `json:"gas_used"`
+	GasEstimate uint64        `json:"gas_estimate,omitempty"`
+	Fee         uint64        `json:"fee,omitempty"`
+	ReturnData  []byte        `json:"return_data,omitempty"`
+	Logs        []ContractLog `json:"logs,omitempty"`
+	Diff        StateDiff     `json:"state_diff"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// StateDiff lists the state a simulated execution would change, ordered by
+// address and storage slot.
+type StateDiff struct {
+	Balances []BalanceChange `json:"balances,omitempty"`
+	Nonces   []NonceChange   `json:"nonces,omitempty"`
+	Storage  []StorageChange `json:"storage,omitempty"`
+}
+
+// BalanceChange is the change of an account balance.
+type BalanceChange struct {
+	Address string `json:"address"`
+	Before  uint64 `json:"before"`
+	After   uint64 `json:"after"`
+}
+
+// NonceChange is the change of an account nonce.
+type NonceChange struct {
+	Address string `json:"address"`
+	Before  uint64 `json:"before"`
+	After   uint64 `json:"after"`
+}
+
+// StorageChange is the change of a contract storage slot. An empty value is
+// an absent slot.
+type StorageChange struct {
+	Contract string `json:"contract"`
+	Key      []byte `json:"key"`
+	Before   []byte `json:"before,omitempty"`
+	After    []byte `json:"after,omitempty"`
+}
+
+// WithGasEstimateMargin sets the percentage added to gas estimates.
+func WithGasEstimateMargin(percent uint64) ContractRegistryOption {
+	return func(r *ContractRegistry) {
+		r.gasMargin = percent
+	}
+}
+
+// Simulate applies tx to a copy-on-write view of the ledger and reports the
+// balances and nonces it would change without committing anything. An
+// unsigned transaction is checked like a signed one except for its
+// signature, so wallets can simulate a transaction before signing it. The fee
+// is priced at the next block's base fee. A transaction the ledger would
+// reject is reported in the simulation's Error.
+func (l *Ledger) Simulate(tx *Transaction) (*Simulation, error) {
+	if tx == nil {
+		return nil, ErrNilTransaction
+	}
+	if tx.From == "" || tx.To == "" {
+		return nil, ErrEmptyAddress
+	}
+	sim := &Simulation{TxID: tx.ID, Caller: tx.From}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.discardLocked()
+	if base, tip, err := tx.FeeAt(l.txBaseFeeLocked()); err == nil {
+		sim.Fee = base + tip
+	}
+	var err error
+	if len(tx.Signature) > 0 {
+		err = l.verifySignatureLocked(tx)
+	}
+	if err == nil {
+		err = l.applyTransferLocked(tx)
+	}
+	if err != nil {
+		sim.Error = err.Error()
+		return sim, nil
+	}
+	for _, op := range l.batch.ops {
+		balance := strings.HasPrefix(op.key, keyBalancePrefix)
+		if !balance && !strings.HasPrefix(op.key, keyNoncePrefix) {
+			continue
+		}
+		before, err := l.loadUintLocked(op.key)
+		if err != nil {
+			return nil, err
+		}
+		if balance {
+			addr := strings.TrimPrefix(op.key, keyBalancePrefix)
+			sim.Diff.Balances = append(sim.Diff.Balances, BalanceChange{Address: addr, Before: before, After: decodeUint(op.value)})
+		} else {
+			addr := strings.TrimPrefix(op.key, keyNoncePrefix)
+			sim.Diff.Nonces = append(sim.Diff.Nonces, NonceChange{Address: addr, Before: before, After: decodeUint(op.value)})
+		}
+	}
+	sort.Slice(sim.Diff.Balances, func(i, j int) bool { return sim.Diff.Balances[i].Address < sim.Diff.Balances[j].Address })
+	return sim, nil
+}
+
+// SimulateCall executes a contract method like Call against a copy-on-write
+// view of the current state and returns its outcome without committing it,
+// charging gas or recording a receipt. The state diff includes the gas the
+// call would be charged. Execution failures are reported in the simulation's
+// Error.
+func (r *ContractRegistry) SimulateCall(addr, caller, method string, args []byte, value, gasLimit uint64) (*Simulation, error) {
+	c, payer, limit, err := r.callTarget(addr, caller, method, args, value, gasLimit)
+	if err != nil {
+		return nil, err
+	}
+	return r.simulate(c, payer, method, args, value, limit)
+}
+
+// EstimateGas simulates a call of method by caller and reports the smallest
+// gas limit it succeeds with, plus the registry's safety margin, as the
+// simulation's GasEstimate. The estimate never exceeds the contract's gas
+// limit or what the caller can pay. When the call fails even with the largest
+// limit the simulation reports the failure and carries no estimate.
+func (r *ContractRegistry) EstimateGas(caller, addr, method string, args []byte) (*Simulation, error) {
+	return r.EstimateGasWithValue(caller, addr, method, args, 0)
+}
+
+// EstimateGasWithValue estimates gas like EstimateGas for a call transferring
+// value to the contract.
+func (r *ContractRegistry) EstimateGasWithValue(caller, addr, method string, args []byte, value uint64) (*Simulation, error) {
+	c, payer, limit, err := r.callTarget(addr, caller, method, args, value, 0)
+	if err != nil {
+		return nil, err
+	}
+	if r.ledger != nil {
+		bal := r.state.GetBalance(payer)
+		limit = min(limit, bal-min(bal, value))
+		if limit == 0 {
+			return nil, fmt.Errorf("%w: %s cannot pay for gas", ErrGasChargeFailed, payer)
+		}
+	}
+	sim, err := r.simulate(c, payer, method, args, value, limit)
+	if err != nil || sim.Error != "" {
+		return sim, err
+	}
+	ok := func(gas uint64) bool {
+		s, err := r.simulate(c, payer, method, args, value, gas)
+		return err == nil && s.Error == ""
+	}
+	// Gas use need not be the same under every limit, for instance when a
+	// nested call is given all the gas left, so the limit is searched for.
+	need := sim.GasUsed
+	if need < limit && !ok(need) {
+		lo, hi := need+1, limit
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			if ok(mid) {
+				hi = mid
+			} else {
+				lo = mid + 1
+			}
+		}
+		need = hi
+	}
+	sim.GasEstimate = min(need+(need*r.gasMargin+99)/100, limit)
+	return sim, nil
+}
+
+// simulate runs a call in a journal that is never committed.
+func (r *ContractRegistry) simulate(c *Contract, payer, method string, args []byte, value, limit uint64) (*Simulation, error) {
+	host := registryHost{r: r, j: newContractJournal(r.state)}
+	if r.ledger != nil {
+		if err := host.j.reserveGas(payer, r.feeCollector, limit); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrGasChargeFailed, err)
+		}
+	}
+	if err := host.Transfer(payer, c.Address, value); err != nil {
+		return nil, err
+	}
+	call := r.newCall(c.Address, payer, value, host)
+	out, used, err := r.execute(context.Background(), call, c, method, args, limit)
+	sim := &Simulation{
+		Contract:   c.Address,
+		Method:     method,
+		Caller:     payer,
+		GasLimit:   limit,
+		GasUsed:    used,
+		ReturnData: out,
+	}
+	if err != nil {
+		sim.Error = err.Error()
+		var revert *RevertError
+		if errors.As(err, &revert) {
+			sim.ReturnData = revert.Data
+		}
+		return sim, nil
+	}
+	host.j.settleGas(used)
+	sim.Logs = call.Logs
+	sim.Diff = contractDiff(r.state, host.j.changes())
+	return sim, nil
+}
+
+// contractDiff describes the effect of committing c to state.
+func contractDiff(state contractState, c *ContractStateChanges) StateDiff {
+	var d StateDiff
+	before := make(map[string]uint64)
+	after := make(map[string]uint64)
+	balance := func(addr string) uint64 {
+		if v, ok := after[addr]; ok {
+			return v
+		}
+		v := state.GetBalance(addr)
+		before[addr], after[addr] = v, v
+		return v
+	}
+	for _, t := range c.Transfers {
+		after[t.From] = balance(t.From) - t.Amount
+		after[t.To] = balance(t.To) + t.Amount
+	}
+	for addr, v := range after {
+		if v != before[addr] {
+			d.Balances = append(d.Balances, BalanceChange{Address: addr, Before: before[addr], After: v})
+		}
+	}
+	sort.Slice(d.Balances, func(i, j int) bool { return d.Balances[i].Address < d.Balances[j].Address })
+	for _, w := range c.Storage {
+		old, _ := state.ContractStorage(w.Contract, w.Key)
+		if !bytes.Equal(old, w.Value) {
+			d.Storage = append(d.Storage, StorageChange{Contract: w.Contract, Key: w.Key, Before: old, After: w.Value})
+		}
+	}
+	return d
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestContractSimulateAndEstimateGas(t *testing.T) {
+	l := NewLedger()
+	reg, vault, proxy := deployVaults(t, l)
+	balance, receipts := l.GetBalance("alice"), len(l.Receipts(1))
+
+	sim, err := reg.SimulateCall(vault, "alice", "deposit", nil, 50, 0)
+	if err != nil || sim.Error != "" || !bytes.Equal(sim.ReturnData, le64(50)) || len(sim.Logs) != 1 {
+		t.Fatalf("simulate deposit: %+v %v", sim, err)
+	}
+	if len(sim.Diff.Storage) != 1 || sim.Diff.Storage[0].Before != nil || !bytes.Equal(sim.Diff.Storage[0].After, le64(50)) {
+		t.Fatalf("unexpected storage diff %+v", sim.Diff.Storage)
+	}
+	diff := map[string]BalanceChange{}
+	for _, c := range sim.Diff.Balances {
+		diff[c.Address] = c
+	}
+	if a := diff["alice"]; a.Before != balance || a.After != balance-50-sim.GasUsed {
+		t.Fatalf("unexpected payer diff %+v (gas %d)", a, sim.GasUsed)
+	}
+	if v := diff[vault]; v.After-v.Before != 50 {
+		t.Fatalf("unexpected contract diff %+v", v)
+	}
+	if l.GetBalance("alice") != balance || len(l.Receipts(1)) != receipts {
+		t.Fatalf("simulation must not change the ledger")
+	}
+	if _, ok, _ := reg.Storage(vault, []byte("alice")); ok {
+		t.Fatalf("simulation must not write storage")
+	}
+
+	args := append(le32(0), le64(7)...)
+	reg.gasMargin = 0
+	est, err := reg.EstimateGasWithValue("alice", proxy, "relay", args, 7)
+	if err != nil || est.Error != "" || est.GasEstimate < est.GasUsed {
+		t.Fatalf("estimate relay: %+v %v", est, err)
+	}
+	need := est.GasEstimate
+	if _, err := reg.Call(proxy, "alice", "relay", args, 7, need-1); err == nil {
+		t.Fatalf("relay must fail below the estimate of %d", need)
+	}
+	before := l.GetBalance("alice")
+	rcpt, err := reg.Call(proxy, "alice", "relay", args, 7, need)
+	if err != nil {
+		t.Fatalf("relay with the estimate: %v", err)
+	}
+	if got := before - l.GetBalance("alice"); got != 7+rcpt.GasUsed {
+		t.Fatalf("call must charge only the gas used: paid %d, used %d", got, rcpt.GasUsed)
+	}
+
+	reg.gasMargin = DefaultGasEstimateMargin
+	if est, err = reg.EstimateGasWithValue("alice", proxy, "relay", args, 7); err != nil || est.GasEstimate != need+(need+9)/10 {
+		t.Fatalf("estimate with margin: %+v %v, want %d", est, err, need+(need+9)/10)
+	}
+	est, err = reg.EstimateGas("alice", vault, "spill", nil)
+	if err != nil || !strings.Contains(est.Error, ErrContractReverted.Error()) || est.GasEstimate != 0 || string(est.ReturnData) != "nope" {
+		t.Fatalf("estimate of a reverting call: %+v %v", est, err)
+	}
+}
+
+func TestLedgerSimulate(t *testing.T) {
+	l := NewLedger()
+	l.Credit("alice", 100)
+	root := l.StateRoot()
+
+	sim, err := l.Simulate(NewTransaction("alice", "bob", 30, 2, 0))
+	if err != nil || sim.Error != "" || sim.Fee != 2 {
+		t.Fatalf("simulate: %+v %v", sim, err)
+	}
+	want := []BalanceChange{{Address: "alice", Before: 100, After: 68}, {Address: "bob", Before: 0, After: 30}}
+	if len(sim.Diff.Balances) != 2 || sim.Diff.Balances[0] != want[0] || sim.Diff.Balances[1] != want[1] {
+		t.Fatalf("unexpected balance diff %+v", sim.Diff.Balances)
+	}
+	if len(sim.Diff.Nonces) != 1 || sim.Diff.Nonces[0] != (NonceChange{Address: "alice", Before: 0, After: 1}) {
+		t.Fatalf("unexpected nonce diff %+v", sim.Diff.Nonces)
+	}
+	if l.StateRoot() != root || l.GetBalance("bob") != 0 || l.Nonce("alice") != 0 {
+		t.Fatalf("simulation must not change the ledger")
+	}
+
+	if sim, err = l.Simulate(NewTransaction("alice", "bob", 30, 2, 3)); err != nil || !strings.Contains(sim.Error, ErrNonceGap.Error()) {
+		t.Fatalf("expected nonce gap, got %+v %v", sim, err)
+	}
+	if sim, err = l.Simulate(NewTransaction("alice", "bob", 300, 0, 0)); err != nil || sim.Error == "" {
+		t.Fatalf("expected insufficient funds, got %+v %v", sim, err)
+	}
+	tx := NewTransaction("alice", "bob", 30, 2, 0)
+	tx.Signature = []byte{1}
+	if sim, err = l.Simulate(tx); err != nil || !strings.Contains(sim.Error, ErrBadSignature.Error()) {
+		t.Fatalf("signed transactions must be verified, got %+v %v", sim, err)
+	}
+}
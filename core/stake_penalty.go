@@ -6,9 +6,10 @@ type StakePenaltyManager struct{}
 // NewStakePenaltyManager creates a new StakePenaltyManager.
 func NewStakePenaltyManager() *StakePenaltyManager { return &StakePenaltyManager{} }
 
-// Slash reduces the stake of addr on sn by the given penalty amount.
+// Slash burns the given penalty amount from the stake of addr on sn,
+// including tokens that are still unbonding.
 func (spm *StakePenaltyManager) Slash(sn *StakingNode, addr string, penalty uint64) {
-	sn.Unstake(addr, penalty)
+	sn.Slash(addr, penalty)
 }
 
 // Reward increases the stake of addr on sn by the given amount.
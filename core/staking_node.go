@@ -1,16 +1,56 @@
 package core
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
+
+// DefaultStakingNodeUnbondingPeriod is how long unstaked tokens stay locked,
+// and slashable, before they can be withdrawn.
+const DefaultStakingNodeUnbondingPeriod = 21 * 24 * time.Hour
 
 // StakingNode manages token staking for governance or validation purposes.
+// Unstaked tokens are not released at once: they unbond for the unbonding
+// period, during which they can still be slashed.
 type StakingNode struct {
-	mu     sync.Mutex
-	stakes map[string]uint64
+	mu        sync.Mutex
+	stakes    map[string]uint64
+	unbonding map[string][]stakeRelease
+	period    time.Duration
+	now       func() time.Time
+}
+
+// stakeRelease is an unstaked amount and the time it can be withdrawn.
+type stakeRelease struct {
+	amount uint64
+	at     time.Time
+}
+
+// StakingNodeOption configures optional behaviour of a StakingNode.
+type StakingNodeOption func(*StakingNode)
+
+// WithUnbondingPeriod sets how long unstaked tokens stay locked. A zero
+// period releases them at once.
+func WithUnbondingPeriod(d time.Duration) StakingNodeOption {
+	return func(s *StakingNode) {
+		if d >= 0 {
+			s.period = d
+		}
+	}
 }
 
 // NewStakingNode initializes and returns a StakingNode instance.
-func NewStakingNode() *StakingNode {
-	return &StakingNode{stakes: make(map[string]uint64)}
+func NewStakingNode(opts ...StakingNodeOption) *StakingNode {
+	s := &StakingNode{
+		stakes:    make(map[string]uint64),
+		unbonding: make(map[string][]stakeRelease),
+		period:    DefaultStakingNodeUnbondingPeriod,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Stake locks tokens from addr, increasing their staked balance.
@@ -20,17 +60,99 @@ func (s *StakingNode) Stake(addr string, amt uint64) {
 	s.stakes[addr] += amt
 }
 
-// Unstake releases tokens for addr, reducing their staked balance. If the
-// amount exceeds the current stake it removes the stake entirely.
-func (s *StakingNode) Unstake(addr string, amt uint64) {
+// Unstake starts unbonding tokens for addr, reducing their staked balance. If
+// the amount exceeds the current stake the whole stake unbonds. The tokens
+// can be withdrawn once the unbonding period has passed and it returns that
+// time.
+func (s *StakingNode) Unstake(addr string, amt uint64) time.Time {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	bal := s.stakes[addr]
-	if amt >= bal {
+	amt = min(amt, bal)
+	if amt == bal {
 		delete(s.stakes, addr)
-		return
+	} else {
+		s.stakes[addr] = bal - amt
+	}
+	at := s.now().Add(s.period)
+	if amt > 0 && s.period > 0 {
+		s.unbonding[addr] = append(s.unbonding[addr], stakeRelease{amount: amt, at: at})
+	}
+	return at
+}
+
+// Unbonding returns the tokens addr has unstaked but not yet withdrawn.
+func (s *StakingNode) Unbonding(addr string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total uint64
+	for _, r := range s.unbonding[addr] {
+		total += r.amount
+	}
+	return total
+}
+
+// Withdraw releases the tokens of addr whose unbonding period has passed and
+// returns their amount.
+func (s *StakingNode) Withdraw(addr string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var (
+		released uint64
+		kept     []stakeRelease
+	)
+	for _, r := range s.unbonding[addr] {
+		if r.at.After(now) {
+			kept = append(kept, r)
+			continue
+		}
+		released += r.amount
+	}
+	if len(kept) == 0 {
+		delete(s.unbonding, addr)
+	} else {
+		s.unbonding[addr] = kept
+	}
+	return released
+}
+
+// Slash burns up to amt of the tokens addr has at stake, taking them from the
+// staked balance first and then from the tokens still unbonding, most
+// recently unstaked first. It returns the amount burned.
+func (s *StakingNode) Slash(addr string, amt uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bal := s.stakes[addr]
+	burned := min(amt, bal)
+	if burned == bal {
+		delete(s.stakes, addr)
+	} else {
+		s.stakes[addr] = bal - burned
+	}
+	now := s.now()
+	queue := s.unbonding[addr]
+	for i := len(queue) - 1; i >= 0 && burned < amt; i-- {
+		if !queue[i].at.After(now) {
+			// already withdrawable, no longer at stake
+			continue
+		}
+		take := min(amt-burned, queue[i].amount)
+		queue[i].amount -= take
+		burned += take
+	}
+	kept := queue[:0]
+	for _, r := range queue {
+		if r.amount > 0 {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == 0 {
+		delete(s.unbonding, addr)
+	} else {
+		s.unbonding[addr] = kept
 	}
-	s.stakes[addr] = bal - amt
+	return burned
 }
 
 // Balance returns the current staked balance for addr.
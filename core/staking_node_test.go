@@ -1,6 +1,9 @@
 package core
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestStakingNodeStakeAndUnstake(t *testing.T) {
 	sn := NewStakingNode()
@@ -26,3 +29,27 @@ func TestStakingNodeTotal(t *testing.T) {
 		t.Fatalf("expected total 125, got %d", sn.TotalStaked())
 	}
 }
+
+func TestStakingNodeUnbonding(t *testing.T) {
+	now := time.Unix(1_000, 0)
+	sn := NewStakingNode(WithUnbondingPeriod(time.Hour))
+	sn.now = func() time.Time { return now }
+	sn.Stake("addr1", 100)
+	if release := sn.Unstake("addr1", 60); !release.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected release time %v", release)
+	}
+	if sn.Balance("addr1") != 40 || sn.Unbonding("addr1") != 60 {
+		t.Fatalf("expected 40 staked and 60 unbonding, got %d and %d", sn.Balance("addr1"), sn.Unbonding("addr1"))
+	}
+	if got := sn.Withdraw("addr1"); got != 0 {
+		t.Fatalf("withdrew %d before the unbonding period passed", got)
+	}
+	// unbonding tokens are still slashable
+	if burned := sn.Slash("addr1", 50); burned != 50 || sn.Balance("addr1") != 0 || sn.Unbonding("addr1") != 50 {
+		t.Fatalf("slash burned %d, left %d staked and %d unbonding", burned, sn.Balance("addr1"), sn.Unbonding("addr1"))
+	}
+	now = now.Add(time.Hour)
+	if got := sn.Withdraw("addr1"); got != 50 || sn.Unbonding("addr1") != 0 {
+		t.Fatalf("expected to withdraw 50, got %d", got)
+	}
+}
@@ -0,0 +1,635 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"synnergy/internal/tokens"
+)
+
+// A state snapshot captures the committed ledger state at a block height so a
+// new node can start from it instead of replaying every block. The state is
+// split into gzip compressed chunks addressed by the SHA-256 of their bytes.
+// A manifest lists the chunks together with the height, the block at that
+// height and the state root the chunks must reproduce, and is signed by the
+// node that produced it. Token registries are carried in their own chunk;
+// they are not part of the state root and are only covered by the signature.
+//
+// The signature alone proves nothing, since anyone can sign a manifest of
+// any state with a key of their own. A snapshot is therefore only accepted
+// against a trust anchor: a producer the caller trusts, or a block hash or
+// state root the caller obtained elsewhere, such as from a verified header
+// chain, that the snapshot must reproduce.
+//
+// On disk a snapshot is a directory holding manifest.json and a chunks
+// directory with one file per chunk hash.
+
+const (
+	// SnapshotFormatVersion is the version written to new manifests.
+	SnapshotFormatVersion = 1
+	// DefaultSnapshotChunkSize is the target size of an uncompressed chunk.
+	DefaultSnapshotChunkSize = 1 << 20
+
+	snapshotManifestFile = "manifest.json"
+	snapshotChunkDir     = "chunks"
+
+	snapshotChunkState  = "state"
+	snapshotChunkTokens = "tokens"
+)
+
+var (
+	// ErrSnapshotInvalid is returned when a snapshot fails verification.
+	ErrSnapshotInvalid = errors.New("invalid snapshot")
+	// ErrSnapshotHeight is returned when the state at the requested height
+	// can no longer be reconstructed.
+	ErrSnapshotHeight = errors.New("snapshot height unavailable")
+	// ErrLedgerNotEmpty is returned when restoring a snapshot into a ledger
+	// that already holds state.
+	ErrLedgerNotEmpty = errors.New("ledger not empty")
+	// ErrSnapshotUntrusted is returned when a snapshot is verified without a
+	// trust anchor or does not match the anchors given.
+	ErrSnapshotUntrusted = errors.New("untrusted snapshot")
+)
+
+// snapshotPrefixes are the state namespaces committed to by the state root.
+var snapshotPrefixes = []string{keyBalancePrefix, keyFrozenPrefix, keyNoncePrefix, keyPubKeyPrefix, keyContractPrefix, keyContractStoragePrefix, keyKVPrefix, keyStakePrefix, keyBeaconPrefix, keyEvidencePrefix, keyLivenessPrefix, keyValSetPrefix}
+
+func isSnapshotKey(key string) bool {
+	for _, p := range snapshotPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// StateEntry is a single key of committed ledger state.
+type StateEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// SnapshotToken is a token registry entry with its balances.
+type SnapshotToken struct {
+	ID        tokens.TokenID    `json:"id"`
+	Name      string            `json:"name"`
+	Symbol    string            `json:"symbol"`
+	Decimals  uint8             `json:"decimals"`
+	MaxSupply uint64            `json:"max_supply,omitempty"`
+	Balances  map[string]uint64 `json:"balances,omitempty"`
+}
+
+// SnapshotChunk identifies a chunk listed in a manifest.
+type SnapshotChunk struct {
+	Hash    string `json:"hash"`
+	Kind    string `json:"kind"`
+	Size    int    `json:"size"`
+	Entries int    `json:"entries"`
+}
+
+// SnapshotManifest describes a snapshot. Signature covers the JSON encoding
+// of the manifest with Signature left empty.
+type SnapshotManifest struct {
+	Version   int             `json:"version"`
+	Height    int             `json:"height"`
+	BlockHash string          `json:"block_hash"`
+	StateRoot string          `json:"state_root"`
+	Block     *Block          `json:"block"`
+	Chunks    []SnapshotChunk `json:"chunks"`
+	Producer  string          `json:"producer"`
+	PublicKey []byte          `json:"public_key"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+func (m *SnapshotManifest) digest() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = nil
+	b, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	d := sha256.Sum256(b)
+	return d[:], nil
+}
+
+// verifySignature checks that the manifest was signed by the key it names
+// and that the key belongs to the producer address.
+func (m *SnapshotManifest) verifySignature() error {
+	pub, err := decodePublicKey(m.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: producer key: %v", ErrSnapshotInvalid, err)
+	}
+	if deriveAddress(pub) != m.Producer {
+		return fmt.Errorf("%w: producer key does not match %s", ErrSnapshotInvalid, m.Producer)
+	}
+	d, err := m.digest()
+	if err != nil {
+		return err
+	}
+	if !verifyDigest(d, m.Signature, pub) {
+		return fmt.Errorf("%w: bad signature", ErrSnapshotInvalid)
+	}
+	return nil
+}
+
+// SnapshotSource provides the manifest and chunks of a snapshot.
+type SnapshotSource interface {
+	Manifest() (*SnapshotManifest, error)
+	Chunk(hash string) ([]byte, error)
+}
+
+// Snapshot is a snapshot held in memory.
+type Snapshot struct {
+	manifest SnapshotManifest
+	chunks   map[string][]byte
+}
+
+// Manifest returns the snapshot manifest.
+func (s *Snapshot) Manifest() (*SnapshotManifest, error) {
+	m := s.manifest
+	return &m, nil
+}
+
+// Chunk returns the chunk with the given hash.
+func (s *Snapshot) Chunk(hash string) ([]byte, error) {
+	c, ok := s.chunks[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: chunk %s missing", ErrSnapshotInvalid, hash)
+	}
+	return c, nil
+}
+
+// WriteDir stores the snapshot in dir, creating it if needed.
+func (s *Snapshot) WriteDir(dir string) error {
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(filepath.Join(dir, snapshotChunkDir), 0o700); err != nil {
+		return err
+	}
+	for hash, c := range s.chunks {
+		if err := os.WriteFile(filepath.Join(dir, snapshotChunkDir, hash), c, 0o600); err != nil {
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(&s.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, snapshotManifestFile), b, 0o600)
+}
+
+// SnapshotDir reads a snapshot stored with WriteDir.
+type SnapshotDir string
+
+// Manifest reads the manifest from the directory.
+func (d SnapshotDir) Manifest() (*SnapshotManifest, error) {
+	b, err := os.ReadFile(filepath.Join(filepath.Clean(string(d)), snapshotManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m SnapshotManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%w: manifest: %v", ErrSnapshotInvalid, err)
+	}
+	return &m, nil
+}
+
+// Chunk reads a chunk from the directory.
+func (d SnapshotDir) Chunk(hash string) ([]byte, error) {
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha256.Size {
+		return nil, fmt.Errorf("%w: malformed chunk hash %q", ErrSnapshotInvalid, hash)
+	}
+	return os.ReadFile(filepath.Join(filepath.Clean(string(d)), snapshotChunkDir, hash))
+}
+
+// SnapshotOption configures snapshot creation and restore.
+type SnapshotOption func(*snapshotConfig)
+
+type snapshotConfig struct {
+	chunkSize int
+	tokens    *tokens.Registry
+	producers map[string]bool
+	block     string
+	root      string
+}
+
+// WithSnapshotChunkSize sets the target uncompressed size of state chunks.
+func WithSnapshotChunkSize(n int) SnapshotOption {
+	return func(c *snapshotConfig) {
+		if n > 0 {
+			c.chunkSize = n
+		}
+	}
+}
+
+// WithSnapshotTokens includes the tokens of reg when creating a snapshot and
+// registers the snapshot's tokens in reg when restoring one.
+func WithSnapshotTokens(reg *tokens.Registry) SnapshotOption {
+	return func(c *snapshotConfig) { c.tokens = reg }
+}
+
+// WithTrustedSnapshotProducers accepts snapshots signed by any of the given
+// producer addresses.
+func WithTrustedSnapshotProducers(addrs ...string) SnapshotOption {
+	return func(c *snapshotConfig) {
+		if c.producers == nil {
+			c.producers = make(map[string]bool, len(addrs))
+		}
+		for _, addr := range addrs {
+			c.producers[addr] = true
+		}
+	}
+}
+
+// WithTrustedSnapshotBlock accepts only a snapshot of the block with the given
+// hash, whose state reproduces the state root that block declares.
+func WithTrustedSnapshotBlock(hash string) SnapshotOption {
+	return func(c *snapshotConfig) { c.block = hash }
+}
+
+// WithTrustedSnapshotRoot accepts only a snapshot whose state reproduces root.
+func WithTrustedSnapshotRoot(root string) SnapshotOption {
+	return func(c *snapshotConfig) { c.root = root }
+}
+
+func newSnapshotConfig(opts []SnapshotOption) snapshotConfig {
+	c := snapshotConfig{chunkSize: DefaultSnapshotChunkSize}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// snapshotChunkData is the decoded content of a chunk.
+type snapshotChunkData struct {
+	Entries []StateEntry    `json:"entries,omitempty"`
+	Tokens  []SnapshotToken `json:"tokens,omitempty"`
+}
+
+func encodeSnapshotChunk(kind string, data snapshotChunkData) ([]byte, SnapshotChunk, error) {
+	raw, err := json.Marshal(&data)
+	if err != nil {
+		return nil, SnapshotChunk{}, err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(raw); err != nil {
+		return nil, SnapshotChunk{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, SnapshotChunk{}, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	ref := SnapshotChunk{Hash: hex.EncodeToString(sum[:]), Kind: kind, Size: buf.Len(), Entries: len(data.Entries) + len(data.Tokens)}
+	return buf.Bytes(), ref, nil
+}
+
+// decodeSnapshotChunk checks a chunk against its content address and decodes
+// it.
+func decodeSnapshotChunk(ref SnapshotChunk, b []byte) (snapshotChunkData, error) {
+	var data snapshotChunkData
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != ref.Hash {
+		return data, fmt.Errorf("%w: chunk %s does not match its hash", ErrSnapshotInvalid, ref.Hash)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return data, fmt.Errorf("%w: chunk %s: %v", ErrSnapshotInvalid, ref.Hash, err)
+	}
+	defer gz.Close()
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		return data, fmt.Errorf("%w: chunk %s: %v", ErrSnapshotInvalid, ref.Hash, err)
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return data, fmt.Errorf("%w: chunk %s: %v", ErrSnapshotInvalid, ref.Hash, err)
+	}
+	return data, nil
+}
+
+// CreateSnapshot captures the committed state of l at height, or at the head
+// when height is zero, and signs the manifest with producer. Heights below the
+// head are reconstructed from the ledger's undo records, so only the most
+// recent blocks (see WithMaxReorgDepth) can be snapshotted.
+func CreateSnapshot(l *Ledger, height int, producer *Wallet, opts ...SnapshotOption) (*Snapshot, error) {
+	if producer == nil || producer.PrivateKey == nil {
+		return nil, errors.New("snapshot producer wallet required")
+	}
+	cfg := newSnapshotConfig(opts)
+	l.mu.RLock()
+	head := l.heightLocked()
+	if height == 0 {
+		height = head
+	}
+	if height <= 0 || height > head {
+		l.mu.RUnlock()
+		return nil, fmt.Errorf("%w: height %d, head %d", ErrSnapshotHeight, height, head)
+	}
+	block, ok := l.blockLocked(height)
+	if !ok {
+		l.mu.RUnlock()
+		return nil, fmt.Errorf("%w: block %d missing", ErrSnapshotHeight, height)
+	}
+	entries, err := l.stateEntriesLocked(height)
+	l.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	root, err := stateRootOf(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{chunks: make(map[string][]byte)}
+	m := &snap.manifest
+	*m = SnapshotManifest{
+		Version:   SnapshotFormatVersion,
+		Height:    height,
+		BlockHash: block.Hash,
+		StateRoot: root,
+		Block:     block,
+		Producer:  producer.Address,
+		PublicKey: producer.PublicKeyBytes(),
+	}
+	add := func(kind string, data snapshotChunkData) error {
+		b, ref, err := encodeSnapshotChunk(kind, data)
+		if err != nil {
+			return err
+		}
+		snap.chunks[ref.Hash] = b
+		m.Chunks = append(m.Chunks, ref)
+		return nil
+	}
+	var cur snapshotChunkData
+	size := 0
+	for _, e := range entries {
+		cur.Entries = append(cur.Entries, e)
+		size += len(e.Key) + len(e.Value)
+		if size >= cfg.chunkSize {
+			if err := add(snapshotChunkState, cur); err != nil {
+				return nil, err
+			}
+			cur, size = snapshotChunkData{}, 0
+		}
+	}
+	if len(cur.Entries) > 0 || len(m.Chunks) == 0 {
+		if err := add(snapshotChunkState, cur); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.tokens != nil {
+		if toks := snapshotTokens(cfg.tokens); len(toks) > 0 {
+			if err := add(snapshotChunkTokens, snapshotChunkData{Tokens: toks}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	d, err := m.digest()
+	if err != nil {
+		return nil, err
+	}
+	sig, _, err := signSubBlock(producer.PrivateKey, hex.EncodeToString(d))
+	if err != nil {
+		return nil, err
+	}
+	m.Signature = sig
+	return snap, nil
+}
+
+// stateEntriesLocked returns the committed state at height, sorted by key.
+// The state diffs above height are applied from the head down, so each key
+// ends up with the value it had before the first of them touched it.
+func (l *Ledger) stateEntriesLocked(height int) ([]StateEntry, error) {
+	overlay := make(map[string]undoEntry)
+	err := l.walkHistoryLocked(height, func(e undoEntry) {
+		if isSnapshotKey(e.Key) {
+			overlay[e.Key] = e
+		}
+	})
+	if errors.Is(err, ErrHistoryUnavailable) {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotHeight, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[string][]byte)
+	for _, p := range snapshotPrefixes {
+		it := l.store.Iterate([]byte(p))
+		for it.Next() {
+			state[string(it.Key())] = append([]byte(nil), it.Value()...)
+		}
+	}
+	for k, e := range overlay {
+		if e.Absent {
+			delete(state, k)
+		} else {
+			state[k] = e.Value
+		}
+	}
+	entries := make([]StateEntry, 0, len(state))
+	for k, v := range state {
+		entries = append(entries, StateEntry{Key: k, Value: v})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// stateRootOf computes the state root committing to entries.
+func stateRootOf(entries []StateEntry) (string, error) {
+	scratch := newLedger()
+	for _, e := range entries {
+		scratch.setLocked(e.Key, e.Value)
+	}
+	root, err := scratch.updateStateRootLocked()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(root[:]), nil
+}
+
+func snapshotTokens(reg *tokens.Registry) []SnapshotToken {
+	var out []SnapshotToken
+	for _, info := range reg.List() {
+		t, ok := reg.Get(info.ID)
+		if !ok {
+			continue
+		}
+		st := SnapshotToken{ID: info.ID, Name: info.Name, Symbol: info.Symbol, Decimals: info.Decimals}
+		if capped, ok := t.(interface{ MaxSupply() uint64 }); ok {
+			st.MaxSupply = capped.MaxSupply()
+		}
+		if acc, ok := t.(interface {
+			Accounts() []tokens.AccountSnapshot
+		}); ok {
+			for _, a := range acc.Accounts() {
+				if a.Balance == 0 {
+					continue
+				}
+				if st.Balances == nil {
+					st.Balances = make(map[string]uint64)
+				}
+				st.Balances[a.Address] = a.Balance
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// loadedSnapshot is a verified snapshot ready to be restored.
+type loadedSnapshot struct {
+	manifest *SnapshotManifest
+	entries  []StateEntry
+	tokens   []SnapshotToken
+}
+
+// VerifySnapshot checks the manifest signature, that the manifest matches the
+// trust anchors given with WithTrustedSnapshotProducers,
+// WithTrustedSnapshotBlock or WithTrustedSnapshotRoot, every chunk against its
+// hash and that the state in the chunks reproduces the manifest's state root.
+// A snapshot verified without any trust anchor is rejected. It returns the
+// verified manifest.
+func VerifySnapshot(src SnapshotSource, opts ...SnapshotOption) (*SnapshotManifest, error) {
+	ls, err := loadSnapshot(src, newSnapshotConfig(opts))
+	if err != nil {
+		return nil, err
+	}
+	return ls.manifest, nil
+}
+
+// checkTrust checks m against every trust anchor of the configuration.
+func (c snapshotConfig) checkTrust(m *SnapshotManifest) error {
+	if len(c.producers) == 0 && c.block == "" && c.root == "" {
+		return fmt.Errorf("%w: no trusted producer, block or state root given", ErrSnapshotUntrusted)
+	}
+	if len(c.producers) > 0 && !c.producers[m.Producer] {
+		return fmt.Errorf("%w: producer %s is not trusted", ErrSnapshotUntrusted, m.Producer)
+	}
+	if c.block != "" && (m.BlockHash != c.block || m.Block.StateRoot != m.StateRoot) {
+		return fmt.Errorf("%w: snapshot is not of block %s", ErrSnapshotUntrusted, c.block)
+	}
+	if c.root != "" && m.StateRoot != c.root {
+		return fmt.Errorf("%w: state root %s, want %s", ErrSnapshotUntrusted, m.StateRoot, c.root)
+	}
+	return nil
+}
+
+func loadSnapshot(src SnapshotSource, cfg snapshotConfig) (*loadedSnapshot, error) {
+	m, err := src.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	if m.Version != SnapshotFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrSnapshotInvalid, m.Version)
+	}
+	if err := m.verifySignature(); err != nil {
+		return nil, err
+	}
+	if m.Height <= 0 || m.Block == nil || m.Block.Hash != m.BlockHash {
+		return nil, fmt.Errorf("%w: manifest does not name its block", ErrSnapshotInvalid)
+	}
+	if err := m.Block.Header(m.Height).Verify(); err != nil {
+		return nil, fmt.Errorf("%w: block %d: %v", ErrSnapshotInvalid, m.Height, err)
+	}
+	if err := cfg.checkTrust(m); err != nil {
+		return nil, err
+	}
+	ls := &loadedSnapshot{manifest: m}
+	prev := ""
+	for _, ref := range m.Chunks {
+		b, err := src.Chunk(ref.Hash)
+		if err != nil {
+			return nil, err
+		}
+		data, err := decodeSnapshotChunk(ref, b)
+		if err != nil {
+			return nil, err
+		}
+		switch ref.Kind {
+		case snapshotChunkState:
+			for _, e := range data.Entries {
+				if !isSnapshotKey(e.Key) || e.Key <= prev {
+					return nil, fmt.Errorf("%w: unexpected key %q", ErrSnapshotInvalid, e.Key)
+				}
+				prev = e.Key
+			}
+			ls.entries = append(ls.entries, data.Entries...)
+		case snapshotChunkTokens:
+			ls.tokens = append(ls.tokens, data.Tokens...)
+		default:
+			return nil, fmt.Errorf("%w: unknown chunk kind %q", ErrSnapshotInvalid, ref.Kind)
+		}
+	}
+	root, err := stateRootOf(ls.entries)
+	if err != nil {
+		return nil, err
+	}
+	if root != m.StateRoot {
+		return nil, fmt.Errorf("%w: chunks produce state root %s, manifest declares %s", ErrSnapshotInvalid, root, m.StateRoot)
+	}
+	return ls, nil
+}
+
+// RestoreSnapshot verifies src like VerifySnapshot, against the trust anchors
+// among opts, and loads it into l, which must be empty.
+// Afterwards the ledger's head is the snapshot block and later blocks can be
+// added on top of it; blocks below the snapshot height are not available.
+// With WithSnapshotTokens the snapshot's tokens are registered as base tokens.
+func (l *Ledger) RestoreSnapshot(src SnapshotSource, opts ...SnapshotOption) (*SnapshotManifest, error) {
+	cfg := newSnapshotConfig(opts)
+	ls, err := loadSnapshot(src, cfg)
+	if err != nil {
+		return nil, err
+	}
+	m := ls.manifest
+	l.mu.Lock()
+	if l.heightLocked() != 0 || l.stateRootHashLocked() != emptyTrieHash {
+		l.mu.Unlock()
+		return nil, ErrLedgerNotEmpty
+	}
+	if err := l.restoreStateLocked(m.Height, m.Block, ls.entries); err != nil {
+		l.discardLocked()
+		l.mu.Unlock()
+		return nil, err
+	}
+	if root, err := l.updateStateRootLocked(); err != nil || hex.EncodeToString(root[:]) != m.StateRoot {
+		l.discardLocked()
+		l.mu.Unlock()
+		return nil, fmt.Errorf("%w: restored state root differs", ErrStateMismatch)
+	}
+	err = l.commitLocked(walRecord{Kind: walKindSnapshot, Height: m.Height, Block: m.Block, Entries: ls.entries})
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.tokens != nil {
+		for _, st := range ls.tokens {
+			t := tokens.NewBaseToken(st.ID, st.Name, st.Symbol, st.Decimals, tokens.WithMaxSupply(st.MaxSupply))
+			for addr, bal := range st.Balances {
+				if err := t.Mint(addr, bal); err != nil {
+					return nil, fmt.Errorf("restore token %s: %w", st.Symbol, err)
+				}
+			}
+			cfg.tokens.Register(t)
+		}
+	}
+	return m, nil
+}
+
+// restoreStateLocked stages the snapshot state and block.
+func (l *Ledger) restoreStateLocked(height int, b *Block, entries []StateEntry) error {
+	for _, e := range entries {
+		l.setLocked(e.Key, e.Value)
+	}
+	return l.putBlockLocked(height, b)
+}
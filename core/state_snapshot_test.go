@@ -0,0 +1,194 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synnergy/internal/tokens"
+)
+
+// addSealedTestBlocks appends n blocks that declare their state roots, each
+// moving funds from sender, and returns them.
+func addSealedTestBlocks(t *testing.T, l *Ledger, validator, sender *Wallet, n int) []*Block {
+	t.Helper()
+	height, _ := l.Head()
+	prev, _ := l.GetBlock(height)
+	var out []*Block
+	for i := 0; i < n; i++ {
+		blk := sealTestBlock(t, l, reorgTestBlock(t, prev, validator, signedTestTx(t, sender, fmt.Sprintf("to-%d", height+i), 1, 0, l.Nonce(sender.Address))))
+		if err := l.AddBlock(blk); err != nil {
+			t.Fatalf("add block: %v", err)
+		}
+		out = append(out, blk)
+		prev = blk
+	}
+	return out
+}
+
+func TestSnapshotCreateVerifyRestore(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	producer := testWallet(t, "producer")
+	source := NewLedger()
+	source.Credit(alice.Address, 1000)
+	blocks := addSealedTestBlocks(t, source, validator, alice, 5)
+	reg := tokens.NewRegistry()
+	tok := tokens.NewBaseToken(reg.NextID(), "Gold", "GLD", 2, tokens.WithMaxSupply(1000))
+	tok.Mint(alice.Address, 40)
+	reg.Register(tok)
+
+	snap, err := CreateSnapshot(source, 0, producer, WithSnapshotChunkSize(64), WithSnapshotTokens(reg))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	dir := t.TempDir()
+	if err := snap.WriteDir(dir); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	m, err := VerifySnapshot(SnapshotDir(dir), WithTrustedSnapshotProducers(producer.Address))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if m.Height != 5 || m.BlockHash != blocks[4].Hash || m.StateRoot != source.StateRoot() || m.Producer != producer.Address {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	if len(m.Chunks) < 3 {
+		t.Fatalf("expected the state to be split into chunks, got %d", len(m.Chunks))
+	}
+
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	dest, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	restored := tokens.NewRegistry()
+	if _, err := dest.RestoreSnapshot(SnapshotDir(dir), WithSnapshotTokens(restored), WithTrustedSnapshotProducers(producer.Address)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if h, head := dest.Head(); h != 5 || head != blocks[4].Hash || dest.StateRoot() != source.StateRoot() {
+		t.Fatalf("unexpected restored head %d %s", h, head)
+	}
+	if dest.GetBalance(alice.Address) != source.GetBalance(alice.Address) || dest.Nonce(alice.Address) != 5 {
+		t.Fatalf("account state not restored")
+	}
+	if got, ok := restored.GetBySymbol("GLD"); !ok || got.ID() != tok.ID() || got.BalanceOf(alice.Address) != 40 {
+		t.Fatalf("token registry not restored")
+	}
+	if _, err := dest.RestoreSnapshot(SnapshotDir(dir), WithTrustedSnapshotProducers(producer.Address)); !errors.Is(err, ErrLedgerNotEmpty) {
+		t.Fatalf("expected ErrLedgerNotEmpty got %v", err)
+	}
+
+	// blocks after the snapshot apply on top of it, also after a restart
+	next := addSealedTestBlocks(t, source, validator, alice, 1)[0]
+	if err := dest.AddBlock(next); err != nil {
+		t.Fatalf("block after snapshot: %v", err)
+	}
+	dest.Close()
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if h, _ := reopened.Head(); h != 6 || reopened.StateRoot() != source.StateRoot() {
+		t.Fatalf("replayed snapshot differs from the source")
+	}
+}
+
+func TestSnapshotAtPastHeight(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	producer := testWallet(t, "producer")
+	l, _ := OpenLedger("", WithMaxReorgDepth(2))
+	l.Credit(alice.Address, 1000)
+	blocks := addSealedTestBlocks(t, l, validator, alice, 4)
+
+	snap, err := CreateSnapshot(l, 2, producer)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	m, err := VerifySnapshot(snap, WithTrustedSnapshotProducers(producer.Address))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if m.Height != 2 || m.StateRoot != blocks[1].StateRoot {
+		t.Fatalf("snapshot does not match block 2: %+v", m)
+	}
+	if _, err := CreateSnapshot(l, 1, producer); !errors.Is(err, ErrSnapshotHeight) {
+		t.Fatalf("expected ErrSnapshotHeight got %v", err)
+	}
+	if _, err := CreateSnapshot(l, 5, producer); !errors.Is(err, ErrSnapshotHeight) {
+		t.Fatalf("expected ErrSnapshotHeight got %v", err)
+	}
+}
+
+func TestSnapshotRejectsTampering(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	l := NewLedger()
+	l.Credit(alice.Address, 1000)
+	addSealedTestBlocks(t, l, validator, alice, 2)
+	producer := testWallet(t, "producer")
+	snap, err := CreateSnapshot(l, 0, producer)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	dir := t.TempDir()
+	snap.WriteDir(dir)
+	m, _ := snap.Manifest()
+	chunk := filepath.Join(dir, snapshotChunkDir, m.Chunks[0].Hash)
+	os.WriteFile(chunk, []byte("garbage"), 0o600)
+	if _, err := VerifySnapshot(SnapshotDir(dir), WithTrustedSnapshotProducers(producer.Address)); !errors.Is(err, ErrSnapshotInvalid) {
+		t.Fatalf("expected a modified chunk to be rejected, got %v", err)
+	}
+
+	forged := *snap
+	forged.manifest.StateRoot = EmptyStateRoot
+	if _, err := VerifySnapshot(&forged, WithTrustedSnapshotProducers(producer.Address)); !errors.Is(err, ErrSnapshotInvalid) {
+		t.Fatalf("expected a modified manifest to be rejected, got %v", err)
+	}
+}
+
+func TestSnapshotRequiresATrustAnchor(t *testing.T) {
+	validator, alice := registerTestValidator(t), testWallet(t, "alice")
+	producer, attacker := testWallet(t, "producer"), testWallet(t, "attacker")
+	l := NewLedger()
+	l.Credit(alice.Address, 1000)
+	blocks := addSealedTestBlocks(t, l, validator, alice, 2)
+	head := blocks[1]
+	snap, err := CreateSnapshot(l, 0, producer)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := VerifySnapshot(snap); !errors.Is(err, ErrSnapshotUntrusted) {
+		t.Fatalf("expected a snapshot without a trust anchor to be rejected, got %v", err)
+	}
+	for _, opt := range []SnapshotOption{WithTrustedSnapshotProducers(producer.Address), WithTrustedSnapshotBlock(head.Hash), WithTrustedSnapshotRoot(head.StateRoot)} {
+		if _, err := VerifySnapshot(snap, opt); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+	}
+
+	// the attacker signs a snapshot of another state naming the real head
+	fake := NewLedger()
+	fake.Credit(attacker.Address, 1_000_000)
+	addSealedTestBlocks(t, fake, validator, attacker, 1)
+	forged, err := CreateSnapshot(fake, 0, attacker)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	m := &forged.manifest
+	m.Height, m.BlockHash, m.Block, m.Signature = head.Header(2).Height, head.Hash, head, nil
+	d, _ := m.digest()
+	m.Signature, _, _ = signSubBlock(attacker.PrivateKey, fmt.Sprintf("%x", d))
+	if _, err := VerifySnapshot(forged, WithTrustedSnapshotProducers(attacker.Address)); err != nil {
+		t.Fatalf("a trusted producer's snapshot must verify, got %v", err)
+	}
+	for _, opt := range []SnapshotOption{WithTrustedSnapshotProducers(producer.Address), WithTrustedSnapshotBlock(head.Hash), WithTrustedSnapshotRoot(head.StateRoot)} {
+		if _, err := VerifySnapshot(forged, opt); !errors.Is(err, ErrSnapshotUntrusted) {
+			t.Fatalf("expected the forged snapshot to be rejected, got %v", err)
+		}
+		if _, err := NewLedger().RestoreSnapshot(forged, opt); !errors.Is(err, ErrSnapshotUntrusted) {
+			t.Fatalf("expected the forged snapshot not to be restored, got %v", err)
+		}
+	}
+}
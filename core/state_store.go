@@ -0,0 +1,221 @@
+package core
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrStateNotFound is returned when a key is absent from a state store.
+	ErrStateNotFound = errors.New("state key not found")
+	// ErrStateStoreClosed is returned when a closed store is accessed.
+	ErrStateStoreClosed = errors.New("state store closed")
+)
+
+// StateKeyIterator extends StateIterator with access to the current key.
+// Iterators visit keys in ascending byte order.
+type StateKeyIterator interface {
+	StateIterator
+	Key() []byte
+	Err() error
+}
+
+// StateStore is the key-value backend holding ledger state. Writes are only
+// applied through batches and implementations must make every batch atomic:
+// after a crash either all of its writes are visible or none are.
+type StateStore interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+	Iterate(prefix []byte) StateKeyIterator
+	Write(b *StateBatch) error
+	Close() error
+}
+
+type stateOp struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// StateBatch collects writes that are committed to a StateStore as a single
+// atomic unit. Later writes to the same key replace earlier ones.
+type StateBatch struct {
+	ops   []stateOp
+	index map[string]int
+}
+
+// NewStateBatch returns an empty batch.
+func NewStateBatch() *StateBatch {
+	return &StateBatch{index: make(map[string]int)}
+}
+
+// Set records a write of value under key. Both slices are copied.
+func (b *StateBatch) Set(key, value []byte) {
+	b.put(stateOp{key: string(key), value: append([]byte{}, value...)})
+}
+
+// Delete records the removal of key.
+func (b *StateBatch) Delete(key []byte) {
+	b.put(stateOp{key: string(key), delete: true})
+}
+
+func (b *StateBatch) put(op stateOp) {
+	if b.index == nil {
+		b.index = make(map[string]int)
+	}
+	if i, ok := b.index[op.key]; ok {
+		b.ops[i] = op
+		return
+	}
+	b.index[op.key] = len(b.ops)
+	b.ops = append(b.ops, op)
+}
+
+// Len reports the number of distinct keys written by the batch.
+func (b *StateBatch) Len() int { return len(b.ops) }
+
+// Reset discards all recorded writes so the batch can be reused.
+func (b *StateBatch) Reset() {
+	b.ops = b.ops[:0]
+	for k := range b.index {
+		delete(b.index, k)
+	}
+}
+
+// lookup reports the pending write for key, if any.
+func (b *StateBatch) lookup(key string) (value []byte, deleted, ok bool) {
+	i, ok := b.index[key]
+	if !ok {
+		return nil, false, false
+	}
+	op := b.ops[i]
+	return op.value, op.delete, true
+}
+
+// sliceIterator walks a sorted snapshot of keys, fetching values lazily.
+type sliceIterator struct {
+	keys  []string
+	idx   int
+	fetch func(key string) ([]byte, bool, error)
+	value []byte
+	err   error
+}
+
+func (it *sliceIterator) Next() bool {
+	for it.err == nil && it.idx < len(it.keys) {
+		it.idx++
+		v, ok, err := it.fetch(it.keys[it.idx-1])
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if ok {
+			it.value = v
+			return true
+		}
+	}
+	return false
+}
+
+func (it *sliceIterator) Key() []byte {
+	if it.idx == 0 {
+		return nil
+	}
+	return []byte(it.keys[it.idx-1])
+}
+
+func (it *sliceIterator) Value() []byte { return it.value }
+
+func (it *sliceIterator) Err() error { return it.err }
+
+// MemoryStateStore is a volatile StateStore used when no on-disk backend is
+// configured. It is safe for concurrent use.
+type MemoryStateStore struct {
+	mu     sync.RWMutex
+	data   map[string][]byte
+	closed bool
+}
+
+// NewMemoryStateStore returns an empty in-memory store.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{data: make(map[string][]byte)}
+}
+
+// Get returns a copy of the value stored under key.
+func (s *MemoryStateStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStateStoreClosed
+	}
+	v, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+// Has reports whether key is present.
+func (s *MemoryStateStore) Has(key []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false, ErrStateStoreClosed
+	}
+	_, ok := s.data[string(key)]
+	return ok, nil
+}
+
+// Iterate returns the entries whose keys start with prefix in key order.
+func (s *MemoryStateStore) Iterate(prefix []byte) StateKeyIterator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return &sliceIterator{err: ErrStateStoreClosed}
+	}
+	p := string(prefix)
+	keys := make([]string, 0)
+	for k := range s.data {
+		if strings.HasPrefix(k, p) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return &sliceIterator{keys: keys, fetch: func(key string) ([]byte, bool, error) {
+		v, err := s.Get([]byte(key))
+		if errors.Is(err, ErrStateNotFound) {
+			return nil, false, nil
+		}
+		return v, err == nil, err
+	}}
+}
+
+// Write applies every operation in the batch atomically.
+func (s *MemoryStateStore) Write(b *StateBatch) error {
+	if b == nil || b.Len() == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStateStoreClosed
+	}
+	for _, op := range b.ops {
+		if op.delete {
+			delete(s.data, op.key)
+			continue
+		}
+		s.data[op.key] = append([]byte{}, op.value...)
+	}
+	return nil
+}
+
+// Close releases the store. Subsequent calls return ErrStateStoreClosed.
+func (s *MemoryStateStore) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,393 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrStateStoreCorrupt is returned when a state log record fails its checksum
+// somewhere other than at the tail of the file.
+var ErrStateStoreCorrupt = errors.New("state store corrupt")
+
+const (
+	fileStateMagic      = "SYNKV001"
+	fileStateHeaderSize = 8 // uint32 payload length + uint32 crc32
+	fileStateOpSet      = 0
+	fileStateOpDelete   = 1
+	// fileStateCompactChunk bounds the payload size of records written during
+	// compaction so rewriting a large store does not buffer it all in memory.
+	fileStateCompactChunk = 4 << 20
+)
+
+// fileValueLoc locates a live value inside the log file.
+type fileValueLoc struct {
+	off int64
+	n   int
+}
+
+// FileStateStore is an embedded StateStore persisted as an append-only log.
+// Each batch is written as one checksummed record and fsynced before Write
+// returns, so a batch is either fully recovered or discarded after a crash. An
+// in-memory index maps every live key to the location of its latest value;
+// values themselves stay on disk and are read on demand. Superseded records
+// are reclaimed with Compact.
+type FileStateStore struct {
+	mu     sync.RWMutex
+	path   string
+	f      *os.File
+	size   int64
+	index  map[string]fileValueLoc
+	closed bool
+}
+
+// OpenFileStateStore opens or creates the log at path and rebuilds its index.
+// A partially written record at the end of the file, left behind by a crash
+// mid-write, is truncated away. Damage anywhere else yields
+// ErrStateStoreCorrupt.
+func OpenFileStateStore(path string) (*FileStateStore, error) {
+	clean := filepath.Clean(path)
+	f, err := os.OpenFile(clean, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStateStore{path: clean, f: f, index: make(map[string]fileValueLoc)}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load validates the header, replays every record into the index and trims a
+// torn tail.
+func (s *FileStateStore) load() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := s.f.WriteAt([]byte(fileStateMagic), 0); err != nil {
+			return err
+		}
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+		s.size = int64(len(fileStateMagic))
+		return syncDir(filepath.Dir(s.path))
+	}
+	magic := make([]byte, len(fileStateMagic))
+	if _, err := s.f.ReadAt(magic, 0); err != nil || string(magic) != fileStateMagic {
+		return fmt.Errorf("%w: %s: bad header", ErrStateStoreCorrupt, s.path)
+	}
+	total := info.Size()
+	off := int64(len(fileStateMagic))
+	r := bufio.NewReader(io.NewSectionReader(s.f, off, total-off))
+	hdr := make([]byte, fileStateHeaderSize)
+	for off < total {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			break // torn header
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		sum := binary.BigEndian.Uint32(hdr[4:8])
+		end := off + fileStateHeaderSize + n
+		if end > total {
+			break // torn payload
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			if end == total {
+				break // last record was only partly flushed
+			}
+			return fmt.Errorf("%w: %s: checksum mismatch at offset %d", ErrStateStoreCorrupt, s.path, off)
+		}
+		if err := s.indexRecord(off+fileStateHeaderSize, payload); err != nil {
+			return fmt.Errorf("%w: %s: offset %d: %v", ErrStateStoreCorrupt, s.path, off, err)
+		}
+		off = end
+	}
+	if off < total {
+		if err := s.f.Truncate(off); err != nil {
+			return err
+		}
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+	}
+	s.size = off
+	return nil
+}
+
+// indexRecord applies the operations of a record whose payload starts at base.
+func (s *FileStateStore) indexRecord(base int64, payload []byte) error {
+	pos := 0
+	for pos < len(payload) {
+		op := payload[pos]
+		pos++
+		klen, n := binary.Uvarint(payload[pos:])
+		if n <= 0 || uint64(len(payload)-pos-n) < klen {
+			return errors.New("bad key length")
+		}
+		pos += n
+		key := string(payload[pos : pos+int(klen)])
+		pos += int(klen)
+		switch op {
+		case fileStateOpDelete:
+			delete(s.index, key)
+		case fileStateOpSet:
+			vlen, n := binary.Uvarint(payload[pos:])
+			if n <= 0 || uint64(len(payload)-pos-n) < vlen {
+				return errors.New("bad value length")
+			}
+			pos += n
+			s.index[key] = fileValueLoc{off: base + int64(pos), n: int(vlen)}
+			pos += int(vlen)
+		default:
+			return fmt.Errorf("unknown op %d", op)
+		}
+	}
+	return nil
+}
+
+// encodeStateOps appends the wire form of ops to buf.
+func encodeStateOps(buf []byte, ops []stateOp) []byte {
+	for _, op := range ops {
+		if op.delete {
+			buf = append(buf, fileStateOpDelete)
+			buf = binary.AppendUvarint(buf, uint64(len(op.key)))
+			buf = append(buf, op.key...)
+			continue
+		}
+		buf = append(buf, fileStateOpSet)
+		buf = binary.AppendUvarint(buf, uint64(len(op.key)))
+		buf = append(buf, op.key...)
+		buf = binary.AppendUvarint(buf, uint64(len(op.value)))
+		buf = append(buf, op.value...)
+	}
+	return buf
+}
+
+// frameStateRecord prefixes payload with its length and checksum.
+func frameStateRecord(payload []byte) []byte {
+	rec := make([]byte, fileStateHeaderSize, fileStateHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	return append(rec, payload...)
+}
+
+// Get returns the latest value stored under key.
+func (s *FileStateStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStateStoreClosed
+	}
+	loc, ok := s.index[string(key)]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	v := make([]byte, loc.n)
+	if _, err := s.f.ReadAt(v, loc.off); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Has reports whether key is present.
+func (s *FileStateStore) Has(key []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false, ErrStateStoreClosed
+	}
+	_, ok := s.index[string(key)]
+	return ok, nil
+}
+
+// Iterate returns the entries whose keys start with prefix in key order. The
+// key set is captured when Iterate is called; values are read as the iterator
+// advances.
+func (s *FileStateStore) Iterate(prefix []byte) StateKeyIterator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return &sliceIterator{err: ErrStateStoreClosed}
+	}
+	p := string(prefix)
+	keys := make([]string, 0)
+	for k := range s.index {
+		if strings.HasPrefix(k, p) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return &sliceIterator{keys: keys, fetch: func(key string) ([]byte, bool, error) {
+		v, err := s.Get([]byte(key))
+		if errors.Is(err, ErrStateNotFound) {
+			return nil, false, nil
+		}
+		return v, err == nil, err
+	}}
+}
+
+// Write appends the batch as a single record and syncs it to disk before the
+// index is updated.
+func (s *FileStateStore) Write(b *StateBatch) error {
+	if b == nil || b.Len() == 0 {
+		return nil
+	}
+	payload := encodeStateOps(nil, b.ops)
+	rec := frameStateRecord(payload)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStateStoreClosed
+	}
+	if _, err := s.f.WriteAt(rec, s.size); err != nil {
+		_ = s.f.Truncate(s.size)
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		_ = s.f.Truncate(s.size)
+		return err
+	}
+	if err := s.indexRecord(s.size+fileStateHeaderSize, payload); err != nil {
+		return err
+	}
+	s.size += int64(len(rec))
+	return nil
+}
+
+// Compact rewrites the log so it only contains live values. The new file is
+// written alongside the old one and atomically renamed over it, so a crash
+// during compaction leaves the original log intact.
+func (s *FileStateStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStateStoreClosed
+	}
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	keys := make([]string, 0, len(s.index))
+	for k := range s.index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := bufio.NewWriter(tmp)
+	if _, err := w.WriteString(fileStateMagic); err != nil {
+		return fail(err)
+	}
+	size := int64(len(fileStateMagic))
+	index := make(map[string]fileValueLoc, len(keys))
+	var payload []byte
+	var pendingKeys []string
+	flush := func() error {
+		if len(payload) == 0 {
+			return nil
+		}
+		base := size + fileStateHeaderSize
+		if _, err := w.Write(frameStateRecord(payload)); err != nil {
+			return err
+		}
+		// Re-index from the payload we just wrote to learn the new offsets.
+		pos := 0
+		for _, k := range pendingKeys {
+			pos++ // op
+			pos += uvarintLen(uint64(len(k))) + len(k)
+			n := s.index[k].n
+			pos += uvarintLen(uint64(n))
+			index[k] = fileValueLoc{off: base + int64(pos), n: n}
+			pos += n
+		}
+		size = base + int64(len(payload))
+		payload = payload[:0]
+		pendingKeys = pendingKeys[:0]
+		return nil
+	}
+	for _, k := range keys {
+		loc := s.index[k]
+		v := make([]byte, loc.n)
+		if _, err := s.f.ReadAt(v, loc.off); err != nil {
+			return fail(err)
+		}
+		payload = encodeStateOps(payload, []stateOp{{key: k, value: v}})
+		pendingKeys = append(pendingKeys, k)
+		if len(payload) >= fileStateCompactChunk {
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return fail(err)
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fail(err)
+	}
+	if err := syncDir(filepath.Dir(s.path)); err != nil {
+		tmp.Close()
+		return err
+	}
+	s.f.Close()
+	s.f = tmp
+	s.size = size
+	s.index = index
+	return nil
+}
+
+// Close syncs and closes the underlying file.
+func (s *FileStateStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.f.Close()
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+// syncDir flushes directory metadata so newly created or renamed files
+// survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func collectKeys(it StateKeyIterator) []string {
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key())+"="+string(it.Value()))
+	}
+	return keys
+}
+
+func exerciseStateStore(t *testing.T, s StateStore) {
+	t.Helper()
+	b := NewStateBatch()
+	b.Set([]byte("a/2"), []byte("two"))
+	b.Set([]byte("a/1"), []byte("one"))
+	b.Set([]byte("b/1"), []byte("x"))
+	b.Delete([]byte("b/1"))
+	if err := s.Write(b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if v, err := s.Get([]byte("a/1")); err != nil || string(v) != "one" {
+		t.Fatalf("get a/1: %q %v", v, err)
+	}
+	if _, err := s.Get([]byte("b/1")); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("expected ErrStateNotFound got %v", err)
+	}
+	if ok, _ := s.Has([]byte("a/2")); !ok {
+		t.Fatalf("expected a/2 present")
+	}
+	got := collectKeys(s.Iterate([]byte("a/")))
+	if len(got) != 2 || got[0] != "a/1=one" || got[1] != "a/2=two" {
+		t.Fatalf("unexpected iteration: %v", got)
+	}
+}
+
+func TestMemoryStateStore(t *testing.T) {
+	s := NewMemoryStateStore()
+	exerciseStateStore(t, s)
+	s.Close()
+	if _, err := s.Get([]byte("a/1")); !errors.Is(err, ErrStateStoreClosed) {
+		t.Fatalf("expected ErrStateStoreClosed got %v", err)
+	}
+}
+
+func TestFileStateStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	exerciseStateStore(t, s)
+	b := NewStateBatch()
+	b.Set([]byte("a/1"), []byte("uno"))
+	if err := s.Write(b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s.Close()
+
+	s, err = OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	got := collectKeys(s.Iterate(nil))
+	if len(got) != 2 || got[0] != "a/1=uno" || got[1] != "a/2=two" {
+		t.Fatalf("unexpected state after reopen: %v", got)
+	}
+}
+
+func TestFileStateStoreTornBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	b := NewStateBatch()
+	b.Set([]byte("k1"), []byte("v1"))
+	s.Write(b)
+	info, _ := os.Stat(path)
+	good := info.Size()
+	b.Reset()
+	b.Set([]byte("k1"), []byte("changed"))
+	b.Set([]byte("k2"), []byte("v2"))
+	s.Write(b)
+	s.Close()
+
+	// simulate a crash part way through the second batch
+	info, _ = os.Stat(path)
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	s, err = OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if v, _ := s.Get([]byte("k1")); string(v) != "v1" {
+		t.Fatalf("expected first batch only, k1=%q", v)
+	}
+	if ok, _ := s.Has([]byte("k2")); ok {
+		t.Fatalf("partial batch must not be visible")
+	}
+	s.Close()
+	if info, _ := os.Stat(path); info.Size() != good {
+		t.Fatalf("torn tail not trimmed: size %d want %d", info.Size(), good)
+	}
+}
+
+func TestFileStateStoreCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, _ := OpenFileStateStore(path)
+	for _, k := range []string{"a", "b"} {
+		b := NewStateBatch()
+		b.Set([]byte(k), []byte("value-"+k))
+		s.Write(b)
+	}
+	s.Close()
+	data, _ := os.ReadFile(path)
+	data[len(fileStateMagic)+fileStateHeaderSize+2] ^= 0xff
+	os.WriteFile(path, data, 0o600)
+	if _, err := OpenFileStateStore(path); !errors.Is(err, ErrStateStoreCorrupt) {
+		t.Fatalf("expected ErrStateStoreCorrupt got %v", err)
+	}
+}
+
+func TestFileStateStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, _ := OpenFileStateStore(path)
+	for i := 0; i < 50; i++ {
+		b := NewStateBatch()
+		b.Set([]byte("counter"), []byte{byte(i)})
+		b.Set([]byte("gone"), []byte("x"))
+		b.Delete([]byte("gone"))
+		s.Write(b)
+	}
+	before, _ := os.Stat(path)
+	if err := s.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Fatalf("compaction did not shrink log: %d -> %d", before.Size(), after.Size())
+	}
+	b := NewStateBatch()
+	b.Set([]byte("new"), []byte("y"))
+	if err := s.Write(b); err != nil {
+		t.Fatalf("write after compact: %v", err)
+	}
+	s.Close()
+	s, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	got := collectKeys(s.Iterate(nil))
+	if len(got) != 2 || got[0] != "counter=\x31" || got[1] != "new=y" {
+		t.Fatalf("unexpected state after compact: %q", got)
+	}
+}
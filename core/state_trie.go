@@ -0,0 +1,513 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The ledger commits to its state with a compact sparse Merkle trie. Every
+// leaf is addressed by the SHA-256 of a label such as "acct:<address>", and a
+// subtree holding a single leaf is represented by that leaf directly, so the
+// depth of the trie grows with log2 of the number of leaves rather than 256.
+// Nodes are content addressed and kept in the state store, which means the
+// root of any past height can still be walked as long as its nodes are kept.
+//
+//	empty    = 32 zero bytes
+//	leaf     = sha256(0x00 || key || valueHash)
+//	internal = sha256(0x01 || left || right)
+
+const (
+	keyTrieNodePrefix = "trie/"
+	keyMetaStateRoot  = "meta/state-root"
+
+	trieLeafTag     = 0x00
+	trieInternalTag = 0x01
+	trieHashLen     = sha256.Size
+	trieMaxDepth    = trieHashLen * 8
+)
+
+var (
+	// ErrStateRootMismatch is returned when a block's declared state root does
+	// not match the state produced by executing it.
+	ErrStateRootMismatch = errors.New("state root mismatch")
+	// ErrInvalidProof is returned when a state proof does not verify against
+	// the supplied root.
+	ErrInvalidProof = errors.New("invalid state proof")
+)
+
+type trieHash [trieHashLen]byte
+
+var emptyTrieHash trieHash
+
+// EmptyStateRoot is the state root of a ledger holding no state.
+var EmptyStateRoot = hex.EncodeToString(emptyTrieHash[:])
+
+func trieKey(label string) trieHash { return sha256.Sum256([]byte(label)) }
+
+func trieBit(k trieHash, depth int) byte { return (k[depth/8] >> (7 - uint(depth%8))) & 1 }
+
+func trieLeafHash(k, v trieHash) trieHash {
+	return sha256.Sum256(append(append([]byte{trieLeafTag}, k[:]...), v[:]...))
+}
+
+func trieInternalHash(l, r trieHash) trieHash {
+	return sha256.Sum256(append(append([]byte{trieInternalTag}, l[:]...), r[:]...))
+}
+
+// trieNode is a decoded trie node. For leaves a and b hold the key and value
+// hash, for internal nodes the left and right child hashes.
+type trieNode struct {
+	leaf bool
+	a, b trieHash
+}
+
+func (n trieNode) hash() trieHash {
+	if n.leaf {
+		return trieLeafHash(n.a, n.b)
+	}
+	return trieInternalHash(n.a, n.b)
+}
+
+func (n trieNode) encode() []byte {
+	tag := byte(trieInternalTag)
+	if n.leaf {
+		tag = trieLeafTag
+	}
+	return append(append([]byte{tag}, n.a[:]...), n.b[:]...)
+}
+
+func decodeTrieNode(b []byte) (trieNode, error) {
+	if len(b) != 1+2*trieHashLen || (b[0] != trieLeafTag && b[0] != trieInternalTag) {
+		return trieNode{}, fmt.Errorf("%w: malformed trie node", ErrStateStoreCorrupt)
+	}
+	var n trieNode
+	n.leaf = b[0] == trieLeafTag
+	copy(n.a[:], b[1:1+trieHashLen])
+	copy(n.b[:], b[1+trieHashLen:])
+	return n, nil
+}
+
+func (l *Ledger) trieNodeLocked(h trieHash) (trieNode, error) {
+	v, ok := l.getLocked(keyTrieNodePrefix + hex.EncodeToString(h[:]))
+	if !ok {
+		return trieNode{}, fmt.Errorf("%w: trie node %x missing", ErrStateStoreCorrupt, h)
+	}
+	return decodeTrieNode(v)
+}
+
+func (l *Ledger) putTrieNodeLocked(n trieNode) trieHash {
+	h := n.hash()
+	l.setLocked(keyTrieNodePrefix+hex.EncodeToString(h[:]), n.encode())
+	return h
+}
+
+// trieUpdateLocked sets key to value beneath the subtree rooted at h, or
+// removes it when value is nil, and returns the new subtree hash. Subtrees left
+// with a single leaf collapse into that leaf so the trie stays canonical.
+func (l *Ledger) trieUpdateLocked(h trieHash, depth int, key trieHash, value *trieHash) (trieHash, error) {
+	if h == emptyTrieHash {
+		if value == nil {
+			return emptyTrieHash, nil
+		}
+		return l.putTrieNodeLocked(trieNode{leaf: true, a: key, b: *value}), nil
+	}
+	n, err := l.trieNodeLocked(h)
+	if err != nil {
+		return h, err
+	}
+	if n.leaf {
+		switch {
+		case n.a == key && value == nil:
+			return emptyTrieHash, nil
+		case n.a == key:
+			return l.putTrieNodeLocked(trieNode{leaf: true, a: key, b: *value}), nil
+		case value == nil:
+			return h, nil
+		}
+		added := l.putTrieNodeLocked(trieNode{leaf: true, a: key, b: *value})
+		return l.trieSplitLocked(depth, n.a, h, key, added)
+	}
+	left, right := n.a, n.b
+	if trieBit(key, depth) == 0 {
+		left, err = l.trieUpdateLocked(left, depth+1, key, value)
+	} else {
+		right, err = l.trieUpdateLocked(right, depth+1, key, value)
+	}
+	if err != nil {
+		return h, err
+	}
+	switch {
+	case left == emptyTrieHash && right == emptyTrieHash:
+		return emptyTrieHash, nil
+	case left == emptyTrieHash || right == emptyTrieHash:
+		child := left
+		if child == emptyTrieHash {
+			child = right
+		}
+		cn, err := l.trieNodeLocked(child)
+		if err != nil {
+			return h, err
+		}
+		if cn.leaf {
+			return child, nil
+		}
+	}
+	return l.putTrieNodeLocked(trieNode{a: left, b: right}), nil
+}
+
+// trieSplitLocked builds the internal nodes separating two leaves whose keys
+// share a prefix of at least depth bits.
+func (l *Ledger) trieSplitLocked(depth int, ka, ha, kb, hb trieHash) (trieHash, error) {
+	if depth >= trieMaxDepth {
+		return emptyTrieHash, fmt.Errorf("%w: duplicate trie key", ErrStateStoreCorrupt)
+	}
+	ba, bb := trieBit(ka, depth), trieBit(kb, depth)
+	if ba != bb {
+		if ba == 0 {
+			return l.putTrieNodeLocked(trieNode{a: ha, b: hb}), nil
+		}
+		return l.putTrieNodeLocked(trieNode{a: hb, b: ha}), nil
+	}
+	child, err := l.trieSplitLocked(depth+1, ka, ha, kb, hb)
+	if err != nil {
+		return emptyTrieHash, err
+	}
+	if ba == 0 {
+		return l.putTrieNodeLocked(trieNode{a: child, b: emptyTrieHash}), nil
+	}
+	return l.putTrieNodeLocked(trieNode{a: emptyTrieHash, b: child}), nil
+}
+
+func (l *Ledger) stateRootHashLocked() trieHash {
+	var h trieHash
+	if v, ok := l.getLocked(keyMetaStateRoot); ok && len(v) == trieHashLen {
+		copy(h[:], v)
+	}
+	return h
+}
+
+// markDirtyLocked records that the trie leaf derived from a state key needs
+// recomputing. Keys outside the committed namespaces are ignored.
+func (l *Ledger) markDirtyLocked(key string) {
+	var label string
+	switch {
+	case strings.HasPrefix(key, keyBalancePrefix):
+		label = "acct:" + strings.TrimPrefix(key, keyBalancePrefix)
+	case strings.HasPrefix(key, keyFrozenPrefix):
+		label = "acct:" + strings.TrimPrefix(key, keyFrozenPrefix)
+	case strings.HasPrefix(key, keyNoncePrefix):
+		label = "acct:" + strings.TrimPrefix(key, keyNoncePrefix)
+	case strings.HasPrefix(key, keyPubKeyPrefix):
+		label = "pubkey:" + strings.TrimPrefix(key, keyPubKeyPrefix)
+	case strings.HasPrefix(key, keyContractPrefix):
+		label = "contract:" + strings.TrimPrefix(key, keyContractPrefix)
+	case strings.HasPrefix(key, keyKVPrefix):
+		label = "kv:" + strings.TrimPrefix(key, keyKVPrefix)
+	case strings.HasPrefix(key, keyContractStoragePrefix):
+		label = "cstore:" + strings.TrimPrefix(key, keyContractStoragePrefix)
+	case strings.HasPrefix(key, keyStakePrefix):
+		label = "stake:" + strings.TrimPrefix(key, keyStakePrefix)
+	case strings.HasPrefix(key, keyBeaconPrefix):
+		label = "beacon:" + strings.TrimPrefix(key, keyBeaconPrefix)
+	case strings.HasPrefix(key, keyEvidencePrefix):
+		label = "evidence:" + strings.TrimPrefix(key, keyEvidencePrefix)
+	case strings.HasPrefix(key, keyLivenessPrefix):
+		label = "liveness:" + strings.TrimPrefix(key, keyLivenessPrefix)
+	case strings.HasPrefix(key, keyValSetPrefix):
+		label = "valset:" + strings.TrimPrefix(key, keyValSetPrefix)
+	default:
+		return
+	}
+	if l.dirty == nil {
+		l.dirty = make(map[string]struct{})
+	}
+	l.dirty[label] = struct{}{}
+}
+
+// trieValueLocked returns the value hash committed for a leaf label, or nil
+// when the underlying state is absent.
+func (l *Ledger) trieValueLocked(label string) *trieHash {
+	var raw []byte
+	switch {
+	case strings.HasPrefix(label, "acct:"):
+		acct := l.accountLocked(strings.TrimPrefix(label, "acct:"))
+		if acct.isZero() {
+			return nil
+		}
+		raw = acct.encode()
+	case strings.HasPrefix(label, "contract:"):
+		v, ok := l.getLocked(keyContractPrefix + strings.TrimPrefix(label, "contract:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "pubkey:"):
+		v, ok := l.getLocked(keyPubKeyPrefix + strings.TrimPrefix(label, "pubkey:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "kv:"):
+		v, ok := l.getLocked(keyKVPrefix + strings.TrimPrefix(label, "kv:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "cstore:"):
+		v, ok := l.getLocked(keyContractStoragePrefix + strings.TrimPrefix(label, "cstore:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "stake:"):
+		v, ok := l.getLocked(keyStakePrefix + strings.TrimPrefix(label, "stake:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "beacon:"):
+		v, ok := l.getLocked(keyBeaconPrefix + strings.TrimPrefix(label, "beacon:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "evidence:"):
+		v, ok := l.getLocked(keyEvidencePrefix + strings.TrimPrefix(label, "evidence:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "liveness:"):
+		v, ok := l.getLocked(keyLivenessPrefix + strings.TrimPrefix(label, "liveness:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	case strings.HasPrefix(label, "valset:"):
+		v, ok := l.getLocked(keyValSetPrefix + strings.TrimPrefix(label, "valset:"))
+		if !ok {
+			return nil
+		}
+		raw = v
+	}
+	h := trieHash(sha256.Sum256(raw))
+	return &h
+}
+
+// updateStateRootLocked folds every dirty leaf into the trie, stages the new
+// root in the pending batch and returns it.
+func (l *Ledger) updateStateRootLocked() (trieHash, error) {
+	root := l.stateRootHashLocked()
+	if len(l.dirty) == 0 {
+		return root, nil
+	}
+	labels := make([]string, 0, len(l.dirty))
+	for label := range l.dirty {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		var err error
+		root, err = l.trieUpdateLocked(root, 0, trieKey(label), l.trieValueLocked(label))
+		if err != nil {
+			return root, err
+		}
+	}
+	l.setLocked(keyMetaStateRoot, root[:])
+	clear(l.dirty)
+	return root, nil
+}
+
+// AccountState is the per-account data committed to by the state root.
+type AccountState struct {
+	Balance uint64 `json:"balance"`
+	Frozen  uint64 `json:"frozen"`
+	Nonce   uint64 `json:"nonce"`
+}
+
+func (a AccountState) isZero() bool { return a == AccountState{} }
+
+// encode returns the canonical byte form hashed into the trie.
+func (a AccountState) encode() []byte {
+	b := binary.BigEndian.AppendUint64(nil, a.Balance)
+	b = binary.BigEndian.AppendUint64(b, a.Frozen)
+	return binary.BigEndian.AppendUint64(b, a.Nonce)
+}
+
+func (l *Ledger) accountLocked(addr string) AccountState {
+	return AccountState{Balance: l.balanceLocked(addr), Frozen: l.frozenLocked(addr), Nonce: l.nonceLocked(addr)}
+}
+
+// StateProof proves the presence or absence of a leaf in the state trie.
+// Siblings run from the root downwards. For an absent key the proof ends
+// either in an empty subtree or in another leaf, given by LeafKey and
+// LeafValue, that occupies the position the key would take.
+type StateProof struct {
+	Siblings  []string `json:"siblings"`
+	LeafKey   string   `json:"leaf_key,omitempty"`
+	LeafValue string   `json:"leaf_value,omitempty"`
+}
+
+// AccountProof is a light-client proof of an account's state at a root.
+type AccountProof struct {
+	Address string       `json:"address"`
+	Account AccountState `json:"account"`
+	Root    string       `json:"root"`
+	Proof   StateProof   `json:"proof"`
+}
+
+// StateRoot returns the hex encoded root of the state trie.
+func (l *Ledger) StateRoot() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	root := l.stateRootHashLocked()
+	return hex.EncodeToString(root[:])
+}
+
+// ComputeStateRoot returns the state root that applying b on top of the
+// current state would produce, without modifying the ledger. Block producers
+// use it to fill in Block.StateRoot before sealing a block.
+func (l *Ledger) ComputeStateRoot(b *Block) (string, error) {
+	if b == nil {
+		return "", ErrNilBlock
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.discardLocked()
+	l.executeBlockLocked(b)
+	root, err := l.updateStateRootLocked()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(root[:]), nil
+}
+
+// ProveAccount returns a proof of addr's current account state against the
+// current state root. Accounts that were never funded yield a proof of
+// absence with a zero AccountState.
+func (l *Ledger) ProveAccount(addr string) (*AccountProof, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	root := l.stateRootHashLocked()
+	proof, err := l.proveLocked(root, trieKey("acct:"+addr))
+	if err != nil {
+		return nil, err
+	}
+	return &AccountProof{
+		Address: addr,
+		Account: l.accountLocked(addr),
+		Root:    hex.EncodeToString(root[:]),
+		Proof:   proof,
+	}, nil
+}
+
+func (l *Ledger) proveLocked(root, key trieHash) (StateProof, error) {
+	proof := StateProof{Siblings: []string{}}
+	h := root
+	for depth := 0; h != emptyTrieHash; depth++ {
+		n, err := l.trieNodeLocked(h)
+		if err != nil {
+			return proof, err
+		}
+		if n.leaf {
+			proof.LeafKey = hex.EncodeToString(n.a[:])
+			proof.LeafValue = hex.EncodeToString(n.b[:])
+			break
+		}
+		if trieBit(key, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, hex.EncodeToString(n.b[:]))
+			h = n.a
+		} else {
+			proof.Siblings = append(proof.Siblings, hex.EncodeToString(n.a[:]))
+			h = n.b
+		}
+	}
+	return proof, nil
+}
+
+// VerifyAccountProof checks that p proves its account state against root. A
+// zero account must be proven absent from the trie.
+func VerifyAccountProof(root string, p *AccountProof) error {
+	if p == nil {
+		return ErrInvalidProof
+	}
+	var value *trieHash
+	if !p.Account.isZero() {
+		h := trieHash(sha256.Sum256(p.Account.encode()))
+		value = &h
+	}
+	return verifyStateProof(root, trieKey("acct:"+p.Address), value, p.Proof)
+}
+
+func decodeTrieHash(s string) (trieHash, error) {
+	var h trieHash
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != trieHashLen {
+		return h, ErrInvalidProof
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+func verifyStateProof(root string, key trieHash, value *trieHash, p StateProof) error {
+	want, err := decodeTrieHash(root)
+	if err != nil {
+		return err
+	}
+	depth := len(p.Siblings)
+	if depth > trieMaxDepth {
+		return ErrInvalidProof
+	}
+	var h trieHash
+	switch {
+	case p.LeafKey == "":
+		if value != nil {
+			return fmt.Errorf("%w: leaf missing", ErrInvalidProof)
+		}
+	default:
+		lk, err := decodeTrieHash(p.LeafKey)
+		if err != nil {
+			return err
+		}
+		lv, err := decodeTrieHash(p.LeafValue)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			if lk != key || lv != *value {
+				return fmt.Errorf("%w: leaf does not match", ErrInvalidProof)
+			}
+		} else {
+			if lk == key {
+				return fmt.Errorf("%w: key is present", ErrInvalidProof)
+			}
+			for i := 0; i < depth; i++ {
+				if trieBit(lk, i) != trieBit(key, i) {
+					return fmt.Errorf("%w: leaf off path", ErrInvalidProof)
+				}
+			}
+		}
+		h = trieLeafHash(lk, lv)
+	}
+	for i := depth - 1; i >= 0; i-- {
+		sib, err := decodeTrieHash(p.Siblings[i])
+		if err != nil {
+			return err
+		}
+		if trieBit(key, i) == 0 {
+			h = trieInternalHash(h, sib)
+		} else {
+			h = trieInternalHash(sib, h)
+		}
+	}
+	if !bytes.Equal(h[:], want[:]) {
+		return fmt.Errorf("%w: root mismatch", ErrInvalidProof)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStateRootIsCanonical(t *testing.T) {
+	a := NewLedger()
+	if a.StateRoot() != EmptyStateRoot {
+		t.Fatalf("expected empty root")
+	}
+	for i := 0; i < 200; i++ {
+		a.Credit(fmt.Sprintf("acct-%d", i), uint64(i+1))
+	}
+	for i := 0; i < 200; i += 2 {
+		if err := a.StateRW().Transfer(Address(fmt.Sprintf("acct-%d", i)), "sink", uint64(i+1)); err != nil {
+			t.Fatalf("transfer: %v", err)
+		}
+	}
+
+	// the same final state built in a different order must share the root
+	b := NewLedger()
+	b.Credit("sink", 100*100)
+	for i := 199; i >= 0; i-- {
+		if i%2 == 1 {
+			b.Credit(fmt.Sprintf("acct-%d", i), uint64(i+1))
+		}
+	}
+	if a.StateRoot() != b.StateRoot() {
+		t.Fatalf("roots differ for identical state")
+	}
+	b.Credit("sink", 1)
+	if a.StateRoot() == b.StateRoot() {
+		t.Fatalf("root did not change with state")
+	}
+}
+
+func TestAccountProof(t *testing.T) {
+	l := NewLedger()
+	for i := 0; i < 50; i++ {
+		l.Credit(fmt.Sprintf("acct-%d", i), 10)
+	}
+	p, err := l.ProveAccount("acct-7")
+	if err != nil {
+		t.Fatalf("prove: %v", err)
+	}
+	if p.Account.Balance != 10 || p.Root != l.StateRoot() {
+		t.Fatalf("unexpected proof: %+v", p)
+	}
+	if err := VerifyAccountProof(l.StateRoot(), p); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	p.Account.Balance = 11
+	if err := VerifyAccountProof(l.StateRoot(), p); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected forged balance to fail, got %v", err)
+	}
+
+	absent, err := l.ProveAccount("nobody")
+	if err != nil {
+		t.Fatalf("prove absent: %v", err)
+	}
+	if err := VerifyAccountProof(l.StateRoot(), absent); err != nil {
+		t.Fatalf("verify absent: %v", err)
+	}
+	absent.Account.Balance = 5
+	if err := VerifyAccountProof(l.StateRoot(), absent); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected absence proof to reject balance, got %v", err)
+	}
+	if err := VerifyAccountProof(EmptyStateRoot, p); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected wrong root to fail, got %v", err)
+	}
+}
+
+func TestLedgerChecksBlockStateRoot(t *testing.T) {
+	alice := testWallet(t, "alice")
+	l := NewLedger()
+	l.Credit(alice.Address, 50)
+	tx := signedTestTx(t, alice, "bob", 20, 0, 0)
+	blk := &Block{Hash: "h1", SubBlocks: []*SubBlock{{Transactions: []*Transaction{tx}}}}
+	before := l.StateRoot()
+	blk.StateRoot = before
+	if err := l.AddBlock(blk); !errors.Is(err, ErrStateRootMismatch) {
+		t.Fatalf("expected ErrStateRootMismatch got %v", err)
+	}
+	if l.GetBalance("bob") != 0 || l.StateRoot() != before {
+		t.Fatalf("rejected block modified state")
+	}
+	root, err := l.ComputeStateRoot(blk)
+	if err != nil {
+		t.Fatalf("compute: %v", err)
+	}
+	if l.StateRoot() != before {
+		t.Fatalf("ComputeStateRoot modified state")
+	}
+	blk.StateRoot = root
+	if err := l.AddBlock(blk); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	if l.StateRoot() != root || l.GetBalance("bob") != 20 {
+		t.Fatalf("unexpected state after block")
+	}
+}
+
+func TestTxMerkleRoot(t *testing.T) {
+	txs := []*Transaction{
+		NewTransaction("a", "b", 1, 0, 0),
+		NewTransaction("a", "b", 2, 0, 1),
+		NewTransaction("a", "b", 3, 0, 2),
+	}
+	root := TxMerkleRoot(txs)
+	if TxMerkleRoot(txs[:2]) == root || TxMerkleRoot([]*Transaction{txs[1], txs[0], txs[2]}) == root {
+		t.Fatalf("root must commit to the exact transaction list")
+	}
+	if TxMerkleRoot(nil) != EmptyStateRoot {
+		t.Fatalf("unexpected empty root")
+	}
+	txs[2].Amount = 4
+	if TxMerkleRoot(txs) == root {
+		t.Fatalf("root must commit to transaction contents")
+	}
+	if len(root) != 64 {
+		t.Fatalf("root should be 32 hex encoded bytes: %s", root)
+	}
+}
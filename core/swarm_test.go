@@ -4,8 +4,9 @@ import "testing"
 
 // TestSwarmBroadcast ensures transactions are broadcast to all swarm members.
 func TestSwarmBroadcast(t *testing.T) {
+	alice := testWallet(t, "alice")
 	ledger := NewLedger()
-	ledger.Credit("alice", 100)
+	ledger.Credit(alice.Address, 100)
 
 	n1 := NewNode("n1", "addr1", ledger)
 	n2 := NewNode("n2", "addr2", ledger)
@@ -14,10 +15,10 @@ func TestSwarmBroadcast(t *testing.T) {
 	s.Join(n1)
 	s.Join(n2)
 
-	tx := NewTransaction("alice", "bob", 1, 1, 1)
+	tx := signedTestTx(t, alice, "bob", 1, 1, 0)
 	s.Broadcast(tx)
 
-	if len(n1.Mempool) != 1 || len(n2.Mempool) != 1 {
+	if n1.Mempool.Len() != 1 || n2.Mempool.Len() != 1 {
 		t.Fatalf("transaction was not broadcast to all nodes")
 	}
 }
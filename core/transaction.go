@@ -3,9 +3,10 @@ package core
 import (
 	"crypto/ecdsa"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"time"
 )
 
@@ -15,15 +16,26 @@ import (
 // another.  They include a fee and timestamp so that they can be ordered
 // deterministically by the consensus engine.
 type Transaction struct {
-	ID        string
-	From      string
-	To        string
-	Amount    uint64
-	Fee       uint64
+	ID     string
+	From   string
+	To     string
+	Amount uint64
+	Fee    uint64
+	// MaxFee and Tip price the transaction per unit of gas under a fee
+	// market: it pays the block's base fee plus up to Tip, and never more
+	// than MaxFee. A transaction without a MaxFee pays its flat Fee instead.
+	MaxFee    uint64 `json:",omitempty"`
+	Tip       uint64 `json:",omitempty"`
 	Nonce     uint64
 	Timestamp int64
 	Signature []byte
+	// PublicKey optionally carries the sender's encoded public key. The ledger
+	// registers it on the sender's first transaction if it hashes to From, and
+	// ignores it afterwards. It is not covered by the signature.
+	PublicKey []byte
 	Type      TransactionType
+	// Source is the validator a redelegation moves stake away from.
+	Source string `json:",omitempty"`
 	// BiometricHash stores the hash of the biometric data used to
 	// authorize this transaction. It ensures that the transaction is tied
 	// to a verified identity when biometric authentication is required.
@@ -53,24 +65,114 @@ func NewTransaction(from, to string, amount, fee, nonce uint64) *Transaction {
 	return tx
 }
 
+// NewDynamicFeeTransaction creates an unsigned transfer priced per unit of
+// gas with a fee cap and priority tip rather than a flat fee.
+func NewDynamicFeeTransaction(from, to string, amount, maxFee, tip, nonce uint64) *Transaction {
+	tx := NewTransaction(from, to, amount, 0, nonce)
+	tx.MaxFee, tx.Tip = maxFee, tip
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// NewBondTransaction creates an unsigned transaction bonding amount of the
+// sender's balance as stake of validator. Bonding to another validator
+// delegates to it.
+func NewBondTransaction(from, validator string, amount, fee, nonce uint64) *Transaction {
+	tx := NewTransaction(from, validator, amount, fee, nonce)
+	tx.Type = TxTypeBond
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// NewUnbondTransaction creates an unsigned transaction unbonding amount of the
+// stake the sender bonded to validator. The stake returns to the sender's
+// balance after the ledger's unbonding period.
+func NewUnbondTransaction(from, validator string, amount, fee, nonce uint64) *Transaction {
+	tx := NewTransaction(from, validator, amount, fee, nonce)
+	tx.Type = TxTypeUnbond
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// NewRedelegateTransaction creates an unsigned transaction moving amount of
+// the stake the sender bonded to src over to dst without unbonding it.
+func NewRedelegateTransaction(from, src, dst string, amount, fee, nonce uint64) *Transaction {
+	tx := NewTransaction(from, dst, amount, fee, nonce)
+	tx.Type, tx.Source = TxTypeRedelegate, src
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// NewWithdrawRewardsTransaction creates an unsigned transaction paying out
+// the rewards the sender's stake with validator has earned.
+func NewWithdrawRewardsTransaction(from, validator string, fee, nonce uint64) *Transaction {
+	tx := NewTransaction(from, validator, 0, fee, nonce)
+	tx.Type = TxTypeWithdrawRewards
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// NewCommissionTransaction creates an unsigned transaction setting the share
+// of its rewards validator keeps, in basis points of MaxCommission.
+func NewCommissionTransaction(validator string, rate, fee, nonce uint64) *Transaction {
+	tx := NewTransaction(validator, validator, rate, fee, nonce)
+	tx.Type = TxTypeCommission
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// Debit returns what the transaction takes from the sender's balance besides
+// its fees: the amount of transfers and bonds. Other staking transactions
+// move stake or rewards rather than balance.
+func (t *Transaction) Debit() uint64 {
+	switch t.Type {
+	case TxTypeUnbond, TxTypeRedelegate, TxTypeWithdrawRewards, TxTypeCommission:
+		return 0
+	default:
+		return t.Amount
+	}
+}
+
 // Hash returns the hex-encoded hash of the transaction contents excluding the
-// signature.  It is used as the message for signing and verification.
+// signature and public key.  It is used as the message for signing and
+// verification.  Every field is encoded unambiguously: integers at a fixed
+// width and strings, byte slices and the program with their length, so no two
+// different transactions share a signing message.
 func (t *Transaction) Hash() string {
-	bio := hex.EncodeToString(t.BiometricHash)
-	h := sha256.Sum256([]byte(fmt.Sprintf(
-		"%s%s%d%d%d%d%d%s",
-		t.From,
-		t.To,
-		t.Amount,
-		t.Fee,
-		t.Nonce,
-		t.Timestamp,
-		t.Type,
-		bio,
-	)))
+	buf := []byte("synnergy/tx\x00")
+	buf = appendHashField(buf, []byte(t.From))
+	buf = appendHashField(buf, []byte(t.To))
+	for _, v := range []uint64{t.Amount, t.Fee, t.MaxFee, t.Tip, t.Nonce, uint64(t.Timestamp), uint64(t.Type)} {
+		buf = binary.BigEndian.AppendUint64(buf, v)
+	}
+	buf = appendHashField(buf, []byte(t.Source))
+	buf = appendHashField(buf, t.BiometricHash)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(t.Program)))
+	for _, ins := range t.Program {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(ins.Op))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(ins.Value))
+	}
+	h := sha256.Sum256(buf)
 	return hex.EncodeToString(h[:])
 }
 
+// appendHashField appends b to buf prefixed with its length.
+func appendHashField(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// Size returns the length in bytes of the transaction's JSON encoding, the
+// form in which it is gossiped and stored in blocks. The mempool prices block
+// space per byte of this encoding.
+func (t *Transaction) Size() uint64 {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return 0
+	}
+	return uint64(len(b))
+}
+
 // Verify checks the transaction's signature against the provided public key.
 func (t *Transaction) Verify(pub *ecdsa.PublicKey) bool {
 	return VerifySignature(t, t.Signature, pub)
@@ -40,15 +40,45 @@ func CancelTransaction(st *ScheduledTransaction) bool {
 func ReverseTransaction(l *Ledger, tx *Transaction) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if err := l.reverseTransactionLocked(tx); err != nil {
+		l.discardLocked()
+		return err
+	}
+	return l.commitLocked(walRecord{Kind: walKindReverse, Tx: tx})
+}
+
+func (l *Ledger) reverseTransactionLocked(tx *Transaction) error {
+	if tx == nil {
+		return ErrNilTransaction
+	}
 	total := tx.Amount + tx.Fee
-	if l.balances[tx.To] < tx.Amount {
+	toBal := l.balanceLocked(tx.To)
+	if toBal < tx.Amount {
 		return errors.New("insufficient recipient funds")
 	}
-	l.balances[tx.To] -= tx.Amount
-	l.balances[tx.From] += total
+	l.setBalanceLocked(tx.To, toBal-tx.Amount)
+	l.setBalanceLocked(tx.From, l.balanceLocked(tx.From)+total)
 	return nil
 }
 
+// freezeLocked moves funds from an address's spendable balance into its frozen
+// balance.
+func (l *Ledger) freezeLocked(addr string, amount uint64) error {
+	bal := l.balanceLocked(addr)
+	if bal < amount {
+		return errors.New("insufficient funds to freeze for reversal")
+	}
+	l.setBalanceLocked(addr, bal-amount)
+	l.setFrozenLocked(addr, l.frozenLocked(addr)+amount)
+	return nil
+}
+
+// releaseLocked returns frozen funds to an address's spendable balance.
+func (l *Ledger) releaseLocked(addr string, amount uint64) {
+	l.setBalanceLocked(addr, l.balanceLocked(addr)+amount)
+	l.setFrozenLocked(addr, l.frozenLocked(addr)-amount)
+}
+
 // ReversalRequest tracks an authority-mediated transaction reversal.
 type ReversalRequest struct {
 	Tx          *Transaction
@@ -63,11 +93,13 @@ func RequestReversal(l *Ledger, tx *Transaction, fee uint64) (*ReversalRequest,
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	total := tx.Amount + fee
-	if l.balances[tx.To] < total {
-		return nil, errors.New("insufficient funds to freeze for reversal")
+	if err := l.freezeLocked(tx.To, total); err != nil {
+		l.discardLocked()
+		return nil, err
+	}
+	if err := l.commitLocked(walRecord{Kind: walKindFreeze, Addr: tx.To, Amount: total}); err != nil {
+		return nil, err
 	}
-	l.balances[tx.To] -= total
-	l.frozen[tx.To] += total
 	return &ReversalRequest{Tx: tx, RequestedAt: time.Now(), Fee: fee, votes: make(map[string]bool)}, nil
 }
 
@@ -95,22 +127,21 @@ func FinalizeReversal(l *Ledger, r *ReversalRequest, required int) error {
 		RejectReversal(l, r)
 		return errors.New("reversal request expired")
 	}
-	total := r.Tx.Amount + r.Fee
-	l.mu.Lock()
-	l.balances[r.Tx.To] += total
-	l.frozen[r.Tx.To] -= total
-	l.mu.Unlock()
-	revTx := NewTransaction(r.Tx.To, r.Tx.From, r.Tx.Amount, r.Fee, 0)
-	return l.ApplyTransaction(revTx)
+	releaseReversal(l, r)
+	return l.Transfer(r.Tx.To, r.Tx.From, r.Tx.Amount, r.Fee)
 }
 
 // RejectReversal releases frozen funds when a reversal request fails.
 func RejectReversal(l *Ledger, r *ReversalRequest) {
+	releaseReversal(l, r)
+}
+
+func releaseReversal(l *Ledger, r *ReversalRequest) {
 	total := r.Tx.Amount + r.Fee
 	l.mu.Lock()
-	l.balances[r.Tx.To] += total
-	l.frozen[r.Tx.To] -= total
-	l.mu.Unlock()
+	defer l.mu.Unlock()
+	l.releaseLocked(r.Tx.To, total)
+	_ = l.commitLocked(walRecord{Kind: walKindRelease, Addr: r.Tx.To, Amount: total})
 }
 
 // ConvertToPrivate encrypts the transaction using AES-GCM with the provided key.
@@ -157,12 +188,20 @@ func (pt *PrivateTransaction) Decrypt(key []byte) (*Transaction, error) {
 	return &tx, nil
 }
 
-// Receipt captures the outcome of a transaction.
+// Receipt captures the outcome of a transaction. Receipts recorded by the
+// ledger also place the transaction in the chain and carry the gas, return
+// data and ordered event logs of contract invocations.
 type Receipt struct {
-	TxID      string
-	Status    string
-	Timestamp int64
-	Details   string
+	TxID            string        `json:"tx_id"`
+	Status          string        `json:"status"`
+	Timestamp       int64         `json:"timestamp"`
+	Details         string        `json:"details,omitempty"`
+	BlockHeight     int           `json:"block_height,omitempty"`
+	Index           int           `json:"index"`
+	GasUsed         uint64        `json:"gas_used,omitempty"`
+	ContractAddress string        `json:"contract_address,omitempty"`
+	ReturnData      []byte        `json:"return_data,omitempty"`
+	Logs            []ContractLog `json:"logs,omitempty"`
 }
 
 // GenerateReceipt creates a receipt for the given transaction ID and status.
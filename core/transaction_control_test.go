@@ -18,24 +18,26 @@ func TestScheduleAndCancel(t *testing.T) {
 }
 
 func TestReverseTransaction(t *testing.T) {
+	a := testWallet(t, "a")
 	l := NewLedger()
-	l.Credit("a", 20)
-	tx := NewTransaction("a", "b", 10, 2, 0)
+	l.Credit(a.Address, 20)
+	tx := signedTestTx(t, a, "b", 10, 2, 0)
 	if err := l.ApplyTransaction(tx); err != nil {
 		t.Fatalf("apply: %v", err)
 	}
 	if err := ReverseTransaction(l, tx); err != nil {
 		t.Fatalf("reverse: %v", err)
 	}
-	if l.GetBalance("a") != 20 || l.GetBalance("b") != 0 {
-		t.Fatalf("unexpected balances: a=%d b=%d", l.GetBalance("a"), l.GetBalance("b"))
+	if l.GetBalance(a.Address) != 20 || l.GetBalance("b") != 0 {
+		t.Fatalf("unexpected balances: a=%d b=%d", l.GetBalance(a.Address), l.GetBalance("b"))
 	}
 }
 
 func TestAuthorityMediatedReversal(t *testing.T) {
+	a := testWallet(t, "a")
 	l := NewLedger()
-	l.Credit("a", 20)
-	tx := NewTransaction("a", "b", 10, 1, 0)
+	l.Credit(a.Address, 20)
+	tx := signedTestTx(t, a, "b", 10, 1, 0)
 	if err := l.ApplyTransaction(tx); err != nil {
 		t.Fatalf("apply: %v", err)
 	}
@@ -49,15 +51,16 @@ func TestAuthorityMediatedReversal(t *testing.T) {
 	if err := FinalizeReversal(l, req, 2); err != nil {
 		t.Fatalf("finalize: %v", err)
 	}
-	if l.GetBalance("a") != 19 || l.GetBalance("b") != 0 {
-		t.Fatalf("unexpected balances: a=%d b=%d", l.GetBalance("a"), l.GetBalance("b"))
+	if l.GetBalance(a.Address) != 19 || l.GetBalance("b") != 0 {
+		t.Fatalf("unexpected balances: a=%d b=%d", l.GetBalance(a.Address), l.GetBalance("b"))
 	}
 }
 
 func TestReversalRejection(t *testing.T) {
+	a := testWallet(t, "a")
 	l := NewLedger()
-	l.Credit("a", 20)
-	tx := NewTransaction("a", "b", 10, 1, 0)
+	l.Credit(a.Address, 20)
+	tx := signedTestTx(t, a, "b", 10, 1, 0)
 	if err := l.ApplyTransaction(tx); err != nil {
 		t.Fatalf("apply: %v", err)
 	}
@@ -20,6 +20,17 @@ func TestNewTransactionAndHash(t *testing.T) {
 	if h1 != h2 {
 		t.Fatalf("expected deterministic hash")
 	}
+	// fields do not run into each other
+	a := &Transaction{From: "alice", To: "bob", Amount: 1, Fee: 23, Timestamp: 42}
+	b := &Transaction{From: "alice", To: "bob", Amount: 12, Fee: 3, Timestamp: 42}
+	c := &Transaction{From: "alic", To: "ebob", Amount: 1, Fee: 23, Timestamp: 42}
+	if a.Hash() == b.Hash() || a.Hash() == c.Hash() {
+		t.Fatalf("different transactions share a hash")
+	}
+	prog := &Transaction{From: "alice", To: "bob", Amount: 1, Fee: 23, Timestamp: 42, Program: []Instruction{{Op: OpPush, Value: 1}}}
+	if prog.Hash() == a.Hash() {
+		t.Fatalf("program not covered by the hash")
+	}
 }
 
 func TestAttachBiometric(t *testing.T) {
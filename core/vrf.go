@@ -0,0 +1,167 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+)
+
+// Validators prove their right to propose with a verifiable random function
+// over their wallet key. The VRF follows ECVRF-P256-SHA256-TAI of RFC 9381:
+// the output is a pseudorandom function of the key and the input that only
+// the key holder can compute, and the proof lets anyone holding the public
+// key check it. Nonces are derived by hashing the key and input rather than
+// with RFC 6979; proofs verify the same either way.
+
+// VRFProofSize is the length of a VRF proof: a compressed point, a 16 byte
+// challenge and a 32 byte scalar.
+const VRFProofSize = 33 + 16 + 32
+
+const vrfSuite = 0x01
+
+// ErrInvalidVRFProof is returned for VRF proofs that do not verify.
+var ErrInvalidVRFProof = errors.New("invalid vrf proof")
+
+// VRFProve returns the VRF output of priv for alpha and the proof of it.
+func VRFProve(priv *ecdsa.PrivateKey, alpha []byte) (output, proof []byte, err error) {
+	if priv == nil || priv.D == nil {
+		return nil, nil, errors.New("private key required")
+	}
+	curve := elliptic.P256()
+	pk := elliptic.MarshalCompressed(curve, priv.PublicKey.X, priv.PublicKey.Y)
+	hx, hy, err := vrfHashToCurve(pk, alpha)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := elliptic.MarshalCompressed(curve, hx, hy)
+	gx, gy := curve.ScalarMult(hx, hy, priv.D.Bytes())
+	gamma := elliptic.MarshalCompressed(curve, gx, gy)
+	k := vrfNonce(priv.D, h)
+	ux, uy := curve.ScalarBaseMult(k.Bytes())
+	vx, vy := curve.ScalarMult(hx, hy, k.Bytes())
+	c := vrfChallenge(pk, h, gamma, elliptic.MarshalCompressed(curve, ux, uy), elliptic.MarshalCompressed(curve, vx, vy))
+	s := new(big.Int).Mul(c, priv.D)
+	s.Add(s, k).Mod(s, curve.Params().N)
+	proof = make([]byte, VRFProofSize)
+	copy(proof, gamma)
+	c.FillBytes(proof[33:49])
+	s.FillBytes(proof[49:])
+	return vrfProofToHash(gamma), proof, nil
+}
+
+// VRFVerify checks that proof is pub's VRF proof for alpha and returns the
+// output it proves.
+func VRFVerify(pub *ecdsa.PublicKey, alpha, proof []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	if pub == nil || pub.X == nil || pub.Y == nil || !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("public key invalid")
+	}
+	if len(proof) != VRFProofSize {
+		return nil, ErrInvalidVRFProof
+	}
+	gx, gy := elliptic.UnmarshalCompressed(curve, proof[:33])
+	if gx == nil {
+		return nil, ErrInvalidVRFProof
+	}
+	c := new(big.Int).SetBytes(proof[33:49])
+	s := new(big.Int).SetBytes(proof[49:])
+	if c.Sign() == 0 || s.Sign() == 0 || s.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidVRFProof
+	}
+	pk := elliptic.MarshalCompressed(curve, pub.X, pub.Y)
+	hx, hy, err := vrfHashToCurve(pk, alpha)
+	if err != nil {
+		return nil, err
+	}
+	// U = s*B - c*Y, V = s*H - c*Gamma
+	sbx, sby := curve.ScalarBaseMult(s.Bytes())
+	cyx, cyy := curve.ScalarMult(pub.X, pub.Y, c.Bytes())
+	ux, uy := curve.Add(sbx, sby, cyx, vrfNeg(cyy))
+	shx, shy := curve.ScalarMult(hx, hy, s.Bytes())
+	cgx, cgy := curve.ScalarMult(gx, gy, c.Bytes())
+	vx, vy := curve.Add(shx, shy, cgx, vrfNeg(cgy))
+	want := vrfChallenge(pk, elliptic.MarshalCompressed(curve, hx, hy), proof[:33],
+		elliptic.MarshalCompressed(curve, ux, uy), elliptic.MarshalCompressed(curve, vx, vy))
+	if want.Cmp(c) != 0 {
+		return nil, ErrInvalidVRFProof
+	}
+	return vrfProofToHash(proof[:33]), nil
+}
+
+// VRFPriority ranks a VRF output for a validator with stake. Priorities are
+// exponentially distributed with rate stake, so the lowest priority among a
+// set of validators belongs to each with probability proportional to its
+// stake.
+func VRFPriority(output []byte, stake uint64) float64 {
+	if stake == 0 || len(output) < 8 {
+		return math.Inf(1)
+	}
+	// uniform in (0, 1) from the top 53 bits
+	u := (float64(binary.BigEndian.Uint64(output)>>11) + 0.5) / (1 << 53)
+	return -math.Log(u) / float64(stake)
+}
+
+// SlotInput returns the VRF input validators prove for the block at height
+// under the epoch randomness seed.
+func SlotInput(seed []byte, height uint64) []byte {
+	in := append([]byte("synnergy/slot\x00"), seed...)
+	return binary.BigEndian.AppendUint64(in, height)
+}
+
+// vrfHashToCurve maps alpha to a curve point by try and increment.
+func vrfHashToCurve(pk, alpha []byte) (x, y *big.Int, err error) {
+	curve := elliptic.P256()
+	for ctr := 0; ctr < 256; ctr++ {
+		h := sha256.New()
+		h.Write([]byte{vrfSuite, 0x01})
+		h.Write(pk)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), 0x00})
+		if x, y = elliptic.UnmarshalCompressed(curve, append([]byte{0x02}, h.Sum(nil)...)); x != nil {
+			return x, y, nil
+		}
+	}
+	return nil, nil, errors.New("vrf input does not map to the curve")
+}
+
+func vrfNonce(d *big.Int, h []byte) *big.Int {
+	n := elliptic.P256().Params().N
+	var key [32]byte
+	d.FillBytes(key[:])
+	for ctr := byte(0); ; ctr++ {
+		sum := sha256.Sum256(append(append(append([]byte("synnergy/vrf-nonce\x00"), key[:]...), h...), ctr))
+		if k := new(big.Int).Mod(new(big.Int).SetBytes(sum[:]), n); k.Sign() != 0 {
+			return k
+		}
+	}
+}
+
+func vrfChallenge(points ...[]byte) *big.Int {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x02})
+	for _, p := range points {
+		h.Write(p)
+	}
+	h.Write([]byte{0x00})
+	return new(big.Int).SetBytes(h.Sum(nil)[:16])
+}
+
+func vrfProofToHash(gamma []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x03})
+	h.Write(gamma)
+	h.Write([]byte{0x00})
+	return h.Sum(nil)
+}
+
+// vrfNeg negates the y coordinate of a point, keeping the point at infinity.
+func vrfNeg(y *big.Int) *big.Int {
+	if y.Sign() == 0 {
+		return y
+	}
+	return new(big.Int).Sub(elliptic.P256().Params().P, y)
+}
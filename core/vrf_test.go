@@ -0,0 +1,58 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVRFProveVerify(t *testing.T) {
+	w, other := testWallet(t, "vrf"), testWallet(t, "vrf-other")
+	alpha := SlotInput([]byte("seed"), 7)
+	out, proof, err := VRFProve(w.PrivateKey, alpha)
+	if err != nil || len(out) != 32 || len(proof) != VRFProofSize {
+		t.Fatalf("prove: %x %x %v", out, proof, err)
+	}
+	got, err := VRFVerify(&w.PrivateKey.PublicKey, alpha, proof)
+	if err != nil || !bytes.Equal(got, out) {
+		t.Fatalf("verify: %x %v", got, err)
+	}
+	again, proof2, _ := VRFProve(w.PrivateKey, alpha)
+	if !bytes.Equal(again, out) || !bytes.Equal(proof2, proof) {
+		t.Fatalf("vrf is not deterministic")
+	}
+	if next, _, _ := VRFProve(w.PrivateKey, SlotInput([]byte("seed"), 8)); bytes.Equal(next, out) {
+		t.Fatalf("outputs for different slots collide")
+	}
+
+	if _, err := VRFVerify(&other.PrivateKey.PublicKey, alpha, proof); !errors.Is(err, ErrInvalidVRFProof) {
+		t.Fatalf("expected a proof under another key to fail, got %v", err)
+	}
+	if _, err := VRFVerify(&w.PrivateKey.PublicKey, SlotInput([]byte("seed"), 8), proof); !errors.Is(err, ErrInvalidVRFProof) {
+		t.Fatalf("expected a proof for another input to fail, got %v", err)
+	}
+	tampered := append([]byte(nil), proof...)
+	tampered[40] ^= 1
+	if _, err := VRFVerify(&w.PrivateKey.PublicKey, alpha, tampered); !errors.Is(err, ErrInvalidVRFProof) {
+		t.Fatalf("expected a tampered proof to fail, got %v", err)
+	}
+}
+
+func TestVRFPriorityFollowsStake(t *testing.T) {
+	out := bytes.Repeat([]byte{0x80}, 32)
+	if VRFPriority(out, 2) >= VRFPriority(out, 1) {
+		t.Fatalf("more stake should lower the priority")
+	}
+	sc := NewSynnergyConsensus()
+	a, b := testWallet(t, "a"), testWallet(t, "b")
+	wins := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		outputs := map[string][]byte{}
+		outputs["a"], _, _ = VRFProve(a.PrivateKey, SlotInput([]byte("seed"), uint64(i)))
+		outputs["b"], _, _ = VRFProve(b.PrivateKey, SlotInput([]byte("seed"), uint64(i)))
+		wins[sc.SelectValidatorVRF(outputs, map[string]uint64{"a": 3, "b": 1})]++
+	}
+	if wins["a"] < 650 || wins["a"] > 850 {
+		t.Fatalf("expected about 3:1 wins, got %v", wins)
+	}
+}
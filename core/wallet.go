@@ -61,7 +61,8 @@ func NewWalletFromSeed(seed []byte) (*Wallet, error) {
 	return &Wallet{PrivateKey: priv, PublicKey: priv.PublicKey, Address: addr}, nil
 }
 
-// Sign signs the transaction hash with the wallet's private key.
+// Sign signs the transaction hash with the wallet's private key and attaches
+// the wallet's public key so a ledger can register it on first use.
 func (w *Wallet) Sign(tx *Transaction) ([]byte, error) {
 	if w == nil || w.PrivateKey == nil {
 		return nil, errors.New("wallet private key not initialised")
@@ -80,6 +81,7 @@ func (w *Wallet) Sign(tx *Transaction) ([]byte, error) {
 	copy(sig[32-len(rb):32], rb)
 	copy(sig[64-len(sb):], sb)
 	tx.Signature = sig
+	tx.PublicKey = encodePublicKey(&w.PublicKey)
 	return sig, nil
 }
 
@@ -277,12 +279,13 @@ func encodePublicKey(pub *ecdsa.PublicKey) []byte {
 	if pub == nil || pub.X == nil || pub.Y == nil {
 		return nil
 	}
-	xb := pub.X.Bytes()
-	yb := pub.Y.Bytes()
-	out := make([]byte, 1+len(xb)+len(yb))
+	// Coordinates are left-padded to the curve size so the encoding has a fixed
+	// length and decodePublicKey can split it unambiguously.
+	size := (elliptic.P256().Params().BitSize + 7) / 8
+	out := make([]byte, 1+2*size)
 	out[0] = 0x04
-	copy(out[1:], xb)
-	copy(out[1+len(xb):], yb)
+	pub.X.FillBytes(out[1 : 1+size])
+	pub.Y.FillBytes(out[1+size:])
 	return out
 }
 
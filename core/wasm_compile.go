@@ -0,0 +1,749 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// wasmGasClass groups instructions that share a price in the gas table.
+type wasmGasClass uint8
+
+const (
+	wasmGasControl wasmGasClass = iota
+	wasmGasCall
+	wasmGasCallIndirect
+	wasmGasVariable
+	wasmGasConst
+	wasmGasLoad
+	wasmGasStore
+	wasmGasMemorySize
+	wasmGasMemoryGrow
+	wasmGasIntArith
+	wasmGasIntMul
+	wasmGasIntDiv
+	wasmGasFloatArith
+	wasmGasFloatDiv
+	wasmGasConvert
+	wasmGasClasses
+)
+
+// wasmGasNames maps each class to its entry in the opcode catalogue.
+var wasmGasNames = [wasmGasClasses]string{
+	wasmGasControl:      "WasmControl",
+	wasmGasCall:         "WasmCall",
+	wasmGasCallIndirect: "WasmCallIndirect",
+	wasmGasVariable:     "WasmVariable",
+	wasmGasConst:        "WasmConst",
+	wasmGasLoad:         "WasmLoad",
+	wasmGasStore:        "WasmStore",
+	wasmGasMemorySize:   "WasmMemorySize",
+	wasmGasMemoryGrow:   "WasmMemoryGrow",
+	wasmGasIntArith:     "WasmIntArith",
+	wasmGasIntMul:       "WasmIntMul",
+	wasmGasIntDiv:       "WasmIntDiv",
+	wasmGasFloatArith:   "WasmFloatArith",
+	wasmGasFloatDiv:     "WasmFloatDiv",
+	wasmGasConvert:      "WasmConvert",
+}
+
+// wasmMemoryPageGas names the additional price charged per page added by
+// memory.grow.
+const wasmMemoryPageGas = "WasmMemoryPage"
+
+// WebAssembly opcodes with special handling in the compiler.
+const (
+	wasmOpUnreachable  = 0x00
+	wasmOpNop          = 0x01
+	wasmOpBlock        = 0x02
+	wasmOpLoop         = 0x03
+	wasmOpIf           = 0x04
+	wasmOpElse         = 0x05
+	wasmOpEnd          = 0x0b
+	wasmOpBr           = 0x0c
+	wasmOpBrIf         = 0x0d
+	wasmOpBrTable      = 0x0e
+	wasmOpReturn       = 0x0f
+	wasmOpCall         = 0x10
+	wasmOpCallIndirect = 0x11
+	wasmOpDrop         = 0x1a
+	wasmOpSelect       = 0x1b
+	wasmOpLocalGet     = 0x20
+	wasmOpLocalSet     = 0x21
+	wasmOpLocalTee     = 0x22
+	wasmOpGlobalGet    = 0x23
+	wasmOpGlobalSet    = 0x24
+	wasmOpMemorySize   = 0x3f
+	wasmOpMemoryGrow   = 0x40
+	wasmOpI32Const     = 0x41
+	wasmOpI64Const     = 0x42
+	wasmOpF32Const     = 0x43
+	wasmOpF64Const     = 0x44
+)
+
+// wasmOpInfo describes the operand and result types of a plain instruction,
+// or the access width of a load or store.
+type wasmOpInfo struct {
+	valid  bool
+	in     []wasmValType
+	out    wasmValType
+	class  wasmGasClass
+	width  uint32 // bytes accessed by loads and stores
+	memory bool
+}
+
+var wasmOps [256]wasmOpInfo
+
+func init() {
+	i32, i64, f32, f64 := wasmI32, wasmI64, wasmF32, wasmF64
+	set := func(from, to byte, in []wasmValType, out wasmValType, class wasmGasClass) {
+		for op := int(from); op <= int(to); op++ {
+			wasmOps[op] = wasmOpInfo{valid: true, in: in, out: out, class: class}
+		}
+	}
+	mem := func(op byte, in []wasmValType, out wasmValType, width uint32, class wasmGasClass) {
+		wasmOps[op] = wasmOpInfo{valid: true, in: in, out: out, width: width, class: class, memory: true}
+	}
+	for op, width := range map[byte]uint32{0x28: 4, 0x2c: 1, 0x2d: 1, 0x2e: 2, 0x2f: 2} {
+		mem(op, []wasmValType{i32}, i32, width, wasmGasLoad)
+	}
+	for op, width := range map[byte]uint32{0x29: 8, 0x30: 1, 0x31: 1, 0x32: 2, 0x33: 2, 0x34: 4, 0x35: 4} {
+		mem(op, []wasmValType{i32}, i64, width, wasmGasLoad)
+	}
+	mem(0x2a, []wasmValType{i32}, f32, 4, wasmGasLoad)
+	mem(0x2b, []wasmValType{i32}, f64, 8, wasmGasLoad)
+	mem(0x36, []wasmValType{i32, i32}, 0, 4, wasmGasStore)
+	mem(0x37, []wasmValType{i32, i64}, 0, 8, wasmGasStore)
+	mem(0x38, []wasmValType{i32, f32}, 0, 4, wasmGasStore)
+	mem(0x39, []wasmValType{i32, f64}, 0, 8, wasmGasStore)
+	mem(0x3a, []wasmValType{i32, i32}, 0, 1, wasmGasStore)
+	mem(0x3b, []wasmValType{i32, i32}, 0, 2, wasmGasStore)
+	mem(0x3c, []wasmValType{i32, i64}, 0, 1, wasmGasStore)
+	mem(0x3d, []wasmValType{i32, i64}, 0, 2, wasmGasStore)
+	mem(0x3e, []wasmValType{i32, i64}, 0, 4, wasmGasStore)
+
+	set(0x45, 0x45, []wasmValType{i32}, i32, wasmGasIntArith)
+	set(0x46, 0x4f, []wasmValType{i32, i32}, i32, wasmGasIntArith)
+	set(0x50, 0x50, []wasmValType{i64}, i32, wasmGasIntArith)
+	set(0x51, 0x5a, []wasmValType{i64, i64}, i32, wasmGasIntArith)
+	set(0x5b, 0x60, []wasmValType{f32, f32}, i32, wasmGasFloatArith)
+	set(0x61, 0x66, []wasmValType{f64, f64}, i32, wasmGasFloatArith)
+
+	set(0x67, 0x69, []wasmValType{i32}, i32, wasmGasIntArith)
+	set(0x6a, 0x78, []wasmValType{i32, i32}, i32, wasmGasIntArith)
+	set(0x6c, 0x6c, []wasmValType{i32, i32}, i32, wasmGasIntMul)
+	set(0x6d, 0x70, []wasmValType{i32, i32}, i32, wasmGasIntDiv)
+	set(0x79, 0x7b, []wasmValType{i64}, i64, wasmGasIntArith)
+	set(0x7c, 0x8a, []wasmValType{i64, i64}, i64, wasmGasIntArith)
+	set(0x7e, 0x7e, []wasmValType{i64, i64}, i64, wasmGasIntMul)
+	set(0x7f, 0x82, []wasmValType{i64, i64}, i64, wasmGasIntDiv)
+
+	set(0x8b, 0x90, []wasmValType{f32}, f32, wasmGasFloatArith)
+	set(0x91, 0x91, []wasmValType{f32}, f32, wasmGasFloatDiv)
+	set(0x92, 0x98, []wasmValType{f32, f32}, f32, wasmGasFloatArith)
+	set(0x95, 0x95, []wasmValType{f32, f32}, f32, wasmGasFloatDiv)
+	set(0x99, 0x9e, []wasmValType{f64}, f64, wasmGasFloatArith)
+	set(0x9f, 0x9f, []wasmValType{f64}, f64, wasmGasFloatDiv)
+	set(0xa0, 0xa6, []wasmValType{f64, f64}, f64, wasmGasFloatArith)
+	set(0xa3, 0xa3, []wasmValType{f64, f64}, f64, wasmGasFloatDiv)
+
+	set(0xa7, 0xa7, []wasmValType{i64}, i32, wasmGasConvert)
+	set(0xa8, 0xa9, []wasmValType{f32}, i32, wasmGasConvert)
+	set(0xaa, 0xab, []wasmValType{f64}, i32, wasmGasConvert)
+	set(0xac, 0xad, []wasmValType{i32}, i64, wasmGasConvert)
+	set(0xae, 0xaf, []wasmValType{f32}, i64, wasmGasConvert)
+	set(0xb0, 0xb1, []wasmValType{f64}, i64, wasmGasConvert)
+	set(0xb2, 0xb3, []wasmValType{i32}, f32, wasmGasConvert)
+	set(0xb4, 0xb5, []wasmValType{i64}, f32, wasmGasConvert)
+	set(0xb6, 0xb6, []wasmValType{f64}, f32, wasmGasConvert)
+	set(0xb7, 0xb8, []wasmValType{i32}, f64, wasmGasConvert)
+	set(0xb9, 0xba, []wasmValType{i64}, f64, wasmGasConvert)
+	set(0xbb, 0xbb, []wasmValType{f32}, f64, wasmGasConvert)
+	set(0xbc, 0xbc, []wasmValType{f32}, i32, wasmGasConvert)
+	set(0xbd, 0xbd, []wasmValType{f64}, i64, wasmGasConvert)
+	set(0xbe, 0xbe, []wasmValType{i32}, f32, wasmGasConvert)
+	set(0xbf, 0xbf, []wasmValType{i64}, f64, wasmGasConvert)
+	// Sign-extension operators, emitted by default by current toolchains.
+	set(0xc0, 0xc1, []wasmValType{i32}, i32, wasmGasIntArith)
+	set(0xc2, 0xc4, []wasmValType{i64}, i64, wasmGasIntArith)
+}
+
+// wasmInstr is a compiled instruction. Structured control flow is resolved at
+// compile time: block, loop and end disappear and branches carry their target
+// and the operand stack height to unwind to.
+type wasmInstr struct {
+	op    byte
+	class wasmGasClass
+	a     uint64 // constant, index, memory offset or branch target
+	b     uint32 // branch arity
+	c     uint32 // branch target height, relative to the frame
+}
+
+type wasmTarget struct {
+	pc     uint32
+	height uint32
+}
+
+type wasmFunc struct {
+	typ      wasmFuncType
+	locals   []wasmValType // declared locals following the parameters
+	body     []byte
+	code     []wasmInstr
+	tables   [][]wasmTarget
+	maxStack int
+}
+
+// wasmFixup locates a forward branch target to patch once the end of its
+// block is reached: instruction instr, or entry of branch table table.
+type wasmFixup struct {
+	instr, table, entry int
+}
+
+type wasmCtrl struct {
+	op          byte
+	results     []wasmValType
+	height      int
+	unreachable bool
+	start       int
+	ifInstr     int
+	fixups      []wasmFixup
+}
+
+func (c *wasmCtrl) labelTypes() []wasmValType {
+	if c.op == wasmOpLoop {
+		return nil
+	}
+	return c.results
+}
+
+type wasmCompiler struct {
+	m      *wasmModule
+	f      *wasmFunc
+	r      *wasmReader
+	locals []wasmValType
+	vals   []wasmValType
+	ctrls  []wasmCtrl
+}
+
+func validateWASMModule(m *wasmModule) error {
+	nfuncs := uint32(len(m.imports) + len(m.funcs))
+	for name, e := range m.exports {
+		var ok bool
+		switch e.kind {
+		case wasmExternFunc:
+			ok = e.index < nfuncs
+		case wasmExternTable:
+			ok = m.table != nil && e.index == 0
+		case wasmExternMemory:
+			ok = m.memory != nil && e.index == 0
+		case wasmExternGlobal:
+			ok = int(e.index) < len(m.globals)
+		}
+		if !ok {
+			return fmt.Errorf("export %q refers to an unknown index %d", name, e.index)
+		}
+	}
+	if m.start >= 0 {
+		ft, ok := m.funcType(uint32(m.start))
+		if !ok {
+			return fmt.Errorf("unknown start function %d", m.start)
+		}
+		if len(ft.params) != 0 || len(ft.results) != 0 {
+			return errors.New("start function must take no arguments and return nothing")
+		}
+	}
+	if len(m.elems) > 0 && m.table == nil {
+		return errors.New("element segment without a table")
+	}
+	for _, e := range m.elems {
+		for _, idx := range e.funcs {
+			if idx >= nfuncs {
+				return fmt.Errorf("element segment refers to unknown function %d", idx)
+			}
+		}
+	}
+	if len(m.data) > 0 && m.memory == nil {
+		return errors.New("data segment without a memory")
+	}
+	for i, f := range m.funcs {
+		if err := compileWASMFunc(m, f); err != nil {
+			return fmt.Errorf("function %d: %v", len(m.imports)+i, err)
+		}
+	}
+	return nil
+}
+
+func compileWASMFunc(m *wasmModule, f *wasmFunc) error {
+	r := &wasmReader{buf: f.body}
+	groups, err := r.count(2)
+	if err != nil {
+		return err
+	}
+	total := uint64(len(f.typ.params))
+	for i := uint32(0); i < groups; i++ {
+		n, err := r.u32()
+		if err != nil {
+			return err
+		}
+		t, err := r.valType()
+		if err != nil {
+			return err
+		}
+		total += uint64(n)
+		if total > wasmMaxLocals {
+			return errors.New("too many locals")
+		}
+		for j := uint32(0); j < n; j++ {
+			f.locals = append(f.locals, t)
+		}
+	}
+	c := &wasmCompiler{m: m, f: f, r: r}
+	c.locals = append(append([]wasmValType{}, f.typ.params...), f.locals...)
+	c.ctrls = []wasmCtrl{{op: wasmOpBlock, results: f.typ.results, ifInstr: -1}}
+	for len(c.ctrls) > 0 {
+		if r.eof() {
+			return errors.New("unexpected end of function body")
+		}
+		if err := c.step(); err != nil {
+			return fmt.Errorf("offset %d: %v", r.pos, err)
+		}
+	}
+	if !r.eof() {
+		return errors.New("trailing bytes after function end")
+	}
+	return nil
+}
+
+func (c *wasmCompiler) emit(op byte, class wasmGasClass, a uint64) int {
+	c.f.code = append(c.f.code, wasmInstr{op: op, class: class, a: a})
+	return len(c.f.code) - 1
+}
+
+func (c *wasmCompiler) push(t wasmValType) {
+	c.vals = append(c.vals, t)
+	if len(c.vals) > c.f.maxStack {
+		c.f.maxStack = len(c.vals)
+	}
+}
+
+func (c *wasmCompiler) pop() (wasmValType, error) {
+	top := &c.ctrls[len(c.ctrls)-1]
+	if len(c.vals) == top.height {
+		if top.unreachable {
+			return 0, nil
+		}
+		return 0, errors.New("type mismatch: operand stack underflow")
+	}
+	t := c.vals[len(c.vals)-1]
+	c.vals = c.vals[:len(c.vals)-1]
+	return t, nil
+}
+
+func (c *wasmCompiler) popExpect(want wasmValType) error {
+	got, err := c.pop()
+	if err != nil {
+		return err
+	}
+	if got != 0 && want != 0 && got != want {
+		return fmt.Errorf("type mismatch: expected %s, got %s", want, got)
+	}
+	return nil
+}
+
+func (c *wasmCompiler) popAll(types []wasmValType) error {
+	for i := len(types) - 1; i >= 0; i-- {
+		if err := c.popExpect(types[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *wasmCompiler) pushAll(types []wasmValType) {
+	for _, t := range types {
+		c.push(t)
+	}
+}
+
+func (c *wasmCompiler) setUnreachable() {
+	top := &c.ctrls[len(c.ctrls)-1]
+	c.vals = c.vals[:top.height]
+	top.unreachable = true
+}
+
+func (c *wasmCompiler) label(depth uint32) (*wasmCtrl, error) {
+	if int(depth) >= len(c.ctrls) {
+		return nil, fmt.Errorf("unknown label %d", depth)
+	}
+	return &c.ctrls[len(c.ctrls)-1-int(depth)], nil
+}
+
+// branch emits a branch to the label depth levels up, recording a fixup when
+// the target is the end of a block that has not been compiled yet.
+func (c *wasmCompiler) branch(op byte, depth uint32) (int, error) {
+	target, err := c.label(depth)
+	if err != nil {
+		return 0, err
+	}
+	idx := c.emit(op, wasmGasControl, 0)
+	ins := &c.f.code[idx]
+	ins.b = uint32(len(target.labelTypes()))
+	ins.c = uint32(target.height)
+	if target.op == wasmOpLoop {
+		ins.a = uint64(target.start)
+	} else {
+		target.fixups = append(target.fixups, wasmFixup{instr: idx, table: -1})
+	}
+	return idx, nil
+}
+
+func (c *wasmCompiler) blockType() ([]wasmValType, error) {
+	b, err := c.r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if b == 0x40 {
+		return nil, nil
+	}
+	switch t := wasmValType(b); t {
+	case wasmI32, wasmI64, wasmF32, wasmF64:
+		return []wasmValType{t}, nil
+	}
+	return nil, fmt.Errorf("invalid block type 0x%02x", b)
+}
+
+func (c *wasmCompiler) memarg(width uint32) (uint32, error) {
+	align, err := c.r.u32()
+	if err != nil {
+		return 0, err
+	}
+	if align >= 32 || 1<<align > width {
+		return 0, errors.New("alignment must not be larger than natural")
+	}
+	return c.r.u32()
+}
+
+func (c *wasmCompiler) step() error {
+	r := c.r
+	op, err := r.byte()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case wasmOpUnreachable:
+		c.emit(op, wasmGasControl, 0)
+		c.setUnreachable()
+	case wasmOpNop:
+	case wasmOpBlock, wasmOpLoop, wasmOpIf:
+		results, err := c.blockType()
+		if err != nil {
+			return err
+		}
+		ctrl := wasmCtrl{op: op, results: results, start: len(c.f.code), ifInstr: -1}
+		if op == wasmOpIf {
+			if err := c.popExpect(wasmI32); err != nil {
+				return err
+			}
+			ctrl.ifInstr = c.emit(op, wasmGasControl, 0)
+		}
+		ctrl.height = len(c.vals)
+		c.ctrls = append(c.ctrls, ctrl)
+	case wasmOpElse:
+		top := &c.ctrls[len(c.ctrls)-1]
+		if top.op != wasmOpIf {
+			return errors.New("else without matching if")
+		}
+		if err := c.popAll(top.results); err != nil {
+			return err
+		}
+		if len(c.vals) != top.height {
+			return errors.New("type mismatch: values remaining on stack at end of block")
+		}
+		jump := c.emit(op, wasmGasControl, 0)
+		top.fixups = append(top.fixups, wasmFixup{instr: jump, table: -1})
+		c.f.code[top.ifInstr].a = uint64(len(c.f.code))
+		top.ifInstr = -1
+		top.op = wasmOpElse
+		top.unreachable = false
+	case wasmOpEnd:
+		top := c.ctrls[len(c.ctrls)-1]
+		if err := c.popAll(top.results); err != nil {
+			return err
+		}
+		if len(c.vals) != top.height {
+			return errors.New("type mismatch: values remaining on stack at end of block")
+		}
+		if top.ifInstr >= 0 {
+			if len(top.results) > 0 {
+				return errors.New("type mismatch: if with a result requires an else branch")
+			}
+			c.f.code[top.ifInstr].a = uint64(len(c.f.code))
+		}
+		end := uint64(len(c.f.code))
+		for _, fx := range top.fixups {
+			if fx.table < 0 {
+				c.f.code[fx.instr].a = end
+			} else {
+				c.f.tables[fx.table][fx.entry].pc = uint32(end)
+			}
+		}
+		c.ctrls = c.ctrls[:len(c.ctrls)-1]
+		c.pushAll(top.results)
+		if len(c.ctrls) == 0 {
+			ret := c.emit(wasmOpReturn, wasmGasControl, 0)
+			c.f.code[ret].b = uint32(len(top.results))
+		}
+	case wasmOpBr:
+		depth, err := r.u32()
+		if err != nil {
+			return err
+		}
+		target, err := c.label(depth)
+		if err != nil {
+			return err
+		}
+		if err := c.popAll(target.labelTypes()); err != nil {
+			return err
+		}
+		if _, err := c.branch(op, depth); err != nil {
+			return err
+		}
+		c.setUnreachable()
+	case wasmOpBrIf:
+		depth, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if err := c.popExpect(wasmI32); err != nil {
+			return err
+		}
+		target, err := c.label(depth)
+		if err != nil {
+			return err
+		}
+		types := target.labelTypes()
+		if err := c.popAll(types); err != nil {
+			return err
+		}
+		c.pushAll(types)
+		if _, err := c.branch(op, depth); err != nil {
+			return err
+		}
+	case wasmOpBrTable:
+		n, err := r.count(1)
+		if err != nil {
+			return err
+		}
+		depths := make([]uint32, n+1)
+		for i := range depths {
+			if depths[i], err = r.u32(); err != nil {
+				return err
+			}
+		}
+		if err := c.popExpect(wasmI32); err != nil {
+			return err
+		}
+		def, err := c.label(depths[n])
+		if err != nil {
+			return err
+		}
+		arity := def.labelTypes()
+		table := len(c.f.tables)
+		targets := make([]wasmTarget, len(depths))
+		for i, d := range depths {
+			target, err := c.label(d)
+			if err != nil {
+				return err
+			}
+			types := target.labelTypes()
+			if len(types) != len(arity) || (len(types) == 1 && types[0] != arity[0]) {
+				return errors.New("type mismatch: br_table targets have inconsistent types")
+			}
+			targets[i].height = uint32(target.height)
+			if target.op == wasmOpLoop {
+				targets[i].pc = uint32(target.start)
+			} else {
+				target.fixups = append(target.fixups, wasmFixup{table: table, entry: i})
+			}
+		}
+		c.f.tables = append(c.f.tables, targets)
+		if err := c.popAll(arity); err != nil {
+			return err
+		}
+		idx := c.emit(op, wasmGasControl, uint64(table))
+		c.f.code[idx].b = uint32(len(arity))
+		c.setUnreachable()
+	case wasmOpReturn:
+		if err := c.popAll(c.f.typ.results); err != nil {
+			return err
+		}
+		idx := c.emit(op, wasmGasControl, 0)
+		c.f.code[idx].b = uint32(len(c.f.typ.results))
+		c.setUnreachable()
+	case wasmOpCall:
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		ft, ok := c.m.funcType(idx)
+		if !ok {
+			return fmt.Errorf("unknown function %d", idx)
+		}
+		if err := c.popAll(ft.params); err != nil {
+			return err
+		}
+		c.pushAll(ft.results)
+		c.emit(op, wasmGasCall, uint64(idx))
+	case wasmOpCallIndirect:
+		ti, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if reserved, err := r.byte(); err != nil || reserved != 0 {
+			return errors.New("zero byte expected")
+		}
+		if c.m.table == nil {
+			return errors.New("call_indirect without a table")
+		}
+		if int(ti) >= len(c.m.types) {
+			return fmt.Errorf("unknown type %d", ti)
+		}
+		if err := c.popExpect(wasmI32); err != nil {
+			return err
+		}
+		ft := c.m.types[ti]
+		if err := c.popAll(ft.params); err != nil {
+			return err
+		}
+		c.pushAll(ft.results)
+		c.emit(op, wasmGasCallIndirect, uint64(ti))
+	case wasmOpDrop:
+		if _, err := c.pop(); err != nil {
+			return err
+		}
+		c.emit(op, wasmGasControl, 0)
+	case wasmOpSelect:
+		if err := c.popExpect(wasmI32); err != nil {
+			return err
+		}
+		t1, err := c.pop()
+		if err != nil {
+			return err
+		}
+		t2, err := c.pop()
+		if err != nil {
+			return err
+		}
+		if t1 != 0 && t2 != 0 && t1 != t2 {
+			return fmt.Errorf("type mismatch: select operands %s and %s", t2, t1)
+		}
+		if t1 == 0 {
+			t1 = t2
+		}
+		c.push(t1)
+		c.emit(op, wasmGasControl, 0)
+	case wasmOpLocalGet, wasmOpLocalSet, wasmOpLocalTee:
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if int(idx) >= len(c.locals) {
+			return fmt.Errorf("unknown local %d", idx)
+		}
+		t := c.locals[idx]
+		if op != wasmOpLocalGet {
+			if err := c.popExpect(t); err != nil {
+				return err
+			}
+		}
+		if op != wasmOpLocalSet {
+			c.push(t)
+		}
+		c.emit(op, wasmGasVariable, uint64(idx))
+	case wasmOpGlobalGet, wasmOpGlobalSet:
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if int(idx) >= len(c.m.globals) {
+			return fmt.Errorf("unknown global %d", idx)
+		}
+		g := c.m.globals[idx]
+		if op == wasmOpGlobalSet {
+			if !g.mutable {
+				return fmt.Errorf("global %d is immutable", idx)
+			}
+			if err := c.popExpect(g.typ); err != nil {
+				return err
+			}
+		} else {
+			c.push(g.typ)
+		}
+		c.emit(op, wasmGasVariable, uint64(idx))
+	case wasmOpMemorySize, wasmOpMemoryGrow:
+		if reserved, err := r.byte(); err != nil || reserved != 0 {
+			return errors.New("zero byte expected")
+		}
+		if c.m.memory == nil {
+			return errors.New("memory instruction without a memory")
+		}
+		class := wasmGasMemorySize
+		if op == wasmOpMemoryGrow {
+			class = wasmGasMemoryGrow
+			if err := c.popExpect(wasmI32); err != nil {
+				return err
+			}
+		}
+		c.push(wasmI32)
+		c.emit(op, class, 0)
+	case wasmOpI32Const:
+		v, err := r.s32()
+		if err != nil {
+			return err
+		}
+		c.push(wasmI32)
+		c.emit(op, wasmGasConst, uint64(uint32(v)))
+	case wasmOpI64Const:
+		v, err := r.s64()
+		if err != nil {
+			return err
+		}
+		c.push(wasmI64)
+		c.emit(op, wasmGasConst, uint64(v))
+	case wasmOpF32Const:
+		v, err := r.fixed32()
+		if err != nil {
+			return err
+		}
+		c.push(wasmF32)
+		c.emit(op, wasmGasConst, uint64(v))
+	case wasmOpF64Const:
+		v, err := r.fixed64()
+		if err != nil {
+			return err
+		}
+		c.push(wasmF64)
+		c.emit(op, wasmGasConst, v)
+	default:
+		info := wasmOps[op]
+		if !info.valid {
+			return fmt.Errorf("unsupported opcode 0x%02x", op)
+		}
+		var offset uint32
+		if info.memory {
+			if c.m.memory == nil {
+				return errors.New("memory instruction without a memory")
+			}
+			if offset, err = c.memarg(info.width); err != nil {
+				return err
+			}
+		}
+		if err := c.popAll(info.in); err != nil {
+			return err
+		}
+		if info.out != 0 {
+			c.push(info.out)
+		}
+		c.emit(op, info.class, uint64(offset))
+	}
+	return nil
+}
@@ -0,0 +1,677 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// wasmTableNull marks an uninitialised table element.
+const wasmTableNull = ^uint32(0)
+
+// wasmInstance is a module instantiated for a single execution. It is not
+// safe for concurrent use.
+type wasmInstance struct {
+	mod      *wasmModule
+	mem      []byte
+	maxPages uint32
+	globals  []uint64
+	table    []uint32
+	stack    []uint64
+	sp       int
+	depth    int
+	ctx      context.Context
+	steps    uint64
+
+	env        *CallContext
+	trace      *contractTracer
+	returnData []byte
+	hostCosts  []uint64
+	wordCost   uint64
+
+	gasLimit uint64
+	gasLeft  uint64
+	costs    [wasmGasClasses]uint64
+	pageCost uint64
+}
+
+func wasmTrap(msg string) error { return fmt.Errorf("%w: %s", ErrWASMTrap, msg) }
+
+// instantiate allocates memory, globals and the table and applies the element
+// and data segments. maxPages bounds linear memory.
+func (m *wasmModule) instantiate(ctx context.Context, maxPages uint32) (*wasmInstance, error) {
+	in := &wasmInstance{mod: m, ctx: ctx, env: &CallContext{}}
+	if m.memory != nil {
+		in.maxPages = maxPages
+		if m.memory.hasMax && m.memory.max < in.maxPages {
+			in.maxPages = m.memory.max
+		}
+		if m.memory.min > in.maxPages {
+			return nil, fmt.Errorf("%w: module requires %d pages, limit is %d", ErrWASMMemoryLimit, m.memory.min, in.maxPages)
+		}
+		in.mem = make([]byte, int(m.memory.min)*wasmPageSize)
+	}
+	in.globals = make([]uint64, len(m.globals))
+	for i, g := range m.globals {
+		in.globals[i] = g.init
+	}
+	if m.table != nil {
+		in.table = make([]uint32, m.table.min)
+		for i := range in.table {
+			in.table[i] = wasmTableNull
+		}
+	}
+	for _, e := range m.elems {
+		if uint64(e.offset)+uint64(len(e.funcs)) > uint64(len(in.table)) {
+			return nil, wasmTrap("elements segment does not fit")
+		}
+	}
+	for _, d := range m.data {
+		if uint64(d.offset)+uint64(len(d.init)) > uint64(len(in.mem)) {
+			return nil, wasmTrap("data segment does not fit")
+		}
+	}
+	for _, e := range m.elems {
+		copy(in.table[e.offset:], e.funcs)
+	}
+	for _, d := range m.data {
+		copy(in.mem[d.offset:], d.init)
+	}
+	return in, nil
+}
+
+func (in *wasmInstance) charge(amount uint64) error {
+	if amount > in.gasLeft {
+		left := in.gasLeft
+		in.gasLeft = 0
+		return fmt.Errorf("%w: required %d remaining %d", ErrGasLimit, amount, left)
+	}
+	in.gasLeft -= amount
+	return nil
+}
+
+func (in *wasmInstance) gasUsed() uint64 { return in.gasLimit - in.gasLeft }
+
+// call invokes function idx with its arguments on top of the operand stack,
+// leaving its results in their place.
+func (in *wasmInstance) call(idx uint32) (err error) {
+	if int(idx) < len(in.mod.imports) {
+		return in.callHost(idx)
+	}
+	if in.depth >= wasmMaxDepth {
+		return wasmTrap("call stack exhausted")
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+
+	f := in.mod.funcs[int(idx)-len(in.mod.imports)]
+	nparams := len(f.typ.params)
+	locals := make([]uint64, nparams+len(f.locals))
+	copy(locals, in.stack[in.sp-nparams:in.sp])
+	in.sp -= nparams
+	base := in.sp
+	if need := base + f.maxStack + 1; need > len(in.stack) {
+		grown := make([]uint64, max(need, 2*len(in.stack)))
+		copy(grown, in.stack[:in.sp])
+		in.stack = grown
+	}
+	s := in.stack
+	sp := in.sp
+	code := f.code
+	if in.trace != nil {
+		in.trace.enter(in, idx, base)
+		defer func() { in.trace.leave(err) }()
+	}
+
+	for pc := 0; pc < len(code); pc++ {
+		ins := &code[pc]
+		if in.trace != nil {
+			in.trace.begin(pc, ins, s[base:sp])
+		}
+		if cost := in.costs[ins.class]; cost > 0 {
+			if err := in.charge(cost); err != nil {
+				return err
+			}
+		}
+		in.steps++
+		if in.steps&0x3ff == 0 {
+			if err := in.ctx.Err(); err != nil {
+				return err
+			}
+		}
+		switch ins.op {
+		case wasmOpUnreachable:
+			return wasmTrap("unreachable executed")
+		case wasmOpIf:
+			sp--
+			if uint32(s[sp]) == 0 {
+				pc = int(ins.a) - 1
+			}
+		case wasmOpElse:
+			pc = int(ins.a) - 1
+		case wasmOpBr:
+			sp = wasmUnwind(s, sp, base+int(ins.c), int(ins.b))
+			pc = int(ins.a) - 1
+		case wasmOpBrIf:
+			sp--
+			if uint32(s[sp]) != 0 {
+				sp = wasmUnwind(s, sp, base+int(ins.c), int(ins.b))
+				pc = int(ins.a) - 1
+			}
+		case wasmOpBrTable:
+			sp--
+			i := uint32(s[sp])
+			targets := f.tables[ins.a]
+			if int(i) >= len(targets)-1 {
+				i = uint32(len(targets) - 1)
+			}
+			t := targets[i]
+			sp = wasmUnwind(s, sp, base+int(t.height), int(ins.b))
+			pc = int(t.pc) - 1
+		case wasmOpReturn:
+			in.sp = wasmUnwind(s, sp, base, int(ins.b))
+			return nil
+		case wasmOpCall, wasmOpCallIndirect:
+			target := uint32(ins.a)
+			if ins.op == wasmOpCallIndirect {
+				sp--
+				i := uint32(s[sp])
+				if int(i) >= len(in.table) {
+					return wasmTrap("undefined element")
+				}
+				if target = in.table[i]; target == wasmTableNull {
+					return wasmTrap("uninitialized element")
+				}
+				ft, _ := in.mod.funcType(target)
+				if !ft.equal(in.mod.types[ins.a]) {
+					return wasmTrap("indirect call type mismatch")
+				}
+			}
+			in.sp = sp
+			if err := in.call(target); err != nil {
+				return err
+			}
+			s, sp = in.stack, in.sp
+		case wasmOpDrop:
+			sp--
+		case wasmOpSelect:
+			sp -= 2
+			if uint32(s[sp+1]) == 0 {
+				s[sp-1] = s[sp]
+			}
+		case wasmOpLocalGet:
+			s[sp] = locals[ins.a]
+			sp++
+		case wasmOpLocalSet:
+			sp--
+			locals[ins.a] = s[sp]
+		case wasmOpLocalTee:
+			locals[ins.a] = s[sp-1]
+		case wasmOpGlobalGet:
+			s[sp] = in.globals[ins.a]
+			sp++
+		case wasmOpGlobalSet:
+			sp--
+			in.globals[ins.a] = s[sp]
+		case wasmOpMemorySize:
+			s[sp] = uint64(len(in.mem) / wasmPageSize)
+			sp++
+		case wasmOpMemoryGrow:
+			delta := uint32(s[sp-1])
+			old := uint32(len(in.mem) / wasmPageSize)
+			if uint64(old)+uint64(delta) > uint64(in.maxPages) {
+				s[sp-1] = uint64(math.MaxUint32)
+				break
+			}
+			if err := in.charge(uint64(delta) * in.pageCost); err != nil {
+				return err
+			}
+			in.mem = append(in.mem, make([]byte, int(delta)*wasmPageSize)...)
+			s[sp-1] = uint64(old)
+		case wasmOpI32Const, wasmOpI64Const, wasmOpF32Const, wasmOpF64Const:
+			s[sp] = ins.a
+			sp++
+		default:
+			var err error
+			if wasmOps[ins.op].memory {
+				sp, err = in.memoryOp(ins, s, sp)
+			} else {
+				sp, err = wasmNumeric(ins.op, s, sp)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wasmUnwind moves the top arity values down to height and returns the new
+// stack pointer.
+func wasmUnwind(s []uint64, sp, height, arity int) int {
+	if sp-arity != height {
+		copy(s[height:], s[sp-arity:sp])
+	}
+	return height + arity
+}
+
+func (in *wasmInstance) memoryOp(ins *wasmInstr, s []uint64, sp int) (int, error) {
+	info := &wasmOps[ins.op]
+	var v uint64
+	if info.out == 0 {
+		sp--
+		v = s[sp]
+	}
+	ea := uint64(uint32(s[sp-1])) + ins.a
+	if ea+uint64(info.width) > uint64(len(in.mem)) {
+		return sp, wasmTrap("out of bounds memory access")
+	}
+	b := in.mem[ea : ea+uint64(info.width)]
+	if info.out == 0 {
+		var old []byte
+		if in.trace != nil {
+			old = append(old, b...)
+			defer func() { in.trace.memory(ea, old, b) }()
+		}
+		switch info.width {
+		case 1:
+			b[0] = byte(v)
+		case 2:
+			binary.LittleEndian.PutUint16(b, uint16(v))
+		case 4:
+			binary.LittleEndian.PutUint32(b, uint32(v))
+		case 8:
+			binary.LittleEndian.PutUint64(b, v)
+		}
+		return sp - 1, nil
+	}
+	switch ins.op {
+	case 0x28, 0x2a, 0x35:
+		v = uint64(binary.LittleEndian.Uint32(b))
+	case 0x29, 0x2b:
+		v = binary.LittleEndian.Uint64(b)
+	case 0x2c:
+		v = uint64(uint32(int32(int8(b[0]))))
+	case 0x2d, 0x31:
+		v = uint64(b[0])
+	case 0x2e:
+		v = uint64(uint32(int32(int16(binary.LittleEndian.Uint16(b)))))
+	case 0x2f, 0x33:
+		v = uint64(binary.LittleEndian.Uint16(b))
+	case 0x30:
+		v = uint64(int64(int8(b[0])))
+	case 0x32:
+		v = uint64(int64(int16(binary.LittleEndian.Uint16(b))))
+	case 0x34:
+		v = uint64(int64(int32(binary.LittleEndian.Uint32(b))))
+	}
+	s[sp-1] = v
+	return sp, nil
+}
+
+func wasmBool(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// wasmNumeric executes the numeric instruction op. i32 and f32 values occupy
+// the low 32 bits of a stack slot.
+func wasmNumeric(op byte, s []uint64, sp int) (int, error) {
+	if len(wasmOps[op].in) == 2 {
+		sp--
+		x, y := s[sp-1], s[sp]
+		r, err := wasmBinary(op, x, y)
+		s[sp-1] = r
+		return sp, err
+	}
+	r, err := wasmUnary(op, s[sp-1])
+	s[sp-1] = r
+	return sp, err
+}
+
+func wasmBinary(op byte, x, y uint64) (uint64, error) {
+	a32, b32 := uint32(x), uint32(y)
+	f32a, f32b := math.Float32frombits(a32), math.Float32frombits(b32)
+	f64a, f64b := math.Float64frombits(x), math.Float64frombits(y)
+	switch op {
+	case 0x46:
+		return wasmBool(a32 == b32), nil
+	case 0x47:
+		return wasmBool(a32 != b32), nil
+	case 0x48:
+		return wasmBool(int32(a32) < int32(b32)), nil
+	case 0x49:
+		return wasmBool(a32 < b32), nil
+	case 0x4a:
+		return wasmBool(int32(a32) > int32(b32)), nil
+	case 0x4b:
+		return wasmBool(a32 > b32), nil
+	case 0x4c:
+		return wasmBool(int32(a32) <= int32(b32)), nil
+	case 0x4d:
+		return wasmBool(a32 <= b32), nil
+	case 0x4e:
+		return wasmBool(int32(a32) >= int32(b32)), nil
+	case 0x4f:
+		return wasmBool(a32 >= b32), nil
+	case 0x51:
+		return wasmBool(x == y), nil
+	case 0x52:
+		return wasmBool(x != y), nil
+	case 0x53:
+		return wasmBool(int64(x) < int64(y)), nil
+	case 0x54:
+		return wasmBool(x < y), nil
+	case 0x55:
+		return wasmBool(int64(x) > int64(y)), nil
+	case 0x56:
+		return wasmBool(x > y), nil
+	case 0x57:
+		return wasmBool(int64(x) <= int64(y)), nil
+	case 0x58:
+		return wasmBool(x <= y), nil
+	case 0x59:
+		return wasmBool(int64(x) >= int64(y)), nil
+	case 0x5a:
+		return wasmBool(x >= y), nil
+	case 0x5b:
+		return wasmBool(f32a == f32b), nil
+	case 0x5c:
+		return wasmBool(f32a != f32b), nil
+	case 0x5d:
+		return wasmBool(f32a < f32b), nil
+	case 0x5e:
+		return wasmBool(f32a > f32b), nil
+	case 0x5f:
+		return wasmBool(f32a <= f32b), nil
+	case 0x60:
+		return wasmBool(f32a >= f32b), nil
+	case 0x61:
+		return wasmBool(f64a == f64b), nil
+	case 0x62:
+		return wasmBool(f64a != f64b), nil
+	case 0x63:
+		return wasmBool(f64a < f64b), nil
+	case 0x64:
+		return wasmBool(f64a > f64b), nil
+	case 0x65:
+		return wasmBool(f64a <= f64b), nil
+	case 0x66:
+		return wasmBool(f64a >= f64b), nil
+
+	case 0x6a:
+		return uint64(a32 + b32), nil
+	case 0x6b:
+		return uint64(a32 - b32), nil
+	case 0x6c:
+		return uint64(a32 * b32), nil
+	case 0x6d:
+		if b32 == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		if int32(a32) == math.MinInt32 && int32(b32) == -1 {
+			return 0, wasmTrap("integer overflow")
+		}
+		return uint64(uint32(int32(a32) / int32(b32))), nil
+	case 0x6e:
+		if b32 == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		return uint64(a32 / b32), nil
+	case 0x6f:
+		if b32 == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		if int32(b32) == -1 {
+			return 0, nil
+		}
+		return uint64(uint32(int32(a32) % int32(b32))), nil
+	case 0x70:
+		if b32 == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		return uint64(a32 % b32), nil
+	case 0x71:
+		return uint64(a32 & b32), nil
+	case 0x72:
+		return uint64(a32 | b32), nil
+	case 0x73:
+		return uint64(a32 ^ b32), nil
+	case 0x74:
+		return uint64(a32 << (b32 & 31)), nil
+	case 0x75:
+		return uint64(uint32(int32(a32) >> (b32 & 31))), nil
+	case 0x76:
+		return uint64(a32 >> (b32 & 31)), nil
+	case 0x77:
+		return uint64(bits.RotateLeft32(a32, int(b32&31))), nil
+	case 0x78:
+		return uint64(bits.RotateLeft32(a32, -int(b32&31))), nil
+
+	case 0x7c:
+		return x + y, nil
+	case 0x7d:
+		return x - y, nil
+	case 0x7e:
+		return x * y, nil
+	case 0x7f:
+		if y == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		if int64(x) == math.MinInt64 && int64(y) == -1 {
+			return 0, wasmTrap("integer overflow")
+		}
+		return uint64(int64(x) / int64(y)), nil
+	case 0x80:
+		if y == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		return x / y, nil
+	case 0x81:
+		if y == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		if int64(y) == -1 {
+			return 0, nil
+		}
+		return uint64(int64(x) % int64(y)), nil
+	case 0x82:
+		if y == 0 {
+			return 0, wasmTrap("integer divide by zero")
+		}
+		return x % y, nil
+	case 0x83:
+		return x & y, nil
+	case 0x84:
+		return x | y, nil
+	case 0x85:
+		return x ^ y, nil
+	case 0x86:
+		return x << (y & 63), nil
+	case 0x87:
+		return uint64(int64(x) >> (y & 63)), nil
+	case 0x88:
+		return x >> (y & 63), nil
+	case 0x89:
+		return bits.RotateLeft64(x, int(y&63)), nil
+	case 0x8a:
+		return bits.RotateLeft64(x, -int(y&63)), nil
+
+	case 0x92:
+		return wasmF32Bits(float32(f32a + f32b)), nil
+	case 0x93:
+		return wasmF32Bits(float32(f32a - f32b)), nil
+	case 0x94:
+		return wasmF32Bits(float32(f32a * f32b)), nil
+	case 0x95:
+		return wasmF32Bits(float32(f32a / f32b)), nil
+	case 0x96:
+		return wasmF32Bits(float32(math.Min(float64(f32a), float64(f32b)))), nil
+	case 0x97:
+		return wasmF32Bits(float32(math.Max(float64(f32a), float64(f32b)))), nil
+	case 0x98:
+		return uint64(a32&^(1<<31) | b32&(1<<31)), nil
+	case 0xa0:
+		return wasmF64Bits(float64(f64a + f64b)), nil
+	case 0xa1:
+		return wasmF64Bits(float64(f64a - f64b)), nil
+	case 0xa2:
+		return wasmF64Bits(float64(f64a * f64b)), nil
+	case 0xa3:
+		return wasmF64Bits(float64(f64a / f64b)), nil
+	case 0xa4:
+		return wasmF64Bits(math.Min(f64a, f64b)), nil
+	case 0xa5:
+		return wasmF64Bits(math.Max(f64a, f64b)), nil
+	case 0xa6:
+		return x&^(1<<63) | y&(1<<63), nil
+	}
+	return 0, fmt.Errorf("unsupported opcode 0x%02x", op)
+}
+
+func wasmUnary(op byte, x uint64) (uint64, error) {
+	a32 := uint32(x)
+	f32 := math.Float32frombits(a32)
+	f64 := math.Float64frombits(x)
+	switch op {
+	case 0x45:
+		return wasmBool(a32 == 0), nil
+	case 0x50:
+		return wasmBool(x == 0), nil
+	case 0x67:
+		return uint64(bits.LeadingZeros32(a32)), nil
+	case 0x68:
+		return uint64(bits.TrailingZeros32(a32)), nil
+	case 0x69:
+		return uint64(bits.OnesCount32(a32)), nil
+	case 0x79:
+		return uint64(bits.LeadingZeros64(x)), nil
+	case 0x7a:
+		return uint64(bits.TrailingZeros64(x)), nil
+	case 0x7b:
+		return uint64(bits.OnesCount64(x)), nil
+
+	case 0x8b:
+		return uint64(a32 &^ (1 << 31)), nil
+	case 0x8c:
+		return uint64(a32 ^ (1 << 31)), nil
+	case 0x8d:
+		return wasmF32Bits(float32(math.Ceil(float64(f32)))), nil
+	case 0x8e:
+		return wasmF32Bits(float32(math.Floor(float64(f32)))), nil
+	case 0x8f:
+		return wasmF32Bits(float32(math.Trunc(float64(f32)))), nil
+	case 0x90:
+		return wasmF32Bits(float32(math.RoundToEven(float64(f32)))), nil
+	case 0x91:
+		return wasmF32Bits(float32(math.Sqrt(float64(f32)))), nil
+	case 0x99:
+		return x &^ (1 << 63), nil
+	case 0x9a:
+		return x ^ (1 << 63), nil
+	case 0x9b:
+		return wasmF64Bits(math.Ceil(f64)), nil
+	case 0x9c:
+		return wasmF64Bits(math.Floor(f64)), nil
+	case 0x9d:
+		return wasmF64Bits(math.Trunc(f64)), nil
+	case 0x9e:
+		return wasmF64Bits(math.RoundToEven(f64)), nil
+	case 0x9f:
+		return wasmF64Bits(math.Sqrt(f64)), nil
+
+	case 0xa7:
+		return uint64(a32), nil
+	case 0xa8:
+		v, err := wasmTruncate(float64(f32), -1<<31, 1<<31)
+		return uint64(uint32(int32(v))), err
+	case 0xa9:
+		v, err := wasmTruncate(float64(f32), -1, 1<<32)
+		return uint64(uint32(v)), err
+	case 0xaa:
+		v, err := wasmTruncate(f64, -1<<31, 1<<31)
+		return uint64(uint32(int32(v))), err
+	case 0xab:
+		v, err := wasmTruncate(f64, -1, 1<<32)
+		return uint64(uint32(v)), err
+	case 0xac:
+		return uint64(int64(int32(a32))), nil
+	case 0xad:
+		return uint64(a32), nil
+	case 0xae:
+		v, err := wasmTruncate(float64(f32), -1<<63, 1<<63)
+		return uint64(int64(v)), err
+	case 0xaf:
+		return wasmTruncateU64(float64(f32))
+	case 0xb0:
+		v, err := wasmTruncate(f64, -1<<63, 1<<63)
+		return uint64(int64(v)), err
+	case 0xb1:
+		return wasmTruncateU64(f64)
+	case 0xb2:
+		return wasmF32Bits(float32(int32(a32))), nil
+	case 0xb3:
+		return wasmF32Bits(float32(a32)), nil
+	case 0xb4:
+		return wasmF32Bits(float32(int64(x))), nil
+	case 0xb5:
+		return wasmF32Bits(float32(x)), nil
+	case 0xb6:
+		return wasmF32Bits(float32(f64)), nil
+	case 0xb7:
+		return wasmF64Bits(float64(int32(a32))), nil
+	case 0xb8:
+		return wasmF64Bits(float64(a32)), nil
+	case 0xb9:
+		return wasmF64Bits(float64(int64(x))), nil
+	case 0xba:
+		return wasmF64Bits(float64(x)), nil
+	case 0xbb:
+		return wasmF64Bits(float64(f32)), nil
+	case 0xbc, 0xbe:
+		return uint64(a32), nil
+	case 0xbd, 0xbf:
+		return x, nil
+
+	case 0xc0:
+		return uint64(uint32(int32(int8(a32)))), nil
+	case 0xc1:
+		return uint64(uint32(int32(int16(a32)))), nil
+	case 0xc2:
+		return uint64(int64(int8(x))), nil
+	case 0xc3:
+		return uint64(int64(int16(x))), nil
+	case 0xc4:
+		return uint64(int64(int32(x))), nil
+	}
+	return 0, fmt.Errorf("unsupported opcode 0x%02x", op)
+}
+
+// wasmTruncate truncates v towards zero and traps when the result is NaN or
+// falls outside [lo, hi). A lo of -1 denotes an unsigned target, for which
+// -1 itself is out of range as well.
+func wasmTruncate(v, lo, hi float64) (float64, error) {
+	if math.IsNaN(v) {
+		return 0, wasmTrap("invalid conversion to integer")
+	}
+	t := math.Trunc(v)
+	if t >= hi || t < lo || (lo == -1 && t <= lo) {
+		return 0, wasmTrap("integer overflow")
+	}
+	return t, nil
+}
+
+func wasmTruncateU64(v float64) (uint64, error) {
+	t, err := wasmTruncate(v, -1, 1<<64)
+	if err != nil {
+		return 0, err
+	}
+	if t >= 1<<63 {
+		return uint64(t-(1<<63)) | 1<<63, nil
+	}
+	return uint64(t), nil
+}
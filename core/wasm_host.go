@@ -0,0 +1,276 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// wasmHostModule is the import namespace of the synnergy host ABI.
+const wasmHostModule = "synnergy"
+
+// wasmHostWordGas prices each 32-byte word copied between linear memory and
+// the host.
+const wasmHostWordGas = "HostDataWord"
+
+// Status codes returned by the call host function.
+const (
+	wasmCallOK       = 0
+	wasmCallReverted = 1
+	wasmCallFailed   = 2
+)
+
+// wasmHostFunc is a function contracts import from the synnergy namespace.
+// Byte strings cross the boundary as (ptr, len) pairs. Functions returning
+// bytes take a (ptr, cap) buffer and return the full length, writing nothing
+// when the buffer is too small.
+type wasmHostFunc struct {
+	gas string
+	typ wasmFuncType
+	fn  func(in *wasmInstance, args []uint64) (uint64, error)
+}
+
+func hostSig(params []wasmValType, results ...wasmValType) wasmFuncType {
+	return wasmFuncType{params: params, results: results}
+}
+
+var (
+	hostBuf   = []wasmValType{wasmI32, wasmI32}
+	hostBuf2  = []wasmValType{wasmI32, wasmI32, wasmI32, wasmI32}
+	hostNoArg []wasmValType
+)
+
+// wasmHostFuncs lists the host ABI by import name.
+var wasmHostFuncs = map[string]*wasmHostFunc{
+	"caller": {"HostCaller", hostSig(hostBuf, wasmI32), func(in *wasmInstance, a []uint64) (uint64, error) {
+		return in.hostWrite(a[0], a[1], []byte(in.env.Caller))
+	}},
+	"origin": {"HostOrigin", hostSig(hostBuf, wasmI32), func(in *wasmInstance, a []uint64) (uint64, error) {
+		return in.hostWrite(a[0], a[1], []byte(in.env.Origin))
+	}},
+	"address": {"HostAddress", hostSig(hostBuf, wasmI32), func(in *wasmInstance, a []uint64) (uint64, error) {
+		return in.hostWrite(a[0], a[1], []byte(in.env.Contract))
+	}},
+	"value": {"HostValue", hostSig(hostNoArg, wasmI64), func(in *wasmInstance, _ []uint64) (uint64, error) {
+		return in.env.Value, nil
+	}},
+	"block_height": {"HostBlockHeight", hostSig(hostNoArg, wasmI64), func(in *wasmInstance, _ []uint64) (uint64, error) {
+		return in.env.Height, nil
+	}},
+	"block_time": {"HostBlockTime", hostSig(hostNoArg, wasmI64), func(in *wasmInstance, _ []uint64) (uint64, error) {
+		return uint64(in.env.Time), nil
+	}},
+	"balance": {"HostBalance", hostSig(hostBuf, wasmI64), func(in *wasmInstance, a []uint64) (uint64, error) {
+		host, err := in.host("balance")
+		if err != nil {
+			return 0, err
+		}
+		addr, err := in.hostRead(a[0], a[1])
+		if err != nil {
+			return 0, err
+		}
+		return host.Balance(string(addr)), nil
+	}},
+	"transfer": {"HostTransfer", hostSig([]wasmValType{wasmI32, wasmI32, wasmI64}, wasmI32), func(in *wasmInstance, a []uint64) (uint64, error) {
+		host, err := in.host("transfer")
+		if err != nil {
+			return 0, err
+		}
+		to, err := in.hostRead(a[0], a[1])
+		if err != nil {
+			return 0, err
+		}
+		if err := host.Transfer(in.env.Contract, string(to), a[2]); err != nil {
+			return wasmCallFailed, nil
+		}
+		return wasmCallOK, nil
+	}},
+	"storage_get": {"HostStorageGet", hostSig(hostBuf2, wasmI32), func(in *wasmInstance, a []uint64) (uint64, error) {
+		host, err := in.host("storage_get")
+		if err != nil {
+			return 0, err
+		}
+		key, err := in.hostRead(a[0], a[1])
+		if err != nil {
+			return 0, err
+		}
+		v, ok := host.StorageGet(in.env.Contract, key)
+		if !ok {
+			return uint64(^uint32(0)), nil
+		}
+		return in.hostWrite(a[2], a[3], v)
+	}},
+	"storage_set": {"HostStorageSet", hostSig(hostBuf2), func(in *wasmInstance, a []uint64) (uint64, error) {
+		host, err := in.host("storage_set")
+		if err != nil {
+			return 0, err
+		}
+		key, err := in.hostRead(a[0], a[1])
+		if err != nil {
+			return 0, err
+		}
+		v, err := in.hostRead(a[2], a[3])
+		if err != nil {
+			return 0, err
+		}
+		host.StorageSet(in.env.Contract, key, v)
+		return 0, nil
+	}},
+	"emit_log": {"HostEmitLog", hostSig(hostBuf2), func(in *wasmInstance, a []uint64) (uint64, error) {
+		n := uint32(a[1])
+		if n > MaxLogTopics {
+			return 0, wasmTrap(fmt.Sprintf("log has %d topics, limit is %d", n, MaxLogTopics))
+		}
+		raw, err := in.hostRead(a[0], uint64(n)*32)
+		if err != nil {
+			return 0, err
+		}
+		data, err := in.hostRead(a[2], a[3])
+		if err != nil {
+			return 0, err
+		}
+		log := ContractLog{Address: in.env.Contract, Topics: make([]string, n), Data: data}
+		for i := range log.Topics {
+			log.Topics[i] = hex.EncodeToString(raw[32*i : 32*i+32])
+		}
+		in.env.Logs = append(in.env.Logs, log)
+		return 0, nil
+	}},
+	"call": {"HostCall", hostSig([]wasmValType{wasmI32, wasmI32, wasmI32, wasmI32, wasmI32, wasmI32, wasmI64, wasmI64}, wasmI32), func(in *wasmInstance, a []uint64) (uint64, error) {
+		host, err := in.host("call")
+		if err != nil {
+			return 0, err
+		}
+		to, err := in.hostRead(a[0], a[1])
+		if err != nil {
+			return 0, err
+		}
+		method, err := in.hostRead(a[2], a[3])
+		if err != nil {
+			return 0, err
+		}
+		args, err := in.hostRead(a[4], a[5])
+		if err != nil {
+			return 0, err
+		}
+		gas := a[7]
+		if gas == 0 || gas > in.gasLeft {
+			gas = in.gasLeft
+		}
+		if gas == 0 {
+			return 0, in.charge(1)
+		}
+		out, used, err := host.Call(in.ctx, in.env, string(to), string(method), args, a[6], gas)
+		if cerr := in.charge(min(used, gas)); cerr != nil {
+			return 0, cerr
+		}
+		var revert *RevertError
+		switch {
+		case err == nil:
+			in.returnData = out
+			return wasmCallOK, nil
+		case errors.As(err, &revert):
+			in.returnData = revert.Data
+			return wasmCallReverted, nil
+		default:
+			in.returnData = nil
+			return wasmCallFailed, nil
+		}
+	}},
+	"return_data": {"HostReturnData", hostSig(hostBuf, wasmI32), func(in *wasmInstance, a []uint64) (uint64, error) {
+		return in.hostWrite(a[0], a[1], in.returnData)
+	}},
+	"revert": {"HostRevert", hostSig(hostBuf), func(in *wasmInstance, a []uint64) (uint64, error) {
+		data, err := in.hostRead(a[0], a[1])
+		if err != nil {
+			return 0, err
+		}
+		return 0, &RevertError{Data: data}
+	}},
+}
+
+// resolveWASMImports binds every import of m to a host function, checking
+// that the declared signature matches the ABI.
+func resolveWASMImports(m *wasmModule) error {
+	for i := range m.imports {
+		imp := &m.imports[i]
+		h, ok := wasmHostFuncs[imp.name]
+		if imp.module != wasmHostModule || !ok {
+			return fmt.Errorf("%w: %s.%s", ErrWASMImport, imp.module, imp.name)
+		}
+		if !m.types[imp.typeIdx].equal(h.typ) {
+			return fmt.Errorf("%w: %s.%s has the wrong signature", ErrWASMImport, imp.module, imp.name)
+		}
+		imp.host = h
+	}
+	return nil
+}
+
+// callHost invokes imported function idx with its arguments on top of the
+// operand stack, charging its gas table price.
+func (in *wasmInstance) callHost(idx uint32) error {
+	h := in.mod.imports[idx].host
+	if err := in.charge(in.hostCosts[idx]); err != nil {
+		return err
+	}
+	n := len(h.typ.params)
+	args := make([]uint64, n)
+	copy(args, in.stack[in.sp-n:in.sp])
+	res, err := h.fn(in, args)
+	if in.trace != nil {
+		in.trace.host(in.mod.imports[idx].name, args, res, err)
+	}
+	if err != nil {
+		return err
+	}
+	in.sp -= n
+	if len(h.typ.results) > 0 {
+		in.stack[in.sp] = res
+		in.sp++
+	}
+	return nil
+}
+
+func (in *wasmInstance) host(name string) (ContractHost, error) {
+	if in.env.Host == nil {
+		return nil, fmt.Errorf("%w: %s.%s", ErrHostUnavailable, wasmHostModule, name)
+	}
+	return in.env.Host, nil
+}
+
+func (in *wasmInstance) chargeWords(n uint64) error {
+	return in.charge(in.wordCost * ((n + 31) / 32))
+}
+
+// hostRead copies n bytes at ptr out of linear memory.
+func (in *wasmInstance) hostRead(ptr, n uint64) ([]byte, error) {
+	ptr, n = uint64(uint32(ptr)), uint64(uint32(n))
+	if err := in.chargeWords(n); err != nil {
+		return nil, err
+	}
+	if ptr+n > uint64(len(in.mem)) {
+		return nil, wasmTrap("host memory access out of bounds")
+	}
+	return append([]byte(nil), in.mem[ptr:ptr+n]...), nil
+}
+
+// hostWrite copies data into the buffer at ptr when it fits in capacity and
+// returns the length of data.
+func (in *wasmInstance) hostWrite(ptr, capacity uint64, data []byte) (uint64, error) {
+	ptr, capacity = uint64(uint32(ptr)), uint64(uint32(capacity))
+	n := uint64(len(data))
+	if n > capacity {
+		return n, nil
+	}
+	if err := in.chargeWords(n); err != nil {
+		return 0, err
+	}
+	if ptr+n > uint64(len(in.mem)) {
+		return 0, wasmTrap("host memory access out of bounds")
+	}
+	if in.trace != nil {
+		in.trace.memory(ptr, in.mem[ptr:ptr+n], data)
+	}
+	copy(in.mem[ptr:], data)
+	return n, nil
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func wasmSLEB(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func i32c(v int32) []byte { return append([]byte{0x41}, wasmSLEB(int64(v))...) }
+
+func wasmCode(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func (b *wasmBuilder) segment(offset int32, init []byte) {
+	seg := append(append([]byte{0}, i32c(offset)...), 0x0b)
+	b.data = append(b.data, append(seg, wasmName(string(init))...))
+}
+
+// Imports of the vault contract, in function index order.
+const (
+	hostCaller byte = iota
+	hostValue
+	hostHeight
+	hostStorageSet
+	hostStorageGet
+	hostEmitLog
+	hostRevert
+	hostTransfer
+	hostCall
+	hostReturnData
+)
+
+// vaultModule builds a contract recording deposits per caller. When callee is
+// set its relay function forwards calls to that contract.
+func vaultModule(callee string) []byte {
+	var b wasmBuilder
+	buf := []wasmValType{wasmI32, wasmI32}
+	buf2 := []wasmValType{wasmI32, wasmI32, wasmI32, wasmI32}
+	b.importFunc("synnergy", "caller", buf, oneI32)
+	b.importFunc("synnergy", "value", nil, oneI64)
+	b.importFunc("synnergy", "block_height", nil, oneI64)
+	b.importFunc("synnergy", "storage_set", buf2, nil)
+	b.importFunc("synnergy", "storage_get", buf2, oneI32)
+	b.importFunc("synnergy", "emit_log", buf2, nil)
+	b.importFunc("synnergy", "revert", buf, nil)
+	b.importFunc("synnergy", "transfer", []wasmValType{wasmI32, wasmI32, wasmI64}, oneI32)
+	b.importFunc("synnergy", "call", []wasmValType{wasmI32, wasmI32, wasmI32, wasmI32, wasmI32, wasmI32, wasmI64, wasmI64}, oneI32)
+	b.importFunc("synnergy", "return_data", buf, oneI32)
+	b.memory = []byte{0x00, 1}
+
+	callerLen := func(local byte) []byte {
+		return wasmCode(i32c(0), i32c(128), []byte{0x10, hostCaller, 0x21, local})
+	}
+	b.fn("deposit", nil, oneI64, oneI32, wasmCode(
+		callerLen(0),
+		i32c(256), []byte{0x10, hostValue, 0x37, 3, 0},
+		i32c(0), []byte{0x20, 0}, i32c(256), i32c(8), []byte{0x10, hostStorageSet},
+		i32c(512), i32c(1), i32c(256), i32c(8), []byte{0x10, hostEmitLog},
+		[]byte{0x10, hostValue, 0x0b})...)
+	b.fn("get", nil, oneI64, oneI32, wasmCode(
+		callerLen(0),
+		i32c(0), []byte{0x20, 0}, i32c(256), i32c(8), []byte{0x10, hostStorageGet, 0x1a},
+		i32c(256), []byte{0x29, 3, 0, 0x0b})...)
+	b.fn("fail", nil, nil, nil, wasmCode(i32c(600), i32c(4), []byte{0x10, hostRevert, 0x0b})...)
+	b.fn("height", nil, oneI64, nil, 0x10, hostHeight, 0x0b)
+	b.fn("pay", oneI64, oneI32, oneI32, wasmCode(
+		callerLen(1),
+		i32c(0), []byte{0x20, 1, 0x20, 0, 0x10, hostTransfer, 0x0b})...)
+	// relay(which, value) calls deposit (which == 0) or fail on the callee
+	// and returns status*100 + the length of the return data.
+	relay := b.fn("relay", []wasmValType{wasmI32, wasmI64}, oneI32, nil, wasmCode(
+		i32c(700), i32c(64),
+		i32c(820), i32c(800), []byte{0x20, 0, 0x1b},
+		i32c(4), i32c(7), []byte{0x20, 0, 0x1b},
+		i32c(0), i32c(0),
+		[]byte{0x20, 1, 0x42, 0, 0x10, hostCall},
+		i32c(100), []byte{0x6c},
+		i32c(1000), i32c(64), []byte{0x10, hostReturnData, 0x6a, 0x0b})...)
+	// spill and burn write the caller's slot and then revert or run out of
+	// gas; relayFail reverts after a successful relay.
+	b.fn("spill", nil, nil, oneI32, wasmCode(
+		callerLen(0),
+		i32c(0), []byte{0x20, 0}, i32c(256), i32c(8), []byte{0x10, hostStorageSet},
+		i32c(600), i32c(4), []byte{0x10, hostRevert, 0x0b})...)
+	b.fn("burn", nil, nil, oneI32, wasmCode(
+		callerLen(0),
+		i32c(0), []byte{0x20, 0}, i32c(256), i32c(8), []byte{0x10, hostStorageSet},
+		[]byte{0x03, 0x40, 0x0c, 0, 0x0b, 0x0b})...)
+	b.fn("relay_fail", []wasmValType{wasmI32, wasmI64}, nil, nil, wasmCode(
+		[]byte{0x20, 0, 0x20, 1, 0x10, byte(relay), 0x1a},
+		i32c(600), i32c(4), []byte{0x10, hostRevert, 0x0b})...)
+
+	b.segment(512, append([]byte("deposit"), make([]byte, 25)...))
+	b.segment(600, []byte("nope"))
+	b.segment(800, []byte("deposit"))
+	b.segment(820, []byte("fail"))
+	if callee != "" {
+		b.segment(700, []byte(callee))
+	}
+	return b.bytes()
+}
+
+type registryEventRecorder struct {
+	events []ContractRegistryEvent
+}
+
+func (r *registryEventRecorder) HandleContractRegistryEvent(e ContractRegistryEvent) {
+	r.events = append(r.events, e)
+}
+
+func (r *registryEventRecorder) last() ContractRegistryEvent { return r.events[len(r.events)-1] }
+
+func le64(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+
+func TestWASMHostABI(t *testing.T) {
+	vm := runningWASMVM(t)
+	ledger := NewLedger()
+	ledger.Credit("alice", 1_000_000)
+	ledger.Credit("bob", 1_000_000)
+	rec := &registryEventRecorder{}
+	reg := NewContractRegistry(vm, ledger, WithContractRegistryObserver(rec))
+	vault, err := reg.Deploy(vaultModule(""), "", 200_000, "alice")
+	if err != nil {
+		t.Fatalf("deploy vault: %v", err)
+	}
+
+	alice := ledger.GetBalance("alice")
+	out, used, err := reg.InvokeWithValue(vault, "alice", "deposit", nil, 50, 0)
+	if err != nil || !bytes.Equal(out, le64(50)) {
+		t.Fatalf("deposit: %x %v", out, err)
+	}
+	if ledger.GetBalance(vault) != 50 {
+		t.Fatalf("vault balance %d, want 50", ledger.GetBalance(vault))
+	}
+	if ledger.GetBalance("alice") != alice-50-used {
+		t.Fatalf("alice balance %d after paying %d gas", ledger.GetBalance("alice"), used)
+	}
+	topic := hex.EncodeToString(append([]byte("deposit"), make([]byte, 25)...))
+	logs := rec.last().Logs
+	if len(logs) != 1 || logs[0].Address != vault || logs[0].Topics[0] != topic || !bytes.Equal(logs[0].Data, le64(50)) {
+		t.Fatalf("unexpected logs %+v", logs)
+	}
+
+	if out, _, err := reg.InvokeFrom(vault, "alice", "get", nil, 0); err != nil || !bytes.Equal(out, le64(50)) {
+		t.Fatalf("get alice: %x %v", out, err)
+	}
+	if out, _, err := reg.InvokeFrom(vault, "bob", "get", nil, 0); err != nil || !bytes.Equal(out, le64(0)) {
+		t.Fatalf("get bob: %x %v", out, err)
+	}
+
+	before := ledger.GetBalance("alice")
+	_, _, err = reg.InvokeWithValue(vault, "alice", "fail", nil, 10, 0)
+	var revert *RevertError
+	if !errors.As(err, &revert) || string(revert.Data) != "nope" || !errors.Is(err, ErrContractReverted) {
+		t.Fatalf("expected revert with data, got %v", err)
+	}
+	if ledger.GetBalance("alice") != before || ledger.GetBalance(vault) != 50 {
+		t.Fatalf("revert must return value and gas")
+	}
+
+	bob := ledger.GetBalance("bob")
+	out, used, err = reg.InvokeFrom(vault, "bob", "pay", le64(20), 0)
+	if err != nil || !bytes.Equal(out, le32(wasmCallOK)) || ledger.GetBalance("bob") != bob+20-used {
+		t.Fatalf("pay: %x %v", out, err)
+	}
+	if out, _, err := reg.InvokeFrom(vault, "bob", "pay", le64(1000), 0); err != nil || !bytes.Equal(out, le32(wasmCallFailed)) {
+		t.Fatalf("overdraft must report failure: %x %v", out, err)
+	}
+}
+
+func TestWASMHostCrossContractCalls(t *testing.T) {
+	vm := runningWASMVM(t)
+	ledger := NewLedger()
+	ledger.Credit("alice", 1_000_000)
+	rec := &registryEventRecorder{}
+	reg := NewContractRegistry(vm, ledger, WithContractRegistryObserver(rec))
+	vault, err := reg.Deploy(vaultModule(""), "", 200_000, "alice")
+	if err != nil {
+		t.Fatalf("deploy vault: %v", err)
+	}
+	proxy, err := reg.Deploy(vaultModule(vault), "", 200_000, "alice")
+	if err != nil {
+		t.Fatalf("deploy proxy: %v", err)
+	}
+
+	args := append(le32(0), le64(5)...)
+	out, _, err := reg.InvokeWithValue(proxy, "alice", "relay", args, 5, 0)
+	if err != nil || !bytes.Equal(out, le32(8)) {
+		t.Fatalf("relay deposit: %x %v", out, err)
+	}
+	if ledger.GetBalance(vault) != 5 || ledger.GetBalance(proxy) != 0 {
+		t.Fatalf("value not forwarded: vault %d proxy %d", ledger.GetBalance(vault), ledger.GetBalance(proxy))
+	}
+	if logs := rec.last().Logs; len(logs) != 1 || logs[0].Address != vault {
+		t.Fatalf("nested logs not propagated: %+v", logs)
+	}
+	if v, ok, _ := reg.Storage(vault, []byte(proxy)); !ok || !bytes.Equal(v, le64(5)) {
+		t.Fatalf("callee must see the proxy as caller, got %x", v)
+	}
+
+	args = append(le32(1), le64(0)...)
+	if out, _, err := reg.InvokeFrom(proxy, "alice", "relay", args, 0); err != nil || !bytes.Equal(out, le32(100*wasmCallReverted+4)) {
+		t.Fatalf("relay revert: %x %v", out, err)
+	}
+}
+
+func TestWASMHostFunctionsNeedHost(t *testing.T) {
+	vm := runningWASMVM(t)
+	mod := vaultModule("")
+	if out, _, err := vm.Execute(mod, "height", nil, 1000); err != nil || !bytes.Equal(out, le64(0)) {
+		t.Fatalf("height: %x %v", out, err)
+	}
+	if _, _, err := vm.Execute(mod, "get", nil, 1000); !errors.Is(err, ErrHostUnavailable) {
+		t.Fatalf("expected host unavailable, got %v", err)
+	}
+
+	var wrongSig wasmBuilder
+	wrongSig.importFunc("synnergy", "value", nil, oneI32)
+	wrongSig.fn("f", nil, oneI32, nil, 0x10, 0, 0x0b)
+	var unknown wasmBuilder
+	unknown.importFunc("synnergy", "selfdestruct", nil, nil)
+	unknown.fn("f", nil, nil, nil, 0x0b)
+	for name, bin := range map[string][]byte{"signature": wrongSig.bytes(), "unknown": unknown.bytes()} {
+		if _, _, err := CompileWASM(bin); !errors.Is(err, ErrWASMImport) {
+			t.Fatalf("%s: expected import error, got %v", name, err)
+		}
+	}
+}
+
+func TestWASMHostGasPricedByName(t *testing.T) {
+	tbl := GasTable{}
+	for name, cost := range map[string]uint64{"HostBlockHeight": 40, "WasmCall": 0, "WasmControl": 1} {
+		op, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("opcode %s not in catalogue", name)
+		}
+		tbl[op] = cost
+	}
+	vm := runningWASMVM(t, WithWASMGasTable(tbl))
+	// call block_height, return
+	if _, used, err := vm.Execute(vaultModule(""), "height", nil, 1000); err != nil || used != 40+0+1 {
+		t.Fatalf("height used %d gas, err %v", used, err)
+	}
+	if GasCostByName("HostStorageSet") <= GasCostByName("HostStorageGet") {
+		t.Fatalf("storage writes must cost more than reads")
+	}
+}
@@ -0,0 +1,733 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Errors reported by the WebAssembly virtual machine.
+var (
+	ErrWASMInvalidModule  = errors.New("invalid wasm module")
+	ErrWASMImport         = errors.New("unresolved wasm import")
+	ErrWASMExportNotFound = errors.New("wasm export not found")
+	ErrWASMInvalidArgs    = errors.New("invalid wasm arguments")
+	ErrWASMMemoryLimit    = errors.New("wasm memory limit exceeded")
+	ErrWASMTrap           = errors.New("wasm trap")
+)
+
+const (
+	wasmMagic      = "\x00asm"
+	wasmVersion    = 1
+	wasmPageSize   = 1 << 16
+	wasmMaxPages   = 1 << 16
+	wasmMaxTable   = 1 << 16
+	wasmMaxLocals  = 1 << 16
+	wasmMaxDepth   = 1024
+	wasmMaxSegment = 1 << 16
+)
+
+// wasmValType is a WebAssembly value type. The zero value is used during
+// validation for operands of unknown type in unreachable code.
+type wasmValType byte
+
+const (
+	wasmI32 wasmValType = 0x7f
+	wasmI64 wasmValType = 0x7e
+	wasmF32 wasmValType = 0x7d
+	wasmF64 wasmValType = 0x7c
+)
+
+func (t wasmValType) String() string {
+	switch t {
+	case wasmI32:
+		return "i32"
+	case wasmI64:
+		return "i64"
+	case wasmF32:
+		return "f32"
+	case wasmF64:
+		return "f64"
+	default:
+		return "unknown"
+	}
+}
+
+// size returns the number of bytes used to pass the value in call arguments
+// and results.
+func (t wasmValType) size() int {
+	if t == wasmI32 || t == wasmF32 {
+		return 4
+	}
+	return 8
+}
+
+type wasmFuncType struct {
+	params  []wasmValType
+	results []wasmValType
+}
+
+func (ft wasmFuncType) equal(o wasmFuncType) bool {
+	if len(ft.params) != len(o.params) || len(ft.results) != len(o.results) {
+		return false
+	}
+	for i := range ft.params {
+		if ft.params[i] != o.params[i] {
+			return false
+		}
+	}
+	for i := range ft.results {
+		if ft.results[i] != o.results[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type wasmLimits struct {
+	min    uint32
+	max    uint32
+	hasMax bool
+}
+
+type wasmImport struct {
+	module, name string
+	typeIdx      uint32
+	host         *wasmHostFunc
+}
+
+type wasmGlobal struct {
+	typ     wasmValType
+	mutable bool
+	init    uint64
+}
+
+type wasmExport struct {
+	kind  byte
+	index uint32
+}
+
+type wasmElem struct {
+	offset uint32
+	funcs  []uint32
+}
+
+type wasmData struct {
+	offset uint32
+	init   []byte
+}
+
+// wasmModule is a decoded and validated module. Function bodies are compiled
+// by validateWASMModule and the module is immutable afterwards, so it may be
+// shared between executions.
+type wasmModule struct {
+	types   []wasmFuncType
+	imports []wasmImport
+	funcs   []*wasmFunc
+	table   *wasmLimits
+	memory  *wasmLimits
+	globals []wasmGlobal
+	exports map[string]wasmExport
+	start   int64
+	elems   []wasmElem
+	data    []wasmData
+}
+
+// funcType returns the signature of function idx in the function index space,
+// which numbers imported functions before the module's own.
+func (m *wasmModule) funcType(idx uint32) (wasmFuncType, bool) {
+	if int(idx) < len(m.imports) {
+		return m.types[m.imports[idx].typeIdx], true
+	}
+	idx -= uint32(len(m.imports))
+	if int(idx) < len(m.funcs) {
+		return m.funcs[idx].typ, true
+	}
+	return wasmFuncType{}, false
+}
+
+const (
+	wasmExternFunc   = 0x00
+	wasmExternTable  = 0x01
+	wasmExternMemory = 0x02
+	wasmExternGlobal = 0x03
+)
+
+type wasmReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *wasmReader) eof() bool { return r.pos >= len(r.buf) }
+
+func (r *wasmReader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errors.New("unexpected end")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *wasmReader) bytes(n uint32) ([]byte, error) {
+	if uint64(n) > uint64(len(r.buf)-r.pos) {
+		return nil, errors.New("unexpected end")
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// leb reads an LEB128 integer of at most bits bits.
+func (r *wasmReader) leb(bits uint, signed bool) (uint64, error) {
+	var result uint64
+	var shift uint
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift+7 >= bits {
+			// The final byte may only use the bits that fit and, for
+			// signed values, must sign-extend them.
+			rem := bits - shift
+			if b&0x80 != 0 {
+				return 0, errors.New("integer representation too long")
+			}
+			if rem < 7 {
+				unused := int8(b<<1) >> rem
+				if signed {
+					if unused != 0 && unused != -1 {
+						return 0, errors.New("integer too large")
+					}
+				} else if b>>rem != 0 {
+					return 0, errors.New("integer too large")
+				}
+			}
+			result |= uint64(b&0x7f) << shift
+			shift += 7
+			break
+		}
+		result |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if signed && shift < 64 && result&(1<<(shift-1)) != 0 {
+		result |= ^uint64(0) << shift
+	}
+	return result, nil
+}
+
+func (r *wasmReader) u32() (uint32, error) {
+	v, err := r.leb(32, false)
+	return uint32(v), err
+}
+
+func (r *wasmReader) s32() (int32, error) {
+	v, err := r.leb(32, true)
+	return int32(v), err
+}
+
+func (r *wasmReader) s64() (int64, error) {
+	v, err := r.leb(64, true)
+	return int64(v), err
+}
+
+func (r *wasmReader) fixed32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *wasmReader) fixed64() (uint64, error) {
+	b, err := r.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (r *wasmReader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", errors.New("malformed UTF-8 name")
+	}
+	return string(b), nil
+}
+
+// count reads a vector length, rejecting lengths that cannot fit in the
+// remaining input given at least min bytes per element.
+func (r *wasmReader) count(min int) (uint32, error) {
+	n, err := r.u32()
+	if err != nil {
+		return 0, err
+	}
+	if uint64(n)*uint64(min) > uint64(len(r.buf)-r.pos) {
+		return 0, errors.New("vector length exceeds input")
+	}
+	return n, nil
+}
+
+func (r *wasmReader) valType() (wasmValType, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch t := wasmValType(b); t {
+	case wasmI32, wasmI64, wasmF32, wasmF64:
+		return t, nil
+	default:
+		return 0, fmt.Errorf("invalid value type 0x%02x", b)
+	}
+}
+
+func (r *wasmReader) limits(max uint32) (wasmLimits, error) {
+	flag, err := r.byte()
+	if err != nil {
+		return wasmLimits{}, err
+	}
+	var l wasmLimits
+	switch flag {
+	case 0x00:
+	case 0x01:
+		l.hasMax = true
+	default:
+		return l, fmt.Errorf("invalid limits flag 0x%02x", flag)
+	}
+	if l.min, err = r.u32(); err != nil {
+		return l, err
+	}
+	if l.hasMax {
+		if l.max, err = r.u32(); err != nil {
+			return l, err
+		}
+		if l.max < l.min {
+			return l, errors.New("size minimum must not be greater than maximum")
+		}
+	}
+	if l.min > max || (l.hasMax && l.max > max) {
+		return l, fmt.Errorf("size must be at most %d", max)
+	}
+	return l, nil
+}
+
+// constExpr reads a constant initialiser of type want. Imported globals are
+// not supported, so only the *.const instructions are accepted.
+func (r *wasmReader) constExpr(want wasmValType) (uint64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	var got wasmValType
+	switch op {
+	case 0x41:
+		x, err := r.s32()
+		if err != nil {
+			return 0, err
+		}
+		v, got = uint64(uint32(x)), wasmI32
+	case 0x42:
+		x, err := r.s64()
+		if err != nil {
+			return 0, err
+		}
+		v, got = uint64(x), wasmI64
+	case 0x43:
+		x, err := r.fixed32()
+		if err != nil {
+			return 0, err
+		}
+		v, got = uint64(x), wasmF32
+	case 0x44:
+		if v, err = r.fixed64(); err != nil {
+			return 0, err
+		}
+		got = wasmF64
+	default:
+		return 0, fmt.Errorf("unsupported constant expression opcode 0x%02x", op)
+	}
+	if got != want {
+		return 0, fmt.Errorf("type mismatch in constant expression: expected %s, got %s", want, got)
+	}
+	if end, err := r.byte(); err != nil || end != 0x0b {
+		return 0, errors.New("constant expression must end after one instruction")
+	}
+	return v, nil
+}
+
+// decodeWASMModule parses a binary module and validates it, compiling the
+// function bodies for execution.
+func decodeWASMModule(bin []byte) (*wasmModule, error) {
+	m, err := parseWASMModule(bin)
+	if err == nil {
+		err = validateWASMModule(m)
+	}
+	if err == nil {
+		err = resolveWASMImports(m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWASMInvalidModule, err)
+	}
+	return m, nil
+}
+
+func parseWASMModule(bin []byte) (*wasmModule, error) {
+	if len(bin) < 8 || string(bin[:4]) != wasmMagic {
+		return nil, errors.New("missing magic header")
+	}
+	if v := binary.LittleEndian.Uint32(bin[4:8]); v != wasmVersion {
+		return nil, fmt.Errorf("unsupported version %d", v)
+	}
+	m := &wasmModule{exports: make(map[string]wasmExport), start: -1}
+	var funcTypes []uint32
+	var bodies [][]byte
+	r := &wasmReader{buf: bin, pos: 8}
+	var last byte
+	for !r.eof() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.bytes(size)
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %v", id, err)
+		}
+		if id == 0 {
+			sr := &wasmReader{buf: payload}
+			if _, err := sr.name(); err != nil {
+				return nil, fmt.Errorf("custom section: %v", err)
+			}
+			continue
+		}
+		if id > 11 {
+			return nil, fmt.Errorf("unknown section %d", id)
+		}
+		if id <= last {
+			return nil, fmt.Errorf("section %d out of order", id)
+		}
+		last = id
+		sr := &wasmReader{buf: payload}
+		switch id {
+		case 1:
+			err = parseTypeSection(sr, m)
+		case 2:
+			err = parseImportSection(sr, m)
+		case 3:
+			funcTypes, err = parseFunctionSection(sr, m)
+		case 4:
+			err = parseTableSection(sr, m)
+		case 5:
+			err = parseMemorySection(sr, m)
+		case 6:
+			err = parseGlobalSection(sr, m)
+		case 7:
+			err = parseExportSection(sr, m)
+		case 8:
+			var idx uint32
+			if idx, err = sr.u32(); err == nil {
+				m.start = int64(idx)
+			}
+		case 9:
+			err = parseElementSection(sr, m)
+		case 10:
+			bodies, err = parseCodeSection(sr)
+		case 11:
+			err = parseDataSection(sr, m)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %v", id, err)
+		}
+		if !sr.eof() {
+			return nil, fmt.Errorf("section %d: size mismatch", id)
+		}
+	}
+	if len(funcTypes) != len(bodies) {
+		return nil, errors.New("function and code section have inconsistent lengths")
+	}
+	for i, ti := range funcTypes {
+		m.funcs = append(m.funcs, &wasmFunc{typ: m.types[ti], body: bodies[i]})
+	}
+	return m, nil
+}
+
+func parseTypeSection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(3)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if form, err := r.byte(); err != nil || form != 0x60 {
+			return errors.New("invalid function type")
+		}
+		var ft wasmFuncType
+		for _, dst := range []*[]wasmValType{&ft.params, &ft.results} {
+			c, err := r.count(1)
+			if err != nil {
+				return err
+			}
+			for j := uint32(0); j < c; j++ {
+				t, err := r.valType()
+				if err != nil {
+					return err
+				}
+				*dst = append(*dst, t)
+			}
+		}
+		if len(ft.results) > 1 {
+			return errors.New("multiple return values are not supported")
+		}
+		m.types = append(m.types, ft)
+	}
+	return nil
+}
+
+func parseImportSection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(4)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		var imp wasmImport
+		if imp.module, err = r.name(); err != nil {
+			return err
+		}
+		if imp.name, err = r.name(); err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if kind != wasmExternFunc {
+			return fmt.Errorf("import %s.%s: only function imports are supported", imp.module, imp.name)
+		}
+		if imp.typeIdx, err = r.u32(); err != nil {
+			return err
+		}
+		if int(imp.typeIdx) >= len(m.types) {
+			return fmt.Errorf("import %s.%s: unknown type %d", imp.module, imp.name, imp.typeIdx)
+		}
+		m.imports = append(m.imports, imp)
+	}
+	return nil
+}
+
+func parseFunctionSection(r *wasmReader, m *wasmModule) ([]uint32, error) {
+	n, err := r.count(1)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]uint32, n)
+	for i := range out {
+		if out[i], err = r.u32(); err != nil {
+			return nil, err
+		}
+		if int(out[i]) >= len(m.types) {
+			return nil, fmt.Errorf("unknown type %d", out[i])
+		}
+	}
+	return out, nil
+}
+
+func parseTableSection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(3)
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		return errors.New("multiple tables")
+	}
+	if n == 1 {
+		if et, err := r.byte(); err != nil || et != 0x70 {
+			return errors.New("table element type must be funcref")
+		}
+		l, err := r.limits(wasmMaxTable)
+		if err != nil {
+			return err
+		}
+		m.table = &l
+	}
+	return nil
+}
+
+func parseMemorySection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(2)
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		return errors.New("multiple memories")
+	}
+	if n == 1 {
+		l, err := r.limits(wasmMaxPages)
+		if err != nil {
+			return err
+		}
+		m.memory = &l
+	}
+	return nil
+}
+
+func parseGlobalSection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(4)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		var g wasmGlobal
+		if g.typ, err = r.valType(); err != nil {
+			return err
+		}
+		mut, err := r.byte()
+		if err != nil || mut > 1 {
+			return errors.New("invalid global mutability")
+		}
+		g.mutable = mut == 1
+		if g.init, err = r.constExpr(g.typ); err != nil {
+			return err
+		}
+		m.globals = append(m.globals, g)
+	}
+	return nil
+}
+
+func parseExportSection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(3)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		var e wasmExport
+		if e.kind, err = r.byte(); err != nil {
+			return err
+		}
+		if e.index, err = r.u32(); err != nil {
+			return err
+		}
+		if e.kind > wasmExternGlobal {
+			return fmt.Errorf("export %q: invalid kind %d", name, e.kind)
+		}
+		if _, dup := m.exports[name]; dup {
+			return fmt.Errorf("duplicate export name %q", name)
+		}
+		m.exports[name] = e
+	}
+	return nil
+}
+
+func parseElementSection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(4)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if tbl, err := r.u32(); err != nil || tbl != 0 {
+			return errors.New("element segment must target table 0")
+		}
+		var e wasmElem
+		off, err := r.constExpr(wasmI32)
+		if err != nil {
+			return err
+		}
+		e.offset = uint32(off)
+		c, err := r.count(1)
+		if err != nil {
+			return err
+		}
+		e.funcs = make([]uint32, c)
+		for j := range e.funcs {
+			if e.funcs[j], err = r.u32(); err != nil {
+				return err
+			}
+		}
+		m.elems = append(m.elems, e)
+	}
+	return nil
+}
+
+func parseCodeSection(r *wasmReader) ([][]byte, error) {
+	n, err := r.count(2)
+	if err != nil {
+		return nil, err
+	}
+	bodies := make([][]byte, n)
+	for i := range bodies {
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if bodies[i], err = r.bytes(size); err != nil {
+			return nil, err
+		}
+	}
+	return bodies, nil
+}
+
+func parseDataSection(r *wasmReader, m *wasmModule) error {
+	n, err := r.count(4)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if mem, err := r.u32(); err != nil || mem != 0 {
+			return errors.New("data segment must target memory 0")
+		}
+		var d wasmData
+		off, err := r.constExpr(wasmI32)
+		if err != nil {
+			return err
+		}
+		d.offset = uint32(off)
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if d.init, err = r.bytes(size); err != nil {
+			return err
+		}
+		m.data = append(m.data, d)
+	}
+	return nil
+}
+
+// canonical NaN encodings keep float results identical on every platform.
+const (
+	wasmCanonicalNaN32 = 0x7fc00000
+	wasmCanonicalNaN64 = 0x7ff8000000000000
+)
+
+func wasmF32Bits(v float32) uint64 {
+	if v != v {
+		return wasmCanonicalNaN32
+	}
+	return uint64(math.Float32bits(v))
+}
+
+func wasmF64Bits(v float64) uint64 {
+	if v != v {
+		return wasmCanonicalNaN64
+	}
+	return math.Float64bits(v)
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// DefaultWASMMemoryLimit caps linear memory when no sandbox limit is set.
+const DefaultWASMMemoryLimit = 16 << 20
+
+// wasmModuleCacheSize bounds the number of compiled modules kept in memory.
+const wasmModuleCacheSize = 128
+
+// WASMVM executes WebAssembly MVP modules with a pure-Go interpreter. Each
+// instruction is charged from the gas table by instruction class and linear
+// memory is capped by the sandbox memory limit. It satisfies the
+// VirtualMachine interface and is safe for concurrent use.
+//
+// Contract methods are exported functions. Arguments are passed as the
+// concatenated little-endian encoding of the function's parameters (4 bytes
+// for i32 and f32, 8 bytes for i64 and f64) and results are returned in the
+// same encoding. Float results with NaN values are canonicalised so every
+// platform computes identical state. Modules may import the synnergy host
+// ABI, which ExecuteCall binds to a CallContext.
+type WASMVM struct {
+	mu       sync.RWMutex
+	running  bool
+	gasTable GasTable
+	memLimit uint64
+	modules  map[[32]byte]*wasmModule
+}
+
+// WASMVMOption configures a WASMVM.
+type WASMVMOption func(*WASMVM)
+
+// WithWASMGasTable prices instructions from tbl instead of the global gas
+// table. Classes missing from tbl cost DefaultGasCost.
+func WithWASMGasTable(tbl GasTable) WASMVMOption {
+	return func(vm *WASMVM) { vm.gasTable = tbl }
+}
+
+// WithWASMSandbox applies the memory limit of a sandbox. A zero limit keeps
+// DefaultWASMMemoryLimit.
+func WithWASMSandbox(info SandboxInfo) WASMVMOption {
+	return func(vm *WASMVM) {
+		if info.MemoryLimit > 0 {
+			vm.memLimit = info.MemoryLimit
+		}
+	}
+}
+
+// NewWASMVM creates a stopped WebAssembly virtual machine.
+func NewWASMVM(opts ...WASMVMOption) *WASMVM {
+	vm := &WASMVM{memLimit: DefaultWASMMemoryLimit, modules: make(map[[32]byte]*wasmModule)}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(vm)
+		}
+	}
+	return vm
+}
+
+// Start marks the VM as running. It is safe to call multiple times.
+func (vm *WASMVM) Start() error {
+	vm.mu.Lock()
+	vm.running = true
+	vm.mu.Unlock()
+	return nil
+}
+
+// Stop halts the VM instance.
+func (vm *WASMVM) Stop() error {
+	vm.mu.Lock()
+	vm.running = false
+	vm.mu.Unlock()
+	return nil
+}
+
+// Status reports whether the VM is running.
+func (vm *WASMVM) Status() bool {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	return vm.running
+}
+
+// Validate parses and validates a module without executing it, allowing the
+// contract registry to reject invalid bytecode at deployment.
+func (vm *WASMVM) Validate(wasm []byte) error {
+	_, err := vm.module(wasm)
+	return err
+}
+
+// module returns the compiled module for wasm, compiling it on first use.
+func (vm *WASMVM) module(wasm []byte) (*wasmModule, error) {
+	key := sha256.Sum256(wasm)
+	vm.mu.RLock()
+	m, ok := vm.modules[key]
+	vm.mu.RUnlock()
+	if ok {
+		return m, nil
+	}
+	m, err := decodeWASMModule(wasm)
+	if err != nil {
+		return nil, err
+	}
+	vm.mu.Lock()
+	if len(vm.modules) >= wasmModuleCacheSize {
+		clear(vm.modules)
+	}
+	vm.modules[key] = m
+	vm.mu.Unlock()
+	return m, nil
+}
+
+func (vm *WASMVM) gasCost(name string) uint64 {
+	if vm.gasTable == nil {
+		return GasCostByName(name)
+	}
+	op, ok := Lookup(name)
+	if !ok {
+		return DefaultGasCost
+	}
+	if cost, ok := vm.gasTable[op]; ok {
+		return cost
+	}
+	return DefaultGasCost
+}
+
+// Execute runs method with args under gasLimit.
+func (vm *WASMVM) Execute(wasm []byte, method string, args []byte, gasLimit uint64) ([]byte, uint64, error) {
+	return vm.ExecuteContext(context.Background(), wasm, method, args, gasLimit)
+}
+
+// ExecuteContext runs method like Execute and aborts when ctx is cancelled.
+// The gas consumed is reported even when execution fails.
+func (vm *WASMVM) ExecuteContext(ctx context.Context, wasm []byte, method string, args []byte, gasLimit uint64) ([]byte, uint64, error) {
+	return vm.ExecuteCall(ctx, nil, wasm, method, args, gasLimit)
+}
+
+// ExecuteCall runs method like ExecuteContext and exposes call to the
+// contract through the synnergy host ABI. Logs emitted by the contract are
+// appended to call.Logs. Without a call context, host functions that access
+// chain state fail with ErrHostUnavailable.
+func (vm *WASMVM) ExecuteCall(ctx context.Context, call *CallContext, wasm []byte, method string, args []byte, gasLimit uint64) (out []byte, gasUsed uint64, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !vm.Status() {
+		return nil, 0, errVMNotRunning
+	}
+	if len(wasm) == 0 {
+		return nil, 0, errBytecodeRequired
+	}
+	if gasLimit == 0 {
+		return nil, 0, errGasLimitNotDefined
+	}
+	m, err := vm.module(wasm)
+	if err != nil {
+		return nil, 0, err
+	}
+	exp, ok := m.exports[method]
+	if !ok || exp.kind != wasmExternFunc {
+		return nil, 0, fmt.Errorf("%w: %q", ErrWASMExportNotFound, method)
+	}
+	ft, _ := m.funcType(exp.index)
+	params, err := decodeWASMArgs(ft.params, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vm.mu.RLock()
+	pages := vm.memLimit / wasmPageSize
+	vm.mu.RUnlock()
+	in, err := m.instantiate(ctx, uint32(min(pages, wasmMaxPages)))
+	if err != nil {
+		return nil, 0, err
+	}
+	in.gasLimit, in.gasLeft = gasLimit, gasLimit
+	for class, name := range wasmGasNames {
+		in.costs[class] = vm.gasCost(name)
+	}
+	in.pageCost = vm.gasCost(wasmMemoryPageGas)
+	in.wordCost = vm.gasCost(wasmHostWordGas)
+	in.hostCosts = make([]uint64, len(m.imports))
+	for i, imp := range m.imports {
+		in.hostCosts[i] = vm.gasCost(imp.host.gas)
+	}
+	if call != nil {
+		in.env = call
+		in.trace = call.trace
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("vm panic: %v", r)
+		}
+		gasUsed = in.gasUsed()
+	}()
+
+	if m.start >= 0 {
+		if err := in.call(uint32(m.start)); err != nil {
+			return nil, 0, err
+		}
+	}
+	in.stack = append(in.stack[:0], params...)
+	in.sp = len(params)
+	if err := in.call(exp.index); err != nil {
+		return nil, 0, err
+	}
+	return encodeWASMResults(ft.results, in.stack[:in.sp]), 0, nil
+}
+
+func decodeWASMArgs(types []wasmValType, args []byte) ([]uint64, error) {
+	want := 0
+	for _, t := range types {
+		want += t.size()
+	}
+	if len(args) != want {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrWASMInvalidArgs, want, len(args))
+	}
+	vals := make([]uint64, len(types))
+	for i, t := range types {
+		if t.size() == 4 {
+			vals[i] = uint64(binary.LittleEndian.Uint32(args))
+		} else {
+			vals[i] = binary.LittleEndian.Uint64(args)
+		}
+		args = args[t.size():]
+	}
+	return vals, nil
+}
+
+func encodeWASMResults(types []wasmValType, vals []uint64) []byte {
+	out := make([]byte, 0, 8*len(types))
+	for i, t := range types {
+		if t.size() == 4 {
+			out = binary.LittleEndian.AppendUint32(out, uint32(vals[i]))
+		} else {
+			out = binary.LittleEndian.AppendUint64(out, vals[i])
+		}
+	}
+	return out
+}
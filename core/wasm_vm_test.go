@@ -0,0 +1,359 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// wasmBuilder assembles binary modules for tests. Each function gets its own
+// type, so a function's index is also the index of its type.
+type wasmBuilder struct {
+	types   [][]byte
+	imports [][]byte
+	funcs   []byte
+	codes   [][]byte
+	exports [][]byte
+	table   []byte
+	memory  []byte
+	elems   [][]byte
+	data    [][]byte
+	nfuncs  uint32
+}
+
+func wasmU32(v uint32) []byte {
+	return binary.AppendUvarint(nil, uint64(v))
+}
+
+func wasmVec(items ...[]byte) []byte {
+	out := wasmU32(uint32(len(items)))
+	for _, it := range items {
+		out = append(out, it...)
+	}
+	return out
+}
+
+func wasmName(s string) []byte { return append(wasmU32(uint32(len(s))), s...) }
+
+func wasmTypes(ts []wasmValType) []byte {
+	out := wasmU32(uint32(len(ts)))
+	for _, t := range ts {
+		out = append(out, byte(t))
+	}
+	return out
+}
+
+func (b *wasmBuilder) addType(params, results []wasmValType) uint32 {
+	ft := append(append([]byte{0x60}, wasmTypes(params)...), wasmTypes(results)...)
+	b.types = append(b.types, ft)
+	return uint32(len(b.types) - 1)
+}
+
+func (b *wasmBuilder) importFunc(module, name string, params, results []wasmValType) uint32 {
+	ti := b.addType(params, results)
+	imp := append(append(wasmName(module), wasmName(name)...), 0x00)
+	b.imports = append(b.imports, append(imp, wasmU32(ti)...))
+	b.nfuncs++
+	return b.nfuncs - 1
+}
+
+// fn adds a function with the given locals and body, which must include the
+// final end opcode, and exports it under name unless name is empty.
+func (b *wasmBuilder) fn(name string, params, results, locals []wasmValType, body ...byte) uint32 {
+	ti := b.addType(params, results)
+	b.funcs = append(b.funcs, wasmU32(ti)...)
+	var groups [][]byte
+	for _, t := range locals {
+		groups = append(groups, []byte{1, byte(t)})
+	}
+	code := append(wasmVec(groups...), body...)
+	b.codes = append(b.codes, append(wasmU32(uint32(len(code))), code...))
+	idx := b.nfuncs
+	b.nfuncs++
+	if name != "" {
+		b.exports = append(b.exports, append(append(wasmName(name), 0x00), wasmU32(idx)...))
+	}
+	return idx
+}
+
+func (b *wasmBuilder) bytes() []byte {
+	out := []byte("\x00asm\x01\x00\x00\x00")
+	section := func(id byte, payload []byte) {
+		out = append(out, id)
+		out = append(out, wasmU32(uint32(len(payload)))...)
+		out = append(out, payload...)
+	}
+	section(1, wasmVec(b.types...))
+	if len(b.imports) > 0 {
+		section(2, wasmVec(b.imports...))
+	}
+	section(3, append(wasmU32(uint32(len(b.codes))), b.funcs...))
+	if b.table != nil {
+		section(4, append([]byte{1, 0x70}, b.table...))
+	}
+	if b.memory != nil {
+		section(5, append([]byte{1}, b.memory...))
+	}
+	section(7, wasmVec(b.exports...))
+	if len(b.elems) > 0 {
+		section(9, wasmVec(b.elems...))
+	}
+	section(10, wasmVec(b.codes...))
+	if len(b.data) > 0 {
+		section(11, wasmVec(b.data...))
+	}
+	return out
+}
+
+var (
+	oneI32 = []wasmValType{wasmI32}
+	oneI64 = []wasmValType{wasmI64}
+)
+
+func le32(vs ...uint32) []byte {
+	var out []byte
+	for _, v := range vs {
+		out = binary.LittleEndian.AppendUint32(out, v)
+	}
+	return out
+}
+
+func runningWASMVM(t *testing.T, opts ...WASMVMOption) *WASMVM {
+	t.Helper()
+	vm := NewWASMVM(opts...)
+	if err := vm.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return vm
+}
+
+// controlFlowModule exports add, fib (recursive calls), fact (loops), pick
+// (br_table), carry (branching with a value over an operand), nan, div and
+// trap.
+func controlFlowModule() []byte {
+	var b wasmBuilder
+	b.fn("add", []wasmValType{wasmI32, wasmI32}, oneI32, nil, 0x20, 0, 0x20, 1, 0x6a, 0x0b)
+	fib := b.nfuncs
+	b.fn("fib", oneI32, oneI32, nil,
+		0x20, 0, 0x41, 2, 0x49,
+		0x04, 0x7f,
+		0x20, 0,
+		0x05,
+		0x20, 0, 0x41, 1, 0x6b, 0x10, byte(fib),
+		0x20, 0, 0x41, 2, 0x6b, 0x10, byte(fib),
+		0x6a,
+		0x0b, 0x0b)
+	b.fn("fact", oneI64, oneI64, oneI64,
+		0x42, 1, 0x21, 1,
+		0x02, 0x40, 0x03, 0x40,
+		0x20, 0, 0x50, 0x0d, 1,
+		0x20, 1, 0x20, 0, 0x7e, 0x21, 1,
+		0x20, 0, 0x42, 1, 0x7d, 0x21, 0,
+		0x0c, 0,
+		0x0b, 0x0b,
+		0x20, 1, 0x0b)
+	b.fn("pick", oneI32, oneI32, nil,
+		0x02, 0x40, 0x02, 0x40, 0x02, 0x40,
+		0x20, 0, 0x0e, 2, 0, 1, 2,
+		0x0b, 0x41, 10, 0x0f,
+		0x0b, 0x41, 20, 0x0f,
+		0x0b, 0x41, 30, 0x0b)
+	b.fn("carry", nil, oneI32, nil,
+		0x41, 50,
+		0x02, 0x7f, 0x41, 5, 0x41, 7, 0x41, 1, 0x0d, 0, 0x1a, 0x1a, 0x41, 9, 0x0b,
+		0x6a, 0x0b)
+	b.fn("nan", nil, []wasmValType{wasmF32}, nil, 0x43, 0, 0, 0, 0, 0x43, 0, 0, 0, 0, 0x95, 0x0b)
+	b.fn("div", []wasmValType{wasmI32, wasmI32}, oneI32, nil, 0x20, 0, 0x20, 1, 0x6d, 0x0b)
+	b.fn("trap", nil, nil, nil, 0x00, 0x0b)
+	b.fn("spin", nil, nil, nil, 0x03, 0x40, 0x0c, 0, 0x0b, 0x0b)
+	return b.bytes()
+}
+
+func TestWASMVMExecutesExportedFunctions(t *testing.T) {
+	vm := runningWASMVM(t)
+	mod := controlFlowModule()
+	cases := []struct {
+		method string
+		args   []byte
+		want   []byte
+	}{
+		{"add", le32(40, 2), le32(42)},
+		{"add", le32(math.MaxUint32, 2), le32(1)},
+		{"fib", le32(10), le32(55)},
+		{"fact", binary.LittleEndian.AppendUint64(nil, 20), binary.LittleEndian.AppendUint64(nil, 2432902008176640000)},
+		{"pick", le32(0), le32(10)},
+		{"pick", le32(1), le32(20)},
+		{"pick", le32(7), le32(30)},
+		{"carry", nil, le32(57)},
+		{"nan", nil, le32(wasmCanonicalNaN32)},
+		{"trap", nil, nil},
+	}
+	for _, tc := range cases {
+		out, used, err := vm.Execute(mod, tc.method, tc.args, 1_000_000)
+		if tc.method == "trap" {
+			if !errors.Is(err, ErrWASMTrap) || used == 0 {
+				t.Fatalf("trap: expected trap with gas used, got %v (gas %d)", err, used)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.method, err)
+		}
+		if string(out) != string(tc.want) {
+			t.Fatalf("%s(%x) = %x, want %x", tc.method, tc.args, out, tc.want)
+		}
+	}
+
+	if _, _, err := vm.Execute(mod, "div", le32(1, 0), 1000); !errors.Is(err, ErrWASMTrap) {
+		t.Fatalf("expected divide by zero trap, got %v", err)
+	}
+	if _, _, err := vm.Execute(mod, "missing", nil, 1000); !errors.Is(err, ErrWASMExportNotFound) {
+		t.Fatalf("expected missing export, got %v", err)
+	}
+	if _, _, err := vm.Execute(mod, "add", le32(1), 1000); !errors.Is(err, ErrWASMInvalidArgs) {
+		t.Fatalf("expected invalid args, got %v", err)
+	}
+	if err := vm.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, _, err := vm.Execute(mod, "add", le32(1, 2), 1000); err == nil {
+		t.Fatalf("expected error from stopped vm")
+	}
+}
+
+func TestWASMVMMetersGasFromTable(t *testing.T) {
+	tbl := GasTable{}
+	for name, cost := range map[string]uint64{"WasmVariable": 3, "WasmIntArith": 5, "WasmControl": 7} {
+		op, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("opcode %s not in catalogue", name)
+		}
+		tbl[op] = cost
+	}
+	vm := runningWASMVM(t, WithWASMGasTable(tbl))
+	mod := controlFlowModule()
+
+	// local.get, local.get, oneI32.add, return
+	_, used, err := vm.Execute(mod, "add", le32(1, 2), 100)
+	if err != nil || used != 3+3+5+7 {
+		t.Fatalf("add used %d gas, err %v", used, err)
+	}
+	if _, used, err := vm.Execute(mod, "add", le32(1, 2), 17); !errors.Is(err, ErrGasLimit) || used != 17 {
+		t.Fatalf("expected out of gas using the whole limit, got %v (gas %d)", err, used)
+	}
+	if _, used, err := vm.Execute(mod, "spin", nil, 10_000); !errors.Is(err, ErrGasLimit) || used != 10_000 {
+		t.Fatalf("infinite loop must run out of gas, got %v (gas %d)", err, used)
+	}
+}
+
+func memoryModule(minPages byte) []byte {
+	var b wasmBuilder
+	b.memory = []byte{0x01, minPages, 4}
+	b.data = append(b.data, append([]byte{0, 0x41, 16, 0x0b}, wasmName("hi")...))
+	b.fn("grow", oneI32, oneI32, nil, 0x20, 0, 0x40, 0x00, 0x0b)
+	b.fn("roundtrip", []wasmValType{wasmI32, wasmI64}, oneI64, nil,
+		0x20, 0, 0x20, 1, 0x37, 3, 0,
+		0x20, 0, 0x29, 3, 0, 0x0b)
+	b.fn("byte", oneI32, oneI32, nil, 0x20, 0, 0x2d, 0, 0, 0x0b)
+	return b.bytes()
+}
+
+func TestWASMVMCapsMemoryAtSandboxLimit(t *testing.T) {
+	vm := runningWASMVM(t, WithWASMSandbox(SandboxInfo{MemoryLimit: 2 * wasmPageSize}))
+	mod := memoryModule(1)
+
+	if out, _, err := vm.Execute(mod, "grow", le32(1), 1000); err != nil || string(out) != string(le32(1)) {
+		t.Fatalf("grow within limit: %x %v", out, err)
+	}
+	if out, _, err := vm.Execute(mod, "grow", le32(2), 1000); err != nil || string(out) != string(le32(math.MaxUint32)) {
+		t.Fatalf("grow beyond limit must fail with -1: %x %v", out, err)
+	}
+	if out, _, err := vm.Execute(mod, "byte", le32(17), 1000); err != nil || string(out) != string(le32('i')) {
+		t.Fatalf("data segment: %x %v", out, err)
+	}
+	args := binary.LittleEndian.AppendUint64(le32(wasmPageSize-8), 1<<40+7)
+	if out, _, err := vm.Execute(mod, "roundtrip", args, 1000); err != nil || binary.LittleEndian.Uint64(out) != 1<<40+7 {
+		t.Fatalf("store/load: %x %v", out, err)
+	}
+	args = binary.LittleEndian.AppendUint64(le32(wasmPageSize-4), 1)
+	if _, _, err := vm.Execute(mod, "roundtrip", args, 1000); !errors.Is(err, ErrWASMTrap) {
+		t.Fatalf("expected out of bounds trap, got %v", err)
+	}
+	if _, _, err := vm.Execute(memoryModule(3), "byte", le32(0), 1000); !errors.Is(err, ErrWASMMemoryLimit) {
+		t.Fatalf("expected memory limit error, got %v", err)
+	}
+}
+
+func TestWASMVMIndirectCalls(t *testing.T) {
+	var b wasmBuilder
+	add := b.fn("", []wasmValType{wasmI32, wasmI32}, oneI32, nil, 0x20, 0, 0x20, 1, 0x6a, 0x0b)
+	neg := b.fn("", oneI32, oneI32, nil, 0x41, 0, 0x20, 0, 0x6b, 0x0b)
+	b.fn("dispatch", oneI32, oneI32, nil, 0x41, 5, 0x41, 6, 0x20, 0, 0x11, byte(add), 0x00, 0x0b)
+	b.table = []byte{0x00, 3}
+	b.elems = append(b.elems, append([]byte{0, 0x41, 0, 0x0b}, wasmVec([]byte{byte(add)}, []byte{byte(neg)})...))
+	mod := b.bytes()
+	vm := runningWASMVM(t)
+
+	if out, _, err := vm.Execute(mod, "dispatch", le32(0), 1000); err != nil || string(out) != string(le32(11)) {
+		t.Fatalf("dispatch: %x %v", out, err)
+	}
+	for _, idx := range []uint32{1, 2, 3} {
+		if _, _, err := vm.Execute(mod, "dispatch", le32(idx), 1000); !errors.Is(err, ErrWASMTrap) {
+			t.Fatalf("dispatch(%d): expected trap, got %v", idx, err)
+		}
+	}
+}
+
+func TestWASMValidationRejectsInvalidModules(t *testing.T) {
+	var mismatch wasmBuilder
+	mismatch.fn("f", nil, oneI32, nil, 0x42, 1, 0x0b)
+	var underflow wasmBuilder
+	underflow.fn("f", nil, oneI32, nil, 0x6a, 0x0b)
+	var badLocal wasmBuilder
+	badLocal.fn("f", nil, nil, nil, 0x20, 3, 0x1a, 0x0b)
+	var noMemory wasmBuilder
+	noMemory.fn("f", nil, oneI32, nil, 0x41, 0, 0x28, 2, 0, 0x0b)
+
+	for name, mod := range map[string][]byte{
+		"placeholder": []byte("placeholder wasm for token faucet contract"),
+		"mismatch":    mismatch.bytes(),
+		"underflow":   underflow.bytes(),
+		"local":       badLocal.bytes(),
+		"memory":      noMemory.bytes(),
+		"truncated":   controlFlowModule()[:40],
+	} {
+		if _, _, err := CompileWASM(mod); !errors.Is(err, ErrWASMInvalidModule) {
+			t.Fatalf("%s: expected invalid module, got %v", name, err)
+		}
+	}
+	if _, hash, err := CompileWASM(controlFlowModule()); err != nil || len(hash) != 64 {
+		t.Fatalf("compile valid module: %q %v", hash, err)
+	}
+
+	var imports wasmBuilder
+	imports.importFunc("env", "host", nil, nil)
+	imports.fn("f", nil, nil, nil, 0x10, 0, 0x0b)
+	vm := runningWASMVM(t)
+	if _, _, err := vm.Execute(imports.bytes(), "f", nil, 1000); !errors.Is(err, ErrWASMImport) {
+		t.Fatalf("expected unresolved import, got %v", err)
+	}
+}
+
+func TestContractRegistryRunsWASMContracts(t *testing.T) {
+	vm := runningWASMVM(t)
+	ledger := NewLedger()
+	ledger.Credit("owner", 1_000_000)
+	reg := NewContractRegistry(vm, ledger)
+	if _, err := reg.Deploy([]byte("placeholder"), "", 1000, "owner"); !errors.Is(err, ErrWASMInvalidModule) {
+		t.Fatalf("expected deploy of invalid module to fail, got %v", err)
+	}
+	addr, err := reg.Deploy(controlFlowModule(), "", 100_000, "owner")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	out, used, err := reg.Invoke(addr, "fib", le32(15), 0)
+	if err != nil || string(out) != string(le32(610)) || used == 0 {
+		t.Fatalf("invoke fib: %x %d %v", out, used, err)
+	}
+}
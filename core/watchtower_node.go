@@ -22,6 +22,7 @@ const (
 	WatchtowerEventMetrics      WatchtowerEventType = "watchtower.metrics"
 	WatchtowerEventForkDetected WatchtowerEventType = "watchtower.fork"
 	WatchtowerEventAlert        WatchtowerEventType = "watchtower.alert"
+	WatchtowerEventReorg        WatchtowerEventType = "watchtower.reorg"
 )
 
 // WatchtowerEvent captures observability data for CLI and web dashboards.
@@ -89,7 +90,8 @@ func (w *Watchtower) SetEventRetention(limit int) {
 	w.mu.Unlock()
 }
 
-// Start begins monitoring routines for the watchtower node.
+// Start begins monitoring routines for the watchtower node. When a node is
+// attached, reorgs of its ledger are recorded as events.
 func (w *Watchtower) Start(ctx context.Context) error {
 	w.mu.Lock()
 	if w.running {
@@ -99,8 +101,13 @@ func (w *Watchtower) Start(ctx context.Context) error {
 	var c context.Context
 	c, w.cancel = context.WithCancel(ctx)
 	w.running = true
+	node := w.observed
 	w.mu.Unlock()
 	go w.monitorLoop(c)
+	if node != nil && node.Ledger != nil {
+		reorgs, cancel := node.Ledger.SubscribeReorgs(0)
+		go w.reorgLoop(c, reorgs, cancel)
+	}
 	w.recordEvent(WatchtowerEvent{Type: WatchtowerEventStarted, Timestamp: time.Now().UTC(), Payload: map[string]string{"id": w.id}})
 	return nil
 }
@@ -130,7 +137,7 @@ func (w *Watchtower) monitorLoop(ctx context.Context) {
 				w.logger.Printf("watchtower metrics: %+v", metrics)
 			}
 			if node := w.snapshotNode(); node != nil {
-				payload["mempool_size"] = formatInt(len(node.Mempool))
+				payload["mempool_size"] = formatInt(node.Mempool.Len())
 				payload["validators"] = formatInt(len(node.Validators.Eligible()))
 			}
 			w.recordEvent(WatchtowerEvent{Type: WatchtowerEventMetrics, Timestamp: metrics.Timestamp, Payload: payload})
@@ -140,6 +147,32 @@ func (w *Watchtower) monitorLoop(ctx context.Context) {
 	}
 }
 
+// reorgLoop records chain reorganisations reported by the observed node's
+// ledger until the watchtower stops.
+func (w *Watchtower) reorgLoop(ctx context.Context, reorgs <-chan ReorgEvent, cancel func()) {
+	defer cancel()
+	for {
+		select {
+		case ev, ok := <-reorgs:
+			if !ok {
+				return
+			}
+			payload := map[string]string{
+				"depth":    formatInt(ev.Depth),
+				"old_head": ev.OldHead,
+				"new_head": ev.NewHead,
+				"height":   formatInt(ev.Height),
+			}
+			if w.logger != nil {
+				w.logger.Printf("reorg of depth %d from %s to %s", ev.Depth, ev.OldHead, ev.NewHead)
+			}
+			w.recordEvent(WatchtowerEvent{Type: WatchtowerEventReorg, Timestamp: time.Now().UTC(), Payload: payload})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // snapshotNode safely returns the observed node pointer without holding locks
 // for extended periods.
 func (w *Watchtower) snapshotNode() *Node {
@@ -255,11 +288,11 @@ func (w *Watchtower) RunIntegritySweep(ctx context.Context, maxMempool int) ([]W
 		return nil, errors.New("no node attached")
 	}
 	var events []WatchtowerEvent
-	if len(node.Mempool) > maxMempool {
+	if node.Mempool.Len() > maxMempool {
 		ev := WatchtowerEvent{Type: WatchtowerEventAlert, Timestamp: time.Now().UTC(), Payload: map[string]string{
 			"category": "mempool",
 			"message":  "mempool size above threshold",
-			"size":     formatInt(len(node.Mempool)),
+			"size":     formatInt(node.Mempool.Len()),
 		}}
 		w.recordEvent(ev)
 		events = append(events, ev)
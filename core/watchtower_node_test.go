@@ -63,7 +63,9 @@ func TestWatchtowerRunIntegritySweep(t *testing.T) {
 	w := NewWatchtowerNode("wt", nil)
 	node := NewNode("n", "addr", NewLedger())
 	for i := 0; i < 5; i++ {
-		node.Mempool = append(node.Mempool, &Transaction{})
+		if err := node.Mempool.Add(NewTransaction("a", "b", 1, 0, uint64(i))); err != nil {
+			t.Fatalf("queue tx: %v", err)
+		}
 	}
 	w.AttachNode(node)
 	events, err := w.RunIntegritySweep(context.Background(), 3)
@@ -98,5 +100,37 @@ func TestWatchtowerReportFork(t *testing.T) {
 	}
 }
 
+func TestWatchtowerRecordsReorgs(t *testing.T) {
+	f := newReorgFixture(t)
+	l := NewLedger()
+	f.fund(l)
+	node := NewNode("n", "addr", l)
+	node.Consensus = nil
+	w := NewWatchtowerNode("wt", nil)
+	w.AttachNode(node)
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer w.Stop()
+	for _, b := range []*Block{f.g, f.a1, f.b1, f.b2} {
+		if _, err := node.ImportBlock(b); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, ev := range w.Events() {
+			if ev.Type == WatchtowerEventReorg {
+				if ev.Payload["depth"] != "1" || ev.Payload["new_head"] != f.b2.Hash {
+					t.Fatalf("unexpected reorg payload %+v", ev.Payload)
+				}
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected reorg event, got %+v", w.Events())
+}
+
 // compile-time interface check
 var _ watchtower.WatchtowerNode = (*Watchtower)(nil)
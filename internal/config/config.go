@@ -43,6 +43,7 @@ type Config struct {
 	Telemetry   TelemetryConfig `mapstructure:"telemetry" validate:"required"`
 	Security    SecurityConfig  `mapstructure:"security" validate:"required"`
 	Network     NetworkConfig   `mapstructure:"network" validate:"required"`
+	Ledger      LedgerConfig    `mapstructure:"ledger" validate:"required"`
 }
 
 // LogConfig describes structured logging behaviour used by the CLI, node
@@ -209,6 +210,33 @@ type NetworkConfig struct {
 	SyncRetryInterval time.Duration `mapstructure:"sync_retry_interval" validate:"required,gt=0"`
 }
 
+// LedgerConfig sets how much chain history the ledger retains. Full history
+// keeps every block but only the state diffs needed for reorgs, pruned history
+// keeps the bodies and state diffs of the last RetainBlocks blocks and only the
+// headers of older ones, and archive history keeps every state diff so
+// balances can be queried at any height. FeeMarket optionally prices
+// transactions with a per-block base fee.
+type LedgerConfig struct {
+	History       string          `mapstructure:"history" validate:"required,oneof=full pruned archive"`
+	RetainBlocks  int             `mapstructure:"retain_blocks" validate:"gte=0"`
+	MaxReorgDepth int             `mapstructure:"max_reorg_depth" validate:"gt=0"`
+	FeeMarket     FeeMarketConfig `mapstructure:"fee_market"`
+}
+
+// FeeMarketConfig enables EIP-1559 style pricing: every block carries a base
+// fee per unit of gas that follows block utilisation against TargetGas, and
+// transactions pay it plus a priority tip for the block's validator. The base
+// fee portion is burned, or divided among the fee pools of the default fee
+// split policy when BaseFee is "split". Every node of a network must use the
+// same settings.
+type FeeMarketConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	InitialBaseFee uint64 `mapstructure:"initial_base_fee"`
+	MinBaseFee     uint64 `mapstructure:"min_base_fee"`
+	TargetGas      uint64 `mapstructure:"target_gas" validate:"gt=0"`
+	BaseFee        string `mapstructure:"base_fee" validate:"required,oneof=burn split"`
+}
+
 var (
 	validatorOnce sync.Once
 	validate      *validator.Validate
@@ -305,6 +333,14 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("vm.gas_limit must be >= consensus.gas_floor")
 	}
 
+	if c.Ledger.History == "pruned" && c.Ledger.RetainBlocks < c.Ledger.MaxReorgDepth {
+		return fmt.Errorf("ledger.retain_blocks must be >= ledger.max_reorg_depth when pruning")
+	}
+
+	if c.Ledger.FeeMarket.Enabled && c.Ledger.FeeMarket.TargetGas > c.Consensus.MaxBlockGas/2 {
+		return fmt.Errorf("ledger.fee_market.target_gas must be at most half of consensus.max_block_gas")
+	}
+
 	if err := validateCIDRs(c.Security.PermitCIDRs); err != nil {
 		return fmt.Errorf("security.permit_cidrs: %w", err)
 	}
@@ -521,6 +557,15 @@ func applyDefaults(v *viper.Viper) {
 	v.SetDefault("network.authority_nodes", []string{"authority-1.synnergy.io:7070"})
 	v.SetDefault("network.allow_private_peers", false)
 	v.SetDefault("network.sync_retry_interval", 5*time.Second)
+
+	v.SetDefault("ledger.history", "full")
+	v.SetDefault("ledger.retain_blocks", 1024)
+	v.SetDefault("ledger.max_reorg_depth", 64)
+	v.SetDefault("ledger.fee_market.enabled", false)
+	v.SetDefault("ledger.fee_market.initial_base_fee", uint64(1))
+	v.SetDefault("ledger.fee_market.min_base_fee", uint64(0))
+	v.SetDefault("ledger.fee_market.target_gas", uint64(12_500_000))
+	v.SetDefault("ledger.fee_market.base_fee", "burn")
 }
 
 func validateCIDRs(cidrs []string) error {
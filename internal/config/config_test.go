@@ -202,6 +202,50 @@ func TestConsensusGasFloorValidation(t *testing.T) {
 	}
 }
 
+func TestLedgerHistoryValidation(t *testing.T) {
+	t.Parallel()
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+	if cfg.Ledger.History != "full" || cfg.Ledger.MaxReorgDepth != 64 {
+		t.Fatalf("unexpected ledger defaults %+v", cfg.Ledger)
+	}
+	cfg.Ledger.History = "pruned"
+	cfg.Ledger.RetainBlocks = cfg.Ledger.MaxReorgDepth - 1
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected validation error when pruning inside the reorg window")
+	}
+	cfg.Ledger.History = "light"
+	if err := ensureValidator().Struct(cfg); err == nil {
+		t.Fatalf("expected validator to reject unknown history mode")
+	}
+}
+
+func TestFeeMarketValidation(t *testing.T) {
+	t.Parallel()
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+	fm := cfg.Ledger.FeeMarket
+	if fm.Enabled || fm.BaseFee != "burn" || fm.TargetGas != cfg.Consensus.MaxBlockGas/2 {
+		t.Fatalf("unexpected fee market defaults %+v", fm)
+	}
+	cfg.Ledger.FeeMarket.Enabled = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default fee market must validate: %v", err)
+	}
+	cfg.Ledger.FeeMarket.TargetGas = cfg.Consensus.MaxBlockGas
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected validation error when blocks could exceed max block gas")
+	}
+	cfg.Ledger.FeeMarket.BaseFee = "mint"
+	if err := ensureValidator().Struct(cfg); err == nil {
+		t.Fatalf("expected validator to reject unknown base fee routing")
+	}
+}
+
 func TestTimeoutsRemainPositive(t *testing.T) {
 	t.Parallel()
 	cfg, err := Load("")
@@ -87,9 +87,13 @@ func Default() *Logger {
 
 // WithFields returns a derived logger with the provided fields attached to every event.
 func (l *Logger) WithFields(fields map[string]any) *Logger {
-	clone := *l
-	clone.staticFields = mergeMaps(l.staticFields, fields)
-	return &clone
+	return &Logger{
+		level:         l.level,
+		format:        l.format,
+		includeCaller: l.includeCaller,
+		writers:       l.writers,
+		staticFields:  mergeMaps(l.staticFields, fields),
+	}
 }
 
 // WithContext returns a derived logger enriched with trace identifiers from the context.
@@ -0,0 +1,439 @@
+// Package rpc implements the versioned JSON-RPC 2.0 API served by a running
+// Synnergy node. Requests are POSTed to Path over HTTP, either on a TCP
+// address or on a Unix socket, and may be sent individually or in batches.
+// Methods are named "<namespace>_<method>", for example "ledger_getBalance".
+//
+// Requests must be sent as application/json. Over TCP the server only answers
+// requests addressed to a loopback host, which defeats DNS rebinding, and it
+// refuses requests carrying an Origin header, which browsers add to the
+// requests a web page makes. Methods marked with Server.Protect change node
+// state and are served over TCP only to callers presenting the server's token.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Version is the API version. Incompatible changes to method names or their
+// parameters are published under a new version path.
+const Version = "v1"
+
+// Path is the HTTP path the API is served on.
+const Path = "/rpc/" + Version
+
+// maxRequestSize bounds the body of a single HTTP request.
+const maxRequestSize = 16 << 20
+
+// Standard JSON-RPC 2.0 error codes, plus CodeServerError for errors
+// returned by method handlers and CodeUnauthorized for protected methods
+// called without the server's token.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeServerError    = -32000
+	CodeUnauthorized   = -32001
+)
+
+// Error is a JSON-RPC error object. Handlers may return an *Error to choose
+// the code; any other error is reported with CodeServerError.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Request is a JSON-RPC 2.0 request. A request without an ID is a
+// notification and receives no response.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC 2.0 response.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// HandlerFunc executes a method with its raw parameters.
+type HandlerFunc func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Method adapts fn to a HandlerFunc that decodes the parameters, given as a
+// JSON object, into P. Missing parameters leave P at its zero value.
+func Method[P any](fn func(ctx context.Context, p P) (any, error)) HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p P
+		if len(bytes.TrimSpace(params)) > 0 && !bytes.Equal(bytes.TrimSpace(params), []byte("null")) {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, &Error{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+			}
+		}
+		return fn(ctx, p)
+	}
+}
+
+// Server dispatches JSON-RPC requests to registered methods. Handlers are
+// called concurrently and must synchronise access to shared state.
+type Server struct {
+	mu        sync.RWMutex
+	methods   map[string]HandlerFunc
+	protected map[string]bool
+	token     string
+}
+
+// NewServer creates a server with the built-in "rpc_methods" method, which
+// lists the API version and the registered methods.
+func NewServer() *Server {
+	s := &Server{methods: make(map[string]HandlerFunc), protected: make(map[string]bool)}
+	s.Register("rpc_methods", func(context.Context, json.RawMessage) (any, error) {
+		return map[string]any{"version": Version, "methods": s.Methods()}, nil
+	})
+	return s
+}
+
+// Register adds or replaces the handler for method.
+func (s *Server) Register(method string, h HandlerFunc) {
+	s.mu.Lock()
+	s.methods[method] = h
+	s.mu.Unlock()
+}
+
+// Protect marks methods as changing node state. Over TCP they are only
+// served to requests carrying the server's token as a bearer token in the
+// Authorization header, and not at all while the token is empty. Requests on
+// a Unix socket, whose access is governed by the socket file's permissions,
+// and in-process calls through Invoke may call them freely.
+func (s *Server) Protect(methods ...string) {
+	s.mu.Lock()
+	for _, m := range methods {
+		s.protected[m] = true
+	}
+	s.mu.Unlock()
+}
+
+// SetToken sets the token that grants TCP callers access to protected
+// methods. An empty token serves them on Unix sockets only.
+func (s *Server) SetToken(token string) {
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+}
+
+// authorized reports whether r carries the server's token.
+func (s *Server) authorized(r *http.Request) bool {
+	s.mu.RLock()
+	token := s.token
+	s.mu.RUnlock()
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// Methods returns the registered method names in sorted order.
+func (s *Server) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Invoke calls method in-process. The parameters are encoded to JSON and
+// decoded by the handler exactly as for a remote call, but the result is
+// returned as produced by the handler.
+func (s *Server) Invoke(ctx context.Context, method string, params any) (any, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return s.call(ctx, method, raw, true)
+}
+
+func (s *Server) call(ctx context.Context, method string, params json.RawMessage, trusted bool) (any, error) {
+	s.mu.RLock()
+	h, ok := s.methods[method]
+	protected := s.protected[method]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", method)}
+	}
+	if protected && !trusted {
+		return nil, &Error{Code: CodeUnauthorized, Message: fmt.Sprintf("method %q requires the node's API token", method)}
+	}
+	return h(ctx, params)
+}
+
+// handle executes a single request and returns its response, or nil for a
+// notification. Protected methods are only called when trusted is set.
+func (s *Server) handle(ctx context.Context, raw json.RawMessage, trusted bool) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return &Response{JSONRPC: "2.0", Error: &Error{Code: CodeInvalidRequest, Message: "invalid request"}, ID: json.RawMessage("null")}
+	}
+	notify := len(req.ID) == 0
+	resp := &Response{JSONRPC: "2.0", ID: req.ID}
+	if notify {
+		resp.ID = json.RawMessage("null")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &Error{Code: CodeInvalidRequest, Message: "invalid request"}
+		return resp
+	}
+	result, err := s.call(ctx, req.Method, req.Params, trusted)
+	if notify {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeServerError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &Error{Code: CodeInternalError, Message: "encode result: " + err.Error()}
+		return resp
+	}
+	resp.Result = b
+	return resp
+}
+
+// ServeHTTP implements http.Handler for single and batch requests received
+// over TCP.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.serveHTTP(w, r, false)
+}
+
+// serveHTTP answers r. Requests received on a Unix socket are local: they
+// may name any host and call protected methods without the token.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request, local bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.Header.Get("Origin") != "" {
+		http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if !local && !loopbackHost(r.Host) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return
+	}
+	trusted := local || s.authorized(r)
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil || len(body) > maxRequestSize {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	body = bytes.TrimSpace(body)
+	var out any
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			out = &Response{JSONRPC: "2.0", Error: &Error{Code: CodeInvalidRequest, Message: "invalid batch"}, ID: json.RawMessage("null")}
+		} else {
+			resps := make([]*Response, 0, len(batch))
+			for _, raw := range batch {
+				if resp := s.handle(r.Context(), raw, trusted); resp != nil {
+					resps = append(resps, resp)
+				}
+			}
+			if len(resps) > 0 {
+				out = resps
+			}
+		}
+	} else if !json.Valid(body) {
+		out = &Response{JSONRPC: "2.0", Error: &Error{Code: CodeParseError, Message: "parse error"}, ID: json.RawMessage("null")}
+	} else if resp := s.handle(r.Context(), body, trusted); resp != nil {
+		out = resp
+	}
+	if out == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// loopbackHost reports whether host, the Host header of a request, names the
+// local machine.
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Serve answers requests on ln until ctx is cancelled, then shuts down
+// gracefully and returns nil. Requests on a Unix socket are treated as local.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	local := ln.Addr().Network() == "unix"
+	mux := http.NewServeMux()
+	mux.Handle(Path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveHTTP(w, r, local)
+	}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	stop := context.AfterFunc(ctx, func() {
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	})
+	defer stop()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Listen opens a listener for endpoint, which is either a TCP address such as
+// "127.0.0.1:8545" or "http://127.0.0.1:8545", or a Unix socket given as
+// "unix:///path/node.sock" or a filesystem path. A stale socket file left by
+// a previous run is removed.
+func Listen(endpoint string) (net.Listener, error) {
+	network, addr := parseEndpoint(endpoint)
+	if network == "unix" {
+		if err := os.Remove(addr); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+func parseEndpoint(endpoint string) (network, addr string) {
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		return "unix", strings.TrimPrefix(endpoint, "unix://")
+	case strings.HasPrefix(endpoint, "http://"):
+		return "tcp", strings.TrimSuffix(strings.TrimPrefix(endpoint, "http://"), Path)
+	case strings.ContainsAny(endpoint, "/\\") || strings.HasSuffix(endpoint, ".sock"):
+		return "unix", endpoint
+	default:
+		return "tcp", endpoint
+	}
+}
+
+// Client calls methods on a remote Server.
+type Client struct {
+	http   *http.Client
+	url    string
+	token  string
+	nextID atomic.Uint64
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithToken sends token with every call, granting access to the server's
+// protected methods over TCP.
+func WithToken(token string) ClientOption {
+	return func(c *Client) { c.token = token }
+}
+
+// Dial returns a client for endpoint, using the same endpoint syntax as
+// Listen. No connection is made until the first call.
+func Dial(endpoint string, opts ...ClientOption) (*Client, error) {
+	if endpoint == "" {
+		return nil, errors.New("rpc endpoint required")
+	}
+	network, addr := parseEndpoint(endpoint)
+	c := &Client{http: &http.Client{Timeout: time.Minute}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if network == "unix" {
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", addr)
+			},
+		}
+		c.url = "http://unix" + Path
+	} else {
+		c.url = "http://" + addr + Path
+	}
+	return c, nil
+}
+
+// Call invokes method with params and decodes the result into result, which
+// may be nil to discard it. Numbers decoded into an interface value are kept
+// as json.Number so large integers survive. Errors reported by the server are
+// returned as *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	id, _ := json.Marshal(c.nextID.Add(1))
+	body, err := json.Marshal(Request{JSONRPC: "2.0", Method: method, Params: p, ID: id})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, 512))
+		return fmt.Errorf("rpc: %s: %s", httpResp.Status, strings.TrimSpace(string(msg)))
+	}
+	var resp Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return fmt.Errorf("rpc: decode response: %w", err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(resp.Result))
+	dec.UseNumber()
+	return dec.Decode(result)
+}
@@ -0,0 +1,202 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type addParams struct {
+	A uint64 `json:"a"`
+	B uint64 `json:"b"`
+}
+
+func testServer() *Server {
+	s := NewServer()
+	s.Register("math_add", Method(func(_ context.Context, p addParams) (any, error) {
+		return p.A + p.B, nil
+	}))
+	s.Register("math_fail", Method(func(_ context.Context, _ struct{}) (any, error) {
+		return nil, errors.New("boom")
+	}))
+	return s
+}
+
+func serve(t *testing.T, s *Server, endpoint string) {
+	t.Helper()
+	ln, err := Listen(endpoint)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+}
+
+func TestClientServerOverTCPAndUnixSocket(t *testing.T) {
+	s := testServer()
+	ln, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, ln)
+	sock := filepath.Join(t.TempDir(), "node.sock")
+	serve(t, s, "unix://"+sock)
+
+	for _, endpoint := range []string{"http://" + ln.Addr().String(), sock} {
+		c, err := Dial(endpoint)
+		if err != nil {
+			t.Fatalf("dial %s: %v", endpoint, err)
+		}
+		var sum uint64
+		if err := c.Call(context.Background(), "math_add", addParams{A: 1 << 60, B: 1}, &sum); err != nil || sum != 1<<60+1 {
+			t.Fatalf("%s: add = %d, %v", endpoint, sum, err)
+		}
+		var rpcErr *Error
+		if err := c.Call(context.Background(), "math_fail", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeServerError || rpcErr.Message != "boom" {
+			t.Fatalf("%s: expected server error, got %v", endpoint, err)
+		}
+		if err := c.Call(context.Background(), "math_sub", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeMethodNotFound {
+			t.Fatalf("%s: expected method not found, got %v", endpoint, err)
+		}
+		var methods struct {
+			Version string   `json:"version"`
+			Methods []string `json:"methods"`
+		}
+		if err := c.Call(context.Background(), "rpc_methods", nil, &methods); err != nil || methods.Version != Version || len(methods.Methods) != 3 {
+			t.Fatalf("%s: unexpected methods %+v %v", endpoint, methods, err)
+		}
+	}
+}
+
+func TestServerBatchesAndNotifications(t *testing.T) {
+	srv := httptest.NewServer(testServer())
+	defer srv.Close()
+	post := func(body string) (*http.Response, []Response) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+Path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		var out []Response
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return resp, out
+	}
+
+	_, out := post(`[
+		{"jsonrpc":"2.0","method":"math_add","params":{"a":2,"b":3},"id":1},
+		{"jsonrpc":"2.0","method":"math_add","params":{"a":1}},
+		{"jsonrpc":"2.0","method":"math_add","params":"bad","id":"x"},
+		{"jsonrpc":"1.0","method":"math_add","id":2}
+	]`)
+	if len(out) != 3 {
+		t.Fatalf("expected three responses, got %+v", out)
+	}
+	if string(out[0].ID) != "1" || string(out[0].Result) != "5" {
+		t.Fatalf("unexpected first response %+v", out[0])
+	}
+	if out[1].Error == nil || out[1].Error.Code != CodeInvalidParams || string(out[1].ID) != `"x"` {
+		t.Fatalf("expected invalid params, got %+v", out[1])
+	}
+	if out[2].Error == nil || out[2].Error.Code != CodeInvalidRequest {
+		t.Fatalf("expected invalid request, got %+v", out[2])
+	}
+
+	if resp, _ := post(`[{"jsonrpc":"2.0","method":"math_add"}]`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected no content for notifications, got %s", resp.Status)
+	}
+	resp, err := http.Post(srv.URL+Path, "application/json", strings.NewReader(`{"jsonrpc"`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	var parseErr Response
+	json.NewDecoder(resp.Body).Decode(&parseErr)
+	resp.Body.Close()
+	if parseErr.Error == nil || parseErr.Error.Code != CodeParseError {
+		t.Fatalf("expected parse error, got %+v", parseErr)
+	}
+}
+
+func TestInvokeInProcess(t *testing.T) {
+	s := testServer()
+	got, err := s.Invoke(context.Background(), "math_add", addParams{A: 4, B: 5})
+	if err != nil || got != uint64(9) {
+		t.Fatalf("invoke: %v %v", got, err)
+	}
+}
+
+func TestServerRejectsForeignRequestsAndGuardsProtectedMethods(t *testing.T) {
+	s := testServer()
+	s.Protect("math_add")
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	body := `{"jsonrpc":"2.0","method":"math_add","params":{"a":1,"b":2},"id":1}`
+	post := func(mutate func(*http.Request)) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+Path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mutate(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := post(func(r *http.Request) { r.Header.Set("Content-Type", "text/plain") }); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected a form post to be refused, got %s", resp.Status)
+	}
+	if resp := post(func(r *http.Request) { r.Header.Set("Origin", "http://evil.example") }); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a cross-origin request to be refused, got %s", resp.Status)
+	}
+	if resp := post(func(r *http.Request) { r.Host = "evil.example" }); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a rebound host to be refused, got %s", resp.Status)
+	}
+
+	call := func(c *Client) error {
+		var sum uint64
+		return c.Call(context.Background(), "math_add", addParams{A: 1, B: 2}, &sum)
+	}
+	var rpcErr *Error
+	anon, _ := Dial(srv.URL)
+	if err := call(anon); !errors.As(err, &rpcErr) || rpcErr.Code != CodeUnauthorized {
+		t.Fatalf("expected an untokened call to be refused while no token is set, got %v", err)
+	}
+	s.SetToken("secret")
+	wrong, _ := Dial(srv.URL, WithToken("guess"))
+	if err := call(wrong); !errors.As(err, &rpcErr) || rpcErr.Code != CodeUnauthorized {
+		t.Fatalf("expected a wrong token to be refused, got %v", err)
+	}
+	authed, _ := Dial(srv.URL, WithToken("secret"))
+	if err := call(authed); err != nil {
+		t.Fatalf("authorised call: %v", err)
+	}
+	if _, err := s.Invoke(context.Background(), "math_add", addParams{}); err != nil {
+		t.Fatalf("in-process calls are trusted: %v", err)
+	}
+
+	sock := filepath.Join(t.TempDir(), "node.sock")
+	serve(t, s, "unix://"+sock)
+	local, _ := Dial(sock)
+	if err := call(local); err != nil {
+		t.Fatalf("unix socket calls are trusted: %v", err)
+	}
+}
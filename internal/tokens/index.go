@@ -80,13 +80,18 @@ func (r *Registry) NextID() TokenID {
 	return r.next
 }
 
-// Register adds the token to the registry using its ID.
+// Register adds the token to the registry using its ID. NextID never hands
+// out the ID of a registered token, so tokens restored with their original
+// IDs do not collide with new ones.
 func (r *Registry) Register(t Token) {
 	if t == nil {
 		return
 	}
 	r.mu.Lock()
 	r.tokens[t.ID()] = t
+	if t.ID() > r.next {
+		r.next = t.ID()
+	}
 	observers := append([]RegistryObserver(nil), r.observers...)
 	info := r.infoLocked(t)
 	ts := r.clock()
@@ -52,3 +52,11 @@ func TestRegistryGetBySymbol(t *testing.T) {
 		t.Fatalf("expected registry to contain single token")
 	}
 }
+
+func TestRegistryNextIDSkipsRegistered(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(NewBaseToken(7, "Restored", "RST", 0))
+	if id := reg.NextID(); id != 8 {
+		t.Fatalf("expected next id 8 got %d", id)
+	}
+}
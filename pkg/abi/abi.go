@@ -0,0 +1,364 @@
+// Package abi describes the typed interface of a smart contract and encodes
+// call arguments, return values and event data for it.
+//
+// A contract declares its ABI under the "abi" key of its manifest:
+//
+//	{
+//	  "name": "token",
+//	  "abi": {
+//	    "methods": [
+//	      {"name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint64"}], "outputs": [{"name": "ok", "type": "bool"}]},
+//	      {"name": "balanceOf", "inputs": [{"name": "owner", "type": "address"}], "outputs": [{"name": "balance", "type": "uint64"}], "mutability": "view"}
+//	    ],
+//	    "events": [
+//	      {"name": "Transfer", "inputs": [{"name": "from", "type": "address", "indexed": true}, {"name": "to", "type": "address", "indexed": true}, {"name": "amount", "type": "uint64"}]}
+//	    ]
+//	  }
+//	}
+//
+// Values are encoded one after another in declaration order. bool takes one
+// byte, uintN and intN take N/8 bytes in little-endian two's complement, and
+// string, bytes and address are a little-endian uint32 length followed by
+// their bytes. An array type T[] is a uint32 element count followed by the
+// elements.
+package abi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxIndexed is the most indexed inputs an event may declare. Together with
+// the event ID they fill the four topics a contract log carries.
+const MaxIndexed = 3
+
+var (
+	// ErrInvalidABI is returned when an ABI declaration is malformed.
+	ErrInvalidABI = errors.New("invalid abi")
+	// ErrEncode is returned when a value does not match its declared type.
+	ErrEncode = errors.New("abi encode")
+	// ErrDecode is returned when data does not decode as the declared types.
+	ErrDecode = errors.New("abi decode")
+)
+
+// Mutability says whether a method may change contract state.
+type Mutability string
+
+const (
+	// Mutable methods may write storage and transfer coins. It is the
+	// default when a method declares no mutability.
+	Mutable Mutability = "mutable"
+	// View methods only read state and cannot receive coins.
+	View Mutability = "view"
+)
+
+// Param is a named, typed method input or output or event field. Indexed
+// applies to event fields only.
+type Param struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Indexed bool   `json:"indexed,omitempty"`
+}
+
+// Method is a contract entry point.
+type Method struct {
+	Name       string     `json:"name"`
+	Inputs     []Param    `json:"inputs,omitempty"`
+	Outputs    []Param    `json:"outputs,omitempty"`
+	Mutability Mutability `json:"mutability,omitempty"`
+}
+
+// Event is a log a contract emits.
+type Event struct {
+	Name   string  `json:"name"`
+	Inputs []Param `json:"inputs,omitempty"`
+}
+
+// ABI is the typed interface of a contract.
+type ABI struct {
+	Methods []Method `json:"methods"`
+	Events  []Event  `json:"events,omitempty"`
+}
+
+// Parse decodes and validates an ABI in its JSON form.
+func Parse(data []byte) (*ABI, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var a ABI
+	if err := dec.Decode(&a); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidABI, err)
+	}
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// FromManifest returns the ABI declared under the "abi" key of a contract
+// manifest. A manifest without one yields nil and no error.
+func FromManifest(manifest string) (*ABI, error) {
+	if strings.TrimSpace(manifest) == "" {
+		return nil, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(manifest), &m); err != nil {
+		// manifests need not be objects; those carry no ABI
+		return nil, nil
+	}
+	raw, ok := m["abi"]
+	if !ok {
+		return nil, nil
+	}
+	return Parse(raw)
+}
+
+// Validate checks that names are present and unique, types are known,
+// mutabilities are valid and events index no more than MaxIndexed fields.
+func (a *ABI) Validate() error {
+	methods := make(map[string]bool, len(a.Methods))
+	for _, m := range a.Methods {
+		if m.Name == "" {
+			return fmt.Errorf("%w: method without a name", ErrInvalidABI)
+		}
+		if methods[m.Name] {
+			return fmt.Errorf("%w: duplicate method %s", ErrInvalidABI, m.Name)
+		}
+		methods[m.Name] = true
+		switch m.Mutability {
+		case "", Mutable, View:
+		default:
+			return fmt.Errorf("%w: method %s has unknown mutability %q", ErrInvalidABI, m.Name, m.Mutability)
+		}
+		if err := validateParams(m.Inputs, true, false); err != nil {
+			return fmt.Errorf("%w: method %s inputs: %v", ErrInvalidABI, m.Name, err)
+		}
+		if err := validateParams(m.Outputs, false, false); err != nil {
+			return fmt.Errorf("%w: method %s outputs: %v", ErrInvalidABI, m.Name, err)
+		}
+	}
+	events := make(map[string]bool, len(a.Events))
+	for _, e := range a.Events {
+		if e.Name == "" {
+			return fmt.Errorf("%w: event without a name", ErrInvalidABI)
+		}
+		if events[e.Name] {
+			return fmt.Errorf("%w: duplicate event %s", ErrInvalidABI, e.Name)
+		}
+		events[e.Name] = true
+		if err := validateParams(e.Inputs, true, true); err != nil {
+			return fmt.Errorf("%w: event %s: %v", ErrInvalidABI, e.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateParams(params []Param, named, indexable bool) error {
+	seen := make(map[string]bool, len(params))
+	indexed := 0
+	for i, p := range params {
+		if p.Name == "" && named {
+			return fmt.Errorf("parameter %d has no name", i)
+		}
+		if p.Name != "" && seen[p.Name] {
+			return fmt.Errorf("duplicate parameter %s", p.Name)
+		}
+		seen[p.Name] = true
+		if _, err := parseType(p.Type); err != nil {
+			return fmt.Errorf("parameter %s: %v", p.key(i), err)
+		}
+		if p.Indexed {
+			if !indexable {
+				return fmt.Errorf("parameter %s cannot be indexed", p.key(i))
+			}
+			indexed++
+		}
+	}
+	if indexed > MaxIndexed {
+		return fmt.Errorf("%d indexed fields, at most %d allowed", indexed, MaxIndexed)
+	}
+	return nil
+}
+
+// key names the i-th parameter in decoded values: its name, or its position
+// when it has none.
+func (p Param) key(i int) string {
+	if p.Name == "" {
+		return fmt.Sprint(i)
+	}
+	return p.Name
+}
+
+// Method returns the method with the given name.
+func (a *ABI) Method(name string) (*Method, bool) {
+	for i := range a.Methods {
+		if a.Methods[i].Name == name {
+			return &a.Methods[i], true
+		}
+	}
+	return nil, false
+}
+
+// Event returns the event with the given name.
+func (a *ABI) Event(name string) (*Event, bool) {
+	for i := range a.Events {
+		if a.Events[i].Name == name {
+			return &a.Events[i], true
+		}
+	}
+	return nil, false
+}
+
+// IsView reports whether the method is declared view.
+func (m *Method) IsView() bool { return m.Mutability == View }
+
+// Signature returns the method's name and input types, for example
+// "transfer(address,uint64)".
+func (m *Method) Signature() string { return signature(m.Name, m.Inputs) }
+
+// EncodeArgs encodes call arguments given in input order.
+func (m *Method) EncodeArgs(values ...any) ([]byte, error) {
+	return Encode(m.Inputs, values)
+}
+
+// EncodeNamedArgs encodes call arguments given by input name. Every input
+// must be given and no others.
+func (m *Method) EncodeNamedArgs(values map[string]any) ([]byte, error) {
+	ordered, err := orderNamed(m.Inputs, values)
+	if err != nil {
+		return nil, err
+	}
+	return Encode(m.Inputs, ordered)
+}
+
+// DecodeArgs decodes call arguments keyed by input name.
+func (m *Method) DecodeArgs(data []byte) (map[string]any, error) {
+	return DecodeNamed(m.Inputs, data)
+}
+
+// DecodeOutputs decodes return data keyed by output name, or by position
+// for unnamed outputs.
+func (m *Method) DecodeOutputs(data []byte) (map[string]any, error) {
+	return DecodeNamed(m.Outputs, data)
+}
+
+// Signature returns the event's name and field types.
+func (e *Event) Signature() string { return signature(e.Name, e.Inputs) }
+
+// ID returns the hex encoded first topic of the event's logs, the SHA-256
+// hash of its signature.
+func (e *Event) ID() string {
+	h := sha256.Sum256([]byte(e.Signature()))
+	return hex.EncodeToString(h[:])
+}
+
+// Topic returns the hex encoded topic of an indexed field value. Values of
+// fixed size types are encoded and zero padded to 32 bytes, while strings,
+// bytes, addresses and arrays are hashed with SHA-256.
+func Topic(typ string, value any) (string, error) {
+	t, err := parseType(typ)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrEncode, err)
+	}
+	enc, err := t.encode(nil, value)
+	if err != nil {
+		return "", err
+	}
+	var topic [32]byte
+	if t.size() > 0 {
+		copy(topic[:], enc)
+	} else {
+		topic = sha256.Sum256(enc)
+	}
+	return hex.EncodeToString(topic[:]), nil
+}
+
+// DecodeLog decodes a log of one of the ABI's events. Non-indexed fields are
+// decoded from data. Indexed fields of fixed size types are decoded from
+// their topics and the others are returned as their hex encoded topic.
+func (a *ABI) DecodeLog(topics []string, data []byte) (*Event, map[string]any, error) {
+	if len(topics) == 0 {
+		return nil, nil, fmt.Errorf("%w: log has no topics", ErrDecode)
+	}
+	for i := range a.Events {
+		e := &a.Events[i]
+		if e.ID() != topics[0] {
+			continue
+		}
+		var plain []Param
+		for _, p := range e.Inputs {
+			if !p.Indexed {
+				plain = append(plain, p)
+			}
+		}
+		values, err := DecodeNamed(plain, data)
+		if err != nil {
+			return e, nil, err
+		}
+		topic := 1
+		for i, p := range e.Inputs {
+			if !p.Indexed {
+				continue
+			}
+			if topic >= len(topics) {
+				return e, nil, fmt.Errorf("%w: %s has no topic for %s", ErrDecode, e.Name, p.key(i))
+			}
+			t, _ := parseType(p.Type)
+			values[p.key(i)] = topics[topic]
+			if n := t.size(); n > 0 {
+				raw, err := hex.DecodeString(topics[topic])
+				if err != nil || len(raw) < n {
+					return e, nil, fmt.Errorf("%w: malformed topic for %s", ErrDecode, p.key(i))
+				}
+				v, _, err := t.decode(raw[:n])
+				if err != nil {
+					return e, nil, err
+				}
+				values[p.key(i)] = v
+			}
+			topic++
+		}
+		return e, values, nil
+	}
+	return nil, nil, fmt.Errorf("%w: no event with topic %s", ErrDecode, topics[0])
+}
+
+func signature(name string, params []Param) string {
+	types := make([]string, len(params))
+	for i, p := range params {
+		types[i] = p.Type
+	}
+	return name + "(" + strings.Join(types, ",") + ")"
+}
+
+func orderNamed(params []Param, values map[string]any) ([]any, error) {
+	ordered := make([]any, len(params))
+	for i, p := range params {
+		v, ok := values[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing argument %s", ErrEncode, p.Name)
+		}
+		ordered[i] = v
+	}
+	if len(values) > len(params) {
+		for name := range values {
+			if !hasParam(params, name) {
+				return nil, fmt.Errorf("%w: unknown argument %s", ErrEncode, name)
+			}
+		}
+	}
+	return ordered, nil
+}
+
+func hasParam(params []Param, name string) bool {
+	for _, p := range params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package abi
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const tokenABI = `{
+	"methods": [
+		{"name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint64"}], "outputs": [{"name": "ok", "type": "bool"}]},
+		{"name": "batch", "inputs": [{"name": "amounts", "type": "uint32[]"}, {"name": "memo", "type": "bytes"}, {"name": "delta", "type": "int16"}], "outputs": [{"type": "string"}], "mutability": "view"}
+	],
+	"events": [
+		{"name": "Transfer", "inputs": [{"name": "from", "type": "address", "indexed": true}, {"name": "amount", "type": "uint64", "indexed": true}, {"name": "memo", "type": "string"}]}
+	]
+}`
+
+func TestParseValidates(t *testing.T) {
+	a, err := FromManifest(`{"name":"token","abi":` + tokenABI + `}`)
+	if err != nil || a == nil || len(a.Methods) != 2 {
+		t.Fatalf("from manifest: %+v %v", a, err)
+	}
+	if m, ok := a.Method("batch"); !ok || !m.IsView() || m.Signature() != "batch(uint32[],bytes,int16)" {
+		t.Fatalf("unexpected method %+v", m)
+	}
+	if a, err := FromManifest(`{"name":"token"}`); a != nil || err != nil {
+		t.Fatalf("manifest without abi: %v %v", a, err)
+	}
+	bad := []string{
+		`{"methods":[{"name":"f","inputs":[{"name":"x","type":"uint7"}]}]}`,
+		`{"methods":[{"name":"f"},{"name":"f"}]}`,
+		`{"methods":[{"name":"f","inputs":[{"type":"bool"}]}]}`,
+		`{"methods":[{"name":"f","mutability":"pure"}]}`,
+		`{"methods":[{"name":"f","inputs":[{"name":"x","type":"bool","indexed":true}]}]}`,
+		`{"methods":[],"events":[{"name":"E","inputs":[{"name":"a","type":"bool","indexed":true},{"name":"b","type":"bool","indexed":true},{"name":"c","type":"bool","indexed":true},{"name":"d","type":"bool","indexed":true}]}]}`,
+		`{"methods":[],"constructor":{}}`,
+	}
+	for _, s := range bad {
+		if _, err := Parse([]byte(s)); !errors.Is(err, ErrInvalidABI) {
+			t.Errorf("Parse(%s) = %v, want ErrInvalidABI", s, err)
+		}
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	a, err := Parse([]byte(tokenABI))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	transfer, _ := a.Method("transfer")
+	data, err := transfer.EncodeNamedArgs(map[string]any{"to": "bob", "amount": 100})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	want := []byte{3, 0, 0, 0, 'b', 'o', 'b', 100, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("encoded %x, want %x", data, want)
+	}
+	args, err := transfer.DecodeArgs(data)
+	if err != nil || args["to"] != "bob" || args["amount"] != uint64(100) {
+		t.Fatalf("decoded %v %v", args, err)
+	}
+	if _, err := transfer.DecodeArgs(append(data, 0)); !errors.Is(err, ErrDecode) {
+		t.Fatalf("trailing bytes must fail, got %v", err)
+	}
+	if _, err := transfer.DecodeArgs(data[:10]); !errors.Is(err, ErrDecode) {
+		t.Fatalf("short data must fail, got %v", err)
+	}
+	if _, err := transfer.EncodeNamedArgs(map[string]any{"to": "bob"}); !errors.Is(err, ErrEncode) {
+		t.Fatalf("missing argument must fail, got %v", err)
+	}
+	if _, err := transfer.EncodeNamedArgs(map[string]any{"to": "bob", "amount": 1, "fee": 2}); !errors.Is(err, ErrEncode) {
+		t.Fatalf("unknown argument must fail, got %v", err)
+	}
+	if _, err := transfer.EncodeArgs("bob", -1); !errors.Is(err, ErrEncode) {
+		t.Fatalf("negative uint must fail, got %v", err)
+	}
+
+	batch, _ := a.Method("batch")
+	data, err = batch.EncodeArgs([]uint32{1, 70000}, []byte{0xab}, -2)
+	if err != nil {
+		t.Fatalf("encode batch: %v", err)
+	}
+	values, err := Decode(batch.Inputs, data)
+	if err != nil {
+		t.Fatalf("decode batch: %v", err)
+	}
+	if !reflect.DeepEqual(values, []any{[]any{uint32(1), uint32(70000)}, []byte{0xab}, int16(-2)}) {
+		t.Fatalf("decoded %#v", values)
+	}
+	if _, err := batch.EncodeArgs([]uint32{1}, []byte{}, 40000); !errors.Is(err, ErrEncode) {
+		t.Fatalf("out of range int16 must fail, got %v", err)
+	}
+	out, err := batch.DecodeOutputs(append([]byte{2, 0, 0, 0}, "ok"...))
+	if err != nil || out["0"] != "ok" {
+		t.Fatalf("unnamed output: %v %v", out, err)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	cases := []struct {
+		typ, text string
+		want      any
+	}{
+		{"uint8", "255", uint8(255)},
+		{"int64", "-5", int64(-5)},
+		{"bool", "true", true},
+		{"address", "bob", "bob"},
+		{"bytes", "0x0aff", []byte{0x0a, 0xff}},
+		{"uint64[]", "[1,2]", []any{uint64(1), uint64(2)}},
+		{"string[]", `["a","b"]`, []any{"a", "b"}},
+	}
+	for _, c := range cases {
+		got, err := ParseValue(c.typ, c.text)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseValue(%s, %s) = %#v %v", c.typ, c.text, got, err)
+		}
+		if FormatValue(got) != c.text {
+			t.Errorf("FormatValue(%#v) = %s", got, FormatValue(got))
+		}
+	}
+	for _, c := range [][2]string{{"uint8", "256"}, {"int8", "x"}, {"bytes", "zz"}, {"uint64[]", "1,2"}} {
+		if _, err := ParseValue(c[0], c[1]); !errors.Is(err, ErrEncode) {
+			t.Errorf("ParseValue(%s, %s) = %v, want ErrEncode", c[0], c[1], err)
+		}
+	}
+}
+
+func TestDecodeLog(t *testing.T) {
+	a, err := Parse([]byte(tokenABI))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	e, _ := a.Event("Transfer")
+	from, _ := Topic("address", "alice")
+	amount, _ := Topic("uint64", uint64(7))
+	data, _ := Encode([]Param{{Type: "string"}}, []any{"hi"})
+	got, values, err := a.DecodeLog([]string{e.ID(), from, amount}, data)
+	if err != nil || got != e {
+		t.Fatalf("decode log: %v", err)
+	}
+	if values["from"] != from || values["amount"] != uint64(7) || values["memo"] != "hi" {
+		t.Fatalf("decoded %v", values)
+	}
+	if _, _, err := a.DecodeLog([]string{amount}, nil); !errors.Is(err, ErrDecode) {
+		t.Fatalf("unknown event must fail, got %v", err)
+	}
+}
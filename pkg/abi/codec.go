@@ -0,0 +1,354 @@
+package abi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// abiType is a parsed type name.
+type abiType struct {
+	name string   // the full type name, such as "uint64[]"
+	kind string   // bool, uint, int, string, bytes, address or array
+	bits int      // width of uint and int types
+	elem *abiType // element type of arrays
+}
+
+func parseType(name string) (*abiType, error) {
+	if elem, ok := strings.CutSuffix(name, "[]"); ok {
+		e, err := parseType(elem)
+		if err != nil {
+			return nil, err
+		}
+		return &abiType{name: name, kind: "array", elem: e}, nil
+	}
+	switch name {
+	case "bool", "string", "bytes", "address":
+		return &abiType{name: name, kind: name}, nil
+	case "uint8", "uint16", "uint32", "uint64":
+		n, _ := strconv.Atoi(name[4:])
+		return &abiType{name: name, kind: "uint", bits: n}, nil
+	case "int8", "int16", "int32", "int64":
+		n, _ := strconv.Atoi(name[3:])
+		return &abiType{name: name, kind: "int", bits: n}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", name)
+}
+
+// size returns the encoded size of fixed size types and 0 for the others.
+func (t *abiType) size() int {
+	switch t.kind {
+	case "bool":
+		return 1
+	case "uint", "int":
+		return t.bits / 8
+	}
+	return 0
+}
+
+// Encode encodes values as the given parameters. Unsigned values accept any
+// Go integer in range, signed values any Go integer in range, bool a bool,
+// string and address a string, bytes a []byte and arrays any slice.
+func Encode(params []Param, values []any) ([]byte, error) {
+	if len(values) != len(params) {
+		return nil, fmt.Errorf("%w: %d values for %d parameters", ErrEncode, len(values), len(params))
+	}
+	var out []byte
+	for i, p := range params {
+		t, err := parseType(p.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEncode, err)
+		}
+		if out, err = t.encode(out, values[i]); err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, p.key(i))
+		}
+	}
+	return out, nil
+}
+
+// Decode decodes data as the given parameters in order. It fails unless data
+// holds exactly those values. Values decode as bool, the Go integer type of
+// their width, string, []byte or, for arrays, []any.
+func Decode(params []Param, data []byte) ([]any, error) {
+	values := make([]any, len(params))
+	for i, p := range params {
+		t, err := parseType(p.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+		}
+		var n int
+		if values[i], n, err = t.decode(data); err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, p.key(i))
+		}
+		data = data[n:]
+	}
+	if len(data) > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrDecode, len(data))
+	}
+	return values, nil
+}
+
+// DecodeNamed decodes data like Decode and keys the values by parameter
+// name, or by position for unnamed parameters.
+func DecodeNamed(params []Param, data []byte) (map[string]any, error) {
+	values, err := Decode(params, data)
+	if err != nil {
+		return nil, err
+	}
+	named := make(map[string]any, len(values))
+	for i, p := range params {
+		named[p.key(i)] = values[i]
+	}
+	return named, nil
+}
+
+func (t *abiType) encode(out []byte, v any) ([]byte, error) {
+	switch t.kind {
+	case "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s needs a bool, got %T", ErrEncode, t.name, v)
+		}
+		if b {
+			return append(out, 1), nil
+		}
+		return append(out, 0), nil
+	case "uint":
+		n, ok := toUint(v)
+		if !ok || (t.bits < 64 && n >= 1<<t.bits) {
+			return nil, fmt.Errorf("%w: %v is not a %s", ErrEncode, v, t.name)
+		}
+		return appendLE(out, n, t.bits/8), nil
+	case "int":
+		n, ok := toInt(v)
+		if !ok || (t.bits < 64 && (n < -1<<(t.bits-1) || n >= 1<<(t.bits-1))) {
+			return nil, fmt.Errorf("%w: %v is not an %s", ErrEncode, v, t.name)
+		}
+		return appendLE(out, uint64(n), t.bits/8), nil
+	case "string", "address":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s needs a string, got %T", ErrEncode, t.name, v)
+		}
+		if t.kind == "address" && s == "" {
+			return nil, fmt.Errorf("%w: empty address", ErrEncode)
+		}
+		return appendBytes(out, []byte(s)), nil
+	case "bytes":
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("%w: bytes needs a []byte, got %T", ErrEncode, v)
+		}
+		return appendBytes(out, b), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w: %s needs a slice, got %T", ErrEncode, t.name, v)
+	}
+	if rv.Len() > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: %s too long", ErrEncode, t.name)
+	}
+	out = binary.LittleEndian.AppendUint32(out, uint32(rv.Len()))
+	for i := 0; i < rv.Len(); i++ {
+		var err error
+		if out, err = t.elem.encode(out, rv.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (t *abiType) decode(data []byte) (any, int, error) {
+	if n := t.size(); n > 0 {
+		if len(data) < n {
+			return nil, 0, fmt.Errorf("%w: %s needs %d bytes, %d left", ErrDecode, t.name, n, len(data))
+		}
+		var u uint64
+		for i := n - 1; i >= 0; i-- {
+			u = u<<8 | uint64(data[i])
+		}
+		switch {
+		case t.kind == "bool":
+			if u > 1 {
+				return nil, 0, fmt.Errorf("%w: invalid bool %d", ErrDecode, u)
+			}
+			return u == 1, n, nil
+		case t.kind == "uint":
+			return sizedUint(u, t.bits), n, nil
+		default:
+			shift := 64 - t.bits
+			return sizedInt(int64(u<<shift)>>shift, t.bits), n, nil
+		}
+	}
+	if len(data) < 4 {
+		return nil, 0, fmt.Errorf("%w: %s needs a length, %d bytes left", ErrDecode, t.name, len(data))
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	data, read := data[4:], 4
+	if t.kind != "array" {
+		if len(data) < count {
+			return nil, 0, fmt.Errorf("%w: %s of %d bytes, %d left", ErrDecode, t.name, count, len(data))
+		}
+		if t.kind == "bytes" {
+			return append([]byte{}, data[:count]...), read + count, nil
+		}
+		return string(data[:count]), read + count, nil
+	}
+	var elems []any
+	for i := 0; i < count; i++ {
+		v, n, err := t.elem.decode(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		elems = append(elems, v)
+		data, read = data[n:], read+n
+	}
+	return elems, read, nil
+}
+
+func appendLE(out []byte, v uint64, n int) []byte {
+	for i := 0; i < n; i++ {
+		out = append(out, byte(v>>(8*i)))
+	}
+	return out
+}
+
+func appendBytes(out, b []byte) []byte {
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(b)))
+	return append(out, b...)
+}
+
+func sizedUint(v uint64, bits int) any {
+	switch bits {
+	case 8:
+		return uint8(v)
+	case 16:
+		return uint16(v)
+	case 32:
+		return uint32(v)
+	}
+	return v
+}
+
+func sizedInt(v int64, bits int) any {
+	switch bits {
+	case 8:
+		return int8(v)
+	case 16:
+		return int16(v)
+	case 32:
+		return int32(v)
+	}
+	return v
+}
+
+func toUint(v any) (uint64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() >= 0 {
+			return uint64(rv.Int()), true
+		}
+	}
+	return 0, false
+}
+
+func toInt(v any) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() <= math.MaxInt64 {
+			return int64(rv.Uint()), true
+		}
+	}
+	return 0, false
+}
+
+// ParseValue parses the text form of a value of the given type, as typed on
+// a command line. Integers are decimal, bool is true or false, bytes are hex
+// with an optional 0x prefix and arrays are JSON arrays such as [1,2,3] or
+// ["a","b"].
+func ParseValue(typ, text string) (any, error) {
+	t, err := parseType(typ)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEncode, err)
+	}
+	return t.parse(text)
+}
+
+func (t *abiType) parse(text string) (any, error) {
+	switch t.kind {
+	case "bool":
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a bool", ErrEncode, text)
+		}
+		return b, nil
+	case "uint":
+		n, err := strconv.ParseUint(text, 10, t.bits)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a %s", ErrEncode, text, t.name)
+		}
+		return sizedUint(n, t.bits), nil
+	case "int":
+		n, err := strconv.ParseInt(text, 10, t.bits)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not an %s", ErrEncode, text, t.name)
+		}
+		return sizedInt(n, t.bits), nil
+	case "string", "address":
+		return text, nil
+	case "bytes":
+		b, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not hex", ErrEncode, text)
+		}
+		return b, nil
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, fmt.Errorf("%w: %s needs a JSON array: %v", ErrEncode, t.name, err)
+	}
+	elems := make([]any, len(raw))
+	for i, r := range raw {
+		var s string
+		if err := json.Unmarshal(r, &s); err != nil {
+			s = string(r)
+		}
+		v, err := t.elem.parse(s)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = v
+	}
+	return elems, nil
+}
+
+// FormatValue returns the text form of a decoded value, the inverse of
+// ParseValue.
+func FormatValue(v any) string {
+	switch v := v.(type) {
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			if s, ok := e.(string); ok {
+				parts[i] = strconv.Quote(s)
+			} else {
+				parts[i] = FormatValue(e)
+			}
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	}
+	return fmt.Sprint(v)
+}
@@ -26,7 +26,11 @@ log() {
   shift
   local ts="$(log_timestamp)"
   local msg="$*"
-  printf '%s [%s] %s\n' "$ts" "$level" "$msg"
+  if [[ "$level" == ERROR || "$level" == WARN ]]; then
+    printf '%s [%s] %s\n' "$ts" "$level" "$msg" >&2
+  else
+    printf '%s [%s] %s\n' "$ts" "$level" "$msg"
+  fi
   if [[ -n "$LOG_FILE" ]]; then
     printf '%s [%s] %s\n' "$ts" "$level" "$msg" >>"$LOG_FILE"
   fi
@@ -98,6 +98,13 @@ func TestNetworkHarness(t *testing.T) {
 		t.Fatalf("cli address parse failed: %v %s", err, out)
 	}
 
+	// The server keeps the new wallet's key, so transactions on the in-memory
+	// network are signed by a local wallet instead.
+	signer, err := core.NewWallet()
+	if err != nil {
+		t.Fatalf("local wallet: %v", err)
+	}
+
 	// Build an in-memory network with biometric authentication
 	svc := core.NewBiometricService()
 	network := core.NewNetwork(svc)
@@ -105,8 +112,8 @@ func TestNetworkHarness(t *testing.T) {
 	n2 := core.NewNode("n2", "addr2", core.NewLedger())
 	network.AddNode(n1)
 	network.AddNode(n2)
-	n1.Ledger.Credit(data.Address, 100)
-	n2.Ledger.Credit(data.Address, 100)
+	n1.Ledger.Credit(signer.Address, 100)
+	n2.Ledger.Credit(signer.Address, 100)
 
 	// Enrol biometric data for the new wallet
 	bio := []byte("finger")
@@ -114,19 +121,25 @@ func TestNetworkHarness(t *testing.T) {
 	if err != nil {
 		t.Fatalf("gen key: %v", err)
 	}
-	if err := svc.Enroll(data.Address, bio, pub); err != nil {
+	if err := svc.Enroll(signer.Address, bio, pub); err != nil {
 		t.Fatalf("enroll: %v", err)
 	}
 	h := sha256.Sum256(bio)
 	sig := ed25519.Sign(priv, h[:])
 
 	// Broadcast a simple transaction through the network
-	tx := core.NewTransaction(data.Address, "recipient", 1, 1, 1)
-	if err := network.Broadcast(tx, data.Address, bio, sig); err != nil {
+	tx := core.NewTransaction(signer.Address, "recipient", 1, 1, 0)
+	if err := tx.AttachBiometric(signer.Address, bio, sig, svc); err != nil {
+		t.Fatalf("attach biometric: %v", err)
+	}
+	if _, err := signer.Sign(tx); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := network.Broadcast(tx, signer.Address, bio, sig); err != nil {
 		t.Fatalf("broadcast failed: %v", err)
 	}
 	time.Sleep(100 * time.Millisecond)
-	if len(n1.Mempool) != 1 || len(n2.Mempool) != 1 {
+	if n1.Mempool.Len() != 1 || n2.Mempool.Len() != 1 {
 		t.Fatalf("transaction not received by all nodes")
 	}
 
@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"sync"
 
 	"synnergy/core"
 	"synnergy/internal/log"
 )
 
-type server struct{}
+// txSimulator runs a transaction against node state without applying it.
+type txSimulator interface {
+	Simulate(ctx context.Context, tx *core.Transaction) (*core.Simulation, error)
+}
+
+type server struct {
+	mu      sync.Mutex
+	wallets map[string]*core.Wallet
+	// node simulates transactions before they are signed; signing skips the
+	// check when it is nil.
+	node txSimulator
+}
 
-func newServer() *server { return &server{} }
+func newServer() *server { return &server{wallets: make(map[string]*core.Wallet)} }
 
 func (s *server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -28,6 +41,66 @@ func (s *server) newWalletHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	s.mu.Lock()
+	s.wallets[wallet.Address] = wallet
+	s.mu.Unlock()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"address": wallet.Address})
 }
+
+type signTxRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount uint64 `json:"amount"`
+	Fee    uint64 `json:"fee"`
+	MaxFee uint64 `json:"max_fee"`
+	Tip    uint64 `json:"tip"`
+	Nonce  uint64 `json:"nonce"`
+}
+
+// signTxHandler signs a transfer from a wallet created by the server. The
+// transaction is simulated first and not signed if the node would reject it.
+func (s *server) signTxHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req signTxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	wallet, ok := s.wallets[req.From]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "wallet not found", http.StatusNotFound)
+		return
+	}
+	tx := core.NewTransaction(req.From, req.To, req.Amount, req.Fee, req.Nonce)
+	if req.MaxFee > 0 {
+		tx = core.NewDynamicFeeTransaction(req.From, req.To, req.Amount, req.MaxFee, req.Tip, req.Nonce)
+	}
+	var sim *core.Simulation
+	if s.node != nil {
+		var err error
+		if sim, err = s.node.Simulate(r.Context(), tx); err != nil {
+			log.Error("transaction simulation failed", "err", err)
+			http.Error(w, "simulation unavailable", http.StatusBadGateway)
+			return
+		}
+		if sim.Error != "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]any{"error": sim.Error, "simulation": sim})
+			return
+		}
+	}
+	if _, err := wallet.Sign(tx); err != nil {
+		log.Error("transaction signing failed", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"transaction": tx, "simulation": sim})
+}
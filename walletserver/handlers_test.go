@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"synnergy/core"
 )
 
 func TestNewWalletHandler(t *testing.T) {
@@ -33,3 +37,52 @@ func TestHealthHandler(t *testing.T) {
 		t.Fatalf("unexpected status: %d", w.Code)
 	}
 }
+
+type ledgerSimulator struct{ l *core.Ledger }
+
+func (s ledgerSimulator) Simulate(_ context.Context, tx *core.Transaction) (*core.Simulation, error) {
+	return s.l.Simulate(tx)
+}
+
+func TestSignTxHandler(t *testing.T) {
+	l := core.NewLedger()
+	srv := newServer()
+	srv.node = ledgerSimulator{l}
+	w := httptest.NewRecorder()
+	srv.newWalletHandler(w, httptest.NewRequest(http.MethodPost, "/wallet/new", nil))
+	var wallet struct{ Address string }
+	if err := json.Unmarshal(w.Body.Bytes(), &wallet); err != nil {
+		t.Fatalf("decode wallet: %v", err)
+	}
+	l.Credit(wallet.Address, 100)
+
+	sign := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.signTxHandler(w, httptest.NewRequest(http.MethodPost, "/tx/sign", strings.NewReader(body)))
+		return w
+	}
+	w = sign(`{"from":"` + wallet.Address + `","to":"bob","amount":500,"fee":1}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "insufficient funds") {
+		t.Fatalf("expected the simulation to stop signing: %d %s", w.Code, w.Body)
+	}
+	w = sign(`{"from":"` + wallet.Address + `","to":"bob","amount":50,"fee":1}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("sign: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Transaction core.Transaction
+		Simulation  core.Simulation
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode signed transaction: %v", err)
+	}
+	if len(resp.Simulation.Diff.Balances) != 2 {
+		t.Fatalf("unexpected simulation %+v", resp.Simulation)
+	}
+	if err := l.ApplyTransaction(&resp.Transaction); err != nil || l.GetBalance("bob") != 50 {
+		t.Fatalf("signed transaction must apply: %v", err)
+	}
+	if w = sign(`{"from":"mallory","to":"bob","amount":1}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown wallet, got %d", w.Code)
+	}
+}
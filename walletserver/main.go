@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
 
+	"synnergy/core"
 	"synnergy/internal/log"
+	"synnergy/internal/rpc"
 )
 
 var httpListenAndServe = http.ListenAndServe
@@ -12,12 +16,34 @@ func run(addr string, srv *server) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", srv.healthHandler)
 	mux.HandleFunc("/wallet/new", srv.newWalletHandler)
+	mux.HandleFunc("/tx/sign", srv.signTxHandler)
 	log.Info("wallet server listening", "addr", addr)
 	return httpListenAndServe(addr, mux)
 }
 
+// rpcSimulator simulates transactions on the node serving JSON-RPC at
+// endpoint.
+type rpcSimulator struct{ client *rpc.Client }
+
+func (s rpcSimulator) Simulate(ctx context.Context, tx *core.Transaction) (*core.Simulation, error) {
+	var sim core.Simulation
+	if err := s.client.Call(ctx, "tx_simulate", tx, &sim); err != nil {
+		return nil, err
+	}
+	return &sim, nil
+}
+
 func main() {
-	if err := run(":8080", newServer()); err != nil {
+	srv := newServer()
+	if endpoint := os.Getenv("SYN_RPC"); endpoint != "" {
+		c, err := rpc.Dial(endpoint)
+		if err != nil {
+			log.Error("invalid node endpoint", "err", err)
+			os.Exit(1)
+		}
+		srv.node = rpcSimulator{client: c}
+	}
+	if err := run(":8080", srv); err != nil {
 		log.Error("server shutdown", "err", err)
 	}
 }